@@ -0,0 +1,48 @@
+package buildinfo
+
+import "runtime/debug"
+
+// Info identifies the build of the gateway.
+type Info struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit"`
+	Date    string `json:"date"`
+}
+
+// Resolve returns the build info injected at build time with -ldflags. The
+// values left empty are taken from the build info the Go toolchain embeds
+// in the binary, and are "unknown" when it has none either.
+func Resolve(version, commit, date string) Info {
+	return resolve(version, commit, date, debug.ReadBuildInfo)
+}
+
+func resolve(version, commit, date string, read func() (*debug.BuildInfo, bool)) Info {
+	info := Info{
+		Version: version,
+		Commit:  commit,
+		Date:    date,
+	}
+
+	if build, ok := read(); ok {
+		if info.Version == "" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+			info.Version = build.Main.Version
+		}
+
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.Date == "":
+				info.Date = setting.Value
+			}
+		}
+	}
+
+	for _, value := range []*string{&info.Version, &info.Commit, &info.Date} {
+		if *value == "" {
+			*value = "unknown"
+		}
+	}
+
+	return info
+}
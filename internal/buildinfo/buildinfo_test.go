@@ -0,0 +1,29 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	embedded := func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{
+			Main: debug.Module{Version: "v1.2.3"},
+			Settings: []debug.BuildSetting{
+				{Key: "vcs.revision", Value: "abc123"},
+				{Key: "vcs.time", Value: "2024-01-01T00:00:00Z"},
+			},
+		}, true
+	}
+
+	assert.Equal(t, Info{Version: "v2.0.0", Commit: "def456", Date: "2024-02-02"},
+		resolve("v2.0.0", "def456", "2024-02-02", embedded))
+
+	assert.Equal(t, Info{Version: "v1.2.3", Commit: "abc123", Date: "2024-01-01T00:00:00Z"},
+		resolve("", "", "", embedded))
+
+	assert.Equal(t, Info{Version: "unknown", Commit: "unknown", Date: "unknown"},
+		resolve("", "", "", func() (*debug.BuildInfo, bool) { return nil, false }))
+}
@@ -1,5 +1,87 @@
 package metrics
 
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultPrefix is the namespace prepended to every metric name when no
+	// prefix is configured.
+	DefaultPrefix = "zeroex"
+)
+
 type Config struct {
-	Port uint `yaml:"port"`
+	// Port serves the metrics, 0 picks an ephemeral port.
+	Port            uint      `yaml:"port"`
+	Prefix          string    `yaml:"prefix"`
+	DurationBuckets []float64 `yaml:"durationBuckets"`
+
+	// Required makes the gateway fail when the metrics port cannot be
+	// bound. Otherwise the failure is logged and the bind is retried in
+	// the background. Defaults to true.
+	Required *bool `yaml:"required"`
+
+	// Host is the address the metrics are bound to, every address when
+	// empty. The self-check binds them to the loopback.
+	Host string `yaml:"-"`
+
+	// Listen binds the metrics port, net.Listen when nil. The gateway binds
+	// it like its own ports.
+	Listen func(address string) (net.Listener, error) `yaml:"-"`
+}
+
+func (c Config) required() bool {
+	return c.Required == nil || *c.Required
+}
+
+// DefaultDurationBuckets returns the histogram buckets (in seconds) used for
+// duration metrics when none are configured.
+func DefaultDurationBuckets() []float64 {
+	return []float64{
+		.025,
+		.05,
+		.1,
+		.25,
+		.5,
+		1,
+		2.5,
+		5,
+		10,
+		15,
+		20,
+		25,
+		30,
+	}
+}
+
+// Namespace returns the configured metric prefix or the default one.
+func (c Config) Namespace() string {
+	if c.Prefix == "" {
+		return DefaultPrefix
+	}
+
+	return c.Prefix
+}
+
+// Buckets returns the configured duration buckets or the default ones.
+func (c Config) Buckets() []float64 {
+	if len(c.DurationBuckets) == 0 {
+		return DefaultDurationBuckets()
+	}
+
+	return c.DurationBuckets
+}
+
+// Validate makes sure the duration buckets are in strictly ascending order.
+func (c Config) Validate() error {
+	for i := 1; i < len(c.DurationBuckets); i++ {
+		if c.DurationBuckets[i] <= c.DurationBuckets[i-1] {
+			return errors.Errorf("durationBuckets must be in ascending order, got %v after %v",
+				c.DurationBuckets[i], c.DurationBuckets[i-1])
+		}
+	}
+
+	return nil
 }
@@ -1,40 +1,175 @@
 package metrics
 
 import (
-	"fmt"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
+// bindRetryInterval is how often the port is bound again when the metrics
+// aren't required and the port is unavailable.
+const bindRetryInterval = 10 * time.Second
+
 type Server struct {
-	server *http.Server
+	server        *http.Server
+	listenFunc    func(address string) (net.Listener, error)
+	required      bool
+	retryInterval time.Duration
+	logger        *slog.Logger
+
+	mu   sync.Mutex
+	addr net.Addr
+
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
+// Start serves the metrics until Stop is called. When the metrics aren't
+// required, a port that cannot be bound is logged and retried instead of
+// returned.
 func (s *Server) Start() error {
-	return s.server.ListenAndServe()
+	listener, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	if listener == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	s.addr = listener.Addr()
+	s.mu.Unlock()
+
+	s.logger.Info("metrics server listening", "addr", listener.Addr().String())
+
+	if err := s.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// listen binds the port. It returns a nil listener when Stop was called
+// before the port could be bound.
+func (s *Server) listen() (net.Listener, error) {
+	for {
+		listener, err := s.listenFunc(s.server.Addr)
+		if err == nil {
+			return listener, nil
+		}
+
+		if s.required {
+			return nil, err
+		}
+
+		s.logger.Warn("cannot bind metrics port, retrying", "addr", s.server.Addr,
+			"error", err, "retryIn", s.retryInterval)
+
+		select {
+		case <-time.After(s.retryInterval):
+		case <-s.stop:
+			return nil, nil
+		}
+	}
+}
+
+// Addr returns the address the metrics are served on, nil until the port is
+// bound. It tells which port was picked when the configured one is 0.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addr
 }
 
 func (s *Server) Stop() error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
 	return s.server.Close()
 }
 
-func NewServer(config Config) *Server {
+// NewServer creates the metrics server. Metrics are gathered from the given
+// gatherer, or from the Prometheus default registry when nil. /readyz answers
+// 503 until ready is closed, a nil ready is always ready. / renders the status
+// page of the providers listed by status, unless it's nil. /version returns
+// build as JSON.
+func NewServer(
+	config Config,
+	gatherer prometheus.Gatherer,
+	logger *slog.Logger,
+	ready <-chan struct{},
+	status StatusSource,
+	build buildinfo.Info,
+) *Server {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Heartbeat("/healthz"))
-	r.Handle("/metrics", promhttp.Handler())
+
+	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if ready != nil {
+			select {
+			case <-ready:
+			default:
+				w.WriteHeader(http.StatusServiceUnavailable)
+
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	if gatherer == nil {
+		r.Handle("/metrics", promhttp.Handler())
+	} else {
+		r.Handle("/metrics", promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}))
+	}
+
+	if status != nil {
+		r.Get("/", newStatusHandler(status).ServeHTTP)
+	}
+
+	r.Get("/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		json.NewEncoder(w).Encode(build) // nolint:errcheck
+	})
+
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	listen := config.Listen
+	if listen == nil {
+		listen = func(address string) (net.Listener, error) {
+			return net.Listen("tcp", address)
+		}
+	}
 
 	return &Server{
 		server: &http.Server{
 			Handler:           r,
-			Addr:              fmt.Sprintf(":%d", config.Port),
+			Addr:              net.JoinHostPort(config.Host, strconv.FormatUint(uint64(config.Port), 10)),
 			WriteTimeout:      time.Second * 15,
 			ReadTimeout:       time.Second * 15,
 			ReadHeaderTimeout: time.Second * 5,
 		},
+		listenFunc:    listen,
+		required:      config.required(),
+		retryInterval: bindRetryInterval,
+		logger:        logger,
+		stop:          make(chan struct{}),
 	}
 }
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func TestServerRetriesUnavailablePort(t *testing.T) {
+	occupied, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+
+	port := occupied.Addr().(*net.TCPAddr).Port
+	required := false
+
+	s := NewServer(
+		Config{Port: uint(port), Required: &required},
+		prometheus.NewRegistry(),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		nil,
+		nil,
+		buildinfo.Info{},
+	)
+	s.retryInterval = 10 * time.Millisecond
+
+	started := make(chan error)
+
+	go func() {
+		started <- s.Start()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, s.Addr())
+
+	occupied.Close()
+
+	assert.Eventually(t, func() bool { return s.Addr() != nil }, time.Second, time.Millisecond)
+	assert.Equal(t, port, s.Addr().(*net.TCPAddr).Port)
+
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, <-started)
+}
+
+func TestServerStopsWhileRetrying(t *testing.T) {
+	occupied, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+
+	defer occupied.Close()
+
+	required := false
+
+	s := NewServer(
+		Config{Port: uint(occupied.Addr().(*net.TCPAddr).Port), Required: &required},
+		prometheus.NewRegistry(),
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+		nil,
+		nil,
+		buildinfo.Info{},
+	)
+
+	started := make(chan error)
+
+	go func() {
+		started <- s.Start()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+
+	assert.NoError(t, s.Stop())
+	assert.NoError(t, <-started)
+}
+
+func TestServerReadiness(t *testing.T) {
+	ready := make(chan struct{})
+	s := NewServer(Config{}, prometheus.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ready, nil, buildinfo.Info{})
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	close(ready)
+
+	rec = httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestServerVersion(t *testing.T) {
+	build := buildinfo.Info{Version: "v1.2.3", Commit: "abc123", Date: "2024-01-01"}
+
+	s := NewServer(Config{}, prometheus.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		nil, nil, build)
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"version":"v1.2.3","commit":"abc123","date":"2024-01-01"}`, rec.Body.String())
+}
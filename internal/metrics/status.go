@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+//go:embed templates/status.html.tmpl
+var statusTemplates embed.FS //nolint:gochecknoglobals
+
+// statusRefreshInterval is how often the status page reloads itself.
+const statusRefreshInterval = 5 * time.Second
+
+// ProviderStatus is the status of a provider, as shown on the status page.
+type ProviderStatus struct {
+	Name    string
+	State   string
+	Healthy bool
+	Taints  []string
+
+	// WriteHealthy tells whether the provider accepts transactions, as
+	// opposed to Healthy which is about reads.
+	WriteHealthy bool
+
+	// BlockNumber is the last one observed, and Lag how far it is behind the
+	// highest block of the providers. Both are 0 when unknown.
+	BlockNumber uint64
+	Lag         uint64
+
+	// SuccessRate is the one of the rolling window, which holds
+	// Observations outcomes.
+	SuccessRate  float64
+	Observations int
+
+	// Score ranks the providers from 0 to 1, the higher the better.
+	Score float64
+
+	LastError     string
+	LastErrorTime time.Time
+}
+
+// Status returns the value of the State column: the state of the provider
+// when it isn't serving, its health otherwise.
+func (p ProviderStatus) Status() string {
+	switch {
+	case p.State != "" && p.State != "active":
+		return p.State
+	case !p.Healthy:
+		return "unhealthy"
+	case len(p.Taints) > 0:
+		return "tainted"
+	default:
+		return "healthy"
+	}
+}
+
+// StatusSource lists the providers shown on the status page.
+type StatusSource interface {
+	ProviderStatuses() []ProviderStatus
+}
+
+type statusPage struct {
+	Providers       []ProviderStatus
+	RefreshInterval int
+	GeneratedAt     time.Time
+}
+
+// newStatusHandler renders the status page of source. The page has no
+// external assets, so it works wherever the metrics can be reached.
+func newStatusHandler(source StatusSource) http.Handler {
+	page := template.Must(template.New("status.html.tmpl").Funcs(template.FuncMap{
+		"percent": func(rate float64) string {
+			return fmt.Sprintf("%.1f%%", rate*100)
+		},
+	}).ParseFS(statusTemplates, "templates/status.html.tmpl"))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		page.Execute(w, statusPage{ // nolint:errcheck
+			Providers:       source.ProviderStatuses(),
+			RefreshInterval: int(statusRefreshInterval.Seconds()),
+			GeneratedAt:     time.Now().UTC(),
+		})
+	})
+}
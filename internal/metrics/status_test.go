@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStatusSource []ProviderStatus
+
+func (s fakeStatusSource) ProviderStatuses() []ProviderStatus {
+	return s
+}
+
+func TestServerStatusPage(t *testing.T) {
+	source := fakeStatusSource{
+		{
+			Name:         "Alchemy",
+			State:        "active",
+			Healthy:      true,
+			WriteHealthy: true,
+			BlockNumber:  100,
+			SuccessRate:  0.995,
+			Observations: 200,
+		},
+		{
+			Name:        "Infura",
+			State:       "active",
+			Healthy:     true,
+			Taints:      []string{"manual", "error_rate (logs)"},
+			BlockNumber: 97,
+			Lag:         3,
+		},
+		{
+			Name:          "<Cloudflare>",
+			State:         "active",
+			LastError:     "eth_call HTTP 502 connection refused",
+			LastErrorTime: time.Date(2024, 1, 1, 12, 30, 0, 0, time.UTC),
+		},
+		{
+			Name:    "Ankr",
+			State:   "draining",
+			Healthy: true,
+		},
+	}
+
+	s := NewServer(Config{}, prometheus.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		nil, source, buildinfo.Info{})
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	body := rec.Body.String()
+
+	assert.Contains(t, body, `<meta http-equiv="refresh" content="5">`)
+	assert.Contains(t, body, `<td>Alchemy</td>`)
+	assert.Contains(t, body, `<span class="status healthy">healthy</span>`)
+	assert.Contains(t, body, `99.5% of 200`)
+	assert.Contains(t, body, `<td>accepted</td>`)
+	assert.Contains(t, body, `<td><span class="status unhealthy">rejected</span></td>`)
+	assert.Contains(t, body, `<td>Infura</td>`)
+	assert.Contains(t, body, `<span class="status tainted">tainted</span>`)
+	assert.Contains(t, body, `manual, error_rate (logs)`)
+	assert.Contains(t, body, `<td>3</td>`)
+	assert.Contains(t, body, `<td>&lt;Cloudflare&gt;</td>`)
+	assert.Contains(t, body, `<span class="status unhealthy">unhealthy</span>`)
+	assert.Contains(t, body, `12:30:00 eth_call HTTP 502 connection refused`)
+	assert.Contains(t, body, `<span class="status draining">draining</span>`)
+}
+
+func TestServerWithoutStatusPage(t *testing.T) {
+	s := NewServer(Config{}, prometheus.NewRegistry(), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		nil, nil, buildinfo.Info{})
+
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
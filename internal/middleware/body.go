@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-http-utils/headers"
+)
+
+// SetBody replaces the body of r and keeps its framing in agreement with it:
+// ContentLength, the Content-Length header and GetBody follow the new body,
+// and Transfer-Encoding is dropped. The header is cloned first, so the
+// copies of r sharing it keep theirs.
+func SetBody(r *http.Request, body []byte) {
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+
+	header.Set(headers.ContentLength, strconv.Itoa(len(body)))
+	header.Del(headers.TransferEncoding)
+
+	r.Header = header
+	r.TransferEncoding = nil
+	r.ContentLength = int64(len(body))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetBody(t *testing.T) {
+	t.Parallel()
+
+	r := httptest.NewRequest(http.MethodPost, "http://localhost", strings.NewReader("original body"))
+	r.Header.Set(headers.ContentLength, "13")
+	r.Header.Set(headers.TransferEncoding, "chunked")
+	r.TransferEncoding = []string{"chunked"}
+
+	shared := r.Header
+	copied := r.WithContext(r.Context())
+
+	SetBody(copied, []byte("new"))
+
+	assert.Equal(t, int64(3), copied.ContentLength)
+	assert.Equal(t, "3", copied.Header.Get(headers.ContentLength))
+	assert.Empty(t, copied.Header.Get(headers.TransferEncoding))
+	assert.Nil(t, copied.TransferEncoding)
+
+	body, err := io.ReadAll(copied.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(body))
+
+	body2, err := copied.GetBody()
+	assert.NoError(t, err)
+
+	body, err = io.ReadAll(body2)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", string(body))
+
+	// The original request keeps its header.
+	//
+	assert.Equal(t, "13", shared.Get(headers.ContentLength))
+	assert.Equal(t, "chunked", r.Header.Get(headers.TransferEncoding))
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-http-utils/headers"
+)
+
+const (
+	// JSONRPCErrorInvalidRequest is the JSON-RPC code of requests the gateway
+	// refuses to handle.
+	JSONRPCErrorInvalidRequest = -32600
+
+	// JSONRPCErrorInternal is the JSON-RPC code of requests the gateway
+	// couldn't serve.
+	JSONRPCErrorInternal = -32603
+
+	// prettyContentType asks for an indented error body.
+	prettyContentType = "application/json+pretty"
+)
+
+// GatewayError is an error generated by the gateway itself, as opposed to
+// the errors returned by node providers.
+type GatewayError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Code and Message are the JSON-RPC error.
+	Code    int
+	Message string
+
+	// Reason tells machines why the gateway failed the request.
+	Reason string
+	// Attempts and Providers count the upstream attempts made and the
+	// distinct providers they went to.
+	Attempts  int
+	Providers int
+	// RetryAfter is the number of seconds after which the client should
+	// retry, zero when it shouldn't.
+	RetryAfter int
+	// Data is the data of the JSON-RPC error, if any.
+	Data interface{}
+}
+
+type gatewayErrorDetails struct {
+	Reason     string `json:"reason"`
+	Attempts   int    `json:"attempts"`
+	Providers  int    `json:"providers"`
+	RetryAfter int    `json:"retryAfter,omitempty"`
+}
+
+type jsonRPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+type gatewayErrorResponse struct {
+	Jsonrpc string              `json:"jsonrpc"`
+	ID      json.RawMessage     `json:"id"`
+	Error   jsonRPCError        `json:"error"`
+	Gateway gatewayErrorDetails `json:"gateway"`
+}
+
+type jsonRPCIDContextKey struct{}
+
+// WithJSONRPCID sets the id echoed by the errors written for a request. It's
+// kept raw, so that strings and numbers beyond float64 precision are echoed
+// exactly as the client sent them.
+func WithJSONRPCID(c context.Context, id json.RawMessage) context.Context {
+	return context.WithValue(c, jsonRPCIDContextKey{}, id)
+}
+
+// jsonRPCID returns the id set by WithJSONRPCID, nil for null.
+func jsonRPCID(r *http.Request) json.RawMessage {
+	if r == nil {
+		return nil
+	}
+
+	id, _ := r.Context().Value(jsonRPCIDContextKey{}).(json.RawMessage)
+
+	return id
+}
+
+// WriteError writes a gateway generated error. It always uses the JSON-RPC
+// envelope, so clients can decode it the same way as provider responses,
+// and echoes the id set by WithJSONRPCID. The body is indented when the
+// request asks for it with ?pretty=1 or "Accept: application/json+pretty".
+func WriteError(w http.ResponseWriter, r *http.Request, e GatewayError) {
+	w.Header().Set(headers.ContentType, "application/json")
+
+	if e.RetryAfter > 0 {
+		w.Header().Set(headers.RetryAfter, strconv.Itoa(e.RetryAfter))
+	}
+
+	w.WriteHeader(e.StatusCode)
+
+	// Ids are echoed as they were sent, even with HTML characters.
+	//
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+
+	if wantsPretty(r) {
+		encoder.SetIndent("", "  ")
+	}
+
+	encoder.Encode(gatewayErrorResponse{ // nolint:errcheck
+		Jsonrpc: "2.0",
+		ID:      jsonRPCID(r),
+		Error: jsonRPCError{
+			Code:    e.Code,
+			Message: e.Message,
+			Data:    e.Data,
+		},
+		Gateway: gatewayErrorDetails{
+			Reason:     e.Reason,
+			Attempts:   e.Attempts,
+			Providers:  e.Providers,
+			RetryAfter: e.RetryAfter,
+		},
+	})
+}
+
+func wantsPretty(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+
+	if pretty, err := strconv.ParseBool(r.URL.Query().Get("pretty")); err == nil && pretty {
+		return true
+	}
+
+	return strings.Contains(r.Header.Get(headers.Accept), prettyContentType)
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+
+	gatewayError := GatewayError{
+		StatusCode: http.StatusTooManyRequests,
+		Code:       JSONRPCErrorInternal,
+		Message:    "too many requests",
+		Reason:     "queue_full",
+		RetryAfter: 2,
+	}
+
+	expected := `{"jsonrpc":"2.0","id":null,"error":{"code":-32603,"message":"too many requests"},` +
+		`"gateway":{"reason":"queue_full","attempts":0,"providers":0,"retryAfter":2}}`
+
+	tests := []struct {
+		name   string
+		target string
+		accept string
+		pretty bool
+	}{
+		{name: "compact", target: "/"},
+		{name: "pretty query", target: "/?pretty=1", pretty: true},
+		{name: "pretty accept", target: "/", accept: "application/json+pretty", pretty: true},
+		{name: "invalid pretty query", target: "/?pretty=yes"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			request := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.accept != "" {
+				request.Header.Set(headers.Accept, tt.accept)
+			}
+
+			recorder := httptest.NewRecorder()
+
+			WriteError(recorder, request, gatewayError)
+
+			assert.Equal(t, http.StatusTooManyRequests, recorder.Code)
+			assert.Equal(t, "application/json", recorder.Header().Get(headers.ContentType))
+			assert.Equal(t, "2", recorder.Header().Get(headers.RetryAfter))
+			assert.JSONEq(t, expected, recorder.Body.String())
+			assert.Equal(t, tt.pretty, len(recorder.Body.String()) > len(expected)+1)
+		})
+	}
+}
+
+func TestWriteErrorEchoesID(t *testing.T) {
+	t.Parallel()
+
+	for _, id := range []string{`123456789012345678901234567890`, `"<0xabc>"`, `-1.5e3`} {
+		request := httptest.NewRequest(http.MethodPost, "/", nil)
+		request = request.WithContext(WithJSONRPCID(request.Context(), json.RawMessage(id)))
+
+		recorder := httptest.NewRecorder()
+
+		WriteError(recorder, request, GatewayError{StatusCode: http.StatusServiceUnavailable})
+
+		assert.Contains(t, recorder.Body.String(), `"id":`+id+`,`)
+	}
+}
@@ -3,13 +3,37 @@ package middleware
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"errors"
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/go-http-utils/headers"
 )
 
+// gzipReaders recycles the gzip readers, which allocate large buffers.
+//
+//nolint:gochecknoglobals
+var gzipReaders sync.Pool
+
+type gunzipCacheKey struct{}
+
+// gunzipCache holds the decompressed body of a request.
+type gunzipCache struct {
+	once sync.Once
+	body []byte
+	err  error
+}
+
+// WithGunzipCache returns a context under which Gunzip decompresses the body
+// of a request once, however many times the request is replayed. Every
+// replay has to carry the same body.
+func WithGunzipCache(c context.Context) context.Context {
+	return context.WithValue(c, gunzipCacheKey{}, &gunzipCache{})
+}
+
 func Gunzip(next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		// Skip if not gzip.
@@ -20,23 +44,76 @@ func Gunzip(next http.Handler) http.Handler {
 			return
 		}
 
-		body := &bytes.Buffer{}
-
-		g, err := gzip.NewReader(r.Body)
+		body, err := decompressBody(r)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		}
+			writeGzipError(w, r, err)
 
-		if _, err := io.Copy(body, g); err != nil { // nolint:gosec
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
 		}
 
+		SetBody(r, body)
 		r.Header.Del(headers.ContentEncoding)
-		r.Body = io.NopCloser(body)
-		r.ContentLength = int64(body.Len())
 
 		next.ServeHTTP(w, r)
 	}
 
 	return http.HandlerFunc(fn)
 }
+
+// decompressBody returns the decompressed body of r, from the cache of its
+// context when there's one.
+func decompressBody(r *http.Request) ([]byte, error) {
+	cache, ok := r.Context().Value(gunzipCacheKey{}).(*gunzipCache)
+	if !ok {
+		return gunzip(r.Body)
+	}
+
+	cache.once.Do(func() {
+		cache.body, cache.err = gunzip(r.Body)
+	})
+
+	return cache.body, cache.err
+}
+
+func gunzip(compressed io.Reader) ([]byte, error) {
+	g, ok := gzipReaders.Get().(*gzip.Reader)
+	if !ok {
+		g = &gzip.Reader{}
+	}
+	defer gzipReaders.Put(g)
+
+	if err := g.Reset(compressed); err != nil {
+		return nil, err
+	}
+
+	body := &bytes.Buffer{}
+
+	if _, err := io.Copy(body, g); err != nil { // nolint:gosec
+		return nil, err
+	}
+
+	return body.Bytes(), nil
+}
+
+// writeGzipError answers a request whose body couldn't be decompressed, 413
+// when it's larger than allowed and 400 otherwise: the client sent it.
+func writeGzipError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		WriteError(w, r, GatewayError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Code:       JSONRPCErrorInvalidRequest,
+			Message:    "request body too large",
+			Reason:     "request_too_large",
+		})
+
+		return
+	}
+
+	WriteError(w, r, GatewayError{
+		StatusCode: http.StatusBadRequest,
+		Code:       JSONRPCErrorInvalidRequest,
+		Message:    "cannot decompress request body",
+		Reason:     "invalid_gzip_body",
+	})
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -69,3 +70,114 @@ func TestGunzip(t *testing.T) {
 				httptest.NewRequest(http.MethodPost, "http://localhost", bytes.NewBufferString(ethChainID)))
 	})
 }
+
+func gzipBody(t testing.TB, body []byte) []byte {
+	t.Helper()
+
+	compressed := &bytes.Buffer{}
+	w := gzip.NewWriter(compressed)
+
+	_, err := w.Write(body)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	return compressed.Bytes()
+}
+
+func TestGunzipCache(t *testing.T) {
+	t.Parallel()
+
+	ethChainID := `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`
+	compressed := gzipBody(t, []byte(ethChainID))
+
+	var bodies []string
+
+	handler := Gunzip(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		bodies = append(bodies, string(body))
+	}))
+
+	c := WithGunzipCache(context.Background())
+
+	request := httptest.NewRequest(http.MethodPost, "http://localhost", bytes.NewReader(compressed)).WithContext(c)
+	request.Header.Set(headers.ContentEncoding, "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	// The replay isn't decompressed again, so its body doesn't matter.
+	//
+	replay := httptest.NewRequest(http.MethodPost, "http://localhost", strings.NewReader("not gzip")).WithContext(c)
+	replay.Header.Set(headers.ContentEncoding, "gzip")
+	handler.ServeHTTP(httptest.NewRecorder(), replay)
+
+	assert.Equal(t, []string{ethChainID, ethChainID}, bodies)
+}
+
+func TestGunzipInvalidBody(t *testing.T) {
+	t.Parallel()
+
+	for i := 0; i < 2; i++ {
+		request := httptest.NewRequest(http.MethodPost, "http://localhost", strings.NewReader("not gzip"))
+		request.Header.Set(headers.ContentEncoding, "gzip")
+
+		rec := httptest.NewRecorder()
+		Gunzip(http.NotFoundHandler()).ServeHTTP(rec, request)
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"invalid_gzip_body"`)
+	}
+}
+
+func TestGunzipBodyTooLarge(t *testing.T) {
+	t.Parallel()
+
+	compressed := gzipBody(t, bytes.Repeat([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`), 100))
+
+	request := httptest.NewRequest(http.MethodPost, "http://localhost", bytes.NewReader(compressed))
+	request.Header.Set(headers.ContentEncoding, "gzip")
+
+	rec := httptest.NewRecorder()
+	request.Body = http.MaxBytesReader(rec, request.Body, int64(len(compressed)/2))
+
+	Gunzip(http.NotFoundHandler()).ServeHTTP(rec, request)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"request_too_large"`)
+}
+
+// BenchmarkGunzipReplays decompresses a request replayed to three targets.
+func BenchmarkGunzipReplays(b *testing.B) {
+	body := bytes.Repeat([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]},`), 1024)
+	compressed := gzipBody(b, body)
+
+	handler := Gunzip(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+	}))
+
+	for _, bc := range []struct {
+		name  string
+		cache bool
+	}{
+		{name: "uncached"},
+		{name: "cached", cache: true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				c := context.Background()
+				if bc.cache {
+					c = WithGunzipCache(c)
+				}
+
+				for attempt := 0; attempt < 3; attempt++ {
+					request := httptest.NewRequest(http.MethodPost, "http://localhost", bytes.NewReader(compressed))
+					request.Header.Set(headers.ContentEncoding, "gzip")
+
+					handler.ServeHTTP(httptest.NewRecorder(), request.WithContext(c))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// ResponseHeaders removes the remove headers from the responses, and sets
+// the set ones. They're applied as the response is written, once its
+// handler and the node provider set their headers: whatever set them, the
+// removed headers are never sent and the set ones replace every value.
+func ResponseHeaders(set map[string]string, remove []string) func(http.Handler) http.Handler {
+	canonical := make(map[string]string, len(set))
+	for k, v := range set {
+		canonical[http.CanonicalHeaderKey(k)] = v
+	}
+
+	apply := func(h http.Header) {
+		for _, k := range remove {
+			h.Del(k)
+		}
+
+		for k, v := range canonical {
+			h.Set(k, v)
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		if len(set) == 0 && len(remove) == 0 {
+			return next
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&headerWriter{ResponseWriter: w, apply: apply}, r)
+		})
+	}
+}
+
+// headerWriter applies the response headers before they're sent.
+type headerWriter struct {
+	http.ResponseWriter
+
+	apply   func(http.Header)
+	applied bool
+}
+
+func (w *headerWriter) applyOnce() {
+	if w.applied {
+		return
+	}
+
+	w.applied = true
+	w.apply(w.Header())
+}
+
+// WriteHeader applies the headers to the informational responses too, the
+// final response might set more of them.
+func (w *headerWriter) WriteHeader(statusCode int) {
+	if !w.applied {
+		w.apply(w.Header())
+		w.applied = statusCode >= http.StatusOK
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.applyOnce()
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush sends the headers of a response not written yet, so they're
+// applied first.
+func (w *headerWriter) Flush() {
+	w.applyOnce()
+	http.NewResponseController(w.ResponseWriter).Flush() // nolint:errcheck
+}
+
+// Hijack applies the headers first, as the upgrade responses are written
+// with the header of the writer once hijacked.
+func (w *headerWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.applyOnce()
+
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseHeaders(t *testing.T) {
+	t.Parallel()
+
+	handler := ResponseHeaders(
+		map[string]string{"x-served-by": "gateway"},
+		[]string{"Server"},
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("X-Served-By", "node")
+		w.WriteHeader(http.StatusEarlyHints)
+
+		// Set after the informational response, still stripped from the
+		// final one.
+		//
+		w.Header().Set("Server", "nginx")
+		w.Write([]byte("{}")) // nolint:errcheck
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	assert.Equal(t, []string{"gateway"}, rec.Result().Header.Values("X-Served-By"))
+	assert.Empty(t, rec.Result().Header.Values("Server"))
+}
+
+func TestResponseHeadersFlush(t *testing.T) {
+	t.Parallel()
+
+	handler := ResponseHeaders(map[string]string{"X-Served-By": "gateway"}, nil)(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.NewResponseController(w).Flush() // nolint:errcheck
+		}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	assert.True(t, rec.Flushed)
+	assert.Equal(t, "gateway", rec.Result().Header.Get("X-Served-By"))
+}
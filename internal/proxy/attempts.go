@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type attemptsContextKey struct{}
+
+// requestAttempts keeps track of every upstream attempt made on behalf of a
+// single client request. It's stored in the request context, so every layer
+// that performs an attempt can record it.
+type requestAttempts struct {
+	mu        sync.Mutex
+	attempts  int
+	providers []string
+
+	// trace holds the outcome of every attempt when the client asked for
+	// it, nil otherwise.
+	trace []AttemptTrace
+	// tracing is set when the client asked for the trace of the request.
+	tracing bool
+	// reporting is set when the attempts are listed in the error of the
+	// request, should it fail.
+	reporting bool
+}
+
+func withRequestAttempts(c context.Context, a *requestAttempts) context.Context {
+	return context.WithValue(c, attemptsContextKey{}, a)
+}
+
+func requestAttemptsFromContext(c context.Context) *requestAttempts {
+	a, ok := c.Value(attemptsContextKey{}).(*requestAttempts)
+	if !ok {
+		return nil
+	}
+
+	return a
+}
+
+// Observe records an attempt against the given provider.
+func (a *requestAttempts) Observe(provider string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.attempts++
+
+	for _, p := range a.providers {
+		if p == provider {
+			return
+		}
+	}
+
+	a.providers = append(a.providers, provider)
+}
+
+// Attempts returns the total number of upstream attempts.
+func (a *requestAttempts) Attempts() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.attempts
+}
+
+// ProvidersVisited returns the number of distinct providers attempted.
+func (a *requestAttempts) ProvidersVisited() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return len(a.providers)
+}
+
+// Record adds an attempt against the given provider, started at start, to
+// the trace of the request. It's a no-op unless the request is traced, or
+// its attempts are reported and this one failed: errors only list failed
+// attempts, so the requests served at the first attempt record nothing.
+func (a *requestAttempts) Record(provider string, start time.Time, outcome string) {
+	if !a.tracing && (!a.reporting || outcome == attemptSuccess) {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.trace = append(a.trace, AttemptTrace{
+		Provider:   provider,
+		DurationMs: time.Since(start).Milliseconds(),
+		Outcome:    outcome,
+	})
+}
+
+// Trace returns the attempts recorded so far.
+func (a *requestAttempts) Trace() []AttemptTrace {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	trace := make([]AttemptTrace, len(a.trace))
+	copy(trace, a.trace)
+
+	return trace
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/pkg/errors"
+)
+
+// checkBlockTimestamp returns the timestamp of the latest block of the node.
+// It fails when the block is older than maxBlockAge, which catches a node
+// frozen at a block recent enough not to lag behind the others, e.g. on a
+// chain with irregular block times.
+func (h *HealthChecker) checkBlockTimestamp(c context.Context) (time.Time, error) {
+	var header *struct {
+		Timestamp hexutil.Uint64 `json:"timestamp"`
+	}
+
+	if err := h.client.CallContext(c, &header, "eth_getBlockByNumber", "latest", false); err != nil {
+		return time.Time{}, errors.Wrap(err, "cannot fetch the latest block")
+	}
+
+	if header == nil {
+		return time.Time{}, errors.New("no latest block")
+	}
+
+	timestamp := time.Unix(int64(header.Timestamp), 0)
+
+	if age := h.config.Clock.Now().Sub(timestamp); age > h.config.MaxBlockAge {
+		return timestamp, errors.Errorf("latest block is %s old, more than %s",
+			age.Round(time.Second), h.config.MaxBlockAge)
+	}
+
+	return timestamp, nil
+}
+
+// BlockTimestamp returns the timestamp of the latest block of the node, the
+// zero time without a block age check or if none was fetched yet.
+func (h *HealthChecker) BlockTimestamp() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.context.Time(HealthContextBlockTimestamp)
+}
@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBlockAgeTestNode is a fake node answering the health checks, whose
+// latest block has the given timestamp.
+func newBlockAgeTestNode(t *testing.T, timestamp *atomic.Int64) *httptest.Server {
+	t.Helper()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		switch req.Method {
+		case "eth_blockNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`)) // nolint:errcheck
+		case "eth_call":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`)) // nolint:errcheck
+		case "eth_getBlockByNumber":
+			assert.JSONEq(t, `["latest",false]`, string(req.Params))
+
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"number":"0x10","timestamp":"0x` + // nolint:errcheck
+				strconv.FormatInt(timestamp.Load(), 16) + `"}}`))
+		default:
+			http.Error(w, "unexpected method", http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(node.Close)
+
+	return node
+}
+
+func TestHealthcheckerMaxBlockAge(t *testing.T) {
+	clock := newFakeClock()
+
+	var timestamp atomic.Int64
+	timestamp.Store(clock.Now().Add(-12 * time.Second).Unix())
+
+	node := newBlockAgeTestNode(t, &timestamp)
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:         node.URL,
+		Timeout:     time.Second,
+		MaxBlockAge: time.Minute,
+		Clock:       clock,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	defer healthchecker.Stop(context.Background()) // nolint:errcheck
+
+	healthchecker.CheckAndSetHealth(context.Background())
+	assert.True(t, healthchecker.IsHealthy())
+	assert.Equal(t, clock.Now().Add(-12*time.Second), healthchecker.BlockTimestamp())
+
+	// The node is frozen at its last block while time goes by.
+	//
+	clock.Advance(2 * time.Minute)
+
+	healthchecker.CheckAndSetHealth(context.Background())
+	assert.False(t, healthchecker.IsHealthy())
+
+	_, lastErr := healthchecker.LastCheck()
+	assert.ErrorContains(t, lastErr, "latest block is 2m12s old")
+
+	timestamp.Store(clock.Now().Unix())
+
+	healthchecker.CheckAndSetHealth(context.Background())
+	assert.True(t, healthchecker.IsHealthy())
+}
+
+func TestHealthcheckerWithoutMaxBlockAgeIgnoresTimestamps(t *testing.T) {
+	var timestamp atomic.Int64
+
+	node := newBlockAgeTestNode(t, &timestamp)
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:     node.URL,
+		Timeout: time.Second,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	defer healthchecker.Stop(context.Background()) // nolint:errcheck
+
+	healthchecker.CheckAndSetHealth(context.Background())
+	assert.True(t, healthchecker.IsHealthy())
+	assert.True(t, healthchecker.BlockTimestamp().IsZero())
+}
+
+func TestHealthCheckManagerReportsBlockTimestampAge(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	clock := newFakeClock()
+
+	var timestamp atomic.Int64
+	timestamp.Store(clock.Now().Add(-30 * time.Second).Unix())
+
+	node := newBlockAgeTestNode(t, &timestamp)
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name:       "Server1",
+				Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+			},
+		},
+		Config: HealthCheckConfig{Timeout: time.Second, MaxBlockAge: time.Minute},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	hcm.clock = clock
+
+	hc, err := hcm.GetTargetByName("Server1")
+	require.NoError(t, err)
+
+	hc.CheckAndSetHealth(context.Background())
+	hcm.reportStatusMetrics()
+
+	assert.True(t, hc.IsHealthy())
+	assert.Equal(t, 30.0, testutil.ToFloat64(hcm.metricRPCProviderBlockTimestampAge.WithLabelValues("Server1")))
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+type bodyReadContextKey struct{}
+
+// bodyReadState is shared between an attempt and the reader of its upstream
+// response body, so the attempt knows the body was cut short.
+type bodyReadState struct {
+	cancel  context.CancelFunc
+	stalled atomic.Bool
+
+	// readErr is the error that cut the body short, if any.
+	readErr atomic.Pointer[error]
+}
+
+// truncated returns the error that cut the body short, nil when it was read
+// to the end.
+func (s *bodyReadState) truncated() error {
+	if err := s.readErr.Load(); err != nil {
+		return *err
+	}
+
+	return nil
+}
+
+func withBodyReadState(c context.Context, s *bodyReadState) context.Context {
+	return context.WithValue(c, bodyReadContextKey{}, s)
+}
+
+func bodyReadStateFromContext(c context.Context) *bodyReadState {
+	s, ok := c.Value(bodyReadContextKey{}).(*bodyReadState)
+	if !ok {
+		return nil
+	}
+
+	return s
+}
+
+// stallReader cancels the attempt when the upstream body doesn't make any
+// progress for timeout. Headers may have arrived long before, so the response
+// header timeout doesn't cover this.
+type stallReader struct {
+	body  io.ReadCloser
+	timer *time.Timer
+
+	timeout time.Duration
+}
+
+func newStallReader(body io.ReadCloser, timeout time.Duration, state *bodyReadState) *stallReader {
+	return &stallReader{
+		body:    body,
+		timeout: timeout,
+		timer: time.AfterFunc(timeout, func() {
+			state.stalled.Store(true)
+			state.cancel()
+		}),
+	}
+}
+
+func (s *stallReader) Read(p []byte) (int, error) {
+	n, err := s.body.Read(p)
+	if n > 0 {
+		s.timer.Reset(s.timeout)
+	}
+
+	return n, err
+}
+
+func (s *stallReader) Close() error {
+	s.timer.Stop()
+
+	return s.body.Close()
+}
+
+// truncationReader records the error cutting the upstream body short, like
+// a connection closed before the end of the body.
+type truncationReader struct {
+	body  io.ReadCloser
+	state *bodyReadState
+}
+
+func (t *truncationReader) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if err != nil && err != io.EOF { //nolint:errorlint
+		t.state.readErr.CompareAndSwap(nil, &err)
+	}
+
+	return n, err
+}
+
+func (t *truncationReader) Close() error {
+	return t.body.Close()
+}
+
+// watchBody returns a ReverseProxy.ModifyResponse function recording the
+// upstream bodies cut short on attempts made by the proxy, and enforcing the
+// body read timeout when set.
+func watchBody(timeout time.Duration) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		state := bodyReadStateFromContext(resp.Request.Context())
+		if state == nil {
+			return nil
+		}
+
+		if timeout > 0 {
+			resp.Body = newStallReader(resp.Body, timeout, state)
+		}
+
+		resp.Body = &truncationReader{body: resp.Body, state: state}
+
+		return nil
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// maxPooledBufferSize is the largest buffer kept in the pool. Bigger
+	// buffers (e.g. huge eth_getLogs responses) are left to the garbage
+	// collector, so they don't pin memory.
+	maxPooledBufferSize = 1 << 20
+
+	// copyBufferSize is the size of the buffers used by the reverse proxy to
+	// copy response bodies.
+	copyBufferSize = 32 * 1024
+)
+
+// bufferPool is a pool of bytes.Buffer reused across requests.
+type bufferPool struct {
+	pool sync.Pool
+}
+
+func newBufferPool() *bufferPool {
+	return &bufferPool{
+		pool: sync.Pool{
+			New: func() any {
+				return &bytes.Buffer{}
+			},
+		},
+	}
+}
+
+func (b *bufferPool) Get() *bytes.Buffer {
+	buf, ok := b.pool.Get().(*bytes.Buffer)
+	if !ok {
+		return &bytes.Buffer{}
+	}
+
+	return buf
+}
+
+// Put returns the buffer to the pool. The buffer must not be used after.
+func (b *bufferPool) Put(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBufferSize {
+		return
+	}
+
+	buf.Reset()
+	b.pool.Put(buf)
+}
+
+// copyBufferPool implements httputil.BufferPool, so the reverse proxy doesn't
+// allocate a new copy buffer for every response.
+type copyBufferPool struct {
+	pool sync.Pool
+}
+
+func newCopyBufferPool() *copyBufferPool {
+	return &copyBufferPool{
+		pool: sync.Pool{
+			New: func() any {
+				buf := make([]byte, copyBufferSize)
+
+				return &buf
+			},
+		},
+	}
+}
+
+func (c *copyBufferPool) Get() []byte {
+	buf, ok := c.pool.Get().(*[]byte)
+	if !ok {
+		return make([]byte, copyBufferSize)
+	}
+
+	return *buf
+}
+
+func (c *copyBufferPool) Put(buf []byte) {
+	if cap(buf) != copyBufferSize {
+		return
+	}
+
+	buf = buf[:copyBufferSize]
+	c.pool.Put(&buf)
+}
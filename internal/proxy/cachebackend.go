@@ -0,0 +1,298 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DefaultRedisMaxTTL is the longest a key is kept in Redis when no maxTTL
+	// is configured.
+	DefaultRedisMaxTTL = 24 * time.Hour
+
+	// DefaultRedisTimeout is how long a Redis operation may take when no
+	// timeout is configured.
+	DefaultRedisTimeout = 100 * time.Millisecond
+
+	// redisFlushBatch is the number of keys scanned at once by flushes.
+	redisFlushBatch = 1000
+
+	// redisBreakerThreshold is the number of consecutive failed operations
+	// after which Redis is bypassed for redisBreakerCooldown.
+	redisBreakerThreshold = 5
+	redisBreakerCooldown  = 5 * time.Second
+)
+
+// cacheBackend stores cached results. The in-memory one is local to the
+// replica, others are shared by all the replicas of the gateway.
+type cacheBackend interface {
+	// Get returns the value of key, false when it's missing.
+	Get(c context.Context, key string) ([]byte, bool, error)
+	// Set stores value under key for ttl, or as long as the backend allows
+	// when ttl is zero.
+	Set(c context.Context, key string, value []byte, ttl time.Duration) error
+	// Flush drops the keys of method, every key when it's empty, and
+	// returns how many were dropped.
+	Flush(c context.Context, method string) (int, error)
+	Close() error
+}
+
+// CacheBackendConfig configures where the caches of the gateway are shared
+// across replicas. Without a backend, every replica only has its own cache.
+type CacheBackendConfig struct {
+	// Redis shares the caches through a Redis server.
+	Redis RedisCacheConfig `yaml:"redis"`
+}
+
+// RedisCacheConfig configures the Redis server shared by the replicas. The
+// cache is bypassed when Redis is unreachable, requests never fail because
+// of it. After 5 consecutive failed operations, Redis isn't even tried for
+// 5s, so requests don't each wait for the timeout.
+type RedisCacheConfig struct {
+	// Address is the host:port of the server. Redis is disabled when it's
+	// empty.
+	Address string `yaml:"address"`
+
+	// Username and Password authenticate to the server.
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+
+	// DB is the database selected after connecting.
+	DB int `yaml:"db"`
+
+	// TLS connects to the server with TLS.
+	TLS bool `yaml:"tls"`
+
+	// KeyPrefix is prepended to every key, and required. It keeps apart the
+	// results and the flushes of gateways sharing the server, e.g. it names
+	// the chain: the same transaction hash has other results on other
+	// chains.
+	KeyPrefix string `yaml:"keyPrefix"`
+
+	// MaxTTL caps how long a key is kept, including the immutable results.
+	// Defaults to 24h.
+	MaxTTL time.Duration `yaml:"maxTTL"`
+
+	// Timeout bounds every operation, after which the cache is bypassed.
+	// Defaults to 100ms.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c RedisCacheConfig) enabled() bool {
+	return c.Address != ""
+}
+
+func (c RedisCacheConfig) validate() error {
+	if !c.enabled() {
+		return nil
+	}
+
+	if _, _, err := net.SplitHostPort(c.Address); err != nil {
+		return errors.Wrap(err, "invalid redis address")
+	}
+
+	if c.KeyPrefix == "" {
+		return errors.New("redis key prefix is required, e.g. the name of the chain")
+	}
+
+	if c.MaxTTL < 0 {
+		return errors.New("redis max ttl can't be negative")
+	}
+
+	if c.Timeout < 0 {
+		return errors.New("redis timeout can't be negative")
+	}
+
+	return nil
+}
+
+func (c RedisCacheConfig) maxTTL() time.Duration {
+	if c.MaxTTL == 0 {
+		return DefaultRedisMaxTTL
+	}
+
+	return c.MaxTTL
+}
+
+func (c RedisCacheConfig) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultRedisTimeout
+	}
+
+	return c.Timeout
+}
+
+type redisCache struct {
+	client  *redis.Client
+	prefix  string
+	maxTTL  time.Duration
+	timeout time.Duration
+
+	// failures counts the consecutive failed operations, and openUntil is
+	// when Redis is tried again once there were too many, in Unix
+	// nanoseconds.
+	failures  atomic.Int32
+	openUntil atomic.Int64
+}
+
+func newRedisCache(config RedisCacheConfig) *redisCache {
+	options := &redis.Options{
+		Addr:     config.Address,
+		Username: config.Username,
+		Password: config.Password,
+		DB:       config.DB,
+
+		// A slow or unreachable server mustn't slow the requests down, so
+		// operations aren't retried and time out quickly.
+		//
+		MaxRetries:            -1,
+		DialTimeout:           config.timeout(),
+		ReadTimeout:           config.timeout(),
+		WriteTimeout:          config.timeout(),
+		ContextTimeoutEnabled: true,
+		DisableIndentity:      true,
+	}
+
+	if config.TLS {
+		host, _, _ := net.SplitHostPort(config.Address)
+
+		options.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: host,
+		}
+	}
+
+	return &redisCache{
+		client:  redis.NewClient(options),
+		prefix:  config.KeyPrefix,
+		maxTTL:  config.maxTTL(),
+		timeout: config.timeout(),
+	}
+}
+
+// bypassed reports whether Redis failed too often lately to be tried.
+func (c *redisCache) bypassed() bool {
+	return time.Now().UnixNano() < c.openUntil.Load()
+}
+
+// observe counts the outcome of an operation, and bypasses Redis once too
+// many failed in a row. The first operation after the cooldown bypasses it
+// again at once if it fails.
+func (c *redisCache) observe(err error) {
+	if err == nil {
+		c.failures.Store(0)
+
+		return
+	}
+
+	if c.failures.Add(1) >= redisBreakerThreshold {
+		c.openUntil.Store(time.Now().Add(redisBreakerCooldown).UnixNano())
+	}
+}
+
+// Get misses, without an error, while Redis is bypassed.
+func (c *redisCache) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	if c.bypassed() {
+		return nil, false, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	value, err := c.client.Get(ctx, c.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		c.observe(nil)
+
+		return nil, false, nil
+	}
+
+	c.observe(err)
+
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cannot get from redis")
+	}
+
+	return value, true, nil
+}
+
+// Set drops value, without an error, while Redis is bypassed.
+func (c *redisCache) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if c.bypassed() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	if ttl <= 0 || ttl > c.maxTTL {
+		ttl = c.maxTTL
+	}
+
+	err := c.client.Set(ctx, c.prefix+key, value, ttl).Err()
+	c.observe(err)
+
+	return errors.Wrap(err, "cannot set in redis")
+}
+
+// Flush scans the keys of the gateway, so it's bounded by the timeout per
+// batch rather than as a whole.
+func (c *redisCache) Flush(ctx context.Context, method string) (int, error) {
+	match := redisGlobEscape(c.prefix) + "*"
+	if method != "" {
+		match = redisGlobEscape(c.prefix+method+" ") + "*"
+	}
+
+	var (
+		cursor  uint64
+		flushed int
+	)
+
+	for {
+		scanCtx, cancel := context.WithTimeout(ctx, c.timeout)
+
+		keys, next, err := c.client.Scan(scanCtx, cursor, match, redisFlushBatch).Result()
+		if err == nil && len(keys) > 0 {
+			var deleted int64
+
+			deleted, err = c.client.Del(scanCtx, keys...).Result()
+			flushed += int(deleted)
+		}
+
+		cancel()
+
+		if err != nil {
+			return flushed, errors.Wrap(err, "cannot flush redis")
+		}
+
+		if cursor = next; cursor == 0 {
+			return flushed, nil
+		}
+	}
+}
+
+// redisGlobEscape escapes the characters of s matching patterns in SCAN.
+func redisGlobEscape(s string) string {
+	var b strings.Builder
+
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func (c *redisCache) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+// CacheControlNoStore is the Cache-Control value of the responses that must
+// not be cached.
+const CacheControlNoStore = "no-store"
+
+// CacheControlConfig sets the Cache-Control header of the responses, for a
+// CDN in front of the gateway, e.g.
+//
+//	methods:
+//	  eth_getBlockByHash: "public, max-age=86400"
+//	  logs: "public, max-age=5"
+type CacheControlConfig struct {
+	// Methods maps methods or method classes to the Cache-Control value of
+	// their successful responses, methods taking precedence. Empty disables
+	// the header, the one of the targets is passed through then.
+	Methods map[string]string `yaml:"methods"`
+
+	// Default is the value of the successful responses of the other
+	// methods. Defaults to "no-store".
+	Default string `yaml:"default"`
+}
+
+func (c CacheControlConfig) enabled() bool {
+	return len(c.Methods) > 0
+}
+
+func (c CacheControlConfig) validate() error {
+	for method, value := range c.Methods {
+		if value == "" {
+			return errors.Errorf("empty cache control value for %q", method)
+		}
+	}
+
+	return nil
+}
+
+// cacheControlValue returns the Cache-Control value of the response to
+// requests held by pw. Errors, JSON-RPC ones included, are never stored, nor
+// the results of methods that are only final once mined until they are.
+// Compressed bodies can't be told apart from errors, they aren't stored
+// either.
+func (p *Proxy) cacheControlValue(requests []JSONRPCRequest, pw *ReponseWriter) string {
+	if pw.statusCode < http.StatusOK || pw.statusCode >= http.StatusMultipleChoices ||
+		pw.Header().Get(headers.ContentEncoding) != "" || hasJSONRPCError(pw.body.Bytes()) {
+		return CacheControlNoStore
+	}
+
+	for _, request := range requests {
+		if _, immutable := immutableMethods[request.Method]; !immutable {
+			continue
+		}
+
+		if _, final := finalResult(request.Method, pw); len(requests) > 1 || !final {
+			return CacheControlNoStore
+		}
+	}
+
+	return p.methodCacheControl(requests)
+}
+
+// methodCacheControl returns the Cache-Control value configured for the
+// methods of requests. A batch gets the value of its methods when they all
+// share it, and isn't stored otherwise.
+func (p *Proxy) methodCacheControl(requests []JSONRPCRequest) string {
+	defaultValue := p.cacheControl.Default
+	if defaultValue == "" {
+		defaultValue = CacheControlNoStore
+	}
+
+	value := defaultValue
+
+	for i, request := range requests {
+		v, ok := p.cacheControl.Methods[request.Method]
+		if !ok {
+			v, ok = p.cacheControl.Methods[p.classifier.Classify(request.Method)]
+		}
+
+		if !ok {
+			v = defaultValue
+		}
+
+		if i > 0 && v != value {
+			return CacheControlNoStore
+		}
+
+		value = v
+	}
+
+	return value
+}
+
+// setCacheControl replaces the Cache-Control header of the targets with the
+// one configured for the response to requests held by pw.
+func (p *Proxy) setCacheControl(w http.ResponseWriter, requests []JSONRPCRequest, pw *ReponseWriter) {
+	if !p.cacheControl.enabled() {
+		return
+	}
+
+	w.Header().Set(headers.CacheControl, p.cacheControlValue(requests, pw))
+}
+
+// hasJSONRPCError reports whether the single or batch response in body holds
+// an error.
+func hasJSONRPCError(body []byte) bool {
+	// Results are never decoded, they can be large.
+	//
+	if !bytes.Contains(body, []byte(`"error"`)) {
+		return false
+	}
+
+	type response struct {
+		Error *JSONRPCError `json:"error"`
+	}
+
+	var batch []response
+	if err := json.Unmarshal(body, &batch); err == nil {
+		for _, r := range batch {
+			if r.Error != nil {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var single response
+	if err := json.Unmarshal(body, &single); err != nil {
+		// What can't be told apart from an error isn't stored either.
+		//
+		return true
+	}
+
+	return single.Error != nil
+}
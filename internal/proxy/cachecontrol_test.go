@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newCacheControlTestProxy returns a proxy whose target sets its own
+// Cache-Control header and answers eth_call with an error, unknown methods
+// with a 500, and the others with a result.
+func newCacheControlTestProxy(t *testing.T, cacheControl CacheControlConfig) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&request) // nolint:errcheck
+
+		w.Header().Set(headers.CacheControl, "max-age=60")
+
+		switch request.Method {
+		case "eth_call":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":3,"message":"execution reverted"}}`)) // nolint:errcheck
+		case "eth_getTransactionReceipt":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":null}`)) // nolint:errcheck
+		case "unknown_method":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	config := createConfig()
+	config.Proxy.CacheControl = cacheControl
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: upstream.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, config)
+}
+
+func TestHttpFailoverProxyCacheControl(t *testing.T) {
+	p := newCacheControlTestProxy(t, CacheControlConfig{
+		Methods: map[string]string{
+			"eth_chainId":               "public, max-age=86400",
+			"eth_call":                  "public, max-age=86400",
+			"eth_getTransactionReceipt": "public, max-age=86400",
+			"logs":                      "public, max-age=5",
+		},
+	})
+
+	for _, tc := range []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "method",
+			body:     `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`,
+			expected: "public, max-age=86400",
+		},
+		{
+			name:     "method class",
+			body:     `{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[{}]}`,
+			expected: "public, max-age=5",
+		},
+		{
+			name:     "default",
+			body:     `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`,
+			expected: CacheControlNoStore,
+		},
+		{
+			name:     "batch of different values",
+			body:     `[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},{"jsonrpc":"2.0","id":2,"method":"eth_getLogs"}]`,
+			expected: CacheControlNoStore,
+		},
+		{
+			name:     "JSON-RPC error",
+			body:     `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{},"latest"]}`,
+			expected: CacheControlNoStore,
+		},
+		{
+			name:     "result not final yet",
+			body:     `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionReceipt","params":["0x1"]}`,
+			expected: CacheControlNoStore,
+		},
+		{
+			name:     "gateway error",
+			body:     `{"jsonrpc":"2.0","id":1,"method":"unknown_method"}`,
+			expected: CacheControlNoStore,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tc.body)))
+
+			assert.Equal(t, []string{tc.expected}, rr.Header().Values(headers.CacheControl))
+		})
+	}
+}
+
+func TestHttpFailoverProxyCacheControlDisabled(t *testing.T) {
+	p := newCacheControlTestProxy(t, CacheControlConfig{})
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`)))
+
+	assert.Equal(t, "max-age=60", rr.Header().Get(headers.CacheControl))
+}
+
+func TestCacheControlConfigRejectsEmptyValues(t *testing.T) {
+	assert.Error(t, CacheControlConfig{Methods: map[string]string{"eth_chainId": ""}}.validate())
+	assert.NoError(t, CacheControlConfig{Methods: map[string]string{"eth_chainId": "no-cache"}}.validate())
+}
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"net/http"
+)
+
+const (
+	// DefaultCanaryWindowSize is the number of canary outcomes a recovering
+	// target is judged on when no windowSize is configured.
+	DefaultCanaryWindowSize = 20
+
+	// DefaultCanarySuccessThreshold is the canary success rate a recovering
+	// target has to reach when no successThreshold is configured.
+	DefaultCanarySuccessThreshold = 0.95
+)
+
+// CanaryConfig puts targets coming back from an unhealthy state on probation.
+// Synthetic health checks often pass while the real workload still fails, so
+// a recovering target only serves copies of live requests until those
+// succeed often enough.
+type CanaryConfig struct {
+	// Fraction is the share of live requests mirrored to each recovering
+	// target. Zero disables canaries, targets are restored as soon as their
+	// health checks pass.
+	Fraction float64 `yaml:"fraction"`
+
+	// WindowSize is the number of canary outcomes a target is judged on.
+	// Defaults to 20.
+	WindowSize uint `yaml:"windowSize"`
+
+	// SuccessThreshold is the canary success rate over a full window needed
+	// to restore a target. Defaults to 0.95.
+	SuccessThreshold float64 `yaml:"successThreshold"`
+}
+
+func (c CanaryConfig) enabled() bool {
+	return c.Fraction > 0
+}
+
+func (c CanaryConfig) windowSize() int {
+	if c.WindowSize == 0 {
+		return DefaultCanaryWindowSize
+	}
+
+	return int(c.WindowSize)
+}
+
+func (c CanaryConfig) successThreshold() float64 {
+	if c.SuccessThreshold <= 0 {
+		return DefaultCanarySuccessThreshold
+	}
+
+	return c.SuccessThreshold
+}
+
+// IsRecovering reports whether the named target passes its health checks but
+// still has to prove itself on canary traffic.
+func (h *HealthCheckManager) IsRecovering(name string) bool {
+	e, err := h.entry(name)
+	if err != nil {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.recovering
+}
+
+// startRecovery puts a target that became healthy on probation.
+func (h *HealthCheckManager) startRecovery(name string) {
+	e, err := h.entry(name)
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.recovering = true
+	e.canary.Reset()
+
+	h.logger.Info("target is recovering", "nodeprovider", name)
+}
+
+// ObserveCanary records the outcome of a canary request. A recovering target
+// is restored once a full window of canaries succeeds often enough.
+func (h *HealthCheckManager) ObserveCanary(name string, success bool) {
+	e, err := h.entry(name)
+	if err != nil {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.recovering {
+		return
+	}
+
+	value := 0
+	if success {
+		value = 1
+	}
+
+	e.canary.Observe(value)
+
+	if e.canary.HasEnoughObservations() && e.canary.SuccessRate() >= h.config.Canary.successThreshold() {
+		e.recovering = false
+
+		h.logger.Info("target restored by canary traffic",
+			"nodeprovider", name,
+			"successRate", e.canary.SuccessRate())
+	}
+}
+
+// mirrorToRecoveringTargets sends a copy of the request to a fraction of the
+// recovering targets. Their responses only feed the canary windows, the
+// client gets the response of the regular attempts. Writes are never
+// mirrored, a transaction would be sent twice.
+func (p *Proxy) mirrorToRecoveringTargets(r *http.Request, body []byte, requests []JSONRPCRequest) {
+	if !p.canary.enabled() || !p.idempotent(requests) {
+		return
+	}
+
+	for _, target := range p.targets {
+		if target.Draining() || !p.hcm.IsHealthy(target.Name()) || !p.hcm.IsRecovering(target.Name()) ||
+			!p.supports(target, requests) {
+			continue
+		}
+
+		if rand.Float64() >= p.canary.Fraction { //nolint:gosec
+			continue
+		}
+
+		if !target.TryAcquire() {
+			continue
+		}
+
+		// The canary outlives the client request, so it gets its own copy of
+		// the body and its own context.
+		//
+		canary := r.Clone(context.Background())
+		canary.Body = nil
+
+		target := target
+		body := bytes.Clone(body)
+
+		if !p.goBackground(&p.canaries, func() { p.serveCanary(target, canary, body) }) {
+			target.Release()
+
+			return
+		}
+	}
+}
+
+func (p *Proxy) serveCanary(target *NodeProvider, r *http.Request, body []byte) {
+	defer target.Release()
+
+	pw := newResponseWriterWithBuffer(p.buffers.Get())
+	defer func() {
+		p.buffers.Put(pw.body)
+	}()
+
+	p.serveAttempt(target, p.timeout, pw, r, body)
+
+	success := !p.HasNodeProviderFailed(pw.statusCode)
+	outcome := "success"
+
+	if !success {
+		outcome = "failure"
+	}
+
+	p.metricCanaryRequests.WithLabelValues(target.Name(), outcome).Inc()
+	p.hcm.ObserveCanary(target.Name(), success)
+}
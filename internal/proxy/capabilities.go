@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/pkg/errors"
+)
+
+// matchMethod reports whether one of patterns matches method, by name, by
+// class or by prefix when it ends with "*".
+func matchMethod(patterns []string, method, class string) bool {
+	for _, pattern := range patterns {
+		if pattern == method || pattern == class {
+			return true
+		}
+
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateMethodPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" || pattern == "*" {
+			return errors.Errorf("invalid method pattern %q", pattern)
+		}
+	}
+
+	return nil
+}
+
+func (c NodeProviderConfig) validateCapabilities() error {
+	if err := validateMethodPatterns(c.Capabilities); err != nil {
+		return errors.Wrap(err, "invalid capabilities")
+	}
+
+	if err := validateMethodPatterns(c.UnsupportedMethods); err != nil {
+		return errors.Wrap(err, "invalid unsupported methods")
+	}
+
+	return nil
+}
+
+// supportsMethod reports whether the target can serve method, of class.
+func (c NodeProviderConfig) supportsMethod(method, class string) bool {
+	if len(c.Capabilities) > 0 && !matchMethod(c.Capabilities, method, class) {
+		return false
+	}
+
+	return !matchMethod(c.UnsupportedMethods, method, class)
+}
+
+// supports reports whether target can serve every method of requests.
+// Requests that couldn't be parsed are left to the targets.
+func (p *Proxy) supports(target *NodeProvider, requests []JSONRPCRequest) bool {
+	for _, request := range requests {
+		if !target.Config.supportsMethod(request.Method, p.classifier.Classify(request.Method)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hasCapableTarget reports whether a target, healthy or not, can serve
+// requests.
+func (p *Proxy) hasCapableTarget(requests []JSONRPCRequest) bool {
+	for _, target := range p.targets {
+		if p.supports(target, requests) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// errMethodUnsupported fails a request no target is able to serve,
+// whatever their health.
+func (p *Proxy) errMethodUnsupported(w http.ResponseWriter, r *http.Request) {
+	p.writeError(w, r, middleware.GatewayError{
+		StatusCode: http.StatusNotImplemented,
+		Code:       JSONRPCErrorMethodNotFound,
+		Message:    "no node provider supports the method",
+		Reason:     "method_unsupported",
+	})
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCapabilitiesTestNode is a fake node answering the trace and debug
+// methods only when it's an archive node, and counting its hits.
+func newCapabilitiesTestNode(t *testing.T, archive bool, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+
+		var req JSONRPCRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		if !archive && (req.Method == "debug_traceTransaction" || req.Method == "trace_block") {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)) // nolint:errcheck
+
+			return
+		}
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(node.Close)
+
+	return node
+}
+
+func TestHttpFailoverProxySkipsTargetsUnableToServeTheMethod(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var archiveHits, lightHits atomic.Int32
+
+	archive := newCapabilitiesTestNode(t, true, &archiveHits)
+	light := newCapabilitiesTestNode(t, false, &lightHits)
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "archive",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: archive.URL}},
+		},
+		{
+			Name:               "light",
+			Connection:         NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: light.URL}},
+			UnsupportedMethods: []string{"traces"},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":[]}`)))
+
+		return rr
+	}
+
+	rr := serve("debug_traceTransaction")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, rr.Body.String())
+	assert.Equal(t, int32(1), archiveHits.Load())
+
+	require.NoError(t, p.hcm.Taint("archive", TaintReasonManual, 0))
+
+	// The light node could answer, but only with a misleading error.
+	//
+	rr = serve("debug_traceTransaction")
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"reason":"no_provider_available"`)
+	assert.NotContains(t, rr.Body.String(), "method not found")
+	assert.Zero(t, lightHits.Load())
+
+	rr = serve("eth_getBalance")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int32(1), lightHits.Load())
+}
+
+func TestHttpFailoverProxyFailsMethodsNoTargetSupports(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var hits atomic.Int32
+
+	node := newCapabilitiesTestNode(t, false, &hits)
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:         "light",
+			Connection:   NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+			Capabilities: []string{"reads", "eth_sendRawTransaction"},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":2,"method":"trace_block"}]`)))
+
+	assert.Equal(t, http.StatusNotImplemented, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"code":-32601`)
+	assert.Contains(t, rr.Body.String(), `"reason":"method_unsupported"`)
+	assert.Zero(t, hits.Load())
+}
+
+func TestNodeProviderConfigSupportsMethod(t *testing.T) {
+	config := NodeProviderConfig{
+		Capabilities:       []string{"reads", "debug_*"},
+		UnsupportedMethods: []string{"debug_traceCall"},
+	}
+
+	assert.True(t, config.supportsMethod("eth_call", "reads"))
+	assert.True(t, config.supportsMethod("debug_traceTransaction", "traces"))
+	assert.False(t, config.supportsMethod("debug_traceCall", "traces"))
+	assert.False(t, config.supportsMethod("trace_block", "traces"))
+	assert.False(t, config.supportsMethod("eth_sendRawTransaction", "sends"))
+
+	assert.True(t, NodeProviderConfig{}.supportsMethod("trace_block", "traces"))
+
+	assert.Error(t, NodeProviderConfig{Name: "n", UnsupportedMethods: []string{""}}.validateCapabilities())
+}
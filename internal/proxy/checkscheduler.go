@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// scheduledCheck is the health check of the target at index, due at due.
+type scheduledCheck struct {
+	index int
+	due   time.Time
+}
+
+// runChecks runs the health checks of the targets until c is done, with at
+// most healthChecks.maxConcurrentChecks of them at once, one per target when
+// zero. The first checks are due at once, the next ones are staggered over
+// the interval of each target, so they don't all run at the same time. A
+// check falling due while the previous one of the target is still queued or
+// running is skipped.
+func (h *HealthCheckManager) runChecks(c context.Context) {
+	if len(h.hcs) == 0 {
+		return
+	}
+
+	workers := len(h.hcs)
+	if limit := int(h.config.MaxConcurrentChecks); limit > 0 && limit < workers {
+		workers = limit
+	}
+
+	jobs := make(chan scheduledCheck)
+	finished := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for job := range jobs {
+				hc := h.hcs[job.index]
+
+				h.metricCheckQueueDelay.Observe(time.Since(job.due).Seconds())
+				hc.CheckAndSetHealth(c)
+				hc.markChecked()
+
+				select {
+				case finished <- job.index:
+				case <-c.Done():
+				}
+			}
+		}()
+	}
+
+	defer wg.Wait()
+	defer close(jobs)
+
+	start := time.Now()
+
+	// next holds when the next check of every target is due, the zero time
+	// for the targets checked only once.
+	//
+	next := make([]time.Time, len(h.hcs))
+	for i := range next {
+		next[i] = start
+	}
+
+	busy := make([]bool, len(h.hcs))
+
+	var queue []scheduledCheck
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		var (
+			send chan<- scheduledCheck
+			head scheduledCheck
+		)
+
+		if len(queue) > 0 {
+			send, head = jobs, queue[0]
+		}
+
+		select {
+		case <-c.Done():
+			return
+		case send <- head:
+			queue = queue[1:]
+		case i := <-finished:
+			busy[i] = false
+		case now := <-timer.C:
+			for i, due := range next {
+				if due.IsZero() || due.After(now) {
+					continue
+				}
+
+				if busy[i] {
+					h.observeSkippedCheck(h.hcs[i].Name())
+				} else {
+					busy[i] = true
+					queue = append(queue, scheduledCheck{index: i, due: due})
+				}
+
+				next[i] = h.nextCheck(i, due, start, now)
+			}
+
+			if earliest, ok := earliestCheck(next); ok {
+				timer.Reset(time.Until(earliest))
+			}
+		}
+	}
+}
+
+// nextCheck returns when the check of the target at index following the one
+// due at due is, given the checks started at start. The first one is
+// followed by a share of the interval proportional to index, which staggers
+// the targets. A target running late skips the checks it missed.
+func (h *HealthCheckManager) nextCheck(index int, due, start, now time.Time) time.Time {
+	interval := h.hcs[index].config.Interval
+	if interval <= 0 {
+		return time.Time{}
+	}
+
+	next := due.Add(interval)
+	if due.Equal(start) {
+		next = next.Add(time.Duration(int64(interval) * int64(index) / int64(len(h.hcs))))
+	}
+
+	if !next.After(now) {
+		next = now.Add(interval)
+	}
+
+	return next
+}
+
+// earliestCheck returns the earliest of the due times, false when there are
+// none.
+func earliestCheck(next []time.Time) (time.Time, bool) {
+	var earliest time.Time
+
+	for _, due := range next {
+		if !due.IsZero() && (earliest.IsZero() || due.Before(earliest)) {
+			earliest = due
+		}
+	}
+
+	return earliest, !earliest.IsZero()
+}
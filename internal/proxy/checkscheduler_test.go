@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checkTracker is a node serving every target on its own path, which
+// records how many targets are being checked at once, at most, and how many
+// checks each target got.
+type checkTracker struct {
+	mu       sync.Mutex
+	inflight map[string]int
+	current  int
+	peak     int
+	calls    map[string]int
+}
+
+func newCheckTracker(t *testing.T) (*checkTracker, *httptest.Server) {
+	t.Helper()
+
+	tracker := &checkTracker{inflight: map[string]int{}, calls: map[string]int{}}
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req) // nolint:errcheck
+
+		tracker.mu.Lock()
+		if tracker.inflight[r.URL.Path] == 0 {
+			tracker.current++
+			tracker.peak = max(tracker.peak, tracker.current)
+		}
+		tracker.inflight[r.URL.Path]++
+
+		if req.Method == "eth_blockNumber" {
+			tracker.calls[r.URL.Path]++
+		}
+		tracker.mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		if req.Method == "eth_blockNumber" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`)) // nolint:errcheck
+		} else {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`)) // nolint:errcheck
+		}
+
+		tracker.mu.Lock()
+		tracker.inflight[r.URL.Path]--
+		if tracker.inflight[r.URL.Path] == 0 {
+			tracker.current--
+		}
+		tracker.mu.Unlock()
+	}))
+	t.Cleanup(node.Close)
+
+	return tracker, node
+}
+
+func (tracker *checkTracker) checks(name string) int {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+
+	return tracker.calls["/"+name]
+}
+
+// startTestHealthCheckManager starts hcm, and stops it when the test ends.
+func startTestHealthCheckManager(t *testing.T, hcm *HealthCheckManager) {
+	t.Helper()
+
+	started := make(chan error)
+
+	go func() {
+		started <- hcm.Start(context.Background())
+	}()
+
+	t.Cleanup(func() {
+		assert.NoError(t, hcm.Stop(context.Background()))
+		assert.NoError(t, <-started)
+	})
+}
+
+func TestHealthCheckManagerBoundsConcurrentChecks(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	tracker, node := newCheckTracker(t)
+
+	targets := []NodeProviderConfig{}
+	for i := 0; i < 12; i++ {
+		targets = append(targets, NodeProviderConfig{
+			Name:       "Server" + strconv.Itoa(i),
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL + "/Server" + strconv.Itoa(i)}},
+		})
+	}
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: targets,
+		Config: HealthCheckConfig{
+			Interval:            time.Hour,
+			Timeout:             time.Second,
+			MaxConcurrentChecks: 3,
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	startTestHealthCheckManager(t, hcm)
+
+	require.NoError(t, hcm.AwaitFirstChecks(context.Background()))
+
+	tracker.mu.Lock()
+	assert.Equal(t, 3, tracker.peak)
+	tracker.mu.Unlock()
+
+	for _, target := range targets {
+		assert.Equal(t, 1, tracker.checks(target.Name))
+	}
+
+	// Every check is timed from when it fell due to when a worker took it.
+	//
+	var delays dto.Metric
+	require.NoError(t, hcm.metricCheckQueueDelay.Write(&delays))
+	assert.Equal(t, uint64(12), delays.GetHistogram().GetSampleCount())
+}
+
+func TestHealthCheckManagerTargetInterval(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	tracker, node := newCheckTracker(t)
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name:        "Fast",
+				Connection:  NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL + "/Fast"}},
+				HealthCheck: NodeProviderHealthCheckConfig{Interval: 20 * time.Millisecond},
+			},
+			{
+				Name:       "Slow",
+				Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL + "/Slow"}},
+			},
+		},
+		Config: HealthCheckConfig{
+			Interval:            time.Hour,
+			Timeout:             time.Second,
+			MaxConcurrentChecks: 1,
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	startTestHealthCheckManager(t, hcm)
+
+	assert.Eventually(t, func() bool {
+		return tracker.checks("Fast") >= 3
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 1, tracker.checks("Slow"))
+}
+
+func TestHealthCheckManagerStaggersChecks(t *testing.T) {
+	hcm := newTestHealthCheckManagerWithConfig(t, HealthCheckConfig{Interval: time.Minute},
+		"Server1", "Server2", "Server3", "Server4")
+
+	start := time.Now()
+
+	// The first checks are followed by a share of the interval, the next
+	// ones keep their pace, unless they're late.
+	//
+	for i, offset := range []time.Duration{0, 15 * time.Second, 30 * time.Second, 45 * time.Second} {
+		assert.Equal(t, start.Add(time.Minute+offset), hcm.nextCheck(i, start, start, start))
+	}
+
+	assert.Equal(t, start.Add(3*time.Minute),
+		hcm.nextCheck(1, start.Add(2*time.Minute), start, start.Add(2*time.Minute)))
+	assert.Equal(t, start.Add(5*time.Minute+time.Second),
+		hcm.nextCheck(1, start.Add(2*time.Minute), start, start.Add(4*time.Minute+time.Second)))
+}
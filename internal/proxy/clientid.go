@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"hash/fnv"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/httplog/v2"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultClientIDHashBuckets is the number of labels client ids are
+	// hashed into when neither clientIds nor clientIdHashBuckets is set.
+	DefaultClientIDHashBuckets = 16
+
+	// UnknownClient labels the requests without a client id, or with one
+	// missing from clientIds.
+	UnknownClient = "unknown"
+)
+
+// clientLabeler derives the client label of requests from their client id
+// header, bounding the number of distinct labels.
+type clientLabeler struct {
+	header  string
+	allowed map[string]bool
+	buckets uint32
+}
+
+func newClientLabeler(config ProxyConfig) (*clientLabeler, error) {
+	if config.ClientIDHashBuckets < 0 {
+		return nil, errors.New("client id hash buckets can't be negative")
+	}
+
+	if config.ClientIDHeader == "" {
+		return nil, nil
+	}
+
+	l := &clientLabeler{
+		header:  config.ClientIDHeader,
+		buckets: uint32(config.ClientIDHashBuckets),
+	}
+
+	if len(config.ClientIDs) > 0 {
+		l.allowed = map[string]bool{}
+
+		for _, id := range config.ClientIDs {
+			l.allowed[id] = true
+		}
+	} else if l.buckets == 0 {
+		l.buckets = DefaultClientIDHashBuckets
+	}
+
+	return l, nil
+}
+
+// label returns the client label of r. It's empty when client ids are
+// disabled, which Prometheus treats as a missing label.
+func (l *clientLabeler) label(r *http.Request) string {
+	if l == nil {
+		return ""
+	}
+
+	id := r.Header.Get(l.header)
+
+	switch {
+	case id == "":
+		return UnknownClient
+	case l.allowed != nil:
+		if l.allowed[id] {
+			return id
+		}
+
+		return UnknownClient
+	default:
+		h := fnv.New32a()
+		h.Write([]byte(id)) // nolint:errcheck
+
+		return "hash-" + strconv.FormatUint(uint64(h.Sum32()%l.buckets), 10)
+	}
+}
+
+// labelClient returns the client label of r and adds it to its access log.
+func (p *Proxy) labelClient(r *http.Request) string {
+	client := p.clients.label(r)
+	if client != "" {
+		httplog.LogEntrySetField(r.Context(), "client", slog.StringValue(client))
+	}
+
+	return client
+}
@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientLabeler(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   ProxyConfig
+		id       string
+		expected string
+	}{
+		{
+			name:     "disabled",
+			id:       "indexer",
+			expected: "",
+		},
+		{
+			name:     "allowed",
+			config:   ProxyConfig{ClientIDHeader: "X-Client-Id", ClientIDs: []string{"indexer", "api"}},
+			id:       "indexer",
+			expected: "indexer",
+		},
+		{
+			name:     "not allowed",
+			config:   ProxyConfig{ClientIDHeader: "X-Client-Id", ClientIDs: []string{"indexer", "api"}},
+			id:       "scraper",
+			expected: UnknownClient,
+		},
+		{
+			name:     "missing",
+			config:   ProxyConfig{ClientIDHeader: "X-Client-Id", ClientIDs: []string{"indexer", "api"}},
+			expected: UnknownClient,
+		},
+		{
+			name:     "missing hashed",
+			config:   ProxyConfig{ClientIDHeader: "X-Client-Id"},
+			expected: UnknownClient,
+		},
+		{
+			name:     "hashed",
+			config:   ProxyConfig{ClientIDHeader: "X-Client-Id", ClientIDHashBuckets: 1},
+			id:       "scraper",
+			expected: "hash-0",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			labeler, err := newClientLabeler(tc.config)
+			assert.NoError(t, err)
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if tc.id != "" {
+				r.Header.Set("X-Client-Id", tc.id)
+			}
+
+			assert.Equal(t, tc.expected, labeler.label(r))
+		})
+	}
+}
+
+func TestClientLabelerHashBuckets(t *testing.T) {
+	labeler, err := newClientLabeler(ProxyConfig{ClientIDHeader: "X-Client-Id"})
+	assert.NoError(t, err)
+
+	labels := map[string]bool{}
+
+	for i := 0; i < 1000; i++ {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set("X-Client-Id", "client-"+string(rune('a'+i%26))+string(rune('a'+i/26)))
+
+		label := labeler.label(r)
+		assert.Equal(t, label, labeler.label(r))
+
+		labels[label] = true
+	}
+
+	assert.Len(t, labels, DefaultClientIDHashBuckets)
+
+	_, err = newClientLabeler(ProxyConfig{ClientIDHeader: "X-Client-Id", ClientIDHashBuckets: -1})
+	assert.Error(t, err)
+}
+
+func TestHttpFailoverProxyClientLabel(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	working := newFakeNode(t)
+	defer working.Close()
+
+	config := createConfig()
+	config.Proxy.ClientIDHeader = "X-Client-Id"
+	config.Proxy.ClientIDs = []string{"indexer"}
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: failing.URL}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: working.URL}},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, config)
+
+	for _, id := range []string{"indexer", "scraper", ""} {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+		if id != "" {
+			req.Header.Set("X-Client-Id", id)
+		}
+
+		rr := httptest.NewRecorder()
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(httpFailoverProxy.metricRequestErrors.WithLabelValues("Server1", "rerouted", "Server2", "indexer")))
+	assert.Equal(t, 2.0,
+		testutil.ToFloat64(httpFailoverProxy.metricRequestErrors.WithLabelValues("Server1", "rerouted", "Server2", UnknownClient)))
+
+	for client, count := range map[string]uint64{"indexer": 1, UnknownClient: 2} {
+		var metric dto.Metric
+		assert.NoError(t, httpFailoverProxy.metricRequestDuration.
+			WithLabelValues("Server2", http.MethodPost, statusClass2xx, client).(prometheus.Histogram).Write(&metric))
+		assert.Equal(t, count, metric.GetHistogram().GetSampleCount(), client)
+	}
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// MaxRetriesHeader lowers the number of retries made to each target for
+	// a single request, when proxy.allowClientOverrides is set.
+	MaxRetriesHeader = "X-RPC-Gateway-Max-Retries"
+	// MaxReroutesHeader lowers the number of targets a single request is
+	// rerouted to after the first one failed, when
+	// proxy.allowClientOverrides is set.
+	MaxReroutesHeader = "X-RPC-Gateway-Max-Reroutes"
+)
+
+// clientOverrides are the limits a client set on its request. They can only
+// lower the configured ones, a negative value keeps them.
+type clientOverrides struct {
+	maxRetries  int
+	maxReroutes int
+}
+
+type clientOverridesContextKey struct{}
+
+func withClientOverrides(c context.Context, o clientOverrides) context.Context {
+	return context.WithValue(c, clientOverridesContextKey{}, o)
+}
+
+func clientOverridesFromContext(c context.Context) (clientOverrides, bool) {
+	o, ok := c.Value(clientOverridesContextKey{}).(clientOverrides)
+
+	return o, ok
+}
+
+// clientOverrides reads the limits set by the headers of r. Invalid values
+// are ignored and counted.
+func (p *Proxy) clientOverrides(r *http.Request) clientOverrides {
+	return clientOverrides{
+		maxRetries:  p.clientOverride(r, MaxRetriesHeader),
+		maxReroutes: p.clientOverride(r, MaxReroutesHeader),
+	}
+}
+
+func (p *Proxy) clientOverride(r *http.Request, header string) int {
+	value := r.Header.Get(header)
+	if value == "" {
+		return -1
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		p.metricInvalidClientOverrides.WithLabelValues(header).Inc()
+
+		return -1
+	}
+
+	return n
+}
+
+// maxAttempts returns the number of attempts made to a target, lowered by
+// the client overrides of the request.
+func (c RetryConfig) maxAttempts(ctx context.Context) int {
+	maxAttempts := int(c.MaxAttempts)
+
+	if o, ok := clientOverridesFromContext(ctx); ok && o.maxRetries >= 0 {
+		maxAttempts = min(maxAttempts, o.maxRetries+1)
+	}
+
+	return maxAttempts
+}
+
+// rerouteAllowed reports whether the request can be rerouted once more.
+func (s *failoverState) rerouteAllowed() bool {
+	return s.overrides.maxReroutes < 0 || s.reroutes < s.overrides.maxReroutes
+}
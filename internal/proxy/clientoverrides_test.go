@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClientOverridesTestProxy(t *testing.T, allow bool, primaryCalls, secondaryCalls *atomic.Int64) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(primary.Close)
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryCalls.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	t.Cleanup(secondary.Close)
+
+	config := createConfig()
+	config.Proxy.AllowClientOverrides = allow
+	config.Proxy.Retry = RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond}
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: primary.URL}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: secondary.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, config)
+}
+
+func TestHttpFailoverProxyClientOverrides(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		allow          bool
+		header         map[string]string
+		status         int
+		primaryCalls   int64
+		secondaryCalls int64
+		invalid        float64
+	}{
+		{
+			name:           "default",
+			allow:          true,
+			status:         http.StatusOK,
+			primaryCalls:   3,
+			secondaryCalls: 1,
+		},
+		{
+			name:         "fail fast",
+			allow:        true,
+			header:       map[string]string{MaxRetriesHeader: "0", MaxReroutesHeader: "0"},
+			status:       http.StatusServiceUnavailable,
+			primaryCalls: 1,
+		},
+		{
+			name:           "no retries",
+			allow:          true,
+			header:         map[string]string{MaxRetriesHeader: "0"},
+			status:         http.StatusOK,
+			primaryCalls:   1,
+			secondaryCalls: 1,
+		},
+		{
+			name:           "clamped",
+			allow:          true,
+			header:         map[string]string{MaxRetriesHeader: "10", MaxReroutesHeader: "5"},
+			status:         http.StatusOK,
+			primaryCalls:   3,
+			secondaryCalls: 1,
+		},
+		{
+			name:           "invalid",
+			allow:          true,
+			header:         map[string]string{MaxRetriesHeader: "none", MaxReroutesHeader: "-1"},
+			status:         http.StatusOK,
+			primaryCalls:   3,
+			secondaryCalls: 1,
+			invalid:        1,
+		},
+		{
+			name:           "not allowed",
+			header:         map[string]string{MaxRetriesHeader: "0", MaxReroutesHeader: "0"},
+			status:         http.StatusOK,
+			primaryCalls:   3,
+			secondaryCalls: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var primaryCalls, secondaryCalls atomic.Int64
+
+			p := newClientOverridesTestProxy(t, tc.allow, &primaryCalls, &secondaryCalls)
+
+			req := httptest.NewRequest(http.MethodPost, "/",
+				bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+			for key, value := range tc.header {
+				req.Header.Set(key, value)
+			}
+
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.status, rec.Code)
+			assert.Equal(t, tc.primaryCalls, primaryCalls.Load())
+			assert.Equal(t, tc.secondaryCalls, secondaryCalls.Load())
+
+			assert.Equal(t, tc.invalid,
+				testutil.ToFloat64(p.metricInvalidClientOverrides.WithLabelValues(MaxRetriesHeader)))
+			assert.Equal(t, tc.invalid,
+				testutil.ToFloat64(p.metricInvalidClientOverrides.WithLabelValues(MaxReroutesHeader)))
+		})
+	}
+}
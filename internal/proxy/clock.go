@@ -0,0 +1,22 @@
+package proxy
+
+import "time"
+
+// Clock abstracts the time source, so time dependent behavior can be tested
+// deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// clockFunc adapts a function to Clock.
+type clockFunc func() time.Time
+
+func (f clockFunc) Now() time.Time {
+	return f()
+}
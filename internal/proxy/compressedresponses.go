@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-http-utils/headers"
+)
+
+type acceptsGzipContextKey struct{}
+
+func withAcceptsGzip(c context.Context, accepts bool) context.Context {
+	return context.WithValue(c, acceptsGzipContextKey{}, accepts)
+}
+
+// acceptsGzipFromContext reports whether the client of the request accepts
+// gzipped responses, as recorded by the provider.
+func acceptsGzipFromContext(c context.Context) bool {
+	accepts, _ := c.Value(acceptsGzipContextKey{}).(bool)
+
+	return accepts
+}
+
+// acceptsGzip reports whether the Accept-Encoding header in h accepts gzip,
+// explicitly or through "*", with a non-zero quality.
+func acceptsGzip(h http.Header) bool {
+	for _, value := range h.Values(headers.AcceptEncoding) {
+		for _, coding := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(coding, ";")
+
+			name = strings.TrimSpace(name)
+			if !strings.EqualFold(name, "gzip") && name != "*" {
+				continue
+			}
+
+			quality := strings.TrimSpace(params)
+			if !strings.HasPrefix(quality, "q=") {
+				return true
+			}
+
+			if q, err := strconv.ParseFloat(strings.TrimPrefix(quality, "q="), 64); err != nil || q > 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// requestGzip wraps the director of a reverse proxy so the target is always
+// asked for gzipped responses, whatever the client accepts. Setting the
+// header ourselves also turns off the transparent decompression of the
+// transport, which only applies to the requests it added the header to, so
+// decompressResponses is the one deciding what the client gets.
+func requestGzip(director func(*http.Request)) func(*http.Request) {
+	return func(r *http.Request) {
+		director(r)
+
+		r.Header.Set(headers.AcceptEncoding, "gzip")
+	}
+}
+
+// decompressResponses wraps the ModifyResponse function of a reverse proxy
+// so gzipped responses are decompressed before next sees them, unless the
+// client accepts gzip too, in which case they're passed through as is.
+func decompressResponses(next func(*http.Response) error) func(*http.Response) error {
+	return func(resp *http.Response) error {
+		if !acceptsGzipFromContext(resp.Request.Context()) &&
+			strings.EqualFold(strings.TrimSpace(resp.Header.Get(headers.ContentEncoding)), "gzip") {
+			resp.Body = &gunzipReader{body: resp.Body}
+			resp.Header.Del(headers.ContentEncoding)
+			resp.Header.Del(headers.ContentLength)
+			resp.ContentLength = -1
+			resp.Uncompressed = true
+		}
+
+		if next == nil {
+			return nil
+		}
+
+		return next(resp)
+	}
+}
+
+// gunzipReader decompresses an upstream body. The gzip header is only read
+// on the first Read, so a target slow to send it is caught by the body
+// timeout rather than blocking ModifyResponse.
+type gunzipReader struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (g *gunzipReader) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+
+	if g.zr == nil {
+		zr, err := gzip.NewReader(g.body)
+		if err != nil {
+			g.err = err
+
+			return 0, err
+		}
+
+		g.zr = zr
+	}
+
+	n, err := g.zr.Read(p)
+	if err != nil {
+		g.err = err
+	}
+
+	return n, err
+}
+
+func (g *gunzipReader) Close() error {
+	return g.body.Close()
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const compressedTestResult = `{"jsonrpc":"2.0","id":1,"result":"0x10"}`
+
+// newCompressedResponsesTestProxy returns a proxy to a target serving gzipped
+// responses only when asked for them, and the Accept-Encoding headers it got.
+func newCompressedResponsesTestProxy(t *testing.T) (*Proxy, *[]string) {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var acceptEncodings []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncodings = append(acceptEncodings, r.Header.Get("Accept-Encoding"))
+
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte(compressedTestResult)) // nolint:errcheck
+
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+
+		zw := gzip.NewWriter(w)
+		zw.Write([]byte(compressedTestResult)) // nolint:errcheck
+		zw.Close()                             // nolint:errcheck
+	}))
+	t.Cleanup(server.Close)
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{URL: server.URL, AcceptCompressedResponses: true},
+			},
+		},
+	}
+
+	return newTestFailoverProxy(t, config), &acceptEncodings
+}
+
+func TestAcceptCompressedResponsesDecompressesForPlainClients(t *testing.T) {
+	p, acceptEncodings := newCompressedResponsesTestProxy(t)
+
+	for _, acceptEncoding := range []string{"", "br", "gzip;q=0"} {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code, acceptEncoding)
+		assert.Empty(t, rr.Header().Get("Content-Encoding"), acceptEncoding)
+		assert.JSONEq(t, compressedTestResult, rr.Body.String(), acceptEncoding)
+	}
+
+	assert.Equal(t, []string{"gzip", "gzip", "gzip"}, *acceptEncodings)
+}
+
+func TestAcceptCompressedResponsesPassesThroughToGzipClients(t *testing.T) {
+	p, acceptEncodings := newCompressedResponsesTestProxy(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	req.Header.Set("Accept-Encoding", "br, gzip")
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, []string{"gzip"}, *acceptEncodings)
+
+	zr, err := gzip.NewReader(rr.Body)
+	require.NoError(t, err)
+
+	body, err := io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.JSONEq(t, compressedTestResult, string(body))
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"":                 false,
+		"br":               false,
+		"gzip":             true,
+		"GZIP":             true,
+		"br, gzip;q=0.5":   true,
+		"gzip;q=0":         false,
+		"*":                true,
+		"deflate, *;q=0.1": true,
+	} {
+		h := http.Header{}
+		if value != "" {
+			h.Set("Accept-Encoding", value)
+		}
+
+		assert.Equal(t, expected, acceptsGzip(h), value)
+	}
+}
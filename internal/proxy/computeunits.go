@@ -0,0 +1,77 @@
+package proxy
+
+import "github.com/pkg/errors"
+
+// DefaultComputeUnitCost is the cost of the methods missing from the cost
+// table.
+const DefaultComputeUnitCost = 1
+
+// ComputeUnitsConfig prices JSON-RPC methods the way providers bill them, so
+// the spend per provider can be tracked in their own units.
+type ComputeUnitsConfig struct {
+	// Costs maps methods to their cost. Accounting is disabled when it's
+	// empty.
+	Costs map[string]float64 `yaml:"costs"`
+
+	// DefaultCost is the cost of the methods missing from Costs. Defaults
+	// to DefaultComputeUnitCost.
+	DefaultCost float64 `yaml:"defaultCost"`
+}
+
+func (c ComputeUnitsConfig) enabled() bool {
+	return len(c.Costs) > 0
+}
+
+func (c ComputeUnitsConfig) validate() error {
+	if c.DefaultCost < 0 {
+		return errors.New("default compute unit cost can't be negative")
+	}
+
+	for method, cost := range c.Costs {
+		if cost < 0 {
+			return errors.Errorf("compute unit cost of %s can't be negative", method)
+		}
+	}
+
+	return nil
+}
+
+// cost returns the cost of a single call of method.
+func (c ComputeUnitsConfig) cost(method string) float64 {
+	if cost, ok := c.Costs[method]; ok {
+		return cost
+	}
+
+	if c.DefaultCost == 0 {
+		return DefaultComputeUnitCost
+	}
+
+	return c.DefaultCost
+}
+
+// label returns the metric label of method, "other" when it has no cost of
+// its own so clients can't create a series per made up method.
+func (c ComputeUnitsConfig) label(method string) string {
+	if _, ok := c.Costs[method]; ok {
+		return method
+	}
+
+	return otherMethodLabel
+}
+
+// observeComputeUnits counts the cost of requests answered by provider. The
+// calls of a batch are summed per method.
+func (p *Proxy) observeComputeUnits(provider string, requests []JSONRPCRequest) {
+	if !p.computeUnits.enabled() {
+		return
+	}
+
+	costs := map[string]float64{}
+	for _, request := range requests {
+		costs[p.computeUnits.label(request.Method)] += p.computeUnits.cost(request.Method)
+	}
+
+	for method, cost := range costs {
+		p.metricComputeUnits.WithLabelValues(provider, method).Add(cost)
+	}
+}
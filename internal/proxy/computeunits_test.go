@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeUnitsConfigCost(t *testing.T) {
+	config := ComputeUnitsConfig{Costs: map[string]float64{"eth_getLogs": 75}}
+
+	assert.Equal(t, float64(75), config.cost("eth_getLogs"))
+	assert.Equal(t, float64(DefaultComputeUnitCost), config.cost("eth_call"))
+
+	config.DefaultCost = 10
+	assert.Equal(t, float64(10), config.cost("eth_call"))
+
+	assert.Equal(t, "eth_getLogs", config.label("eth_getLogs"))
+	assert.Equal(t, otherMethodLabel, config.label("eth_call"))
+}
+
+func TestHttpFailoverProxyCountsComputeUnits(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.ComputeUnits = ComputeUnitsConfig{
+		Costs: map[string]float64{
+			"eth_blockNumber": 10,
+			"eth_getLogs":     75,
+		},
+		DefaultCost: 20,
+	}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{URL: fakeRPCServer.URL},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs"}`,
+		`[
+			{"jsonrpc":"2.0","id":1,"method":"eth_getLogs"},
+			{"jsonrpc":"2.0","id":2,"method":"eth_getLogs"},
+			{"jsonrpc":"2.0","id":3,"method":"eth_blockNumber"},
+			{"jsonrpc":"2.0","id":4,"method":"eth_call"},
+			{"jsonrpc":"2.0","id":5,"method":"eth_madeUp1234"}
+		]`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	assert.Equal(t, float64(225),
+		testutil.ToFloat64(httpFailoverProxy.metricComputeUnits.WithLabelValues("Server1", "eth_getLogs")))
+	assert.Equal(t, float64(10),
+		testutil.ToFloat64(httpFailoverProxy.metricComputeUnits.WithLabelValues("Server1", "eth_blockNumber")))
+	assert.Equal(t, float64(40),
+		testutil.ToFloat64(httpFailoverProxy.metricComputeUnits.WithLabelValues("Server1", otherMethodLabel)))
+	assert.Equal(t, 3, testutil.CollectAndCount(httpFailoverProxy.metricComputeUnits))
+}
@@ -1,7 +1,31 @@
 package proxy
 
 import (
+	"log/slog"
+	"net/http"
 	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultTaintDuration is how long a target stays tainted when no
+	// taintDuration is configured.
+	DefaultTaintDuration = 30 * time.Second
+
+	// DefaultMaxRequestBodySize is the largest request body accepted when no
+	// maxRequestBodySize is configured.
+	DefaultMaxRequestBodySize = 10 << 20
+
+	// DefaultStartupTimeout bounds the first round of health checks when no
+	// startupTimeout is configured.
+	DefaultStartupTimeout = 30 * time.Second
+
+	// DefaultBlockNumberStaleness is how old a block number observation can
+	// be to count towards the highest block when no blockNumberStaleness is
+	// configured.
+	DefaultBlockNumberStaleness = time.Minute
 )
 
 type HealthCheckConfig struct {
@@ -9,11 +33,268 @@ type HealthCheckConfig struct {
 	Timeout          time.Duration `yaml:"timeout"`
 	FailureThreshold uint          `yaml:"failureThreshold"`
 	SuccessThreshold uint          `yaml:"successThreshold"`
+
+	// RollingWindowSize is the number of request outcomes kept per target.
+	RollingWindowSize uint `yaml:"rollingWindowSize"`
+
+	// RollingWindowMinObservations is the fraction of the rolling window that
+	// has to be filled before its success rate is acted upon.
+	RollingWindowMinObservations float64 `yaml:"rollingWindowMinObservations"`
+
+	// RollingWindowImplementation is "atomic" for lock free rolling
+	// windows, or "mutex" for windows guarded by a mutex. Defaults to
+	// "atomic".
+	RollingWindowImplementation string `yaml:"rollingWindowImplementation"`
+
+	// RollingWindowTaintThreshold is the success rate under which a target
+	// is tainted for a method class. Zero disables tainting.
+	RollingWindowTaintThreshold float64 `yaml:"rollingWindowTaintThreshold"`
+
+	// TaintDuration is how long a target stays tainted. Defaults to 30s.
+	TaintDuration time.Duration `yaml:"taintDuration"`
+
+	// StatePath is where the health and taint state of the targets is
+	// persisted, so it survives restarts. Empty disables persistence.
+	StatePath string `yaml:"statePath"`
+
+	// StateMaxAge is how old the persisted state can be to be restored.
+	// Defaults to 5m.
+	StateMaxAge time.Duration `yaml:"stateMaxAge"`
+
+	// WaitForHealthyOnStart holds the listeners until every target went
+	// through its first health check, so no request is served on a health
+	// state that was never observed.
+	WaitForHealthyOnStart bool `yaml:"waitForHealthyOnStart"`
+
+	// StartupTimeout bounds the first round of health checks. The listeners
+	// are bound anyway once it passed. Defaults to 30s.
+	StartupTimeout time.Duration `yaml:"startupTimeout"`
+
+	// StrictStartup refuses to start when the hostname of a target doesn't
+	// resolve. Otherwise such targets are marked unhealthy until their
+	// health checks pass, and startup only fails when no target is left.
+	StrictStartup bool `yaml:"strictStartup"`
+
+	// SourcePorts is a range of local ports the health checks connect from,
+	// e.g. "40000-40999", so they can be told apart from the traffic by the
+	// firewalls and the providers. Empty lets the system pick them.
+	SourcePorts string `yaml:"sourcePorts"`
+
+	// StrictDistinctBackends refuses to start when two targets share a
+	// backend, as failing over between them is an illusion. Otherwise the
+	// targets are logged and flagged by rpc_gateway_provider_shared_backend.
+	StrictDistinctBackends bool `yaml:"strictDistinctBackends"`
+
+	// DistinctBackendsByIP compares the targets on their resolved addresses
+	// and port, every 5 minutes, rather than on their hostname and port. It
+	// flags the providers behind the same CDN too.
+	DistinctBackendsByIP bool `yaml:"distinctBackendsByIP"`
+
+	// MaxConcurrentChecks bounds the health checks running at once across
+	// targets. Zero runs the checks of every target at once.
+	MaxConcurrentChecks uint `yaml:"maxConcurrentChecks"`
+
+	// BlockNumberStaleness is how old a block number observation can be to
+	// count towards the highest block of the targets. Defaults to 1m.
+	BlockNumberStaleness time.Duration `yaml:"blockNumberStaleness"`
+
+	// ConsensusSpreadThreshold is the number of blocks the healthy targets
+	// may be apart before a warning is logged, as a fork or a target on
+	// another chain is possible. Zero disables the warning.
+	ConsensusSpreadThreshold uint64 `yaml:"consensusSpreadThreshold"`
+
+	// MaxBlockAge marks unhealthy the targets whose latest block is older,
+	// going by its timestamp, e.g. 60s on mainnet. Zero disables the check,
+	// as do probes.
+	MaxBlockAge time.Duration `yaml:"maxBlockAge"`
+
+	// Probes replace the built-in eth checks, e.g. for non-EVM chains.
+	Probes []HealthCheckProbe `yaml:"probes"`
+
+	// Canary keeps recovering targets on probation until they serve live
+	// traffic successfully.
+	Canary CanaryConfig `yaml:"canary"`
+
+	// WriteMethodClasses are the method classes only routed to the targets
+	// passing their write health check. Defaults to ["sends"].
+	WriteMethodClasses []string `yaml:"writeMethodClasses"`
+}
+
+type QueueConfig struct {
+	// Depth is the number of requests allowed to wait for a target slot when
+	// every target is saturated. Requests beyond it are shed.
+	Depth uint `yaml:"depth"`
+
+	// MaxWait is how long a request waits for a slot before being shed.
+	MaxWait time.Duration `yaml:"maxWait"`
 }
 
 type ProxyConfig struct { // nolint:revive
 	Port            string        `yaml:"port"`
 	UpstreamTimeout time.Duration `yaml:"upstreamTimeout"`
+
+	// UpstreamBodyTimeout is how long the body of an upstream response may
+	// stall between two reads. A stalled attempt is failed and rerouted.
+	// Zero disables it.
+	UpstreamBodyTimeout time.Duration `yaml:"upstreamBodyTimeout"`
+
+	// RequestTimeout is the total time budget of a single request, shared
+	// across all of its upstream attempts. Zero disables the budget.
+	RequestTimeout time.Duration `yaml:"requestTimeout"`
+
+	// LoadBalancing selects how requests are spread across healthy targets,
+	// either "priority" (default), "leastPending", "clientHash",
+	// "weightedRoundRobin" or "score".
+	LoadBalancing string `yaml:"loadBalancing"`
+
+	// Score weighs the score of the targets, exported whatever the mode and
+	// used by the "score" one.
+	Score ScoreConfig `yaml:"score"`
+
+	// SlowStart is the window during which a recovered target's weight
+	// ramps up in the "weightedRoundRobin" mode. Defaults to 60s, a negative
+	// value disables it.
+	SlowStart time.Duration `yaml:"slowStart"`
+
+	// ClientHashHeader is the request header identifying a client in the
+	// "clientHash" mode. The client IP address is used when it's missing.
+	ClientHashHeader string `yaml:"clientHashHeader"`
+
+	// Queue configures how requests wait when every target reached its
+	// maxConcurrentRequests.
+	Queue QueueConfig `yaml:"queue"`
+
+	// FailoverBreaker stops rerouting the requests when too many are
+	// rerouted, so a failure shared by every target doesn't multiply their
+	// load.
+	FailoverBreaker FailoverBreakerConfig `yaml:"failoverBreaker"`
+
+	// PermanentFailures taints the targets failing in a way retries can't
+	// fix, e.g. a wrong URL.
+	PermanentFailures PermanentFailuresConfig `yaml:"permanentFailures"`
+
+	// MethodClasses groups JSON-RPC methods, so a target failing one kind of
+	// workload is only avoided for that workload. A trailing "*" matches a
+	// prefix.
+	MethodClasses map[string][]string `yaml:"methodClasses"`
+
+	// MaxRequestBodySize is the largest request body accepted, in bytes.
+	// Bodies are buffered so every attempt can replay them. Defaults to
+	// 10MiB.
+	MaxRequestBodySize int64 `yaml:"maxRequestBodySize"`
+
+	// ErrorNormalization maps provider specific errors to canonical JSON-RPC
+	// errors.
+	ErrorNormalization ErrorNormalizationConfig `yaml:"errorNormalization"`
+
+	// SlowQueryLog logs requests with large or slow responses.
+	SlowQueryLog SlowQueryLogConfig `yaml:"slowQueryLog"`
+
+	// Retry retries failed attempts on the same target before failing over.
+	Retry RetryConfig `yaml:"retry"`
+
+	// FaultInjection enables the faults configured on the targets.
+	FaultInjection FaultInjectionConfig `yaml:"faultInjection"`
+
+	// RecentErrors keeps the last errors of every target.
+	RecentErrors RecentErrorsConfig `yaml:"recentErrors"`
+
+	// DebugTrace lets clients ask for the upstream attempts of their
+	// requests.
+	DebugTrace DebugTraceConfig `yaml:"debugTrace"`
+
+	// AttemptsInErrors lists the failed upstream attempts of the requests no
+	// target could serve, with their provider and outcome, in the data of
+	// their error, so clients can tell why they failed. Off by default,
+	// which keeps the providers private.
+	AttemptsInErrors bool `yaml:"attemptsInErrors"`
+
+	// DebugSampling captures a sample of the requests, their bodies and
+	// every attempt included, to a separate sink.
+	DebugSampling DebugSamplingConfig `yaml:"debugSampling"`
+
+	// StatusPolicy sets how the 4xx responses of the targets are handled,
+	// per status code, so clients see the same behavior whichever provider
+	// served them.
+	StatusPolicy StatusPolicyConfig `yaml:"statusPolicy"`
+
+	// JSONRPCErrorActions sets what is done about the JSON-RPC errors served
+	// with a successful status code, per error code.
+	JSONRPCErrorActions JSONRPCErrorActionsConfig `yaml:"jsonRpcErrorActions"`
+
+	// ComputeUnits prices methods to count the spend per provider.
+	ComputeUnits ComputeUnitsConfig `yaml:"computeUnits"`
+
+	// ServerHeader sends the version of the gateway in the Server header of
+	// the responses. Defaults to true.
+	ServerHeader *bool `yaml:"serverHeader"`
+
+	// ResponseHeaders are set on every response, served by a target or by
+	// the gateway, replacing the headers of the targets. Their values expand
+	// environment variables, e.g. "${REGION}".
+	ResponseHeaders map[string]string `yaml:"responseHeaders"`
+
+	// RemoveResponseHeaders are stripped from every response, e.g. the
+	// Server or X-Powered-By headers of the targets. They're removed before
+	// ResponseHeaders are set.
+	RemoveResponseHeaders []string `yaml:"removeResponseHeaders"`
+
+	// UserAgent is sent to the targets, by both the proxied requests and the
+	// health checks. The targets can override it. Defaults to
+	// "rpc-gateway/<version>".
+	UserAgent string `yaml:"userAgent"`
+
+	// PassClientUserAgent forwards the User-Agent of the clients instead of
+	// replacing it with UserAgent.
+	PassClientUserAgent bool `yaml:"passClientUserAgent"`
+
+	// ForwardRequestID sends the request id of the gateway to the targets in
+	// X-Forwarded-Request-Id. It's the X-Request-Id of the client when it
+	// sent one, so clients and targets can find the same request.
+	ForwardRequestID bool `yaml:"forwardRequestId"`
+
+	// EnableH2C accepts HTTP/2 cleartext connections on the port of the
+	// proxy, along the HTTP/1.1 ones, e.g. from a service mesh.
+	EnableH2C bool `yaml:"enableH2C"`
+
+	// AllowGet accepts read-only calls sent with GET, their JSON-RPC request
+	// base64 encoded in the "request" query parameter. Other HTTP methods
+	// than POST and OPTIONS are refused.
+	AllowGet bool `yaml:"allowGet"`
+
+	// AllowClientOverrides lets clients lower the retries and reroutes of
+	// their requests with the X-RPC-Gateway-Max-Retries and
+	// X-RPC-Gateway-Max-Reroutes headers. They can't raise them.
+	AllowClientOverrides bool `yaml:"allowClientOverrides"`
+
+	// CacheControl sets the Cache-Control header of the responses per
+	// method, for a CDN in front of the gateway.
+	CacheControl CacheControlConfig `yaml:"cacheControl"`
+
+	// ImmutableCache caches the results of the methods looked up by hash
+	// once they're final.
+	ImmutableCache ImmutableCacheConfig `yaml:"immutableCache"`
+
+	// CacheBackend shares the caches across the replicas of the gateway.
+	CacheBackend CacheBackendConfig `yaml:"cacheBackend"`
+
+	// ClientIDHeader is the request header identifying the clients of the
+	// gateway, e.g. "X-Client-Id". The client labels the request metrics and
+	// is added to the access logs. Disabled when empty, every client adds
+	// series to the metrics.
+	ClientIDHeader string `yaml:"clientIdHeader"`
+
+	// ClientIDs are the client ids labeled as they are, the others are
+	// labeled "unknown". Without them, client ids are hashed.
+	ClientIDs []string `yaml:"clientIds"`
+
+	// ClientIDHashBuckets is the number of labels client ids are hashed into
+	// when ClientIDs is empty. Defaults to 16.
+	ClientIDHashBuckets int `yaml:"clientIdHashBuckets"`
+
+	// Stream enables the experimental /stream endpoint serving
+	// newline-delimited JSON-RPC requests.
+	Stream StreamConfig `yaml:"stream"`
 }
 
 // This struct is temporary. It's about to keep the input interface clean and simple.
@@ -22,4 +303,15 @@ type Config struct {
 	Targets            []NodeProviderConfig
 	HealthChecks       HealthCheckConfig
 	HealthcheckManager *HealthCheckManager
+	Metrics            metrics.Config
+
+	// Registerer is where metrics are registered, the Prometheus default
+	// registerer when nil.
+	Registerer prometheus.Registerer
+	// Transports overrides the HTTP transport per target name.
+	Transports map[string]http.RoundTripper
+	// TargetSelector replaces the configured load balancing mode when set.
+	TargetSelector TargetSelector
+	// Logger is used by the slow query log, slog.Default() when nil.
+	Logger *slog.Logger
 }
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// connectionMetrics are the metrics of the connections to the targets, to
+// tell a provider dropping connections from one answering slowly.
+type connectionMetrics struct {
+	dialsStarted   *prometheus.CounterVec
+	dialsSucceeded *prometheus.CounterVec
+	dialsFailed    *prometheus.CounterVec
+	tlsHandshake   *prometheus.HistogramVec
+	connsReused    *prometheus.CounterVec
+	connsNew       *prometheus.CounterVec
+}
+
+func newConnectionMetrics(factory promauto.Factory, namespace string) *connectionMetrics {
+	return &connectionMetrics{
+		dialsStarted: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "rpc_gateway_upstream_dials_started_total",
+				Help:      "The total number of connections dialed to a given provider, one per address tried",
+			}, []string{
+				"provider",
+			}),
+		dialsSucceeded: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "rpc_gateway_upstream_dials_succeeded_total",
+				Help:      "The total number of connections established to a given provider",
+			}, []string{
+				"provider",
+			}),
+		dialsFailed: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "rpc_gateway_upstream_dials_failed_total",
+				Help:      "The total number of connections to a given provider that couldn't be established",
+			}, []string{
+				"provider",
+			}),
+		tlsHandshake: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: namespace,
+				Name:      "rpc_gateway_upstream_tls_handshake_duration_seconds",
+				Help:      "Histogram of the TLS handshake durations with a given provider in seconds",
+				Buckets:   prometheus.DefBuckets,
+			}, []string{
+				"provider",
+			}),
+		connsReused: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "rpc_gateway_upstream_connections_reused_total",
+				Help:      "The total number of requests to a given provider sent over an existing connection",
+			}, []string{
+				"provider",
+			}),
+		connsNew: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: namespace,
+				Name:      "rpc_gateway_upstream_connections_new_total",
+				Help:      "The total number of requests to a given provider that needed a new connection",
+			}, []string{
+				"provider",
+			}),
+	}
+}
+
+// connectionMetricsTransport observes the connections used by the requests
+// to a target. It's below the retries, so every attempt is observed.
+type connectionMetricsTransport struct {
+	next    http.RoundTripper
+	name    string
+	metrics *connectionMetrics
+}
+
+func newConnectionMetricsTransport(
+	next http.RoundTripper,
+	name string,
+	metrics *connectionMetrics,
+) *connectionMetricsTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &connectionMetricsTransport{
+		next:    next,
+		name:    name,
+		metrics: metrics,
+	}
+}
+
+func (t *connectionMetricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var tlsStart time.Time
+
+	trace := &httptrace.ClientTrace{
+		ConnectStart: func(string, string) {
+			t.metrics.dialsStarted.WithLabelValues(t.name).Inc()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				t.metrics.dialsFailed.WithLabelValues(t.name).Inc()
+
+				return
+			}
+
+			t.metrics.dialsSucceeded.WithLabelValues(t.name).Inc()
+		},
+		TLSHandshakeStart: func() {
+			tlsStart = time.Now()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.metrics.tlsHandshake.WithLabelValues(t.name).Observe(time.Since(tlsStart).Seconds())
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				t.metrics.connsReused.WithLabelValues(t.name).Inc()
+
+				return
+			}
+
+			t.metrics.connsNew.WithLabelValues(t.name).Inc()
+		},
+	}
+
+	return t.next.RoundTrip(r.WithContext(httptrace.WithClientTrace(r.Context(), trace)))
+}
+
+func (t *connectionMetricsTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
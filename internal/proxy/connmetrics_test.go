@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newConnectionMetricsTestProxy(t *testing.T, url string) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: url,
+					// Its own transport, so no idle connection is shared
+					// with other tests.
+					//
+					Transport: NodeProviderTransportConfig{MaxIdleConnsPerHost: 1},
+				},
+			},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+	t.Cleanup(func() { p.targets[0].Provider.Close() })
+
+	return p
+}
+
+func TestHttpFailoverProxyConnectionMetricsReuse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	p := newConnectionMetricsTestProxy(t, server.URL)
+	metrics := p.metricConnections
+
+	for i := 0; i < 2; i++ {
+		rr := serveTracedRequest(p, nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.dialsStarted.WithLabelValues("Server1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.dialsSucceeded.WithLabelValues("Server1")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.dialsFailed.WithLabelValues("Server1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.connsNew.WithLabelValues("Server1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.connsReused.WithLabelValues("Server1")))
+}
+
+func TestHttpFailoverProxyConnectionMetricsDialFailure(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+
+	p := newConnectionMetricsTestProxy(t, server.URL)
+	metrics := p.metricConnections
+
+	rr := serveTracedRequest(p, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.dialsStarted.WithLabelValues("Server1")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(metrics.dialsFailed.WithLabelValues("Server1")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.dialsSucceeded.WithLabelValues("Server1")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(metrics.connsNew.WithLabelValues("Server1")))
+}
+
+func TestHttpFailoverProxyConnectionMetricsTLSHandshake(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: server.URL}},
+		},
+	}
+	config.Transports = map[string]http.RoundTripper{"Server1": server.Client().Transport}
+
+	p := newTestFailoverProxy(t, config)
+
+	rr := serveTracedRequest(p, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, 1, testutil.CollectAndCount(p.metricConnections.tlsHandshake))
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"sort"
+)
+
+// blockObservation is the latest block number observed on a target.
+type blockObservation struct {
+	name    string
+	number  uint64
+	healthy bool
+}
+
+// blockConsensus is the head of the network as seen by the targets.
+type blockConsensus struct {
+	// median is the median block number of the healthy targets, the lower
+	// of the two middle ones for an even count, so it's always a block a
+	// target reported.
+	median uint64
+
+	// lowest and highest are the targets at the ends of the healthy ones,
+	// spread the blocks between them.
+	lowest, highest string
+	spread          uint64
+
+	// deviations are the block numbers of every target minus the median,
+	// negative when behind.
+	deviations map[string]int64
+}
+
+// computeBlockConsensus computes the consensus of the healthy targets, and
+// how far from it every target is, healthy or not. It returns false when no
+// target is healthy.
+func computeBlockConsensus(observations []blockObservation) (blockConsensus, bool) {
+	healthy := make([]blockObservation, 0, len(observations))
+
+	for _, o := range observations {
+		if o.healthy {
+			healthy = append(healthy, o)
+		}
+	}
+
+	if len(healthy) == 0 {
+		return blockConsensus{}, false
+	}
+
+	sort.SliceStable(healthy, func(i, j int) bool { return healthy[i].number < healthy[j].number })
+
+	lowest, highest := healthy[0], healthy[len(healthy)-1]
+
+	consensus := blockConsensus{
+		median:     healthy[(len(healthy)-1)/2].number,
+		lowest:     lowest.name,
+		highest:    highest.name,
+		spread:     highest.number - lowest.number,
+		deviations: make(map[string]int64, len(observations)),
+	}
+
+	for _, o := range observations {
+		consensus.deviations[o.name] = int64(o.number) - int64(consensus.median)
+	}
+
+	return consensus, true
+}
+
+// reportConsensus exports the consensus block number of the targets whose
+// block number is recent, and their deviation from it, zero and none while
+// no target is healthy. A spread above the threshold is logged once, until
+// the targets agree again.
+func (h *HealthCheckManager) reportConsensus() {
+	observations := make([]blockObservation, 0, len(h.hcs))
+
+	for _, hc := range h.hcs {
+		observedAt := hc.BlockNumberObservedAt()
+		if observedAt.IsZero() || h.clock.Now().Sub(observedAt) > h.blockNumberStaleness() {
+			h.metricRPCProviderBlockDeviation.DeleteLabelValues(hc.Name())
+
+			continue
+		}
+
+		observations = append(observations, blockObservation{
+			name:    hc.Name(),
+			number:  hc.BlockNumber(),
+			healthy: hc.IsHealthy(),
+		})
+	}
+
+	// Without a healthy target there's no head to compare to, the last one
+	// isn't left exported as if it were still current.
+	//
+	consensus, ok := computeBlockConsensus(observations)
+	if !ok {
+		h.metricConsensusBlockNumber.Set(0)
+		h.metricRPCProviderBlockDeviation.Reset()
+
+		return
+	}
+
+	h.metricConsensusBlockNumber.Set(float64(consensus.median))
+
+	for name, deviation := range consensus.deviations {
+		h.metricRPCProviderBlockDeviation.WithLabelValues(name).Set(float64(deviation))
+	}
+
+	threshold := h.config.ConsensusSpreadThreshold
+	diverged := threshold > 0 && consensus.spread > threshold
+
+	switch {
+	case diverged && !h.consensusDiverged:
+		h.logger.Warn("targets disagree on the head of the chain, a fork or a target on another chain is possible",
+			"spread", consensus.spread, "median", consensus.median,
+			"lowest", consensus.lowest, "highest", consensus.highest)
+	case !diverged && h.consensusDiverged:
+		h.logger.Info("targets agree on the head of the chain again", "spread", consensus.spread)
+	}
+
+	h.consensusDiverged = diverged
+}
@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestComputeBlockConsensus(t *testing.T) {
+	tests := []struct {
+		name         string
+		observations []blockObservation
+		median       uint64
+		spread       uint64
+		deviations   map[string]int64
+	}{
+		{
+			name: "agreeing",
+			observations: []blockObservation{
+				{"a", 100, true}, {"b", 101, true}, {"c", 100, true},
+			},
+			median:     100,
+			spread:     1,
+			deviations: map[string]int64{"a": 0, "b": 1, "c": 0},
+		},
+		{
+			name: "even count takes the lower middle",
+			observations: []blockObservation{
+				{"a", 100, true}, {"b", 104, true},
+			},
+			median:     100,
+			spread:     4,
+			deviations: map[string]int64{"a": 0, "b": 4},
+		},
+		{
+			name: "outlier ahead on another chain",
+			observations: []blockObservation{
+				{"a", 100, true}, {"b", 101, true}, {"c", 99, true}, {"d", 5000, true}, {"e", 100, true},
+			},
+			median:     100,
+			spread:     4901,
+			deviations: map[string]int64{"a": 0, "b": 1, "c": -1, "d": 4900, "e": 0},
+		},
+		{
+			name: "outlier behind",
+			observations: []blockObservation{
+				{"a", 100, true}, {"b", 12, true}, {"c", 101, true},
+			},
+			median:     100,
+			spread:     89,
+			deviations: map[string]int64{"a": 0, "b": -88, "c": 1},
+		},
+		{
+			name: "unhealthy targets only deviate",
+			observations: []blockObservation{
+				{"a", 100, true}, {"b", 50, false}, {"c", 102, true},
+			},
+			median:     100,
+			spread:     2,
+			deviations: map[string]int64{"a": 0, "b": -50, "c": 2},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			consensus, ok := computeBlockConsensus(tt.observations)
+			require.True(t, ok)
+
+			assert.Equal(t, tt.median, consensus.median)
+			assert.Equal(t, tt.spread, consensus.spread)
+			assert.Equal(t, tt.deviations, consensus.deviations)
+		})
+	}
+
+	_, ok := computeBlockConsensus([]blockObservation{{"a", 100, false}})
+	assert.False(t, ok)
+}
+
+func TestHealthCheckManagerReportsConsensus(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var (
+		blocks  = []uint64{100, 101, 100}
+		numbers = make([]atomic.Uint64, len(blocks))
+		targets []NodeProviderConfig
+	)
+
+	for i := range blocks {
+		i := i
+
+		numbers[i].Store(blocks[i])
+
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var req JSONRPCRequest
+
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+			switch req.Method {
+			case "eth_blockNumber":
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x` + // nolint:errcheck
+					strconv.FormatUint(numbers[i].Load(), 16) + `"}`))
+			case "eth_call":
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`)) // nolint:errcheck
+			}
+		}))
+		t.Cleanup(node.Close)
+
+		targets = append(targets, NodeProviderConfig{
+			Name:       "Server" + strconv.Itoa(i+1),
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		})
+	}
+
+	var logs bytes.Buffer
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: targets,
+		Config:  HealthCheckConfig{Timeout: time.Second, ConsensusSpreadThreshold: 10},
+		Logger:  slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+	require.NoError(t, err)
+
+	check := func() {
+		for _, target := range targets {
+			hc, err := hcm.GetTargetByName(target.Name)
+			require.NoError(t, err)
+
+			hc.CheckAndSetHealth(context.Background())
+		}
+
+		hcm.reportConsensus()
+	}
+
+	check()
+
+	assert.Equal(t, 100.0, testutil.ToFloat64(hcm.metricConsensusBlockNumber))
+	assert.Equal(t, 1.0, testutil.ToFloat64(hcm.metricRPCProviderBlockDeviation.WithLabelValues("Server2")))
+	assert.NotContains(t, logs.String(), "disagree")
+
+	// One target jumps to another chain, the median doesn't follow it, and
+	// the spread is only logged once.
+	//
+	numbers[2].Store(90000)
+
+	check()
+	check()
+
+	assert.Equal(t, 101.0, testutil.ToFloat64(hcm.metricConsensusBlockNumber))
+	assert.Equal(t, 89899.0, testutil.ToFloat64(hcm.metricRPCProviderBlockDeviation.WithLabelValues("Server3")))
+	assert.Equal(t, -1.0, testutil.ToFloat64(hcm.metricRPCProviderBlockDeviation.WithLabelValues("Server1")))
+	assert.Equal(t, 1, strings.Count(logs.String(), "disagree"))
+
+	numbers[2].Store(101)
+
+	check()
+
+	assert.Contains(t, logs.String(), "agree on the head of the chain again")
+
+	// Without a healthy target, nothing is left exported.
+	//
+	for _, target := range targets {
+		hc, err := hcm.GetTargetByName(target.Name)
+		require.NoError(t, err)
+
+		hc.markUnhealthy(errors.New("down"))
+	}
+
+	hcm.reportConsensus()
+
+	assert.Zero(t, testutil.ToFloat64(hcm.metricConsensusBlockNumber))
+	assert.Zero(t, testutil.CollectAndCount(hcm.metricRPCProviderBlockDeviation))
+}
@@ -0,0 +1,348 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"hash/crc32"
+	"log/slog"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/pkg/errors"
+)
+
+// Debug sampling sinks.
+const (
+	DebugSamplingSinkLog  = "log"
+	DebugSamplingSinkFile = "file"
+)
+
+// DefaultDebugSamplingMaxBodyBytes is how many bytes of the bodies are
+// captured when no maxBodyBytes is configured.
+const DefaultDebugSamplingMaxBodyBytes = 4096
+
+// redactedHeaders aren't captured, their values are replaced.
+//
+//nolint:gochecknoglobals
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", DebugTokenHeader}
+
+// DebugSamplingConfig captures a sample of the requests with everything the
+// gateway knows about them, for offline analysis. Every sampled request is
+// written to the sink as a single JSON document.
+type DebugSamplingConfig struct {
+	// Rate is the fraction of the requests captured, from 0 to 1. Requests
+	// with an X-Request-Id are sampled on it, so every replica samples the
+	// same ones. Zero disables it.
+	Rate float64 `yaml:"rate"`
+
+	// Sink is "log" to write the documents to the logs, or "file" to append
+	// them to Path, one per line. Defaults to "log".
+	Sink string `yaml:"sink"`
+	Path string `yaml:"path"`
+
+	// MaxBodyBytes truncates the captured request and response bodies.
+	// Defaults to 4096.
+	MaxBodyBytes int `yaml:"maxBodyBytes"`
+}
+
+func (c DebugSamplingConfig) enabled() bool {
+	return c.Rate > 0
+}
+
+func (c DebugSamplingConfig) sink() string {
+	if c.Sink == "" {
+		return DebugSamplingSinkLog
+	}
+
+	return c.Sink
+}
+
+func (c DebugSamplingConfig) maxBodyBytes() int {
+	if c.MaxBodyBytes <= 0 {
+		return DefaultDebugSamplingMaxBodyBytes
+	}
+
+	return c.MaxBodyBytes
+}
+
+func (c DebugSamplingConfig) validate() error {
+	if c.Rate < 0 || c.Rate > 1 {
+		return errors.Errorf("debug sampling rate %v isn't between 0 and 1", c.Rate)
+	}
+
+	switch c.sink() {
+	case DebugSamplingSinkLog:
+		return nil
+	case DebugSamplingSinkFile:
+		if c.Path == "" {
+			return errors.New("debug sampling file sink requires a path")
+		}
+
+		return nil
+	default:
+		return errors.Errorf("invalid debug sampling sink %q", c.Sink)
+	}
+}
+
+// sampled reports whether r is captured. The decision only depends on the
+// request id when there's one.
+func (c DebugSamplingConfig) sampled(r *http.Request) bool {
+	if !c.enabled() {
+		return false
+	}
+
+	id := r.Header.Get(middleware.RequestIDHeader)
+	if id == "" {
+		return rand.Float64() < c.Rate //nolint:gosec
+	}
+
+	return float64(crc32.ChecksumIEEE([]byte(id)))/math.MaxUint32 < c.Rate
+}
+
+// debugSampler writes the documents of the sampled requests to the sink.
+type debugSampler struct {
+	config DebugSamplingConfig
+	logger *slog.Logger
+
+	// mu guards the file, closed being set once it's closed so late
+	// writes are dropped rather than hitting a closed file.
+	mu     sync.Mutex
+	file   *os.File
+	closed bool
+}
+
+func newDebugSampler(config DebugSamplingConfig, logger *slog.Logger) (*debugSampler, error) {
+	if !config.enabled() {
+		return nil, nil
+	}
+
+	s := &debugSampler{config: config, logger: logger}
+
+	if config.sink() == DebugSamplingSinkFile {
+		file, err := os.OpenFile(config.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot open debug sampling file")
+		}
+
+		s.file = file
+	}
+
+	return s, nil
+}
+
+func (s *debugSampler) write(sample DebugSample) {
+	document, err := json.Marshal(sample)
+	if err != nil {
+		s.logger.Warn("cannot encode debug sample", "error", err)
+
+		return
+	}
+
+	if s.file == nil {
+		s.logger.Info("debug sample", "sample", string(document))
+
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		s.logger.Debug("dropping debug sample, the sampler is closed")
+
+		return
+	}
+
+	if _, err := s.file.Write(append(document, '\n')); err != nil {
+		s.logger.Warn("cannot write debug sample", "error", err)
+	}
+}
+
+func (s *debugSampler) Close() error {
+	if s == nil || s.file == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+
+	s.closed = true
+
+	return s.file.Close()
+}
+
+// DebugSample is the document captured for a sampled request.
+type DebugSample struct {
+	Time       time.Time           `json:"time"`
+	RequestID  string              `json:"requestId,omitempty"`
+	Method     string              `json:"method"`
+	URL        string              `json:"url"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
+	Attempts   []SampledAttempt    `json:"attempts"`
+	Response   SampledResponse     `json:"response"`
+	DurationMs int64               `json:"durationMs"`
+}
+
+// SampledAttempt is an upstream attempt of a sampled request.
+type SampledAttempt struct {
+	Provider   string `json:"provider"`
+	DurationMs int64  `json:"durationMs"`
+	Outcome    string `json:"outcome"`
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error,omitempty"`
+	Body       string `json:"body"`
+}
+
+// SampledResponse is the response sent to the client of a sampled request.
+type SampledResponse struct {
+	StatusCode int                 `json:"statusCode"`
+	Headers    map[string][]string `json:"headers"`
+	Body       string              `json:"body"`
+}
+
+type debugCaptureContextKey struct{}
+
+// debugCapture collects the attempts of a sampled request. It's stored in
+// the request context, like the attempts.
+type debugCapture struct {
+	mu           sync.Mutex
+	maxBodyBytes int
+	attempts     []SampledAttempt
+}
+
+func withDebugCapture(c context.Context, d *debugCapture) context.Context {
+	return context.WithValue(c, debugCaptureContextKey{}, d)
+}
+
+func debugCaptureFromContext(c context.Context) *debugCapture {
+	d, ok := c.Value(debugCaptureContextKey{}).(*debugCapture)
+	if !ok {
+		return nil
+	}
+
+	return d
+}
+
+// Record adds an attempt against provider, started at start and served into
+// pw.
+func (d *debugCapture) Record(provider string, start time.Time, outcome string, pw *ReponseWriter, err error) {
+	attempt := SampledAttempt{
+		Provider:   provider,
+		DurationMs: time.Since(start).Milliseconds(),
+		Outcome:    outcome,
+		StatusCode: pw.statusCode,
+		Body:       truncate(pw.body.String(), d.maxBodyBytes),
+	}
+
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.attempts = append(d.attempts, attempt)
+}
+
+func (d *debugCapture) Attempts() []SampledAttempt {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	attempts := make([]SampledAttempt, len(d.attempts))
+	copy(attempts, d.attempts)
+
+	return attempts
+}
+
+// sampleWriter keeps the status and the beginning of the response to a
+// sampled request.
+type sampleWriter struct {
+	http.ResponseWriter
+
+	maxBodyBytes int
+	statusCode   int
+	body         bytes.Buffer
+}
+
+func (s *sampleWriter) WriteHeader(statusCode int) {
+	if s.statusCode == 0 {
+		s.statusCode = statusCode
+	}
+
+	s.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *sampleWriter) Write(b []byte) (int, error) {
+	if s.statusCode == 0 {
+		s.statusCode = http.StatusOK
+	}
+
+	if remaining := s.maxBodyBytes + 1 - s.body.Len(); remaining > 0 {
+		s.body.Write(b[:min(len(b), remaining)])
+	}
+
+	return s.ResponseWriter.Write(b)
+}
+
+// startSample captures r, whose body has been read into body, when it's
+// sampled. It returns the writer and request to serve it with, and a
+// function writing the document once served.
+func (p *Proxy) startSample(
+	w http.ResponseWriter,
+	r *http.Request,
+	body []byte,
+) (http.ResponseWriter, *http.Request, func()) {
+	if p.debugSampler == nil || !p.debugSampler.config.sampled(r) {
+		return w, r, func() {}
+	}
+
+	maxBodyBytes := p.debugSampler.config.maxBodyBytes()
+	start := time.Now()
+
+	sample := DebugSample{
+		Time:      start,
+		RequestID: middleware.GetReqID(r.Context()),
+		Method:    r.Method,
+		URL:       r.URL.String(),
+		Headers:   redactHeaders(r.Header),
+		Body:      truncate(string(body), maxBodyBytes),
+	}
+
+	capture := &debugCapture{maxBodyBytes: maxBodyBytes}
+	sw := &sampleWriter{ResponseWriter: w, maxBodyBytes: maxBodyBytes}
+
+	return sw, r.WithContext(withDebugCapture(r.Context(), capture)), func() {
+		sample.Attempts = capture.Attempts()
+		sample.Response = SampledResponse{
+			StatusCode: sw.statusCode,
+			Headers:    redactHeaders(sw.Header()),
+			Body:       truncate(sw.body.String(), maxBodyBytes),
+		}
+		sample.DurationMs = time.Since(start).Milliseconds()
+
+		p.debugSampler.write(sample)
+	}
+}
+
+func redactHeaders(header http.Header) map[string][]string {
+	redacted := header.Clone()
+
+	for _, name := range redactedHeaders {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "REDACTED")
+		}
+	}
+
+	return redacted
+}
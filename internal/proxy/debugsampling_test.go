@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSamplingProxy(t *testing.T, sampling DebugSamplingConfig) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("upstream is down"))
+	}))
+	t.Cleanup(failing.Close)
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x` + strings.Repeat("a", 64) + `"}`))
+	}))
+	t.Cleanup(working.Close)
+
+	config := createConfig()
+	config.Proxy.DebugSampling = sampling
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: failing.URL}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: working.URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+	t.Cleanup(func() { p.debugSampler.Close() })
+
+	return p
+}
+
+func readDebugSamples(t *testing.T, path string) []DebugSample {
+	t.Helper()
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer file.Close()
+
+	samples := []DebugSample{}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var sample DebugSample
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &sample))
+		samples = append(samples, sample)
+	}
+
+	return samples
+}
+
+func TestHttpFailoverProxyDebugSampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "samples.jsonl")
+
+	p := newTestSamplingProxy(t, DebugSamplingConfig{
+		Rate:         1,
+		Sink:         DebugSamplingSinkFile,
+		Path:         path,
+		MaxBodyBytes: 32,
+	})
+
+	payload := `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":[{"to":"0x0000000000000000000000000000000000000000"}]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/?pretty=0", bytes.NewBufferString(payload))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set(DebugTokenHeader, "secret")
+	req.Header.Set("X-Client", "tests")
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	samples := readDebugSamples(t, path)
+	require.Len(t, samples, 1)
+
+	sample := samples[0]
+	assert.Equal(t, http.MethodPost, sample.Method)
+	assert.Equal(t, "/?pretty=0", sample.URL)
+	assert.Equal(t, []string{"REDACTED"}, sample.Headers["Authorization"])
+	assert.Equal(t, []string{"REDACTED"}, sample.Headers[http.CanonicalHeaderKey(DebugTokenHeader)])
+	assert.Equal(t, []string{"tests"}, sample.Headers["X-Client"])
+	assert.Equal(t, payload[:32]+"...", sample.Body)
+
+	require.NotEmpty(t, sample.Attempts)
+
+	first, last := sample.Attempts[0], sample.Attempts[len(sample.Attempts)-1]
+	assert.Equal(t, "Server1", first.Provider)
+	assert.Equal(t, "http_"+strconv.Itoa(http.StatusBadGateway), first.Outcome)
+	assert.Equal(t, http.StatusBadGateway, first.StatusCode)
+	assert.Equal(t, "upstream is down", first.Body)
+	assert.Equal(t, "Server2", last.Provider)
+	assert.Equal(t, "success", last.Outcome)
+	assert.Equal(t, http.StatusOK, last.StatusCode)
+
+	assert.Equal(t, http.StatusOK, sample.Response.StatusCode)
+	assert.Equal(t, rr.Body.String()[:32]+"...", sample.Response.Body)
+	assert.NotEmpty(t, sample.Response.Headers)
+}
+
+func TestHttpFailoverProxyDebugSamplingTransportError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "samples.jsonl")
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	config := createConfig()
+	config.Proxy.DebugSampling = DebugSamplingConfig{Rate: 1, Sink: DebugSamplingSinkFile, Path: path}
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: closed.URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+	t.Cleanup(func() { p.debugSampler.Close() })
+
+	// The error of the attempt is the one the error handler got.
+	//
+	rr := serveTracedRequest(p, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	samples := readDebugSamples(t, path)
+	require.Len(t, samples, 1)
+	require.NotEmpty(t, samples[0].Attempts)
+	assert.NotEmpty(t, samples[0].Attempts[0].Error)
+	assert.Equal(t, http.StatusServiceUnavailable, samples[0].Response.StatusCode)
+}
+
+func TestDebugSamplingDecision(t *testing.T) {
+	config := DebugSamplingConfig{Rate: 0.5}
+
+	sampled := 0
+
+	for i := 0; i < 1000; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(middleware.RequestIDHeader, "request-"+strconv.Itoa(i))
+
+		// Every replica makes the same decision for a request id.
+		//
+		decision := config.sampled(req)
+		assert.Equal(t, decision, config.sampled(req))
+
+		if decision {
+			sampled++
+		}
+	}
+
+	assert.InDelta(t, 500, sampled, 100)
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	assert.False(t, DebugSamplingConfig{}.sampled(req))
+	assert.True(t, DebugSamplingConfig{Rate: 1}.sampled(req))
+}
+
+func TestDebugSamplingConfigValidate(t *testing.T) {
+	assert.NoError(t, DebugSamplingConfig{}.validate())
+	assert.NoError(t, DebugSamplingConfig{Rate: 0.001}.validate())
+	assert.Error(t, DebugSamplingConfig{Rate: 2}.validate())
+	assert.Error(t, DebugSamplingConfig{Rate: 1, Sink: DebugSamplingSinkFile}.validate())
+	assert.Error(t, DebugSamplingConfig{Rate: 1, Sink: "kafka"}.validate())
+}
+
+func TestDebugSamplerDropsSamplesOnceClosed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "samples.jsonl")
+
+	sampler, err := newDebugSampler(
+		DebugSamplingConfig{Rate: 1, Sink: DebugSamplingSinkFile, Path: path},
+		slog.New(slog.NewTextHandler(io.Discard, nil)),
+	)
+	require.NoError(t, err)
+
+	sampler.write(DebugSample{Method: http.MethodPost})
+	require.NoError(t, sampler.Close())
+
+	// A request still in flight when the sampler is closed.
+	//
+	sampler.write(DebugSample{Method: http.MethodPost})
+	assert.NoError(t, sampler.Close())
+
+	assert.Len(t, readDebugSamples(t, path), 1)
+}
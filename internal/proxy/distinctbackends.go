@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// distinctBackendsInterval is how often the addresses of the targets are
+// resolved again to compare them, with DistinctBackendsByIP.
+const distinctBackendsInterval = 5 * time.Minute
+
+// ErrSharedBackend is returned when two targets share a backend with
+// StrictDistinctBackends.
+var ErrSharedBackend = errors.New("targets share a backend")
+
+// backendEndpoint returns the host:port of the target served at rawURL,
+// empty when it has none.
+func backendEndpoint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// backends returns the backends of a target: its host:port, or each of
+// its resolved addresses with the port when byIP is set.
+func (e *healthCheckEntry) backends(c context.Context, byIP bool) []string {
+	if !byIP || e.host == "" {
+		return []string{e.endpoint}
+	}
+
+	_, port, _ := net.SplitHostPort(e.endpoint)
+
+	// A target that doesn't resolve has no backend to share, its health
+	// checks fail anyway.
+	//
+	addrs, err := e.resolver.LookupIPAddr(c, e.host)
+	if err != nil {
+		return nil
+	}
+
+	backends := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		backends = append(backends, net.JoinHostPort(addr.IP.String(), port))
+	}
+
+	return backends
+}
+
+// checkDistinctBackends looks for the targets sharing a backend, so
+// failing over between them is an illusion. They're logged and exported,
+// and an error is returned with StrictDistinctBackends. Targets are compared
+// on their hostname, as providers behind a CDN legitimately share addresses,
+// or on their resolved addresses with DistinctBackendsByIP.
+func (h *HealthCheckManager) checkDistinctBackends(c context.Context, byIP bool) error {
+	targets := map[string][]string{}
+
+	for _, hc := range h.hcs {
+		e := h.entries[hc.Name()]
+		if e.endpoint == "" {
+			continue
+		}
+
+		for _, backend := range e.backends(c, byIP) {
+			if names := targets[backend]; len(names) == 0 || names[len(names)-1] != hc.Name() {
+				targets[backend] = append(names, hc.Name())
+			}
+		}
+	}
+
+	backends := make([]string, 0, len(targets))
+	for backend := range targets {
+		backends = append(backends, backend)
+	}
+
+	sort.Strings(backends)
+
+	var (
+		shared = map[string]bool{}
+		err    error
+	)
+
+	for _, backend := range backends {
+		names := targets[backend]
+		if len(names) < 2 {
+			continue
+		}
+
+		h.logger.Warn("targets share a backend, failing over between them won't help",
+			"backend", backend, "targets", names)
+
+		for _, name := range names {
+			shared[name] = true
+		}
+
+		if err == nil && h.config.StrictDistinctBackends {
+			err = errors.Wrapf(ErrSharedBackend, "targets %q share %s", names, backend)
+		}
+	}
+
+	for _, hc := range h.hcs {
+		value := 0.0
+		if shared[hc.Name()] {
+			value = 1
+		}
+
+		h.metricRPCProviderSharedBackend.WithLabelValues(hc.Name()).Set(value)
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDistinctBackendsManager(t *testing.T, config HealthCheckConfig, urls map[string]string) (*HealthCheckManager, error) {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	targets := []NodeProviderConfig{}
+	for _, name := range []string{"Server1", "Server2", "Server3"} {
+		targets = append(targets, NodeProviderConfig{
+			Name:       name,
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: urls[name]}},
+		})
+	}
+
+	return NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: targets,
+		Config:  config,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	})
+}
+
+func assertSharedBackends(t *testing.T, hcm *HealthCheckManager, expected map[string]float64) {
+	t.Helper()
+
+	for name, value := range expected {
+		assert.Equal(t, value, testutil.ToFloat64(hcm.metricRPCProviderSharedBackend.WithLabelValues(name)), name)
+	}
+}
+
+func TestHealthCheckManagerFlagsDuplicateHostnames(t *testing.T) {
+	urls := map[string]string{
+		"Server1": "https://node.example.com/v2/key1",
+		"Server2": "https://NODE.example.com:443/v2/key2",
+		"Server3": "https://node.example.com:8545",
+	}
+
+	hcm, err := newTestDistinctBackendsManager(t, HealthCheckConfig{}, urls)
+	require.NoError(t, err)
+
+	assertSharedBackends(t, hcm, map[string]float64{"Server1": 1, "Server2": 1, "Server3": 0})
+
+	_, err = newTestDistinctBackendsManager(t, HealthCheckConfig{StrictDistinctBackends: true}, urls)
+	assert.ErrorIs(t, err, ErrSharedBackend)
+
+	urls["Server2"] = "https://other.example.com"
+
+	_, err = newTestDistinctBackendsManager(t, HealthCheckConfig{StrictDistinctBackends: true}, urls)
+	assert.NoError(t, err)
+}
+
+func TestHealthCheckManagerComparesSharedIPsOptIn(t *testing.T) {
+	urls := map[string]string{
+		"Server1": "https://a.example.com",
+		"Server2": "https://b.example.com",
+		"Server3": "http://10.0.0.1:8545",
+	}
+
+	resolver := &fakeResolver{addrs: map[string][]net.IPAddr{}}
+	resolver.Set("a.example.com", "10.0.0.1", "10.0.0.2")
+	resolver.Set("b.example.com", "10.0.0.2")
+
+	// Distinct hostnames behind the same CDN aren't flagged by default.
+	//
+	hcm, err := newTestDistinctBackendsManager(t, HealthCheckConfig{StrictDistinctBackends: true}, urls)
+	require.NoError(t, err)
+
+	assertSharedBackends(t, hcm, map[string]float64{"Server1": 0, "Server2": 0, "Server3": 0})
+
+	for _, config := range []HealthCheckConfig{
+		{DistinctBackendsByIP: true},
+		{DistinctBackendsByIP: true, StrictDistinctBackends: true},
+	} {
+		hcm, err := newTestDistinctBackendsManager(t, config, urls)
+		require.NoError(t, err)
+
+		for _, e := range hcm.entries {
+			e.resolver = resolver
+		}
+
+		err = hcm.checkDistinctBackends(context.Background(), true)
+		if config.StrictDistinctBackends {
+			assert.ErrorIs(t, err, ErrSharedBackend)
+		} else {
+			assert.NoError(t, err)
+		}
+
+		// The third target shares an address, not the port.
+		//
+		assertSharedBackends(t, hcm, map[string]float64{"Server1": 1, "Server2": 1, "Server3": 0})
+	}
+}
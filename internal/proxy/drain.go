@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultDrainTimeout is how long a draining target may take to finish
+	// its requests in flight when no timeout is given.
+	DefaultDrainTimeout = 30 * time.Second
+
+	// drainPollInterval is how often the requests in flight of a draining
+	// target are counted.
+	drainPollInterval = 10 * time.Millisecond
+)
+
+// ErrProxyClosed is returned for the work refused once the proxy shuts
+// down.
+var ErrProxyClosed = errors.New("proxy is shutting down")
+
+// States of a target.
+const (
+	// TargetStateActive targets are selected for new requests.
+	TargetStateActive = "active"
+	// TargetStateDraining targets finish their requests in flight, but
+	// aren't selected for new ones.
+	TargetStateDraining = "draining"
+	// TargetStateDrained targets have been closed.
+	TargetStateDrained = "drained"
+)
+
+// State returns whether the target is active, draining or drained.
+func (n *NodeProvider) State() string {
+	switch {
+	case n.drained.Load():
+		return TargetStateDrained
+	case n.draining.Load():
+		return TargetStateDraining
+	default:
+		return TargetStateActive
+	}
+}
+
+// Draining reports whether the target stopped accepting new requests.
+func (n *NodeProvider) Draining() bool {
+	return n.draining.Load()
+}
+
+// hasActiveTargets reports whether any target is configured and not
+// draining.
+func (p *Proxy) hasActiveTargets() bool {
+	for _, target := range p.targets {
+		if !target.Draining() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// awaitIdle waits until the target has no requests in flight, or the timeout
+// passed. It reports whether the target is idle.
+func (n *NodeProvider) awaitIdle(timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for n.Pending() > 0 {
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return n.Pending() == 0
+		}
+	}
+
+	return true
+}
+
+// Drain stops selecting the named target for new requests. Its provider is
+// closed in the background, once the requests in flight are done or the
+// timeout passed. Draining a target twice has no effect, and no target is
+// drained once the proxy shuts down.
+func (p *Proxy) Drain(name string, timeout time.Duration) error {
+	target, err := p.target(name)
+	if err != nil {
+		return err
+	}
+
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+
+	if !target.draining.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	drained := p.goBackground(&p.drains, func() {
+		p.logger.Info("draining target", "nodeprovider", name, "pending", target.Pending())
+
+		if !target.awaitIdle(timeout) {
+			p.logger.Warn("drain timed out, closing target with requests in flight",
+				"nodeprovider", name, "pending", target.Pending())
+		}
+
+		if err := target.Provider.Close(); err != nil {
+			p.logger.Error("cannot close drained target", "nodeprovider", name, "error", err)
+		}
+
+		target.drained.Store(true)
+
+		p.logger.Info("target drained", "nodeprovider", name)
+	})
+
+	// The shutdown closes the target itself.
+	//
+	if !drained {
+		target.draining.Store(false)
+
+		return ErrProxyClosed
+	}
+
+	return nil
+}
+
+// Targets returns the configured targets, in the configured order.
+func (p *Proxy) Targets() []*NodeProvider {
+	return append([]*NodeProvider(nil), p.targets...)
+}
@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpFailoverProxyDrainsTarget(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+		calls   atomic.Int64
+	)
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"primary"}`))
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"secondary"}`))
+	}))
+	defer secondary.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Primary",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: primary.URL,
+				},
+			},
+		},
+		{
+			Name: "Secondary",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: secondary.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	long := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		long <- serve()
+	}()
+
+	<-started
+
+	primaryTarget, err := httpFailoverProxy.target("Primary")
+	assert.NoError(t, err)
+
+	assert.NoError(t, httpFailoverProxy.Drain("Primary", time.Minute))
+	assert.Equal(t, TargetStateDraining, primaryTarget.State())
+
+	// New requests go elsewhere while the long one is in flight.
+	//
+	assert.Contains(t, serve().Body.String(), "secondary")
+	assert.Equal(t, int64(1), calls.Load())
+	assert.Equal(t, TargetStateDraining, primaryTarget.State())
+
+	close(release)
+
+	rr := <-long
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "primary")
+
+	assert.Eventually(t, func() bool {
+		return primaryTarget.State() == TargetStateDrained
+	}, time.Second, time.Millisecond)
+
+	assert.Contains(t, serve().Body.String(), "secondary")
+	assert.ErrorIs(t, httpFailoverProxy.Drain("Unknown", 0), ErrTargetNotFound)
+
+	// The drained target isn't closed again on shutdown, and no target is
+	// drained after it.
+	//
+	var closes atomic.Int64
+
+	for _, target := range httpFailoverProxy.targets {
+		target.Provider = closeCountingProvider{Provider: target.Provider, closes: &closes}
+	}
+
+	assert.NoError(t, httpFailoverProxy.Close())
+	assert.Equal(t, int64(1), closes.Load())
+
+	assert.ErrorIs(t, httpFailoverProxy.Drain("Secondary", 0), ErrProxyClosed)
+
+	secondaryTarget, err := httpFailoverProxy.target("Secondary")
+	assert.NoError(t, err)
+	assert.Equal(t, TargetStateActive, secondaryTarget.State())
+}
+
+// closeCountingProvider counts the calls to Close.
+type closeCountingProvider struct {
+	Provider
+	closes *atomic.Int64
+}
+
+func (p closeCountingProvider) Close() error {
+	p.closes.Add(1)
+
+	return p.Provider.Close()
+}
+
+func TestNodeProviderDrainTimeout(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				Mock: &NodeProviderConnectionMockConfig{},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	target, err := httpFailoverProxy.target("Server1")
+	assert.NoError(t, err)
+
+	// A request stuck in flight doesn't hold the drain forever.
+	//
+	target.pending.Add(1)
+
+	assert.False(t, target.awaitIdle(50*time.Millisecond))
+	assert.NoError(t, httpFailoverProxy.Drain("Server1", 50*time.Millisecond))
+
+	assert.Eventually(t, func() bool {
+		return target.State() == TargetStateDrained
+	}, time.Second, time.Millisecond)
+}
+
+func TestHttpFailoverProxyWithoutActiveTargets(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		drain bool
+	}{
+		{name: "no target configured"},
+		{name: "every target drained", drain: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, mode := range []string{
+				LoadBalancingPriority,
+				LoadBalancingLeastPending,
+				LoadBalancingClientHash,
+				LoadBalancingWeightedRoundRobin,
+			} {
+				prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+				config := createConfig()
+				config.Proxy.LoadBalancing = mode
+				config.Proxy.Queue = QueueConfig{Depth: 10, MaxWait: time.Minute}
+
+				if !tc.drain {
+					config.Targets = nil
+				}
+
+				p := newTestFailoverProxy(t, config)
+
+				for _, target := range p.Targets() {
+					assert.NoError(t, p.Drain(target.Name(), time.Second))
+				}
+
+				start := time.Now()
+
+				rr := httptest.NewRecorder()
+				p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+					bytes.NewBufferString(`{"jsonrpc":"2.0","id":7,"method":"eth_blockNumber"}`)))
+
+				assert.Less(t, time.Since(start), time.Second, mode)
+				assert.Equal(t, http.StatusServiceUnavailable, rr.Code, mode)
+				assert.Contains(t, rr.Body.String(), `"id":7`, mode)
+				assert.Contains(t, rr.Body.String(), `"reason":"no_active_provider"`, mode)
+
+				assert.Equal(t, float64(len(config.Targets)), testutil.ToFloat64(p.metricConfiguredTargets), mode)
+
+				p.drains.Wait()
+			}
+		})
+	}
+}
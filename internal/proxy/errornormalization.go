@@ -0,0 +1,260 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-http-utils/headers"
+)
+
+// ErrorNormalizationConfig rewrites provider specific errors to canonical
+// JSON-RPC errors, so clients don't need to know which provider served them.
+type ErrorNormalizationConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Rules apply to every target, after the rules of the target itself.
+	// Defaults to DefaultErrorNormalizationRules.
+	Rules []ErrorNormalizationRule `yaml:"rules"`
+}
+
+// ErrorNormalizationRule matches a provider error and the canonical error it
+// is rewritten to. Every condition set has to match, at least one has to be
+// set.
+type ErrorNormalizationRule struct {
+	// Name labels the normalizations counted by the rule.
+	Name string `yaml:"name"`
+
+	// HTTPStatus matches the status code of the upstream response.
+	HTTPStatus int `yaml:"httpStatus"`
+	// Code matches the code of a JSON-RPC error.
+	Code int `yaml:"code"`
+	// MessageContains matches the message of a JSON-RPC error.
+	MessageContains string `yaml:"messageContains"`
+
+	To CanonicalError `yaml:"to"`
+}
+
+// CanonicalError is the error returned to the client instead of the provider
+// error.
+type CanonicalError struct {
+	// Status is the HTTP status code. Defaults to 200.
+	Status  int    `yaml:"status"`
+	Code    int    `yaml:"code"`
+	Message string `yaml:"message"`
+}
+
+// DefaultErrorNormalizationRules maps the common rate limiting shapes to a
+// single error.
+func DefaultErrorNormalizationRules() []ErrorNormalizationRule {
+	rateLimited := CanonicalError{
+		Status:  http.StatusTooManyRequests,
+		Code:    JSONRPCErrorLimitExceeded,
+		Message: "rate limited",
+	}
+
+	return []ErrorNormalizationRule{
+		{Name: "http_429", HTTPStatus: http.StatusTooManyRequests, To: rateLimited},
+		{Name: "code_429", Code: http.StatusTooManyRequests, To: rateLimited},
+		{Name: "limit_exceeded", Code: JSONRPCErrorLimitExceeded, To: rateLimited},
+	}
+}
+
+// jsonRPCResponseEnvelope is the part of a JSON-RPC response the normalizer
+// needs.
+type jsonRPCResponseEnvelope struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *JSONRPCError   `json:"error,omitempty"`
+}
+
+type errorNormalizer struct {
+	rules     []ErrorNormalizationRule
+	perTarget map[string][]ErrorNormalizationRule
+}
+
+func newErrorNormalizer(config ErrorNormalizationConfig, targets []NodeProviderConfig) *errorNormalizer {
+	if !config.Enabled {
+		return nil
+	}
+
+	rules := config.Rules
+	if len(rules) == 0 {
+		rules = DefaultErrorNormalizationRules()
+	}
+
+	n := &errorNormalizer{
+		rules:     rules,
+		perTarget: map[string][]ErrorNormalizationRule{},
+	}
+
+	for _, target := range targets {
+		n.perTarget[target.Name] = target.ErrorNormalizationRules
+	}
+
+	return n
+}
+
+func (r ErrorNormalizationRule) matches(statusCode int, e *JSONRPCError) bool {
+	if r.HTTPStatus == 0 && r.Code == 0 && r.MessageContains == "" {
+		return false
+	}
+
+	if r.HTTPStatus != 0 && r.HTTPStatus != statusCode {
+		return false
+	}
+
+	if r.Code != 0 && (e == nil || e.Code != r.Code) {
+		return false
+	}
+
+	if r.MessageContains != "" && (e == nil || !strings.Contains(e.Message, r.MessageContains)) {
+		return false
+	}
+
+	return true
+}
+
+func (n *errorNormalizer) match(target string, statusCode int, e *JSONRPCError) (ErrorNormalizationRule, bool) {
+	for _, rules := range [][]ErrorNormalizationRule{n.perTarget[target], n.rules} {
+		for _, rule := range rules {
+			if rule.matches(statusCode, e) {
+				return rule, true
+			}
+		}
+	}
+
+	return ErrorNormalizationRule{}, false
+}
+
+func canonicalResponse(rule ErrorNormalizationRule, id json.RawMessage) jsonRPCResponseEnvelope {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	return jsonRPCResponseEnvelope{
+		Jsonrpc: "2.0",
+		ID:      id,
+		Error: &JSONRPCError{
+			Code:    rule.To.Code,
+			Message: rule.To.Message,
+		},
+	}
+}
+
+// normalize rewrites pw when it holds an error matched by a rule. Successful
+// results are never rewritten. It returns the names of the rules applied.
+func (n *errorNormalizer) normalize(target string, pw *ReponseWriter, requests []JSONRPCRequest) []string {
+	body := bytes.TrimSpace(pw.body.Bytes())
+
+	if len(body) > 0 && body[0] == '[' {
+		return n.normalizeBatch(target, pw, body)
+	}
+
+	var (
+		response jsonRPCResponseEnvelope
+		e        *JSONRPCError
+	)
+
+	if err := json.Unmarshal(body, &response); err == nil {
+		if response.Error == nil && pw.statusCode < http.StatusBadRequest {
+			return nil
+		}
+
+		e = response.Error
+	}
+
+	rule, ok := n.match(target, pw.statusCode, e)
+	if !ok {
+		return nil
+	}
+
+	// Responses that aren't JSON-RPC, like a plain HTTP 429, get the ids of
+	// the request.
+	//
+	var canonical any
+
+	switch {
+	case len(response.ID) > 0:
+		canonical = canonicalResponse(rule, response.ID)
+	case len(requests) == 1:
+		canonical = canonicalResponse(rule, requests[0].ID)
+	case len(requests) > 1:
+		batch := make([]jsonRPCResponseEnvelope, 0, len(requests))
+		for _, request := range requests {
+			batch = append(batch, canonicalResponse(rule, request.ID))
+		}
+
+		canonical = batch
+	default:
+		canonical = canonicalResponse(rule, nil)
+	}
+
+	rewriteResponse(pw, rule.To.Status, canonical)
+
+	return []string{rule.Name}
+}
+
+// normalizeBatch rewrites the errors of a batch response one by one, keeping
+// the other elements as they are and the status code.
+func (n *errorNormalizer) normalizeBatch(target string, pw *ReponseWriter, body []byte) []string {
+	var elements []json.RawMessage
+	if err := json.Unmarshal(body, &elements); err != nil {
+		return nil
+	}
+
+	var applied []string
+
+	for i, element := range elements {
+		var response jsonRPCResponseEnvelope
+		if err := json.Unmarshal(element, &response); err != nil || response.Error == nil {
+			continue
+		}
+
+		rule, ok := n.match(target, pw.statusCode, response.Error)
+		if !ok {
+			continue
+		}
+
+		canonical, err := json.Marshal(canonicalResponse(rule, response.ID))
+		if err != nil {
+			continue
+		}
+
+		elements[i] = canonical
+		applied = append(applied, rule.Name)
+	}
+
+	if len(applied) > 0 {
+		rewriteResponse(pw, pw.statusCode, elements)
+	}
+
+	return applied
+}
+
+// rewriteResponse replaces the response held by pw with v encoded as JSON.
+// Retry-After is kept, so the clients and the cooldowns still wait as long
+// as the target asked, and so is a JSON content type with its parameters.
+func rewriteResponse(pw *ReponseWriter, statusCode int, v any) {
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+
+	retryAfter := pw.header.Get(headers.RetryAfter)
+
+	contentType := pw.header.Get(headers.ContentType)
+	if !strings.HasPrefix(contentType, "application/json") {
+		contentType = "application/json"
+	}
+
+	pw.reset(statusCode)
+	pw.header.Set(headers.ContentType, contentType)
+
+	if retryAfter != "" {
+		pw.header.Set(headers.RetryAfter, retryAfter)
+	}
+
+	json.NewEncoder(pw.body).Encode(v) // nolint:errcheck
+}
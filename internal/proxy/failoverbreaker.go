@@ -0,0 +1,150 @@
+package proxy
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultFailoverBreakerWindow is the window the reroutes are counted
+	// over.
+	DefaultFailoverBreakerWindow = 10 * time.Second
+
+	// DefaultFailoverBreakerCooldown is how long the breaker stays open.
+	DefaultFailoverBreakerCooldown = 30 * time.Second
+)
+
+// FailoverBreakerConfig stops rerouting the requests when too many of them
+// are. When a dependency shared by every target fails, e.g. DNS, every
+// request goes through every target, multiplying their load by their count
+// when they can least afford it.
+type FailoverBreakerConfig struct {
+	// MaxReroutesPerSecond is the rate of reroutes over Window above which
+	// the breaker opens. Zero disables the breaker.
+	MaxReroutesPerSecond float64 `yaml:"maxReroutesPerSecond"`
+
+	// Window is the window the reroutes are counted over. Defaults to 10s.
+	Window time.Duration `yaml:"window"`
+
+	// Cooldown is how long the breaker stays open, the requests are only
+	// attempted once meanwhile. Defaults to 30s.
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+func (c FailoverBreakerConfig) validate() error {
+	if c.MaxReroutesPerSecond < 0 {
+		return errors.Errorf("invalid failover breaker maxReroutesPerSecond %v", c.MaxReroutesPerSecond)
+	}
+
+	if c.Window < 0 || c.Cooldown < 0 {
+		return errors.New("failover breaker window and cooldown cannot be negative")
+	}
+
+	return nil
+}
+
+func (c FailoverBreakerConfig) window() time.Duration {
+	if c.Window == 0 {
+		return DefaultFailoverBreakerWindow
+	}
+
+	return c.Window
+}
+
+func (c FailoverBreakerConfig) cooldown() time.Duration {
+	if c.Cooldown == 0 {
+		return DefaultFailoverBreakerCooldown
+	}
+
+	return c.Cooldown
+}
+
+// failoverBreaker counts the reroutes of every request, over fixed windows.
+// A nil breaker always allows them.
+type failoverBreaker struct {
+	maxReroutes float64
+	window      time.Duration
+	cooldown    time.Duration
+	logger      *slog.Logger
+	metricOpen  prometheus.Gauge
+
+	mu          sync.Mutex
+	windowStart time.Time
+	reroutes    int
+	openUntil   time.Time
+}
+
+// newFailoverBreaker returns the breaker of the config, nil when disabled.
+func newFailoverBreaker(config FailoverBreakerConfig, logger *slog.Logger, metricOpen prometheus.Gauge) *failoverBreaker {
+	if config.MaxReroutesPerSecond == 0 {
+		return nil
+	}
+
+	return &failoverBreaker{
+		maxReroutes: config.MaxReroutesPerSecond * config.window().Seconds(),
+		window:      config.window(),
+		cooldown:    config.cooldown(),
+		logger:      logger,
+		metricOpen:  metricOpen,
+	}
+}
+
+// allow reports whether a request can be rerouted at now. The breaker closes
+// once its cooldown is over.
+func (b *failoverBreaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+
+	if now.Before(b.openUntil) {
+		return false
+	}
+
+	b.openUntil = time.Time{}
+	b.windowStart = now
+	b.reroutes = 0
+	b.metricOpen.Set(0)
+
+	b.logger.Warn("failover breaker closed, requests are rerouted again")
+
+	return true
+}
+
+// observe counts a reroute made at now, and opens the breaker when there
+// are too many of them in the window.
+func (b *failoverBreaker) observe(now time.Time) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if now.Sub(b.windowStart) >= b.window {
+		b.windowStart = now
+		b.reroutes = 0
+	}
+
+	b.reroutes++
+
+	if !b.openUntil.IsZero() || float64(b.reroutes) <= b.maxReroutes {
+		return
+	}
+
+	b.openUntil = now.Add(b.cooldown)
+	b.metricOpen.Set(1)
+
+	b.logger.Error("failover breaker open, requests are no longer rerouted: a failure shared by every target is likely",
+		"reroutes", b.reroutes, "window", b.window, "cooldown", b.cooldown)
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFailoverBreakerStopsReroutes(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var hits [2]atomic.Int32
+
+	config := createConfig()
+	config.Proxy.FailoverBreaker = FailoverBreakerConfig{
+		MaxReroutesPerSecond: 0.3,
+		Window:               10 * time.Second,
+		Cooldown:             time.Minute,
+	}
+
+	for i := range hits {
+		i := i
+
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits[i].Add(1)
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		}))
+		t.Cleanup(node.Close)
+
+		config.Targets = append(config.Targets, NodeProviderConfig{
+			Name:       []string{"Server1", "Server2"}[i],
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		})
+	}
+
+	clock := newFakeClock()
+
+	p := newTestFailoverProxy(t, config)
+	p.clock = clock
+
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// The window allows 3 reroutes, the 4th opens the breaker.
+	//
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusServiceUnavailable, serve().Code)
+	}
+
+	assert.Equal(t, int32(4), hits[1].Load())
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricFailoverBreakerOpen))
+
+	// Open, the requests are only attempted once.
+	//
+	for i := 0; i < 3; i++ {
+		rec := serve()
+
+		var body struct {
+			Gateway struct {
+				Reason   string `json:"reason"`
+				Attempts int    `json:"attempts"`
+			} `json:"gateway"`
+		}
+
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+		assert.Equal(t, "failover_breaker_open", body.Gateway.Reason)
+		assert.Equal(t, 1, body.Gateway.Attempts)
+	}
+
+	assert.Equal(t, int32(7), hits[0].Load())
+	assert.Equal(t, int32(4), hits[1].Load())
+
+	// Past the cooldown, the requests are rerouted again.
+	//
+	clock.Advance(time.Minute)
+
+	serve()
+
+	assert.Equal(t, int32(5), hits[1].Load())
+	assert.Equal(t, 0.0, testutil.ToFloat64(p.metricFailoverBreakerOpen))
+}
+
+func TestFailoverBreakerCountsOverWindows(t *testing.T) {
+	b := newFailoverBreaker(FailoverBreakerConfig{MaxReroutesPerSecond: 1, Window: time.Second},
+		slog.New(slog.NewTextHandler(io.Discard, nil)), prometheus.NewGauge(prometheus.GaugeOpts{Name: "open"}))
+
+	now := time.Unix(1700000000, 0)
+
+	// One reroute per window never opens it.
+	//
+	for i := 0; i < 10; i++ {
+		b.observe(now)
+		now = now.Add(time.Second)
+	}
+
+	assert.True(t, b.allow(now))
+
+	b.observe(now)
+	b.observe(now)
+	assert.False(t, b.allow(now))
+	assert.False(t, b.allow(now.Add(DefaultFailoverBreakerCooldown-time.Millisecond)))
+	assert.True(t, b.allow(now.Add(DefaultFailoverBreakerCooldown)))
+
+	var disabled *failoverBreaker
+
+	disabled.observe(now)
+	assert.True(t, disabled.allow(now))
+	assert.Nil(t, newFailoverBreaker(FailoverBreakerConfig{}, nil, nil))
+}
@@ -0,0 +1,237 @@
+package proxy
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Kinds of injected faults.
+const (
+	faultLatency = "latency"
+	faultFailure = "failure"
+	faultReset   = "reset"
+)
+
+// ErrFaultInjectionDisabled is returned when faults are set while fault
+// injection isn't enabled.
+var ErrFaultInjectionDisabled = errors.New("fault injection is disabled")
+
+// FaultInjectionConfig lets the targets fail on purpose, to test how clients
+// and the gateway itself cope with misbehaving providers. It must never be
+// enabled in production.
+type FaultInjectionConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// AllowUnsafe has to be set along with Enabled, so fault injection can't
+	// be turned on by mistake.
+	AllowUnsafe bool `yaml:"allowUnsafe"`
+}
+
+func (c FaultInjectionConfig) validate() error {
+	if c.Enabled && !c.AllowUnsafe {
+		return errors.New("fault injection must not run in production, set allowUnsafe to enable it anyway")
+	}
+
+	return nil
+}
+
+// FaultConfig describes the faults injected into the requests proxied to a
+// target. Health checks aren't affected.
+type FaultConfig struct {
+	// Latency is added before every request reaches the target.
+	Latency time.Duration `yaml:"latency"`
+
+	// FailureRate is the share of requests answered with HTTP 503, between
+	// 0 and 1.
+	FailureRate float64 `yaml:"failureRate"`
+
+	// ResetRate is the share of requests failing as if the target reset the
+	// connection, between 0 and 1.
+	ResetRate float64 `yaml:"resetRate"`
+}
+
+func (c FaultConfig) validate() error {
+	if c.Latency < 0 {
+		return errors.New("latency must not be negative")
+	}
+
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		return errors.New("failureRate must be between 0 and 1")
+	}
+
+	if c.ResetRate < 0 || c.ResetRate > 1 {
+		return errors.New("resetRate must be between 0 and 1")
+	}
+
+	return nil
+}
+
+// faultInjector injects the faults of a target, they can be changed while
+// requests are served.
+type faultInjector struct {
+	name   string
+	config atomic.Pointer[FaultConfig]
+
+	// transportResets is set when the transport of the target injects the
+	// resets, as connection resets the retries and the error classification
+	// see like real ones. Otherwise they are answered with HTTP 502.
+	transportResets bool
+
+	metricFaults *prometheus.CounterVec
+}
+
+func newFaultInjector(name string, config FaultConfig, metricFaults *prometheus.CounterVec) *faultInjector {
+	f := &faultInjector{
+		name:         name,
+		metricFaults: metricFaults,
+	}
+
+	f.config.Store(&config)
+
+	return f
+}
+
+// inject returns true when the request was failed and must not reach the
+// target.
+func (f *faultInjector) inject(w http.ResponseWriter, r *http.Request) bool {
+	config := f.config.Load()
+
+	if config.Latency > 0 {
+		f.metricFaults.WithLabelValues(f.name, faultLatency).Inc()
+
+		timer := time.NewTimer(config.Latency)
+		defer timer.Stop()
+
+		// The reverse proxy answers the same way when the client is gone
+		// before the target responds.
+		//
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusBadGateway)
+
+			return true
+		}
+	}
+
+	if !f.transportResets && f.reset() {
+		w.WriteHeader(http.StatusBadGateway)
+
+		return true
+	}
+
+	if config.FailureRate > 0 && rand.Float64() < config.FailureRate { //nolint:gosec
+		f.metricFaults.WithLabelValues(f.name, faultFailure).Inc()
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		return true
+	}
+
+	return false
+}
+
+// reset reports whether the attempt must fail with a connection reset.
+func (f *faultInjector) reset() bool {
+	rate := f.config.Load().ResetRate
+	if rate <= 0 || rand.Float64() >= rate { //nolint:gosec
+		return false
+	}
+
+	f.metricFaults.WithLabelValues(f.name, faultReset).Inc()
+
+	return true
+}
+
+// faultTransport fails the attempts of a target with a connection reset, the
+// way the transport does when the target resets the connection.
+type faultTransport struct {
+	next   http.RoundTripper
+	faults *faultInjector
+}
+
+func newFaultTransport(next http.RoundTripper, faults *faultInjector) *faultTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	faults.transportResets = true
+
+	return &faultTransport{next: next, faults: faults}
+}
+
+func (t *faultTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !t.faults.reset() {
+		return t.next.RoundTrip(r)
+	}
+
+	if r.Body != nil {
+		r.Body.Close()
+	}
+
+	return nil, &net.OpError{
+		Op:  "read",
+		Net: "tcp",
+		Err: os.NewSyscallError("read", syscall.ECONNRESET),
+	}
+}
+
+// CloseIdleConnections forwards to the wrapped transport.
+func (t *faultTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// SetFaults replaces the faults injected into the requests proxied to the
+// named target.
+func (p *Proxy) SetFaults(name string, config FaultConfig) error {
+	if err := config.validate(); err != nil {
+		return errors.Wrap(err, "invalid faults")
+	}
+
+	target, err := p.target(name)
+	if err != nil {
+		return err
+	}
+
+	if target.faults == nil {
+		return ErrFaultInjectionDisabled
+	}
+
+	target.faults.config.Store(&config)
+
+	return nil
+}
+
+// Faults returns the faults injected into the requests proxied to the named
+// target.
+func (p *Proxy) Faults(name string) (FaultConfig, error) {
+	target, err := p.target(name)
+	if err != nil {
+		return FaultConfig{}, err
+	}
+
+	if target.faults == nil {
+		return FaultConfig{}, ErrFaultInjectionDisabled
+	}
+
+	return *target.faults.config.Load(), nil
+}
+
+func (p *Proxy) target(name string) (*NodeProvider, error) {
+	for _, target := range p.targets {
+		if target.Name() == name {
+			return target, nil
+		}
+	}
+
+	return nil, errors.Wrapf(ErrTargetNotFound, "%q", name)
+}
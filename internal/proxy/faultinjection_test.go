@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestFaultInjectionProxy(t *testing.T, faults FaultConfig) (*Proxy, *atomic.Int64, *atomic.Int64) {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var primaryCalls, secondaryCalls atomic.Int64
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"primary"}`))
+	}))
+	t.Cleanup(primary.Close)
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondaryCalls.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"secondary"}`))
+	}))
+	t.Cleanup(secondary.Close)
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.FaultInjection = FaultInjectionConfig{Enabled: true, AllowUnsafe: true}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Primary",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: primary.URL,
+				},
+			},
+			Faults: faults,
+		},
+		{
+			Name: "Secondary",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: secondary.URL,
+				},
+			},
+		},
+	}
+
+	return newTestFailoverProxy(t, rpcGatewayConfig), &primaryCalls, &secondaryCalls
+}
+
+func serveTestRequest(p *Proxy) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	rr := httptest.NewRecorder()
+
+	p.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestHttpFailoverProxyInjectsFaults(t *testing.T) {
+	t.Run("failure", func(t *testing.T) {
+		httpFailoverProxy, primaryCalls, secondaryCalls := newTestFaultInjectionProxy(t, FaultConfig{FailureRate: 1})
+
+		rr := serveTestRequest(httpFailoverProxy)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "secondary")
+		assert.Equal(t, int64(0), primaryCalls.Load())
+		assert.Equal(t, int64(1), secondaryCalls.Load())
+		assert.Equal(t, float64(1),
+			testutil.ToFloat64(httpFailoverProxy.metricFaultsInjected.WithLabelValues("Primary", faultFailure)))
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		httpFailoverProxy, primaryCalls, _ := newTestFaultInjectionProxy(t, FaultConfig{ResetRate: 1})
+
+		rr := serveTestRequest(httpFailoverProxy)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "secondary")
+		assert.Equal(t, int64(0), primaryCalls.Load())
+		assert.Equal(t, float64(1),
+			testutil.ToFloat64(httpFailoverProxy.metricFaultsInjected.WithLabelValues("Primary", faultReset)))
+
+		// The reset comes from the transport, like a real one.
+		//
+		recent, err := httpFailoverProxy.RecentErrors("Primary")
+		assert.NoError(t, err)
+		assert.Len(t, recent, 1)
+		assert.Contains(t, recent[0].Error, "connection reset by peer")
+		assert.Equal(t, TransportErrorOther, recent[0].Type)
+	})
+
+	t.Run("reset is retried", func(t *testing.T) {
+		faults := newFaultInjector("Primary", FaultConfig{ResetRate: 1},
+			prometheus.NewCounterVec(prometheus.CounterOpts{Name: "faults"}, []string{"provider", "fault"}))
+
+		var calls atomic.Int64
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+		}))
+		defer server.Close()
+
+		transport := newTestRetryTransport(RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond})
+		transport.next = newFaultTransport(transport.next, faults)
+
+		_, err := transport.RoundTrip(newRetryRequest(t, context.Background(), server.URL))
+		assert.ErrorIs(t, err, syscall.ECONNRESET)
+		assert.Zero(t, calls.Load())
+		assert.Equal(t, 3.0, testutil.ToFloat64(transport.metricAttempts.WithLabelValues("Server1", attemptNetworkErr)))
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		httpFailoverProxy, primaryCalls, _ := newTestFaultInjectionProxy(t, FaultConfig{Latency: 50 * time.Millisecond})
+
+		start := time.Now()
+		rr := serveTestRequest(httpFailoverProxy)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "primary")
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		assert.Equal(t, int64(1), primaryCalls.Load())
+	})
+
+	t.Run("latency past the upstream timeout", func(t *testing.T) {
+		httpFailoverProxy, primaryCalls, _ := newTestFaultInjectionProxy(t, FaultConfig{Latency: time.Minute})
+		httpFailoverProxy.timeout = 50 * time.Millisecond
+
+		rr := serveTestRequest(httpFailoverProxy)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), "secondary")
+		assert.Equal(t, int64(0), primaryCalls.Load())
+	})
+}
+
+func TestHttpFailoverProxySetFaults(t *testing.T) {
+	httpFailoverProxy, primaryCalls, _ := newTestFaultInjectionProxy(t, FaultConfig{})
+
+	assert.Contains(t, serveTestRequest(httpFailoverProxy).Body.String(), "primary")
+
+	assert.NoError(t, httpFailoverProxy.SetFaults("Primary", FaultConfig{FailureRate: 1}))
+
+	faults, err := httpFailoverProxy.Faults("Primary")
+	assert.NoError(t, err)
+	assert.Equal(t, FaultConfig{FailureRate: 1}, faults)
+
+	assert.Contains(t, serveTestRequest(httpFailoverProxy).Body.String(), "secondary")
+	assert.Equal(t, int64(1), primaryCalls.Load())
+
+	assert.Error(t, httpFailoverProxy.SetFaults("Primary", FaultConfig{FailureRate: 2}))
+	assert.ErrorIs(t, httpFailoverProxy.SetFaults("Unknown", FaultConfig{}), ErrTargetNotFound)
+}
+
+func TestFaultInjectionRequiresAllowUnsafe(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.HealthcheckManager = newTestHealthCheckManager(t, "Server1")
+	rpcGatewayConfig.Proxy.FaultInjection = FaultInjectionConfig{Enabled: true}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: "http://127.0.0.1:8545",
+				},
+			},
+		},
+	}
+
+	_, err := NewProxy(rpcGatewayConfig)
+	assert.Error(t, err)
+
+	// Faults are ignored, and can't be set, unless fault injection is
+	// enabled.
+	//
+	rpcGatewayConfig.Proxy.FaultInjection = FaultInjectionConfig{}
+	rpcGatewayConfig.Targets[0].Faults = FaultConfig{FailureRate: 1}
+
+	httpFailoverProxy, err := NewProxy(rpcGatewayConfig)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, httpFailoverProxy.SetFaults("Server1", FaultConfig{}), ErrFaultInjectionDisabled)
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+const (
+	// hashRingReplicas is the number of virtual nodes per unit of weight.
+	// More virtual nodes spread clients more evenly across targets.
+	hashRingReplicas = 100
+)
+
+// hashRing is a consistent-hash ring of targets. A client key maps to a point
+// on the ring, and walking the ring clockwise yields the targets in the order
+// they should be tried. Adding or removing a target only moves the clients
+// that were mapped to it.
+type hashRing struct {
+	points  []uint32
+	targets map[uint32]*NodeProvider
+	size    int
+}
+
+func newHashRing(targets []*NodeProvider) *hashRing {
+	ring := &hashRing{
+		targets: map[uint32]*NodeProvider{},
+		size:    len(targets),
+	}
+
+	for _, target := range targets {
+		for i := 0; i < hashRingReplicas*int(target.Weight()); i++ {
+			point := crc32.ChecksumIEEE([]byte(target.Name() + "#" + strconv.Itoa(i)))
+
+			// Collisions are unlikely, the first target keeps the point so the
+			// ring is deterministic for a given config.
+			//
+			if _, ok := ring.targets[point]; ok {
+				continue
+			}
+
+			ring.targets[point] = target
+			ring.points = append(ring.points, point)
+		}
+	}
+
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i] < ring.points[j]
+	})
+
+	return ring
+}
+
+// Lookup returns every target ordered by their distance from the key on the
+// ring.
+func (h *hashRing) Lookup(key string) []*NodeProvider {
+	if len(h.points) == 0 {
+		return nil
+	}
+
+	hash := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(h.points), func(i int) bool {
+		return h.points[i] >= hash
+	})
+
+	seen := make(map[*NodeProvider]struct{}, h.size)
+	targets := make([]*NodeProvider, 0, h.size)
+
+	for i := 0; i < len(h.points) && len(targets) < h.size; i++ {
+		target := h.targets[h.points[(start+i)%len(h.points)]]
+		if _, ok := seen[target]; ok {
+			continue
+		}
+
+		seen[target] = struct{}{}
+		targets = append(targets, target)
+	}
+
+	return targets
+}
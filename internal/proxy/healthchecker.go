@@ -5,10 +5,12 @@ import (
 	"log/slog"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -27,10 +29,52 @@ type HealthCheckerConfig struct {
 	Timeout time.Duration `yaml:"healthcheckTimeout"`
 
 	// Try FailureThreshold times before marking as unhealthy
-	FailureThreshold uint `yaml:"healthcheckInterval"`
+	FailureThreshold uint `yaml:"failureThreshold"`
 
 	// Minimum consecutive successes required to mark as healthy
-	SuccessThreshold uint `yaml:"healthcheckInterval"`
+	SuccessThreshold uint `yaml:"successThreshold"`
+
+	// Transport used by the health checks, http.DefaultTransport when nil.
+	Transport http.RoundTripper
+
+	// UserAgent is sent by the health checks, "rpc-gateway-health-check"
+	// when empty.
+	UserAgent string
+
+	// Probes replace the built-in eth checks when set.
+	Probes []HealthCheckProbe
+
+	// ExtraProbes run along the probes of the configured mode.
+	ExtraProbes []Probe
+
+	// Mode selects the JSON-RPC checks, the HTTP check or both.
+	Mode string
+	// HTTP configures the HTTP check.
+	HTTP HTTPHealthCheckConfig
+	// Write checks whether the target accepts transactions.
+	Write WriteHealthCheckConfig
+
+	// MaxBlockAge fails the JSON-RPC checks when the timestamp of the
+	// latest block is older. Zero disables the check.
+	MaxBlockAge time.Duration
+
+	// OnHealthChange is called whenever the health status flips.
+	OnHealthChange func(name string, healthy bool)
+
+	// OnCheckSkipped is called when a check is skipped because the previous
+	// one is still running.
+	OnCheckSkipped func(name string)
+
+	// OnCheckDone is called after every check with its error, if any.
+	OnCheckDone func(name string, err error)
+
+	// OnProbeDone is called after every call a check is made of, e.g.
+	// "eth_blockNumber" or "http", with its duration and error.
+	OnProbeDone func(name, probe string, duration time.Duration, err error)
+
+	// Clock dates the block number observations, the system clock when
+	// nil.
+	Clock Clock
 }
 
 type HealthChecker struct {
@@ -39,33 +83,78 @@ type HealthChecker struct {
 	config     HealthCheckerConfig
 	logger     *slog.Logger
 
-	// latest known blockNumber from the RPC.
-	blockNumber uint64
-	// gasLimit received from the GasLeft.sol contract call.
-	gasLimit uint64
+	// probes are run by every check.
+	probes []Probe
+
+	// context is the latest data collected by the probes, a failing probe
+	// leaving the previous data of its keys.
+	context HealthContext
+	// blockNumberObservedAt is when the block number was last collected.
+	blockNumberObservedAt time.Time
 
 	// is the ethereum RPC node healthy according to the RPCHealthchecker
 	isHealthy bool
+	// isWriteHealthy tells whether the node accepts transactions, always
+	// true without a write check.
+	isWriteHealthy bool
+
+	// failures and successes count the consecutive failed and successful
+	// checks, compared to the thresholds before the health status flips.
+	failures  uint
+	successes uint
+
+	// lastCheck is when the last check ended, and lastError its error.
+	lastCheck time.Time
+	lastError error
+
+	// cancel and done are set while Start runs.
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+
+	// running is set while a check is in flight, so checks never overlap.
+	running atomic.Bool
+
+	// checked is closed once the first check is done.
+	checked     chan struct{}
+	checkedOnce sync.Once
 
 	mu sync.RWMutex
 }
 
 func NewHealthChecker(config HealthCheckerConfig) (*HealthChecker, error) {
-	client, err := rpc.Dial(config.URL)
+	httpClient := &http.Client{
+		Transport: config.Transport,
+	}
+
+	client, err := rpc.DialOptions(context.Background(), config.URL, rpc.WithHTTPClient(httpClient))
 	if err != nil {
 		return nil, err
 	}
 
-	client.SetHeader("User-Agent", userAgent)
+	if config.UserAgent == "" {
+		config.UserAgent = userAgent
+	}
+
+	client.SetHeader("User-Agent", config.UserAgent)
+
+	if config.Clock == nil {
+		config.Clock = systemClock{}
+	}
 
 	healthchecker := &HealthChecker{
-		logger:     config.Logger.With("nodeprovider", config.Name),
-		client:     client,
-		httpClient: &http.Client{},
-		config:     config,
-		isHealthy:  true,
+		logger:         config.Logger.With("nodeprovider", config.Name),
+		client:         client,
+		httpClient:     httpClient,
+		config:         config,
+		isHealthy:      true,
+		isWriteHealthy: true,
+		context:        HealthContext{},
+		checked:        make(chan struct{}),
 	}
 
+	healthchecker.probes = healthchecker.defaultProbes()
+
 	return healthchecker, nil
 }
 
@@ -73,15 +162,19 @@ func (h *HealthChecker) Name() string {
 	return h.config.Name
 }
 
+// observeProbe reports a call of a check, started at start.
+func (h *HealthChecker) observeProbe(probe string, start time.Time, err error) {
+	if h.config.OnProbeDone != nil {
+		h.config.OnProbeDone(h.Name(), probe, time.Since(start), err)
+	}
+}
+
 func (h *HealthChecker) checkBlockNumber(c context.Context) (uint64, error) {
 	// First we check the block number reported by the node. This is later
 	// used to evaluate a single RPC node against others
 	var blockNumber hexutil.Uint64
 
-	err := h.client.CallContext(c, &blockNumber, "eth_blockNumber")
-	if err != nil {
-		h.logger.Error("could not fetch block number", "error", err)
-
+	if err := h.client.CallContext(c, &blockNumber, "eth_blockNumber"); err != nil {
 		return 0, err
 	}
 	h.logger.Debug("fetch block number completed", "blockNumber", uint64(blockNumber))
@@ -94,10 +187,8 @@ func (h *HealthChecker) checkBlockNumber(c context.Context) (uint64, error) {
 // as blockNumber can be either cached or routed to a different service on the
 // RPC provider's side.
 func (h *HealthChecker) checkGasLimit(c context.Context) (uint64, error) {
-	gasLimit, err := performGasLeftCall(c, h.httpClient, h.config.URL)
+	gasLimit, err := performGasLeftCall(c, h.httpClient, h.config.URL, h.config.UserAgent)
 	if err != nil {
-		h.logger.Error("could not fetch gas limit", "error", err)
-
 		return gasLimit, err
 	}
 	h.logger.Debug("fetch gas limit completed", "gasLimit", gasLimit)
@@ -105,68 +196,230 @@ func (h *HealthChecker) checkGasLimit(c context.Context) (uint64, error) {
 	return gasLimit, nil
 }
 
-// CheckAndSetHealth makes the following calls
-// - `eth_blockNumber` - to get the latest block reported by the node
-// - `eth_call` - to get the gas limit
-// And sets the health status based on the responses.
-func (h *HealthChecker) CheckAndSetHealth() {
-	go h.checkAndSetBlockNumberHealth()
-	go h.checkAndSetGasLeftHealth()
+// HealthCheckResult is the outcome of a single health check.
+type HealthCheckResult struct {
+	// BlockNumber is the latest block reported by the node, or the height
+	// extracted by the probes. It's zero when the node couldn't report it,
+	// which doesn't affect its health on its own, and with HTTP-only checks.
+	BlockNumber uint64
+	// GasLimit received from the GasLeft.sol contract call.
+	GasLimit uint64
+	// BlockTimestamp is the timestamp of the latest block, the zero time
+	// without a block age check or when it couldn't be fetched.
+	BlockTimestamp time.Time
+	// Context is all the data collected by the probes.
+	Context HealthContext
+	// Latency is how long the whole check took.
+	Latency time.Duration
 }
 
-func (h *HealthChecker) checkAndSetBlockNumberHealth() {
-	c, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
-	defer cancel()
+// Check runs a single health check synchronously, running the probes of the
+// configured mode.
+func (h *HealthChecker) Check(c context.Context) (HealthCheckResult, error) {
+	start := time.Now()
 
-	// TODO
-	//
-	// This should be moved to a different place, because it does not do a
-	// health checking but it provides additional context.
+	collected, err := h.runPipeline(c, h.probes)
 
-	blockNumber, err := h.checkBlockNumber(c)
-	if err != nil {
-		return
+	result := HealthCheckResult{
+		BlockNumber:    collected.Uint64(HealthContextBlockNumber),
+		GasLimit:       collected.Uint64(HealthContextGasLimit),
+		BlockTimestamp: collected.Time(HealthContextBlockTimestamp),
+		Context:        collected,
+		Latency:        time.Since(start),
 	}
 
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	h.blockNumber = blockNumber
+	if h.config.OnCheckDone != nil {
+		h.config.OnCheckDone(h.Name(), err)
+	}
+
+	return result, err
 }
 
-func (h *HealthChecker) checkAndSetGasLeftHealth() {
-	c, cancel := context.WithTimeout(context.Background(), h.config.Timeout)
+// CheckAndSetHealth runs a single health check and sets the health status
+// based on its result. It's a no-op while another check is running, so a
+// slow node doesn't pile up checks.
+func (h *HealthChecker) CheckAndSetHealth(c context.Context) {
+	if !h.running.CompareAndSwap(false, true) {
+		h.logger.Debug("skipping health check, the previous one is still running")
+
+		if h.config.OnCheckSkipped != nil {
+			h.config.OnCheckSkipped(h.Name())
+		}
+
+		return
+	}
+	defer h.running.Store(false)
+
+	c, cancel := context.WithTimeout(c, h.config.Timeout)
 	defer cancel()
 
-	gasLimit, err := h.checkGasLimit(c)
+	result, err := h.Check(c)
+	writeErr := h.checkWrite(c)
+
+	if h.config.Interval > 0 && result.Latency > h.config.Interval {
+		h.logger.Warn("health check took longer than the interval",
+			"latency", result.Latency,
+			"interval", h.config.Interval)
+	}
+
 	h.mu.Lock()
-	defer h.mu.Unlock()
+	h.lastCheck = h.config.Clock.Now()
+	h.lastError = err
+
+	// The context is copied on write, so it can be handed out as is.
+	//
+	collected := make(HealthContext, len(h.context)+len(result.Context))
+	for key, value := range h.context {
+		collected[key] = value
+	}
+
+	for key, value := range result.Context {
+		collected[key] = value
+	}
+
+	h.context = collected
+
+	if result.BlockNumber != 0 {
+		h.blockNumberObservedAt = h.config.Clock.Now()
+	}
+
+	wasHealthy := h.isHealthy
+	h.countCheck(err)
+	isHealthy := h.isHealthy
+
+	wasWriteHealthy := h.isWriteHealthy
+	h.isWriteHealthy = writeErr == nil
+	h.mu.Unlock()
+
+	if wasHealthy != isHealthy && h.config.OnHealthChange != nil {
+		h.config.OnHealthChange(h.Name(), isHealthy)
+	}
+
+	if wasWriteHealthy && writeErr != nil {
+		h.logger.Warn("node stopped accepting transactions", "error", writeErr)
+	} else if !wasWriteHealthy && writeErr == nil {
+		h.logger.Info("node accepts transactions again")
+	}
+}
+
+// countCheck counts the result of a check and flips the health status once
+// the failures or the successes in a row reach their threshold, a threshold
+// of zero acting like one. It must be called with the lock held.
+func (h *HealthChecker) countCheck(err error) {
 	if err != nil {
-		h.isHealthy = false
+		h.failures++
+		h.successes = 0
+
+		if h.failures >= h.config.FailureThreshold {
+			h.isHealthy = false
+		}
 
 		return
 	}
-	h.gasLimit = gasLimit
-	h.isHealthy = true
+
+	h.successes++
+	h.failures = 0
+
+	if h.successes >= h.config.SuccessThreshold {
+		h.isHealthy = true
+	}
 }
 
+// markUnhealthy marks the node unhealthy without checking it, for an error
+// found before the first check.
+func (h *HealthChecker) markUnhealthy(err error) {
+	h.mu.Lock()
+	wasHealthy := h.isHealthy
+	h.isHealthy = false
+	h.successes = 0
+	h.lastError = err
+	h.mu.Unlock()
+
+	h.logger.Warn("node marked unhealthy", "error", err)
+
+	if wasHealthy && h.config.OnHealthChange != nil {
+		h.config.OnHealthChange(h.Name(), false)
+	}
+}
+
+// Start runs the health checks until the context is canceled or Stop is
+// called.
 func (h *HealthChecker) Start(c context.Context) {
-	h.CheckAndSetHealth()
+	h.mu.Lock()
+	if h.stopped || h.done != nil {
+		h.mu.Unlock()
+
+		return
+	}
+
+	c, cancel := context.WithCancel(c)
+	done := make(chan struct{})
+
+	h.cancel = cancel
+	h.done = done
+	h.mu.Unlock()
+
+	defer close(done)
+	defer cancel()
+
+	h.CheckAndSetHealth(c)
+	h.markChecked()
 
 	ticker := time.NewTicker(h.config.Interval)
 	defer ticker.Stop()
 
+	// Checks run in the background, so the ticks keep their pace and the
+	// ones falling on a running check are skipped.
+	//
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
 	for {
 		select {
 		case <-c.Done():
 			return
 		case <-ticker.C:
-			h.CheckAndSetHealth()
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+				h.CheckAndSetHealth(c)
+			}()
 		}
 	}
 }
 
-func (h *HealthChecker) Stop(_ context.Context) error {
-	// TODO: Additional cleanups?
+// markChecked records that the first check is done.
+func (h *HealthChecker) markChecked() {
+	h.checkedOnce.Do(func() { close(h.checked) })
+}
+
+// Checked is closed once the first health check is done.
+func (h *HealthChecker) Checked() <-chan struct{} {
+	return h.checked
+}
+
+// Stop stops the health checks, waits for Start to return and releases the
+// connections to the node. A stopped HealthChecker can't be started again.
+func (h *HealthChecker) Stop(c context.Context) error {
+	h.mu.Lock()
+	h.stopped = true
+	cancel, done := h.cancel, h.done
+	h.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+
+		select {
+		case <-done:
+		case <-c.Done():
+			return errors.Wrap(c.Err(), "health checks did not stop")
+		}
+	}
+
+	h.client.Close()
+	h.httpClient.CloseIdleConnections()
+
 	return nil
 }
 
@@ -177,16 +430,53 @@ func (h *HealthChecker) IsHealthy() bool {
 	return h.isHealthy
 }
 
+// IsWriteHealthy reports whether the node accepts transactions according to
+// the write check. It's always true without one.
+func (h *HealthChecker) IsWriteHealthy() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.isWriteHealthy
+}
+
 func (h *HealthChecker) BlockNumber() uint64 {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	return h.blockNumber
+	return h.context.Uint64(HealthContextBlockNumber)
+}
+
+// BlockNumberObservedAt returns when the block number was last observed, the
+// zero time if it never was. A failing node keeps its last block number,
+// this tells how old it is.
+func (h *HealthChecker) BlockNumberObservedAt() time.Time {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.blockNumberObservedAt
+}
+
+// LastCheck returns when the last check ended, the zero time if none did,
+// and the error it failed with.
+func (h *HealthChecker) LastCheck() (time.Time, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.lastCheck, h.lastError
 }
 
 func (h *HealthChecker) GasLimit() uint64 {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	return h.gasLimit
+	return h.context.Uint64(HealthContextGasLimit)
+}
+
+// Context returns the latest data collected by the probes. It must not be
+// modified.
+func (h *HealthChecker) Context() HealthContext {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.context
 }
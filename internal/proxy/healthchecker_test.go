@@ -2,13 +2,22 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/caitlinelfring/go-env-default"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+	"gopkg.in/yaml.v2"
 )
 
 // TestBasicHealthchecker checks if it runs with default options.
@@ -41,3 +50,304 @@ func TestBasicHealthchecker(t *testing.T) {
 	healthchecker.isHealthy = true
 	assert.True(t, healthchecker.IsHealthy())
 }
+
+func newFakeNode(t testing.TB) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		switch req.Method {
+		case "eth_blockNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+		case "eth_call":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`))
+		default:
+			http.Error(w, "unexpected method", http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestHealthcheckerCheck(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:    node.URL,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, err)
+
+	result, err := healthchecker.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x10), result.BlockNumber)
+	assert.Equal(t, uint64(0x3b9ac9ff), result.GasLimit)
+	assert.NotZero(t, result.Latency)
+
+	assert.NoError(t, healthchecker.Stop(context.Background()))
+}
+
+func TestHealthcheckerStopReleasesResources(t *testing.T) {
+	defer goleak.VerifyNone(t, goleak.IgnoreCurrent())
+
+	node := newFakeNode(t)
+	defer node.Close()
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:      node.URL,
+		Interval: 10 * time.Millisecond,
+		Timeout:  time.Second,
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, err)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		healthchecker.Start(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool {
+		return healthchecker.BlockNumber() != 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, healthchecker.Stop(context.Background()))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after Stop")
+	}
+}
+
+func TestHealthcheckerChecksNeverOverlap(t *testing.T) {
+	var inflight, maxInflight atomic.Int64
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		if req.Method != "eth_call" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+
+			return
+		}
+
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+
+		for {
+			current := maxInflight.Load()
+			if n <= current || maxInflight.CompareAndSwap(current, n) {
+				break
+			}
+		}
+
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`))
+	}))
+	defer node.Close()
+
+	var skipped atomic.Int64
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:      node.URL,
+		Interval: 5 * time.Millisecond,
+		Timeout:  time.Second,
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		OnCheckSkipped: func(string) {
+			skipped.Add(1)
+		},
+	})
+	assert.NoError(t, err)
+
+	c, cancel := context.WithTimeout(context.Background(), 350*time.Millisecond)
+	defer cancel()
+
+	healthchecker.Start(c)
+
+	assert.Equal(t, int64(1), maxInflight.Load())
+	assert.Positive(t, skipped.Load())
+	assert.Equal(t, uint64(0x3b9ac9ff), healthchecker.GasLimit())
+
+	assert.NoError(t, healthchecker.Stop(context.Background()))
+}
+
+func TestHealthcheckerThresholds(t *testing.T) {
+	var failing atomic.Bool
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+
+			return
+		}
+
+		var req JSONRPCRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		if req.Method == "eth_call" {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`))
+
+			return
+		}
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}))
+	defer node.Close()
+
+	var changes []bool
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:              node.URL,
+		Timeout:          time.Second,
+		FailureThreshold: 3,
+		SuccessThreshold: 2,
+		Logger:           slog.New(slog.NewTextHandler(io.Discard, nil)),
+		OnHealthChange: func(_ string, healthy bool) {
+			changes = append(changes, healthy)
+		},
+	})
+	assert.NoError(t, err)
+
+	failing.Store(true)
+
+	for i := 0; i < 2; i++ {
+		healthchecker.CheckAndSetHealth(context.Background())
+		assert.True(t, healthchecker.IsHealthy())
+	}
+
+	// A success in between resets the failures.
+	//
+	failing.Store(false)
+	healthchecker.CheckAndSetHealth(context.Background())
+
+	failing.Store(true)
+
+	for i := 0; i < 2; i++ {
+		healthchecker.CheckAndSetHealth(context.Background())
+		assert.True(t, healthchecker.IsHealthy())
+	}
+
+	healthchecker.CheckAndSetHealth(context.Background())
+	assert.False(t, healthchecker.IsHealthy())
+
+	failing.Store(false)
+
+	healthchecker.CheckAndSetHealth(context.Background())
+	assert.False(t, healthchecker.IsHealthy())
+
+	healthchecker.CheckAndSetHealth(context.Background())
+	assert.True(t, healthchecker.IsHealthy())
+
+	assert.Equal(t, []bool{false, true}, changes)
+	assert.NoError(t, healthchecker.Stop(context.Background()))
+}
+
+func TestHealthcheckerProbes(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		methods []string
+		params  []json.RawMessage
+		healthy atomic.Bool
+	)
+
+	healthy.Store(true)
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		mu.Lock()
+		methods = append(methods, req.Method)
+		params = append(params, req.Params)
+		mu.Unlock()
+
+		switch {
+		case req.Method == "getSlot":
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":245000000}`, req.ID)
+		case req.Method == "getHealth" && healthy.Load():
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":"ok"}`, req.ID)
+		default:
+			fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"error":{"code":-32005,"message":"Node is behind"}}`, req.ID)
+		}
+	}))
+	defer node.Close()
+
+	var config HealthCheckConfig
+
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+probes:
+  - method: getSlot
+    params: [{commitment: finalized}]
+    heightPath: "$"
+  - method: getHealth
+    required: true
+`), &config))
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:     node.URL,
+		Timeout: time.Second,
+		Probes:  config.Probes,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, err)
+
+	defer healthchecker.Stop(context.Background())
+
+	healthchecker.CheckAndSetHealth(context.Background())
+
+	assert.True(t, healthchecker.IsHealthy())
+	assert.Equal(t, uint64(245000000), healthchecker.BlockNumber())
+
+	healthy.Store(false)
+	healthchecker.CheckAndSetHealth(context.Background())
+
+	assert.False(t, healthchecker.IsHealthy())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.ElementsMatch(t, []string{"getSlot", "getHealth", "getSlot", "getHealth"}, methods)
+
+	for i, method := range methods {
+		if method == "getSlot" {
+			assert.JSONEq(t, `[{"commitment":"finalized"}]`, string(params[i]))
+		}
+	}
+}
+
+func TestExtractHeight(t *testing.T) {
+	for _, tc := range []struct {
+		document string
+		path     string
+		height   uint64
+		err      bool
+	}{
+		{document: `245000000`, path: "$", height: 245000000},
+		{document: `"0x10"`, path: "$", height: 16},
+		{document: `{"context":{"slot":"42"}}`, path: "$.context.slot", height: 42},
+		{document: `{"blocks":[{"number":7}]}`, path: "$.blocks.0.number", height: 7},
+		{document: `{"context":{}}`, path: "$.context.slot", err: true},
+		{document: `[1]`, path: "$.1", err: true},
+		{document: `1`, path: "context", err: true},
+	} {
+		height, err := extractHeight(json.RawMessage(tc.document), tc.path)
+
+		if tc.err {
+			assert.Error(t, err, tc.path)
+		} else if assert.NoError(t, err, tc.path) {
+			assert.Equal(t, tc.height, height, tc.path)
+		}
+	}
+}
@@ -25,7 +25,7 @@ func hexToUint(hexString string) (uint64, error) {
 	return strconv.ParseUint(hexString, 16, 64)
 }
 
-func performGasLeftCall(c context.Context, client *http.Client, url string) (uint64, error) {
+func performGasLeftCall(c context.Context, client *http.Client, url, userAgent string) (uint64, error) {
 	var gasLeftCallRaw = bytes.NewBufferString(`
 {
     "method": "eth_call",
@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/0xProject/rpc-gateway/internal/metrics"
 	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -16,71 +20,410 @@ type HealthCheckManagerConfig struct {
 	Targets []NodeProviderConfig
 	Config  HealthCheckConfig
 	Logger  *slog.Logger
+	Metrics metrics.Config
+
+	// Registerer is where metrics are registered, the Prometheus default
+	// registerer when nil.
+	Registerer prometheus.Registerer
+	// Transports overrides the HTTP transport of health checks per target
+	// name.
+	Transports map[string]http.RoundTripper
+	// HealthObservers are notified on target health transitions.
+	HealthObservers []HealthObserver
+	// UserAgent is sent by the health checks of the targets not overriding
+	// it.
+	UserAgent string
+}
+
+// ErrTargetNotFound is returned when a target name isn't managed by the
+// HealthCheckManager.
+var ErrTargetNotFound = errors.New("target not found")
+
+type healthCheckEntry struct {
+	index   int
+	checker *HealthChecker
+	window  *RollingWindow
+
+	// classes holds the rolling window and taint of every method class
+	// served by the target. They're created on first observation.
+	classes map[string]*methodClassState
+
+	// taints holds the expiry of the reasons tainting the whole target, the
+	// zero time for the ones lasting until cleared.
+	taints map[string]time.Time
+
+	// maintenance are the maintenance windows of the target, and
+	// inMaintenance whether one was active when last looked at.
+	maintenance   []*maintenanceWindow
+	inMaintenance bool
+
+	// consecutiveFailures is the number of failed requests since the last
+	// successful one.
+	consecutiveFailures int
+
+	// recovering is set while the target has to prove itself on canary
+	// traffic, whose outcomes are kept in canary.
+	recovering bool
+	canary     *RollingWindow
+
+	// host is the hostname of the target resolved at startup with
+	// resolver, empty for IP addresses and the targets that aren't HTTP.
+	host     string
+	resolver ipResolver
+
+	// endpoint is the host:port of the target, empty for the targets that
+	// aren't HTTP.
+	endpoint string
+
+	mu sync.Mutex
+}
+
+type methodClassState struct {
+	window       *RollingWindow
+	taintedUntil time.Time
 }
 
 type HealthCheckManager struct {
-	hcs    []*HealthChecker
-	logger *slog.Logger
+	// hcs keeps the configured order, entries indexes the same checkers by
+	// name for the lookups done on every request.
+	hcs     []*HealthChecker
+	entries map[string]*healthCheckEntry
+	logger  *slog.Logger
+	config  HealthCheckConfig
+	clock   Clock
+
+	// writeClasses are the method classes served only by targets accepting
+	// transactions.
+	writeClasses map[string]bool
+
+	healthObservers []HealthObserver
+
+	// consensusDiverged is set while the targets disagree on the head of
+	// the chain by more than the threshold.
+	consensusDiverged bool
+
+	mu sync.RWMutex
+
+	// cancel and done are set while Start runs.
+	cancel  context.CancelFunc
+	done    chan struct{}
+	stopped bool
+	runMu   sync.Mutex
+
+	metricRPCProviderInfo              *prometheus.GaugeVec
+	metricRPCProviderStatus            *prometheus.GaugeVec
+	metricRPCProviderBlockNumber       *prometheus.GaugeVec
+	metricRPCProviderBlockAge          *prometheus.GaugeVec
+	metricRPCProviderBlockTimestampAge *prometheus.GaugeVec
+	metricRPCProviderGasLimit          *prometheus.GaugeVec
+	metricRPCProviderSuccessRate       *prometheus.GaugeVec
 
-	metricRPCProviderInfo        *prometheus.GaugeVec
-	metricRPCProviderStatus      *prometheus.GaugeVec
-	metricRPCProviderBlockNumber *prometheus.GaugeVec
-	metricRPCProviderGasLimit    *prometheus.GaugeVec
+	metricRPCProviderWindowSuccessRate  *prometheus.GaugeVec
+	metricRPCProviderWindowObservations *prometheus.GaugeVec
+	metricRPCProviderConsecutiveFails   *prometheus.GaugeVec
+	metricRPCProviderTaints             *prometheus.CounterVec
+	metricRPCProviderSkippedChecks      *prometheus.CounterVec
+	metricRPCProviderChecks             *prometheus.CounterVec
+	metricRPCProviderCheckDuration      *prometheus.HistogramVec
+	metricCheckQueueDelay               prometheus.Histogram
+	metricRPCProviderSharedBackend      *prometheus.GaugeVec
+	metricRPCProviderTimeouts           *prometheus.CounterVec
+	metricRPCProviderBlockDeviation     *prometheus.GaugeVec
+	metricConsensusBlockNumber          prometheus.Gauge
 }
 
 func NewHealthCheckManager(config HealthCheckManagerConfig) (*HealthCheckManager, error) {
+	factory := promauto.With(registererOrDefault(config.Registerer))
+
 	hcm := &HealthCheckManager{
-		logger: config.Logger,
-		metricRPCProviderInfo: promauto.NewGaugeVec(
+		logger:  config.Logger,
+		entries: make(map[string]*healthCheckEntry, len(config.Targets)),
+		config:  config.Config,
+		clock:   systemClock{},
+
+		writeClasses: newWriteClasses(config.Config.WriteMethodClasses),
+
+		healthObservers: config.HealthObservers,
+		metricRPCProviderInfo: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: "zeroex_rpc_gateway_provider_info",
-				Help: "Gas limit of a given provider",
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_info",
+				Help:      "Gas limit of a given provider",
 			}, []string{
 				"index",
 				"provider",
 			}),
-		metricRPCProviderStatus: promauto.NewGaugeVec(
+		metricRPCProviderStatus: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: "zeroex_rpc_gateway_provider_status",
-				Help: "Current status of a given provider by type. Type can be either healthy or tainted.",
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_status",
+				Help:      "Current status of a given provider by type. Type can be either healthy, write_healthy, tainted, recovering or a taint reason.",
 			}, []string{
 				"provider",
 				"type",
 			}),
-		metricRPCProviderBlockNumber: promauto.NewGaugeVec(
+		metricRPCProviderBlockNumber: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_block_number",
+				Help:      "Block number of a given provider",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderBlockAge: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_block_number_age_seconds",
+				Help:      "Age of the block number observation of a given provider",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderBlockTimestampAge: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_block_timestamp_age_seconds",
+				Help:      "Age of the latest block of a given provider, from its timestamp",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderGasLimit: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_gasLimit_number",
+				Help:      "Gas limit of a given provider",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderSuccessRate: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_class_success_rate",
+				Help:      "Rolling window success rate of a given provider per method class",
+			}, []string{
+				"provider",
+				"class",
+			}),
+		metricRPCProviderWindowSuccessRate: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_success_rate",
+				Help:      "Rolling window success rate of a given provider",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderWindowObservations: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_window_observations",
+				Help:      "Number of request outcomes in the rolling window of a given provider",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderConsecutiveFails: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_consecutive_failures",
+				Help:      "Number of failed requests of a given provider since its last successful one",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderTaints: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_taints_total",
+				Help:      "The total number of times a given provider has been tainted by reason",
+			}, []string{
+				"provider",
+				"reason",
+			}),
+		metricRPCProviderSkippedChecks: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_healthchecks_skipped_total",
+				Help:      "The total number of health checks of a given provider skipped because the previous one was still queued or running",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderChecks: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_healthchecks_total",
+				Help:      "The total number of health checks of a given provider by outcome",
+			}, []string{
+				"provider",
+				"outcome",
+			}),
+		metricRPCProviderCheckDuration: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_healthcheck_response_duration_seconds",
+				Help:      "Histogram of the response time of the health check calls to a given provider in seconds, by probe",
+				Buckets:   config.Metrics.Buckets(),
+			}, []string{
+				"provider",
+				"probe",
+			}),
+		metricCheckQueueDelay: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_healthcheck_queue_delay_seconds",
+				Help:      "Histogram of how long due health checks waited for a free worker in seconds",
+				Buckets:   config.Metrics.Buckets(),
+			}),
+		metricRPCProviderSharedBackend: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: "zeroex_rpc_gateway_provider_block_number",
-				Help: "Block number of a given provider",
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_shared_backend",
+				Help:      "Whether a given provider shares its backend with another one",
+			}, []string{
+				"provider",
+			}),
+		metricRPCProviderTimeouts: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_timeouts_total",
+				Help:      "The total number of timeouts of a given provider, by source: healthcheck or traffic",
 			}, []string{
 				"provider",
+				"source",
 			}),
-		metricRPCProviderGasLimit: promauto.NewGaugeVec(
+		metricRPCProviderBlockDeviation: factory.NewGaugeVec(
 			prometheus.GaugeOpts{
-				Name: "zeroex_rpc_gateway_provider_gasLimit_number",
-				Help: "Gas limit of a given provider",
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_block_deviation",
+				Help:      "Block number of a given provider minus the consensus block number, negative when behind",
 			}, []string{
 				"provider",
 			}),
+		metricConsensusBlockNumber: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_consensus_block_number",
+				Help:      "The median block number of the healthy providers, the head of the network as seen by them",
+			}),
+	}
+
+	ports, err := parseSourcePorts(config.Config.SourcePorts)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid health check config")
+	}
+
+	if err := validateProbes(config.Config.Probes); err != nil {
+		return nil, errors.Wrap(err, "invalid health check config")
+	}
+
+	if err := validateRollingWindowImplementation(config.Config.RollingWindowImplementation); err != nil {
+		return nil, errors.Wrap(err, "invalid health check config")
 	}
 
 	for _, target := range config.Targets {
+		if _, ok := hcm.entries[target.Name]; ok {
+			return nil, errors.Errorf("duplicated target name %q", target.Name)
+		}
+
+		if err := validateHealthCheckMode(target.HealthCheck.Mode); err != nil {
+			return nil, errors.Wrapf(err, "invalid target %q", target.Name)
+		}
+
+		if err := target.HealthCheck.Write.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid target %q", target.Name)
+		}
+
+		if err := target.Connection.validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid target %q", target.Name)
+		}
+
+		if (target.Connection.isIPC() || target.Connection.isMock()) &&
+			target.HealthCheck.Mode != "" && target.HealthCheck.Mode != HealthCheckModeJSONRPC {
+			return nil, errors.Errorf("invalid target %q: ipc and mock targets only support the %q health check mode",
+				target.Name, HealthCheckModeJSONRPC)
+		}
+
+		url, err := target.resolveURL()
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid target %q", target.Name)
+		}
+
+		transport, ok := config.Transports[target.Name]
+
+		switch {
+		case target.Connection.isMock():
+			mock, err := NewMockProvider(*target.Connection.Mock)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid target %q", target.Name)
+			}
+
+			transport = mock
+		case target.Connection.isIPC():
+			transport = newIPCTransport(target.Connection.IPC.Path)
+		case !ok:
+			transport = newHealthCheckTransport(target, config.Config.Timeout, ports)
+		}
+
+		maintenance, err := newMaintenanceWindows(target.MaintenanceWindows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid target %q", target.Name)
+		}
+
 		hc, err := NewHealthChecker(
 			HealthCheckerConfig{
-				Logger:           config.Logger,
-				URL:              target.Connection.HTTP.URL,
+				Logger:           newRedactingLogger(config.Logger, target.secretRedactor()),
+				URL:              url,
 				Name:             target.Name,
-				Interval:         config.Config.Interval,
+				Interval:         target.HealthCheck.interval(config.Config.Interval),
 				Timeout:          config.Config.Timeout,
 				FailureThreshold: config.Config.FailureThreshold,
 				SuccessThreshold: config.Config.SuccessThreshold,
+				Transport:        transport,
+				UserAgent:        target.userAgent(config.UserAgent),
+				Probes:           config.Config.Probes,
+				Mode:             target.HealthCheck.Mode,
+				HTTP:             target.HealthCheck.HTTP,
+				Write:            target.HealthCheck.Write,
+				MaxBlockAge:      config.Config.MaxBlockAge,
+				OnHealthChange:   hcm.notifyHealthChange,
+				OnCheckSkipped:   hcm.observeSkippedCheck,
+				OnCheckDone:      hcm.observeCheck,
+				OnProbeDone:      hcm.observeProbe,
+				Clock:            clockFunc(func() time.Time { return hcm.clock.Now() }),
 			})
 		if err != nil {
 			return nil, err
 		}
 
+		e := &healthCheckEntry{
+			index:   len(hcm.hcs),
+			checker: hc,
+			window:  hcm.newRollingWindow(),
+			classes: map[string]*methodClassState{},
+			taints:  map[string]time.Time{},
+			canary:  newRollingWindow(hcm.config.RollingWindowImplementation, hcm.config.Canary.windowSize(), 1),
+
+			maintenance: maintenance,
+		}
+
+		if !target.Connection.isMock() && !target.Connection.isIPC() {
+			e.host, e.resolver = startupHost(target, url)
+			e.endpoint = backendEndpoint(url)
+		}
+
+		hcm.entries[target.Name] = e
 		hcm.hcs = append(hcm.hcs, hc)
 	}
 
+	// Hostnames are compared as soon as the targets are known, addresses
+	// once they're resolved by Start.
+	//
+	if !hcm.config.DistinctBackendsByIP {
+		if err := hcm.checkDistinctBackends(context.Background(), false); err != nil {
+			return nil, err
+		}
+	}
+
+	if hcm.config.StatePath != "" {
+		hcm.loadState()
+	}
+
 	return hcm, nil
 }
 
@@ -88,19 +431,333 @@ func (h *HealthCheckManager) runLoop(c context.Context) error {
 	ticker := time.NewTicker(time.Second * 1)
 	defer ticker.Stop()
 
+	stateTicker := time.NewTicker(stateSnapshotInterval)
+	defer stateTicker.Stop()
+
+	var distinctBackends <-chan time.Time
+
+	if h.config.DistinctBackendsByIP {
+		distinctBackendsTicker := time.NewTicker(distinctBackendsInterval)
+		defer distinctBackendsTicker.Stop()
+
+		distinctBackends = distinctBackendsTicker.C
+	}
+
 	for {
 		select {
 		case <-c.Done():
 			return nil
 		case <-ticker.C:
 			h.reportStatusMetrics()
+			h.reportConsensus()
+		case <-stateTicker.C:
+			if err := h.SaveState(); err != nil {
+				h.logger.Warn("cannot save state", "error", err)
+			}
+		case <-distinctBackends:
+			// The targets were distinct at startup, so they're only logged
+			// and flagged now.
+			//
+			h.checkDistinctBackends(c, true) // nolint:errcheck
 		}
 	}
 }
 
-func (h *HealthCheckManager) IsHealthy(name string) bool {
-	for _, hc := range h.hcs {
-		if hc.Name() == name && hc.IsHealthy() {
+func (h *HealthCheckManager) notifyHealthChange(name string, healthy bool) {
+	if healthy {
+		h.logger.Info("target became healthy", "nodeprovider", name)
+	} else {
+		h.logger.Warn("target became unhealthy", "nodeprovider", name)
+	}
+
+	if healthy && h.config.Canary.enabled() {
+		h.startRecovery(name)
+	}
+
+	h.mu.RLock()
+	observers := h.healthObservers
+	h.mu.RUnlock()
+
+	for _, observer := range observers {
+		observer.OnHealthChange(name, healthy)
+	}
+}
+
+func (h *HealthCheckManager) observeSkippedCheck(name string) {
+	h.metricRPCProviderSkippedChecks.WithLabelValues(name).Inc()
+}
+
+func (h *HealthCheckManager) observeCheck(name string, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+
+	h.metricRPCProviderChecks.WithLabelValues(name, outcome).Inc()
+
+	if isTimeout(err) {
+		h.ObserveTimeout(name, timeoutSourceHealthCheck)
+	}
+}
+
+// ObserveTimeout counts a timeout of the named target, from its health
+// checks or its traffic, so a busy target failing its health checks can be
+// told from a dead one.
+func (h *HealthCheckManager) ObserveTimeout(name, source string) {
+	h.metricRPCProviderTimeouts.WithLabelValues(name, source).Inc()
+}
+
+// observeProbe records the response time of a call of a health check,
+// whether it failed or not.
+func (h *HealthCheckManager) observeProbe(name, probe string, duration time.Duration, _ error) {
+	h.metricRPCProviderCheckDuration.WithLabelValues(name, probe).Observe(duration.Seconds())
+}
+
+// AddHealthObserver registers an observer notified on target health
+// transitions.
+func (h *HealthCheckManager) AddHealthObserver(observer HealthObserver) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.healthObservers = append(h.healthObservers, observer)
+}
+
+func (h *HealthCheckManager) entry(name string) (*healthCheckEntry, error) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	e, ok := h.entries[name]
+	if !ok {
+		return nil, errors.Wrapf(ErrTargetNotFound, "%q", name)
+	}
+
+	return e, nil
+}
+
+// GetTargetByName returns the health checker of the named target.
+func (h *HealthCheckManager) GetTargetByName(name string) (*HealthChecker, error) {
+	e, err := h.entry(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.checker, nil
+}
+
+// GetTargetIndexByName returns the position of the named target in the
+// configuration.
+func (h *HealthCheckManager) GetTargetIndexByName(name string) (int, error) {
+	e, err := h.entry(name)
+	if err != nil {
+		return -1, err
+	}
+
+	return e.index, nil
+}
+
+// GetRollingWindowByName returns the rolling window of the named target.
+func (h *HealthCheckManager) GetRollingWindowByName(name string) (*RollingWindow, error) {
+	e, err := h.entry(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.window, nil
+}
+
+// WindowsReset is what a reset of the rolling windows of a target dropped.
+type WindowsReset struct {
+	// Observations is the number of observations dropped from the window
+	// of the target, and Classes from the windows of its method classes.
+	Observations int            `json:"observations"`
+	Classes      map[string]int `json:"classes"`
+}
+
+// ResetWindows drops the observations of the rolling windows of the named
+// target, its method classes included, so it starts over. Its taints are
+// kept.
+func (h *HealthCheckManager) ResetWindows(name string) (WindowsReset, error) {
+	e, err := h.entry(name)
+	if err != nil {
+		return WindowsReset{}, err
+	}
+
+	reset := WindowsReset{
+		Observations: e.window.Len(),
+		Classes:      map[string]int{},
+	}
+
+	e.window.Reset()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for class, state := range e.classes {
+		reset.Classes[class] = state.window.Len()
+		state.window.Reset()
+	}
+
+	h.logger.Info("rolling windows reset", "nodeprovider", name, "observations", reset.Observations)
+
+	return reset, nil
+}
+
+// resetConsecutiveFailures clears the consecutive failures of the named
+// target and returns how many there were.
+func (h *HealthCheckManager) resetConsecutiveFailures(name string) (int, error) {
+	e, err := h.entry(name)
+	if err != nil {
+		return 0, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	consecutive := e.consecutiveFailures
+	e.consecutiveFailures = 0
+
+	return consecutive, nil
+}
+
+func (h *HealthCheckManager) newRollingWindow() *RollingWindow {
+	return newRollingWindow(
+		h.config.RollingWindowImplementation,
+		int(h.config.RollingWindowSize),
+		h.config.RollingWindowMinObservations,
+	)
+}
+
+// GetClassRollingWindowByName returns the rolling window of a method class
+// served by the named target.
+func (h *HealthCheckManager) GetClassRollingWindowByName(name, class string) (*RollingWindow, error) {
+	e, err := h.entry(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return h.classState(e, class).window, nil
+}
+
+// classState returns the state of a method class, e.mu must be held.
+func (h *HealthCheckManager) classState(e *healthCheckEntry, class string) *methodClassState {
+	state, ok := e.classes[class]
+	if !ok {
+		state = &methodClassState{window: h.newRollingWindow()}
+		e.classes[class] = state
+	}
+
+	return state
+}
+
+// ObserveSuccess records a successful request of the given method class
+// served by the named target.
+func (h *HealthCheckManager) ObserveSuccess(name, class string) {
+	h.observe(name, class, 1)
+}
+
+// ObserveFailure records a failed request of the given method class served
+// by the named target.
+func (h *HealthCheckManager) ObserveFailure(name, class string) {
+	h.observe(name, class, 0)
+}
+
+func (h *HealthCheckManager) observe(name, class string, value int) {
+	e, err := h.entry(name)
+	if err != nil {
+		h.logger.Warn("cannot observe an unknown target", "nodeprovider", name)
+
+		return
+	}
+
+	e.window.Observe(value)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if value == 0 {
+		e.consecutiveFailures++
+	} else {
+		e.consecutiveFailures = 0
+	}
+
+	state := h.classState(e, class)
+	state.window.Observe(value)
+
+	if h.config.RollingWindowTaintThreshold <= 0 || h.clock.Now().Before(state.taintedUntil) {
+		return
+	}
+
+	if state.window.HasEnoughObservations() && state.window.SuccessRate() < h.config.RollingWindowTaintThreshold {
+		state.taintedUntil = h.clock.Now().Add(h.taintDuration())
+
+		h.metricRPCProviderTaints.WithLabelValues(name, TaintReasonErrorRate).Inc()
+
+		h.logger.Warn("tainting method class",
+			"nodeprovider", name,
+			"class", class,
+			"successRate", state.window.SuccessRate(),
+			"until", state.taintedUntil)
+	}
+}
+
+func (h *HealthCheckManager) taintDuration() time.Duration {
+	if h.config.TaintDuration <= 0 {
+		return DefaultTaintDuration
+	}
+
+	return h.config.TaintDuration
+}
+
+// IsTainted reports whether the named target is tainted for the given method
+// class. An expired taint is lifted and the class window starts over.
+func (h *HealthCheckManager) IsTainted(name, class string) bool {
+	e, err := h.entry(name)
+	if err != nil {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state, ok := e.classes[class]
+	if !ok || state.taintedUntil.IsZero() {
+		return false
+	}
+
+	if h.clock.Now().Before(state.taintedUntil) {
+		return true
+	}
+
+	state.taintedUntil = time.Time{}
+	state.window.Reset()
+
+	h.logger.Info("untainting method class", "nodeprovider", name, "class", class)
+
+	return false
+}
+
+// IsAvailable reports whether the named target can serve a request of the
+// given method class. The write classes also require the target to accept
+// transactions.
+func (h *HealthCheckManager) IsAvailable(name, class string) bool {
+	if h.writeClasses[class] && !h.IsWriteHealthy(name) {
+		return false
+	}
+
+	return h.IsHealthy(name) && !h.isTargetTainted(name) && !h.IsTainted(name, class) && !h.IsRecovering(name)
+}
+
+// isAnyClassTainted reports whether any method class of the named target is
+// tainted.
+func (h *HealthCheckManager) isAnyClassTainted(e *healthCheckEntry) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, state := range e.classes {
+		if h.clock.Now().Before(state.taintedUntil) {
 			return true
 		}
 	}
@@ -108,6 +765,47 @@ func (h *HealthCheckManager) IsHealthy(name string) bool {
 	return false
 }
 
+// IsHealthy reports whether the named target is healthy. Unknown targets are
+// never healthy.
+func (h *HealthCheckManager) IsHealthy(name string) bool {
+	e, err := h.entry(name)
+	if err != nil {
+		return false
+	}
+
+	return e.checker.IsHealthy()
+}
+
+// IsWriteHealthy reports whether the named target accepts transactions.
+// Targets without a write check always do, unknown targets never do.
+func (h *HealthCheckManager) IsWriteHealthy(name string) bool {
+	e, err := h.entry(name)
+	if err != nil {
+		return false
+	}
+
+	return e.checker.IsWriteHealthy()
+}
+
+// isWriteClass reports whether the method class is served only by targets
+// accepting transactions.
+func (h *HealthCheckManager) isWriteClass(class string) bool {
+	return h.writeClasses[class]
+}
+
+func newWriteClasses(classes []string) map[string]bool {
+	if classes == nil {
+		classes = DefaultWriteMethodClasses()
+	}
+
+	writeClasses := make(map[string]bool, len(classes))
+	for _, class := range classes {
+		writeClasses[class] = true
+	}
+
+	return writeClasses
+}
+
 func (h *HealthCheckManager) reportStatusMetrics() {
 	for _, hc := range h.hcs {
 		if hc.IsHealthy() {
@@ -116,23 +814,194 @@ func (h *HealthCheckManager) reportStatusMetrics() {
 			h.metricRPCProviderStatus.WithLabelValues(hc.Name(), "healthy").Set(0)
 		}
 
+		if hc.IsWriteHealthy() {
+			h.metricRPCProviderStatus.WithLabelValues(hc.Name(), "write_healthy").Set(1)
+		} else {
+			h.metricRPCProviderStatus.WithLabelValues(hc.Name(), "write_healthy").Set(0)
+		}
+
+		e, err := h.entry(hc.Name())
+		if err != nil {
+			continue
+		}
+
+		if h.isAnyClassTainted(e) || h.isTargetTainted(hc.Name()) {
+			h.metricRPCProviderStatus.WithLabelValues(hc.Name(), "tainted").Set(1)
+		} else {
+			h.metricRPCProviderStatus.WithLabelValues(hc.Name(), "tainted").Set(0)
+		}
+
+		h.reportTaintMetrics(hc.Name())
+
+		e.mu.Lock()
+		if e.recovering {
+			h.metricRPCProviderStatus.WithLabelValues(hc.Name(), "recovering").Set(1)
+		} else {
+			h.metricRPCProviderStatus.WithLabelValues(hc.Name(), "recovering").Set(0)
+		}
+
+		for class, state := range e.classes {
+			h.metricRPCProviderSuccessRate.WithLabelValues(hc.Name(), class).Set(state.window.SuccessRate())
+		}
+
+		h.metricRPCProviderConsecutiveFails.WithLabelValues(hc.Name()).Set(float64(e.consecutiveFailures))
+		e.mu.Unlock()
+
+		h.metricRPCProviderWindowSuccessRate.WithLabelValues(hc.Name()).Set(e.window.SuccessRate())
+		h.metricRPCProviderWindowObservations.WithLabelValues(hc.Name()).Set(float64(e.window.Len()))
+
 		h.metricRPCProviderGasLimit.WithLabelValues(hc.Name()).Set(float64(hc.BlockNumber()))
 		h.metricRPCProviderBlockNumber.WithLabelValues(hc.Name()).Set(float64(hc.BlockNumber()))
+
+		if observedAt := hc.BlockNumberObservedAt(); !observedAt.IsZero() {
+			h.metricRPCProviderBlockAge.WithLabelValues(hc.Name()).Set(h.clock.Now().Sub(observedAt).Seconds())
+		}
+
+		if timestamp := hc.BlockTimestamp(); !timestamp.IsZero() {
+			h.metricRPCProviderBlockTimestampAge.WithLabelValues(hc.Name()).Set(h.clock.Now().Sub(timestamp).Seconds())
+		}
 	}
 }
 
+// Start runs the health checks of every target until the context is
+// canceled or Stop is called. It returns once every checker has stopped.
 func (h *HealthCheckManager) Start(c context.Context) error {
+	h.runMu.Lock()
+	if h.stopped || h.done != nil {
+		h.runMu.Unlock()
+
+		return nil
+	}
+
+	c, cancel := context.WithCancel(c)
+	done := make(chan struct{})
+
+	h.cancel = cancel
+	h.done = done
+	h.runMu.Unlock()
+
+	defer close(done)
+	defer cancel()
+
+	if err := h.resolveTargets(c); err != nil {
+		return err
+	}
+
+	if h.config.DistinctBackendsByIP {
+		if err := h.checkDistinctBackends(c, true); err != nil {
+			return err
+		}
+	}
+
 	for i, hc := range h.hcs {
 		h.metricRPCProviderInfo.WithLabelValues(strconv.Itoa(i), hc.Name()).Set(1)
-		go hc.Start(c)
 	}
 
-	return h.runLoop(c)
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		h.runChecks(c)
+	}()
+
+	err := h.runLoop(c)
+	wg.Wait()
+
+	return err
+}
+
+// BlockNumber returns the last block number observed on the named target and
+// its age.
+func (h *HealthCheckManager) BlockNumber(name string) (uint64, time.Duration, error) {
+	hc, err := h.GetTargetByName(name)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	observedAt := hc.BlockNumberObservedAt()
+	if observedAt.IsZero() {
+		return 0, 0, nil
+	}
+
+	return hc.BlockNumber(), h.clock.Now().Sub(observedAt), nil
+}
+
+// MaxBlockNumber returns the highest block number observed across targets.
+// Observations older than the staleness bound are ignored, so the last known
+// block of a dead target doesn't make the others look behind.
+func (h *HealthCheckManager) MaxBlockNumber() uint64 {
+	var highest uint64
+
+	for _, hc := range h.hcs {
+		observedAt := hc.BlockNumberObservedAt()
+		if observedAt.IsZero() || h.clock.Now().Sub(observedAt) > h.blockNumberStaleness() {
+			continue
+		}
+
+		highest = max(highest, hc.BlockNumber())
+	}
+
+	return highest
 }
 
+// blockNumberStaleness is how old a block number observation can be to be
+// compared with the others.
+func (h *HealthCheckManager) blockNumberStaleness() time.Duration {
+	if h.config.BlockNumberStaleness <= 0 {
+		return DefaultBlockNumberStaleness
+	}
+
+	return h.config.BlockNumberStaleness
+}
+
+// AwaitFirstChecks waits until every target went through its first health
+// check, for at most the startup timeout.
+func (h *HealthCheckManager) AwaitFirstChecks(c context.Context) error {
+	timeout := h.config.StartupTimeout
+	if timeout <= 0 {
+		timeout = DefaultStartupTimeout
+	}
+
+	c, cancel := context.WithTimeout(c, timeout)
+	defer cancel()
+
+	for _, hc := range h.hcs {
+		select {
+		case <-hc.Checked():
+		case <-c.Done():
+			return errors.Wrapf(c.Err(), "first health check of %q not done", hc.Name())
+		}
+	}
+
+	return nil
+}
+
+// Stop stops the health checks and waits for Start to return, or for the
+// context to be done, whichever comes first.
 func (h *HealthCheckManager) Stop(c context.Context) error {
+	h.runMu.Lock()
+	h.stopped = true
+	cancel, done := h.cancel, h.done
+	h.runMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+
+		select {
+		case <-done:
+		case <-c.Done():
+			return errors.Wrap(c.Err(), "health check manager did not stop")
+		}
+	}
+
 	var errs error
 
+	if err := h.SaveState(); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("healthcheckManager.Stop error: %w", err))
+	}
+
 	for _, hc := range h.hcs {
 		err := hc.Stop(c)
 		if err != nil {
@@ -0,0 +1,450 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHealthCheckManager(t testing.TB, names ...string) *HealthCheckManager {
+	t.Helper()
+
+	return newTestHealthCheckManagerWithConfig(t, HealthCheckConfig{}, names...)
+}
+
+func newTestHealthCheckManagerWithConfig(t testing.TB, config HealthCheckConfig, names ...string) *HealthCheckManager {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	targets := make([]NodeProviderConfig, 0, len(names))
+	for _, name := range names {
+		targets = append(targets, NodeProviderConfig{
+			Name: name,
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: "http://127.0.0.1:8545",
+				},
+			},
+		})
+	}
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: targets,
+		Config:  config,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	})
+	assert.NoError(t, err)
+
+	return hcm
+}
+
+func TestHealthCheckManagerLookups(t *testing.T) {
+	hcm := newTestHealthCheckManager(t, "Server1", "Server2")
+
+	hc, err := hcm.GetTargetByName("Server2")
+	assert.NoError(t, err)
+	assert.Equal(t, "Server2", hc.Name())
+
+	index, err := hcm.GetTargetIndexByName("Server2")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, index)
+
+	assert.True(t, hcm.IsHealthy("Server1"))
+}
+
+func TestHealthCheckManagerUnknownTarget(t *testing.T) {
+	hcm := newTestHealthCheckManager(t, "Server1")
+
+	hc, err := hcm.GetTargetByName("Unknown")
+	assert.Nil(t, hc)
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+
+	index, err := hcm.GetTargetIndexByName("Unknown")
+	assert.Equal(t, -1, index)
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+
+	window, err := hcm.GetRollingWindowByName("Unknown")
+	assert.Nil(t, window)
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+
+	assert.False(t, hcm.IsHealthy("Unknown"))
+}
+
+func TestHealthCheckManagerDuplicatedTarget(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{Name: "Server1", Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8545"}}},
+			{Name: "Server1", Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8545"}}},
+		},
+		Logger: slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	})
+
+	assert.Nil(t, hcm)
+	assert.ErrorContains(t, err, "duplicated target name")
+}
+
+func TestHealthCheckManagerRequiresARequiredProbe(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{Name: "Server1", Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8545"}}},
+		},
+		Config: HealthCheckConfig{
+			Probes: []HealthCheckProbe{{Method: "getSlot", HeightPath: "$"}, {Method: "getHealth"}},
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	assert.Nil(t, hcm)
+	assert.ErrorContains(t, err, "at least one probe must be required")
+}
+
+func BenchmarkHealthCheckManagerIsHealthy(b *testing.B) {
+	names := make([]string, 0, 25)
+	for i := 0; i < 25; i++ {
+		names = append(names, "Server"+strconv.Itoa(i))
+	}
+
+	hcm := newTestHealthCheckManager(b, names...)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			hcm.IsHealthy("Server24")
+		}
+	})
+}
+
+func TestHealthCheckManagerStopWaitsForCheckers(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	node := newFakeNode(t)
+	defer node.Close()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name: "Server1",
+				Connection: NodeProviderConnectionConfig{
+					HTTP: NodeProviderConnectionHTTPConfig{
+						URL: node.URL,
+					},
+				},
+			},
+		},
+		Config: HealthCheckConfig{
+			Interval: 10 * time.Millisecond,
+			Timeout:  time.Second,
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- hcm.Start(context.Background())
+	}()
+
+	hc, err := hcm.GetTargetByName("Server1")
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return hc.BlockNumber() != 0
+	}, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, hcm.Stop(context.Background()))
+	assert.NoError(t, <-started)
+}
+
+func TestHealthCheckManagerRestoresState(t *testing.T) {
+	config := HealthCheckConfig{
+		RollingWindowSize:           10,
+		RollingWindowTaintThreshold: 0.5,
+		TaintDuration:               time.Hour,
+		StatePath:                   filepath.Join(t.TempDir(), "state.json"),
+	}
+
+	hcm := newTestHealthCheckManagerWithConfig(t, config, "Server1", "Server2")
+
+	for i := 0; i < 10; i++ {
+		hcm.ObserveFailure("Server1", "logs")
+		hcm.ObserveSuccess("Server2", "logs")
+	}
+
+	hc, err := hcm.GetTargetByName("Server2")
+	assert.NoError(t, err)
+
+	hc.mu.Lock()
+	hc.isHealthy = false
+	hc.mu.Unlock()
+
+	assert.True(t, hcm.IsTainted("Server1", "logs"))
+
+	clock := newFakeClock()
+	hcm.clock = clock
+
+	assert.NoError(t, hcm.Taint("Server2", TaintReasonManual, 0))
+	assert.NoError(t, hcm.Taint("Server2", TaintReasonCooldown429, time.Minute))
+	assert.NoError(t, hcm.Taint("Server2", TaintReasonMisconfigured, time.Second))
+	assert.NoError(t, hcm.SaveState())
+
+	// A restarted manager keeps the tainted target excluded, and the taints
+	// of the whole target that haven't expired meanwhile.
+	//
+	clock.Advance(2 * time.Second)
+
+	restarted := newTestHealthCheckManagerWithConfig(t, config, "Server1", "Server2")
+	restarted.clock = clock
+	restarted.loadState()
+
+	taints, err := restarted.Taints("Server2")
+	assert.NoError(t, err)
+
+	if assert.Len(t, taints, 2) {
+		assert.Equal(t, TaintReasonCooldown429, taints[0].Reason)
+		assert.WithinDuration(t, clock.Now().Add(time.Minute-2*time.Second), *taints[0].Until, 0)
+		assert.Equal(t, TaintReasonManual, taints[1].Reason)
+		assert.Nil(t, taints[1].Until)
+	}
+
+	assert.True(t, restarted.IsTainted("Server1", "logs"))
+	assert.False(t, restarted.IsAvailable("Server1", "logs"))
+	assert.True(t, restarted.IsAvailable("Server1", DefaultMethodClass))
+	assert.False(t, restarted.IsHealthy("Server2"))
+
+	window, err := restarted.GetClassRollingWindowByName("Server2", "logs")
+	assert.NoError(t, err)
+	assert.Equal(t, 10, window.Len())
+	assert.Equal(t, 1.0, window.SuccessRate())
+}
+
+func TestHealthCheckManagerIgnoresStaleOrCorruptState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	config := HealthCheckConfig{
+		StatePath:   statePath,
+		StateMaxAge: time.Minute,
+	}
+
+	stale, err := json.Marshal(healthState{
+		SavedAt: time.Now().Add(-time.Hour),
+		Targets: map[string]*targetState{
+			"Server1": {Healthy: false},
+		},
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(statePath, stale, 0o600))
+
+	hcm := newTestHealthCheckManagerWithConfig(t, config, "Server1")
+	assert.True(t, hcm.IsHealthy("Server1"))
+
+	assert.NoError(t, os.WriteFile(statePath, []byte(`{"savedAt":`), 0o600))
+
+	hcm = newTestHealthCheckManagerWithConfig(t, config, "Server1")
+	assert.True(t, hcm.IsHealthy("Server1"))
+}
+
+func TestHealthCheckManagerReportsWindowMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name: "Server1",
+				Connection: NodeProviderConnectionConfig{
+					HTTP: NodeProviderConnectionHTTPConfig{
+						URL: "http://127.0.0.1:8545",
+					},
+				},
+			},
+		},
+		Config: HealthCheckConfig{
+			RollingWindowSize:            4,
+			RollingWindowMinObservations: 1,
+			RollingWindowTaintThreshold:  0.5,
+		},
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Registerer: registry,
+	})
+	assert.NoError(t, err)
+
+	hcm.ObserveSuccess("Server1", DefaultMethodClass)
+	hcm.ObserveFailure("Server1", DefaultMethodClass)
+	hcm.ObserveFailure("Server1", DefaultMethodClass)
+	hcm.ObserveFailure("Server1", DefaultMethodClass)
+
+	hcm.reportStatusMetrics()
+
+	expected := `
+# HELP zeroex_rpc_gateway_provider_consecutive_failures Number of failed requests of a given provider since its last successful one
+# TYPE zeroex_rpc_gateway_provider_consecutive_failures gauge
+zeroex_rpc_gateway_provider_consecutive_failures{provider="Server1"} 3
+# HELP zeroex_rpc_gateway_provider_success_rate Rolling window success rate of a given provider
+# TYPE zeroex_rpc_gateway_provider_success_rate gauge
+zeroex_rpc_gateway_provider_success_rate{provider="Server1"} 0.25
+# HELP zeroex_rpc_gateway_provider_taints_total The total number of times a given provider has been tainted by reason
+# TYPE zeroex_rpc_gateway_provider_taints_total counter
+zeroex_rpc_gateway_provider_taints_total{provider="Server1",reason="error_rate"} 1
+# HELP zeroex_rpc_gateway_provider_window_observations Number of request outcomes in the rolling window of a given provider
+# TYPE zeroex_rpc_gateway_provider_window_observations gauge
+zeroex_rpc_gateway_provider_window_observations{provider="Server1"} 4
+`
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"zeroex_rpc_gateway_provider_consecutive_failures",
+		"zeroex_rpc_gateway_provider_success_rate",
+		"zeroex_rpc_gateway_provider_taints_total",
+		"zeroex_rpc_gateway_provider_window_observations"))
+
+	hcm.ObserveSuccess("Server1", DefaultMethodClass)
+	hcm.reportStatusMetrics()
+
+	assert.Zero(t, testutil.ToFloat64(hcm.metricRPCProviderConsecutiveFails.WithLabelValues("Server1")))
+	assert.Equal(t, 0.25, testutil.ToFloat64(hcm.metricRPCProviderWindowSuccessRate.WithLabelValues("Server1")))
+}
+
+func TestHealthCheckManagerIgnoresStaleBlockNumbers(t *testing.T) {
+	clock := newFakeClock()
+
+	hcm := newTestHealthCheckManagerWithConfig(t, HealthCheckConfig{BlockNumberStaleness: time.Minute},
+		"Server1", "Server2")
+	hcm.clock = clock
+
+	dead, alive := hcm.hcs[0], hcm.hcs[1]
+
+	assert.Zero(t, hcm.MaxBlockNumber())
+
+	dead.context, dead.blockNumberObservedAt = HealthContext{HealthContextBlockNumber: uint64(100)}, clock.Now()
+	alive.context, alive.blockNumberObservedAt = HealthContext{HealthContextBlockNumber: uint64(90)}, clock.Now()
+
+	assert.Equal(t, uint64(100), hcm.MaxBlockNumber())
+
+	// Only the alive target keeps observing blocks.
+	//
+	clock.Advance(2 * time.Minute)
+	alive.context, alive.blockNumberObservedAt = HealthContext{HealthContextBlockNumber: uint64(95)}, clock.Now()
+
+	assert.Equal(t, uint64(95), hcm.MaxBlockNumber())
+
+	number, age, err := hcm.BlockNumber("Server1")
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(100), number)
+	assert.Equal(t, 2*time.Minute, age)
+
+	_, _, err = hcm.BlockNumber("Unknown")
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+}
+
+func TestHealthCheckerDatesBlockNumbers(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	clock := newFakeClock()
+
+	hc, err := NewHealthChecker(HealthCheckerConfig{
+		URL:     node.URL,
+		Name:    "Server1",
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Timeout: time.Second,
+		Clock:   clock,
+	})
+	assert.NoError(t, err)
+
+	defer hc.Stop(context.Background())
+
+	assert.True(t, hc.BlockNumberObservedAt().IsZero())
+
+	hc.CheckAndSetHealth(context.Background())
+
+	assert.Equal(t, uint64(0x10), hc.BlockNumber())
+	assert.Equal(t, clock.Now(), hc.BlockNumberObservedAt())
+}
+
+func TestHealthCheckManagerReportsCheckMetrics(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	registry := prometheus.NewRegistry()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name:       "Server1",
+				Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+			},
+			{
+				Name:       "Server2",
+				Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: failing.URL}},
+			},
+		},
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Registerer: registry,
+	})
+	assert.NoError(t, err)
+
+	for _, hc := range hcm.hcs {
+		hc.Check(context.Background()) // nolint:errcheck
+	}
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	observations := map[string]uint64{}
+
+	for _, family := range families {
+		if family.GetName() != "zeroex_rpc_gateway_healthcheck_response_duration_seconds" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			labels := map[string]string{}
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+
+			observations[labels["provider"]+" "+labels["probe"]] = metric.GetHistogram().GetSampleCount()
+		}
+	}
+
+	// Failed calls are timed too.
+	//
+	assert.Equal(t, map[string]uint64{
+		"Server1 eth_blockNumber": 1,
+		"Server1 eth_call":        1,
+		"Server2 eth_blockNumber": 1,
+		"Server2 eth_call":        1,
+	}, observations)
+
+	expected := `
+# HELP zeroex_rpc_gateway_provider_healthchecks_total The total number of health checks of a given provider by outcome
+# TYPE zeroex_rpc_gateway_provider_healthchecks_total counter
+zeroex_rpc_gateway_provider_healthchecks_total{outcome="failure",provider="Server2"} 1
+zeroex_rpc_gateway_provider_healthchecks_total{outcome="success",provider="Server1"} 1
+`
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"zeroex_rpc_gateway_provider_healthchecks_total"))
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxHealthCheckConnectTimeout bounds the dial, the TLS handshake and
+	// the wait for the response headers of a health check, whatever its
+	// timeout.
+	maxHealthCheckConnectTimeout = 5 * time.Second
+
+	// Sources of the timeouts of the targets.
+	timeoutSourceHealthCheck = "healthcheck"
+	timeoutSourceTraffic     = "traffic"
+)
+
+// sourcePorts is a range of local ports connections are made from, shared
+// by the health checks of every target.
+type sourcePorts struct {
+	low, high int
+	next      atomic.Uint32
+}
+
+// parseSourcePorts parses a range of ports, e.g. "40000-40999". It returns
+// nil for an empty range.
+func parseSourcePorts(spec string) (*sourcePorts, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	lowSpec, highSpec, ok := strings.Cut(spec, "-")
+	if !ok {
+		highSpec = lowSpec
+	}
+
+	low, err := strconv.Atoi(lowSpec)
+	if err != nil || low <= 0 || low > 65535 {
+		return nil, errors.Errorf("invalid source ports %q", spec)
+	}
+
+	high, err := strconv.Atoi(highSpec)
+	if err != nil || high < low || high > 65535 {
+		return nil, errors.Errorf("invalid source ports %q", spec)
+	}
+
+	return &sourcePorts{low: low, high: high}, nil
+}
+
+// dialer returns a dialer connecting from the ports of the range in turn,
+// skipping the ones in use.
+func (s *sourcePorts) dialer(dialer *net.Dialer) contextDialer {
+	return dialerFunc(func(c context.Context, network, address string) (net.Conn, error) {
+		size := s.high - s.low + 1
+
+		for i := 0; i < size; i++ {
+			local := *dialer
+			local.LocalAddr = &net.TCPAddr{Port: s.low + int(s.next.Add(1)-1)%size}
+
+			conn, err := local.DialContext(c, network, address)
+			if !errors.Is(err, syscall.EADDRINUSE) {
+				return conn, err
+			}
+		}
+
+		return nil, errors.Errorf("no free source port between %d and %d", s.low, s.high)
+	})
+}
+
+type dialerFunc func(c context.Context, network, address string) (net.Conn, error)
+
+func (f dialerFunc) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	return f(c, network, address)
+}
+
+// newHealthCheckTransport returns the transport of the health checks of a
+// target. It's never shared with the traffic, so the health checks don't
+// wait for the connections of a busy target and fail it for being busy.
+// It follows the DNS settings of the target, but not the limits of its
+// connection pool.
+func newHealthCheckTransport(target NodeProviderConfig, timeout time.Duration, ports *sourcePorts) http.RoundTripper {
+	connectTimeout := maxHealthCheckConnectTimeout
+	if timeout > 0 && timeout < connectTimeout {
+		connectTimeout = timeout
+	}
+
+	transport := NewHTTPTransport(NodeProviderTransportConfig{
+		ForceHTTP2: target.Connection.HTTP.Transport.ForceHTTP2,
+	})
+	transport.TLSHandshakeTimeout = connectTimeout
+	transport.ResponseHeaderTimeout = connectTimeout
+
+	netDialer := &net.Dialer{
+		Timeout:   connectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	var dialer contextDialer = netDialer
+	if ports != nil {
+		dialer = ports.dialer(netDialer)
+	}
+
+	if target.DNS.isZero() {
+		transport.DialContext = dialer.DialContext
+
+		return transport
+	}
+
+	dnsDialer := newTargetDialer(target.DNS, nil, systemClock{})
+	dnsDialer.dialer = dialer
+	transport.DialContext = dnsDialer.DialContext
+
+	return &dnsRefreshingTransport{
+		Transport: transport,
+		dialer:    dnsDialer,
+	}
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSourcePorts(t *testing.T) {
+	ports, err := parseSourcePorts("40000-40999")
+	require.NoError(t, err)
+	assert.Equal(t, 40000, ports.low)
+	assert.Equal(t, 40999, ports.high)
+
+	ports, err = parseSourcePorts("40000")
+	require.NoError(t, err)
+	assert.Equal(t, 40000, ports.high)
+
+	ports, err = parseSourcePorts("")
+	assert.NoError(t, err)
+	assert.Nil(t, ports)
+
+	for _, spec := range []string{"0-10", "10-5", "40000-70000", "a-b", "-"} {
+		_, err := parseSourcePorts(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestHealthChecksSurviveTrafficPoolExhaustion(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var (
+		blocked atomic.Int64
+		release = make(chan struct{})
+	)
+
+	// The traffic hangs, holding the only connection its transport may
+	// open, while the health checks are answered at once.
+	//
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		switch req.Method {
+		case "eth_getLogs":
+			blocked.Add(1)
+			<-release
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":[]}`)) // nolint:errcheck
+		case "eth_blockNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`)) // nolint:errcheck
+		case "eth_call":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`)) // nolint:errcheck
+		}
+	}))
+	t.Cleanup(node.Close)
+
+	config := createConfig()
+	config.HealthChecks.Timeout = time.Second
+	config.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL:       node.URL,
+					Transport: NodeProviderTransportConfig{MaxConnsPerHost: 1},
+				},
+			},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPost, "/",
+				bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs"}`))
+			p.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+
+	require.Eventually(t, func() bool { return blocked.Load() == 1 }, time.Second, time.Millisecond)
+
+	hc, err := p.hcm.GetTargetByName("Server1")
+	require.NoError(t, err)
+
+	c, cancel := context.WithTimeout(context.Background(), config.HealthChecks.Timeout)
+	defer cancel()
+
+	result, err := hc.Check(c)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x10), result.BlockNumber)
+	assert.Equal(t, int64(1), blocked.Load())
+
+	close(release)
+	wg.Wait()
+}
+
+func TestHealthChecksConnectFromSourcePorts(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	var remote atomic.Value
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote.Store(r.RemoteAddr)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(node.Close)
+
+	ports, err := parseSourcePorts(strconv.Itoa(port))
+	require.NoError(t, err)
+
+	transport := newHealthCheckTransport(NodeProviderConfig{}, time.Second, ports)
+
+	res, err := (&http.Client{Transport: transport}).Post(node.URL, "application/json", bytes.NewBufferString(`{}`))
+	require.NoError(t, err)
+	res.Body.Close()
+
+	_, remotePort, err := net.SplitHostPort(remote.Load().(string))
+	require.NoError(t, err)
+	assert.Equal(t, strconv.Itoa(port), remotePort)
+}
+
+func TestHealthCheckManagerCountsTimeoutsBySource(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	t.Cleanup(hanging.Close)
+
+	config := createConfig()
+	config.Proxy.UpstreamTimeout = 50 * time.Millisecond
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: hanging.URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	hc, err := p.hcm.GetTargetByName("Server1")
+	require.NoError(t, err)
+
+	c, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = hc.Check(c)
+	assert.Error(t, err)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.hcm.metricRPCProviderTimeouts.WithLabelValues("Server1", timeoutSourceTraffic)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.hcm.metricRPCProviderTimeouts.WithLabelValues("Server1", timeoutSourceHealthCheck)))
+}
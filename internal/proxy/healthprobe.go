@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
+)
+
+// The keys of the data collected by the default probes.
+const (
+	// HealthContextBlockNumber is the latest block reported by the node, or
+	// the height extracted by the configured probes, as a uint64.
+	HealthContextBlockNumber = "blockNumber"
+	// HealthContextGasLimit is the gas limit received from the GasLeft.sol
+	// contract call, as a uint64.
+	HealthContextGasLimit = "gasLimit"
+	// HealthContextBlockTimestamp is the timestamp of the latest block, as a
+	// time.Time.
+	HealthContextBlockTimestamp = "blockTimestamp"
+)
+
+// HealthContext is the data collected about a node by the probes, by key.
+// It tells more about the node than its health, e.g. how far behind the
+// others it is.
+type HealthContext map[string]interface{}
+
+// Uint64 returns the value of key, zero when it's missing or of another
+// type.
+func (c HealthContext) Uint64(key string) uint64 {
+	v, _ := c[key].(uint64)
+
+	return v
+}
+
+// Time returns the value of key, the zero time when it's missing or of
+// another type.
+func (c HealthContext) Time(key string) time.Time {
+	v, _ := c[key].(time.Time)
+
+	return v
+}
+
+// ProbeVerdict is what a probe makes of the health of a node.
+type ProbeVerdict int
+
+const (
+	// ProbeVerdictNone is given by the probes only collecting data, whose
+	// failures don't affect the health of the node.
+	ProbeVerdictNone ProbeVerdict = iota
+	// ProbeVerdictHealthy is given by a probe that succeeded.
+	ProbeVerdictHealthy
+	// ProbeVerdictUnhealthy makes the whole check fail.
+	ProbeVerdictUnhealthy
+)
+
+// Probe is a step of a health check. The probes of a check run
+// concurrently, and the node is healthy unless one of them gives an
+// unhealthy verdict.
+type Probe interface {
+	// Name identifies the probe in the logs and the metrics, e.g.
+	// "eth_blockNumber".
+	Name() string
+
+	// Probe returns the data collected, if any, even when it fails, e.g.
+	// the timestamp of a block too old.
+	Probe(c context.Context) (HealthContext, ProbeVerdict, error)
+}
+
+// probeFunc is a Probe running a function.
+type probeFunc struct {
+	name  string
+	probe func(c context.Context) (HealthContext, ProbeVerdict, error)
+}
+
+func (p probeFunc) Name() string {
+	return p.name
+}
+
+func (p probeFunc) Probe(c context.Context) (HealthContext, ProbeVerdict, error) {
+	return p.probe(c)
+}
+
+// verdict is unhealthy when err isn't nil, healthy otherwise.
+func verdict(err error) ProbeVerdict {
+	if err != nil {
+		return ProbeVerdictUnhealthy
+	}
+
+	return ProbeVerdictHealthy
+}
+
+// defaultProbes returns the probes of the configured mode, followed by the
+// extra ones:
+// - `eth_blockNumber`, only collecting the block number
+// - `eth_call`, failing when the gas limit can't be fetched
+// - `eth_getBlockByNumber`, failing on a stale latest block, when enabled
+// The configured JSON-RPC probes replace these three.
+// - `http`, failing on an unexpected response, in the "http" and "both"
+// modes
+func (h *HealthChecker) defaultProbes() []Probe {
+	var probes []Probe
+
+	if h.config.Mode != HealthCheckModeHTTP {
+		if len(h.config.Probes) > 0 {
+			for _, probe := range h.config.Probes {
+				probes = append(probes, h.configuredProbe(probe))
+			}
+		} else {
+			probes = append(probes, probeFunc{name: "eth_blockNumber", probe: h.probeBlockNumber})
+			probes = append(probes, probeFunc{name: "eth_call", probe: h.probeGasLimit})
+
+			if h.config.MaxBlockAge > 0 {
+				probes = append(probes, probeFunc{name: "eth_getBlockByNumber", probe: h.probeBlockTimestamp})
+			}
+		}
+	}
+
+	if h.config.Mode == HealthCheckModeHTTP || h.config.Mode == HealthCheckModeBoth {
+		probes = append(probes, probeFunc{name: "http", probe: func(c context.Context) (HealthContext, ProbeVerdict, error) {
+			err := h.checkHTTP(c)
+
+			return nil, verdict(err), err
+		}})
+	}
+
+	return append(probes, h.config.ExtraProbes...)
+}
+
+func (h *HealthChecker) probeBlockNumber(c context.Context) (HealthContext, ProbeVerdict, error) {
+	// The block number doesn't tell whether the node is healthy, it's used
+	// to evaluate the node against the others.
+	//
+	blockNumber, err := h.checkBlockNumber(c)
+	if err != nil {
+		return nil, ProbeVerdictNone, err
+	}
+
+	return HealthContext{HealthContextBlockNumber: blockNumber}, ProbeVerdictNone, nil
+}
+
+func (h *HealthChecker) probeGasLimit(c context.Context) (HealthContext, ProbeVerdict, error) {
+	gasLimit, err := h.checkGasLimit(c)
+	if err != nil {
+		return nil, ProbeVerdictUnhealthy, err
+	}
+
+	return HealthContext{HealthContextGasLimit: gasLimit}, ProbeVerdictHealthy, nil
+}
+
+func (h *HealthChecker) probeBlockTimestamp(c context.Context) (HealthContext, ProbeVerdict, error) {
+	timestamp, err := h.checkBlockTimestamp(c)
+	if timestamp.IsZero() {
+		return nil, verdict(err), err
+	}
+
+	return HealthContext{HealthContextBlockTimestamp: timestamp}, verdict(err), err
+}
+
+// configuredProbe returns the Probe of a configured JSON-RPC probe, only
+// failing the check when it's required.
+func (h *HealthChecker) configuredProbe(probe HealthCheckProbe) Probe {
+	return probeFunc{name: probe.Method, probe: func(c context.Context) (HealthContext, ProbeVerdict, error) {
+		height, err := h.runProbe(c, probe)
+
+		switch {
+		case err != nil && probe.Required:
+			return nil, ProbeVerdictUnhealthy, err
+		case err != nil:
+			return nil, ProbeVerdictNone, err
+		case height == 0:
+			return nil, ProbeVerdictHealthy, nil
+		default:
+			return HealthContext{HealthContextBlockNumber: height}, ProbeVerdictHealthy, nil
+		}
+	}}
+}
+
+// runPipeline runs every probe concurrently. The data collected is merged,
+// the first probe reporting a key, in order, winning. The error gathers the
+// ones of the probes giving an unhealthy verdict.
+func (h *HealthChecker) runPipeline(c context.Context, probes []Probe) (HealthContext, error) {
+	var (
+		data     = make([]HealthContext, len(probes))
+		verdicts = make([]ProbeVerdict, len(probes))
+		errs     = make([]error, len(probes))
+		wg       sync.WaitGroup
+	)
+
+	for i, probe := range probes {
+		wg.Add(1)
+
+		go func(i int, probe Probe) {
+			defer wg.Done()
+
+			start := time.Now()
+			data[i], verdicts[i], errs[i] = probe.Probe(c)
+			h.observeProbe(probe.Name(), start, errs[i])
+		}(i, probe)
+	}
+
+	wg.Wait()
+
+	var (
+		collected = HealthContext{}
+		err       error
+	)
+
+	for i, probe := range probes {
+		for key, value := range data[i] {
+			if _, ok := collected[key]; !ok {
+				collected[key] = value
+			}
+		}
+
+		if errs[i] != nil {
+			h.logger.Error("health check probe failed", "probe", probe.Name(), "error", errs[i])
+
+			if e := classifyTransportError(errs[i]); e.IsTLS() {
+				logTransportError(h.logger.With("probe", probe.Name()), "health check probe failed", e)
+			}
+		}
+
+		if verdicts[i] == ProbeVerdictUnhealthy {
+			if errs[i] == nil {
+				errs[i] = errors.Errorf("probe %q found the node unhealthy", probe.Name())
+			}
+
+			err = multierror.Append(err, errs[i])
+		}
+	}
+
+	return collected, err
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testProbe is a Probe returning the same outcome every time, unless it's
+// changed.
+type testProbe struct {
+	name    string
+	data    HealthContext
+	verdict ProbeVerdict
+	err     error
+}
+
+func (p *testProbe) Name() string {
+	return p.name
+}
+
+func (p *testProbe) Probe(c context.Context) (HealthContext, ProbeVerdict, error) {
+	return p.data, p.verdict, p.err
+}
+
+func newProbeTestHealthChecker(t *testing.T, probes ...Probe) *HealthChecker {
+	t.Helper()
+
+	node := newFakeNode(t)
+	t.Cleanup(node.Close)
+
+	hc, err := NewHealthChecker(HealthCheckerConfig{
+		URL:         node.URL,
+		Timeout:     time.Second,
+		Logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ExtraProbes: probes,
+	})
+	require.NoError(t, err)
+
+	t.Cleanup(func() { hc.Stop(context.Background()) }) // nolint:errcheck
+
+	return hc
+}
+
+func TestHealthCheckerRunsExtraProbes(t *testing.T) {
+	syncing := &testProbe{name: "eth_syncing", data: HealthContext{"syncing": false}, verdict: ProbeVerdictHealthy}
+	chainID := &testProbe{name: "eth_chainId", data: HealthContext{"chainId": uint64(1)}}
+
+	hc := newProbeTestHealthChecker(t, syncing, chainID)
+
+	hc.CheckAndSetHealth(context.Background())
+
+	assert.True(t, hc.IsHealthy())
+	assert.Equal(t, uint64(0x10), hc.BlockNumber())
+	assert.Equal(t, uint64(0x3b9ac9ff), hc.GasLimit())
+	assert.Equal(t, false, hc.Context()["syncing"])
+	assert.Equal(t, uint64(1), hc.Context().Uint64("chainId"))
+
+	syncing.data, syncing.verdict, syncing.err = HealthContext{"syncing": true}, ProbeVerdictUnhealthy, errors.New("syncing")
+	hc.CheckAndSetHealth(context.Background())
+
+	assert.False(t, hc.IsHealthy())
+	assert.Equal(t, true, hc.Context()["syncing"])
+
+	_, err := hc.LastCheck()
+	assert.ErrorContains(t, err, "syncing")
+}
+
+func TestHealthCheckerKeepsDataOfFailingProbes(t *testing.T) {
+	chainID := &testProbe{name: "eth_chainId", data: HealthContext{"chainId": uint64(1)}}
+
+	hc := newProbeTestHealthChecker(t, chainID)
+	hc.CheckAndSetHealth(context.Background())
+
+	// A probe only collecting data doesn't affect the health of the node
+	// when it fails, and its previous data is kept.
+	//
+	chainID.data, chainID.err = nil, errors.New("timeout")
+	hc.CheckAndSetHealth(context.Background())
+
+	assert.True(t, hc.IsHealthy())
+	assert.Equal(t, uint64(1), hc.Context().Uint64("chainId"))
+}
+
+func TestHealthCheckerUnhealthyVerdictWithoutError(t *testing.T) {
+	hc := newProbeTestHealthChecker(t, &testProbe{name: "custom", verdict: ProbeVerdictUnhealthy})
+
+	_, err := hc.Check(context.Background())
+	assert.ErrorContains(t, err, `probe "custom" found the node unhealthy`)
+}
+
+func TestHealthCheckerFirstProbeReportingAKeyWins(t *testing.T) {
+	hc := newProbeTestHealthChecker(t,
+		&testProbe{name: "first", data: HealthContext{HealthContextBlockNumber: uint64(1)}},
+		&testProbe{name: "second", data: HealthContext{HealthContextBlockNumber: uint64(2)}})
+
+	// The built-in eth_blockNumber probe runs before the extra ones.
+	//
+	result, err := hc.Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0x10), result.BlockNumber)
+
+	hc.probes = hc.probes[len(hc.probes)-2:]
+
+	result, err = hc.Check(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), result.BlockNumber)
+}
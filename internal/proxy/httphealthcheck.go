@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+const (
+	// HealthCheckModeJSONRPC health checks a target with JSON-RPC calls.
+	HealthCheckModeJSONRPC = "jsonrpc"
+	// HealthCheckModeHTTP health checks a target with a plain HTTP request,
+	// without any JSON-RPC call. The target reports no block number then.
+	HealthCheckModeHTTP = "http"
+	// HealthCheckModeBoth requires both checks to succeed.
+	HealthCheckModeBoth = "both"
+
+	// DefaultHTTPHealthCheckPath is requested when no path is configured.
+	DefaultHTTPHealthCheckPath = "/health"
+
+	// maxHTTPHealthCheckBody bounds how much of the response is searched.
+	maxHTTPHealthCheckBody = 64 << 10
+)
+
+// NodeProviderHealthCheckConfig selects how a target is health checked.
+type NodeProviderHealthCheckConfig struct {
+	// Mode is either "jsonrpc" (default), "http" or "both".
+	Mode string `yaml:"mode"`
+
+	HTTP HTTPHealthCheckConfig `yaml:"http"`
+
+	// Write checks whether the target accepts transactions, on top of the
+	// checks above.
+	Write WriteHealthCheckConfig `yaml:"write"`
+
+	// Interval replaces healthChecks.interval for the target.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// interval returns the interval of the checks of the target, defaultInterval
+// unless overridden.
+func (c NodeProviderHealthCheckConfig) interval(defaultInterval time.Duration) time.Duration {
+	if c.Interval > 0 {
+		return c.Interval
+	}
+
+	return defaultInterval
+}
+
+// HTTPHealthCheckConfig configures a plain HTTP health check, e.g. against a
+// `GET /health` endpoint exposed next to the RPC port.
+type HTTPHealthCheckConfig struct {
+	// Path is requested on the target host. Defaults to "/health".
+	Path string `yaml:"path"`
+
+	// ExpectedStatus is the status code of a healthy target. Defaults to
+	// 200.
+	ExpectedStatus int `yaml:"expectedStatus"`
+
+	// BodyContains, when set, has to be found in the response body.
+	BodyContains string `yaml:"bodyContains"`
+}
+
+func validateHealthCheckMode(mode string) error {
+	switch mode {
+	case "",
+		HealthCheckModeJSONRPC,
+		HealthCheckModeHTTP,
+		HealthCheckModeBoth:
+		return nil
+	default:
+		return errors.Errorf("unknown healthCheck mode %q", mode)
+	}
+}
+
+// checkHTTP requests the configured path of the target host.
+func (h *HealthChecker) checkHTTP(c context.Context) error {
+	target, err := url.Parse(h.config.URL)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse url")
+	}
+
+	target.Path = h.config.HTTP.Path
+	if target.Path == "" {
+		target.Path = DefaultHTTPHealthCheckPath
+	}
+
+	target.RawQuery = ""
+
+	r, err := http.NewRequestWithContext(c, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot create request")
+	}
+
+	r.Header.Set(headers.UserAgent, h.config.UserAgent)
+
+	resp, err := h.httpClient.Do(r)
+	if err != nil {
+		return errors.Wrap(err, "http health check failed")
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPHealthCheckBody))
+	if err != nil {
+		return errors.Wrap(err, "cannot read http health check response")
+	}
+
+	expectedStatus := h.config.HTTP.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = http.StatusOK
+	}
+
+	if resp.StatusCode != expectedStatus {
+		return errors.Errorf("http health check returned %d, expected %d", resp.StatusCode, expectedStatus)
+	}
+
+	if !strings.Contains(string(body), h.config.HTTP.BodyContains) {
+		return errors.Errorf("http health check response doesn't contain %q", h.config.HTTP.BodyContains)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPHealthCheck(t *testing.T) {
+	var (
+		status      atomic.Int64
+		body        atomic.Value
+		rpcRequests atomic.Int64
+	)
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status" {
+			rpcRequests.Add(1)
+
+			return
+		}
+
+		assert.Equal(t, http.MethodGet, r.Method)
+
+		w.WriteHeader(int(status.Load()))
+		w.Write([]byte(body.Load().(string)))
+	}))
+	defer node.Close()
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:     node.URL + "/rpc?key=secret",
+		Timeout: time.Second,
+		Mode:    HealthCheckModeHTTP,
+		HTTP: HTTPHealthCheckConfig{
+			Path:         "/status",
+			BodyContains: `"synced":true`,
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, err)
+
+	defer healthchecker.Stop(context.Background())
+
+	for _, tc := range []struct {
+		name    string
+		status  int
+		body    string
+		healthy bool
+	}{
+		{name: "success", status: http.StatusOK, body: `{"synced":true}`, healthy: true},
+		{name: "status mismatch", status: http.StatusServiceUnavailable, body: `{"synced":true}`, healthy: false},
+		{name: "body mismatch", status: http.StatusOK, body: `{"synced":false}`, healthy: false},
+	} {
+		status.Store(int64(tc.status))
+		body.Store(tc.body)
+
+		healthchecker.CheckAndSetHealth(context.Background())
+
+		assert.Equal(t, tc.healthy, healthchecker.IsHealthy(), tc.name)
+		assert.Zero(t, healthchecker.BlockNumber(), tc.name)
+	}
+
+	assert.Zero(t, rpcRequests.Load())
+}
+
+func TestHealthCheckManagerRejectsUnknownHealthCheckMode(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	_, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name:        "Server1",
+				HealthCheck: NodeProviderHealthCheckConfig{Mode: "tcp"},
+			},
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	assert.ErrorContains(t, err, `unknown healthCheck mode "tcp"`)
+}
@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+// GETRequestParam is the query parameter holding the base64 encoded
+// JSON-RPC request of GET requests.
+const GETRequestParam = "request"
+
+// stateChangingMethodPrefixes are refused over GET, which is meant for
+// read-only calls only.
+//
+//nolint:gochecknoglobals
+var stateChangingMethodPrefixes = []string{
+	"eth_send",
+	"eth_sign",
+	"personal_",
+	"admin_",
+	"miner_",
+}
+
+// allowedMethods returns the value of the Allow header.
+func (p *Proxy) allowedMethods() string {
+	if p.allowGet {
+		return strings.Join([]string{http.MethodPost, http.MethodGet, http.MethodOptions}, ", ")
+	}
+
+	return strings.Join([]string{http.MethodPost, http.MethodOptions}, ", ")
+}
+
+// acceptHTTPMethod answers the requests that aren't JSON-RPC calls and turns
+// GET calls into POST ones. It returns nil when r has been answered.
+func (p *Proxy) acceptHTTPMethod(w http.ResponseWriter, r *http.Request) *http.Request {
+	switch {
+	case r.Method == http.MethodPost:
+		return r
+	case r.Method == http.MethodGet && isWebSocketUpgrade(r):
+		// Upgrades are left to the reverse proxy of the target.
+		//
+		return r
+	case r.Method == http.MethodOptions:
+		w.Header().Set(headers.Allow, p.allowedMethods())
+		w.WriteHeader(http.StatusNoContent)
+
+		return nil
+	case r.Method == http.MethodGet && p.allowGet:
+		post, err := newPOSTFromGET(r)
+		if err != nil {
+			p.writeError(w, r, middleware.GatewayError{
+				StatusCode: http.StatusBadRequest,
+				Code:       middleware.JSONRPCErrorInvalidRequest,
+				Message:    err.Error(),
+				Reason:     "invalid_get_request",
+			})
+
+			return nil
+		}
+
+		return post
+	default:
+		w.Header().Set(headers.Allow, p.allowedMethods())
+
+		p.writeError(w, r, middleware.GatewayError{
+			StatusCode: http.StatusMethodNotAllowed,
+			Code:       middleware.JSONRPCErrorInvalidRequest,
+			Message:    "method " + r.Method + " not allowed, JSON-RPC requests are sent with POST",
+			Reason:     "method_not_allowed",
+		})
+
+		return nil
+	}
+}
+
+// newPOSTFromGET returns the POST request equivalent to a GET one carrying
+// its JSON-RPC request in the query.
+func newPOSTFromGET(r *http.Request) (*http.Request, error) {
+	query := r.URL.Query()
+
+	encoded := query.Get(GETRequestParam)
+	if encoded == "" {
+		return nil, errors.Errorf("missing %q query parameter", GETRequestParam)
+	}
+
+	body, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, errors.Errorf("%q is not base64 encoded", GETRequestParam)
+	}
+
+	requests, err := parseJSONRPCRequests(body)
+	if err != nil {
+		return nil, errors.Errorf("%q is not a JSON-RPC request", GETRequestParam)
+	}
+
+	for _, request := range requests {
+		if isStateChangingMethod(request.Method) {
+			return nil, errors.Errorf("method %q is not allowed with GET", request.Method)
+		}
+	}
+
+	// The parameter isn't forwarded to the targets.
+	//
+	query.Del(GETRequestParam)
+
+	post := r.Clone(r.Context())
+	post.Method = http.MethodPost
+	post.URL.RawQuery = query.Encode()
+	post.Body = io.NopCloser(bytes.NewReader(body))
+	post.ContentLength = int64(len(body))
+	post.Header.Set(headers.ContentType, "application/json")
+
+	return post, nil
+}
+
+// decodeBase64 accepts both the standard and the URL-safe alphabets, padded
+// or not.
+func decodeBase64(s string) ([]byte, error) {
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.URLEncoding,
+		base64.RawStdEncoding,
+		base64.RawURLEncoding,
+	} {
+		if decoded, err := encoding.DecodeString(s); err == nil {
+			return decoded, nil
+		}
+	}
+
+	return nil, errors.New("invalid base64")
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get(headers.Upgrade), "websocket")
+}
+
+func isStateChangingMethod(method string) bool {
+	for _, prefix := range stateChangingMethodPrefixes {
+		if strings.HasPrefix(method, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
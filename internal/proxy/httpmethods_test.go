@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHTTPMethodsProxy(t *testing.T, allowGet bool, upstreamCalls *atomic.Int64) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls.Add(1)
+
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Empty(t, r.URL.Query().Get(GETRequestParam))
+
+		body, _ := io.ReadAll(r.Body)
+
+		var req JSONRPCRequest
+		assert.NoError(t, json.Unmarshal(body, &req))
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + req.Method + `"}`))
+	}))
+	t.Cleanup(node.Close)
+
+	config := createConfig()
+	config.Proxy.AllowGet = allowGet
+	config.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: node.URL,
+				},
+			},
+		},
+	}
+
+	return newTestFailoverProxy(t, config)
+}
+
+func TestHttpFailoverProxyRejectsUnsupportedMethods(t *testing.T) {
+	var upstreamCalls atomic.Int64
+
+	p := newTestHTTPMethodsProxy(t, false, &upstreamCalls)
+
+	for _, method := range []string{http.MethodGet, http.MethodPut, http.MethodDelete} {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(method, "/", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, method)
+		assert.Equal(t, "POST, OPTIONS", rec.Header().Get("Allow"), method)
+		assert.JSONEq(t, `{
+			"jsonrpc": "2.0",
+			"id": null,
+			"error": {"code": -32600, "message": "method `+method+` not allowed, JSON-RPC requests are sent with POST"},
+			"gateway": {"reason": "method_not_allowed", "attempts": 0, "providers": 0}
+		}`, rec.Body.String(), method)
+	}
+
+	assert.Zero(t, upstreamCalls.Load())
+}
+
+func TestHttpFailoverProxyAnswersOptions(t *testing.T) {
+	var upstreamCalls atomic.Int64
+
+	p := newTestHTTPMethodsProxy(t, true, &upstreamCalls)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/", nil))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "POST, GET, OPTIONS", rec.Header().Get("Allow"))
+	assert.Empty(t, rec.Body.String())
+	assert.Zero(t, upstreamCalls.Load())
+}
+
+func TestHttpFailoverProxyServesGETRequests(t *testing.T) {
+	var upstreamCalls atomic.Int64
+
+	p := newTestHTTPMethodsProxy(t, true, &upstreamCalls)
+
+	get := func(request string, encoding *base64.Encoding) *httptest.ResponseRecorder {
+		target := "/?" + url.Values{GETRequestParam: {encoding.EncodeToString([]byte(request))}}.Encode()
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return rec
+	}
+
+	rec := get(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`, base64.StdEncoding)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"eth_blockNumber"}`, rec.Body.String())
+
+	rec = get(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`, base64.RawURLEncoding)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"eth_chainId"}`, rec.Body.String())
+
+	assert.Equal(t, int64(2), upstreamCalls.Load())
+
+	rec = get(`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x00"]}`, base64.StdEncoding)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `method \"eth_sendRawTransaction\" is not allowed with GET`)
+
+	rec = get(`not json`, base64.StdEncoding)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `"invalid_get_request"`)
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), `missing \"request\" query parameter`)
+
+	assert.Equal(t, int64(2), upstreamCalls.Load())
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", bytes.NewBufferString(`{}`)))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "POST, GET, OPTIONS", rec.Header().Get("Allow"))
+}
@@ -0,0 +1,557 @@
+package proxy
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+// ErrImmutableCacheDisabled is returned when the immutable cache is flushed
+// while it isn't enabled.
+var ErrImmutableCacheDisabled = errors.New("immutable cache is disabled")
+
+// DefaultImmutableCacheMaxBytes bounds the results held by the immutable
+// cache when no maxBytes is configured.
+const DefaultImmutableCacheMaxBytes = 64 << 20
+
+// DefaultImmutableCacheConfirmations is how many blocks a transaction must
+// be buried under before it's cached, when no confirmations are configured.
+const DefaultImmutableCacheConfirmations = 12
+
+// maxRemoteCacheWrites is the number of writes to the remote cache in
+// flight, past which results are only kept in memory.
+const maxRemoteCacheWrites = 64
+
+// immutableMethods maps the methods whose results never change once final to
+// the fields of the result that are null until then.
+//
+//nolint:gochecknoglobals
+var immutableMethods = map[string][]string{
+	"eth_getBlockByHash":        {"hash", "number"},
+	"eth_getTransactionByHash":  {"blockHash", "blockNumber"},
+	"eth_getTransactionReceipt": {"blockHash", "blockNumber"},
+}
+
+// confirmedMethods are the immutable methods whose results tell the block a
+// transaction was mined in, which changes when the block is reorged. They're
+// only cached once the block is confirmed.
+//
+//nolint:gochecknoglobals
+var confirmedMethods = map[string]bool{
+	"eth_getTransactionByHash":  true,
+	"eth_getTransactionReceipt": true,
+}
+
+// ImmutableCacheConfig caches the responses of the methods looked up by hash,
+// whose results can't change once the block or transaction is mined.
+type ImmutableCacheConfig struct {
+	// MaxEntries is the number of results kept, the least recently used
+	// ones being evicted first. Zero disables the cache.
+	MaxEntries int `yaml:"maxEntries"`
+
+	// MaxBytes bounds the total size of the results kept. Defaults to
+	// 64MiB.
+	MaxBytes int64 `yaml:"maxBytes"`
+
+	// Confirmations is how many blocks the highest block number observed by
+	// the health checks must be past the block of a transaction or receipt
+	// before it's cached, so reorged results aren't kept. They're never
+	// cached while the highest block number is unknown. Defaults to 12.
+	Confirmations uint64 `yaml:"confirmations"`
+
+	// NotFound caches the null results of polled methods for a short time,
+	// in the same LRU.
+	NotFound NotFoundCacheConfig `yaml:"notFound"`
+}
+
+func (c ImmutableCacheConfig) enabled() bool {
+	return c.MaxEntries > 0
+}
+
+func (c ImmutableCacheConfig) validate() error {
+	if c.MaxEntries < 0 {
+		return errors.New("immutable cache max entries can't be negative")
+	}
+
+	if c.MaxBytes < 0 {
+		return errors.New("immutable cache max bytes can't be negative")
+	}
+
+	return c.NotFound.validate()
+}
+
+func (c ImmutableCacheConfig) confirmations() uint64 {
+	if c.Confirmations == 0 {
+		return DefaultImmutableCacheConfirmations
+	}
+
+	return c.Confirmations
+}
+
+func (c ImmutableCacheConfig) maxBytes() int64 {
+	if c.MaxBytes == 0 {
+		return DefaultImmutableCacheMaxBytes
+	}
+
+	return c.MaxBytes
+}
+
+type memoryCacheEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// memoryCache is an LRU bounded by entries and bytes. It's the cache local
+// to the replica.
+type memoryCache struct {
+	mu         sync.Mutex
+	clock      Clock
+	maxEntries int
+	maxBytes   int64
+	size       int64
+	entries    map[string]*list.Element
+	lru        *list.List
+}
+
+func newMemoryCache(maxEntries int, maxBytes int64, clock Clock) *memoryCache {
+	return &memoryCache{
+		clock:      clock,
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+	}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := element.Value.(*memoryCacheEntry)
+
+	if !entry.expires.IsZero() && !c.clock.Now().Before(entry.expires) {
+		c.remove(element)
+
+		return nil, false, nil
+	}
+
+	c.lru.MoveToFront(element)
+
+	return entry.value, true, nil
+}
+
+// Set stores value under key, for ttl when it's positive.
+func (c *memoryCache) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	size := int64(len(key) + len(value))
+	if size > c.maxBytes {
+		return nil
+	}
+
+	entry := &memoryCacheEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = c.clock.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.size += size
+
+	for c.lru.Len() > c.maxEntries || c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+
+	return nil
+}
+
+func (c *memoryCache) Flush(_ context.Context, method string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	flushed := 0
+
+	for key, element := range c.entries {
+		if method == "" || cacheKeyMethod(key) == method {
+			c.remove(element)
+			flushed++
+		}
+	}
+
+	return flushed, nil
+}
+
+func (c *memoryCache) Close() error {
+	return nil
+}
+
+func (c *memoryCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*memoryCacheEntry)
+
+	delete(c.entries, entry.key)
+	c.size -= int64(len(entry.key) + len(entry.value))
+}
+
+// immutableCache keeps final results in the memory of the replica and, when
+// configured, in a backend shared by all the replicas. The null results kept
+// by the not found cache are only kept in memory.
+type immutableCache struct {
+	local    cacheBackend
+	remote   cacheBackend
+	notFound notFoundCache
+
+	// confirmations is how many blocks past the block of a transaction the
+	// head must be before it's cached.
+	confirmations uint64
+
+	// writes bounds the writes to the remote cache in flight, and pending
+	// tracks them. No write starts once closed is set.
+	writes   chan struct{}
+	pending  sync.WaitGroup
+	closed   bool
+	closedMu sync.Mutex
+}
+
+func newImmutableCache(config ImmutableCacheConfig, backend CacheBackendConfig, clock Clock) *immutableCache {
+	if !config.enabled() {
+		return nil
+	}
+
+	c := &immutableCache{
+		local:         newMemoryCache(config.MaxEntries, config.maxBytes(), clock),
+		notFound:      newNotFoundCache(config.NotFound),
+		confirmations: config.confirmations(),
+	}
+
+	if backend.Redis.enabled() {
+		c.remote = newRedisCache(backend.Redis)
+		c.writes = make(chan struct{}, maxRemoteCacheWrites)
+	}
+
+	return c
+}
+
+// cacheKey returns the key of requests, false when they can't be cached.
+// Only single requests are.
+func cacheKey(requests []JSONRPCRequest) (string, bool) {
+	if len(requests) != 1 || requests[0].IsNotification() {
+		return "", false
+	}
+
+	var params bytes.Buffer
+	if len(requests[0].Params) > 0 {
+		if err := json.Compact(&params, requests[0].Params); err != nil {
+			return "", false
+		}
+	}
+
+	return requests[0].Method + " " + params.String(), true
+}
+
+// cacheKeyMethod returns the method of a key of the immutable or the not
+// found cache.
+func cacheKeyMethod(key string) string {
+	if rest, ok := strings.CutPrefix(key, "notfound "); ok {
+		_, key, _ = strings.Cut(rest, " ")
+	}
+
+	method, _, _ := strings.Cut(key, " ")
+
+	return method
+}
+
+// get returns the result cached under key and the cache it's been found in,
+// "local" or "remote". An error of the remote cache is returned along with
+// a miss.
+func (c *immutableCache) get(ctx context.Context, key string) (json.RawMessage, string, error) {
+	if result, ok, _ := c.local.Get(ctx, key); ok {
+		return result, "local", nil
+	}
+
+	if c.remote == nil {
+		return nil, "", nil
+	}
+
+	result, ok, err := c.remote.Get(ctx, key)
+	if err != nil || !ok {
+		return nil, "", err
+	}
+
+	c.local.Set(ctx, key, result, 0) // nolint:errcheck
+
+	return result, "remote", nil
+}
+
+// add caches result under key, in the remote cache too when configured.
+// The remote cache is written in the background, so the response doesn't
+// wait for it, and failed is called if it fails. The write is skipped when
+// too many are in flight already, or once the cache is closed.
+func (c *immutableCache) add(ctx context.Context, key string, result json.RawMessage, failed func()) {
+	c.local.Set(ctx, key, result, 0) // nolint:errcheck
+
+	if c.remote == nil {
+		return
+	}
+
+	c.closedMu.Lock()
+	defer c.closedMu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	select {
+	case c.writes <- struct{}{}:
+	default:
+		return
+	}
+
+	c.pending.Add(1)
+
+	go func() {
+		defer c.pending.Done()
+		defer func() { <-c.writes }()
+
+		if err := c.remote.Set(context.WithoutCancel(ctx), key, result, 0); err != nil {
+			failed()
+		}
+	}()
+}
+
+// CacheFlush is what a flush of the immutable cache dropped.
+type CacheFlush struct {
+	// Method is the method flushed, empty when every one is.
+	Method string `json:"method,omitempty"`
+	// Local is the number of results dropped from the memory of the replica,
+	// the not found ones included, and Remote from the shared backend.
+	Local  int `json:"local"`
+	Remote int `json:"remote"`
+	// RemoteError is why the shared backend could not be flushed, it may
+	// have been partly.
+	RemoteError string `json:"remoteError,omitempty"`
+}
+
+// FlushCache drops the results of method from the immutable cache, every
+// result when it's empty. Other replicas keep the results in their memory.
+func (p *Proxy) FlushCache(ctx context.Context, method string) (CacheFlush, error) {
+	c := p.immutableCache
+	if c == nil {
+		return CacheFlush{}, ErrImmutableCacheDisabled
+	}
+
+	flush := CacheFlush{Method: method}
+	flush.Local, _ = c.local.Flush(ctx, method)
+
+	if c.remote != nil {
+		var err error
+
+		if flush.Remote, err = c.remote.Flush(ctx, method); err != nil {
+			flush.RemoteError = err.Error()
+		}
+	}
+
+	p.logger.Info("immutable cache flushed", "method", method, "local", flush.Local, "remote", flush.Remote)
+
+	return flush, nil
+}
+
+func (c *immutableCache) Close() error {
+	if c == nil || c.remote == nil {
+		return nil
+	}
+
+	c.closedMu.Lock()
+	c.closed = true
+	c.closedMu.Unlock()
+
+	c.pending.Wait()
+
+	return c.remote.Close()
+}
+
+// responseResult returns the result of a successful JSON-RPC response held
+// by pw, false for errors.
+func responseResult(pw *ReponseWriter) (json.RawMessage, bool) {
+	if pw.statusCode != http.StatusOK || pw.Header().Get(headers.ContentEncoding) != "" {
+		return nil, false
+	}
+
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  json.RawMessage `json:"error"`
+	}
+
+	if err := json.Unmarshal(pw.body.Bytes(), &response); err != nil {
+		return nil, false
+	}
+
+	if len(response.Error) > 0 || len(response.Result) == 0 {
+		return nil, false
+	}
+
+	return response.Result, true
+}
+
+// finalResult returns the result of a response to method, false unless it's
+// successful and final, e.g. a receipt of a mined transaction.
+func finalResult(method string, pw *ReponseWriter) (json.RawMessage, bool) {
+	result, ok := responseResult(pw)
+	if !ok {
+		return nil, false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil || fields == nil {
+		return nil, false
+	}
+
+	for _, field := range immutableMethods[method] {
+		if value := fields[field]; len(value) == 0 || bytes.Equal(value, []byte("null")) {
+			return nil, false
+		}
+	}
+
+	return bytes.Clone(result), true
+}
+
+// confirmed reports whether the final result of method can be cached at
+// head, i.e. the block it names is confirmed when the method needs it.
+func (c *immutableCache) confirmed(method string, result json.RawMessage, head uint64) bool {
+	if !confirmedMethods[method] {
+		return true
+	}
+
+	var fields struct {
+		BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	}
+
+	if err := json.Unmarshal(result, &fields); err != nil {
+		return false
+	}
+
+	return head >= uint64(fields.BlockNumber)+c.confirmations
+}
+
+// serveCached answers requests from the immutable cache. It reports whether
+// a response has been written. Cache errors are counted and make a miss.
+func (p *Proxy) serveCached(w http.ResponseWriter, r *http.Request, requests []JSONRPCRequest) bool {
+	if p.immutableCache == nil {
+		return false
+	}
+
+	key, ok := cacheKey(requests)
+	if !ok {
+		return false
+	}
+
+	method := requests[0].Method
+
+	var (
+		result json.RawMessage
+		source string
+		err    error
+	)
+
+	_, immutable := immutableMethods[method]
+	notFound := p.immutableCache.notFound.applies(method)
+
+	if !immutable && !notFound {
+		return false
+	}
+
+	if immutable {
+		result, source, err = p.immutableCache.get(r.Context(), key)
+		if err != nil {
+			p.metricCacheBackendErrors.WithLabelValues("redis", "get").Inc()
+		}
+	}
+
+	if result == nil && notFound && p.immutableCache.getNotFound(r.Context(), key, p.head()) {
+		result, source = json.RawMessage("null"), "negative"
+	}
+
+	if result == nil {
+		p.metricImmutableCache.WithLabelValues(method, "miss").Inc()
+
+		return false
+	}
+
+	p.metricImmutableCache.WithLabelValues(method, source+"_hit").Inc()
+
+	id := requests[0].ID
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	w.Header().Set(headers.ContentType, "application/json")
+
+	// Null results aren't final, only the others are stored downstream.
+	//
+	if p.cacheControl.enabled() {
+		if source == "negative" {
+			w.Header().Set(headers.CacheControl, CacheControlNoStore)
+		} else {
+			w.Header().Set(headers.CacheControl, p.methodCacheControl(requests))
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(jsonRPCResponseEnvelope{ // nolint:errcheck
+		Jsonrpc: "2.0",
+		ID:      id,
+		Result:  result,
+	})
+
+	return true
+}
+
+// cacheResponse keeps the result of the response held by pw when it's final
+// and confirmed, or when it's null and the method's null results are cached.
+func (p *Proxy) cacheResponse(r *http.Request, requests []JSONRPCRequest, pw *ReponseWriter) {
+	if p.immutableCache == nil {
+		return
+	}
+
+	key, ok := cacheKey(requests)
+	if !ok {
+		return
+	}
+
+	method := requests[0].Method
+
+	if _, immutable := immutableMethods[method]; immutable {
+		if result, ok := finalResult(method, pw); ok && p.immutableCache.confirmed(method, result, p.head()) {
+			p.immutableCache.add(r.Context(), key, result, func() {
+				p.metricCacheBackendErrors.WithLabelValues("redis", "set").Inc()
+			})
+
+			return
+		}
+	}
+
+	if p.immutableCache.notFound.applies(method) {
+		if result, ok := responseResult(pw); ok && bytes.Equal(result, []byte("null")) {
+			p.immutableCache.addNotFound(r.Context(), key, p.head())
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	minedReceipt   = `{"transactionHash":"0x01","blockHash":"0xaa","blockNumber":"0x10","status":"0x1"}`
+	pendingTx      = `{"hash":"0x02","blockHash":null,"blockNumber":null}`
+	receiptRequest = `{"jsonrpc":"2.0","id":%s,"method":"eth_getTransactionReceipt","params":["0x01"]}`
+)
+
+func newImmutableCacheTestProxy(t *testing.T, results map[string]string, calls *atomic.Int64) *Proxy {
+	t.Helper()
+
+	return newSharedCacheTestProxy(t, results, calls, CacheBackendConfig{})
+}
+
+func newSharedCacheTestProxy(
+	t *testing.T,
+	results map[string]string,
+	calls *atomic.Int64,
+	backend CacheBackendConfig,
+) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		body, _ := io.ReadAll(r.Body)
+
+		requests, err := parseJSONRPCRequests(body)
+		assert.NoError(t, err)
+
+		responses := make([]string, 0, len(requests))
+
+		for _, request := range requests {
+			result, ok := results[request.Method]
+			if !ok {
+				result = "null"
+			}
+
+			responses = append(responses, `{"jsonrpc":"2.0","id":`+string(request.ID)+`,"result":`+result+`}`)
+		}
+
+		if bytes.HasPrefix(body, []byte("[")) {
+			w.Write([]byte("[" + strings.Join(responses, ",") + "]"))
+
+			return
+		}
+
+		w.Write([]byte(responses[0]))
+	}))
+	t.Cleanup(server.Close)
+
+	config := createConfig()
+	config.Proxy.ImmutableCache = ImmutableCacheConfig{MaxEntries: 10}
+	config.Proxy.CacheBackend = backend
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: server.URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+	t.Cleanup(func() { p.immutableCache.Close() })
+
+	// The mined receipt is confirmed.
+	//
+	setTestHead(t, p, 0x10+DefaultImmutableCacheConfirmations)
+
+	return p
+}
+
+func serveImmutableCacheRequest(p *Proxy, payload string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+
+	p.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestHttpFailoverProxyImmutableCacheHit(t *testing.T) {
+	var calls atomic.Int64
+
+	p := newImmutableCacheTestProxy(t, map[string]string{"eth_getTransactionReceipt": minedReceipt}, &calls)
+
+	rr := serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", "1", 1))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":`+minedReceipt+`}`, rr.Body.String())
+
+	// The hit echoes the id of the request, not the cached one.
+	//
+	rr = serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", `"second"`, 1))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":"second","result":`+minedReceipt+`}`, rr.Body.String())
+
+	assert.Equal(t, int64(1), calls.Load())
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricImmutableCache.WithLabelValues("eth_getTransactionReceipt", "local_hit")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricImmutableCache.WithLabelValues("eth_getTransactionReceipt", "miss")))
+}
+
+func TestHttpFailoverProxyImmutableCacheSkipsPendingResults(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		results map[string]string
+		payload string
+	}{
+		{
+			name:    "pending receipt",
+			payload: strings.Replace(receiptRequest, "%s", "1", 1),
+		},
+		{
+			name:    "pending transaction",
+			results: map[string]string{"eth_getTransactionByHash": pendingTx},
+			payload: `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["0x02"]}`,
+		},
+		{
+			name:    "uncached method",
+			results: map[string]string{"eth_getBlockByNumber": `{"hash":"0xaa","number":"0x10"}`},
+			payload: `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber","params":["latest",false]}`,
+		},
+		{
+			name:    "batch",
+			results: map[string]string{"eth_getTransactionReceipt": minedReceipt},
+			payload: "[" + strings.Replace(receiptRequest, "%s", "1", 1) + "]",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int64
+
+			p := newImmutableCacheTestProxy(t, tc.results, &calls)
+
+			serveImmutableCacheRequest(p, tc.payload)
+			serveImmutableCacheRequest(p, tc.payload)
+
+			assert.Equal(t, int64(2), calls.Load())
+		})
+	}
+}
+
+func TestHttpFailoverProxyImmutableCacheWaitsForConfirmations(t *testing.T) {
+	var calls atomic.Int64
+
+	p := newImmutableCacheTestProxy(t, map[string]string{"eth_getTransactionReceipt": minedReceipt}, &calls)
+	payload := strings.Replace(receiptRequest, "%s", "1", 1)
+
+	// The receipt could still be reorged, it isn't cached.
+	//
+	setTestHead(t, p, 0x10+DefaultImmutableCacheConfirmations-1)
+
+	serveImmutableCacheRequest(p, payload)
+	serveImmutableCacheRequest(p, payload)
+	assert.Equal(t, int64(2), calls.Load())
+
+	setTestHead(t, p, 0x10+DefaultImmutableCacheConfirmations)
+
+	serveImmutableCacheRequest(p, payload)
+	serveImmutableCacheRequest(p, payload)
+	assert.Equal(t, int64(3), calls.Load())
+}
+
+func TestImmutableCacheConfirmed(t *testing.T) {
+	c := newImmutableCache(ImmutableCacheConfig{MaxEntries: 10, Confirmations: 2}, CacheBackendConfig{}, systemClock{})
+
+	assert.False(t, c.confirmed("eth_getTransactionReceipt", json.RawMessage(minedReceipt), 0))
+	assert.False(t, c.confirmed("eth_getTransactionReceipt", json.RawMessage(minedReceipt), 0x11))
+	assert.True(t, c.confirmed("eth_getTransactionReceipt", json.RawMessage(minedReceipt), 0x12))
+	assert.False(t, c.confirmed("eth_getTransactionReceipt", json.RawMessage(`{"blockNumber":"latest"}`), 0x12))
+
+	// Blocks looked up by hash don't depend on the head.
+	//
+	assert.True(t, c.confirmed("eth_getBlockByHash", json.RawMessage(`{"hash":"0xaa","number":"0x10"}`), 0))
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	cache := newMemoryCache(2, 40, systemClock{})
+	ctx := context.Background()
+
+	cache.Set(ctx, "a", []byte(`"1"`), 0)
+	cache.Set(ctx, "b", []byte(`"2"`), 0)
+
+	_, ok, _ := cache.Get(ctx, "a")
+	assert.True(t, ok)
+
+	// "b" is the least recently used.
+	//
+	cache.Set(ctx, "c", []byte(`"3"`), 0)
+
+	_, ok, _ = cache.Get(ctx, "b")
+	assert.False(t, ok)
+
+	// Larger results evict as many entries as needed, and the ones larger
+	// than the cache aren't kept.
+	//
+	cache.Set(ctx, "d", []byte(`"`+strings.Repeat("x", 35)+`"`), 0)
+	assert.Equal(t, 1, cache.lru.Len())
+
+	cache.Set(ctx, "e", []byte(`"`+strings.Repeat("x", 40)+`"`), 0)
+
+	_, ok, _ = cache.Get(ctx, "e")
+	assert.False(t, ok)
+	assert.LessOrEqual(t, cache.size, int64(40))
+}
+
+func TestHttpFailoverProxySharedCache(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	var calls atomic.Int64
+
+	results := map[string]string{"eth_getTransactionReceipt": minedReceipt}
+	backend := CacheBackendConfig{Redis: RedisCacheConfig{Address: server.Addr(), KeyPrefix: "test:"}}
+
+	first := newSharedCacheTestProxy(t, results, &calls, backend)
+	second := newSharedCacheTestProxy(t, results, &calls, backend)
+
+	serveImmutableCacheRequest(first, strings.Replace(receiptRequest, "%s", "1", 1))
+
+	// Redis is written in the background.
+	//
+	assert.Eventually(t, func() bool {
+		return server.Exists(`test:eth_getTransactionReceipt ["0x01"]`)
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, DefaultRedisMaxTTL, server.TTL(`test:eth_getTransactionReceipt ["0x01"]`))
+
+	// The other replica finds the result in Redis, then in its own memory.
+	//
+	for i := 0; i < 2; i++ {
+		rr := serveImmutableCacheRequest(second, strings.Replace(receiptRequest, "%s", "2", 1))
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":`+minedReceipt+`}`, rr.Body.String())
+	}
+
+	assert.Equal(t, int64(1), calls.Load())
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(second.metricImmutableCache.WithLabelValues("eth_getTransactionReceipt", "remote_hit")))
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(second.metricImmutableCache.WithLabelValues("eth_getTransactionReceipt", "local_hit")))
+}
+
+func TestHttpFailoverProxySharedCacheUnreachable(t *testing.T) {
+	server := miniredis.RunT(t)
+	address := server.Addr()
+	server.Close()
+
+	var calls atomic.Int64
+
+	p := newSharedCacheTestProxy(t, map[string]string{"eth_getTransactionReceipt": minedReceipt}, &calls,
+		CacheBackendConfig{Redis: RedisCacheConfig{Address: address, KeyPrefix: "test:"}})
+
+	// Requests are served by the targets, as if there were no shared cache.
+	//
+	rr := serveImmutableCacheRequest(p, `{"jsonrpc":"2.0","id":1,"method":"eth_getTransactionByHash","params":["0x01"]}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":null}`, rr.Body.String())
+
+	rr = serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", "1", 1))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":`+minedReceipt+`}`, rr.Body.String())
+
+	assert.Equal(t, int64(2), calls.Load())
+	assert.Equal(t, 2.0, testutil.ToFloat64(p.metricCacheBackendErrors.WithLabelValues("redis", "get")))
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(p.metricCacheBackendErrors.WithLabelValues("redis", "set")) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestRedisCacheConfigRequiresKeyPrefix(t *testing.T) {
+	assert.Error(t, RedisCacheConfig{Address: "127.0.0.1:6379"}.validate())
+	assert.NoError(t, RedisCacheConfig{Address: "127.0.0.1:6379", KeyPrefix: "mainnet:"}.validate())
+	assert.NoError(t, RedisCacheConfig{}.validate())
+}
+
+func TestImmutableCacheSkipsRemoteWritesOnceClosed(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	cache := newImmutableCache(ImmutableCacheConfig{MaxEntries: 100},
+		CacheBackendConfig{Redis: RedisCacheConfig{Address: server.Addr(), KeyPrefix: "test:"}}, systemClock{})
+
+	// Writes racing with Close are either waited for or skipped.
+	//
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			cache.add(context.Background(), strconv.Itoa(i), json.RawMessage(`"0x1"`), func() {})
+		}(i)
+	}
+
+	require.NoError(t, cache.Close())
+	wg.Wait()
+
+	keys := len(server.Keys())
+
+	cache.add(context.Background(), "late", json.RawMessage(`"0x1"`), func() { t.Error("late write attempted") })
+	assert.Len(t, server.Keys(), keys)
+}
+
+func TestRedisCacheBypassedAfterConsecutiveFailures(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	cache := newRedisCache(RedisCacheConfig{Address: server.Addr(), KeyPrefix: "test:"})
+	defer cache.Close()
+
+	ctx := context.Background()
+
+	require.NoError(t, cache.Set(ctx, "key", []byte("value"), 0))
+
+	server.SetError("unavailable")
+
+	for i := 0; i < redisBreakerThreshold; i++ {
+		_, _, err := cache.Get(ctx, "key")
+		assert.Error(t, err)
+	}
+
+	// Redis isn't tried anymore, the cache misses at once.
+	//
+	server.SetError("")
+
+	value, ok, err := cache.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, value)
+	assert.True(t, cache.bypassed())
+
+	// Once the cooldown is over, a single success closes the breaker.
+	//
+	cache.openUntil.Store(0)
+
+	value, ok, err = cache.Get(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []byte("value"), value)
+	assert.Zero(t, cache.failures.Load())
+}
+
+func TestFlushCache(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.Set("other:eth_getTransactionReceipt []", "kept") // nolint:errcheck
+
+	var calls atomic.Int64
+
+	results := map[string]string{
+		"eth_getTransactionReceipt": minedReceipt,
+		"eth_getBlockByHash":        `{"hash":"0xaa","number":"0x10"}`,
+	}
+
+	p := newSharedCacheTestProxy(t, results, &calls,
+		CacheBackendConfig{Redis: RedisCacheConfig{Address: server.Addr(), KeyPrefix: "test:"}})
+
+	serve := func() {
+		serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", "1", 1))
+		serveImmutableCacheRequest(p, `{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByHash","params":["0xaa",false]}`)
+	}
+
+	serve()
+	serve()
+	assert.Equal(t, int64(2), calls.Load())
+
+	flush, err := p.FlushCache(context.Background(), "eth_getTransactionReceipt")
+	assert.NoError(t, err)
+	assert.Equal(t, CacheFlush{Method: "eth_getTransactionReceipt", Local: 1, Remote: 1}, flush)
+
+	serve()
+	assert.Equal(t, int64(3), calls.Load())
+
+	flush, err = p.FlushCache(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, CacheFlush{Local: 2, Remote: 2}, flush)
+	assert.Equal(t, []string{"other:eth_getTransactionReceipt []"}, server.Keys())
+
+	serve()
+	assert.Equal(t, int64(5), calls.Load())
+
+	// The remote cache fails, the local one is flushed all the same.
+	//
+	server.Close()
+
+	flush, err = p.FlushCache(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flush.Local)
+	assert.NotEmpty(t, flush.RemoteError)
+
+	cache := p.immutableCache
+	p.immutableCache = nil
+
+	_, err = p.FlushCache(context.Background(), "")
+	assert.ErrorIs(t, err, ErrImmutableCacheDisabled)
+
+	p.immutableCache = cache
+}
+
+func TestCacheKeyMethod(t *testing.T) {
+	assert.Equal(t, "eth_getBlockByHash", cacheKeyMethod(`eth_getBlockByHash ["0xaa",false]`))
+	assert.Equal(t, "eth_getTransactionReceipt", cacheKeyMethod(notFoundKey(`eth_getTransactionReceipt ["0x01"]`, 16)))
+	assert.Equal(t, "eth_chainId", cacheKeyMethod("eth_chainId "))
+}
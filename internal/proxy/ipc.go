@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+const (
+	// ipcURL stands for the node in the requests sent over IPC. The
+	// transport ignores it, it only keeps HTTP clients happy.
+	ipcURL = "http://ipc"
+
+	ipcMaxIdleConnections = 16
+)
+
+type NodeProviderConnectionIPCConfig struct {
+	// Path is the unix socket of the node, e.g. geth.ipc.
+	Path string `yaml:"path"`
+}
+
+// ipcConn is a connection to the node. Its decoder is kept along, it may
+// have buffered bytes read from the socket.
+type ipcConn struct {
+	net.Conn
+	decoder *json.Decoder
+}
+
+// ipcTransport speaks JSON-RPC over the unix socket of a node. Requests and
+// responses are plain JSON values streamed over the socket, one response per
+// request, so a connection serves one request at a time.
+type ipcTransport struct {
+	path   string
+	dialer net.Dialer
+
+	mu     sync.Mutex
+	idle   []*ipcConn
+	closed bool
+}
+
+func newIPCTransport(path string) *ipcTransport {
+	return &ipcTransport{
+		path: path,
+	}
+}
+
+func (t *ipcTransport) get(c context.Context) (*ipcConn, error) {
+	t.mu.Lock()
+	if n := len(t.idle); n > 0 {
+		conn := t.idle[n-1]
+		t.idle = t.idle[:n-1]
+		t.mu.Unlock()
+
+		return conn, nil
+	}
+	t.mu.Unlock()
+
+	conn, err := t.dialer.DialContext(c, "unix", t.path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot dial ipc")
+	}
+
+	return &ipcConn{
+		Conn:    conn,
+		decoder: json.NewDecoder(conn),
+	}, nil
+}
+
+func (t *ipcTransport) put(conn *ipcConn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed || len(t.idle) >= ipcMaxIdleConnections {
+		conn.Close()
+
+		return
+	}
+
+	t.idle = append(t.idle, conn)
+}
+
+// Do sends a JSON-RPC payload to the node and returns its response.
+func (t *ipcTransport) Do(c context.Context, payload []byte) (json.RawMessage, error) {
+	conn, err := t.get(c)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline, _ := c.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+
+		return nil, errors.Wrap(err, "cannot set ipc deadline")
+	}
+
+	// Unblocks the reads and writes when the request is canceled.
+	//
+	stop := context.AfterFunc(c, func() {
+		conn.SetDeadline(time.Now()) // nolint:errcheck
+	})
+	defer stop()
+
+	if _, err := conn.Write(payload); err != nil {
+		conn.Close()
+
+		return nil, errors.Wrap(err, "cannot write ipc request")
+	}
+
+	var response json.RawMessage
+
+	if err := conn.decoder.Decode(&response); err != nil {
+		conn.Close()
+
+		return nil, errors.Wrap(err, "cannot read ipc response")
+	}
+
+	// A cancellation that fired meanwhile has set the deadline of the
+	// connection, it can't be reused.
+	//
+	if !stop() {
+		conn.Close()
+
+		return response, nil
+	}
+
+	t.put(conn)
+
+	return response, nil
+}
+
+// RoundTrip implements http.RoundTripper, so HTTP based JSON-RPC clients like
+// the health checks can reach the node over IPC.
+func (t *ipcTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var payload []byte
+
+	if r.Body != nil {
+		var err error
+
+		payload, err = io.ReadAll(r.Body)
+		r.Body.Close()
+
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read request body")
+		}
+	}
+
+	response, err := t.Do(r.Context(), payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			headers.ContentType:   []string{"application/json"},
+			headers.ContentLength: []string{strconv.Itoa(len(response))},
+		},
+		Body:          io.NopCloser(bytes.NewReader(response)),
+		ContentLength: int64(len(response)),
+		Request:       r,
+	}, nil
+}
+
+// CloseIdleConnections closes the connections not serving a request.
+func (t *ipcTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	idle := t.idle
+	t.idle = nil
+	t.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.Close()
+	}
+}
+
+// Close closes the idle connections, and the busy ones once they're done.
+func (t *ipcTransport) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	t.CloseIdleConnections()
+
+	return nil
+}
+
+// IPCProvider forwards requests to a node over its unix socket. It skips
+// the TCP stack when the gateway runs next to the node.
+type IPCProvider struct {
+	transport *ipcTransport
+	handler   http.Handler
+}
+
+func NewIPCProvider(config NodeProviderConnectionIPCConfig) *IPCProvider {
+	p := &IPCProvider{
+		transport: newIPCTransport(config.Path),
+	}
+
+	// Nodes don't decompress requests over IPC.
+	//
+	p.handler = middleware.Gunzip(http.HandlerFunc(p.serve))
+
+	return p
+}
+
+func (p *IPCProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+func (p *IPCProvider) serve(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		middleware.WriteError(w, r, middleware.GatewayError{
+			StatusCode: http.StatusBadRequest,
+			Code:       middleware.JSONRPCErrorInvalidRequest,
+			Message:    "cannot read request body",
+			Reason:     "request_body_unreadable",
+		})
+
+		return
+	}
+
+	response, err := p.transport.Do(r.Context(), payload)
+	if err != nil {
+		recordAttemptError(r.Context(), classifyTransportError(err))
+
+		middleware.WriteError(w, r, middleware.GatewayError{
+			StatusCode: http.StatusBadGateway,
+			Code:       middleware.JSONRPCErrorInternal,
+			Message:    "cannot reach the node over ipc",
+			Reason:     "upstream_unreachable",
+		})
+
+		return
+	}
+
+	w.Header().Set(headers.ContentType, "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response) // nolint:errcheck
+}
+
+func (p *IPCProvider) Close() error {
+	return p.transport.Close()
+}
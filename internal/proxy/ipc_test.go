@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFakeIPCNode serves JSON-RPC over a unix socket the way geth does, and
+// returns the socket path.
+func newFakeIPCNode(t testing.TB) string {
+	t.Helper()
+
+	// Socket paths are limited to ~100 bytes, t.TempDir() may be longer.
+	//
+	dir, err := os.MkdirTemp("", "ipc")
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "geth.ipc")
+
+	listener, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns []net.Conn
+	)
+
+	respond := func(req JSONRPCRequest) any {
+		result := "0x1"
+
+		switch req.Method {
+		case "eth_blockNumber":
+			result = "0x10"
+		case "eth_call":
+			result = "0x3b9ac9ff"
+		}
+
+		return map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": result}
+	}
+
+	serve := func(conn net.Conn) {
+		defer wg.Done()
+
+		decoder := json.NewDecoder(conn)
+		encoder := json.NewEncoder(conn)
+
+		for {
+			var payload json.RawMessage
+			if err := decoder.Decode(&payload); err != nil {
+				return
+			}
+
+			requests, err := parseJSONRPCRequests(payload)
+			if err != nil {
+				return
+			}
+
+			if bytes.HasPrefix(payload, []byte("[")) {
+				responses := make([]any, 0, len(requests))
+				for _, req := range requests {
+					responses = append(responses, respond(req))
+				}
+
+				encoder.Encode(responses)
+			} else {
+				encoder.Encode(respond(requests[0]))
+			}
+		}
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+
+			wg.Add(1)
+
+			go serve(conn)
+		}
+	}()
+
+	t.Cleanup(func() {
+		listener.Close()
+
+		mu.Lock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+
+		wg.Wait()
+		os.RemoveAll(dir)
+	})
+
+	return path
+}
+
+func TestHttpFailoverProxyServesIPCTarget(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Local",
+			Connection: NodeProviderConnectionConfig{
+				IPC: NodeProviderConnectionIPCConfig{
+					Path: newFakeIPCNode(t),
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	for payload, expected := range map[string]string{
+		`{"jsonrpc":"2.0","id":7,"method":"eth_blockNumber"}`:                                                   `{"jsonrpc":"2.0","id":7,"result":"0x10"}`,
+		`[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},{"jsonrpc":"2.0","id":2,"method":"eth_blockNumber"}]`: `[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"result":"0x10"}]`,
+	} {
+		// The same connection serves both requests.
+		//
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(payload))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, expected, rr.Body.String())
+	}
+
+	assert.NoError(t, httpFailoverProxy.Close())
+}
+
+func TestHttpFailoverProxyReroutesUnreachableIPCTarget(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Local",
+			Connection: NodeProviderConnectionConfig{
+				IPC: NodeProviderConnectionIPCConfig{
+					Path: filepath.Join(t.TempDir(), "missing.ipc"),
+				},
+			},
+		},
+		{
+			Name: "Remote",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x"}`, rr.Body.String())
+}
+
+func TestHealthCheckManagerChecksIPCTarget(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name: "Local",
+				Connection: NodeProviderConnectionConfig{
+					IPC: NodeProviderConnectionIPCConfig{
+						Path: newFakeIPCNode(t),
+					},
+				},
+			},
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.NoError(t, err)
+
+	hc, err := hcm.GetTargetByName("Local")
+	assert.NoError(t, err)
+
+	result, err := hc.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x10), result.BlockNumber)
+	assert.Equal(t, uint64(0x3b9ac9ff), result.GasLimit)
+
+	assert.NoError(t, hcm.Stop(context.Background()))
+}
+
+func TestNodeProviderConnectionValidation(t *testing.T) {
+	_, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name: "Both",
+				Connection: NodeProviderConnectionConfig{
+					HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8545"},
+					IPC:  NodeProviderConnectionIPCConfig{Path: "/tmp/geth.ipc"},
+				},
+			},
+		},
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Registerer: prometheus.NewRegistry(),
+	})
+	assert.Error(t, err)
+
+	_, err = NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name: "Local",
+				Connection: NodeProviderConnectionConfig{
+					IPC: NodeProviderConnectionIPCConfig{Path: "/tmp/geth.ipc"},
+				},
+				HealthCheck: NodeProviderHealthCheckConfig{Mode: HealthCheckModeHTTP},
+			},
+		},
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Registerer: prometheus.NewRegistry(),
+	})
+	assert.Error(t, err)
+
+	_, err = NewNodeProvider(NodeProviderConfig{
+		Name: "Both",
+		Connection: NodeProviderConnectionConfig{
+			HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8545"},
+			IPC:  NodeProviderConnectionIPCConfig{Path: "/tmp/geth.ipc"},
+		},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/go-http-utils/headers"
+)
+
+const (
+	// JSONRPCErrorLimitExceeded is the code used by providers to signal that
+	// a request has been rate limited.
+	JSONRPCErrorLimitExceeded = -32005
+
+	// JSONRPCErrorMethodNotFound is the code of the methods no target
+	// supports.
+	JSONRPCErrorMethodNotFound = -32601
+
+	// maxErrorAttempts is the number of attempts listed in the error of a
+	// request no target could serve, the last ones.
+	maxErrorAttempts = 10
+)
+
+type JSONRPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// writeError writes an error generated by the gateway, with the upstream
+// attempts made on behalf of r.
+func (p *Proxy) writeError(w http.ResponseWriter, r *http.Request, e middleware.GatewayError) {
+	if attempts := requestAttemptsFromContext(r.Context()); attempts != nil {
+		e.Attempts = attempts.Attempts()
+		e.Providers = attempts.ProvidersVisited()
+	}
+
+	if p.cacheControl.enabled() {
+		w.Header().Set(headers.CacheControl, CacheControlNoStore)
+	}
+
+	middleware.WriteError(w, r, e)
+}
+
+// errServiceUnavailable fails a request no target could serve. The data of
+// the error lists the attempts made, by provider name, never by URL.
+func (p *Proxy) errServiceUnavailable(w http.ResponseWriter, r *http.Request, reason string) {
+	e := middleware.GatewayError{
+		StatusCode: http.StatusServiceUnavailable,
+		Code:       middleware.JSONRPCErrorInternal,
+		Message:    "no node provider could serve the request",
+		Reason:     reason,
+	}
+
+	if attempts := requestAttemptsFromContext(r.Context()); attempts != nil && attempts.reporting {
+		if trace := attempts.Trace(); len(trace) > 0 {
+			if len(trace) > maxErrorAttempts {
+				trace = trace[len(trace)-maxErrorAttempts:]
+			}
+
+			e.Data = trace
+		}
+	}
+
+	p.writeError(w, r, e)
+}
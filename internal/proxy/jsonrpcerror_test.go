@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestDoubleFailureProxy(t *testing.T, attemptsInErrors bool) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rateLimited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(rateLimited.Close)
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(failing.Close)
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.AttemptsInErrors = attemptsInErrors
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: rateLimited.URL}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: failing.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, rpcGatewayConfig)
+}
+
+func TestErrServiceUnavailableListsAttempts(t *testing.T) {
+	p := newTestDoubleFailureProxy(t, true)
+
+	rr := serveTracedRequest(p, nil)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var body struct {
+		Error struct {
+			Data []AttemptTrace `json:"data"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+
+	outcomes := []string{}
+	for _, attempt := range body.Error.Data {
+		outcomes = append(outcomes, attempt.Provider+":"+attempt.Outcome)
+	}
+
+	assert.Equal(t, []string{"Server1:http_429", "Server2:http_500"}, outcomes)
+	assert.NotContains(t, rr.Body.String(), "127.0.0.1")
+}
+
+func TestErrServiceUnavailableHidesAttempts(t *testing.T) {
+	p := newTestDoubleFailureProxy(t, false)
+
+	rr := serveTracedRequest(p, nil)
+	require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var body struct {
+		Error   map[string]interface{} `json:"error"`
+		Gateway map[string]interface{} `json:"gateway"`
+	}
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body))
+	assert.NotContains(t, body.Error, "data")
+	assert.Equal(t, 2.0, body.Gateway["attempts"])
+}
+
+func TestRequestAttemptsOnlyRecordFailuresForErrors(t *testing.T) {
+	reported := &requestAttempts{reporting: true}
+	reported.Record("Server1", time.Now(), attemptSuccess)
+	assert.Nil(t, reported.trace)
+
+	reported.Record("Server1", time.Now(), "http_500")
+	assert.Len(t, reported.Trace(), 1)
+
+	// Traces list every attempt.
+	//
+	traced := &requestAttempts{tracing: true}
+	traced.Record("Server1", time.Now(), attemptSuccess)
+	assert.Len(t, traced.Trace(), 1)
+
+	(&requestAttempts{}).Record("Server1", time.Now(), "http_500")
+}
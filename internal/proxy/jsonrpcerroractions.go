@@ -0,0 +1,214 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Actions taken on the JSON-RPC errors served with a successful status code.
+const (
+	// ErrorActionRetrySame retries the request on the same target.
+	ErrorActionRetrySame = "retry_same"
+	// ErrorActionReroute counts the response as a failure of the target and
+	// tries the next one.
+	ErrorActionReroute = "reroute"
+	// ErrorActionCooldown excludes the target for the cooldown of the
+	// action, with the cooldown_429 taint.
+	ErrorActionCooldown = "cooldown"
+)
+
+// JSONRPCErrorLimitReached is the code some providers, like QuickNode, use
+// to signal that the request limit of the account has been reached.
+const JSONRPCErrorLimitReached = -32007
+
+// JSONRPCErrorActionsConfig maps the codes of the JSON-RPC errors served with
+// a successful status code to the actions taken on them. Providers often
+// rate limit with HTTP 200, which would otherwise be returned to the client
+// as is. Defaults to DefaultJSONRPCErrorActions, an empty map disables it.
+type JSONRPCErrorActionsConfig map[int]JSONRPCErrorAction
+
+// JSONRPCErrorAction is what the gateway does about a JSON-RPC error code.
+type JSONRPCErrorAction struct {
+	// Actions are a combination of "retry_same", "reroute" and "cooldown".
+	// The request is retried on the same target first, then rerouted once
+	// the retries are exhausted.
+	Actions []string `yaml:"actions"`
+
+	// Cooldown is how long the cooldown action excludes the target. The
+	// Retry-After header of the response takes precedence. Defaults to the
+	// rateLimitCooldown of the retries.
+	Cooldown time.Duration `yaml:"cooldown"`
+
+	// Retries is the number of times retry_same retries the request, after
+	// the backoff of the retries. The max retries client override lowers
+	// it. Defaults to 1.
+	Retries uint `yaml:"retries"`
+}
+
+// DefaultJSONRPCErrorActions cools down and reroutes the rate limit errors.
+func DefaultJSONRPCErrorActions() JSONRPCErrorActionsConfig {
+	rateLimited := JSONRPCErrorAction{Actions: []string{ErrorActionCooldown, ErrorActionReroute}}
+
+	return JSONRPCErrorActionsConfig{
+		JSONRPCErrorLimitExceeded: rateLimited,
+		JSONRPCErrorLimitReached:  rateLimited,
+	}
+}
+
+func (c JSONRPCErrorActionsConfig) validate() error {
+	for code, action := range c {
+		if len(action.Actions) == 0 {
+			return errors.Errorf("no action for JSON-RPC error %d", code)
+		}
+
+		for _, a := range action.Actions {
+			switch a {
+			case ErrorActionRetrySame, ErrorActionReroute, ErrorActionCooldown:
+			default:
+				return errors.Errorf("invalid action %q of JSON-RPC error %d", a, code)
+			}
+		}
+
+		if action.Cooldown < 0 {
+			return errors.Errorf("negative cooldown of JSON-RPC error %d", code)
+		}
+	}
+
+	return nil
+}
+
+// newJSONRPCErrorActions returns the actions of config with their defaults
+// set, nil when disabled.
+func newJSONRPCErrorActions(config JSONRPCErrorActionsConfig, retry RetryConfig) JSONRPCErrorActionsConfig {
+	if config == nil {
+		config = DefaultJSONRPCErrorActions()
+	}
+
+	if len(config) == 0 {
+		return nil
+	}
+
+	actions := make(JSONRPCErrorActionsConfig, len(config))
+
+	for code, action := range config {
+		if action.Cooldown <= 0 {
+			action.Cooldown = retry.rateLimitCooldown(nil)
+		}
+
+		if action.Retries == 0 {
+			action.Retries = 1
+		}
+
+		actions[code] = action
+	}
+
+	return actions
+}
+
+func (a JSONRPCErrorAction) has(action string) bool {
+	for _, x := range a.Actions {
+		if x == action {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retries returns the number of times retry_same retries the request,
+// lowered by the client overrides.
+func (a JSONRPCErrorAction) retries(o clientOverrides) uint {
+	if o.maxRetries >= 0 {
+		return min(a.Retries, uint(o.maxRetries))
+	}
+
+	return a.Retries
+}
+
+// waitRetrySame waits the backoff of the retries before the given retry_same
+// one. It reports false, without waiting, when the retry wouldn't start
+// before the end of the request budget, or when the client is gone.
+func (p *Proxy) waitRetrySame(c context.Context, state *failoverState, retry uint) bool {
+	wait := p.retry.backoff(int(retry))
+
+	if p.requestTimeout > 0 && state.deadline.Sub(p.clock.Now()) <= wait {
+		return false
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-c.Done():
+		return false
+	}
+}
+
+// cooldown returns how long the target serving pw is excluded.
+func (a JSONRPCErrorAction) cooldown(pw *ReponseWriter) time.Duration {
+	if wait, ok := retryAfter(pw.Header()); ok && wait > 0 {
+		return wait
+	}
+
+	return a.Cooldown
+}
+
+// match returns the action of the JSON-RPC error held by pw. Only single
+// responses served with a successful status code are matched, the others
+// are already failed over or passed through by their status code.
+func (c JSONRPCErrorActionsConfig) match(pw *ReponseWriter) (int, JSONRPCErrorAction, bool) {
+	if len(c) == 0 || pw.statusCode < http.StatusOK || pw.statusCode >= http.StatusMultipleChoices {
+		return 0, JSONRPCErrorAction{}, false
+	}
+
+	// Results are never decoded, they can be large.
+	//
+	body := pw.body.Bytes()
+	if !bytes.Contains(body, []byte(`"error"`)) {
+		return 0, JSONRPCErrorAction{}, false
+	}
+
+	var response struct {
+		Error *JSONRPCError `json:"error"`
+	}
+
+	if err := json.Unmarshal(body, &response); err != nil || response.Error == nil {
+		return 0, JSONRPCErrorAction{}, false
+	}
+
+	action, ok := c[response.Error.Code]
+
+	return response.Error.Code, action, ok
+}
+
+// applyErrorAction cools down the target when the action says so, and counts
+// the actions applied to the error code.
+func (p *Proxy) applyErrorAction(target *NodeProvider, pw *ReponseWriter, code int, action JSONRPCErrorAction) {
+	for _, a := range action.Actions {
+		if a == ErrorActionRetrySame {
+			continue
+		}
+
+		p.observeErrorAction(target, code, a)
+	}
+
+	if !action.has(ErrorActionCooldown) {
+		return
+	}
+
+	if err := p.hcm.Taint(target.Name(), TaintReasonCooldown429, action.cooldown(pw)); err != nil {
+		p.logger.Warn("cannot cool down target", "provider", target.Name(), "error", err)
+	}
+}
+
+func (p *Proxy) observeErrorAction(target *NodeProvider, code int, action string) {
+	p.metricErrorActions.WithLabelValues(target.Name(), strconv.Itoa(code), action).Inc()
+}
@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const limitReachedResponse = `{"jsonrpc":"2.0","id":1,"error":{"code":-32007,"message":"request limit reached"}}`
+
+// newErrorActionsTestProxy returns a proxy whose first target serves the
+// responses of limited, and the second one a result. The hits of both are
+// counted.
+func newErrorActionsTestProxy(
+	t *testing.T,
+	actions JSONRPCErrorActionsConfig,
+	limited http.HandlerFunc,
+) (*Proxy, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var limitedHits, okHits atomic.Int32
+
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limitedHits.Add(1)
+		limited(w, r)
+	}))
+	t.Cleanup(first.Close)
+
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		okHits.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(second.Close)
+
+	config := createConfig()
+	config.Proxy.JSONRPCErrorActions = actions
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: first.URL}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: second.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, config), &limitedHits, &okHits
+}
+
+func serveErrorActionsRequest(t *testing.T, p *Proxy) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestHttpFailoverProxyCoolsDownLimitErrorsServedWithOK(t *testing.T) {
+	p, limitedHits, okHits := newErrorActionsTestProxy(t,
+		JSONRPCErrorActionsConfig{
+			JSONRPCErrorLimitReached: {
+				Actions:  []string{ErrorActionCooldown, ErrorActionReroute},
+				Cooldown: time.Minute,
+			},
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(limitReachedResponse)) // nolint:errcheck
+		})
+
+	clock := newFakeClock()
+	p.hcm.clock = clock
+
+	rr := serveErrorActionsRequest(t, p)
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, rr.Body.String())
+
+	taints, err := p.hcm.Taints("Server1")
+	require.NoError(t, err)
+	require.Len(t, taints, 1)
+	assert.Equal(t, TaintReasonCooldown429, taints[0].Reason)
+	assert.Equal(t, clock.Now().Add(time.Minute), *taints[0].Until)
+
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricErrorActions.WithLabelValues("Server1", "-32007", ErrorActionCooldown)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricErrorActions.WithLabelValues("Server1", "-32007", ErrorActionReroute)))
+
+	// The target is excluded for the whole cooldown.
+	//
+	serveErrorActionsRequest(t, p)
+	clock.Advance(59 * time.Second)
+	serveErrorActionsRequest(t, p)
+
+	assert.Equal(t, int32(1), limitedHits.Load())
+	assert.Equal(t, int32(3), okHits.Load())
+
+	clock.Advance(2 * time.Second)
+	serveErrorActionsRequest(t, p)
+
+	assert.Equal(t, int32(2), limitedHits.Load())
+}
+
+func TestHttpFailoverProxyDefaultErrorActionsHonorRetryAfter(t *testing.T) {
+	p, _, okHits := newErrorActionsTestProxy(t, nil, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.RetryAfter, "30")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32005,"message":"limit exceeded"}}`)) // nolint:errcheck
+	})
+
+	clock := newFakeClock()
+	p.hcm.clock = clock
+
+	rr := serveErrorActionsRequest(t, p)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int32(1), okHits.Load())
+
+	taints, err := p.hcm.Taints("Server1")
+	require.NoError(t, err)
+	require.Len(t, taints, 1)
+	assert.Equal(t, clock.Now().Add(30*time.Second), *taints[0].Until)
+}
+
+func TestHttpFailoverProxyRetriesSameTargetOnErrorAction(t *testing.T) {
+	var limits atomic.Int32
+
+	limits.Store(1)
+
+	p, limitedHits, okHits := newErrorActionsTestProxy(t,
+		JSONRPCErrorActionsConfig{
+			JSONRPCErrorLimitReached: {Actions: []string{ErrorActionRetrySame, ErrorActionReroute}, Retries: 1},
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			if limits.Add(-1) >= 0 {
+				w.Write([]byte(limitReachedResponse)) // nolint:errcheck
+
+				return
+			}
+
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x2"}`)) // nolint:errcheck
+		})
+
+	rr := serveErrorActionsRequest(t, p)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x2"}`, rr.Body.String())
+	assert.Equal(t, int32(2), limitedHits.Load())
+	assert.Zero(t, okHits.Load())
+
+	taints, err := p.hcm.Taints("Server1")
+	require.NoError(t, err)
+	assert.Empty(t, taints)
+
+	// The retries exhausted, the request is rerouted.
+	//
+	limits.Store(2)
+
+	rr = serveErrorActionsRequest(t, p)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, rr.Body.String())
+	assert.Equal(t, int32(4), limitedHits.Load())
+	assert.Equal(t, int32(1), okHits.Load())
+}
+
+func TestHttpFailoverProxyRetrySameBacksOffAndHonorsOverrides(t *testing.T) {
+	p, limitedHits, okHits := newErrorActionsTestProxy(t,
+		JSONRPCErrorActionsConfig{
+			JSONRPCErrorLimitReached: {Actions: []string{ErrorActionRetrySame, ErrorActionReroute}, Retries: 2},
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(limitReachedResponse)) // nolint:errcheck
+		})
+
+	p.retry = RetryConfig{Backoff: 20 * time.Millisecond}
+	p.overridable = true
+
+	start := time.Now()
+
+	serveErrorActionsRequest(t, p)
+
+	assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	assert.Equal(t, int32(3), limitedHits.Load())
+	assert.Equal(t, int32(1), okHits.Load())
+
+	// The client asked for no retries, the request is rerouted at once.
+	//
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	req.Header.Set(MaxRetriesHeader, "0")
+
+	p.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, int32(4), limitedHits.Load())
+	assert.Equal(t, int32(2), okHits.Load())
+}
+
+func TestHttpFailoverProxyIgnoresUnmatchedErrors(t *testing.T) {
+	p, limitedHits, okHits := newErrorActionsTestProxy(t, JSONRPCErrorActionsConfig{},
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(limitReachedResponse)) // nolint:errcheck
+		})
+
+	rr := serveErrorActionsRequest(t, p)
+	assert.JSONEq(t, limitReachedResponse, rr.Body.String())
+	assert.Equal(t, int32(1), limitedHits.Load())
+	assert.Zero(t, okHits.Load())
+}
+
+func TestJSONRPCErrorActionsConfigValidate(t *testing.T) {
+	assert.NoError(t, DefaultJSONRPCErrorActions().validate())
+	assert.Error(t, JSONRPCErrorActionsConfig{-32007: {}}.validate())
+	assert.Error(t, JSONRPCErrorActionsConfig{-32007: {Actions: []string{"drop"}}}.validate())
+	assert.Error(t, JSONRPCErrorActionsConfig{
+		-32007: {Actions: []string{ErrorActionCooldown}, Cooldown: -time.Second},
+	}.validate())
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// JSONRPCRequest is the part of a JSON-RPC request envelope the gateway
+// needs to route it. The id is kept raw, decoding it would lose the precision
+// of big numbers.
+type JSONRPCRequest struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// parseJSONRPCRequests decodes a single or batch JSON-RPC request. Invalid
+// payloads return an error and are proxied as they are.
+func parseJSONRPCRequests(body []byte) ([]JSONRPCRequest, error) {
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		var batch []JSONRPCRequest
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, err
+		}
+
+		return batch, nil
+	}
+
+	var request JSONRPCRequest
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+
+	return []JSONRPCRequest{request}, nil
+}
+
+// responseID returns the id echoed by a gateway generated response to
+// requests: the id of a single request, or nil for null when there's no
+// single id or it isn't a string or a number.
+func responseID(requests []JSONRPCRequest) json.RawMessage {
+	if len(requests) != 1 || !validID(requests[0].ID) {
+		return nil
+	}
+
+	return requests[0].ID
+}
+
+// validID reports whether id, a valid JSON value, is a string or a number.
+func validID(id json.RawMessage) bool {
+	if len(id) == 0 {
+		return false
+	}
+
+	c := id[0]
+
+	return c == '"' || c == '-' || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseID(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{"number", `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`, `1`},
+		{"big number", `{"jsonrpc":"2.0","id":123456789012345678901234567890,"method":"eth_chainId"}`, `123456789012345678901234567890`},
+		{"negative fraction", `{"jsonrpc":"2.0","id":-1.5e3,"method":"eth_chainId"}`, `-1.5e3`},
+		{"string", `{"jsonrpc":"2.0","id":"a\"bé","method":"eth_chainId"}`, `"a\"bé"`},
+		{"null", `{"jsonrpc":"2.0","id":null,"method":"eth_chainId"}`, ``},
+		{"missing", `{"jsonrpc":"2.0","method":"eth_chainId"}`, ``},
+		{"object", `{"jsonrpc":"2.0","id":{"a":1},"method":"eth_chainId"}`, ``},
+		{"boolean", `{"jsonrpc":"2.0","id":true,"method":"eth_chainId"}`, ``},
+		{"batch", `[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}]`, `1`},
+		{"larger batch", `[{"jsonrpc":"2.0","id":1,"method":"a"},{"jsonrpc":"2.0","id":2,"method":"b"}]`, ``},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests, err := parseJSONRPCRequests([]byte(tc.payload))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(responseID(requests)))
+		})
+	}
+}
+
+func TestHttpFailoverProxyErrorEchoesID(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: failing.URL}},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, config)
+
+	for _, id := range []string{`123456789012345678901234567890`, `"0xabc"`, `null`} {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":`+id+`,"method":"eth_chainId"}`))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+		var response map[string]json.RawMessage
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+		assert.Equal(t, id, string(response["id"]))
+	}
+}
+
+func FuzzParseJSONRPCRequests(f *testing.F) {
+	for _, seed := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`,
+		`{"jsonrpc":"2.0","id":123456789012345678901234567890,"method":"eth_chainId"}`,
+		`{"jsonrpc":"2.0","id":"x","method":"eth_call","params":[{},"latest"]}`,
+		`{"jsonrpc":"2.0","id":null,"method":"eth_chainId"}`,
+		`{"jsonrpc":"2.0","id":"<a&b>\u00e9","method":"eth_chainId"}`,
+		`{"jsonrpc":"2.0","method":"eth_subscribe"}`,
+		`[{"jsonrpc":"2.0","id":1,"method":"a"},{"jsonrpc":"2.0","id":"2","method":"b"}]`,
+		`[]`,
+		`[1]`,
+		`{"id":{"nested":[1,2]}}`,
+		`{"jsonrpc":`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		requests, err := parseJSONRPCRequests(body)
+		if err != nil {
+			return
+		}
+
+		for _, request := range requests {
+			if request.ID != nil && !json.Valid(request.ID) {
+				t.Fatalf("invalid id %q", request.ID)
+			}
+		}
+
+		requestMethod(requests)
+
+		id := responseID(requests)
+		if id == nil {
+			return
+		}
+
+		// The id echoed by a gateway error is the one sent, byte for byte.
+		//
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req = req.WithContext(middleware.WithJSONRPCID(req.Context(), id))
+		rr := httptest.NewRecorder()
+
+		middleware.WriteError(rr, req, middleware.GatewayError{StatusCode: http.StatusServiceUnavailable})
+
+		var response map[string]json.RawMessage
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid error response %q: %v", rr.Body.Bytes(), err)
+		}
+
+		if !bytes.Equal(compactJSON(t, id), compactJSON(t, response["id"])) {
+			t.Fatalf("id %s echoed as %s", id, response["id"])
+		}
+	})
+}
+
+func compactJSON(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	if err := json.Compact(&b, data); err != nil {
+		t.Fatal(err)
+	}
+
+	return b.Bytes()
+}
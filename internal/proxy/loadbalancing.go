@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// LoadBalancingPriority sends requests to the first healthy target in the
+	// configured order. It's the default mode.
+	LoadBalancingPriority = "priority"
+
+	// LoadBalancingLeastPending sends requests to the healthy target with the
+	// fewest outstanding requests, ties are broken by the configured weight.
+	LoadBalancingLeastPending = "leastPending"
+
+	// LoadBalancingClientHash sticks a client to a single target using a
+	// consistent-hash ring, as long as that target is healthy.
+	LoadBalancingClientHash = "clientHash"
+
+	// LoadBalancingWeightedRoundRobin spreads requests across healthy targets
+	// proportionally to their weight.
+	LoadBalancingWeightedRoundRobin = "weightedRoundRobin"
+
+	// LoadBalancingScore sends requests to the healthy target with the best
+	// score, only switching to another one when it scores better by more
+	// than the hysteresis.
+	LoadBalancingScore = "score"
+
+	// DefaultSlowStart is the window during which a recovered target's weight
+	// ramps up in the "weightedRoundRobin" mode.
+	DefaultSlowStart = 60 * time.Second
+)
+
+func validateLoadBalancing(mode string) error {
+	switch mode {
+	case "",
+		LoadBalancingPriority,
+		LoadBalancingLeastPending,
+		LoadBalancingClientHash,
+		LoadBalancingWeightedRoundRobin,
+		LoadBalancingScore:
+		return nil
+	default:
+		return errors.Errorf("unknown loadBalancing mode %q", mode)
+	}
+}
+
+// candidates returns the targets in the order they should be attempted for
+// the given request, tier by tier. Unhealthy targets are filtered later, so
+// failover works the same way regardless of the mode.
+func (p *Proxy) candidates(r *http.Request) []*NodeProvider {
+	return byTier(p.balancedCandidates(r))
+}
+
+// balancedCandidates returns the targets in the order of the selector or the
+// load balancing mode.
+func (p *Proxy) balancedCandidates(r *http.Request) []*NodeProvider {
+	if p.selector != nil {
+		return p.selector.Select(r, p.targets)
+	}
+
+	switch p.loadBalancing {
+	case LoadBalancingLeastPending:
+		return p.leastPendingCandidates()
+	case LoadBalancingClientHash:
+		return p.ring.Lookup(p.clientKey(r))
+	case LoadBalancingWeightedRoundRobin:
+		return p.weightedRoundRobinCandidates()
+	case LoadBalancingScore:
+		return p.scoreCandidates()
+	default:
+		return p.targets
+	}
+}
+
+func (p *Proxy) leastPendingCandidates() []*NodeProvider {
+	type candidate struct {
+		target  *NodeProvider
+		pending int64
+	}
+
+	// Snapshot the counters once, so the sort sees a consistent view.
+	//
+	snapshot := make([]candidate, len(p.targets))
+	for i, target := range p.targets {
+		snapshot[i] = candidate{target: target, pending: target.Pending()}
+	}
+
+	sort.SliceStable(snapshot, func(i, j int) bool {
+		if snapshot[i].pending != snapshot[j].pending {
+			return snapshot[i].pending < snapshot[j].pending
+		}
+
+		return snapshot[i].target.Weight() > snapshot[j].target.Weight()
+	})
+
+	candidates := make([]*NodeProvider, len(snapshot))
+	for i, c := range snapshot {
+		candidates[i] = c.target
+	}
+
+	return candidates
+}
+
+func (p *Proxy) weightedRoundRobinCandidates() []*NodeProvider {
+	candidates := p.wrr.Next(p.hcm.IsHealthy, p.clock.Now())
+
+	for name, weight := range p.wrr.EffectiveWeights() {
+		p.metricEffectiveWeight.WithLabelValues(name).Set(weight)
+	}
+
+	return candidates
+}
+
+// clientKey identifies the client for sticky routing. The configured header
+// (usually an API key) takes precedence over the client IP address.
+func (p *Proxy) clientKey(r *http.Request) string {
+	if p.clientHeader != "" {
+		if key := r.Header.Get(p.clientHeader); key != "" {
+			return key
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,307 @@
+package proxy
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	// The timezones of the maintenance windows are resolved without relying
+	// on the tzdata of the host, which slim images don't ship.
+	_ "time/tzdata"
+
+	"github.com/pkg/errors"
+)
+
+// MaxMaintenanceWindowDuration bounds how long a recurring maintenance
+// window lasts.
+const MaxMaintenanceWindowDuration = 7 * 24 * time.Hour
+
+// MaintenanceWindowConfig is a window during which a target is tainted for
+// the "maintenance" reason, either recurring or one-off. Overlapping windows
+// taint the target until the last one ends.
+type MaintenanceWindowConfig struct {
+	// Schedule starts a recurring window, as a cron expression of five
+	// fields: minute, hour, day of month, month and day of week, e.g.
+	// "0 3 * * SUN" every Sunday at 03:00. Fields take numbers, names for
+	// months and days of week, "*", ranges, lists and steps.
+	Schedule string `yaml:"schedule"`
+
+	// Duration is how long a recurring window lasts, at most 7 days.
+	Duration time.Duration `yaml:"duration"`
+
+	// Timezone is the IANA timezone the schedule is evaluated in, e.g.
+	// "Europe/Berlin". Defaults to UTC. Times skipped by a daylight saving
+	// change never start a window, times repeated by one start it twice.
+	Timezone string `yaml:"timezone"`
+
+	// Interval is a one-off window, as two RFC3339 times separated by a
+	// slash, e.g. "2026-11-01T02:00:00Z/2026-11-01T04:00:00Z". It excludes
+	// Schedule.
+	Interval string `yaml:"interval"`
+}
+
+// maintenanceWindow is a parsed MaintenanceWindowConfig.
+type maintenanceWindow struct {
+	// schedule, location and duration describe a recurring window.
+	schedule *cronSchedule
+	location *time.Location
+	duration time.Duration
+
+	// start and end describe a one-off window.
+	start, end time.Time
+
+	// lastMinute is the minute the latest start of the recurring window was
+	// last looked up for, and lastStart the start found, zero if none was.
+	lastMinute time.Time
+	lastStart  time.Time
+}
+
+func newMaintenanceWindow(config MaintenanceWindowConfig) (*maintenanceWindow, error) {
+	if config.Interval != "" {
+		if config.Schedule != "" || config.Duration != 0 || config.Timezone != "" {
+			return nil, errors.New("interval excludes schedule, duration and timezone")
+		}
+
+		start, end, ok := strings.Cut(config.Interval, "/")
+		if !ok {
+			return nil, errors.Errorf("interval %q isn't two RFC3339 times separated by a slash", config.Interval)
+		}
+
+		w := &maintenanceWindow{}
+
+		var err error
+
+		if w.start, err = time.Parse(time.RFC3339, start); err != nil {
+			return nil, errors.Wrapf(err, "invalid interval %q", config.Interval)
+		}
+
+		if w.end, err = time.Parse(time.RFC3339, end); err != nil {
+			return nil, errors.Wrapf(err, "invalid interval %q", config.Interval)
+		}
+
+		if !w.end.After(w.start) {
+			return nil, errors.Errorf("interval %q ends before it starts", config.Interval)
+		}
+
+		return w, nil
+	}
+
+	if config.Schedule == "" {
+		return nil, errors.New("maintenance window without a schedule or an interval")
+	}
+
+	if config.Duration <= 0 || config.Duration > MaxMaintenanceWindowDuration {
+		return nil, errors.Errorf("maintenance window duration must be between 0 and %s", MaxMaintenanceWindowDuration)
+	}
+
+	schedule, err := parseCronSchedule(config.Schedule)
+	if err != nil {
+		return nil, err
+	}
+
+	location := time.UTC
+	if config.Timezone != "" {
+		if location, err = time.LoadLocation(config.Timezone); err != nil {
+			return nil, errors.Wrapf(err, "invalid timezone %q", config.Timezone)
+		}
+	}
+
+	return &maintenanceWindow{schedule: schedule, location: location, duration: config.Duration}, nil
+}
+
+// newMaintenanceWindows parses the maintenance windows of a target.
+func newMaintenanceWindows(configs []MaintenanceWindowConfig) ([]*maintenanceWindow, error) {
+	windows := make([]*maintenanceWindow, 0, len(configs))
+
+	for i, config := range configs {
+		w, err := newMaintenanceWindow(config)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid maintenance window %d", i)
+		}
+
+		windows = append(windows, w)
+	}
+
+	return windows, nil
+}
+
+// activeUntil returns when the window active at now ends, the zero time if
+// none is. The latest start of a recurring window is looked up at most once
+// a minute, it isn't safe for concurrent use.
+func (w *maintenanceWindow) activeUntil(now time.Time) time.Time {
+	if w.schedule == nil {
+		if !now.Before(w.start) && now.Before(w.end) {
+			return w.end
+		}
+
+		return time.Time{}
+	}
+
+	if minute := now.Truncate(time.Minute); !minute.Equal(w.lastMinute) {
+		w.lastMinute = minute
+		w.lastStart = time.Time{}
+
+		// The minutes are walked in absolute time, so the ones repeated or
+		// skipped by a daylight saving change are too.
+		//
+		for start := minute; now.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+			if w.schedule.matches(start.In(w.location)) {
+				w.lastStart = start
+
+				break
+			}
+		}
+	}
+
+	if end := w.lastStart.Add(w.duration); !w.lastStart.IsZero() && now.Before(end) {
+		return end
+	}
+
+	return time.Time{}
+}
+
+// cronSchedule is a parsed cron expression, each field a bitset of the
+// values it matches.
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+
+	// Unless either day field is "*", a day matching any of them matches.
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+//nolint:gochecknoglobals
+var (
+	cronMonthNames = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	cronDayNames = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+func parseCronSchedule(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("schedule %q must have 5 fields", spec)
+	}
+
+	var (
+		s   cronSchedule
+		err error
+	)
+
+	for i, field := range []struct {
+		bits     *uint64
+		min, max int
+		names    map[string]int
+	}{
+		{&s.minute, 0, 59, nil},
+		{&s.hour, 0, 23, nil},
+		{&s.dayOfMonth, 1, 31, nil},
+		{&s.month, 1, 12, cronMonthNames},
+		{&s.dayOfWeek, 0, 7, cronDayNames},
+	} {
+		if *field.bits, err = parseCronField(fields[i], field.min, field.max, field.names); err != nil {
+			return nil, errors.Wrapf(err, "invalid schedule %q", spec)
+		}
+	}
+
+	// Sunday is either 0 or 7.
+	//
+	if s.dayOfWeek&(1<<7) != 0 {
+		s.dayOfWeek |= 1
+	}
+
+	s.anyDayOfMonth = strings.HasPrefix(fields[2], "*")
+	s.anyDayOfWeek = strings.HasPrefix(fields[4], "*")
+
+	return &s, nil
+}
+
+// parseCronField returns the bitset of the values matched by a comma
+// separated list of "*", values and ranges, each with an optional step.
+func parseCronField(field string, lowest, highest int, names map[string]int) (uint64, error) {
+	var set uint64
+
+	for _, item := range strings.Split(field, ",") {
+		item, stepSpec, hasStep := strings.Cut(item, "/")
+
+		step := 1
+
+		if hasStep {
+			var err error
+
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step %q", stepSpec)
+			}
+		}
+
+		low, high := lowest, highest
+
+		if item != "*" {
+			lowSpec, highSpec, isRange := strings.Cut(item, "-")
+
+			var err error
+
+			if low, err = parseCronValue(lowSpec, lowest, highest, names); err != nil {
+				return 0, err
+			}
+
+			high = low
+
+			switch {
+			case isRange:
+				if high, err = parseCronValue(highSpec, lowest, highest, names); err != nil {
+					return 0, err
+				}
+
+				if high < low {
+					return 0, errors.Errorf("invalid range %q", item)
+				}
+			case hasStep:
+				high = highest
+			}
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+
+	if set == 0 {
+		return 0, errors.Errorf("field %q matches nothing", field)
+	}
+
+	return set, nil
+}
+
+func parseCronValue(spec string, lowest, highest int, names map[string]int) (int, error) {
+	if v, ok := names[strings.ToUpper(spec)]; ok {
+		return v, nil
+	}
+
+	v, err := strconv.Atoi(spec)
+	if err != nil || v < lowest || v > highest {
+		return 0, errors.Errorf("invalid value %q, must be between %d and %d", spec, lowest, highest)
+	}
+
+	return v, nil
+}
+
+// matches reports whether t, in the timezone of the schedule, is one of its
+// minutes.
+func (s *cronSchedule) matches(t time.Time) bool {
+	if s.minute&(1<<t.Minute()) == 0 || s.hour&(1<<t.Hour()) == 0 || s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+
+	dayOfMonth := s.dayOfMonth&(1<<t.Day()) != 0
+	dayOfWeek := s.dayOfWeek&(1<<int(t.Weekday())) != 0
+
+	if s.anyDayOfMonth || s.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+
+	return dayOfMonth || dayOfWeek
+}
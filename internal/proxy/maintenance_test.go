@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronScheduleMatches(t *testing.T) {
+	for _, tc := range []struct {
+		spec    string
+		time    string
+		matches bool
+	}{
+		{"0 3 * * SUN", "2026-10-18T03:00:00Z", true},
+		{"0 3 * * 0", "2026-10-18T03:00:00Z", true},
+		{"0 3 * * 7", "2026-10-18T03:00:00Z", true},
+		{"0 3 * * SUN", "2026-10-18T03:01:00Z", false},
+		{"0 3 * * SUN", "2026-10-19T03:00:00Z", false},
+		{"*/15 * * * *", "2026-10-19T10:45:00Z", true},
+		{"*/15 * * * *", "2026-10-19T10:40:00Z", false},
+		{"0 1-5/2 * * *", "2026-10-19T03:00:00Z", true},
+		{"0 1-5/2 * * *", "2026-10-19T04:00:00Z", false},
+		{"30 2 1,15 * *", "2026-10-15T02:30:00Z", true},
+		{"0 0 * JAN-MAR *", "2026-02-03T00:00:00Z", true},
+		{"0 0 * JAN-MAR *", "2026-04-03T00:00:00Z", false},
+		// Both day fields restricted, either of them matches.
+		{"0 0 1 * MON", "2026-10-19T00:00:00Z", true},
+		{"0 0 1 * MON", "2026-10-01T00:00:00Z", true},
+		{"0 0 1 * MON", "2026-10-20T00:00:00Z", false},
+		// A single day field restricted, both of them have to match.
+		{"0 0 * * MON", "2026-10-20T00:00:00Z", false},
+	} {
+		schedule, err := parseCronSchedule(tc.spec)
+		require.NoError(t, err, tc.spec)
+
+		at, err := time.Parse(time.RFC3339, tc.time)
+		require.NoError(t, err)
+
+		assert.Equal(t, tc.matches, schedule.matches(at), "%s at %s", tc.spec, tc.time)
+	}
+}
+
+func TestMaintenanceWindowConfigErrors(t *testing.T) {
+	for _, config := range []MaintenanceWindowConfig{
+		{},
+		{Schedule: "0 3 * * SUN"},
+		{Schedule: "0 3 * * SUN", Duration: 8 * 24 * time.Hour},
+		{Schedule: "0 3 * *", Duration: time.Hour},
+		{Schedule: "60 3 * * SUN", Duration: time.Hour},
+		{Schedule: "0 3 * * SUNDAY", Duration: time.Hour},
+		{Schedule: "0 5-3 * * *", Duration: time.Hour},
+		{Schedule: "*/0 * * * *", Duration: time.Hour},
+		{Schedule: "0 3 * * SUN", Duration: time.Hour, Timezone: "Mars/Olympus_Mons"},
+		{Interval: "2026-11-01T02:00:00Z"},
+		{Interval: "2026-11-01T04:00:00Z/2026-11-01T02:00:00Z"},
+		{Interval: "2026-11-01T02:00:00Z/2026-11-01T04:00:00Z", Schedule: "0 3 * * SUN"},
+	} {
+		_, err := newMaintenanceWindow(config)
+		assert.Error(t, err, "%+v", config)
+	}
+}
+
+func TestMaintenanceWindowActiveUntil(t *testing.T) {
+	at := func(s string) time.Time {
+		t.Helper()
+
+		v, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+
+		return v
+	}
+
+	weekly, err := newMaintenanceWindow(MaintenanceWindowConfig{Schedule: "0 3 * * SUN", Duration: 30 * time.Minute})
+	require.NoError(t, err)
+
+	assert.Zero(t, weekly.activeUntil(at("2026-10-18T02:59:59Z")))
+	assert.Equal(t, at("2026-10-18T03:30:00Z"), weekly.activeUntil(at("2026-10-18T03:00:00Z")))
+	assert.Equal(t, at("2026-10-18T03:30:00Z"), weekly.activeUntil(at("2026-10-18T03:29:59Z")))
+	assert.Zero(t, weekly.activeUntil(at("2026-10-18T03:30:00Z")))
+	assert.Zero(t, weekly.activeUntil(at("2026-10-25T02:00:00Z")))
+
+	// 03:00 in Berlin is 01:00 UTC in summer time and 02:00 UTC after it.
+	//
+	berlin, err := newMaintenanceWindow(MaintenanceWindowConfig{
+		Schedule: "0 3 * * SUN",
+		Duration: 30 * time.Minute,
+		Timezone: "Europe/Berlin",
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, at("2026-10-18T01:30:00Z"), berlin.activeUntil(at("2026-10-18T01:10:00Z")))
+	assert.Zero(t, berlin.activeUntil(at("2026-10-18T03:10:00Z")))
+	assert.Equal(t, at("2026-11-01T02:30:00Z"), berlin.activeUntil(at("2026-11-01T02:10:00Z")))
+
+	oneOff, err := newMaintenanceWindow(MaintenanceWindowConfig{Interval: "2026-11-01T02:00:00Z/2026-11-01T04:00:00Z"})
+	require.NoError(t, err)
+
+	assert.Zero(t, oneOff.activeUntil(at("2026-11-01T01:59:59Z")))
+	assert.Equal(t, at("2026-11-01T04:00:00Z"), oneOff.activeUntil(at("2026-11-01T02:00:00Z")))
+	assert.Zero(t, oneOff.activeUntil(at("2026-11-01T04:00:00Z")))
+}
+
+func TestHealthCheckManagerOverlappingMaintenanceWindows(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	// The fake clock starts on a Tuesday at 22:13:20 UTC.
+	//
+	clock := newFakeClock()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name:       "Server1",
+				Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8545"}},
+				MaintenanceWindows: []MaintenanceWindowConfig{
+					{Schedule: "0 23 * * TUE", Duration: 30 * time.Minute},
+					{Interval: "2023-11-14T23:15:00Z/2023-11-14T23:45:00Z"},
+				},
+			},
+		},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	hcm.clock = clock
+
+	assert.True(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	clock.Advance(47 * time.Minute)
+
+	assert.False(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	taints, err := hcm.Taints("Server1")
+	require.NoError(t, err)
+	require.Len(t, taints, 1)
+	assert.Equal(t, TaintReasonMaintenance, taints[0].Reason)
+	assert.Equal(t, time.Date(2023, 11, 14, 23, 30, 0, 0, time.UTC), taints[0].Until.UTC())
+
+	hcm.reportStatusMetrics()
+	assert.Equal(t, 1.0, testutil.ToFloat64(hcm.metricRPCProviderStatus.WithLabelValues("Server1", TaintReasonMaintenance)))
+
+	// The one-off window overlaps the end of the weekly one.
+	//
+	clock.Advance(20 * time.Minute)
+
+	taints, err = hcm.Taints("Server1")
+	require.NoError(t, err)
+	require.Len(t, taints, 1)
+	assert.Equal(t, time.Date(2023, 11, 14, 23, 45, 0, 0, time.UTC), taints[0].Until.UTC())
+
+	clock.Advance(25 * time.Minute)
+
+	assert.True(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	hcm.reportStatusMetrics()
+	assert.Zero(t, testutil.ToFloat64(hcm.metricRPCProviderStatus.WithLabelValues("Server1", TaintReasonMaintenance)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(hcm.metricRPCProviderTaints.WithLabelValues("Server1", TaintReasonMaintenance)))
+}
+
+func TestHttpFailoverProxyMaintenanceWindow(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	newNode := func(result string) *httptest.Server {
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + result + `"}`)) // nolint:errcheck
+		}))
+		t.Cleanup(node.Close)
+
+		return node
+	}
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: newNode("0x1").URL}},
+			MaintenanceWindows: []MaintenanceWindowConfig{
+				{Schedule: "0 23 * * TUE", Duration: 30 * time.Minute},
+			},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: newNode("0x2").URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	clock := newFakeClock()
+	p.clock = clock
+	p.hcm.clock = clock
+
+	serve := func() string {
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)))
+
+		return rr.Body.String()
+	}
+
+	assert.Contains(t, serve(), `"0x1"`)
+
+	clock.Advance(47 * time.Minute)
+	assert.Contains(t, serve(), `"0x2"`)
+
+	clock.Advance(30 * time.Minute)
+	assert.Contains(t, serve(), `"0x1"`)
+}
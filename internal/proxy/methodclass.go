@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultMethodClass is the class of methods not matching any configured
+	// class.
+	DefaultMethodClass = "reads"
+)
+
+// DefaultMethodClasses returns the method classes used when none are
+// configured.
+func DefaultMethodClasses() map[string][]string {
+	return map[string][]string{
+		"logs":   {"eth_getLogs"},
+		"traces": {"trace_*", "debug_*"},
+		"sends":  {"eth_sendRawTransaction", "eth_sendTransaction"},
+	}
+}
+
+// methodClassifier groups JSON-RPC methods into classes, so a provider
+// failing a single kind of workload can be avoided only for that workload.
+type methodClassifier struct {
+	exact    map[string]string
+	prefixes []methodPrefix
+}
+
+type methodPrefix struct {
+	prefix string
+	class  string
+}
+
+func newMethodClassifier(classes map[string][]string) *methodClassifier {
+	if classes == nil {
+		classes = DefaultMethodClasses()
+	}
+
+	m := &methodClassifier{
+		exact: map[string]string{},
+	}
+
+	for class, methods := range classes {
+		for _, method := range methods {
+			if prefix, ok := strings.CutSuffix(method, "*"); ok {
+				m.prefixes = append(m.prefixes, methodPrefix{prefix: prefix, class: class})
+
+				continue
+			}
+
+			m.exact[method] = class
+		}
+	}
+
+	// The longest prefix wins, so the result doesn't depend on map ordering.
+	//
+	sort.Slice(m.prefixes, func(i, j int) bool {
+		if len(m.prefixes[i].prefix) != len(m.prefixes[j].prefix) {
+			return len(m.prefixes[i].prefix) > len(m.prefixes[j].prefix)
+		}
+
+		return m.prefixes[i].prefix < m.prefixes[j].prefix
+	})
+
+	return m
+}
+
+// Classify returns the class of a method.
+func (m *methodClassifier) Classify(method string) string {
+	if class, ok := m.exact[method]; ok {
+		return class
+	}
+
+	for _, p := range m.prefixes {
+		if strings.HasPrefix(method, p.prefix) {
+			return p.class
+		}
+	}
+
+	return DefaultMethodClass
+}
+
+// ClassifyRequests returns the class of a request. A batch takes the class of
+// its first method that doesn't fall in the default class.
+func (m *methodClassifier) ClassifyRequests(requests []JSONRPCRequest) string {
+	for _, request := range requests {
+		if class := m.Classify(request.Method); class != DefaultMethodClass {
+			return class
+		}
+	}
+
+	return DefaultMethodClass
+}
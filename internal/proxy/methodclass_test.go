@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodClassifier(t *testing.T) {
+	t.Parallel()
+
+	classifier := newMethodClassifier(map[string][]string{
+		"logs":        {"eth_getLogs"},
+		"traces":      {"trace_*", "debug_*"},
+		"blockTraces": {"trace_block*"},
+	})
+
+	assert.Equal(t, "logs", classifier.Classify("eth_getLogs"))
+	assert.Equal(t, "traces", classifier.Classify("trace_transaction"))
+	assert.Equal(t, "blockTraces", classifier.Classify("trace_blockByNumber"))
+	assert.Equal(t, DefaultMethodClass, classifier.Classify("eth_call"))
+
+	assert.Equal(t, "logs", classifier.ClassifyRequests([]JSONRPCRequest{
+		{Method: "eth_call"},
+		{Method: "eth_getLogs"},
+	}))
+	assert.Equal(t, DefaultMethodClass, classifier.ClassifyRequests(nil))
+}
+
+func TestParseJSONRPCRequests(t *testing.T) {
+	t.Parallel()
+
+	requests, err := parseJSONRPCRequests([]byte(` {"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []JSONRPCRequest{{ID: []byte(`1`), Method: "eth_call"}}, requests)
+
+	requests, err = parseJSONRPCRequests([]byte(`[{"id":"a","method":"eth_call"},{"id":2,"method":"eth_getLogs"}]`))
+	assert.NoError(t, err)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, "eth_getLogs", requests[1].Method)
+
+	_, err = parseJSONRPCRequests([]byte(`{{`))
+	assert.Error(t, err)
+}
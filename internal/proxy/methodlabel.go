@@ -0,0 +1,119 @@
+package proxy
+
+// otherMethodLabel labels the methods outside the known ones, so clients
+// can't create a series per made up method.
+const otherMethodLabel = "other"
+
+// standardMethods are the JSON-RPC methods commonly served by nodes, always
+// labeled by name.
+var standardMethods = []string{
+	"eth_accounts",
+	"eth_blobBaseFee",
+	"eth_blockNumber",
+	"eth_call",
+	"eth_chainId",
+	"eth_createAccessList",
+	"eth_estimateGas",
+	"eth_feeHistory",
+	"eth_gasPrice",
+	"eth_getBalance",
+	"eth_getBlockByHash",
+	"eth_getBlockByNumber",
+	"eth_getBlockReceipts",
+	"eth_getBlockTransactionCountByHash",
+	"eth_getBlockTransactionCountByNumber",
+	"eth_getCode",
+	"eth_getFilterChanges",
+	"eth_getFilterLogs",
+	"eth_getLogs",
+	"eth_getProof",
+	"eth_getStorageAt",
+	"eth_getTransactionByBlockHashAndIndex",
+	"eth_getTransactionByBlockNumberAndIndex",
+	"eth_getTransactionByHash",
+	"eth_getTransactionCount",
+	"eth_getTransactionReceipt",
+	"eth_getUncleByBlockHashAndIndex",
+	"eth_getUncleByBlockNumberAndIndex",
+	"eth_getUncleCountByBlockHash",
+	"eth_getUncleCountByBlockNumber",
+	"eth_maxPriorityFeePerGas",
+	"eth_newBlockFilter",
+	"eth_newFilter",
+	"eth_newPendingTransactionFilter",
+	"eth_protocolVersion",
+	"eth_sendRawTransaction",
+	"eth_sendTransaction",
+	"eth_sign",
+	"eth_signTransaction",
+	"eth_subscribe",
+	"eth_syncing",
+	"eth_uninstallFilter",
+	"eth_unsubscribe",
+	"net_listening",
+	"net_peerCount",
+	"net_version",
+	"web3_clientVersion",
+	"web3_sha3",
+	"debug_traceBlockByHash",
+	"debug_traceBlockByNumber",
+	"debug_traceCall",
+	"debug_traceTransaction",
+	"trace_block",
+	"trace_call",
+	"trace_filter",
+	"trace_replayBlockTransactions",
+	"trace_replayTransaction",
+	"trace_transaction",
+}
+
+// newKnownMethods returns the methods labeled by name: the standard ones,
+// and the ones named in the configuration.
+func newKnownMethods(classifier *methodClassifier, computeUnits ComputeUnitsConfig) map[string]struct{} {
+	known := make(map[string]struct{}, len(standardMethods)+len(classifier.exact)+len(computeUnits.Costs))
+
+	for _, method := range standardMethods {
+		known[method] = struct{}{}
+	}
+
+	for method := range classifier.exact {
+		known[method] = struct{}{}
+	}
+
+	for method := range computeUnits.Costs {
+		known[method] = struct{}{}
+	}
+
+	return known
+}
+
+// requestMethod returns the method of a request. Batches aren't broken down,
+// their methods may be unrelated, and notifications are named as such.
+func requestMethod(requests []JSONRPCRequest) string {
+	switch {
+	case isNotificationOnly(requests):
+		return "notification"
+	case len(requests) == 0:
+		return "unknown"
+	case len(requests) == 1:
+		return requests[0].Method
+	default:
+		return "batch"
+	}
+}
+
+// methodLabel returns the method of a request for metrics, "other" when it
+// isn't a known method.
+func (p *Proxy) methodLabel(requests []JSONRPCRequest) string {
+	method := requestMethod(requests)
+
+	if len(requests) != 1 || isNotificationOnly(requests) {
+		return method
+	}
+
+	if _, ok := p.knownMethods[method]; !ok {
+		return otherMethodLabel
+	}
+
+	return method
+}
@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMethodLabelBoundsCardinality(t *testing.T) {
+	t.Parallel()
+
+	p := &Proxy{
+		knownMethods: newKnownMethods(
+			newMethodClassifier(map[string][]string{"archive": {"erigon_getHeaderByNumber", "arbtrace_*"}}),
+			ComputeUnitsConfig{Costs: map[string]float64{"alchemy_getAssetTransfers": 150}},
+		),
+	}
+
+	tests := []struct {
+		requests []JSONRPCRequest
+		label    string
+	}{
+		{[]JSONRPCRequest{{ID: []byte(`1`), Method: "eth_call"}}, "eth_call"},
+		{[]JSONRPCRequest{{ID: []byte(`1`), Method: "erigon_getHeaderByNumber"}}, "erigon_getHeaderByNumber"},
+		{[]JSONRPCRequest{{ID: []byte(`1`), Method: "alchemy_getAssetTransfers"}}, "alchemy_getAssetTransfers"},
+		{[]JSONRPCRequest{{ID: []byte(`1`), Method: "arbtrace_block"}}, otherMethodLabel},
+		{[]JSONRPCRequest{{ID: []byte(`1`), Method: "eth_madeUp1234"}}, otherMethodLabel},
+		{[]JSONRPCRequest{{Method: "eth_madeUp1234"}}, "notification"},
+		{[]JSONRPCRequest{{ID: []byte(`1`), Method: "eth_madeUp1234"}, {ID: []byte(`2`), Method: "eth_call"}}, "batch"},
+		{nil, "unknown"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.label, p.methodLabel(tt.requests))
+	}
+}
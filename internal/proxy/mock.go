@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+const (
+	// mockURL stands for the node in the requests answered by mock targets.
+	mockURL = "http://mock"
+
+	// DefaultMockResult is the result of the methods without a configured
+	// response.
+	DefaultMockResult = "0x0"
+)
+
+// NodeProviderConnectionMockConfig answers requests without any node, e.g.
+// to integration test clients or to load test the gateway itself.
+type NodeProviderConnectionMockConfig struct {
+	// Responses maps methods to result templates, where {{ .ID }} and
+	// {{ .Method }} are the ones of the request. Results which aren't valid
+	// JSON are returned as strings.
+	Responses map[string]string `yaml:"responses"`
+
+	// DefaultResult is the result template of the other methods. Defaults
+	// to "0x0".
+	DefaultResult string `yaml:"defaultResult"`
+}
+
+type mockTemplateData struct {
+	ID     string
+	Method string
+}
+
+type mockResponse struct {
+	Jsonrpc string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result"`
+}
+
+// MockProvider answers every JSON-RPC request from static responses. It goes
+// through the same failover, metrics and logging as the other providers.
+type MockProvider struct {
+	responses     map[string]*template.Template
+	defaultResult *template.Template
+	handler       http.Handler
+}
+
+func NewMockProvider(config NodeProviderConnectionMockConfig) (*MockProvider, error) {
+	p := &MockProvider{
+		responses: make(map[string]*template.Template, len(config.Responses)),
+	}
+
+	for method, text := range config.Responses {
+		tmpl, err := template.New(method).Parse(text)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid mock response of %q", method)
+		}
+
+		p.responses[method] = tmpl
+	}
+
+	text := config.DefaultResult
+	if text == "" {
+		text = DefaultMockResult
+	}
+
+	tmpl, err := template.New("default").Parse(text)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid mock defaultResult")
+	}
+
+	p.defaultResult = tmpl
+
+	// Clients may compress requests, like they would for real nodes.
+	//
+	p.handler = middleware.Gunzip(http.HandlerFunc(p.serve))
+
+	return p, nil
+}
+
+// Do answers a JSON-RPC payload.
+func (p *MockProvider) Do(payload []byte) (json.RawMessage, error) {
+	requests, err := parseJSONRPCRequests(payload)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot parse request")
+	}
+
+	responses := make([]mockResponse, 0, len(requests))
+
+	for _, request := range requests {
+		response, err := p.respond(request)
+		if err != nil {
+			return nil, err
+		}
+
+		responses = append(responses, response)
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(payload), []byte("[")) {
+		return json.Marshal(responses)
+	}
+
+	return json.Marshal(responses[0])
+}
+
+func (p *MockProvider) respond(request JSONRPCRequest) (mockResponse, error) {
+	tmpl, ok := p.responses[request.Method]
+	if !ok {
+		tmpl = p.defaultResult
+	}
+
+	id := request.ID
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+
+	// String IDs are substituted without their quotes.
+	//
+	data := mockTemplateData{
+		ID:     string(id),
+		Method: request.Method,
+	}
+
+	if unquoted, err := strconv.Unquote(data.ID); err == nil {
+		data.ID = unquoted
+	}
+
+	var b strings.Builder
+
+	if err := tmpl.Execute(&b, data); err != nil {
+		return mockResponse{}, errors.Wrapf(err, "cannot execute mock response of %q", request.Method)
+	}
+
+	result := json.RawMessage(b.String())
+	if !json.Valid(result) {
+		result, _ = json.Marshal(b.String())
+	}
+
+	return mockResponse{
+		Jsonrpc: "2.0",
+		ID:      id,
+		Result:  result,
+	}, nil
+}
+
+func (p *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.handler.ServeHTTP(w, r)
+}
+
+func (p *MockProvider) serve(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(r.Body)
+	if err != nil {
+		middleware.WriteError(w, r, middleware.GatewayError{
+			StatusCode: http.StatusBadRequest,
+			Code:       middleware.JSONRPCErrorInvalidRequest,
+			Message:    "cannot read request body",
+			Reason:     "request_body_unreadable",
+		})
+
+		return
+	}
+
+	response, err := p.Do(payload)
+	if err != nil {
+		middleware.WriteError(w, r, middleware.GatewayError{
+			StatusCode: http.StatusBadRequest,
+			Code:       middleware.JSONRPCErrorInvalidRequest,
+			Message:    "invalid JSON-RPC request",
+			Reason:     "invalid_request",
+		})
+
+		return
+	}
+
+	w.Header().Set(headers.ContentType, "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(response) // nolint:errcheck
+}
+
+// RoundTrip implements http.RoundTripper, so the health checks can reach
+// mock targets.
+func (p *MockProvider) RoundTrip(r *http.Request) (*http.Response, error) {
+	var payload []byte
+
+	if r.Body != nil {
+		var err error
+
+		payload, err = io.ReadAll(r.Body)
+		r.Body.Close()
+
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot read request body")
+		}
+	}
+
+	response, err := p.Do(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			headers.ContentType:   []string{"application/json"},
+			headers.ContentLength: []string{strconv.Itoa(len(response))},
+		},
+		Body:          io.NopCloser(bytes.NewReader(response)),
+		ContentLength: int64(len(response)),
+		Request:       r,
+	}, nil
+}
+
+func (p *MockProvider) Close() error {
+	return nil
+}
@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpFailoverProxyServesMockTarget(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Mock",
+			Connection: NodeProviderConnectionConfig{
+				Mock: &NodeProviderConnectionMockConfig{
+					Responses: map[string]string{
+						"eth_chainId":          "0x1",
+						"eth_getBlockByNumber": `{"number":"0x{{ .ID }}","method":"{{ .Method }}"}`,
+						"web3_clientVersion":   "mock/{{ .ID }}",
+					},
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	tests := []struct {
+		name     string
+		payload  string
+		expected string
+	}{
+		{
+			name:     "method response",
+			payload:  `{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`,
+			expected: `{"jsonrpc":"2.0","id":1,"result":"0x1"}`,
+		},
+		{
+			name:     "json result",
+			payload:  `{"jsonrpc":"2.0","id":16,"method":"eth_getBlockByNumber","params":["latest",false]}`,
+			expected: `{"jsonrpc":"2.0","id":16,"result":{"number":"0x16","method":"eth_getBlockByNumber"}}`,
+		},
+		{
+			name:     "string id",
+			payload:  `{"jsonrpc":"2.0","id":"abc","method":"web3_clientVersion"}`,
+			expected: `{"jsonrpc":"2.0","id":"abc","result":"mock/abc"}`,
+		},
+		{
+			name:     "default result",
+			payload:  `{"jsonrpc":"2.0","id":2,"method":"eth_gasPrice"}`,
+			expected: `{"jsonrpc":"2.0","id":2,"result":"0x0"}`,
+		},
+		{
+			name:     "batch",
+			payload:  `[{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},{"jsonrpc":"2.0","id":2,"method":"eth_gasPrice"}]`,
+			expected: `[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"result":"0x0"}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.payload))
+			rr := httptest.NewRecorder()
+
+			httpFailoverProxy.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			assert.JSONEq(t, tt.expected, rr.Body.String())
+		})
+	}
+
+	// Every request went through an attempt to the mock target.
+	//
+	var metric dto.Metric
+	assert.NoError(t, httpFailoverProxy.metricRequestDuration.WithLabelValues("Mock", http.MethodPost, statusClass2xx, "").(prometheus.Histogram).Write(&metric))
+	assert.Equal(t, uint64(len(tests)), metric.GetHistogram().GetSampleCount())
+	assert.Equal(t, 5, testutil.CollectAndCount(httpFailoverProxy.metricResponseSize))
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":`))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"reason":"invalid_request"`)
+}
+
+func TestHealthCheckManagerChecksMockTarget(t *testing.T) {
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name: "Mock",
+				Connection: NodeProviderConnectionConfig{
+					Mock: &NodeProviderConnectionMockConfig{
+						Responses: map[string]string{
+							"eth_blockNumber": "0x10",
+						},
+					},
+				},
+			},
+		},
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Registerer: prometheus.NewRegistry(),
+	})
+	assert.NoError(t, err)
+
+	hc, err := hcm.GetTargetByName("Mock")
+	assert.NoError(t, err)
+
+	result, err := hc.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x10), result.BlockNumber)
+
+	assert.NoError(t, hcm.Stop(context.Background()))
+}
+
+func TestMockConnectionValidation(t *testing.T) {
+	_, err := NewNodeProvider(NodeProviderConfig{
+		Name: "Both",
+		Connection: NodeProviderConnectionConfig{
+			HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8545"},
+			Mock: &NodeProviderConnectionMockConfig{},
+		},
+	})
+	assert.Error(t, err)
+
+	_, err = NewNodeProvider(NodeProviderConfig{
+		Name: "Invalid",
+		Connection: NodeProviderConnectionConfig{
+			Mock: &NodeProviderConnectionMockConfig{DefaultResult: "{{ .ID"},
+		},
+	})
+	assert.Error(t, err)
+}
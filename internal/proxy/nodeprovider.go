@@ -4,39 +4,297 @@ import (
 	"net/http"
 	"net/http/httputil"
 	"strings"
+	"sync/atomic"
 
 	"github.com/0xProject/rpc-gateway/internal/middleware"
 	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
 )
 
 type NodeProviderConnectionHTTPConfig struct {
 	URL         string `yaml:"url"`
 	Compression bool   `yaml:"compression"`
+
+	// AcceptCompressedResponses asks the target for gzipped responses, which
+	// are decompressed for the clients not accepting gzip themselves.
+	AcceptCompressedResponses bool `yaml:"acceptCompressedResponses"`
+
+	// ForwardAuthorization forwards the Authorization header of the clients
+	// to the target, e.g. a node of ours behind an OAuth proxy. It's removed
+	// otherwise, so providers never see the credentials of the clients.
+	ForwardAuthorization bool `yaml:"forwardAuthorization"`
+
+	// URLTemplate replaces URL when it holds secrets, e.g.
+	// "https://eth-mainnet.g.alchemy.com/v2/{{ .APIKey }}". The placeholders
+	// are resolved from the secrets of the target.
+	URLTemplate string `yaml:"urlTemplate"`
+
+	// QueryParams are merged into the query of the target URL. Their values
+	// are templates too.
+	QueryParams map[string]string `yaml:"queryParams"`
+
+	// Transport tunes the connections to the target, for both the proxy
+	// and the health checks.
+	Transport NodeProviderTransportConfig `yaml:"transport"`
+
+	// Redirects sets how the redirects of the target are handled, passed
+	// through to the client by default.
+	Redirects NodeProviderRedirectsConfig `yaml:"redirects"`
 }
 
 type NodeProviderConnectionConfig struct {
 	HTTP NodeProviderConnectionHTTPConfig `yaml:"http"`
+
+	// IPC connects to the unix socket of a local node instead of HTTP.
+	IPC NodeProviderConnectionIPCConfig `yaml:"ipc"`
+
+	// Mock answers requests with static responses instead of forwarding
+	// them to a node.
+	Mock *NodeProviderConnectionMockConfig `yaml:"mock"`
+}
+
+func (c NodeProviderConnectionConfig) isIPC() bool {
+	return c.IPC.Path != ""
+}
+
+func (c NodeProviderConnectionConfig) isMock() bool {
+	return c.Mock != nil
+}
+
+func (c NodeProviderConnectionConfig) validate() error {
+	isHTTP := c.HTTP.URL != "" || c.HTTP.URLTemplate != ""
+
+	if c.isIPC() && isHTTP {
+		return errors.New("http and ipc connections are exclusive")
+	}
+
+	if c.isMock() && (isHTTP || c.isIPC()) {
+		return errors.New("mock connections exclude http and ipc")
+	}
+
+	if c.HTTP.URL != "" && c.HTTP.URLTemplate != "" {
+		return errors.New("url and urlTemplate are exclusive")
+	}
+
+	return c.HTTP.Redirects.validate()
 }
 
 type NodeProviderConfig struct {
 	Name       string                       `yaml:"name"`
 	Connection NodeProviderConnectionConfig `yaml:"connection"`
+
+	// Weight is used by the load balancing modes to prefer some targets over
+	// the others. Defaults to 1.
+	Weight uint `yaml:"weight"`
+
+	// Tier groups the targets into failover tiers, e.g. 1 for self-hosted
+	// nodes, 2 for paid providers and 3 for public endpoints. Requests only
+	// go to a tier when every target of the previous ones is unavailable,
+	// saturated or failed them, load balanced within a tier. Defaults to 1.
+	Tier uint `yaml:"tier"`
+
+	// MaxConcurrentRequests caps the number of requests in flight to the
+	// target. Zero means unlimited.
+	MaxConcurrentRequests uint `yaml:"maxConcurrentRequests"`
+
+	// DNS controls how the target hostname is resolved.
+	DNS NodeProviderDNSConfig `yaml:"dns"`
+
+	// WarmUp opens connections to the target ahead of traffic.
+	WarmUp NodeProviderWarmUpConfig `yaml:"warmUp"`
+
+	// HealthCheck selects how the target is health checked.
+	HealthCheck NodeProviderHealthCheckConfig `yaml:"healthCheck"`
+
+	// ErrorNormalizationRules are matched before the global rules, for
+	// error shapes specific to the target.
+	ErrorNormalizationRules []ErrorNormalizationRule `yaml:"errorNormalizationRules"`
+
+	// Faults are injected into the requests proxied to the target when
+	// proxy.faultInjection is enabled.
+	Faults FaultConfig `yaml:"faults"`
+
+	// Secrets maps the placeholders of the URL templates to the environment
+	// variables holding their values, e.g. APIKey: ALCHEMY_API_KEY.
+	Secrets map[string]string `yaml:"secrets"`
+
+	// UserAgent replaces proxy.userAgent for the target.
+	UserAgent string `yaml:"userAgent"`
+
+	// Capabilities restricts the target to these methods or method classes,
+	// a trailing "*" matching a prefix. Empty means every method.
+	Capabilities []string `yaml:"capabilities"`
+
+	// UnsupportedMethods are the methods or method classes the target can't
+	// serve, e.g. "traces" on a light node. Requests are never routed to a
+	// target for a method it doesn't support.
+	UnsupportedMethods []string `yaml:"unsupportedMethods"`
+
+	// MaintenanceWindows taint the target for the "maintenance" reason while
+	// one of them is active, and untaint it once they're all over.
+	MaintenanceWindows []MaintenanceWindowConfig `yaml:"maintenanceWindows"`
 }
 
-type NodeProvider struct {
-	Config NodeProviderConfig
-	Proxy  *httputil.ReverseProxy
+// Validate checks the configuration of the target without resolving its
+// URL nor connecting to it.
+func (c NodeProviderConfig) Validate() error {
+	if c.Name == "" {
+		return errors.New("target without a name")
+	}
+
+	isHTTP := c.Connection.HTTP.URL != "" || c.Connection.HTTP.URLTemplate != ""
+
+	if !isHTTP && !c.Connection.isIPC() && !c.Connection.isMock() {
+		return errors.Errorf("target %q has no connection", c.Name)
+	}
+
+	if err := c.Connection.validate(); err != nil {
+		return errors.Wrapf(err, "invalid target %q", c.Name)
+	}
+
+	if err := c.validateCapabilities(); err != nil {
+		return errors.Wrapf(err, "invalid target %q", c.Name)
+	}
+
+	if _, err := newMaintenanceWindows(c.MaintenanceWindows); err != nil {
+		return errors.Wrapf(err, "invalid target %q", c.Name)
+	}
+
+	return nil
 }
 
-func NewNodeProvider(config NodeProviderConfig) (*NodeProvider, error) {
+// Provider forwards requests to a node over a given transport.
+type Provider interface {
+	http.Handler
+
+	// Close releases the idle connections to the node.
+	Close() error
+}
+
+// HTTPProvider forwards requests to a node over HTTP.
+type HTTPProvider struct {
+	Proxy *httputil.ReverseProxy
+
+	compression      bool
+	acceptCompressed bool
+}
+
+func NewHTTPProvider(config NodeProviderConfig) (*HTTPProvider, error) {
 	proxy, err := NewNodeProviderProxy(config)
 	if err != nil {
 		return nil, err
 	}
 
+	return &HTTPProvider{
+		Proxy:            proxy,
+		compression:      config.Connection.HTTP.Compression,
+		acceptCompressed: config.Connection.HTTP.AcceptCompressedResponses,
+	}, nil
+}
+
+func (p *HTTPProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.acceptCompressed {
+		r = r.WithContext(withAcceptsGzip(r.Context(), acceptsGzip(r.Header)))
+	}
+
+	gzip := strings.Contains(r.Header.Get(headers.ContentEncoding), "gzip")
+
+	if !p.compression && gzip {
+		middleware.Gunzip(p.Proxy).ServeHTTP(w, r)
+
+		return
+	}
+
+	p.Proxy.ServeHTTP(w, r)
+}
+
+func (p *HTTPProvider) Close() error {
+	if t, ok := p.Proxy.Transport.(interface{ CloseIdleConnections() }); ok {
+		t.CloseIdleConnections()
+	}
+
+	return nil
+}
+
+type NodeProvider struct {
+	Config   NodeProviderConfig
+	Provider Provider
+
+	// Proxy is the reverse proxy of HTTP targets, nil for the other
+	// transports.
+	Proxy *httputil.ReverseProxy
+
+	// url is the resolved URL of the target, it may hold secrets.
+	url string
+
+	// faults is nil unless fault injection is enabled.
+	faults *faultInjector
+
+	// draining is set once the target stops accepting new requests, and
+	// drained once it's closed.
+	draining atomic.Bool
+	drained  atomic.Bool
+
+	// recentErrors keeps the last errors of the target, nil when disabled.
+	recentErrors *errorRing
+
+	// pending is the number of requests currently in flight.
+	pending atomic.Int64
+	// attempts counts the attempts made to the target since it started,
+	// and failures the failed ones.
+	attempts atomic.Uint64
+	failures atomic.Uint64
+	// latency is the moving average of the latency of the successful
+	// attempts, in nanoseconds, zero before the first one.
+	latency atomic.Int64
+	// permanentFailures counts the consecutive permanent failures of the
+	// target.
+	permanentFailures atomic.Uint32
+	// slots limits the requests in flight, nil when unlimited.
+	slots chan struct{}
+}
+
+func NewNodeProvider(config NodeProviderConfig) (*NodeProvider, error) {
+	if err := config.Connection.validate(); err != nil {
+		return nil, errors.Wrapf(err, "invalid target %q", config.Name)
+	}
+
+	if err := config.validateCapabilities(); err != nil {
+		return nil, errors.Wrapf(err, "invalid target %q", config.Name)
+	}
+
+	url, err := config.resolveURL()
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid target %q", config.Name)
+	}
+
 	nodeProvider := &NodeProvider{
 		Config: config,
-		Proxy:  proxy,
+		url:    url,
+	}
+
+	switch {
+	case config.Connection.isMock():
+		provider, err := NewMockProvider(*config.Connection.Mock)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid target %q", config.Name)
+		}
+
+		nodeProvider.Provider = provider
+	case config.Connection.isIPC():
+		nodeProvider.Provider = NewIPCProvider(config.Connection.IPC)
+	default:
+		provider, err := NewHTTPProvider(config)
+		if err != nil {
+			return nil, err
+		}
+
+		nodeProvider.Provider = provider
+		nodeProvider.Proxy = provider.Proxy
+	}
+
+	if config.MaxConcurrentRequests > 0 {
+		nodeProvider.slots = make(chan struct{}, config.MaxConcurrentRequests)
 	}
 
 	return nodeProvider, nil
@@ -46,14 +304,62 @@ func (n *NodeProvider) Name() string {
 	return n.Config.Name
 }
 
+func (n *NodeProvider) Weight() uint {
+	if n.Config.Weight == 0 {
+		return 1
+	}
+
+	return n.Config.Weight
+}
+
+func (n *NodeProvider) Tier() uint {
+	if n.Config.Tier == 0 {
+		return 1
+	}
+
+	return n.Config.Tier
+}
+
+// Pending returns the number of requests currently in flight.
+func (n *NodeProvider) Pending() int64 {
+	return n.pending.Load()
+}
+
+// TryAcquire reserves a concurrency slot without blocking. It returns false
+// when the target is saturated.
+func (n *NodeProvider) TryAcquire() bool {
+	if n.slots == nil {
+		return true
+	}
+
+	select {
+	case n.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees a slot reserved by TryAcquire.
+func (n *NodeProvider) Release() {
+	if n.slots == nil {
+		return
+	}
+
+	<-n.slots
+}
+
 func (n *NodeProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	gzip := strings.Contains(r.Header.Get(headers.ContentEncoding), "gzip")
+	if attempts := requestAttemptsFromContext(r.Context()); attempts != nil {
+		attempts.Observe(n.Name())
+	}
 
-	if !n.Config.Connection.HTTP.Compression && gzip {
-		middleware.Gunzip(n.Proxy).ServeHTTP(w, r)
+	n.pending.Add(1)
+	defer n.pending.Add(-1)
 
+	if n.faults != nil && n.faults.inject(w, r) {
 		return
 	}
 
-	n.Proxy.ServeHTTP(w, r)
+	n.Provider.ServeHTTP(w, r)
 }
@@ -5,11 +5,17 @@ import (
 	"net/http/httputil"
 	"net/url"
 
+	"github.com/go-http-utils/headers"
 	"github.com/pkg/errors"
 )
 
 func NewNodeProviderProxy(config NodeProviderConfig) (*httputil.ReverseProxy, error) {
-	target, err := url.Parse(config.Connection.HTTP.URL)
+	resolved, err := config.resolveURL()
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := url.Parse(resolved)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot parse url")
 	}
@@ -20,6 +26,22 @@ func NewNodeProviderProxy(config NodeProviderConfig) (*httputil.ReverseProxy, er
 		r.URL.Scheme = target.Scheme
 		r.URL.Host = target.Host
 		r.URL.Path = target.Path
+
+		// The request is a copy, the next target of a reroute still gets
+		// the header when it's forwarded there.
+		//
+		if !config.Connection.HTTP.ForwardAuthorization {
+			r.Header.Del(headers.Authorization)
+		}
+
+		if target.RawQuery != "" {
+			query := r.URL.Query()
+			for name, values := range target.Query() {
+				query[name] = values
+			}
+
+			r.URL.RawQuery = query.Encode()
+		}
 	}
 
 	return proxy, nil
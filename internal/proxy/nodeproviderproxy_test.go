@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardAuthorizationOnlyToFlaggedTargets(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []bool
+	}{
+		{"rerouted to the flagged target", []bool{false, true}},
+		{"rerouted from the flagged target", []bool{true, false}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+			var (
+				mu       sync.Mutex
+				received = map[string]string{}
+			)
+
+			config := createConfig()
+
+			for i, forward := range tt.forwarded {
+				name := []string{"Server1", "Server2"}[i]
+				first := i == 0
+
+				node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					mu.Lock()
+					received[name] = r.Header.Get("Authorization")
+					mu.Unlock()
+
+					// The first target fails, so the request is rerouted to
+					// the second one.
+					//
+					if first {
+						http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+
+						return
+					}
+
+					w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+				}))
+				t.Cleanup(node.Close)
+
+				config.Targets = append(config.Targets, NodeProviderConfig{
+					Name: name,
+					Connection: NodeProviderConnectionConfig{
+						HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL, ForwardAuthorization: forward},
+					},
+				})
+			}
+
+			p := newTestFailoverProxy(t, config)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+			req.Header.Set("Authorization", "Bearer client-token")
+
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Len(t, received, 2)
+
+			for i, forward := range tt.forwarded {
+				name := []string{"Server1", "Server2"}[i]
+
+				if forward {
+					assert.Equal(t, "Bearer client-token", received[name], name)
+				} else {
+					assert.Empty(t, received[name], name)
+				}
+			}
+		})
+	}
+}
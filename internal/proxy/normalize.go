@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/go-http-utils/headers"
+)
+
+//nolint:gochecknoglobals
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// whitespace is the one allowed around JSON values.
+const whitespace = " \t\r\n"
+
+// acceptContentType refuses the requests whose content type is clearly not
+// JSON, like XML or forms with files. It reports whether r is accepted.
+// Clients often send no content type or a generic one, those are accepted.
+// JSON variants are forwarded as plain "application/json", since providers
+// don't all accept the charset parameter.
+func (p *Proxy) acceptContentType(w http.ResponseWriter, r *http.Request) bool {
+	contentType := r.Header.Get(headers.ContentType)
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "application/json") || strings.HasSuffix(mediaType, "+json"):
+		if contentType != "application/json" {
+			r.Header.Set(headers.ContentType, "application/json")
+		}
+
+		return true
+	case strings.HasSuffix(mediaType, "xml"), mediaType == "text/html", strings.HasPrefix(mediaType, "multipart/"):
+		p.writeError(w, r, middleware.GatewayError{
+			StatusCode: http.StatusUnsupportedMediaType,
+			Code:       middleware.JSONRPCErrorInvalidRequest,
+			Message:    "content type " + mediaType + " not supported, JSON-RPC requests are sent as application/json",
+			Reason:     "unsupported_content_type",
+		})
+
+		return false
+	default:
+		return true
+	}
+}
+
+// normalizeBody strips a UTF-8 BOM and the surrounding whitespace from the
+// body of r, which some providers refuse. Compressed bodies are left as
+// they are. The content length of the attempts follows the body.
+func normalizeBody(r *http.Request, body *bytes.Buffer) {
+	if r.Header.Get(headers.ContentEncoding) != "" {
+		return
+	}
+
+	b := body.Bytes()
+
+	start := bytes.TrimLeft(bytes.TrimPrefix(bytes.TrimLeft(b, whitespace), utf8BOM), whitespace)
+	trimmed := bytes.TrimRight(start, whitespace)
+
+	if len(trimmed) == len(b) {
+		return
+	}
+
+	body.Next(len(b) - len(start))
+	body.Truncate(len(trimmed))
+
+	r.ContentLength = int64(len(trimmed))
+}
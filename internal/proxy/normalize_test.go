@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/go-http-utils/headers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receivedRequest is what the upstream of the normalization tests got.
+type receivedRequest struct {
+	Body          string `json:"body"`
+	ContentType   string `json:"contentType"`
+	ContentLength string `json:"contentLength"`
+}
+
+func newNormalizationTestProxy(t *testing.T) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		json.NewEncoder(w).Encode(receivedRequest{ // nolint:errcheck
+			Body:          string(body),
+			ContentType:   r.Header.Get(headers.ContentType),
+			ContentLength: strconv.FormatInt(r.ContentLength, 10),
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: server.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, config)
+}
+
+func TestHttpFailoverProxyNormalizesRequests(t *testing.T) {
+	const payload = `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`
+
+	p := newNormalizationTestProxy(t)
+
+	for _, tc := range []struct {
+		name        string
+		body        string
+		contentType string
+		expected    string
+	}{
+		{name: "bom", body: "\xef\xbb\xbf" + payload, contentType: "application/json", expected: "application/json"},
+		{name: "charset", body: payload, contentType: "application/json; charset=UTF-8", expected: "application/json"},
+		{name: "trailing newline", body: payload + "\r\n\n", contentType: "application/json", expected: "application/json"},
+		{name: "surrounding whitespace", body: "\n \xef\xbb\xbf\t" + payload + " ", expected: ""},
+		{name: "generic content type", body: payload, contentType: "text/plain", expected: "text/plain"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set(headers.ContentType, tc.contentType)
+			}
+
+			rr := httptest.NewRecorder()
+			p.ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+
+			var received receivedRequest
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &received))
+
+			assert.Equal(t, payload, received.Body)
+			assert.Equal(t, strconv.Itoa(len(payload)), received.ContentLength)
+			assert.Equal(t, tc.expected, received.ContentType)
+		})
+	}
+}
+
+func TestHttpFailoverProxyRefusesWrongContentType(t *testing.T) {
+	p := newNormalizationTestProxy(t)
+
+	for _, contentType := range []string{"text/xml", "application/soap+xml; charset=utf-8", "multipart/form-data"} {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":7,"method":"eth_blockNumber"}`))
+		req.Header.Set(headers.ContentType, contentType)
+
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code, contentType)
+		assert.Contains(t, rr.Body.String(), `"reason":"unsupported_content_type"`)
+	}
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultNotFoundCacheTTL is how long a null result is cached when no ttl
+// is configured.
+const DefaultNotFoundCacheTTL = time.Second
+
+// NotFoundCacheConfig caches the null results of methods polled until they
+// find something, e.g. the receipts of pending transactions. Error responses
+// are never cached.
+type NotFoundCacheConfig struct {
+	// Methods whose null results are cached. Disabled when empty.
+	Methods []string `yaml:"methods"`
+
+	// TTL is how long a null result is cached. It's dropped before when the
+	// highest block number observed by the health checks advances. Defaults
+	// to 1s.
+	TTL time.Duration `yaml:"ttl"`
+}
+
+func (c NotFoundCacheConfig) validate() error {
+	if c.TTL < 0 {
+		return errors.New("not found cache ttl can't be negative")
+	}
+
+	return nil
+}
+
+type notFoundCache struct {
+	methods map[string]bool
+	ttl     time.Duration
+}
+
+func newNotFoundCache(config NotFoundCacheConfig) notFoundCache {
+	c := notFoundCache{
+		methods: map[string]bool{},
+		ttl:     config.TTL,
+	}
+
+	if c.ttl == 0 {
+		c.ttl = DefaultNotFoundCacheTTL
+	}
+
+	for _, method := range config.Methods {
+		c.methods[method] = true
+	}
+
+	return c
+}
+
+func (c notFoundCache) applies(method string) bool {
+	return c.methods[method]
+}
+
+// notFoundKey returns the key of a null result observed at head. Once the
+// head advances, the keys change and the results observed before are missed.
+func notFoundKey(key string, head uint64) string {
+	return "notfound " + strconv.FormatUint(head, 10) + " " + key
+}
+
+// getNotFound reports whether a null result is cached under key at head.
+func (c *immutableCache) getNotFound(ctx context.Context, key string, head uint64) bool {
+	_, ok, _ := c.local.Get(ctx, notFoundKey(key, head))
+
+	return ok
+}
+
+// addNotFound caches a null result under key at head.
+func (c *immutableCache) addNotFound(ctx context.Context, key string, head uint64) {
+	c.local.Set(ctx, notFoundKey(key, head), nil, c.notFound.ttl) // nolint:errcheck
+}
+
+// head returns the highest block number observed by the health checks, zero
+// when unknown.
+func (p *Proxy) head() uint64 {
+	return p.hcm.MaxBlockNumber()
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newNotFoundCacheTestProxy(t *testing.T, response *atomic.Value, calls *atomic.Int64) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Write([]byte(response.Load().(string)))
+	}))
+	t.Cleanup(server.Close)
+
+	config := createConfig()
+	config.Proxy.ImmutableCache = ImmutableCacheConfig{
+		MaxEntries: 10,
+		NotFound: NotFoundCacheConfig{
+			Methods: []string{"eth_getTransactionReceipt"},
+			TTL:     time.Minute,
+		},
+	}
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: server.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, config)
+}
+
+func setTestHead(t *testing.T, p *Proxy, head uint64) {
+	t.Helper()
+
+	hc, err := p.hcm.GetTargetByName("Server1")
+	assert.NoError(t, err)
+
+	hc.mu.Lock()
+	hc.context, hc.blockNumberObservedAt = HealthContext{HealthContextBlockNumber: head}, time.Now()
+	hc.mu.Unlock()
+}
+
+func TestHttpFailoverProxyNotFoundCache(t *testing.T) {
+	var (
+		calls    atomic.Int64
+		response atomic.Value
+	)
+
+	response.Store(`{"jsonrpc":"2.0","id":1,"result":null}`)
+
+	p := newNotFoundCacheTestProxy(t, &response, &calls)
+	setTestHead(t, p, 100)
+
+	// A wallet polls the receipt of its pending transaction.
+	//
+	for i := 0; i < 10; i++ {
+		rr := serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", "1", 1))
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":null}`, rr.Body.String())
+	}
+
+	assert.Equal(t, int64(1), calls.Load())
+	assert.Equal(t, 9.0, testutil.ToFloat64(p.metricImmutableCache.WithLabelValues("eth_getTransactionReceipt", "negative_hit")))
+
+	// The transaction is mined in the next block, the receipt is found on
+	// the first poll once the head advances.
+	//
+	response.Store(`{"jsonrpc":"2.0","id":1,"result":` + minedReceipt + `}`)
+	setTestHead(t, p, 101)
+
+	for i := 0; i < 3; i++ {
+		rr := serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", "1", 1))
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":`+minedReceipt+`}`, rr.Body.String())
+	}
+
+	assert.Equal(t, int64(2), calls.Load())
+}
+
+func TestHttpFailoverProxyNotFoundCacheSkipsErrors(t *testing.T) {
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"},"result":null}`,
+		`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"header not found"}}`,
+		`not json`,
+	} {
+		var (
+			calls    atomic.Int64
+			response atomic.Value
+		)
+
+		response.Store(body)
+
+		p := newNotFoundCacheTestProxy(t, &response, &calls)
+
+		serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", "1", 1))
+		serveImmutableCacheRequest(p, strings.Replace(receiptRequest, "%s", "1", 1))
+
+		assert.Equal(t, int64(2), calls.Load(), body)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	clock := newFakeClock()
+	cache := newMemoryCache(10, 1024, clock)
+	ctx := context.Background()
+
+	cache.Set(ctx, "pending", nil, time.Second)
+	cache.Set(ctx, "final", []byte(`"0x1"`), 0)
+
+	clock.Advance(999 * time.Millisecond)
+
+	_, ok, _ := cache.Get(ctx, "pending")
+	assert.True(t, ok)
+
+	clock.Advance(time.Millisecond)
+
+	_, ok, _ = cache.Get(ctx, "pending")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.lru.Len())
+
+	_, ok, _ = cache.Get(ctx, "final")
+	assert.True(t, ok)
+}
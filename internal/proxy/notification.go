@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+)
+
+// IsNotification reports whether the request is a notification, i.e. a call
+// of a method without id. A null id is still a request expecting a response.
+func (r JSONRPCRequest) IsNotification() bool {
+	return r.ID == nil && r.Method != ""
+}
+
+// isNotificationOnly reports whether requests are all notifications, so the
+// provider isn't expected to answer anything.
+func isNotificationOnly(requests []JSONRPCRequest) bool {
+	if len(requests) == 0 {
+		return false
+	}
+
+	for _, request := range requests {
+		if !request.IsNotification() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// serveNotification passes the response of target to a notification through
+// as it is. A notification is fire-and-forget, rerouting it would deliver it
+// again to another provider.
+func (p *Proxy) serveNotification(
+	w http.ResponseWriter,
+	target *NodeProvider,
+	pw *ReponseWriter,
+	err error,
+	start time.Time,
+	state *failoverState,
+) {
+	if p.HasNodeProviderFailed(pw.statusCode) {
+		p.hcm.ObserveFailure(target.Name(), state.class)
+		p.observeError(target, state.requests, pw, err)
+	} else {
+		p.hcm.ObserveSuccess(target.Name(), state.class)
+	}
+
+	p.observeResponse(target.Name(), state.requests, pw.body.Len(), time.Since(start))
+	p.writeResponse(w, pw, state.requests)
+	p.buffers.Put(pw.body)
+}
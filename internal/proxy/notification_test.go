@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsNotificationOnly(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		payload  string
+		expected bool
+	}{
+		{"notification", `{"jsonrpc":"2.0","method":"eth_subscribe"}`, true},
+		{"request", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, false},
+		{"null id", `{"jsonrpc":"2.0","id":null,"method":"eth_blockNumber"}`, false},
+		{"notification batch", `[{"jsonrpc":"2.0","method":"a"},{"jsonrpc":"2.0","method":"b"}]`, true},
+		{"mixed batch", `[{"jsonrpc":"2.0","method":"a"},{"jsonrpc":"2.0","id":1,"method":"b"}]`, false},
+		{"empty batch", `[]`, false},
+		{"not JSON-RPC", `{"this_is":"body"}`, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			requests, err := parseJSONRPCRequests([]byte(tc.payload))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, isNotificationOnly(requests))
+		})
+	}
+}
+
+func TestHttpFailoverProxyNotification(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		payload string
+		status  int
+	}{
+		{"empty response", `{"jsonrpc":"2.0","method":"eth_blockNumber"}`, http.StatusNoContent},
+		{"failed response", `{"jsonrpc":"2.0","method":"eth_blockNumber"}`, http.StatusServiceUnavailable},
+		{"batch", `[{"jsonrpc":"2.0","method":"a"},{"jsonrpc":"2.0","method":"b"}]`, http.StatusNoContent},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+			var primaryCalls, secondaryCalls atomic.Int64
+
+			primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				primaryCalls.Add(1)
+				w.WriteHeader(tc.status)
+			}))
+			defer primary.Close()
+
+			secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				secondaryCalls.Add(1)
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer secondary.Close()
+
+			config := createConfig()
+			config.Proxy.Retry = RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond}
+			config.Targets = []NodeProviderConfig{
+				{
+					Name:       "Server1",
+					Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: primary.URL}},
+				},
+				{
+					Name:       "Server2",
+					Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: secondary.URL}},
+				},
+			}
+
+			httpFailoverProxy := newTestFailoverProxy(t, config)
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tc.payload))
+			rr := httptest.NewRecorder()
+
+			httpFailoverProxy.ServeHTTP(rr, req)
+
+			assert.Equal(t, tc.status, rr.Code)
+			assert.Empty(t, rr.Body.String())
+			assert.Equal(t, int64(1), primaryCalls.Load())
+			assert.Equal(t, int64(0), secondaryCalls.Load())
+			assert.Equal(t, 0.0,
+				testutil.ToFloat64(httpFailoverProxy.metricRequestErrors.WithLabelValues("Server1", "rerouted", "Server2", "")))
+
+			var metric dto.Metric
+			assert.NoError(t, httpFailoverProxy.metricResponseSize.WithLabelValues("Server1", "notification").(prometheus.Histogram).Write(&metric))
+			assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultMisconfiguredTaintDuration is how long a target failing permanently
+// is tainted when no taintDuration is configured.
+const DefaultMisconfiguredTaintDuration = 5 * time.Minute
+
+// PermanentFailuresConfig taints the targets whose attempts keep failing in
+// a way that never succeeds on retry, e.g. a wrong URL, until they're fixed.
+type PermanentFailuresConfig struct {
+	// TaintAfter is the number of consecutive permanent failures after which
+	// the target is tainted for the "misconfigured" reason. Zero disables
+	// the taint, the permanent failures still fail over at once.
+	TaintAfter uint32 `yaml:"taintAfter"`
+
+	// TaintDuration is how long the target is tainted. Defaults to 5m.
+	TaintDuration time.Duration `yaml:"taintDuration"`
+}
+
+func (c PermanentFailuresConfig) validate() error {
+	if c.TaintDuration < 0 {
+		return errors.New("permanent failures taintDuration cannot be negative")
+	}
+
+	return nil
+}
+
+func (c PermanentFailuresConfig) taintDuration() time.Duration {
+	if c.TaintDuration == 0 {
+		return DefaultMisconfiguredTaintDuration
+	}
+
+	return c.TaintDuration
+}
+
+// isPermanentStatus reports whether the upstream status code means the
+// target is misconfigured, JSON-RPC endpoints answer every POST otherwise.
+func isPermanentStatus(statusCode int) bool {
+	return statusCode == http.StatusNotFound || statusCode == http.StatusMethodNotAllowed
+}
+
+// isPermanentTransportError reports whether err won't go away by retrying
+// the same target: a certificate it can't be trusted with, or a host that
+// doesn't exist.
+func isPermanentTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	switch classifyTransportError(err).Type {
+	case TransportErrorCertExpired,
+		TransportErrorUnknownAuthority,
+		TransportErrorHostnameMismatch,
+		TransportErrorCertInvalid,
+		TransportErrorDNSNotFound:
+		return true
+	}
+
+	return false
+}
+
+// isPermanentFailure reports whether an attempt failed in a way retrying the
+// same target can't fix.
+func isPermanentFailure(statusCode int, err error) bool {
+	if err != nil {
+		return isPermanentTransportError(err)
+	}
+
+	return isPermanentStatus(statusCode)
+}
+
+// observePermanentFailures counts the consecutive permanent failures of the
+// target, and taints it once there are too many. Any other outcome starts
+// over.
+func (p *Proxy) observePermanentFailures(target *NodeProvider, permanent bool) {
+	if !permanent {
+		target.permanentFailures.Store(0)
+
+		return
+	}
+
+	threshold := p.permanent.TaintAfter
+	if threshold == 0 || target.permanentFailures.Add(1) < threshold {
+		return
+	}
+
+	target.permanentFailures.Store(0)
+
+	if err := p.hcm.Taint(target.Name(), TaintReasonMisconfigured, p.permanent.taintDuration()); err != nil {
+		p.logger.Warn("cannot taint misconfigured target", "provider", target.Name(), "error", err)
+	}
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryTransportDoesNotRetryPermanentFailures(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusMethodNotAllowed} {
+		var calls atomic.Int64
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(status)
+		}))
+
+		transport := newTestRetryTransport(RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond})
+
+		resp, err := transport.RoundTrip(newRetryRequest(t, context.Background(), server.URL))
+		assert.NoError(t, err)
+
+		resp.Body.Close()
+		server.Close()
+
+		assert.Equal(t, status, resp.StatusCode)
+		assert.Equal(t, int64(1), calls.Load(), status)
+		assert.Equal(t, 1.0, testutil.ToFloat64(transport.metricAttempts.WithLabelValues("Server1", attemptPermanent)))
+	}
+
+	// The certificate of the server isn't trusted by the default transport.
+	//
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	transport := newTestRetryTransport(RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	_, err := transport.RoundTrip(newRetryRequest(t, context.Background(), server.URL))
+	assert.Error(t, err)
+	assert.Equal(t, 1.0, testutil.ToFloat64(transport.metricAttempts.WithLabelValues("Server1", attemptPermanent)))
+	assert.Equal(t, 0.0, testutil.ToFloat64(transport.metricAttempts.WithLabelValues("Server1", attemptNetworkErr)))
+}
+
+func TestPermanentFailuresRerouteAndTaint(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var (
+		calls  [2]atomic.Int64
+		status atomic.Int64
+	)
+
+	status.Store(http.StatusNotFound)
+
+	config := createConfig()
+	config.Proxy.Retry = RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond}
+	config.Proxy.PermanentFailures = PermanentFailuresConfig{TaintAfter: 3}
+
+	for i := range calls {
+		i := i
+
+		node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls[i].Add(1)
+
+			if i == 0 && status.Load() != http.StatusOK {
+				w.WriteHeader(int(status.Load()))
+
+				return
+			}
+
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+		}))
+		t.Cleanup(node.Close)
+
+		config.Targets = append(config.Targets, NodeProviderConfig{
+			Name:       []string{"Server1", "Server2"}[i],
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		})
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	serve := func() {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	// Every 404 is attempted once, then rerouted.
+	//
+	serve()
+	serve()
+
+	assert.Equal(t, int64(2), calls[0].Load())
+	assert.Equal(t, int64(2), calls[1].Load())
+
+	// Any other outcome starts the count over.
+	//
+	status.Store(http.StatusOK)
+	serve()
+
+	status.Store(http.StatusNotFound)
+	serve()
+	serve()
+	assert.False(t, p.hcm.isTargetTainted("Server1"))
+
+	serve()
+	assert.True(t, p.hcm.isTargetTainted("Server1"))
+
+	taints, err := p.hcm.Taints("Server1")
+	require.NoError(t, err)
+	require.Len(t, taints, 1)
+	assert.Equal(t, TaintReasonMisconfigured, taints[0].Reason)
+	assert.NotNil(t, taints[0].Until)
+
+	// Tainted, the target isn't attempted anymore.
+	//
+	serve()
+
+	assert.Equal(t, int64(6), calls[0].Load())
+	assert.Equal(t, int64(6), calls[1].Load())
+}
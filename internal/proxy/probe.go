@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// HealthCheckProbe is a JSON-RPC call made by the health checks. Probes
+// replace the built-in `eth_blockNumber` and `eth_call` checks, so chains
+// without the eth namespace can be health checked.
+type HealthCheckProbe struct {
+	Method string        `yaml:"method"`
+	Params []interface{} `yaml:"params"`
+
+	// HeightPath locates the chain height in the result, "$" being the
+	// result itself, e.g. "$" for `getSlot` or "$.context.slot". Array
+	// elements are selected by index. Empty when the probe doesn't report a
+	// height.
+	HeightPath string `yaml:"heightPath"`
+
+	// Required probes have to succeed for the target to be healthy.
+	Required bool `yaml:"required"`
+}
+
+// validateProbes checks that at least one configured probe is required, as
+// the others never fail a check and a dead target would stay healthy.
+func validateProbes(probes []HealthCheckProbe) error {
+	if len(probes) == 0 {
+		return nil
+	}
+
+	for _, probe := range probes {
+		if probe.Required {
+			return nil
+		}
+	}
+
+	return errors.New("at least one probe must be required, otherwise a dead target stays healthy")
+}
+
+func (h *HealthChecker) runProbe(c context.Context, probe HealthCheckProbe) (uint64, error) {
+	params := make([]interface{}, 0, len(probe.Params))
+	for _, param := range probe.Params {
+		params = append(params, jsonCompatible(param))
+	}
+
+	var result json.RawMessage
+
+	if err := h.client.CallContext(c, &result, probe.Method, params...); err != nil {
+		return 0, errors.Wrapf(err, "probe %q", probe.Method)
+	}
+
+	if probe.HeightPath == "" {
+		return 0, nil
+	}
+
+	height, err := extractHeight(result, probe.HeightPath)
+	if err != nil {
+		return 0, errors.Wrapf(err, "probe %q", probe.Method)
+	}
+
+	h.logger.Debug("probe completed", "method", probe.Method, "height", height)
+
+	return height, nil
+}
+
+// extractHeight follows path in a JSON document and parses the value found
+// as a number, a decimal string or a hex string.
+func extractHeight(document json.RawMessage, path string) (uint64, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(document)))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return 0, errors.Wrap(err, "cannot decode result")
+	}
+
+	if !strings.HasPrefix(path, "$") {
+		return 0, errors.Errorf("height path %q must start with $", path)
+	}
+
+	if path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), "."); path != "" {
+		for _, key := range strings.Split(path, ".") {
+			switch v := value.(type) {
+			case map[string]interface{}:
+				value = v[key]
+			case []interface{}:
+				index, err := strconv.Atoi(key)
+				if err != nil || index < 0 || index >= len(v) {
+					return 0, errors.Errorf("no element %q in the result", path)
+				}
+
+				value = v[index]
+			default:
+				return 0, errors.Errorf("no element %q in the result", path)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		height, err := strconv.ParseUint(v.String(), 10, 64)
+
+		return height, errors.Wrap(err, "invalid height")
+	case string:
+		if strings.HasPrefix(v, "0x") {
+			return hexToUint(v)
+		}
+
+		height, err := strconv.ParseUint(v, 10, 64)
+
+		return height, errors.Wrap(err, "invalid height")
+	default:
+		return 0, errors.Errorf("invalid height %v", value)
+	}
+}
+
+// jsonCompatible converts the maps decoded by yaml.v2, keyed by interface{},
+// to maps encoding/json can marshal.
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(value)
+		}
+
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = jsonCompatible(value)
+		}
+
+		return s
+	default:
+		return value
+	}
+}
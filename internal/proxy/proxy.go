@@ -2,62 +2,396 @@ package proxy
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"log/slog"
+	"math"
 	"net/http"
-	"strconv"
+	"sync"
 	"time"
 
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/hashicorp/go-multierror"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
+// ErrMissingHealthCheckManager is returned by NewProxy without a
+// HealthcheckManager.
+var ErrMissingHealthCheckManager = errors.New("missing health check manager")
+
 type Proxy struct {
-	targets []*NodeProvider
-	hcm     *HealthCheckManager
-	timeout time.Duration
+	targets        []*NodeProvider
+	ring           *hashRing
+	wrr            *WeightedRoundRobin
+	queue          *admissionQueue
+	buffers        *bufferPool
+	classifier     *methodClassifier
+	knownMethods   map[string]struct{}
+	selector       TargetSelector
+	hcm            *HealthCheckManager
+	timeout        time.Duration
+	requestTimeout time.Duration
+	loadBalancing  string
+	clientHeader   string
+	clock          Clock
+	maxBodySize    int64
+	warmers        []*connectionWarmer
+	canary         CanaryConfig
+	normalizer     *errorNormalizer
+	slowQueryLog   SlowQueryLogConfig
+	debugTrace     DebugTraceConfig
+	errorAttempts  bool
+	statusPolicy   StatusPolicyConfig
+	errorActions   JSONRPCErrorActionsConfig
+	retry          RetryConfig
+	computeUnits   ComputeUnitsConfig
+	allowGet       bool
+	overridable    bool
+	immutableCache *immutableCache
+	cacheControl   CacheControlConfig
+	stream         StreamConfig
+	scoring        ScoreConfig
+	clients        *clientLabeler
+	debugSampler   *debugSampler
+	breaker        *failoverBreaker
+	permanent      PermanentFailuresConfig
+	logger         *slog.Logger
+
+	metricRequestDuration     *prometheus.HistogramVec
+	metricRequestErrors       *prometheus.CounterVec
+	metricAttemptsPerRequest  prometheus.Histogram
+	metricProvidersPerRequest prometheus.Histogram
+	metricInflightRequests    *prometheus.GaugeVec
+	metricEffectiveWeight     *prometheus.GaugeVec
+	metricQueueDepth          prometheus.Gauge
+	metricRequestsShed        *prometheus.CounterVec
+	metricCanaryRequests      *prometheus.CounterVec
+	metricErrorsNormalized    *prometheus.CounterVec
+	metricResponseSize        *prometheus.HistogramVec
+	metricUpstreamAttempts    *prometheus.CounterVec
+	metricUpstreamRedirects   *prometheus.CounterVec
+	metricFaultsInjected      *prometheus.CounterVec
+	metricComputeUnits        *prometheus.CounterVec
+	metricErrorActions        *prometheus.CounterVec
+
+	metricInvalidClientOverrides *prometheus.CounterVec
+	metricImmutableCache         *prometheus.CounterVec
+	metricCacheBackendErrors     *prometheus.CounterVec
+	metricConnections            *connectionMetrics
+	metricConfiguredTargets      prometheus.Gauge
+	metricActiveTier             prometheus.GaugeFunc
+	metricFailoverBreakerOpen    prometheus.Gauge
+
+	// drains tracks the targets being drained.
+	drains sync.WaitGroup
+
+	// canaries tracks the canary requests in flight.
+	canaries sync.WaitGroup
+
+	// closed is set once the proxy shuts down, no background work is
+	// started after, so it's safe to wait for drains and canaries.
+	closed   bool
+	closedMu sync.Mutex
 
-	metricRequestDuration *prometheus.HistogramVec
-	metricRequestErrors   *prometheus.CounterVec
+	// preferred is the index of the target preferred by the "score" mode,
+	// -1 when there's none yet.
+	preferred int
+	scoreMu   sync.Mutex
 }
 
 func NewProxy(config Config) (*Proxy, error) {
+	if err := config.Metrics.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid metrics config")
+	}
+
+	// Every request looks its targets up in the health check manager.
+	//
+	if config.HealthcheckManager == nil {
+		return nil, ErrMissingHealthCheckManager
+	}
+
+	if err := validateLoadBalancing(config.Proxy.LoadBalancing); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.Score.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.FaultInjection.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.DebugTrace.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.StatusPolicy.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.JSONRPCErrorActions.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.ComputeUnits.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.CacheControl.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.ImmutableCache.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.CacheBackend.Redis.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.DebugSampling.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.PermanentFailures.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.FailoverBreaker.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	if err := config.Proxy.Stream.validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	clients, err := newClientLabeler(config.Proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	factory := promauto.With(registererOrDefault(config.Registerer))
+
 	proxy := &Proxy{
-		hcm:     config.HealthcheckManager,
-		timeout: config.Proxy.UpstreamTimeout,
-		metricRequestDuration: promauto.NewHistogramVec(
+		hcm:            config.HealthcheckManager,
+		timeout:        config.Proxy.UpstreamTimeout,
+		requestTimeout: config.Proxy.RequestTimeout,
+		loadBalancing:  config.Proxy.LoadBalancing,
+		clientHeader:   config.Proxy.ClientHashHeader,
+		clock:          systemClock{},
+		queue:          newAdmissionQueue(config.Proxy.Queue),
+		buffers:        newBufferPool(),
+		classifier:     newMethodClassifier(config.Proxy.MethodClasses),
+		selector:       config.TargetSelector,
+		maxBodySize:    config.Proxy.MaxRequestBodySize,
+		canary:         config.HealthChecks.Canary,
+		normalizer:     newErrorNormalizer(config.Proxy.ErrorNormalization, config.Targets),
+		slowQueryLog:   config.Proxy.SlowQueryLog,
+		debugTrace:     config.Proxy.DebugTrace,
+		errorAttempts:  config.Proxy.AttemptsInErrors,
+		statusPolicy:   config.Proxy.StatusPolicy,
+		permanent:      config.Proxy.PermanentFailures,
+		errorActions:   newJSONRPCErrorActions(config.Proxy.JSONRPCErrorActions, config.Proxy.Retry),
+		retry:          config.Proxy.Retry,
+		computeUnits:   config.Proxy.ComputeUnits,
+		allowGet:       config.Proxy.AllowGet,
+		overridable:    config.Proxy.AllowClientOverrides,
+		immutableCache: newImmutableCache(config.Proxy.ImmutableCache, config.Proxy.CacheBackend, systemClock{}),
+		cacheControl:   config.Proxy.CacheControl,
+		stream:         config.Proxy.Stream,
+		scoring:        config.Proxy.Score,
+		preferred:      -1,
+		clients:        clients,
+		logger:         config.Logger,
+		metricRequestDuration: factory.NewHistogramVec(
 			prometheus.HistogramOpts{
-				Name: "zeroex_rpc_gateway_request_duration_seconds",
-				Help: "Histogram of response time for Gateway in seconds",
-				Buckets: []float64{
-					.025,
-					.05,
-					.1,
-					.25,
-					.5,
-					1,
-					2.5,
-					5,
-					10,
-					15,
-					20,
-					25,
-					30,
-				},
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_request_duration_seconds",
+				Help:      "Histogram of response time for Gateway in seconds",
+				Buckets:   config.Metrics.Buckets(),
 			}, []string{
 				"provider",
 				"method",
 				"status_code",
+				"client",
 			}),
-		metricRequestErrors: promauto.NewCounterVec(
+		metricRequestErrors: factory.NewCounterVec(
 			prometheus.CounterOpts{
-				Name: "zeroex_rpc_gateway_request_errors_handled_total",
-				Help: "The total number of request errors handled by gateway",
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_request_errors_handled_total",
+				Help:      "The total number of request errors handled by gateway",
 			}, []string{
 				"provider",
 				"type",
+				"destination",
+				"client",
+			}),
+		metricAttemptsPerRequest: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_attempts_per_request",
+				Help:      "Histogram of upstream attempts made for a single request",
+				Buckets:   prometheus.LinearBuckets(1, 1, 10),
+			}),
+		metricProvidersPerRequest: factory.NewHistogram(
+			prometheus.HistogramOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_providers_visited_per_request",
+				Help:      "Histogram of distinct providers visited for a single request",
+				Buckets:   prometheus.LinearBuckets(1, 1, 10),
+			}),
+		metricInflightRequests: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_inflight_requests",
+				Help:      "The number of requests currently in flight to a given provider",
+			}, []string{
+				"provider",
+			}),
+		metricEffectiveWeight: factory.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_provider_effective_weight",
+				Help:      "The current effective weight of a given provider in the weightedRoundRobin mode",
+			}, []string{
+				"provider",
+			}),
+		metricQueueDepth: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_queue_depth",
+				Help:      "The number of requests waiting for a saturated provider",
+			}),
+		metricRequestsShed: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_requests_shed_total",
+				Help:      "The total number of requests rejected because every provider was saturated",
+			}, []string{
+				"reason",
+			}),
+		metricCanaryRequests: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_canary_requests_total",
+				Help:      "The total number of live requests mirrored to recovering providers",
+			}, []string{
+				"provider",
+				"outcome",
+			}),
+		metricErrorsNormalized: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_errors_normalized_total",
+				Help:      "The total number of provider errors rewritten to canonical errors",
+			}, []string{
+				"provider",
+				"rule",
+			}),
+		metricErrorActions: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_jsonrpc_error_actions_total",
+				Help:      "The total number of actions taken on JSON-RPC errors served with a successful status code",
+			}, []string{
+				"provider",
+				"code",
+				"action",
+			}),
+		metricResponseSize: factory.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_response_size_bytes",
+				Help:      "Histogram of response body sizes in bytes",
+				Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+			}, []string{
+				"provider",
+				"method",
+			}),
+		metricUpstreamAttempts: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_upstream_attempts_total",
+				Help:      "The total number of attempts made to a given provider by outcome, retries included",
+			}, []string{
+				"provider",
+				"class",
+			}),
+		metricUpstreamRedirects: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_upstream_redirects_total",
+				Help:      "The total number of redirects of a given provider by outcome, followed or why not",
+			}, []string{
+				"provider",
+				"outcome",
+			}),
+		metricFaultsInjected: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_faults_injected_total",
+				Help:      "The total number of faults injected into the requests proxied to a given provider",
+			}, []string{
+				"provider",
+				"fault",
+			}),
+		metricComputeUnits: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_compute_units_total",
+				Help:      "The total cost of the requests answered by a given provider, in compute units",
+			}, []string{
+				"provider",
+				"method",
+			}),
+		metricInvalidClientOverrides: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_client_overrides_invalid_total",
+				Help:      "The total number of invalid client override headers ignored, by header",
+			}, []string{
+				"header",
+			}),
+		metricImmutableCache: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_immutable_cache_requests_total",
+				Help:      "The total number of cacheable requests looked up in the immutable cache, by method and result",
+			}, []string{
+				"method",
+				"result",
+			}),
+		metricCacheBackendErrors: factory.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_cache_backend_errors_total",
+				Help:      "The total number of failed operations of the shared cache backend, bypassed by the requests",
+			}, []string{
+				"backend",
+				"operation",
+			}),
+		metricConnections: newConnectionMetrics(factory, config.Metrics.Namespace()),
+		metricConfiguredTargets: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_configured_targets",
+				Help:      "The number of targets configured, drained ones included",
+			}),
+		metricFailoverBreakerOpen: factory.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: config.Metrics.Namespace(),
+				Name:      "rpc_gateway_failover_breaker_open",
+				Help:      "1 while the failover breaker is open and requests aren't rerouted, 0 otherwise",
 			}),
 	}
 
+	proxy.knownMethods = newKnownMethods(proxy.classifier, proxy.computeUnits)
+
+	copyBuffers := newCopyBufferPool()
+
 	for _, target := range config.Targets {
 		p, err := NewNodeProvider(target)
 		if err != nil {
@@ -65,13 +399,250 @@ func NewProxy(config Config) (*Proxy, error) {
 		}
 
 		proxy.targets = append(proxy.targets, p)
+
+		// Scores depend on the health checks too, they're computed when
+		// scraped.
+		//
+		name := target.Name
+		factory.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Namespace:   config.Metrics.Namespace(),
+				Name:        "rpc_gateway_provider_score",
+				Help:        "Score of a given provider, from 0 to 1, the higher the better",
+				ConstLabels: prometheus.Labels{"provider": name},
+			}, func() float64 {
+				score, _ := proxy.Score(name)
+
+				return score
+			})
+
+		p.recentErrors = newErrorRing(config.Proxy.RecentErrors.size())
+
+		if config.Proxy.FaultInjection.Enabled {
+			if err := target.Faults.validate(); err != nil {
+				return nil, errors.Wrapf(err, "invalid faults of target %q", target.Name)
+			}
+
+			p.faults = newFaultInjector(target.Name, target.Faults, proxy.metricFaultsInjected)
+		}
+
+		// Everything below tunes the reverse proxy of HTTP targets.
+		//
+		if p.Proxy == nil {
+			continue
+		}
+
+		p.Proxy.BufferPool = copyBuffers
+		p.Proxy.Director = newUpstreamIdentity(config.Proxy, target).director(p.Proxy.Director)
+		p.Proxy.ErrorHandler = proxy.proxyErrorHandler(target.Name)
+
+		p.Proxy.ModifyResponse = watchBody(config.Proxy.UpstreamBodyTimeout)
+
+		// The body watchers wrap the decompressed body, so a corrupt gzip
+		// stream counts as a truncated response too.
+		//
+		if target.Connection.HTTP.AcceptCompressedResponses {
+			p.Proxy.Director = requestGzip(p.Proxy.Director)
+			p.Proxy.ModifyResponse = decompressResponses(p.Proxy.ModifyResponse)
+		}
+
+		if transport, ok := config.Transports[target.Name]; ok {
+			p.Proxy.Transport = transport
+		} else if transport := newTargetTransport(target); transport != nil {
+			p.Proxy.Transport = transport
+		}
+
+		// Resets are injected under the retries, so they're retried and
+		// classified like the ones of the targets.
+		//
+		if p.faults != nil {
+			p.Proxy.Transport = newFaultTransport(p.Proxy.Transport, p.faults)
+		}
+
+		p.Proxy.Transport = newConnectionMetricsTransport(p.Proxy.Transport, target.Name, proxy.metricConnections)
+
+		if config.Proxy.Retry.enabled() {
+			p.Proxy.Transport = newRetryTransport(p.Proxy.Transport, target.Name, config.Proxy.Retry,
+				proxy.metricUpstreamAttempts)
+		}
+
+		// Redirects are handled past the retries, so each hop is retried on
+		// its own and a redirect that isn't followed fails over at once.
+		//
+		if target.Connection.HTTP.Redirects.enabled() {
+			p.Proxy.Transport = newRedirectTransport(p.Proxy.Transport, target.Name,
+				target.Connection.HTTP.Redirects, proxy.metricUpstreamRedirects)
+		}
+
+		if target.WarmUp.MinIdleConnections > 0 {
+			proxy.warmers = append(proxy.warmers, newConnectionWarmer(p))
+		}
+	}
+
+	if len(proxy.warmers) > 0 {
+		proxy.hcm.AddHealthObserver(HealthObserverFunc(proxy.onHealthChange))
 	}
 
+	slowStart := config.Proxy.SlowStart
+	if slowStart == 0 {
+		slowStart = DefaultSlowStart
+	}
+
+	if proxy.logger == nil {
+		proxy.logger = slog.Default()
+	}
+
+	if proxy.debugSampler, err = newDebugSampler(config.Proxy.DebugSampling, proxy.logger); err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
+	proxy.breaker = newFailoverBreaker(config.Proxy.FailoverBreaker, proxy.logger, proxy.metricFailoverBreakerOpen)
+
+	if config.Proxy.FaultInjection.Enabled {
+		proxy.logger.Warn("fault injection is enabled, targets may fail on purpose")
+	}
+
+	if proxy.maxBodySize <= 0 {
+		proxy.maxBodySize = DefaultMaxRequestBodySize
+	}
+
+	proxy.ring = newHashRing(proxy.targets)
+	proxy.wrr = NewWeightedRoundRobin(proxy.targets, slowStart)
+
+	proxy.metricConfiguredTargets.Set(float64(len(proxy.targets)))
+
+	// The active tier depends on the health checks, it's computed when
+	// scraped.
+	//
+	proxy.metricActiveTier = factory.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Namespace: config.Metrics.Namespace(),
+			Name:      "rpc_gateway_active_tier",
+			Help:      "The lowest tier with an available target, above 1 when requests spill out of the first tier, 0 when no target is available",
+		}, func() float64 {
+			return float64(proxy.activeTier())
+		})
+
 	return proxy, nil
 }
 
+// Start runs the background work of the proxy, currently the connection
+// warm-up, until the context is canceled. Close releases the resources of
+// the proxy once it no longer serves requests.
+func (p *Proxy) Start(c context.Context) error {
+	var wg sync.WaitGroup
+
+	for _, warmer := range p.warmers {
+		wg.Add(1)
+
+		go func(warmer *connectionWarmer) {
+			defer wg.Done()
+			warmer.Run(c, p.isHealthy)
+		}(warmer)
+	}
+
+	wg.Wait()
+
+	<-c.Done()
+
+	return nil
+}
+
+// Close waits for the drains and canaries in progress, then closes the
+// caches, the debug sampler and the connections to the targets. It must be
+// called once the requests in flight are done, e.g. after the HTTP server
+// is shut down, as they would hit closed connections. No drain or canary
+// starts after, and closing twice has no effect.
+func (p *Proxy) Close() error {
+	p.closedMu.Lock()
+	closed := p.closed
+	p.closed = true
+	p.closedMu.Unlock()
+
+	if closed {
+		return nil
+	}
+
+	p.drains.Wait()
+	p.canaries.Wait()
+
+	var errs error
+
+	if err := p.immutableCache.Close(); err != nil {
+		errs = multierror.Append(errs, errors.Wrap(err, "cannot close immutable cache"))
+	}
+
+	if err := p.debugSampler.Close(); err != nil {
+		errs = multierror.Append(errs, errors.Wrap(err, "cannot close debug sampling file"))
+	}
+
+	for _, target := range p.targets {
+		// Drained targets have been closed already.
+		//
+		if target.drained.Load() {
+			continue
+		}
+
+		if err := target.Provider.Close(); err != nil {
+			errs = multierror.Append(errs, errors.Wrapf(err, "cannot close target %q", target.Name()))
+		}
+	}
+
+	return errs
+}
+
+// goBackground runs fn in the background, tracked by wg, unless the proxy
+// is shutting down. It reports whether fn runs.
+func (p *Proxy) goBackground(wg *sync.WaitGroup, fn func()) bool {
+	p.closedMu.Lock()
+	defer p.closedMu.Unlock()
+
+	if p.closed {
+		return false
+	}
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		fn()
+	}()
+
+	return true
+}
+
+func (p *Proxy) isHealthy(name string) bool {
+	// Draining targets aren't warmed up anymore.
+	//
+	if target, err := p.target(name); err == nil && target.Draining() {
+		return false
+	}
+
+	return p.hcm.IsHealthy(name)
+}
+
+func (p *Proxy) onHealthChange(name string, healthy bool) {
+	if !healthy {
+		return
+	}
+
+	for _, warmer := range p.warmers {
+		if warmer.name == name {
+			warmer.Wake()
+		}
+	}
+}
+
 func (p *Proxy) HasNodeProviderFailed(statusCode int) bool {
-	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+	switch p.statusPolicy[statusCode] {
+	case StatusPolicyFailover:
+		return true
+	case StatusPolicyPassthrough, StatusPolicyNormalize:
+		return false
+	}
+
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests ||
+		isPermanentStatus(statusCode)
 }
 
 func (p *Proxy) copyHeaders(dst http.ResponseWriter, src http.ResponseWriter) {
@@ -84,56 +655,580 @@ func (p *Proxy) copyHeaders(dst http.ResponseWriter, src http.ResponseWriter) {
 	}
 }
 
-func (p *Proxy) timeoutHandler(next http.Handler) http.Handler {
+func (p *Proxy) timeoutHandler(next http.Handler, timeout time.Duration) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
-		handler := http.TimeoutHandler(next, p.timeout, http.StatusText(http.StatusGatewayTimeout))
+		handler := http.TimeoutHandler(next, timeout, http.StatusText(http.StatusGatewayTimeout))
 		handler.ServeHTTP(w, r)
 	}
 
 	return http.HandlerFunc(fn)
 }
 
-func (p *Proxy) errServiceUnavailable(w http.ResponseWriter) {
-	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+// attemptTimeout returns the timeout for the next upstream attempt. When a
+// total request budget is configured, an attempt never gets more time than
+// what's left of it. A non-positive value means the budget is exhausted.
+func (p *Proxy) attemptTimeout(deadline time.Time) time.Duration {
+	if p.requestTimeout <= 0 {
+		return p.timeout
+	}
+
+	remaining := deadline.Sub(p.clock.Now())
+	if remaining < p.timeout {
+		return remaining
+	}
+
+	return p.timeout
+}
+
+func (p *Proxy) writeResponse(w http.ResponseWriter, pw *ReponseWriter, requests []JSONRPCRequest) {
+	p.copyHeaders(w, pw)
+	p.setCacheControl(w, requests, pw)
+
+	pw.stream(w) // nolint:errcheck
+}
+
+// normalizeError rewrites a provider error held by pw to its canonical form.
+// It reports whether pw has been rewritten.
+func (p *Proxy) normalizeError(target *NodeProvider, pw *ReponseWriter, state *failoverState) bool {
+	if p.normalizer == nil {
+		return false
+	}
+
+	applied := p.normalizer.normalize(target.Name(), pw, state.requests)
+
+	for _, rule := range applied {
+		p.metricErrorsNormalized.WithLabelValues(target.Name(), rule).Inc()
+	}
+
+	return len(applied) > 0
+}
+
+// failoverState is the state of a single request shared across its
+// upstream attempts.
+type failoverState struct {
+	// deadline is the end of the request budget.
+	deadline time.Time
+	// rerouted holds the provider that failed last, so the reroute can be
+	// labeled with the provider that absorbs the request.
+	rerouted *NodeProvider
+	// lastFailure is the last failed upstream response.
+	lastFailure *ReponseWriter
+	// queued is set while the request waits in the admission queue.
+	queued bool
+	// class is the method class of the request.
+	class string
+	// requests are the decoded JSON-RPC requests, nil when the body isn't
+	// JSON-RPC.
+	requests []JSONRPCRequest
+	// overrides are the limits set by the client, and reroutes the number
+	// of times the request has been rerouted.
+	overrides clientOverrides
+	reroutes  int
+	// breakerOpen is set when the failover breaker stopped the reroutes.
+	breakerOpen bool
+	// notification is set when the requests are all notifications.
+	notification bool
+	// client is the client label of the request, empty when disabled.
+	client string
 }
 
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r = p.acceptHTTPMethod(w, r); r == nil {
+		return
+	}
+
+	if !p.acceptContentType(w, r) {
+		return
+	}
+
+	// The body is read once and replayed to every attempt, so a target
+	// failing halfway through reading it doesn't truncate the next attempt.
+	// It isn't pooled: http.TimeoutHandler doesn't wait for an attempt that
+	// timed out, whose transport may still be sending the body after the
+	// request is served.
+	//
 	body := &bytes.Buffer{}
 
-	if _, err := io.Copy(body, r.Body); err != nil {
-		p.errServiceUnavailable(w)
+	if _, err := io.Copy(body, http.MaxBytesReader(w, r.Body, p.maxBodySize)); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			p.writeError(w, r, middleware.GatewayError{
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Code:       middleware.JSONRPCErrorInvalidRequest,
+				Message:    "request body too large",
+				Reason:     "request_too_large",
+			})
+
+			return
+		}
+
+		p.errServiceUnavailable(w, r, "request_body_unreadable")
 
 		return
 	}
 
-	for _, target := range p.targets {
-		if !p.hcm.IsHealthy(target.Name()) {
+	normalizeBody(r, body)
+
+	w, r, finishSample := p.startSample(w, r, body.Bytes())
+	defer finishSample()
+
+	// Every attempt replays the same body, so a gzipped one is decompressed
+	// once for all the targets not supporting compression.
+	//
+	attempts := &requestAttempts{tracing: p.debugTrace.traced(r), reporting: p.errorAttempts}
+	r = r.WithContext(middleware.WithGunzipCache(withRequestAttempts(r.Context(), attempts)))
+
+	if attempts.tracing {
+		tw := newTraceWriter(w, attempts, p.debugTrace.output())
+		defer tw.flush()
+
+		w = tw
+	}
+
+	defer func() {
+		p.metricAttemptsPerRequest.Observe(float64(attempts.Attempts()))
+		p.metricProvidersPerRequest.Observe(float64(attempts.ProvidersVisited()))
+	}()
+
+	// The request budget is shared by every attempt, so retries and reroutes
+	// can't take longer than the client is willing to wait.
+	//
+	state := &failoverState{
+		deadline:  p.clock.Now().Add(p.requestTimeout),
+		class:     DefaultMethodClass,
+		overrides: clientOverrides{maxRetries: -1, maxReroutes: -1},
+		client:    p.labelClient(r),
+	}
+
+	if requests, err := parseJSONRPCRequests(body.Bytes()); err == nil {
+		state.class = p.classifier.ClassifyRequests(requests)
+		state.requests = requests
+		state.notification = isNotificationOnly(requests)
+
+		r = r.WithContext(middleware.WithJSONRPCID(r.Context(), responseID(requests)))
+	}
+
+	if p.overridable {
+		state.overrides = p.clientOverrides(r)
+	}
+
+	// Notifications are fire-and-forget, retrying one would deliver it
+	// twice.
+	//
+	if state.notification {
+		state.overrides.maxRetries = 0
+	}
+
+	if p.overridable || state.notification {
+		r = r.WithContext(withClientOverrides(r.Context(), state.overrides))
+	}
+
+	if p.serveCached(w, r, state.requests) {
+		return
+	}
+
+	// Without a target left to select, neither the selection nor the queue
+	// can do any good.
+	//
+	if !p.hasActiveTargets() {
+		p.errServiceUnavailable(w, r, "no_active_provider")
+
+		return
+	}
+
+	// Targets unable to serve the method are never attempted, so the
+	// client gets the error of the ones able to, or this one when there
+	// are none.
+	//
+	if !p.hasCapableTarget(state.requests) {
+		p.errMethodUnsupported(w, r)
+
+		return
+	}
+
+	if !state.notification {
+		p.mirrorToRecoveringTargets(r, body.Bytes(), state.requests)
+	}
+
+	defer func() {
+		if state.queued {
+			p.leaveQueue()
+		}
+
+		if state.lastFailure != nil {
+			p.buffers.Put(state.lastFailure.body)
+		}
+	}()
+
+	var maxWait <-chan time.Time
+
+	for {
+		changed := p.queue.Changed()
+
+		served, saturated := p.tryTargets(w, r, body.Bytes(), state)
+		if served {
+			return
+		}
+
+		// Wait for a slot only when every healthy target is saturated and
+		// nothing has been attempted yet.
+		//
+		if !saturated || state.lastFailure != nil {
+			break
+		}
+
+		if !state.queued {
+			if !p.enterQueue() {
+				p.shed(w, r, "queue_full")
+
+				return
+			}
+
+			state.queued = true
+
+			timer := time.NewTimer(p.queue.maxWait)
+			defer timer.Stop()
+
+			maxWait = timer.C
+		}
+
+		select {
+		case <-changed:
+		case <-maxWait:
+			p.shed(w, r, "max_wait")
+
+			return
+		case <-r.Context().Done():
+			p.errServiceUnavailable(w, r, "client_canceled")
+
+			return
+		}
+	}
+
+	if state.rerouted != nil {
+		p.metricRequestErrors.WithLabelValues(state.rerouted.Name(), "rerouted", "none", state.client).Inc()
+
+		// A provider error with a canonical form is more useful to the
+		// client than a generic 503.
+		//
+		if p.normalizeError(state.rerouted, state.lastFailure, state) {
+			p.writeResponse(w, state.lastFailure, state.requests)
+
+			return
+		}
+
+		if state.breakerOpen {
+			p.errServiceUnavailable(w, r, "failover_breaker_open")
+
+			return
+		}
+
+		p.errServiceUnavailable(w, r, "all_providers_failed")
+
+		return
+	}
+
+	p.errServiceUnavailable(w, r, "no_provider_available")
+}
+
+// tryTargets attempts the healthy targets in order until one of them serves
+// the request. It reports whether a response has been written and whether a
+// target has been skipped because it was saturated.
+func (p *Proxy) tryTargets(
+	w http.ResponseWriter,
+	r *http.Request,
+	body []byte,
+	state *failoverState,
+) (bool, bool) {
+	saturated := false
+
+	for _, target := range p.candidates(r) {
+		if target.Draining() || !p.hcm.IsAvailable(target.Name(), state.class) || !p.supports(target, state.requests) {
 			continue
 		}
-		start := time.Now()
 
-		pw := NewResponseWriter()
-		r.Body = io.NopCloser(bytes.NewBuffer(body.Bytes()))
+		if state.rerouted != nil && !state.rerouteAllowed() {
+			break
+		}
+
+		if state.rerouted != nil && !p.breaker.allow(p.clock.Now()) {
+			state.breakerOpen = true
+
+			break
+		}
 
-		p.timeoutHandler(target).ServeHTTP(pw, r)
+		timeout := p.attemptTimeout(state.deadline)
+		if timeout <= 0 {
+			if state.lastFailure == nil {
+				p.errServiceUnavailable(w, r, "budget_exhausted")
 
-		if p.HasNodeProviderFailed(pw.statusCode) {
-			p.metricRequestDuration.WithLabelValues(target.Name(), r.Method, strconv.Itoa(pw.statusCode)).
-				Observe(time.Since(start).Seconds())
-			p.metricRequestErrors.WithLabelValues(target.Name(), "rerouted").Inc()
+				return true, saturated
+			}
+
+			p.metricRequestErrors.WithLabelValues(state.rerouted.Name(), "budget_exhausted", "none", state.client).Inc()
+			p.normalizeError(state.rerouted, state.lastFailure, state)
+			p.writeResponse(w, state.lastFailure, state.requests)
+
+			return true, saturated
+		}
+
+		if !target.TryAcquire() {
+			saturated = true
 
 			continue
 		}
-		p.copyHeaders(w, pw)
 
-		w.WriteHeader(pw.statusCode)
-		w.Write(pw.body.Bytes()) // nolint:errcheck
+		if state.queued {
+			p.leaveQueue()
+			state.queued = false
+		}
 
-		p.metricRequestDuration.WithLabelValues(target.Name(), r.Method, strconv.Itoa(pw.statusCode)).
-			Observe(time.Since(start).Seconds())
+		if state.rerouted != nil {
+			p.metricRequestErrors.WithLabelValues(state.rerouted.Name(), "rerouted", target.Name(), state.client).Inc()
+			state.rerouted = nil
+			state.reroutes++
 
-		return
+			p.breaker.observe(p.clock.Now())
+		}
+
+		var (
+			start  time.Time
+			pw     *ReponseWriter
+			err    error
+			code   int
+			action JSONRPCErrorAction
+			acted  bool
+		)
+
+		for retries := uint(0); ; retries++ {
+			start = time.Now()
+
+			pw = newResponseWriterWithBuffer(p.buffers.Get())
+
+			p.metricInflightRequests.WithLabelValues(target.Name()).Inc()
+			err = p.serveAttempt(target, timeout, pw, r, body)
+			p.metricInflightRequests.WithLabelValues(target.Name()).Dec()
+
+			p.observeAttempt(target, r, pw, err, start, state)
+
+			code, action, acted = p.errorActions.match(pw)
+			if !acted || !action.has(ErrorActionRetrySame) || retries >= action.retries(state.overrides) ||
+				state.notification {
+				break
+			}
+
+			if !p.waitRetrySame(r.Context(), state, retries+1) {
+				break
+			}
+
+			if timeout = p.attemptTimeout(state.deadline); timeout <= 0 {
+				break
+			}
+
+			p.observeErrorAction(target, code, ErrorActionRetrySame)
+			p.buffers.Put(pw.body)
+		}
+
+		target.Release()
+		p.queue.Broadcast()
+
+		if acted {
+			p.applyErrorAction(target, pw, code, action)
+		}
+
+		if state.notification {
+			p.serveNotification(w, target, pw, err, start, state)
+
+			return true, saturated
+		}
+
+		if errors.Is(err, ErrTruncatedResponse) && p.serveTruncated(w, r, target, pw, err, state) {
+			return true, saturated
+		}
+
+		if p.HasNodeProviderFailed(pw.statusCode) || (acted && action.has(ErrorActionReroute)) {
+			p.hcm.ObserveFailure(target.Name(), state.class)
+			p.observeError(target, state.requests, pw, err)
+			p.observePermanentFailures(target, isPermanentFailure(pw.statusCode, err))
+
+			var transportErr *TransportError
+			if errors.As(err, &transportErr) {
+				p.metricRequestErrors.WithLabelValues(target.Name(), transportErr.Type, "none", state.client).Inc()
+			}
+
+			if isTimeout(err) || pw.statusCode == http.StatusGatewayTimeout {
+				p.hcm.ObserveTimeout(target.Name(), timeoutSourceTraffic)
+			}
+
+			if state.lastFailure != nil {
+				p.buffers.Put(state.lastFailure.body)
+			}
+
+			state.rerouted = target
+			state.lastFailure = pw
+
+			continue
+		}
+
+		p.hcm.ObserveSuccess(target.Name(), state.class)
+		p.observePermanentFailures(target, false)
+
+		if !p.normalizeError(target, pw, state) {
+			p.normalizeStatus(target, pw, state.requests)
+		}
+
+		p.observeResponse(target.Name(), state.requests, pw.body.Len(), time.Since(start))
+		p.writeResponse(w, pw, state.requests)
+		p.cacheResponse(r, state.requests, pw)
+		p.buffers.Put(pw.body)
+
+		return true, saturated
+	}
+
+	return false, saturated
+}
+
+// observeAttempt records an attempt of the request with the target, started
+// at start, whatever its outcome.
+func (p *Proxy) observeAttempt(
+	target *NodeProvider,
+	r *http.Request,
+	pw *ReponseWriter,
+	err error,
+	start time.Time,
+	state *failoverState,
+) {
+	p.metricRequestDuration.WithLabelValues(target.Name(), r.Method, statusClass(r, pw, err), state.client).
+		Observe(time.Since(start).Seconds())
+
+	target.attempts.Add(1)
+
+	if p.attemptOutcome(pw, err) != attemptSuccess {
+		target.failures.Add(1)
+	} else {
+		target.observeLatency(time.Since(start))
+	}
+
+	if attempts := requestAttemptsFromContext(r.Context()); attempts != nil {
+		attempts.Record(target.Name(), start, p.attemptOutcome(pw, err))
+	}
+
+	if capture := debugCaptureFromContext(r.Context()); capture != nil {
+		capture.Record(target.Name(), start, p.attemptOutcome(pw, err), pw, err)
+	}
+
+	// Providers bill the requests they answer, whether they failed or not.
+	//
+	if err == nil {
+		p.observeComputeUnits(target.Name(), state.requests)
+	}
+}
+
+// serveAttempt serves the request with the target into pw. An upstream
+// response cut short, because its body stalled or the connection broke, is
+// turned into a failed response, so the request can be rerouted. Responses
+// are buffered, so the client hasn't received any byte of it yet. The
+// transport error of the attempt, if any, is returned.
+func (p *Proxy) serveAttempt(
+	target *NodeProvider,
+	timeout time.Duration,
+	pw *ReponseWriter,
+	r *http.Request,
+	body []byte,
+) (err error) {
+	c, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	state := &bodyReadState{cancel: cancel}
+	attemptErr := &attemptError{}
+
+	attemptCtx, cancelAttempt := context.WithTimeout(c, timeout)
+	defer cancelAttempt()
+
+	defer func() {
+		aborted := false
+
+		if v := recover(); v != nil {
+			// ReverseProxy aborts the handler when it can't copy the
+			// upstream body under a real server.
+			//
+			if v != http.ErrAbortHandler { //nolint:errorlint
+				panic(v)
+			}
+
+			aborted = true
+		}
+
+		switch {
+		case state.stalled.Load():
+			p.resetAttempt(pw, r, http.StatusGatewayTimeout, "upstream response stalled", "upstream_body_stalled")
+		case state.truncated() != nil && attemptCtx.Err() == nil:
+			p.resetAttempt(pw, r, http.StatusBadGateway, "upstream response truncated", "upstream_truncated")
+
+			err = errors.Wrap(ErrTruncatedResponse, state.truncated().Error())
+		case aborted:
+			p.resetAttempt(pw, r, http.StatusBadGateway, "upstream response aborted", "upstream_aborted")
+		case errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && p.HasNodeProviderFailed(pw.statusCode):
+			p.resetAttempt(pw, r, http.StatusGatewayTimeout, "upstream timeout", "upstream_timeout")
+		}
+	}()
+
+	attempt := newAttemptRequest(r.WithContext(withAttemptError(withBodyReadState(attemptCtx, state), attemptErr)), body)
+
+	p.timeoutHandler(target, timeout).ServeHTTP(pw, attempt)
+
+	return attemptErr.Err()
+}
+
+// resetAttempt replaces whatever an attempt wrote with a gateway error.
+func (p *Proxy) resetAttempt(pw *ReponseWriter, r *http.Request, statusCode int, message, reason string) {
+	pw.reset(statusCode)
+
+	p.writeError(pw, r, middleware.GatewayError{
+		StatusCode: statusCode,
+		Code:       middleware.JSONRPCErrorInternal,
+		Message:    message,
+		Reason:     reason,
+	})
+}
+
+// newAttemptRequest returns a shallow copy of r reading the buffered body
+// from the start. Each attempt gets its own copy, header included, so an
+// attempt abandoned on timeout can't race with the next one and a body
+// decompressed for one target isn't sent as is to the next.
+func newAttemptRequest(r *http.Request, body []byte) *http.Request {
+	attempt := r.WithContext(r.Context())
+	middleware.SetBody(attempt, body)
+
+	return attempt
+}
+
+func (p *Proxy) enterQueue() bool {
+	ok := p.queue.Enter()
+	p.metricQueueDepth.Set(float64(p.queue.Len()))
+
+	return ok
+}
+
+func (p *Proxy) leaveQueue() {
+	p.queue.Leave()
+	p.metricQueueDepth.Set(float64(p.queue.Len()))
+}
+
+// shed rejects a request that couldn't be admitted to any target.
+func (p *Proxy) shed(w http.ResponseWriter, r *http.Request, reason string) {
+	p.metricRequestsShed.WithLabelValues(reason).Inc()
+
+	retryAfter := int(math.Ceil(p.queue.maxWait.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
 	}
 
-	p.errServiceUnavailable(w)
+	p.writeError(w, r, middleware.GatewayError{
+		StatusCode: http.StatusTooManyRequests,
+		Code:       JSONRPCErrorLimitExceeded,
+		Message:    "all node providers are saturated, retry later",
+		Reason:     reason,
+		RetryAfter: retryAfter,
+	})
 }
@@ -3,18 +3,31 @@ package proxy
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/0xProject/rpc-gateway/internal/metrics"
 	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func createConfig() Config {
@@ -160,6 +173,99 @@ func TestHttpFailoverProxyDecompressRequest(t *testing.T) {
 	assert.Equal(t, strconv.Itoa(len(`{"body": "content"}`)), receivedHeaderContentLength)
 }
 
+// newGzipRerouteConfig returns three targets not supporting compression, the
+// first two failing, and a gzipped request to send them.
+func newGzipRerouteConfig(t testing.TB, received func(body string)) (Config, []byte) {
+	t.Helper()
+
+	rpcGatewayConfig := createConfig()
+
+	for i, status := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK} {
+		status := status
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			received(string(body))
+
+			w.WriteHeader(status)
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+		}))
+		t.Cleanup(server.Close)
+
+		rpcGatewayConfig.Targets = append(rpcGatewayConfig.Targets, NodeProviderConfig{
+			Name: fmt.Sprintf("Server%d", i+1),
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: server.URL,
+				},
+			},
+		})
+	}
+
+	var buf bytes.Buffer
+	g := gzip.NewWriter(&buf)
+
+	_, err := g.Write(bytes.Repeat([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},`), 256))
+	assert.NoError(t, err)
+	assert.NoError(t, g.Close())
+
+	return rpcGatewayConfig, buf.Bytes()
+}
+
+func TestHttpFailoverProxyDecompressRequestAcrossReroutes(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+
+	rpcGatewayConfig, compressed := newGzipRerouteConfig(t, func(body string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		bodies = append(bodies, body)
+	})
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	expected := strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"},`, 256)
+
+	for i := 0; i < 2; i++ {
+		mu.Lock()
+		bodies = nil
+		mu.Unlock()
+
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed))
+		req.Header.Set(headers.ContentEncoding, "gzip")
+
+		rr := httptest.NewRecorder()
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		mu.Lock()
+		assert.Equal(t, []string{expected, expected, expected}, bodies)
+		mu.Unlock()
+	}
+}
+
+func BenchmarkProxyServeHTTPGzipReroutes(b *testing.B) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rpcGatewayConfig, compressed := newGzipRerouteConfig(b, func(string) {})
+	httpFailoverProxy := newTestFailoverProxy(b, rpcGatewayConfig)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(compressed))
+		req.Header.Set(headers.ContentEncoding, "gzip")
+
+		httpFailoverProxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+}
+
 func TestHttpFailoverProxyWithCompressionSupportedTarget(t *testing.T) {
 	prometheus.DefaultRegisterer = prometheus.NewRegistry()
 
@@ -225,6 +331,106 @@ func TestHttpFailoverProxyWithCompressionSupportedTarget(t *testing.T) {
 	assert.Equal(t, wantBody.Bytes(), receivedBody)
 }
 
+func TestHttpFailoverProxyBodyFraming(t *testing.T) {
+	const payload = `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`
+
+	var compressed bytes.Buffer
+
+	g := gzip.NewWriter(&compressed)
+	g.Write([]byte(payload))
+	assert.NoError(t, g.Close())
+
+	for _, clientGzip := range []bool{false, true} {
+		for _, compression := range []bool{false, true} {
+			for _, reroute := range []bool{false, true} {
+				clientGzip, compression, reroute := clientGzip, compression, reroute
+
+				name := fmt.Sprintf("gzip=%t/compression=%t/reroute=%t", clientGzip, compression, reroute)
+
+				t.Run(name, func(t *testing.T) {
+					prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+					// checkFraming asserts the request received by a target is
+					// consistent and carries the payload.
+					//
+					checkFraming := func(r *http.Request, compression bool) {
+						body, err := io.ReadAll(r.Body)
+						assert.NoError(t, err)
+
+						assert.Empty(t, r.TransferEncoding)
+						assert.Equal(t, int64(len(body)), r.ContentLength)
+						assert.Equal(t, strconv.Itoa(len(body)), r.Header.Get(headers.ContentLength))
+
+						if clientGzip && compression {
+							assert.Equal(t, "gzip", r.Header.Get(headers.ContentEncoding))
+							assert.Equal(t, compressed.Bytes(), body)
+						} else {
+							assert.Empty(t, r.Header.Get(headers.ContentEncoding))
+							assert.Equal(t, payload, string(body))
+						}
+					}
+
+					failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						checkFraming(r, !compression)
+						w.WriteHeader(http.StatusInternalServerError)
+					}))
+					defer failing.Close()
+
+					working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						checkFraming(r, compression)
+						w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+					}))
+					defer working.Close()
+
+					config := createConfig()
+					config.Targets = []NodeProviderConfig{
+						{
+							Name: "Working",
+							Connection: NodeProviderConnectionConfig{
+								HTTP: NodeProviderConnectionHTTPConfig{
+									URL:         working.URL,
+									Compression: compression,
+								},
+							},
+						},
+					}
+
+					if reroute {
+						config.Targets = append([]NodeProviderConfig{
+							{
+								Name: "Failing",
+								Connection: NodeProviderConnectionConfig{
+									HTTP: NodeProviderConnectionHTTPConfig{
+										URL:         failing.URL,
+										Compression: !compression,
+									},
+								},
+							},
+						}, config.Targets...)
+					}
+
+					httpFailoverProxy := newTestFailoverProxy(t, config)
+
+					body := []byte(payload)
+					if clientGzip {
+						body = compressed.Bytes()
+					}
+
+					req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+					if clientGzip {
+						req.Header.Set(headers.ContentEncoding, "gzip")
+					}
+
+					rr := httptest.NewRecorder()
+					httpFailoverProxy.ServeHTTP(rr, req)
+
+					assert.Equal(t, http.StatusOK, rr.Code)
+				})
+			}
+		}
+	}
+}
+
 func TestHTTPFailoverProxyWhenCannotConnectToPrimaryProvider(t *testing.T) {
 	prometheus.DefaultRegisterer = prometheus.NewRegistry()
 
@@ -288,3 +494,1589 @@ func TestHTTPFailoverProxyWhenCannotConnectToPrimaryProvider(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code)
 	assert.Equal(t, `{"this_is": "body"}`, rr.Body.String())
 }
+
+func TestHttpFailoverProxyAttemptsMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer = registry
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer working.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: failing.URL,
+				},
+			},
+		},
+		{
+			Name: "Server2",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: failing.URL,
+				},
+			},
+		},
+		{
+			Name: "Server3",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: working.URL,
+				},
+			},
+		},
+	}
+
+	healthcheckManager, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: rpcGatewayConfig.Targets,
+		Config:  rpcGatewayConfig.HealthChecks,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	})
+	assert.NoError(t, err)
+
+	rpcGatewayConfig.HealthcheckManager = healthcheckManager
+
+	httpFailoverProxy, err := NewProxy(rpcGatewayConfig)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"this_is": "body"}`))
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.metricRequestErrors.WithLabelValues("Server1", "rerouted", "Server2", "")))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.metricRequestErrors.WithLabelValues("Server2", "rerouted", "Server3", "")))
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	histograms := map[string]*dto.Histogram{}
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			if metric.GetHistogram() != nil {
+				histograms[family.GetName()] = metric.GetHistogram()
+			}
+		}
+	}
+
+	if assert.Contains(t, histograms, "zeroex_rpc_gateway_attempts_per_request") {
+		assert.Equal(t, uint64(1), histograms["zeroex_rpc_gateway_attempts_per_request"].GetSampleCount())
+		assert.Equal(t, float64(3), histograms["zeroex_rpc_gateway_attempts_per_request"].GetSampleSum())
+	}
+
+	if assert.Contains(t, histograms, "zeroex_rpc_gateway_providers_visited_per_request") {
+		assert.Equal(t, uint64(1), histograms["zeroex_rpc_gateway_providers_visited_per_request"].GetSampleCount())
+		assert.Equal(t, float64(3), histograms["zeroex_rpc_gateway_providers_visited_per_request"].GetSampleSum())
+	}
+}
+
+func TestHttpFailoverProxyCustomMetricsConfig(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	prometheus.DefaultRegisterer = registry
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Metrics = metrics.Config{
+		Prefix:          "acme",
+		DurationBuckets: []float64{.001, .005, .01},
+	}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+		},
+	}
+
+	healthcheckManager, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: rpcGatewayConfig.Targets,
+		Config:  rpcGatewayConfig.HealthChecks,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+		Metrics: rpcGatewayConfig.Metrics,
+	})
+	assert.NoError(t, err)
+
+	rpcGatewayConfig.HealthcheckManager = healthcheckManager
+
+	httpFailoverProxy, err := NewProxy(rpcGatewayConfig)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"this_is": "body"}`))
+	assert.NoError(t, err)
+
+	httpFailoverProxy.ServeHTTP(httptest.NewRecorder(), req)
+
+	families, err := registry.Gather()
+	assert.NoError(t, err)
+
+	var duration *dto.MetricFamily
+	for _, family := range families {
+		assert.NotContains(t, family.GetName(), "zeroex")
+
+		if family.GetName() == "acme_rpc_gateway_request_duration_seconds" {
+			duration = family
+		}
+	}
+
+	if assert.NotNil(t, duration) {
+		buckets := []float64{}
+		for _, bucket := range duration.GetMetric()[0].GetHistogram().GetBucket() {
+			buckets = append(buckets, bucket.GetUpperBound())
+		}
+
+		assert.Equal(t, []float64{.001, .005, .01}, buckets)
+	}
+}
+
+func TestNewProxyRejectsUnsortedDurationBuckets(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Metrics = metrics.Config{
+		DurationBuckets: []float64{1, .5},
+	}
+
+	httpFailoverProxy, err := NewProxy(rpcGatewayConfig)
+	assert.Nil(t, httpFailoverProxy)
+	assert.ErrorContains(t, err, "ascending")
+}
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1700000000, 0)}
+}
+
+func (f *fakeClock) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *fakeClock) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
+
+func TestHttpFailoverProxyRequestBudget(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	clock := newFakeClock()
+
+	slowAndFailing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(2 * time.Second)
+		http.Error(w,
+			http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+	}))
+	defer slowAndFailing.Close()
+
+	var thirdAttempts atomic.Int32
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		thirdAttempts.Add(1)
+		w.Write([]byte("OK"))
+	}))
+	defer working.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.RequestTimeout = 3 * time.Second
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: slowAndFailing.URL,
+				},
+			},
+		},
+		{
+			Name: "Server2",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: slowAndFailing.URL,
+				},
+			},
+		},
+		{
+			Name: "Server3",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: working.URL,
+				},
+			},
+		},
+	}
+
+	healthcheckManager, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: rpcGatewayConfig.Targets,
+		Config:  rpcGatewayConfig.HealthChecks,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	})
+	assert.NoError(t, err)
+
+	rpcGatewayConfig.HealthcheckManager = healthcheckManager
+
+	httpFailoverProxy, err := NewProxy(rpcGatewayConfig)
+	assert.NoError(t, err)
+
+	httpFailoverProxy.clock = clock
+
+	req, err := http.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"this_is": "body"}`))
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	// The third attempt is skipped because the budget is gone, and the client
+	// gets the last error.
+	//
+	assert.Equal(t, int32(0), thirdAttempts.Load())
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.metricRequestErrors.WithLabelValues("Server2", "budget_exhausted", "none", "")))
+}
+
+func TestHttpFailoverProxyLeastPending(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var slowHits, fastHits atomic.Int32
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slowHits.Add(1)
+		<-time.After(200 * time.Millisecond)
+		w.Write([]byte("OK"))
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fastHits.Add(1)
+		w.Write([]byte("OK"))
+	}))
+	defer fast.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.LoadBalancing = LoadBalancingLeastPending
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Slow",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: slow.URL,
+				},
+			},
+		},
+		{
+			Name: "Fast",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fast.URL,
+				},
+			},
+		},
+	}
+
+	healthcheckManager, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: rpcGatewayConfig.Targets,
+		Config:  rpcGatewayConfig.HealthChecks,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	})
+	assert.NoError(t, err)
+
+	rpcGatewayConfig.HealthcheckManager = healthcheckManager
+
+	httpFailoverProxy, err := NewProxy(rpcGatewayConfig)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"this_is": "body"}`))
+			rr := httptest.NewRecorder()
+			httpFailoverProxy.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}()
+
+		<-time.After(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(40), slowHits.Load()+fastHits.Load())
+	assert.Greater(t, fastHits.Load(), slowHits.Load()*2)
+	assert.Zero(t, httpFailoverProxy.targets[0].Pending())
+	assert.Zero(t, httpFailoverProxy.targets[1].Pending())
+}
+
+func newTestFailoverProxy(t testing.TB, config Config) *Proxy {
+	t.Helper()
+
+	healthcheckManager, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: config.Targets,
+		Config:  config.HealthChecks,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+		Metrics: config.Metrics,
+	})
+	assert.NoError(t, err)
+
+	config.HealthcheckManager = healthcheckManager
+
+	httpFailoverProxy, err := NewProxy(config)
+	assert.NoError(t, err)
+
+	return httpFailoverProxy
+}
+
+func TestHttpFailoverProxyClientHash(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.LoadBalancing = LoadBalancingClientHash
+	rpcGatewayConfig.Proxy.ClientHashHeader = "X-Api-Key"
+
+	for _, name := range []string{"Server1", "Server2", "Server3"} {
+		name := name
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name))
+		}))
+		defer server.Close()
+
+		rpcGatewayConfig.Targets = append(rpcGatewayConfig.Targets, NodeProviderConfig{
+			Name: name,
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: server.URL,
+				},
+			},
+		})
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	serve := func(key string) string {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"this_is": "body"}`))
+		req.Header.Set("X-Api-Key", key)
+
+		rr := httptest.NewRecorder()
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		return rr.Body.String()
+	}
+
+	assignments := map[string]string{}
+	perTarget := map[string]int{}
+
+	for i := 0; i < 300; i++ {
+		key := "client-" + strconv.Itoa(i)
+		assignments[key] = serve(key)
+		perTarget[assignments[key]]++
+
+		// A client sticks to its target across requests.
+		//
+		assert.Equal(t, assignments[key], serve(key))
+	}
+
+	assert.Len(t, perTarget, 3)
+
+	// Only the clients of the unhealthy target are moved.
+	//
+	healthchecker := httpFailoverProxy.hcm.hcs[1]
+	healthchecker.mu.Lock()
+	healthchecker.isHealthy = false
+	healthchecker.mu.Unlock()
+
+	for key, before := range assignments {
+		after := serve(key)
+
+		if before == "Server2" {
+			assert.NotEqual(t, "Server2", after)
+		} else {
+			assert.Equal(t, before, after)
+		}
+	}
+}
+
+func TestHttpFailoverProxyQueueAndShed(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.Queue = QueueConfig{
+		Depth:   2,
+		MaxWait: 5 * time.Second,
+	}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name:                  "Server1",
+			MaxConcurrentRequests: 1,
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: server.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	serve := func(c context.Context) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"this_is": "body"}`)).
+			WithContext(c)
+		rr := httptest.NewRecorder()
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	admitted := func(c context.Context) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			assert.Equal(t, http.StatusOK, serve(c).Code)
+		}()
+	}
+
+	// Occupies the only slot.
+	//
+	admitted(context.Background())
+	assert.Eventually(t, func() bool {
+		return httpFailoverProxy.targets[0].Pending() == 1
+	}, time.Second, time.Millisecond)
+
+	// A canceled waiter frees its place in the queue immediately.
+	//
+	canceled, cancel := context.WithCancel(context.Background())
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		serve(canceled)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return httpFailoverProxy.queue.Len() == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	assert.Eventually(t, func() bool {
+		return httpFailoverProxy.queue.Len() == 0
+	}, time.Second, time.Millisecond)
+
+	// The queue admits up to its depth.
+	//
+	admitted(context.Background())
+	admitted(context.Background())
+	assert.Eventually(t, func() bool {
+		return httpFailoverProxy.queue.Len() == 2
+	}, time.Second, time.Millisecond)
+
+	// And sheds beyond it.
+	//
+	rr := serve(context.Background())
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "5", rr.Header().Get(headers.RetryAfter))
+	assert.JSONEq(t,
+		`{"jsonrpc":"2.0","id":null,"error":{"code":-32005,"message":"all node providers are saturated, retry later"},`+
+			`"gateway":{"reason":"queue_full","attempts":0,"providers":0,"retryAfter":5}}`,
+		rr.Body.String())
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.metricRequestsShed.WithLabelValues("queue_full")))
+
+	close(release)
+	wg.Wait()
+
+	assert.Zero(t, httpFailoverProxy.queue.Len())
+	assert.Zero(t, testutil.ToFloat64(httpFailoverProxy.metricQueueDepth))
+}
+
+func TestHttpFailoverProxyQueueMaxWait(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.Queue = QueueConfig{
+		Depth:   1,
+		MaxWait: 50 * time.Millisecond,
+	}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name:                  "Server1",
+			MaxConcurrentRequests: 1,
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: server.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		rr := httptest.NewRecorder()
+		httpFailoverProxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{}`)))
+	}()
+
+	assert.Eventually(t, func() bool {
+		return httpFailoverProxy.targets[0].Pending() == 1
+	}, time.Second, time.Millisecond)
+
+	rr := httptest.NewRecorder()
+	httpFailoverProxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{}`)))
+
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get(headers.RetryAfter))
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.metricRequestsShed.WithLabelValues("max_wait")))
+
+	close(release)
+	<-done
+}
+
+func BenchmarkProxyServeHTTP(b *testing.B) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	response := bytes.Repeat([]byte("a"), 16*1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write(response)
+	}))
+	defer server.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: server.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(b, rpcGatewayConfig)
+	request := bytes.Repeat([]byte("b"), 4*1024)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rr := httptest.NewRecorder()
+		httpFailoverProxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(request)))
+	}
+}
+
+func TestHttpFailoverProxyObservesRollingWindow(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer working.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: failing.URL,
+				},
+			},
+		},
+		{
+			Name: "Server2",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: working.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	first, err := httpFailoverProxy.hcm.GetRollingWindowByName("Server1")
+	assert.NoError(t, err)
+
+	second, err := httpFailoverProxy.hcm.GetRollingWindowByName("Server2")
+	assert.NoError(t, err)
+
+	// Reading the windows while the proxy observes must be race free.
+	//
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+
+		go func() {
+			defer wg.Done()
+
+			rr := httptest.NewRecorder()
+			httpFailoverProxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{}`)))
+			assert.Equal(t, http.StatusOK, rr.Code)
+		}()
+
+		go func() {
+			defer wg.Done()
+
+			first.Window()
+			second.SuccessRate()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 10, first.Len())
+	assert.Zero(t, first.SuccessRate())
+	assert.Equal(t, 10, second.Len())
+	assert.Equal(t, float64(1), second.SuccessRate())
+
+	_, err = httpFailoverProxy.hcm.GetRollingWindowByName("Unknown")
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+}
+
+func TestHttpFailoverProxyTaintsOnlyFailingMethodClass(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var primaryLogs, primaryCalls atomic.Int32
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if bytes.Contains(body, []byte("eth_getLogs")) {
+			primaryLogs.Add(1)
+			http.Error(w,
+				http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+			return
+		}
+
+		primaryCalls.Add(1)
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secondary"))
+	}))
+	defer secondary.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.HealthChecks.RollingWindowSize = 4
+	rpcGatewayConfig.HealthChecks.RollingWindowMinObservations = 0.5
+	rpcGatewayConfig.HealthChecks.RollingWindowTaintThreshold = 0.5
+	rpcGatewayConfig.HealthChecks.TaintDuration = time.Minute
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Primary",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: primary.URL,
+				},
+			},
+		},
+		{
+			Name: "Secondary",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: secondary.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	clock := newFakeClock()
+	httpFailoverProxy.hcm.clock = clock
+
+	serve := func(method string) string {
+		rr := httptest.NewRecorder()
+		httpFailoverProxy.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":[]}`)))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		return rr.Body.String()
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, "secondary", serve("eth_getLogs"))
+		assert.Equal(t, "primary", serve("eth_call"))
+	}
+
+	// Two failures are enough to taint the logs class, the primary isn't
+	// attempted for logs anymore while it keeps serving eth_call.
+	//
+	assert.Equal(t, int32(2), primaryLogs.Load())
+	assert.Equal(t, int32(5), primaryCalls.Load())
+	assert.True(t, httpFailoverProxy.hcm.IsTainted("Primary", "logs"))
+	assert.False(t, httpFailoverProxy.hcm.IsTainted("Primary", DefaultMethodClass))
+
+	// The taint expires and the primary is tried again.
+	//
+	clock.Advance(time.Minute)
+	assert.Equal(t, "secondary", serve("eth_getLogs"))
+	assert.Equal(t, int32(3), primaryLogs.Load())
+
+	httpFailoverProxy.hcm.reportStatusMetrics()
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.hcm.metricRPCProviderSuccessRate.WithLabelValues("Primary", DefaultMethodClass)))
+	assert.Equal(t, float64(0),
+		testutil.ToFloat64(httpFailoverProxy.hcm.metricRPCProviderSuccessRate.WithLabelValues("Primary", "logs")))
+}
+
+func TestHttpFailoverProxyReplaysCompleteBody(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	payload := `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":["` + strings.Repeat("ab", 64<<10) + `"]}`
+
+	// The first target reads half of the body and drops the connection.
+	//
+	fakeRPC1Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadFull(r.Body, make([]byte, len(payload)/2))
+
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if assert.NoError(t, err) {
+			conn.Close()
+		}
+	}))
+	defer fakeRPC1Server.Close()
+
+	var received atomic.Value
+
+	fakeRPC2Server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received.Store(string(body))
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	}))
+	defer fakeRPC2Server.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPC1Server.URL,
+				},
+			},
+		},
+		{
+			Name: "Server2",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPC2Server.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(payload))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, payload, received.Load())
+}
+
+func TestHttpFailoverProxyRejectsLargeBody(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var called atomic.Bool
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called.Store(true)
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.MaxRequestBodySize = 16
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"this_is": "a larger body"}`))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.False(t, called.Load())
+}
+
+func TestHttpFailoverProxyWarmsConnections(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var connections atomic.Int64
+
+	fakeRPCServer := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	fakeRPCServer.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	fakeRPCServer.Start()
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+			WarmUp: NodeProviderWarmUpConfig{
+				MinIdleConnections: 3,
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	c, cancel := context.WithCancel(context.Background())
+	started := make(chan error)
+
+	go func() {
+		started <- httpFailoverProxy.Start(c)
+	}()
+
+	assert.Eventually(t, func() bool {
+		return connections.Load() == 3
+	}, time.Second, 10*time.Millisecond)
+
+	// The first proxied request reuses a warm connection.
+	//
+	var reused atomic.Bool
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			reused.Store(info.Reused)
+		},
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, reused.Load())
+	assert.Equal(t, int64(3), connections.Load())
+
+	cancel()
+	assert.NoError(t, <-started)
+
+	httpFailoverProxy.targets[0].Proxy.Transport.(interface{ CloseIdleConnections() }).CloseIdleConnections()
+}
+
+func TestHttpFailoverProxyReroutesStalledBody(t *testing.T) {
+	stalling := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "64")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,`))
+		w.(http.Flusher).Flush()
+
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer stalling.Close()
+
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer healthy.Close()
+
+	for _, tc := range []struct {
+		name  string
+		serve func(handler http.Handler) (int, string)
+	}{
+		{
+			name: "recorder",
+			serve: func(handler http.Handler) (int, string) {
+				req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+				rr := httptest.NewRecorder()
+
+				handler.ServeHTTP(rr, req)
+
+				return rr.Code, rr.Body.String()
+			},
+		},
+		{
+			name: "server",
+			serve: func(handler http.Handler) (int, string) {
+				server := httptest.NewServer(handler)
+				defer server.Close()
+
+				resp, err := http.Post(server.URL, "application/json", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+				if !assert.NoError(t, err) {
+					return 0, ""
+				}
+				defer resp.Body.Close()
+
+				body, _ := io.ReadAll(resp.Body)
+
+				return resp.StatusCode, string(body)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+			rpcGatewayConfig := createConfig()
+			rpcGatewayConfig.Proxy.UpstreamBodyTimeout = 100 * time.Millisecond
+			rpcGatewayConfig.Targets = []NodeProviderConfig{
+				{
+					Name: "Server1",
+					Connection: NodeProviderConnectionConfig{
+						HTTP: NodeProviderConnectionHTTPConfig{
+							URL: stalling.URL,
+						},
+					},
+				},
+				{
+					Name: "Server2",
+					Connection: NodeProviderConnectionConfig{
+						HTTP: NodeProviderConnectionHTTPConfig{
+							URL: healthy.URL,
+						},
+					},
+				},
+			}
+
+			httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+			start := time.Now()
+			code, body := tc.serve(httpFailoverProxy)
+
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, body)
+			assert.Less(t, time.Since(start), time.Second)
+
+			window, err := httpFailoverProxy.hcm.GetRollingWindowByName("Server1")
+			assert.NoError(t, err)
+			assert.Equal(t, []int{0}, window.Window())
+		})
+	}
+}
+
+func TestHttpFailoverProxyCanaryKeepsBrokenTargetOut(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var (
+		broken atomic.Bool
+		sends  atomic.Int64
+	)
+
+	broken.Store(true)
+
+	// The recovering target passes its health checks, but fails the real
+	// workload while broken.
+	//
+	recovering := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Method == "eth_sendRawTransaction" {
+			sends.Add(1)
+		}
+
+		switch {
+		case req.Method == "eth_blockNumber":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+		case req.Method == "eth_call":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`))
+		case broken.Load():
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"Recovering"}`))
+		}
+	}))
+	defer recovering.Close()
+
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"Primary"}`))
+	}))
+	defer primary.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.HealthChecks.Timeout = time.Second
+	rpcGatewayConfig.HealthChecks.Canary = CanaryConfig{
+		Fraction:   1,
+		WindowSize: 5,
+	}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Recovering",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: recovering.URL,
+				},
+			},
+		},
+		{
+			Name: "Primary",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: primary.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	hc, err := httpFailoverProxy.hcm.GetTargetByName("Recovering")
+	assert.NoError(t, err)
+
+	hc.mu.Lock()
+	hc.isHealthy = false
+	hc.mu.Unlock()
+
+	hc.CheckAndSetHealth(context.Background())
+
+	assert.True(t, hc.IsHealthy())
+	assert.True(t, httpFailoverProxy.hcm.IsRecovering("Recovering"))
+
+	serve := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs"}`))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		return rr.Body.String()
+	}
+
+	canaries := func(outcome string) float64 {
+		return testutil.ToFloat64(httpFailoverProxy.metricCanaryRequests.WithLabelValues("Recovering", outcome))
+	}
+
+	for i := 0; i < 10; i++ {
+		assert.Contains(t, serve(), "Primary")
+	}
+
+	assert.Eventually(t, func() bool {
+		return canaries("failure") == 10
+	}, time.Second, 10*time.Millisecond)
+
+	assert.True(t, httpFailoverProxy.hcm.IsRecovering("Recovering"))
+	assert.False(t, httpFailoverProxy.hcm.IsAvailable("Recovering", DefaultMethodClass))
+
+	// Writes aren't mirrored, the transaction would be sent twice.
+	//
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction"}`))
+	httpFailoverProxy.ServeHTTP(httptest.NewRecorder(), req)
+	httpFailoverProxy.canaries.Wait()
+
+	assert.Equal(t, int64(0), sends.Load())
+	assert.Equal(t, float64(10), canaries("failure"))
+
+	// Once the real workload succeeds, a full window of canaries restores it.
+	//
+	broken.Store(false)
+
+	for i := 0; i < 5; i++ {
+		serve()
+	}
+
+	assert.Eventually(t, func() bool {
+		return !httpFailoverProxy.hcm.IsRecovering("Recovering")
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, float64(5), canaries("success"))
+	assert.Contains(t, serve(), "Recovering")
+}
+
+func TestHttpFailoverProxyNoCanaryAfterClose(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	node := newFakeNode(t)
+	defer node.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.HealthChecks.Timeout = time.Second
+	rpcGatewayConfig.HealthChecks.Canary = CanaryConfig{
+		Fraction:   1,
+		WindowSize: 1000,
+	}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name:       "Recovering",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		},
+		{
+			Name:       "Primary",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	hc, err := httpFailoverProxy.hcm.GetTargetByName("Recovering")
+	require.NoError(t, err)
+
+	hc.markUnhealthy(errors.New("down"))
+	hc.CheckAndSetHealth(context.Background())
+	require.True(t, httpFailoverProxy.hcm.IsRecovering("Recovering"))
+
+	serve := func() {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+		httpFailoverProxy.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Requests still in flight while the proxy closes may mirror, the race
+	// detector checks they never start a canary it doesn't wait for.
+	//
+	var wg sync.WaitGroup
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 20; j++ {
+				serve()
+			}
+		}()
+	}
+
+	assert.NoError(t, httpFailoverProxy.Close())
+	wg.Wait()
+
+	canaries := func() float64 {
+		return testutil.ToFloat64(httpFailoverProxy.metricCanaryRequests.WithLabelValues("Recovering", "success")) +
+			testutil.ToFloat64(httpFailoverProxy.metricCanaryRequests.WithLabelValues("Recovering", "failure"))
+	}
+
+	before := canaries()
+	serve()
+	httpFailoverProxy.canaries.Wait()
+
+	assert.Equal(t, before, canaries())
+}
+
+func TestHttpFailoverProxyNormalizesRateLimitErrors(t *testing.T) {
+	serve := func(rule string, handler http.HandlerFunc) *httptest.ResponseRecorder {
+		prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+		fakeRPCServer := httptest.NewServer(handler)
+		defer fakeRPCServer.Close()
+
+		rpcGatewayConfig := createConfig()
+		rpcGatewayConfig.Proxy.ErrorNormalization.Enabled = true
+		rpcGatewayConfig.Targets = []NodeProviderConfig{
+			{
+				Name: "Server1",
+				Connection: NodeProviderConnectionConfig{
+					HTTP: NodeProviderConnectionHTTPConfig{
+						URL: fakeRPCServer.URL,
+					},
+				},
+			},
+		}
+
+		httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":7,"method":"eth_call","params":[]}`))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, float64(1),
+			testutil.ToFloat64(httpFailoverProxy.metricErrorsNormalized.WithLabelValues("Server1", rule)))
+
+		return rr
+	}
+
+	inBody := serve("code_429", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.ContentType, "application/json; charset=utf-8")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":7,"error":{"code":429,"message":"your app has exceeded its compute units"}}`))
+	})
+
+	inStatus := serve("http_429", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(headers.RetryAfter, "30")
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	})
+
+	assert.Equal(t, "application/json; charset=utf-8", inBody.Header().Get(headers.ContentType))
+	assert.Equal(t, "application/json", inStatus.Header().Get(headers.ContentType))
+	assert.Equal(t, "30", inStatus.Header().Get(headers.RetryAfter))
+
+	assert.Equal(t, http.StatusTooManyRequests, inBody.Code)
+	assert.Equal(t, inBody.Code, inStatus.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":7,"error":{"code":-32005,"message":"rate limited"}}`, inBody.Body.String())
+	assert.JSONEq(t, inBody.Body.String(), inStatus.Body.String())
+}
+
+func TestHttpFailoverProxyNeverNormalizesResults(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	response := `[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"error":{"code":-32005,"message":"daily limit","data":"x"}}]`
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.ErrorNormalization.Enabled = true
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+			ErrorNormalizationRules: []ErrorNormalizationRule{
+				{
+					Name:            "daily_limit",
+					MessageContains: "daily limit",
+					To:              CanonicalError{Code: -32000, Message: "quota exceeded"},
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`[{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},{"jsonrpc":"2.0","id":2,"method":"eth_call"}]`))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t,
+		`[{"jsonrpc":"2.0","id":1,"result":"0x1"},{"jsonrpc":"2.0","id":2,"error":{"code":-32000,"message":"quota exceeded"}}]`,
+		rr.Body.String())
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.metricErrorsNormalized.WithLabelValues("Server1", "daily_limit")))
+}
+
+func TestHttpFailoverProxyLogsSlowQueries(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		switch req.Method {
+		case "eth_getLogs":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + strings.Repeat("a", 1024) + `"}`))
+		case "debug_traceTransaction":
+			time.Sleep(50 * time.Millisecond)
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+		}
+	}))
+	defer fakeRPCServer.Close()
+
+	var logs bytes.Buffer
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	rpcGatewayConfig.Proxy.SlowQueryLog = SlowQueryLogConfig{
+		SizeThreshold:     512,
+		DurationThreshold: 25 * time.Millisecond,
+		MaxParamsLength:   8,
+	}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	for _, payload := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`,
+		`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[{"address":"0x1234"}]}`,
+		`{"jsonrpc":"2.0","id":1,"method":"debug_traceTransaction","params":["0xabcd"]}`,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(payload))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	var entries []map[string]any
+
+	decoder := json.NewDecoder(&logs)
+	for decoder.More() {
+		var entry map[string]any
+		assert.NoError(t, decoder.Decode(&entry))
+
+		if entry["msg"] == "slow query" {
+			entries = append(entries, entry)
+		}
+	}
+
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, "eth_getLogs", entries[0]["method"])
+		assert.Equal(t, "Server1", entries[0]["provider"])
+		assert.Equal(t, `[{"addre...`, entries[0]["params"])
+		assert.Equal(t, true, entries[0]["large"])
+		assert.Equal(t, false, entries[0]["slow"])
+
+		assert.Equal(t, "debug_traceTransaction", entries[1]["method"])
+		assert.Equal(t, false, entries[1]["large"])
+		assert.Equal(t, true, entries[1]["slow"])
+	}
+
+	assert.Equal(t, 3, testutil.CollectAndCount(httpFailoverProxy.metricResponseSize))
+
+	var metric dto.Metric
+	assert.NoError(t, httpFailoverProxy.metricResponseSize.WithLabelValues("Server1", "eth_getLogs").(prometheus.Histogram).Write(&metric))
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	assert.Greater(t, metric.GetHistogram().GetSampleSum(), float64(1024))
+}
+
+func TestHttpFailoverProxyGatewayErrorsShareStructure(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	release := make(chan struct{})
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	newProxy := func(url string) *Proxy {
+		prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+		rpcGatewayConfig := createConfig()
+		rpcGatewayConfig.Proxy.UpstreamTimeout = 50 * time.Millisecond
+		rpcGatewayConfig.Proxy.MaxRequestBodySize = 64
+		rpcGatewayConfig.Proxy.AttemptsInErrors = true
+		rpcGatewayConfig.Targets = []NodeProviderConfig{
+			{
+				Name: "Server1",
+				Connection: NodeProviderConnectionConfig{
+					HTTP: NodeProviderConnectionHTTPConfig{
+						URL: url,
+					},
+				},
+			},
+		}
+
+		return newTestFailoverProxy(t, rpcGatewayConfig)
+	}
+
+	type gatewayError struct {
+		Jsonrpc string          `json:"jsonrpc"`
+		ID      json.RawMessage `json:"id"`
+		Error   struct {
+			JSONRPCError
+			Data []AttemptTrace `json:"data"`
+		} `json:"error"`
+		Gateway struct {
+			Reason    string `json:"reason"`
+			Attempts  int    `json:"attempts"`
+			Providers int    `json:"providers"`
+		} `json:"gateway"`
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		body     string
+		target   string
+		status   int
+		reason   string
+		attempts int
+	}{
+		{
+			name:     "unavailable",
+			url:      failing.URL,
+			body:     `{"jsonrpc":"2.0","id":1,"method":"eth_call"}`,
+			status:   http.StatusServiceUnavailable,
+			reason:   "all_providers_failed",
+			attempts: 1,
+		},
+		{
+			name:     "timeout",
+			url:      slow.URL,
+			body:     `{"jsonrpc":"2.0","id":1,"method":"eth_call"}`,
+			target:   "/?pretty=1",
+			status:   http.StatusServiceUnavailable,
+			reason:   "all_providers_failed",
+			attempts: 1,
+		},
+		{
+			name:   "oversized body",
+			url:    failing.URL,
+			body:   `{"jsonrpc":"2.0","id":1,"method":"eth_call","params":["` + strings.Repeat("ab", 64) + `"]}`,
+			status: http.StatusRequestEntityTooLarge,
+			reason: "request_too_large",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := tt.target
+			if target == "" {
+				target = "/"
+			}
+
+			req := httptest.NewRequest(http.MethodPost, target, bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			newProxy(tt.url).ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get(headers.ContentType))
+
+			var response gatewayError
+
+			decoder := json.NewDecoder(rr.Body)
+			decoder.DisallowUnknownFields()
+
+			assert.NoError(t, decoder.Decode(&response))
+			assert.Equal(t, "2.0", response.Jsonrpc)
+			assert.NotZero(t, response.Error.Code)
+			assert.NotEmpty(t, response.Error.Message)
+			assert.Equal(t, tt.reason, response.Gateway.Reason)
+			assert.Equal(t, tt.attempts, response.Gateway.Attempts)
+			assert.Len(t, response.Error.Data, tt.attempts)
+		})
+	}
+}
+
+func TestNewProxyReturnsConstructionErrors(t *testing.T) {
+	config := createConfig()
+
+	_, err := NewProxy(config)
+	assert.ErrorIs(t, err, ErrMissingHealthCheckManager)
+
+	config.HealthcheckManager = newTestHealthCheckManager(t, "Server1")
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "localhost:8545"}},
+		},
+	}
+
+	_, err = NewProxy(config)
+	assert.ErrorContains(t, err, `invalid target "Server1"`)
+}
+
+func TestHttpFailoverProxyTargetUnknownToHealthChecks(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	config := createConfig()
+	config.HealthcheckManager = newTestHealthCheckManager(t, "Other")
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		},
+	}
+
+	p, err := NewProxy(config)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"reason":"no_provider_available"`)
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// admissionQueue bounds the number of requests waiting for a target slot
+// when every target is at its concurrency limit. Waiters are woken up
+// whenever a slot is released and compete for it again.
+type admissionQueue struct {
+	depth   int64
+	maxWait time.Duration
+	waiting atomic.Int64
+
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+func newAdmissionQueue(config QueueConfig) *admissionQueue {
+	return &admissionQueue{
+		depth:   int64(config.Depth),
+		maxWait: config.MaxWait,
+		changed: make(chan struct{}),
+	}
+}
+
+// Enter reserves a place in the queue. It returns false when the queue is
+// full.
+func (q *admissionQueue) Enter() bool {
+	if q.waiting.Add(1) > q.depth {
+		q.waiting.Add(-1)
+
+		return false
+	}
+
+	return true
+}
+
+// Leave frees a place in the queue.
+func (q *admissionQueue) Leave() {
+	q.waiting.Add(-1)
+}
+
+// Len returns the number of requests currently waiting.
+func (q *admissionQueue) Len() int64 {
+	return q.waiting.Load()
+}
+
+// Changed returns a channel closed on the next Broadcast. It has to be
+// obtained before trying to acquire a slot, otherwise a release happening in
+// between would be missed.
+func (q *admissionQueue) Changed() <-chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.changed
+}
+
+// Broadcast wakes up every waiter.
+func (q *admissionQueue) Broadcast() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
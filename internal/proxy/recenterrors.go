@@ -0,0 +1,242 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRecentErrorsSize is the number of errors kept per target when
+	// no size is configured.
+	DefaultRecentErrorsSize = 20
+
+	// recentErrorSnippetLength caps the response snippet of recent errors.
+	recentErrorSnippetLength = 512
+)
+
+// RecentErrorsConfig keeps the last errors of every target, to tell why a
+// target is failing without going through the logs.
+type RecentErrorsConfig struct {
+	// Size is the number of errors kept per target. Defaults to 20, a
+	// negative value disables it.
+	Size int `yaml:"size"`
+}
+
+func (c RecentErrorsConfig) size() int {
+	if c.Size == 0 {
+		return DefaultRecentErrorsSize
+	}
+
+	return c.Size
+}
+
+// RecentError is a failed attempt of a target.
+type RecentError struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	// StatusCode is the one of the response, 502 for transport errors.
+	StatusCode int `json:"statusCode"`
+	// Error is the transport error, if any, and Type its type, e.g.
+	// "tls_cert_expired".
+	Error string `json:"error,omitempty"`
+	Type  string `json:"type,omitempty"`
+	// Snippet is the start of the response body.
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// errorRing keeps the last errors of a target. Its memory is bounded by its
+// size and the snippet length.
+type errorRing struct {
+	mu      sync.Mutex
+	entries []RecentError
+	next    int
+	full    bool
+}
+
+func newErrorRing(size int) *errorRing {
+	if size <= 0 {
+		return nil
+	}
+
+	return &errorRing{
+		entries: make([]RecentError, size),
+	}
+}
+
+func (r *errorRing) Add(e RecentError) {
+	e.Snippet = truncate(e.Snippet, recentErrorSnippetLength)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % len(r.entries)
+
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Clear drops the errors and returns how many there were.
+func (r *errorRing) Clear() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+
+	clear(r.entries)
+	r.next = 0
+	r.full = false
+
+	return n
+}
+
+// List returns the errors, the most recent first.
+func (r *errorRing) List() []RecentError {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := r.next
+	if r.full {
+		n = len(r.entries)
+	}
+
+	list := make([]RecentError, 0, n)
+
+	for i := 1; i <= n; i++ {
+		list = append(list, r.entries[(r.next-i+len(r.entries))%len(r.entries)])
+	}
+
+	return list
+}
+
+type attemptErrorContextKey struct{}
+
+// attemptError holds the transport error of an attempt, which providers
+// only report as a 502 response.
+type attemptError struct {
+	mu  sync.Mutex
+	err error
+}
+
+func withAttemptError(c context.Context, e *attemptError) context.Context {
+	return context.WithValue(c, attemptErrorContextKey{}, e)
+}
+
+// recordAttemptError keeps the transport error of the attempt served with
+// the context, if it's tracked.
+func recordAttemptError(c context.Context, err error) {
+	e, ok := c.Value(attemptErrorContextKey{}).(*attemptError)
+	if !ok {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.err = err
+}
+
+func (e *attemptError) Err() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.err
+}
+
+// proxyErrorHandler answers transport errors like the default handler of the
+// reverse proxy, and keeps the error, with its type, for the recent errors
+// and the metrics.
+func (p *Proxy) proxyErrorHandler(name string) func(http.ResponseWriter, *http.Request, error) {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+		e := classifyTransportError(err)
+		logTransportError(p.logger.With("nodeprovider", name), "upstream error", e)
+
+		recordAttemptError(r.Context(), e)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+// observeError records a failed attempt of the target.
+func (p *Proxy) observeError(target *NodeProvider, requests []JSONRPCRequest, pw *ReponseWriter, err error) {
+	if target.recentErrors == nil {
+		return
+	}
+
+	e := RecentError{
+		Time:       time.Now(),
+		Method:     requestMethod(requests),
+		StatusCode: pw.statusCode,
+	}
+
+	// Add truncates the snippet, only copy what it keeps.
+	//
+	body := pw.body.Bytes()
+	e.Snippet = string(body[:min(len(body), recentErrorSnippetLength+1)])
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	var transportErr *TransportError
+	if errors.As(err, &transportErr) {
+		e.Type = transportErr.Type
+	}
+
+	target.recentErrors.Add(e)
+}
+
+// RecentErrors returns the last errors of the named target, the most recent
+// first.
+func (p *Proxy) RecentErrors(name string) ([]RecentError, error) {
+	target, err := p.target(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if target.recentErrors == nil {
+		return []RecentError{}, nil
+	}
+
+	return target.recentErrors.List(), nil
+}
+
+// ErrorsReset is what a reset of the errors of a target cleared.
+type ErrorsReset struct {
+	RecentErrors        int `json:"recentErrors"`
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+	PermanentFailures   int `json:"permanentFailures"`
+}
+
+// ResetErrors clears the recent errors of the named target and its counts of
+// consecutive failures, e.g. once its provider fixed an issue. Its taints
+// and rolling windows are kept.
+func (p *Proxy) ResetErrors(name string) (ErrorsReset, error) {
+	target, err := p.target(name)
+	if err != nil {
+		return ErrorsReset{}, err
+	}
+
+	consecutive, err := p.hcm.resetConsecutiveFailures(name)
+	if err != nil {
+		return ErrorsReset{}, err
+	}
+
+	reset := ErrorsReset{
+		ConsecutiveFailures: consecutive,
+		PermanentFailures:   int(target.permanentFailures.Swap(0)),
+	}
+
+	if target.recentErrors != nil {
+		reset.RecentErrors = target.recentErrors.Clear()
+	}
+
+	return reset, nil
+}
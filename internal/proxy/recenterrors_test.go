@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorRing(t *testing.T) {
+	ring := newErrorRing(3)
+
+	assert.Empty(t, ring.List())
+
+	for _, method := range []string{"a", "b", "c", "d", "e"} {
+		ring.Add(RecentError{Method: method})
+	}
+
+	list := ring.List()
+	assert.Len(t, list, 3)
+	assert.Equal(t, "e", list[0].Method)
+	assert.Equal(t, "d", list[1].Method)
+	assert.Equal(t, "c", list[2].Method)
+
+	ring.Add(RecentError{Snippet: strings.Repeat("x", 1024)})
+	assert.Len(t, ring.List()[0].Snippet, recentErrorSnippetLength+len("..."))
+
+	assert.Nil(t, newErrorRing(-1))
+}
+
+func TestHttpFailoverProxyRecordsRecentErrors(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var calls atomic.Int64
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"boom"}}`))
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(strings.Repeat("x", 1024)))
+		default:
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		}
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	for _, method := range []string{"eth_call", "eth_getLogs", "eth_blockNumber"} {
+		req := httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"`+method+`"}`))
+		rr := httptest.NewRecorder()
+
+		httpFailoverProxy.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	}
+
+	recent, err := httpFailoverProxy.RecentErrors("Server1")
+	assert.NoError(t, err)
+	assert.Len(t, recent, 3)
+
+	assert.Equal(t, "eth_blockNumber", recent[0].Method)
+	assert.Equal(t, http.StatusBadGateway, recent[0].StatusCode)
+	assert.Contains(t, recent[0].Error, "EOF")
+
+	assert.Equal(t, "eth_getLogs", recent[1].Method)
+	assert.Equal(t, http.StatusTooManyRequests, recent[1].StatusCode)
+	assert.Empty(t, recent[1].Error)
+	assert.Equal(t, strings.Repeat("x", recentErrorSnippetLength)+"...", recent[1].Snippet)
+
+	assert.Equal(t, "eth_call", recent[2].Method)
+	assert.Equal(t, http.StatusInternalServerError, recent[2].StatusCode)
+	assert.Contains(t, recent[2].Snippet, "boom")
+
+	assert.False(t, recent[0].Time.Before(recent[1].Time))
+
+	_, err = httpFailoverProxy.RecentErrors("Unknown")
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+}
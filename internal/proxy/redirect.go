@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// RedirectsPassThrough forwards the redirects of the target to the
+	// client. It's the default mode.
+	RedirectsPassThrough = "passThrough"
+	// RedirectsFollow follows the redirects of the target, re-sending the
+	// request as is.
+	RedirectsFollow = "follow"
+	// RedirectsReject fails the attempts redirected by the target, so the
+	// request is rerouted.
+	RedirectsReject = "reject"
+
+	// DefaultMaxRedirects is the number of redirects followed per attempt
+	// when no maxRedirects is configured.
+	DefaultMaxRedirects = 3
+
+	// redirectDrainLimit is how much of the body of a redirect is read, so
+	// its connection can be reused.
+	redirectDrainLimit = 4 << 10
+)
+
+// ErrUpstreamRedirect fails the attempts redirected by a target when the
+// redirect isn't followed.
+var ErrUpstreamRedirect = errors.New("upstream redirect")
+
+// NodeProviderRedirectsConfig sets how the redirects of a target are
+// handled.
+type NodeProviderRedirectsConfig struct {
+	// Mode is either "passThrough" (default), "follow" or "reject".
+	Mode string `yaml:"mode"`
+
+	// MaxRedirects is the number of redirects followed per attempt in the
+	// "follow" mode, the attempt fails past it. Defaults to 3.
+	MaxRedirects uint `yaml:"maxRedirects"`
+
+	// CrossHost follows the redirects to other hosts too, without the
+	// credentials of the request. They fail the attempt otherwise.
+	CrossHost bool `yaml:"crossHost"`
+}
+
+func (c NodeProviderRedirectsConfig) validate() error {
+	switch c.Mode {
+	case "", RedirectsPassThrough, RedirectsFollow, RedirectsReject:
+		return nil
+	default:
+		return errors.Errorf("unknown redirects mode %q", c.Mode)
+	}
+}
+
+func (c NodeProviderRedirectsConfig) enabled() bool {
+	return c.Mode == RedirectsFollow || c.Mode == RedirectsReject
+}
+
+func (c NodeProviderRedirectsConfig) maxRedirects() int {
+	if c.MaxRedirects == 0 {
+		return DefaultMaxRedirects
+	}
+
+	return int(c.MaxRedirects)
+}
+
+func isRedirect(statusCode int) bool {
+	switch statusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	default:
+		return false
+	}
+}
+
+// redirectTransport follows or rejects the redirects of a target. Followed
+// redirects re-send the request as is, whatever their status code, as a
+// JSON-RPC call only makes sense as a POST.
+type redirectTransport struct {
+	next   http.RoundTripper
+	name   string
+	config NodeProviderRedirectsConfig
+
+	metricRedirects *prometheus.CounterVec
+}
+
+func newRedirectTransport(
+	next http.RoundTripper,
+	name string,
+	config NodeProviderRedirectsConfig,
+	metricRedirects *prometheus.CounterVec,
+) *redirectTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &redirectTransport{
+		next:            next,
+		name:            name,
+		config:          config,
+		metricRedirects: metricRedirects,
+	}
+}
+
+func (t *redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	visited := map[string]bool{r.URL.String(): true}
+
+	for redirects := 0; ; redirects++ {
+		resp, err := t.next.RoundTrip(r)
+		if err != nil || !isRedirect(resp.StatusCode) {
+			return resp, err
+		}
+
+		// A redirect without a location can't be followed, the client gets
+		// it as is.
+		//
+		location, err := resp.Location()
+		if err != nil {
+			return resp, nil // nolint:nilerr
+		}
+
+		io.CopyN(io.Discard, resp.Body, redirectDrainLimit) // nolint:errcheck
+		resp.Body.Close()
+
+		crossHost := location.Host != r.URL.Host || location.Scheme != r.URL.Scheme
+
+		switch {
+		case t.config.Mode == RedirectsReject:
+			return nil, t.reject("rejected", "redirected to %s", location.Redacted())
+		case crossHost && !t.config.CrossHost:
+			return nil, t.reject("cross_host", "redirected to another host, %s", location.Host)
+		case r.URL.Scheme == "https" && location.Scheme != "https":
+			return nil, t.reject("downgrade", "redirected from https to %s", location.Scheme)
+		case visited[location.String()]:
+			return nil, t.reject("loop", "redirect loop through %s", location.Redacted())
+		case redirects >= t.config.maxRedirects():
+			return nil, t.reject("too_many", "more than %d redirects", t.config.maxRedirects())
+		}
+
+		next, err := redirectedRequest(r, location, crossHost)
+		if err != nil {
+			return nil, t.reject("rejected", "cannot replay the request: %s", err)
+		}
+
+		t.metricRedirects.WithLabelValues(t.name, "followed").Inc()
+
+		visited[location.String()] = true
+		r = next
+	}
+}
+
+// reject counts a redirect that isn't followed for reason and returns the
+// error failing the attempt.
+func (t *redirectTransport) reject(reason, format string, args ...interface{}) error {
+	t.metricRedirects.WithLabelValues(t.name, reason).Inc()
+
+	return errors.Wrapf(ErrUpstreamRedirect, format, args...)
+}
+
+// redirectedRequest returns r sent to location, with a fresh copy of its
+// body. Credentials aren't sent to other hosts.
+func redirectedRequest(r *http.Request, location *url.URL, crossHost bool) (*http.Request, error) {
+	next := r.Clone(r.Context())
+	next.URL = location
+
+	if r.Body != nil && r.Body != http.NoBody {
+		if r.GetBody == nil {
+			return nil, errors.New("no body to replay")
+		}
+
+		body, err := r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+
+		next.Body = body
+	}
+
+	if crossHost {
+		next.Host = ""
+		next.Header.Del(headers.Authorization)
+		next.Header.Del(headers.Cookie)
+	}
+
+	return next, nil
+}
+
+// CloseIdleConnections forwards to the wrapped transport.
+func (t *redirectTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
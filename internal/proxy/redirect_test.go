@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectTestRequest = `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`
+
+// newRedirectingNode returns a target redirecting "/hop" to "/", "/" to
+// "/moved", "/loop" to "/loop2" and back, and "/away" to to, answering with
+// the body it got on "/moved".
+func newRedirectingNode(t *testing.T, to string) *httptest.Server {
+	t.Helper()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/moved", http.StatusTemporaryRedirect)
+		case "/hop":
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+		case "/loop":
+			http.Redirect(w, r, "/loop2", http.StatusFound)
+		case "/loop2":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/away":
+			http.Redirect(w, r, to, http.StatusPermanentRedirect)
+		case "/moved":
+			body, _ := io.ReadAll(r.Body)
+			w.Write(body) // nolint:errcheck
+		}
+	}))
+	t.Cleanup(node.Close)
+
+	return node
+}
+
+// newRedirectTestProxy returns a proxy to url, redirecting as set by
+// redirects, failing over to a target answering "0x2".
+func newRedirectTestProxy(t *testing.T, url string, redirects NodeProviderRedirectsConfig) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	fallback := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x2"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(fallback.Close)
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{URL: url, Redirects: redirects},
+			},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: fallback.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, config)
+}
+
+func serveRedirectTestRequest(p *Proxy) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(redirectTestRequest)))
+
+	return rr
+}
+
+func TestRedirectsFollow(t *testing.T) {
+	node := newRedirectingNode(t, "")
+	p := newRedirectTestProxy(t, node.URL, NodeProviderRedirectsConfig{Mode: RedirectsFollow})
+
+	rr := serveRedirectTestRequest(p)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, redirectTestRequest, rr.Body.String())
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricUpstreamRedirects.WithLabelValues("Server1", "followed")))
+}
+
+func TestRedirectsPassThrough(t *testing.T) {
+	node := newRedirectingNode(t, "")
+	p := newRedirectTestProxy(t, node.URL, NodeProviderRedirectsConfig{})
+
+	rr := serveRedirectTestRequest(p)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, "/moved", rr.Header().Get("Location"))
+}
+
+func TestRedirectsFailOver(t *testing.T) {
+	other := newRedirectingNode(t, "")
+
+	for name, tc := range map[string]struct {
+		path      string
+		redirects NodeProviderRedirectsConfig
+		outcome   string
+	}{
+		"reject":     {"/", NodeProviderRedirectsConfig{Mode: RedirectsReject}, "rejected"},
+		"cross host": {"/away", NodeProviderRedirectsConfig{Mode: RedirectsFollow}, "cross_host"},
+		"loop":       {"/loop", NodeProviderRedirectsConfig{Mode: RedirectsFollow}, "loop"},
+		"too many":   {"/hop", NodeProviderRedirectsConfig{Mode: RedirectsFollow, MaxRedirects: 1}, "too_many"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			node := newRedirectingNode(t, other.URL+"/moved")
+			p := newRedirectTestProxy(t, node.URL+tc.path, tc.redirects)
+
+			rr := serveRedirectTestRequest(p)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x2"}`, rr.Body.String())
+			assert.Equal(t, 1.0, testutil.ToFloat64(p.metricUpstreamRedirects.WithLabelValues("Server1", tc.outcome)))
+		})
+	}
+}
+
+func TestRedirectsFollowCrossHost(t *testing.T) {
+	authorization := make(chan string, 1)
+
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+
+		io.Copy(w, r.Body) // nolint:errcheck
+	}))
+	t.Cleanup(other.Close)
+
+	node := newRedirectingNode(t, other.URL)
+
+	transport := newRedirectTransport(http.DefaultTransport, "Server1",
+		NodeProviderRedirectsConfig{Mode: RedirectsFollow, CrossHost: true},
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "redirects"}, []string{"provider", "outcome"}))
+
+	req, err := http.NewRequest(http.MethodPost, node.URL+"/away", bytes.NewBufferString(redirectTestRequest))
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.JSONEq(t, redirectTestRequest, string(body))
+	assert.Empty(t, <-authorization)
+}
+
+func TestRedirectsLoop(t *testing.T) {
+	transport := newRedirectTransport(http.DefaultTransport, "Server1",
+		NodeProviderRedirectsConfig{Mode: RedirectsFollow, MaxRedirects: 10},
+		prometheus.NewCounterVec(prometheus.CounterOpts{Name: "redirects"}, []string{"provider", "outcome"}))
+
+	node := newRedirectingNode(t, "")
+
+	req, err := http.NewRequest(http.MethodPost, node.URL+"/loop", bytes.NewBufferString(redirectTestRequest))
+	require.NoError(t, err)
+
+	_, err = transport.RoundTrip(req)
+	require.ErrorIs(t, err, ErrUpstreamRedirect)
+	assert.Equal(t, 1.0, testutil.ToFloat64(transport.metricRedirects.WithLabelValues("Server1", "followed")))
+	assert.Equal(t, 1.0, testutil.ToFloat64(transport.metricRedirects.WithLabelValues("Server1", "loop")))
+}
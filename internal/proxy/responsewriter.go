@@ -1,31 +1,142 @@
 package proxy
 
 import (
+	"bufio"
 	"bytes"
+	"net"
 	"net/http"
 )
 
+// ReponseWriter buffers an upstream response, so the proxy can fail over
+// before the client got any byte of it. Once streamed to the client, it
+// writes through.
 type ReponseWriter struct {
 	body       *bytes.Buffer
 	header     http.Header
 	statusCode int
+
+	// wroteHeader is set by the final status code, the next ones are
+	// ignored.
+	wroteHeader bool
+	// informational holds the 1xx status codes received before the final
+	// one.
+	informational []int
+
+	// streaming is the writer of the client once the response is streamed
+	// to it, nil while buffering.
+	streaming http.ResponseWriter
 }
 
 func (p *ReponseWriter) Header() http.Header {
+	if p.streaming != nil {
+		return p.streaming.Header()
+	}
+
 	return p.header
 }
 
 func (p *ReponseWriter) Write(b []byte) (int, error) {
+	if !p.wroteHeader {
+		p.WriteHeader(http.StatusOK)
+	}
+
+	if p.streaming != nil {
+		return p.streaming.Write(b)
+	}
+
 	return p.body.Write(b)
 }
 
+// WriteHeader sets the status code of the response. Informational status
+// codes are kept aside, as the final one follows them, and the status codes
+// following the final one are ignored.
 func (p *ReponseWriter) WriteHeader(statusCode int) {
+	if p.wroteHeader {
+		return
+	}
+
+	if statusCode >= 100 && statusCode < http.StatusOK && statusCode != http.StatusSwitchingProtocols {
+		p.informational = append(p.informational, statusCode)
+
+		return
+	}
+
 	p.statusCode = statusCode
+	p.wroteHeader = true
+}
+
+// StatusCode returns the final status code of the response, zero until it's
+// written.
+func (p *ReponseWriter) StatusCode() int {
+	return p.statusCode
+}
+
+// Informational returns the 1xx status codes received before the final one.
+func (p *ReponseWriter) Informational() []int {
+	return p.informational
+}
+
+// Flush is a no-op while buffering, it flushes the client writer once
+// streaming.
+func (p *ReponseWriter) Flush() {
+	if p.streaming == nil {
+		return
+	}
+
+	http.NewResponseController(p.streaming).Flush() // nolint:errcheck
+}
+
+// Hijack hijacks the connection of the client writer once streaming. A
+// buffered response can't be hijacked, the client never sees it.
+func (p *ReponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if p.streaming == nil {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	return http.NewResponseController(p.streaming).Hijack()
+}
+
+// Unwrap returns the client writer once streaming, for
+// http.ResponseController, nil while buffering.
+func (p *ReponseWriter) Unwrap() http.ResponseWriter {
+	return p.streaming
+}
+
+// stream writes the status code and what has been buffered to w, and the
+// rest of the response through. The headers are copied to w beforehand by the
+// caller, which filters them. The buffered body is kept, e.g. for the caches.
+func (p *ReponseWriter) stream(w http.ResponseWriter) error {
+	if p.wroteHeader {
+		w.WriteHeader(p.statusCode)
+	}
+
+	p.streaming = w
+
+	if p.body.Len() == 0 {
+		return nil
+	}
+
+	_, err := w.Write(p.body.Bytes())
+
+	return err
 }
 
 func NewResponseWriter() *ReponseWriter {
+	return newResponseWriterWithBuffer(&bytes.Buffer{})
+}
+
+func newResponseWriterWithBuffer(body *bytes.Buffer) *ReponseWriter {
 	return &ReponseWriter{
 		header: http.Header{},
-		body:   &bytes.Buffer{},
+		body:   body,
 	}
 }
+
+// reset discards whatever has been written and sets the status code.
+func (p *ReponseWriter) reset(statusCode int) {
+	p.body.Reset()
+	p.header = http.Header{}
+	p.statusCode = statusCode
+	p.wroteHeader = true
+	p.informational = nil
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseWriterInformationalResponses(t *testing.T) {
+	pw := NewResponseWriter()
+
+	pw.WriteHeader(http.StatusContinue)
+	pw.WriteHeader(http.StatusEarlyHints)
+	assert.Zero(t, pw.StatusCode())
+
+	pw.WriteHeader(http.StatusAccepted)
+	pw.Write([]byte("ok")) // nolint:errcheck
+
+	assert.Equal(t, http.StatusAccepted, pw.StatusCode())
+	assert.Equal(t, []int{http.StatusContinue, http.StatusEarlyHints}, pw.Informational())
+	assert.Equal(t, "ok", pw.body.String())
+}
+
+func TestResponseWriterIgnoresSuperfluousWriteHeader(t *testing.T) {
+	pw := NewResponseWriter()
+
+	pw.Write([]byte("ok")) // nolint:errcheck
+	pw.WriteHeader(http.StatusInternalServerError)
+
+	assert.Equal(t, http.StatusOK, pw.StatusCode())
+
+	// A reset replaces the response, whatever has been written.
+	//
+	pw.reset(http.StatusBadGateway)
+	pw.WriteHeader(http.StatusOK)
+
+	assert.Equal(t, http.StatusBadGateway, pw.StatusCode())
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	pw := NewResponseWriter()
+	rr := httptest.NewRecorder()
+
+	pw.Header().Set("X-Upstream", "1")
+	pw.WriteHeader(http.StatusOK)
+	pw.Write([]byte("buffered ")) // nolint:errcheck
+
+	// Flushing a buffered response sends nothing to the client.
+	//
+	require.NoError(t, http.NewResponseController(pw).Flush())
+	assert.Equal(t, "buffered ", pw.body.String())
+	assert.False(t, rr.Flushed)
+
+	_, _, err := http.NewResponseController(pw).Hijack()
+	assert.ErrorIs(t, err, http.ErrNotSupported)
+
+	(&Proxy{}).copyHeaders(rr, pw)
+	require.NoError(t, pw.stream(rr))
+
+	pw.Write([]byte("streamed")) // nolint:errcheck
+	require.NoError(t, http.NewResponseController(pw).Flush())
+
+	assert.True(t, rr.Flushed)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("X-Upstream"))
+	assert.Equal(t, "buffered streamed", rr.Body.String())
+	assert.Equal(t, rr, pw.Unwrap())
+}
+
+func TestHttpFailoverProxyInformationalResponses(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</style.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	defer upstream.Close()
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: upstream.URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, rr.Body.String())
+	assert.Equal(t, map[string]uint64{statusClass2xx: 1}, observedStatusClasses(t, p))
+}
@@ -0,0 +1,223 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// DefaultRetryBackoff is the wait before the first retry when no backoff
+	// is configured.
+	DefaultRetryBackoff = 50 * time.Millisecond
+
+	// DefaultRetryMaxBackoff caps the wait between retries when no maxBackoff
+	// is configured.
+	DefaultRetryMaxBackoff = time.Second
+
+	// DefaultRateLimitCooldown is the wait before retrying a rate limited
+	// request without Retry-After when no rateLimitCooldown is configured.
+	DefaultRateLimitCooldown = time.Second
+)
+
+// Classes of upstream attempt outcomes.
+const (
+	attemptSuccess     = "success"
+	attemptClientError = "client_error"
+	attemptNetworkErr  = "network_error"
+	attemptServerError = "server_error"
+	attemptRateLimited = "rate_limited"
+	attemptCanceled    = "canceled"
+	// attemptPermanent is a failure retrying the same target can't fix, it
+	// fails over at once.
+	attemptPermanent = "permanent_error"
+)
+
+// RetryConfig retries an attempt on the same target before failing over to
+// the next one. Only network errors, 5xx and 429 responses are retried, not
+// the permanent failures: 404 and 405 responses, certificates that can't be
+// trusted and hosts that don't exist.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts made to a target, the first one
+	// included. Zero or one disables retries.
+	MaxAttempts uint `yaml:"maxAttempts"`
+
+	// Backoff is the wait before the first retry, doubled on every next one.
+	// Defaults to 50ms.
+	Backoff time.Duration `yaml:"backoff"`
+
+	// MaxBackoff caps the wait between retries. Defaults to 1s.
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+
+	// RateLimitCooldown is the wait before retrying a 429 response without
+	// a Retry-After header. Defaults to 1s.
+	RateLimitCooldown time.Duration `yaml:"rateLimitCooldown"`
+}
+
+func (c RetryConfig) enabled() bool {
+	return c.MaxAttempts > 1
+}
+
+func (c RetryConfig) backoff(retry int) time.Duration {
+	backoff := c.Backoff
+	if backoff <= 0 {
+		backoff = DefaultRetryBackoff
+	}
+
+	maxBackoff := c.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultRetryMaxBackoff
+	}
+
+	for i := 1; i < retry && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, maxBackoff)
+}
+
+// retryAfter returns the wait set by the Retry-After header, in seconds.
+func retryAfter(h http.Header) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(h.Get(headers.RetryAfter))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+
+	return time.Duration(seconds) * time.Second, true
+}
+
+// rateLimitCooldown returns the wait before retrying the rate limited resp,
+// the configured one when resp is nil.
+func (c RetryConfig) rateLimitCooldown(resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header); ok {
+			return wait
+		}
+	}
+
+	if c.RateLimitCooldown <= 0 {
+		return DefaultRateLimitCooldown
+	}
+
+	return c.RateLimitCooldown
+}
+
+// classifyAttempt returns the class of an upstream attempt outcome.
+func classifyAttempt(c context.Context, resp *http.Response, err error) string {
+	switch {
+	case c.Err() != nil:
+		return attemptCanceled
+	case isPermanentTransportError(err):
+		return attemptPermanent
+	case err != nil:
+		return attemptNetworkErr
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return attemptRateLimited
+	case isPermanentStatus(resp.StatusCode):
+		return attemptPermanent
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return attemptServerError
+	case resp.StatusCode >= http.StatusBadRequest:
+		return attemptClientError
+	default:
+		return attemptSuccess
+	}
+}
+
+func isRetryable(class string) bool {
+	return class == attemptNetworkErr || class == attemptServerError || class == attemptRateLimited
+}
+
+// retryTransport retries the attempts of a single target. It stops as soon
+// as the client context is done, and never waits past its deadline.
+type retryTransport struct {
+	next   http.RoundTripper
+	name   string
+	config RetryConfig
+
+	metricAttempts *prometheus.CounterVec
+}
+
+func newRetryTransport(
+	next http.RoundTripper,
+	name string,
+	config RetryConfig,
+	metricAttempts *prometheus.CounterVec,
+) *retryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &retryTransport{
+		next:           next,
+		name:           name,
+		config:         config,
+		metricAttempts: metricAttempts,
+	}
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c := r.Context()
+
+	for attempt := 1; ; attempt++ {
+		start := time.Now()
+
+		resp, err := t.next.RoundTrip(r)
+
+		class := classifyAttempt(c, resp, err)
+		t.metricAttempts.WithLabelValues(t.name, class).Inc()
+
+		if !isRetryable(class) || attempt >= t.config.maxAttempts(c) || r.GetBody == nil {
+			return resp, err
+		}
+
+		wait := t.config.backoff(attempt)
+		if class == attemptRateLimited {
+			wait = t.config.rateLimitCooldown(resp)
+		}
+
+		if deadline, ok := c.Deadline(); ok && time.Until(deadline) <= wait {
+			return resp, err
+		}
+
+		body, bodyErr := r.GetBody()
+		if bodyErr != nil {
+			return resp, err
+		}
+
+		if attempts := requestAttemptsFromContext(c); attempts != nil {
+			attempts.Record(t.name, start, "retried_"+class)
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body) // nolint:errcheck
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-timer.C:
+		case <-c.Done():
+			timer.Stop()
+			body.Close()
+
+			return nil, c.Err()
+		}
+
+		r = r.Clone(c)
+		r.Body = body
+	}
+}
+
+// CloseIdleConnections forwards to the wrapped transport.
+func (t *retryTransport) CloseIdleConnections() {
+	if closer, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
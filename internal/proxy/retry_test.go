@@ -0,0 +1,213 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRetryTransport(config RetryConfig) *retryTransport {
+	metric := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "attempts"}, []string{"provider", "class"})
+
+	return newRetryTransport(http.DefaultTransport, "Server1", config, metric)
+}
+
+func newRetryRequest(t *testing.T, c context.Context, url string) *http.Request {
+	t.Helper()
+
+	r, err := http.NewRequestWithContext(c, http.MethodPost, url, nil)
+	assert.NoError(t, err)
+
+	return newAttemptRequest(r, []byte(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+}
+
+func TestRetryTransportRetriesRetryableClasses(t *testing.T) {
+	tests := []struct {
+		name  string
+		class string
+		fail  func(w http.ResponseWriter)
+	}{
+		{
+			name:  "network error",
+			class: attemptNetworkErr,
+			fail: func(w http.ResponseWriter) {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+			},
+		},
+		{
+			name:  "server error",
+			class: attemptServerError,
+			fail: func(w http.ResponseWriter) {
+				w.WriteHeader(http.StatusBadGateway)
+			},
+		},
+		{
+			name:  "rate limited",
+			class: attemptRateLimited,
+			fail: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int64
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				assert.Equal(t, `{"jsonrpc":"2.0","id":1,"method":"eth_call"}`, string(body))
+
+				if calls.Add(1) == 1 {
+					tt.fail(w)
+
+					return
+				}
+
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+			}))
+			defer server.Close()
+
+			transport := newTestRetryTransport(RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond})
+
+			resp, err := transport.RoundTrip(newRetryRequest(t, context.Background(), server.URL))
+			assert.NoError(t, err)
+
+			defer resp.Body.Close()
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, int64(2), calls.Load())
+			assert.Equal(t, float64(1), testutil.ToFloat64(transport.metricAttempts.WithLabelValues("Server1", tt.class)))
+			assert.Equal(t, float64(1), testutil.ToFloat64(transport.metricAttempts.WithLabelValues("Server1", attemptSuccess)))
+		})
+	}
+}
+
+func TestRetryTransportPassesClientErrorsThrough(t *testing.T) {
+	var calls atomic.Int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	transport := newTestRetryTransport(RetryConfig{MaxAttempts: 3, Backoff: time.Millisecond})
+
+	resp, err := transport.RoundTrip(newRetryRequest(t, context.Background(), server.URL))
+	assert.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, int64(1), calls.Load())
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	var calls atomic.Int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	t.Run("max attempts", func(t *testing.T) {
+		calls.Store(0)
+
+		transport := newTestRetryTransport(RetryConfig{MaxAttempts: 1})
+
+		resp, err := transport.RoundTrip(newRetryRequest(t, context.Background(), server.URL))
+		assert.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("cooldown past the deadline", func(t *testing.T) {
+		calls.Store(0)
+
+		c, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		transport := newTestRetryTransport(RetryConfig{MaxAttempts: 3})
+
+		resp, err := transport.RoundTrip(newRetryRequest(t, c, server.URL))
+		assert.NoError(t, err)
+
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.Equal(t, int64(1), calls.Load())
+	})
+
+	t.Run("client gone", func(t *testing.T) {
+		calls.Store(0)
+
+		c, cancel := context.WithCancel(context.Background())
+
+		transport := newTestRetryTransport(RetryConfig{MaxAttempts: 3})
+
+		time.AfterFunc(50*time.Millisecond, cancel)
+
+		_, err := transport.RoundTrip(newRetryRequest(t, c, server.URL))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, int64(1), calls.Load())
+	})
+}
+
+func TestHttpFailoverProxyRetriesBeforeFailover(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var calls atomic.Int64
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+
+			return
+		}
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.Retry = RetryConfig{MaxAttempts: 2, Backoff: time.Millisecond}
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: fakeRPCServer.URL,
+				},
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(2), calls.Load())
+	assert.Equal(t, float64(1),
+		testutil.ToFloat64(httpFailoverProxy.metricUpstreamAttempts.WithLabelValues("Server1", attemptServerError)))
+}
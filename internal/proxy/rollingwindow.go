@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRollingWindowSize is the number of observations kept per target.
+	DefaultRollingWindowSize = 100
+
+	// DefaultRollingWindowMinObservations is the fraction of the window that
+	// has to be filled before its average is considered meaningful.
+	DefaultRollingWindowMinObservations = 0.9
+)
+
+// Rolling window implementations.
+const (
+	// RollingWindowAtomic is lock free, the default.
+	RollingWindowAtomic = "atomic"
+	// RollingWindowMutex guards the window with a mutex.
+	RollingWindowMutex = "mutex"
+)
+
+func validateRollingWindowImplementation(implementation string) error {
+	switch implementation {
+	case "", RollingWindowAtomic, RollingWindowMutex:
+		return nil
+	default:
+		return errors.Errorf("invalid rolling window implementation %q", implementation)
+	}
+}
+
+// RollingWindow keeps the last size observations of a target, 1 for a
+// success and 0 for a failure. It's observed by every attempt, so by default
+// it's lock free, see atomicObservations.
+type RollingWindow struct {
+	size            int
+	minObservations float64
+
+	observations windowObservations
+}
+
+// windowObservations stores the observations of a window.
+type windowObservations interface {
+	observe(value int)
+	// stats returns the number of observations and their sum, read together
+	// so the average of a window being filled isn't biased.
+	stats() (int, int64)
+	// window returns a copy of the observations, oldest first.
+	window() []int
+	reset()
+}
+
+// NewRollingWindow creates a lock free window of the given size.
+// minObservations is the fraction of the window that has to be filled for
+// HasEnoughObservations to return true.
+func NewRollingWindow(size int, minObservations float64) *RollingWindow {
+	return newRollingWindow(RollingWindowAtomic, size, minObservations)
+}
+
+// NewMutexRollingWindow creates a window like NewRollingWindow, guarded by a
+// mutex.
+func NewMutexRollingWindow(size int, minObservations float64) *RollingWindow {
+	return newRollingWindow(RollingWindowMutex, size, minObservations)
+}
+
+func newRollingWindow(implementation string, size int, minObservations float64) *RollingWindow {
+	if size <= 0 {
+		size = DefaultRollingWindowSize
+	}
+
+	if minObservations <= 0 || minObservations > 1 {
+		minObservations = DefaultRollingWindowMinObservations
+	}
+
+	r := &RollingWindow{
+		size:            size,
+		minObservations: minObservations,
+	}
+
+	if implementation == RollingWindowMutex {
+		r.observations = &mutexObservations{size: size, values: make([]int, 0, size)}
+	} else {
+		r.observations = newAtomicObservations(size)
+	}
+
+	return r
+}
+
+// Observe appends an observation, evicting the oldest one when the window is
+// full.
+func (r *RollingWindow) Observe(value int) {
+	r.observations.observe(value)
+}
+
+// Avg returns the average of the observations, 0 when there are none.
+func (r *RollingWindow) Avg() float64 {
+	n, sum := r.observations.stats()
+	if n == 0 {
+		return 0
+	}
+
+	return float64(sum) / float64(n)
+}
+
+// SuccessRate returns the fraction of successful observations. An empty
+// window is considered fully successful.
+func (r *RollingWindow) SuccessRate() float64 {
+	n, sum := r.observations.stats()
+	if n == 0 {
+		return 1
+	}
+
+	return float64(sum) / float64(n)
+}
+
+// Len returns the number of observations in the window.
+func (r *RollingWindow) Len() int {
+	n, _ := r.observations.stats()
+
+	return n
+}
+
+// HasEnoughObservations reports whether the window is filled enough for its
+// average to be meaningful.
+func (r *RollingWindow) HasEnoughObservations() bool {
+	return float64(r.Len())/float64(r.size) >= r.minObservations
+}
+
+// Window returns a copy of the observations, oldest first.
+func (r *RollingWindow) Window() []int {
+	return r.observations.window()
+}
+
+// Reset drops every observation.
+func (r *RollingWindow) Reset() {
+	r.observations.reset()
+}
+
+// mutexObservations keeps the observations in a ring guarded by a mutex.
+type mutexObservations struct {
+	size   int
+	values []int
+	next   int
+	sum    int64
+
+	mu sync.RWMutex
+}
+
+func (o *mutexObservations) observe(value int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if len(o.values) < o.size {
+		o.values = append(o.values, value)
+	} else {
+		o.sum -= int64(o.values[o.next])
+		o.values[o.next] = value
+		o.next = (o.next + 1) % o.size
+	}
+
+	o.sum += int64(value)
+}
+
+func (o *mutexObservations) stats() (int, int64) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	return len(o.values), o.sum
+}
+
+func (o *mutexObservations) window() []int {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	window := make([]int, 0, len(o.values))
+	window = append(window, o.values[o.next:]...)
+
+	return append(window, o.values[:o.next]...)
+}
+
+func (o *mutexObservations) reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.values = o.values[:0]
+	o.next = 0
+	o.sum = 0
+}
+
+// atomicObservations keeps the observations in a ring of atomic slots.
+// Readers see the observations being made by other goroutines once they're
+// done.
+type atomicObservations struct {
+	size int
+
+	// ring is replaced by reset, an observation racing with it may go to
+	// the previous ring and be dropped with it.
+	ring atomic.Pointer[windowRing]
+}
+
+// windowRing holds the observations of a window. count hands out the slots.
+// Every change of a slot adds its difference to the sum in totals, along
+// with the observation it adds to the window while it isn't full, so the
+// number of observations and their sum always change together.
+type windowRing struct {
+	slots  []atomic.Int64
+	count  atomic.Uint64
+	totals atomic.Uint64
+}
+
+func newAtomicObservations(size int) *atomicObservations {
+	o := &atomicObservations{size: size}
+	o.reset()
+
+	return o
+}
+
+// packTotals encodes a change of the number of observations and of their
+// sum. The sum goes in the low 32 bits, the changes adding up as integers so
+// it may be negative on its way, e.g. when an observation is replaced before
+// its own change is added.
+func packTotals(n int, sum int64) uint64 {
+	return uint64(n)<<32 + uint64(sum)
+}
+
+// unpackTotals decodes the totals of a ring.
+func unpackTotals(totals uint64) (int, int64) {
+	n := (int64(totals) + 1<<31) >> 32
+
+	return int(n), int64(totals) - n<<32
+}
+
+func (o *atomicObservations) observe(value int) {
+	ring := o.ring.Load()
+
+	i := ring.count.Add(1) - 1
+	old := ring.slots[i%uint64(o.size)].Swap(int64(value))
+
+	added := 0
+	if i < uint64(o.size) {
+		added = 1
+	}
+
+	ring.totals.Add(packTotals(added, int64(value)-old))
+}
+
+func (o *atomicObservations) stats() (int, int64) {
+	return unpackTotals(o.ring.Load().totals.Load())
+}
+
+func (o *atomicObservations) window() []int {
+	ring := o.ring.Load()
+
+	count := ring.count.Load()
+	n := min(count, uint64(o.size))
+
+	window := make([]int, 0, n)
+	for i := count - n; i < count; i++ {
+		window = append(window, int(ring.slots[i%uint64(o.size)].Load()))
+	}
+
+	return window
+}
+
+func (o *atomicObservations) reset() {
+	o.ring.Store(&windowRing{slots: make([]atomic.Int64, o.size)})
+}
@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// forEachRollingWindowImplementation runs test against every rolling window
+// implementation.
+func forEachRollingWindowImplementation(t *testing.T, test func(t *testing.T, implementation string)) {
+	t.Helper()
+
+	for _, implementation := range []string{RollingWindowAtomic, RollingWindowMutex} {
+		implementation := implementation
+
+		t.Run(implementation, func(t *testing.T) {
+			t.Parallel()
+
+			test(t, implementation)
+		})
+	}
+}
+
+func TestRollingWindow(t *testing.T) {
+	t.Parallel()
+
+	forEachRollingWindowImplementation(t, testRollingWindow)
+}
+
+func testRollingWindow(t *testing.T, implementation string) {
+	r := newRollingWindow(implementation, 4, 0.5)
+
+	assert.Zero(t, r.Len())
+	assert.Zero(t, r.Avg())
+	assert.Equal(t, float64(1), r.SuccessRate())
+	assert.Empty(t, r.Window())
+
+	r.Observe(1)
+	r.Observe(0)
+	r.Observe(1)
+	r.Observe(1)
+
+	assert.Equal(t, 4, r.Len())
+	assert.Equal(t, []int{1, 0, 1, 1}, r.Window())
+	assert.Equal(t, 0.75, r.Avg())
+	assert.Equal(t, 0.75, r.SuccessRate())
+
+	// The oldest observation is evicted.
+	//
+	r.Observe(1)
+	assert.Equal(t, 4, r.Len())
+	assert.Equal(t, []int{0, 1, 1, 1}, r.Window())
+	assert.Equal(t, 0.75, r.Avg())
+
+	r.Observe(0)
+	assert.Equal(t, []int{1, 1, 1, 0}, r.Window())
+	assert.Equal(t, 0.75, r.Avg())
+
+	r.Reset()
+	assert.Zero(t, r.Len())
+	assert.Zero(t, r.Avg())
+	assert.Empty(t, r.Window())
+
+	r.Observe(0)
+	assert.Equal(t, []int{0}, r.Window())
+	assert.Zero(t, r.SuccessRate())
+}
+
+func TestRollingWindowReturnsCopy(t *testing.T) {
+	t.Parallel()
+
+	r := NewRollingWindow(2, 1)
+	r.Observe(1)
+
+	window := r.Window()
+	window[0] = 0
+
+	assert.Equal(t, []int{1}, r.Window())
+	assert.Equal(t, float64(1), r.Avg())
+}
+
+func TestRollingWindowHasEnoughObservations(t *testing.T) {
+	t.Parallel()
+
+	r := NewRollingWindow(10, 0.5)
+
+	for i := 0; i < 4; i++ {
+		r.Observe(1)
+	}
+
+	assert.False(t, r.HasEnoughObservations())
+
+	// Half full is enough with a 0.5 threshold, even though the window isn't
+	// full yet.
+	//
+	r.Observe(1)
+	assert.True(t, r.HasEnoughObservations())
+
+	defaults := NewRollingWindow(0, 0)
+	for i := 0; i < 89; i++ {
+		defaults.Observe(1)
+	}
+
+	assert.False(t, defaults.HasEnoughObservations())
+
+	defaults.Observe(1)
+	assert.True(t, defaults.HasEnoughObservations())
+}
+
+func TestRollingWindowConcurrentAccess(t *testing.T) {
+	t.Parallel()
+
+	forEachRollingWindowImplementation(t, testRollingWindowConcurrentAccess)
+}
+
+func testRollingWindowConcurrentAccess(t *testing.T, implementation string) {
+	r := newRollingWindow(implementation, 50, 0.9)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 500; j++ {
+				r.Observe((i + j) % 2)
+
+				if j%100 == 0 {
+					r.Reset()
+				}
+			}
+		}(i)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 500; j++ {
+				window := r.Window()
+				for k := range window {
+					window[k] = 7
+				}
+
+				r.Avg()
+				r.Len()
+				r.HasEnoughObservations()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, v := range r.Window() {
+		assert.Contains(t, []int{0, 1}, v)
+	}
+}
+
+func TestRollingWindowSumSurvivesConcurrentObservations(t *testing.T) {
+	t.Parallel()
+
+	forEachRollingWindowImplementation(t, testRollingWindowSumSurvivesConcurrentObservations)
+}
+
+func testRollingWindowSumSurvivesConcurrentObservations(t *testing.T, implementation string) {
+	r := newRollingWindow(implementation, 16, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				r.Observe((i + j) % 2)
+
+				if i == 0 && j%250 == 0 {
+					r.Reset()
+				}
+
+				r.Avg()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Once the observations are done, the average matches the window
+	// whatever order they were made in.
+	//
+	window := r.Window()
+
+	sum := 0
+	for _, v := range window {
+		sum += v
+	}
+
+	assert.Len(t, window, r.Len())
+	assert.Equal(t, float64(sum)/float64(len(window)), r.Avg())
+}
+
+func TestRollingWindowTotals(t *testing.T) {
+	t.Parallel()
+
+	// The count and the sum of the observations change together.
+	//
+	n, sum := unpackTotals(packTotals(1, 1) + packTotals(1, 0) + packTotals(0, -1) + packTotals(0, 1))
+	assert.Equal(t, 2, n)
+	assert.Equal(t, int64(1), sum)
+
+	// A slot replaced before the change of its observation is added leaves
+	// the sum negative for a while.
+	//
+	n, sum = unpackTotals(packTotals(1, 0) + packTotals(0, -1))
+	assert.Equal(t, 1, n)
+	assert.Equal(t, int64(-1), sum)
+}
+
+func TestRollingWindowIsNeverBiasedWhileFilling(t *testing.T) {
+	t.Parallel()
+
+	r := NewRollingWindow(1000, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 250; j++ {
+				r.Observe(1)
+			}
+		}()
+	}
+
+	// Only successes are observed, a reader never sees a failure.
+	//
+	for r.Len() < 1000 {
+		if rate := r.SuccessRate(); rate != 1 {
+			assert.Equal(t, float64(1), rate)
+
+			break
+		}
+	}
+	wg.Wait()
+}
+
+// BenchmarkRollingWindowParallel observes outcomes from every goroutine, as
+// the proxy does for every attempt, while some read the average, as the
+// manager does on every tick. Contention only shows with as many cores as
+// goroutines, e.g. with -cpu=4,16 on a machine with 16 cores: -cpu only sets
+// GOMAXPROCS, the goroutines share the cores there are.
+func BenchmarkRollingWindowParallel(b *testing.B) {
+	for _, implementation := range []string{RollingWindowAtomic, RollingWindowMutex} {
+		r := newRollingWindow(implementation, DefaultRollingWindowSize, DefaultRollingWindowMinObservations)
+
+		b.Run(implementation, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					r.Observe(i % 2)
+
+					if i%64 == 0 {
+						r.Avg()
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package proxy
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultScoreLatencyScale is the latency halving the latency part of
+	// the score when no latencyScale is configured.
+	DefaultScoreLatencyScale = 500 * time.Millisecond
+
+	// DefaultScoreBlockLagScale is the block lag halving the block lag part
+	// of the score when no blockLagScale is configured.
+	DefaultScoreBlockLagScale = 5
+
+	// DefaultScoreHysteresis is how much better the score of a target has to
+	// be to replace the preferred one in the "score" mode when no hysteresis
+	// is configured.
+	DefaultScoreHysteresis = 0.05
+
+	// latencyAverageWeight is the weight of the last attempt in the moving
+	// average of the latency of a target.
+	latencyAverageWeight = 0.2
+)
+
+// ScoreConfig weighs what the score of a target is computed from. The score
+// ranks the targets from 0 to 1, the higher the better.
+type ScoreConfig struct {
+	// SuccessRateWeight, LatencyWeight and BlockLagWeight weigh the success
+	// rate of the rolling window, the moving average of the latency and the
+	// block lag. They all default to 1 when none is set.
+	SuccessRateWeight float64 `yaml:"successRateWeight"`
+	LatencyWeight     float64 `yaml:"latencyWeight"`
+	BlockLagWeight    float64 `yaml:"blockLagWeight"`
+
+	// LatencyScale is the latency halving the latency part of the score.
+	// Defaults to 500ms.
+	LatencyScale time.Duration `yaml:"latencyScale"`
+
+	// BlockLagScale is the number of blocks behind halving the block lag
+	// part of the score. Defaults to 5.
+	BlockLagScale uint64 `yaml:"blockLagScale"`
+
+	// Hysteresis is how much better the score of a target has to be to
+	// replace the preferred one in the "score" mode, so close scores don't
+	// make the traffic flap between targets. Defaults to 0.05.
+	Hysteresis *float64 `yaml:"hysteresis"`
+}
+
+func (c ScoreConfig) validate() error {
+	if c.SuccessRateWeight < 0 || c.LatencyWeight < 0 || c.BlockLagWeight < 0 {
+		return errors.New("score weights must not be negative")
+	}
+
+	if c.LatencyScale < 0 {
+		return errors.New("score latency scale must not be negative")
+	}
+
+	if c.Hysteresis != nil && (*c.Hysteresis < 0 || *c.Hysteresis >= 1) {
+		return errors.New("score hysteresis must be between 0 and 1")
+	}
+
+	return nil
+}
+
+func (c ScoreConfig) weights() (float64, float64, float64) {
+	if c.SuccessRateWeight == 0 && c.LatencyWeight == 0 && c.BlockLagWeight == 0 {
+		return 1, 1, 1
+	}
+
+	return c.SuccessRateWeight, c.LatencyWeight, c.BlockLagWeight
+}
+
+func (c ScoreConfig) hysteresis() float64 {
+	if c.Hysteresis == nil {
+		return DefaultScoreHysteresis
+	}
+
+	return *c.Hysteresis
+}
+
+// ScoreInputs are what the score of a target is computed from.
+type ScoreInputs struct {
+	// SuccessRate is the one of the rolling window, from 0 to 1.
+	SuccessRate float64
+	// Latency is the moving average of the latency, zero when unknown.
+	Latency time.Duration
+	// BlockLag is how many blocks behind the highest one the target is.
+	BlockLag uint64
+}
+
+// Score returns the score of a target, from 0 to 1, the higher the better.
+// It's the weighted average of the success rate, of the latency mapped to
+// latencyScale / (latencyScale + latency), and of the block lag mapped the
+// same way. An unknown latency scores as a null one, so targets that weren't
+// tried yet get their chance.
+func (c ScoreConfig) Score(in ScoreInputs) float64 {
+	successRateWeight, latencyWeight, blockLagWeight := c.weights()
+
+	latencyScale := c.LatencyScale
+	if latencyScale == 0 {
+		latencyScale = DefaultScoreLatencyScale
+	}
+
+	blockLagScale := c.BlockLagScale
+	if blockLagScale == 0 {
+		blockLagScale = DefaultScoreBlockLagScale
+	}
+
+	successRate := min(max(in.SuccessRate, 0), 1)
+	latency := latencyScale.Seconds() / (latencyScale.Seconds() + max(in.Latency, 0).Seconds())
+	blockLag := float64(blockLagScale) / float64(blockLagScale+in.BlockLag)
+
+	return (successRateWeight*successRate + latencyWeight*latency + blockLagWeight*blockLag) /
+		(successRateWeight + latencyWeight + blockLagWeight)
+}
+
+// observeLatency adds the latency of a successful attempt to the moving
+// average of the target.
+func (n *NodeProvider) observeLatency(latency time.Duration) {
+	for {
+		old := n.latency.Load()
+
+		average := int64(latency)
+		if old != 0 {
+			average = old + int64(latencyAverageWeight*float64(int64(latency)-old))
+		}
+
+		if n.latency.CompareAndSwap(old, max(average, 1)) {
+			return
+		}
+	}
+}
+
+// Latency returns the moving average of the latency of the successful
+// attempts to the target, zero before the first one.
+func (n *NodeProvider) Latency() time.Duration {
+	return time.Duration(n.latency.Load())
+}
+
+// scoreInputs returns what the score of target is computed from.
+func (p *Proxy) scoreInputs(target *NodeProvider, maxBlockNumber uint64) ScoreInputs {
+	in := ScoreInputs{SuccessRate: 1, Latency: target.Latency()}
+
+	if window, err := p.hcm.GetRollingWindowByName(target.Name()); err == nil {
+		in.SuccessRate = window.SuccessRate()
+	}
+
+	if hc, err := p.hcm.GetTargetByName(target.Name()); err == nil {
+		if blockNumber := hc.BlockNumber(); blockNumber > 0 && maxBlockNumber > blockNumber {
+			in.BlockLag = maxBlockNumber - blockNumber
+		}
+	}
+
+	return in
+}
+
+// Score returns the score of the named target.
+func (p *Proxy) Score(name string) (float64, error) {
+	target, err := p.target(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return p.scoring.Score(p.scoreInputs(target, p.hcm.MaxBlockNumber())), nil
+}
+
+// preferredTarget returns the index of the healthy target with the best
+// score, unless the current one is healthy and isn't beaten by more than
+// hysteresis. It's -1 when no target is healthy.
+func preferredTarget(scores []float64, healthy []bool, current int, hysteresis float64) int {
+	best := -1
+
+	for i, score := range scores {
+		if healthy[i] && (best == -1 || score > scores[best]) {
+			best = i
+		}
+	}
+
+	if current >= 0 && current < len(scores) && healthy[current] &&
+		best != -1 && scores[best] <= scores[current]+hysteresis {
+		return current
+	}
+
+	return best
+}
+
+// scoreCandidates returns the targets by decreasing score, the preferred one
+// first. The preferred target only changes when another healthy one scores
+// better by more than the hysteresis.
+func (p *Proxy) scoreCandidates() []*NodeProvider {
+	maxBlockNumber := p.hcm.MaxBlockNumber()
+
+	scores := make([]float64, len(p.targets))
+	healthy := make([]bool, len(p.targets))
+
+	for i, target := range p.targets {
+		scores[i] = p.scoring.Score(p.scoreInputs(target, maxBlockNumber))
+		healthy[i] = !target.Draining() && p.hcm.IsHealthy(target.Name())
+	}
+
+	p.scoreMu.Lock()
+	p.preferred = preferredTarget(scores, healthy, p.preferred, p.scoring.hysteresis())
+	preferred := p.preferred
+	p.scoreMu.Unlock()
+
+	order := make([]int, len(p.targets))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i] == preferred || order[j] == preferred {
+			return order[i] == preferred
+		}
+
+		return scores[order[i]] > scores[order[j]]
+	})
+
+	candidates := make([]*NodeProvider, len(order))
+	for i, index := range order {
+		candidates[i] = p.targets[index]
+	}
+
+	return candidates
+}
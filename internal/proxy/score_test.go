@@ -0,0 +1,122 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreConfigScore(t *testing.T) {
+	latencyOnly := ScoreConfig{LatencyWeight: 1}
+
+	for _, tc := range []struct {
+		name     string
+		config   ScoreConfig
+		inputs   ScoreInputs
+		expected float64
+	}{
+		{"perfect", ScoreConfig{}, ScoreInputs{SuccessRate: 1}, 1},
+		{"failing", ScoreConfig{}, ScoreInputs{SuccessRate: 0}, 2.0 / 3},
+		{"latency at scale", latencyOnly, ScoreInputs{SuccessRate: 1, Latency: 500 * time.Millisecond}, 0.5},
+		{"latency at custom scale", ScoreConfig{LatencyWeight: 1, LatencyScale: time.Second},
+			ScoreInputs{Latency: 3 * time.Second}, 0.25},
+		{"lag at scale", ScoreConfig{BlockLagWeight: 1}, ScoreInputs{BlockLag: 5}, 0.5},
+		{"weighted", ScoreConfig{SuccessRateWeight: 3, LatencyWeight: 1},
+			ScoreInputs{SuccessRate: 0.5, Latency: 500 * time.Millisecond}, (3*0.5 + 0.5) / 4},
+		{"clamped", ScoreConfig{SuccessRateWeight: 1}, ScoreInputs{SuccessRate: 2}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.InDelta(t, tc.expected, tc.config.Score(tc.inputs), 1e-9)
+		})
+	}
+}
+
+func TestScoreConfigValidate(t *testing.T) {
+	negative, tooLarge := -0.1, 1.0
+
+	assert.NoError(t, ScoreConfig{}.validate())
+	assert.Error(t, ScoreConfig{LatencyWeight: -1}.validate())
+	assert.Error(t, ScoreConfig{Hysteresis: &negative}.validate())
+	assert.Error(t, ScoreConfig{Hysteresis: &tooLarge}.validate())
+}
+
+func TestPreferredTarget(t *testing.T) {
+	healthy := []bool{true, true, true}
+
+	assert.Equal(t, 1, preferredTarget([]float64{0.5, 0.9, 0.8}, healthy, -1, 0.05))
+
+	// Close scores keep the current target, a clearly better one replaces
+	// it.
+	//
+	assert.Equal(t, 2, preferredTarget([]float64{0.5, 0.84, 0.8}, healthy, 2, 0.05))
+	assert.Equal(t, 1, preferredTarget([]float64{0.5, 0.86, 0.8}, healthy, 2, 0.05))
+
+	// An unhealthy current target is replaced whatever its score.
+	//
+	assert.Equal(t, 1, preferredTarget([]float64{0.5, 0.6, 0.9}, []bool{true, true, false}, 2, 0.05))
+	assert.Equal(t, -1, preferredTarget([]float64{0.5}, []bool{false}, 0, 0.05))
+}
+
+func TestNodeProviderLatencyMovingAverage(t *testing.T) {
+	var target NodeProvider
+
+	assert.Zero(t, target.Latency())
+
+	target.observeLatency(100 * time.Millisecond)
+	assert.Equal(t, 100*time.Millisecond, target.Latency())
+
+	target.observeLatency(200 * time.Millisecond)
+	assert.Equal(t, 120*time.Millisecond, target.Latency())
+}
+
+func TestHttpFailoverProxyScoreModeHysteresis(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	config := createConfig()
+	config.Proxy.LoadBalancing = LoadBalancingScore
+	config.Proxy.Score = ScoreConfig{LatencyWeight: 1}
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:1"}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:2"}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	first := func() string {
+		return p.candidates(nil)[0].Name()
+	}
+
+	p.targets[0].latency.Store(int64(100 * time.Millisecond))
+	p.targets[1].latency.Store(int64(150 * time.Millisecond))
+	assert.Equal(t, "Server1", first())
+
+	// Server2 gets slightly faster than Server1, repeatedly, which doesn't
+	// make the traffic switch.
+	//
+	for i := 0; i < 10; i++ {
+		p.targets[1].latency.Store(int64(time.Duration(90+i%2*15) * time.Millisecond))
+		assert.Equal(t, "Server1", first())
+	}
+
+	p.targets[1].latency.Store(int64(20 * time.Millisecond))
+	assert.Equal(t, "Server2", first())
+
+	p.targets[0].latency.Store(int64(19 * time.Millisecond))
+	assert.Equal(t, "Server2", first())
+
+	assert.Equal(t, []string{"Server2", "Server1"}, []string{p.candidates(nil)[0].Name(), p.candidates(nil)[1].Name()})
+
+	count, err := testutil.GatherAndCount(prometheus.DefaultRegisterer.(prometheus.Gatherer), "zeroex_rpc_gateway_provider_score")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TargetSelector decides in which order targets are attempted for a request.
+// It replaces the built-in load balancing modes when set. Unavailable targets
+// are skipped by the proxy, so selectors don't need to filter them.
+type TargetSelector interface {
+	Select(r *http.Request, targets []*NodeProvider) []*NodeProvider
+}
+
+// HealthObserver is notified whenever a target becomes healthy or unhealthy
+// according to its health checks.
+type HealthObserver interface {
+	OnHealthChange(target string, healthy bool)
+}
+
+// HealthObserverFunc adapts a function to the HealthObserver interface.
+type HealthObserverFunc func(target string, healthy bool)
+
+func (f HealthObserverFunc) OnHealthChange(target string, healthy bool) {
+	f(target, healthy)
+}
+
+// registererOrDefault returns the Prometheus registerer metrics are
+// registered with.
+func registererOrDefault(registerer prometheus.Registerer) prometheus.Registerer {
+	if registerer == nil {
+		return prometheus.DefaultRegisterer
+	}
+
+	return registerer
+}
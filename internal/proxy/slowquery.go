@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultSlowQueryMaxParamsLength is how many bytes of the params are logged
+// when no maxParamsLength is configured.
+const DefaultSlowQueryMaxParamsLength = 256
+
+// SlowQueryLogConfig logs the requests whose response is larger or slower
+// than the thresholds, to find who generates the heaviest traffic.
+type SlowQueryLogConfig struct {
+	// SizeThreshold is the response size, in bytes, above which a request is
+	// logged. Zero disables it.
+	SizeThreshold int `yaml:"sizeThreshold"`
+
+	// DurationThreshold is the upstream response time above which a request
+	// is logged. Zero disables it.
+	DurationThreshold time.Duration `yaml:"durationThreshold"`
+
+	// MaxParamsLength truncates the logged params. Defaults to 256.
+	MaxParamsLength int `yaml:"maxParamsLength"`
+}
+
+func (c SlowQueryLogConfig) enabled() bool {
+	return c.SizeThreshold > 0 || c.DurationThreshold > 0
+}
+
+func (c SlowQueryLogConfig) maxParamsLength() int {
+	if c.MaxParamsLength <= 0 {
+		return DefaultSlowQueryMaxParamsLength
+	}
+
+	return c.MaxParamsLength
+}
+
+// observeResponse records the size of a response served by provider and logs
+// it when it crosses one of the slow query thresholds.
+func (p *Proxy) observeResponse(provider string, requests []JSONRPCRequest, size int, duration time.Duration) {
+	p.metricResponseSize.WithLabelValues(provider, p.methodLabel(requests)).Observe(float64(size))
+
+	if !p.slowQueryLog.enabled() {
+		return
+	}
+
+	large := p.slowQueryLog.SizeThreshold > 0 && size > p.slowQueryLog.SizeThreshold
+	slow := p.slowQueryLog.DurationThreshold > 0 && duration > p.slowQueryLog.DurationThreshold
+
+	if !large && !slow {
+		return
+	}
+
+	attrs := []any{
+		"method", requestMethod(requests),
+		"provider", provider,
+		"size", size,
+		"duration", duration,
+		"large", large,
+		"slow", slow,
+	}
+
+	if len(requests) == 1 {
+		attrs = append(attrs, "params", truncate(string(requests[0].Params), p.slowQueryLog.maxParamsLength()))
+	} else if len(requests) > 1 {
+		methods := make([]string, 0, len(requests))
+		for _, request := range requests {
+			methods = append(methods, request.Method)
+		}
+
+		attrs = append(attrs, "methods", truncate(strings.Join(methods, ","), p.slowQueryLog.maxParamsLength()))
+	}
+
+	p.logger.Warn("slow query", attrs...)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+
+	return s[:n] + "..."
+}
@@ -0,0 +1,133 @@
+package proxy
+
+import (
+	"time"
+)
+
+// ProviderStatus is the state of a target as seen by the health checks when
+// the snapshot was taken.
+type ProviderStatus struct {
+	Name         string `json:"name"`
+	Healthy      bool   `json:"healthy"`
+	WriteHealthy bool   `json:"writeHealthy"`
+
+	// Tainted is set while the target has taints, Reasons lists their
+	// distinct reasons and Taints the taints themselves.
+	Tainted bool     `json:"tainted"`
+	Reasons []string `json:"reasons"`
+	Taints  []Taint  `json:"taints"`
+
+	// BlockNumber is the last block number observed, zero if none was,
+	// BlockNumberAge how long ago it was and Lag how far behind the highest
+	// fresh one of all targets it is.
+	BlockNumber    uint64        `json:"blockNumber"`
+	BlockNumberAge time.Duration `json:"blockNumberAge"`
+	Lag            uint64        `json:"lag"`
+	GasLimit       uint64        `json:"gasLimit"`
+
+	// SuccessRate is the success rate of the rolling window, over its
+	// Observations.
+	SuccessRate  float64 `json:"successRate"`
+	Observations int     `json:"observations"`
+
+	// LastError is the error of the last health check, empty when it
+	// passed, and LastCheck when it ended, the zero time if none did.
+	LastError string    `json:"lastError,omitempty"`
+	LastCheck time.Time `json:"lastCheck"`
+}
+
+// Snapshot returns the status of every target, in the order of the
+// configuration. It only copies the state, so it's cheap enough to be
+// called on every request of a status page.
+func (h *HealthCheckManager) Snapshot() []ProviderStatus {
+	maxBlockNumber := h.MaxBlockNumber()
+
+	statuses := make([]ProviderStatus, 0, len(h.hcs))
+
+	for _, hc := range h.hcs {
+		status := ProviderStatus{
+			Name:         hc.Name(),
+			Healthy:      hc.IsHealthy(),
+			WriteHealthy: hc.IsWriteHealthy(),
+			BlockNumber:  hc.BlockNumber(),
+			GasLimit:     hc.GasLimit(),
+			Reasons:      []string{},
+			Taints:       []Taint{},
+		}
+
+		if observedAt := hc.BlockNumberObservedAt(); !observedAt.IsZero() {
+			status.BlockNumberAge = h.clock.Now().Sub(observedAt)
+		}
+
+		if maxBlockNumber > status.BlockNumber && status.BlockNumber > 0 {
+			status.Lag = maxBlockNumber - status.BlockNumber
+		}
+
+		lastCheck, lastError := hc.LastCheck()
+		status.LastCheck = lastCheck
+
+		if lastError != nil {
+			status.LastError = lastError.Error()
+		}
+
+		if taints, err := h.Taints(status.Name); err == nil {
+			status.Taints = taints
+			status.Tainted = len(taints) > 0
+
+			seen := map[string]bool{}
+
+			for _, taint := range taints {
+				if !seen[taint.Reason] {
+					seen[taint.Reason] = true
+					status.Reasons = append(status.Reasons, taint.Reason)
+				}
+			}
+		}
+
+		if window, err := h.GetRollingWindowByName(status.Name); err == nil {
+			status.SuccessRate = window.SuccessRate()
+			status.Observations = window.Len()
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// ProviderStats are the attempts the proxy made to a target since it
+// started.
+type ProviderStats struct {
+	Name  string `json:"name"`
+	State string `json:"state"`
+
+	// Attempts counts the requests sent to the target, and Errors the ones
+	// that failed, whether they were rerouted or not.
+	Attempts uint64 `json:"attempts"`
+	Errors   uint64 `json:"errors"`
+
+	// Latency is the moving average of the latency of the successful
+	// attempts, and Score the score of the target, from 0 to 1.
+	Latency time.Duration `json:"latency"`
+	Score   float64       `json:"score"`
+}
+
+// Stats returns the attempt counts of every target, in the order of the
+// configuration.
+func (p *Proxy) Stats() []ProviderStats {
+	stats := make([]ProviderStats, 0, len(p.targets))
+	maxBlockNumber := p.hcm.MaxBlockNumber()
+
+	for _, target := range p.targets {
+		stats = append(stats, ProviderStats{
+			Name:     target.Name(),
+			State:    target.State(),
+			Attempts: target.attempts.Load(),
+			Errors:   target.failures.Load(),
+			Latency:  target.Latency(),
+			Score:    p.scoring.Score(p.scoreInputs(target, maxBlockNumber)),
+		})
+	}
+
+	return stats
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthCheckManagerSnapshot(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	node := newFakeNode(t)
+	defer node.Close()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name:       "Server1",
+				Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+			},
+			{
+				Name:       "Server2",
+				Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: failing.URL}},
+			},
+		},
+		Config: HealthCheckConfig{Timeout: time.Second},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	// Nothing happened yet.
+	//
+	snapshot := hcm.Snapshot()
+	require.Len(t, snapshot, 2)
+	assert.Equal(t, "Server1", snapshot[0].Name)
+	assert.Equal(t, "Server2", snapshot[1].Name)
+	assert.True(t, snapshot[1].LastCheck.IsZero())
+	assert.Empty(t, snapshot[1].LastError)
+	assert.Empty(t, snapshot[1].Reasons)
+
+	for _, hc := range hcm.hcs {
+		hc.CheckAndSetHealth(context.Background())
+	}
+
+	require.NoError(t, hcm.Taint("Server2", TaintReasonManual, 0))
+	hcm.ObserveSuccess("Server1", "")
+	hcm.ObserveFailure("Server2", "")
+
+	snapshot = hcm.Snapshot()
+
+	assert.True(t, snapshot[0].Healthy)
+	assert.False(t, snapshot[0].Tainted)
+	assert.Equal(t, uint64(0x10), snapshot[0].BlockNumber)
+	assert.Empty(t, snapshot[0].LastError)
+	assert.False(t, snapshot[0].LastCheck.IsZero())
+	assert.Equal(t, 1, snapshot[0].Observations)
+	assert.Equal(t, 1.0, snapshot[0].SuccessRate)
+
+	assert.False(t, snapshot[1].Healthy)
+	assert.True(t, snapshot[1].Tainted)
+	assert.Equal(t, []string{TaintReasonManual}, snapshot[1].Reasons)
+	assert.Zero(t, snapshot[1].BlockNumber)
+	assert.Zero(t, snapshot[1].BlockNumberAge)
+	assert.NotEmpty(t, snapshot[1].LastError)
+	assert.False(t, snapshot[1].LastCheck.IsZero())
+	assert.Equal(t, 1, snapshot[1].Observations)
+	assert.Zero(t, snapshot[1].SuccessRate)
+
+	// Snapshots are copies, they don't follow the later events.
+	//
+	require.NoError(t, hcm.Untaint("Server2", TaintReasonManual))
+
+	assert.True(t, snapshot[1].Tainted)
+	assert.False(t, hcm.Snapshot()[1].Tainted)
+}
+
+func TestHttpFailoverProxyStats(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	defer working.Close()
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: failing.URL}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: working.URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	for i := 0; i < 2; i++ {
+		rr := httptest.NewRecorder()
+		p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)))
+		require.Equal(t, http.StatusOK, rr.Code)
+	}
+
+	stats := p.Stats()
+	require.Len(t, stats, 2)
+
+	// Only the successful attempts have a latency.
+	//
+	assert.Zero(t, stats[0].Latency)
+	assert.NotZero(t, stats[1].Latency)
+	assert.Less(t, stats[0].Score, stats[1].Score)
+
+	for i := range stats {
+		stats[i].Latency, stats[i].Score = 0, 0
+	}
+
+	assert.Equal(t, []ProviderStats{
+		{Name: "Server1", State: p.targets[0].State(), Attempts: 2, Errors: 2},
+		{Name: "Server2", State: p.targets[1].State(), Attempts: 2, Errors: 0},
+	}, stats)
+}
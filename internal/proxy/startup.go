@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoTargetResolved is returned by Start when the hostname of no target
+// resolves.
+var ErrNoTargetResolved = errors.New("no target hostname resolves")
+
+// startupHost returns the hostname of the target served at rawURL and the
+// resolver of the target, no hostname for IP addresses.
+func startupHost(target NodeProviderConfig, rawURL string) (string, ipResolver) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" || net.ParseIP(u.Hostname()) != nil {
+		return "", nil
+	}
+
+	return u.Hostname(), newTargetResolver(target.DNS, &net.Dialer{})
+}
+
+// resolveTargets resolves the hostnames of the targets before the first
+// health checks, so a target that can't be reached is never served traffic.
+// The targets that don't resolve are marked unhealthy, their health checks
+// retry them. It fails when none resolves, or when any doesn't with
+// strictStartup.
+func (h *HealthCheckManager) resolveTargets(c context.Context) error {
+	if h.config.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		c, cancel = context.WithTimeout(c, h.config.Timeout)
+		defer cancel()
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed = map[string]error{}
+	)
+
+	for _, hc := range h.hcs {
+		e := h.entries[hc.Name()]
+		if e.host == "" {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(hc *HealthChecker, e *healthCheckEntry) {
+			defer wg.Done()
+
+			if _, err := e.resolver.LookupIPAddr(c, e.host); err != nil {
+				mu.Lock()
+				failed[hc.Name()] = errors.Wrapf(err, "cannot resolve %q", e.host)
+				mu.Unlock()
+			}
+		}(hc, e)
+	}
+
+	wg.Wait()
+
+	for _, hc := range h.hcs {
+		err, ok := failed[hc.Name()]
+		if !ok {
+			continue
+		}
+
+		if h.config.StrictStartup {
+			return errors.Wrapf(err, "target %q", hc.Name())
+		}
+
+		hc.markUnhealthy(err)
+	}
+
+	if len(h.hcs) > 0 && len(failed) == len(h.hcs) {
+		return ErrNoTargetResolved
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStartupTestHealthCheckManager returns a manager of a target whose
+// hostname doesn't resolve, "bogus", and of the given live targets.
+func newStartupTestHealthCheckManager(t *testing.T, config HealthCheckConfig, live ...string) *HealthCheckManager {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	targets := []NodeProviderConfig{
+		{
+			Name:       "bogus",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://rpc.bogus.invalid"}},
+		},
+	}
+
+	for i, url := range live {
+		targets = append(targets, NodeProviderConfig{
+			Name:       "live" + string(rune('1'+i)),
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: url}},
+		})
+	}
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: targets,
+		Config:  config,
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	hcm.entries["bogus"].resolver = &fakeResolver{addrs: map[string][]net.IPAddr{}}
+
+	return hcm
+}
+
+func TestHealthCheckManagerStartsWithUnresolvableTarget(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	hcm := newStartupTestHealthCheckManager(t, HealthCheckConfig{Interval: time.Hour, Timeout: time.Second}, node.URL)
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "bogus",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://rpc.bogus.invalid"}},
+		},
+		{
+			Name:       "live1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		},
+	}
+	config.HealthcheckManager = hcm
+
+	p, err := NewProxy(config)
+	require.NoError(t, err)
+
+	c, cancel := context.WithCancel(context.Background())
+
+	started := make(chan error)
+
+	go func() {
+		started <- hcm.Start(c)
+	}()
+
+	defer func() {
+		cancel()
+		assert.NoError(t, <-started)
+	}()
+
+	require.NoError(t, hcm.AwaitFirstChecks(c))
+
+	assert.False(t, hcm.IsHealthy("bogus"))
+	assert.True(t, hcm.IsHealthy("live1"))
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	rr := httptest.NewRecorder()
+
+	p.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x10"}`, rr.Body.String())
+}
+
+func TestHealthCheckManagerStrictStartup(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	hcm := newStartupTestHealthCheckManager(t,
+		HealthCheckConfig{Interval: time.Hour, Timeout: time.Second, StrictStartup: true}, node.URL)
+
+	err := hcm.Start(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `target "bogus"`)
+	assert.Contains(t, err.Error(), "rpc.bogus.invalid")
+}
+
+func TestHealthCheckManagerNoTargetResolved(t *testing.T) {
+	hcm := newStartupTestHealthCheckManager(t, HealthCheckConfig{Interval: time.Hour, Timeout: time.Second})
+
+	assert.ErrorIs(t, hcm.Start(context.Background()), ErrNoTargetResolved)
+}
@@ -0,0 +1,205 @@
+package proxy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultStateMaxAge is how old a state file can be to be restored when
+	// no stateMaxAge is configured.
+	DefaultStateMaxAge = 5 * time.Minute
+
+	stateSnapshotInterval = 10 * time.Second
+)
+
+// healthState is what's persisted across restarts.
+type healthState struct {
+	SavedAt time.Time               `json:"savedAt"`
+	Targets map[string]*targetState `json:"targets"`
+}
+
+type targetState struct {
+	Healthy    bool                   `json:"healthy"`
+	Recovering bool                   `json:"recovering,omitempty"`
+	Window     []int                  `json:"window"`
+	Classes    map[string]*classState `json:"classes,omitempty"`
+
+	// Taints maps the reasons tainting the whole target to their expiry,
+	// the zero time when they only end once cleared.
+	Taints map[string]time.Time `json:"taints,omitempty"`
+}
+
+type classState struct {
+	TaintedUntil time.Time `json:"taintedUntil,omitempty"`
+	Window       []int     `json:"window"`
+}
+
+func (h *HealthCheckManager) snapshot() *healthState {
+	state := &healthState{
+		SavedAt: h.clock.Now(),
+		Targets: make(map[string]*targetState, len(h.hcs)),
+	}
+
+	for _, hc := range h.hcs {
+		e, err := h.entry(hc.Name())
+		if err != nil {
+			continue
+		}
+
+		target := &targetState{
+			Healthy: hc.IsHealthy(),
+			Window:  e.window.Window(),
+			Classes: map[string]*classState{},
+		}
+
+		e.mu.Lock()
+		target.Recovering = e.recovering
+
+		if len(e.taints) > 0 {
+			target.Taints = make(map[string]time.Time, len(e.taints))
+
+			for reason, until := range e.taints {
+				target.Taints[reason] = until
+			}
+		}
+
+		for class, s := range e.classes {
+			target.Classes[class] = &classState{
+				TaintedUntil: s.taintedUntil,
+				Window:       s.window.Window(),
+			}
+		}
+		e.mu.Unlock()
+
+		state.Targets[hc.Name()] = target
+	}
+
+	return state
+}
+
+// restore applies a snapshot. Targets that are no longer configured are
+// skipped.
+func (h *HealthCheckManager) restore(state *healthState) {
+	for name, target := range state.Targets {
+		e, err := h.entry(name)
+		if err != nil {
+			continue
+		}
+
+		e.checker.mu.Lock()
+		e.checker.isHealthy = target.Healthy
+		e.checker.mu.Unlock()
+
+		restoreWindow(e.window, target.Window)
+
+		e.mu.Lock()
+		e.recovering = target.Recovering && h.config.Canary.enabled()
+
+		// Taints keep their expiry, the ones expired meanwhile and the
+		// reasons unknown to this version are dropped.
+		//
+		for reason, until := range target.Taints {
+			if validateTaintReason(reason) != nil || (!until.IsZero() && !h.clock.Now().Before(until)) {
+				continue
+			}
+
+			e.taints[reason] = until
+		}
+
+		for class, s := range target.Classes {
+			cs := h.classState(e, class)
+			cs.taintedUntil = s.TaintedUntil
+
+			restoreWindow(cs.window, s.Window)
+		}
+		e.mu.Unlock()
+	}
+}
+
+func restoreWindow(window *RollingWindow, observations []int) {
+	window.Reset()
+
+	for _, observation := range observations {
+		window.Observe(observation)
+	}
+}
+
+// SaveState writes the health and taint state of every target to the
+// configured statePath. It's a no-op when no statePath is configured.
+func (h *HealthCheckManager) SaveState() error {
+	if h.config.StatePath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(h.snapshot())
+	if err != nil {
+		return errors.Wrap(err, "cannot encode state")
+	}
+
+	// The file is replaced atomically, so a crash can't leave a truncated
+	// state behind.
+	//
+	tmp, err := os.CreateTemp(filepath.Dir(h.config.StatePath), filepath.Base(h.config.StatePath)+".*")
+	if err != nil {
+		return errors.Wrap(err, "cannot create state file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return errors.Wrap(err, "cannot write state file")
+	}
+
+	if err := tmp.Close(); err != nil {
+		return errors.Wrap(err, "cannot write state file")
+	}
+
+	return errors.Wrap(os.Rename(tmp.Name(), h.config.StatePath), "cannot replace state file")
+}
+
+// loadState restores the state saved at the configured statePath. Missing,
+// corrupt and stale files are ignored.
+func (h *HealthCheckManager) loadState() {
+	data, err := os.ReadFile(h.config.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	if err != nil {
+		h.logger.Warn("cannot read state file", "path", h.config.StatePath, "error", err)
+
+		return
+	}
+
+	var state healthState
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		h.logger.Warn("ignoring corrupt state file", "path", h.config.StatePath, "error", err)
+
+		return
+	}
+
+	if age := h.clock.Now().Sub(state.SavedAt); age > h.stateMaxAge() {
+		h.logger.Warn("ignoring stale state file", "path", h.config.StatePath, "age", age)
+
+		return
+	}
+
+	h.restore(&state)
+
+	h.logger.Info("restored state", "path", h.config.StatePath, "savedAt", state.SavedAt)
+}
+
+func (h *HealthCheckManager) stateMaxAge() time.Duration {
+	if h.config.StateMaxAge <= 0 {
+		return DefaultStateMaxAge
+	}
+
+	return h.config.StateMaxAge
+}
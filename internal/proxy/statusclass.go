@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Classes of the status_code label of the attempts. Upstream status codes are
+// bucketed, so an unusual code can't add series, and the attempts without a
+// response get their own class instead of the status the gateway answered
+// with.
+const (
+	statusClass2xx       = "2xx"
+	statusClass4xx       = "4xx"
+	statusClass429       = "429"
+	statusClass5xx       = "5xx"
+	statusClassOther     = "other"
+	statusClassTimeout   = "timeout"
+	statusClassConnError = "conn_error"
+	statusClassCanceled  = attemptCanceled
+)
+
+// statusClass returns the class of an attempt of r served into pw, err being
+// its transport error, if any. Every attempt has exactly one.
+func statusClass(r *http.Request, pw *ReponseWriter, err error) string {
+	switch {
+	case r.Context().Err() != nil:
+		return statusClassCanceled
+	case errors.Is(err, context.DeadlineExceeded) || pw.statusCode == http.StatusGatewayTimeout:
+		return statusClassTimeout
+	case err != nil:
+		return statusClassConnError
+	case pw.statusCode == http.StatusTooManyRequests:
+		return statusClass429
+	case pw.statusCode >= 200 && pw.statusCode < 300:
+		return statusClass2xx
+	case pw.statusCode >= 400 && pw.statusCode < 500:
+		return statusClass4xx
+	case pw.statusCode >= 500 && pw.statusCode < 600:
+		return statusClass5xx
+	default:
+		return statusClassOther
+	}
+}
@@ -0,0 +1,175 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusClass(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, tc := range []struct {
+		request    *http.Request
+		statusCode int
+		err        error
+		expected   string
+	}{
+		{request: r, statusCode: http.StatusOK, expected: statusClass2xx},
+		{request: r, statusCode: http.StatusNoContent, expected: statusClass2xx},
+		{request: r, statusCode: http.StatusBadRequest, expected: statusClass4xx},
+		{request: r, statusCode: http.StatusTooManyRequests, expected: statusClass429},
+		{request: r, statusCode: http.StatusInternalServerError, expected: statusClass5xx},
+		{request: r, statusCode: 599, expected: statusClass5xx},
+		{request: r, statusCode: http.StatusGatewayTimeout, expected: statusClassTimeout},
+		{request: r, statusCode: http.StatusFound, expected: statusClassOther},
+		{request: r, statusCode: 999, expected: statusClassOther},
+		{request: r, statusCode: http.StatusBadGateway, err: context.DeadlineExceeded, expected: statusClassTimeout},
+		{request: r, statusCode: http.StatusBadGateway, err: assert.AnError, expected: statusClassConnError},
+		{
+			request:    r.WithContext(canceled),
+			statusCode: http.StatusBadGateway,
+			err:        context.Canceled,
+			expected:   statusClassCanceled,
+		},
+	} {
+		pw := newResponseWriterWithBuffer(&bytes.Buffer{})
+		pw.statusCode = tc.statusCode
+
+		assert.Equal(t, tc.expected, statusClass(tc.request, pw, tc.err), "status %d, error %v", tc.statusCode, tc.err)
+	}
+}
+
+// observedStatusClasses returns the number of attempts observed by status
+// class.
+func observedStatusClasses(t *testing.T, p *Proxy) map[string]uint64 {
+	t.Helper()
+
+	metrics := make(chan prometheus.Metric, 100)
+	p.metricRequestDuration.Collect(metrics)
+	close(metrics)
+
+	classes := map[string]uint64{}
+
+	for metric := range metrics {
+		var m dto.Metric
+		require.NoError(t, metric.Write(&m))
+
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "status_code" {
+				classes[label.GetValue()] += m.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+
+	return classes
+}
+
+func TestHttpFailoverProxyStatusClassesReconcile(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}
+
+	status := func(code int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		}
+	}
+
+	hang := func(w http.ResponseWriter, r *http.Request) {
+		<-time.After(300 * time.Millisecond)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		targets  []http.HandlerFunc // nil is an unreachable target
+		cancel   bool
+		expected map[string]uint64
+	}{
+		{
+			name:     "rerouted server errors",
+			targets:  []http.HandlerFunc{status(http.StatusInternalServerError), status(599), ok},
+			expected: map[string]uint64{statusClass5xx: 2, statusClass2xx: 1},
+		},
+		{
+			name:     "rate limited then unreachable",
+			targets:  []http.HandlerFunc{status(http.StatusTooManyRequests), nil},
+			expected: map[string]uint64{statusClass429: 1, statusClassConnError: 1},
+		},
+		{
+			name:     "timeout",
+			targets:  []http.HandlerFunc{hang, ok},
+			expected: map[string]uint64{statusClassTimeout: 1, statusClass2xx: 1},
+		},
+		{
+			name:     "passed through",
+			targets:  []http.HandlerFunc{status(http.StatusFound)},
+			expected: map[string]uint64{statusClassOther: 1},
+		},
+		{
+			name:     "client canceled",
+			targets:  []http.HandlerFunc{hang},
+			cancel:   true,
+			expected: map[string]uint64{statusClassCanceled: 1},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+			config := createConfig()
+			config.Proxy.UpstreamTimeout = 100 * time.Millisecond
+
+			for i, handler := range tc.targets {
+				server := httptest.NewServer(handler)
+				if handler == nil {
+					server.Close()
+				} else {
+					t.Cleanup(server.Close)
+				}
+
+				config.Targets = append(config.Targets, NodeProviderConfig{
+					Name:       "Server" + string(rune('1'+i)),
+					Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: server.URL}},
+				})
+			}
+
+			p := newTestFailoverProxy(t, config)
+
+			c, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tc.cancel {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/",
+				bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`)).WithContext(c)
+
+			p.ServeHTTP(httptest.NewRecorder(), req)
+
+			var attempts dto.Metric
+			require.NoError(t, p.metricAttemptsPerRequest.Write(&attempts))
+
+			classes := observedStatusClasses(t, p)
+			assert.Equal(t, tc.expected, classes)
+
+			total := uint64(0)
+			for _, count := range classes {
+				total += count
+			}
+
+			assert.Equal(t, attempts.GetHistogram().GetSampleSum(), float64(total))
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Policies applied to the upstream responses of a given status code.
+const (
+	// StatusPolicyPassthrough returns the response to the client as it is.
+	StatusPolicyPassthrough = "passthrough"
+	// StatusPolicyFailover counts the response as a failure of the target
+	// and tries the next one.
+	StatusPolicyFailover = "failover"
+	// StatusPolicyNormalize returns the response to the client as a
+	// JSON-RPC error with HTTP 200, the way most providers do.
+	StatusPolicyNormalize = "normalize"
+)
+
+// JSONRPCErrorServer is the code of the errors made up for responses that
+// aren't JSON-RPC.
+const JSONRPCErrorServer = -32000
+
+// StatusPolicyConfig maps the 4xx status codes of upstream responses to a
+// policy. Codes missing from it keep the default behavior: 429 fails over,
+// the others pass through.
+type StatusPolicyConfig map[int]string
+
+func (c StatusPolicyConfig) validate() error {
+	for status, policy := range c {
+		if status < http.StatusBadRequest || status >= http.StatusInternalServerError {
+			return errors.Errorf("status policy of %d: only 4xx status codes are supported", status)
+		}
+
+		switch policy {
+		case StatusPolicyPassthrough, StatusPolicyFailover, StatusPolicyNormalize:
+		default:
+			return errors.Errorf("invalid status policy %q of %d", policy, status)
+		}
+	}
+
+	return nil
+}
+
+// normalizeStatus rewrites pw to a JSON-RPC error with HTTP 200 when its
+// status code has the normalize policy. The JSON-RPC errors of the response
+// are kept, responses that aren't JSON-RPC get a made up error with the ids
+// of the requests. It reports whether pw has been rewritten.
+func (p *Proxy) normalizeStatus(target *NodeProvider, pw *ReponseWriter, requests []JSONRPCRequest) bool {
+	if p.statusPolicy[pw.statusCode] != StatusPolicyNormalize {
+		return false
+	}
+
+	body := bytes.TrimSpace(pw.body.Bytes())
+
+	var canonical any
+
+	var (
+		response jsonRPCResponseEnvelope
+		batch    []jsonRPCResponseEnvelope
+	)
+
+	switch {
+	case json.Unmarshal(body, &response) == nil && response.Error != nil:
+		canonical = response
+	case json.Unmarshal(body, &batch) == nil && len(batch) > 0:
+		canonical = batch
+	default:
+		rule := ErrorNormalizationRule{
+			To: CanonicalError{
+				Code:    JSONRPCErrorServer,
+				Message: fmt.Sprintf("provider responded with HTTP %d", pw.statusCode),
+			},
+		}
+
+		switch {
+		case len(requests) == 1:
+			canonical = canonicalResponse(rule, requests[0].ID)
+		case len(requests) > 1:
+			responses := make([]jsonRPCResponseEnvelope, 0, len(requests))
+			for _, request := range requests {
+				responses = append(responses, canonicalResponse(rule, request.ID))
+			}
+
+			canonical = responses
+		default:
+			canonical = canonicalResponse(rule, nil)
+		}
+	}
+
+	p.metricErrorsNormalized.WithLabelValues(target.Name(), "status_"+strconv.Itoa(pw.statusCode)).Inc()
+
+	rewriteResponse(pw, http.StatusOK, canonical)
+
+	return true
+}
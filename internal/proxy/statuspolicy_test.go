@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHttpFailoverProxyStatusPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy StatusPolicyConfig
+		status int
+		body   string
+
+		wantStatus int
+		wantBody   string
+		wantCalls  int64
+	}{
+		{
+			name:       "default passes 4xx through",
+			status:     http.StatusBadRequest,
+			body:       `block not found`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   `block not found`,
+		},
+		{
+			name:       "passthrough",
+			policy:     StatusPolicyConfig{http.StatusTooManyRequests: StatusPolicyPassthrough},
+			status:     http.StatusTooManyRequests,
+			body:       `slow down`,
+			wantStatus: http.StatusTooManyRequests,
+			wantBody:   `slow down`,
+		},
+		{
+			name:       "failover",
+			policy:     StatusPolicyConfig{http.StatusForbidden: StatusPolicyFailover},
+			status:     http.StatusForbidden,
+			body:       `forbidden`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","id":1,"result":"0x1"}`,
+			wantCalls:  1,
+		},
+		{
+			name:       "normalize plain body",
+			policy:     StatusPolicyConfig{http.StatusBadRequest: StatusPolicyNormalize},
+			status:     http.StatusBadRequest,
+			body:       `block not found`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"provider responded with HTTP 400"}}`,
+		},
+		{
+			name:       "normalize JSON-RPC error",
+			policy:     StatusPolicyConfig{http.StatusBadRequest: StatusPolicyNormalize},
+			status:     http.StatusBadRequest,
+			body:       `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"block not found"}}`,
+			wantStatus: http.StatusOK,
+			wantBody:   `{"jsonrpc":"2.0","id":1,"error":{"code":-32602,"message":"block not found"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+			first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer first.Close()
+
+			var calls atomic.Int64
+
+			second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+			}))
+			defer second.Close()
+
+			rpcGatewayConfig := createConfig()
+			rpcGatewayConfig.Proxy.StatusPolicy = tt.policy
+			rpcGatewayConfig.Targets = []NodeProviderConfig{
+				{
+					Name: "Server1",
+					Connection: NodeProviderConnectionConfig{
+						HTTP: NodeProviderConnectionHTTPConfig{URL: first.URL},
+					},
+				},
+				{
+					Name: "Server2",
+					Connection: NodeProviderConnectionConfig{
+						HTTP: NodeProviderConnectionHTTPConfig{URL: second.URL},
+					},
+				},
+			}
+
+			httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+			req := httptest.NewRequest(http.MethodPost, "/",
+				bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByNumber"}`))
+			rr := httptest.NewRecorder()
+
+			httpFailoverProxy.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantCalls, calls.Load())
+
+			if tt.wantStatus == http.StatusOK {
+				assert.JSONEq(t, tt.wantBody, rr.Body.String())
+			} else {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewProxyRejectsInvalidStatusPolicy(t *testing.T) {
+	for _, policy := range []StatusPolicyConfig{
+		{http.StatusBadRequest: "retry"},
+		{http.StatusBadGateway: StatusPolicyPassthrough},
+	} {
+		rpcGatewayConfig := createConfig()
+		rpcGatewayConfig.HealthcheckManager = newTestHealthCheckManager(t)
+		rpcGatewayConfig.Proxy.StatusPolicy = policy
+
+		_, err := NewProxy(rpcGatewayConfig)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,266 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultStreamMaxInFlight is the number of requests of a stream served
+	// at once when no maxInFlight is configured.
+	DefaultStreamMaxInFlight = 16
+
+	// DefaultStreamIdleTimeout is how long a stream may go without a line
+	// read or written when no idleTimeout is configured.
+	DefaultStreamIdleTimeout = time.Minute
+
+	// StreamContentType is the content type of the responses of a stream,
+	// one JSON value per line.
+	StreamContentType = "application/jsonl"
+)
+
+// StreamConfig enables the experimental /stream endpoint, which takes
+// newline-delimited JSON-RPC requests and streams back their responses,
+// one per line, as they complete. Responses are matched to requests by id,
+// not by order.
+type StreamConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// MaxInFlight bounds the requests of a stream served at once. The
+	// stream isn't read any further while it's reached. Defaults to 16.
+	MaxInFlight uint `yaml:"maxInFlight"`
+
+	// IdleTimeout closes a stream whose client neither sends the next line
+	// nor reads the next response for that long. Defaults to 1m.
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+
+	// MaxDuration closes a stream that long after it started, and cancels
+	// its requests in flight. Zero lets it last as long as it isn't idle.
+	MaxDuration time.Duration `yaml:"maxDuration"`
+}
+
+func (c StreamConfig) maxInFlight() int {
+	if c.MaxInFlight == 0 {
+		return DefaultStreamMaxInFlight
+	}
+
+	return int(c.MaxInFlight)
+}
+
+func (c StreamConfig) idleTimeout() time.Duration {
+	if c.IdleTimeout <= 0 {
+		return DefaultStreamIdleTimeout
+	}
+
+	return c.IdleTimeout
+}
+
+func (c StreamConfig) validate() error {
+	if c.IdleTimeout < 0 {
+		return errors.New("stream idleTimeout cannot be negative")
+	}
+
+	if c.MaxDuration < 0 {
+		return errors.New("stream maxDuration cannot be negative")
+	}
+
+	return nil
+}
+
+// streamWriter writes the responses of a stream, one line at a time, as
+// they're written concurrently.
+type streamWriter struct {
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	cancel   context.CancelFunc
+	deadline func() time.Time
+
+	mu  sync.Mutex
+	err error
+}
+
+// writeLine writes line followed by a newline and flushes it, before the
+// deadline. The first error cancels the stream, as the client won't get the
+// next responses.
+func (s *streamWriter) writeLine(line []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return
+	}
+
+	s.rc.SetWriteDeadline(s.deadline()) // nolint:errcheck
+
+	if _, err := s.w.Write(append(line, '\n')); err != nil {
+		s.err = err
+		s.cancel()
+
+		return
+	}
+
+	s.rc.Flush() // nolint:errcheck
+}
+
+// ServeStream serves the requests of a newline-delimited stream of JSON-RPC
+// requests, each going through ServeHTTP like a request of its own, so it's
+// routed and failed over as usual. At most maxInFlight requests are served
+// at once. Closing the connection, staying idle for too long or reaching the
+// max duration cancels the requests in flight.
+func (p *Proxy) ServeStream(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+
+	// A stream lasts as long as the client keeps sending requests, so the
+	// timeouts of the server are replaced by an idle timeout, refreshed by
+	// every line. Responses are written while the body is still being read.
+	//
+	start := time.Now()
+	deadline := func() time.Time {
+		next := time.Now().Add(p.stream.idleTimeout())
+
+		if p.stream.MaxDuration > 0 && next.After(start.Add(p.stream.MaxDuration)) {
+			return start.Add(p.stream.MaxDuration)
+		}
+
+		return next
+	}
+
+	rc.SetReadDeadline(deadline())  // nolint:errcheck
+	rc.SetWriteDeadline(deadline()) // nolint:errcheck
+	rc.EnableFullDuplex()           // nolint:errcheck
+
+	c, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	if p.stream.MaxDuration > 0 {
+		c, cancel = context.WithDeadline(c, start.Add(p.stream.MaxDuration))
+		defer cancel()
+	}
+
+	w.Header().Set(headers.ContentType, StreamContentType)
+	w.WriteHeader(http.StatusOK)
+	rc.Flush() // nolint:errcheck
+
+	out := &streamWriter{w: w, rc: rc, cancel: cancel, deadline: deadline}
+
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), int(p.maxBodySize)+1)
+
+	slots := make(chan struct{}, p.stream.maxInFlight())
+
+	var wg sync.WaitGroup
+
+	for scanner.Scan() {
+		rc.SetReadDeadline(deadline()) // nolint:errcheck
+
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-c.Done():
+		}
+
+		if c.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+
+		go func(line []byte) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			out.writeLine(p.serveStreamLine(c, r, line))
+		}(bytes.Clone(line))
+	}
+
+	if err := scanner.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			out.writeLine(p.streamError(c, r, nil, middleware.GatewayError{
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Code:       middleware.JSONRPCErrorInvalidRequest,
+				Message:    "request too large",
+				Reason:     "request_too_large",
+			}))
+		}
+
+		// A stream that can't be read to the end is given up on, along with
+		// the requests in flight.
+		//
+		cancel()
+	}
+
+	wg.Wait()
+}
+
+// serveStreamLine serves the request on line, with the headers of the
+// stream, and returns its response on a single line.
+func (p *Proxy) serveStreamLine(c context.Context, stream *http.Request, line []byte) []byte {
+	r, err := http.NewRequestWithContext(c, http.MethodPost, "/", bytes.NewReader(line))
+	if err != nil {
+		return p.streamError(c, stream, line, middleware.GatewayError{
+			StatusCode: http.StatusInternalServerError,
+			Code:       middleware.JSONRPCErrorInternal,
+			Message:    "cannot serve the request",
+			Reason:     "stream_request_invalid",
+		})
+	}
+
+	r.Header = stream.Header.Clone()
+	r.RemoteAddr = stream.RemoteAddr
+	r.Header.Set(headers.ContentType, "application/json")
+
+	// Lines are never compressed, and neither are their responses, which
+	// are written as they are to the stream.
+	//
+	r.Header.Del(headers.ContentEncoding)
+	r.Header.Del(headers.AcceptEncoding)
+	r.Header.Del(headers.ContentLength)
+
+	pw := NewResponseWriter()
+	p.ServeHTTP(pw, r)
+
+	var response bytes.Buffer
+	if err := json.Compact(&response, pw.body.Bytes()); err != nil {
+		return p.streamError(c, stream, line, middleware.GatewayError{
+			StatusCode: http.StatusBadGateway,
+			Code:       middleware.JSONRPCErrorInternal,
+			Message:    "the response isn't valid JSON",
+			Reason:     "stream_invalid_response",
+		})
+	}
+
+	return response.Bytes()
+}
+
+// streamError returns the gateway error e on a single line, with the id of
+// the request on line, if any.
+func (p *Proxy) streamError(c context.Context, stream *http.Request, line []byte, e middleware.GatewayError) []byte {
+	var request struct {
+		ID json.RawMessage `json:"id"`
+	}
+
+	json.Unmarshal(line, &request) // nolint:errcheck
+
+	pw := NewResponseWriter()
+	p.writeError(pw, stream.WithContext(middleware.WithJSONRPCID(c, request.ID)), e)
+
+	// Errors are indented when the stream asks for pretty ones.
+	//
+	var response bytes.Buffer
+	json.Compact(&response, pw.body.Bytes()) // nolint:errcheck
+
+	return response.Bytes()
+}
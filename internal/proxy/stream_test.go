@@ -0,0 +1,226 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStreamTestProxy returns a proxy serving streams configured by config,
+// to a target answering every request with its id after
+// running handle. Requests that aren't JSON are answered with plain text.
+func newStreamTestProxy(t *testing.T, config StreamConfig, handle func(r *http.Request)) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Write([]byte("bad request")) // nolint:errcheck
+
+			return
+		}
+
+		handle(r)
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":` + string(req.ID) + `,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(node.Close)
+
+	config.Enabled = true
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.Stream = config
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, rpcGatewayConfig)
+}
+
+func TestServeStream(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+
+	p := newStreamTestProxy(t, StreamConfig{MaxInFlight: 4}, func(r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(p.ServeStream))
+	defer server.Close()
+
+	var body strings.Builder
+
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&body, `{"jsonrpc":"2.0","id":%d,"method":"eth_getBalance","params":["0x%x"]}`+"\n", i, i)
+	}
+
+	resp, err := http.Post(server.URL, "application/jsonl", strings.NewReader(body.String()))
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, StreamContentType, resp.Header.Get("Content-Type"))
+
+	ids := map[int]bool{}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var response struct {
+			ID     int    `json:"id"`
+			Result string `json:"result"`
+		}
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &response), scanner.Text())
+		assert.Equal(t, "0x1", response.Result)
+		assert.False(t, ids[response.ID], "duplicate id %d", response.ID)
+
+		ids[response.ID] = true
+	}
+
+	require.NoError(t, scanner.Err())
+	assert.Len(t, ids, 100)
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(4))
+}
+
+func TestServeStreamWritesErrorsOnTheirLine(t *testing.T) {
+	p := newStreamTestProxy(t, StreamConfig{}, func(r *http.Request) {})
+
+	rr := httptest.NewRecorder()
+	p.ServeStream(rr, httptest.NewRequest(http.MethodPost, "/stream", strings.NewReader(
+		"not json\n\n"+`{"jsonrpc":"2.0","id":"a","method":"eth_chainId"}`+"\n")))
+
+	lines := strings.Split(strings.TrimSpace(rr.Body.String()), "\n")
+	require.Len(t, lines, 2)
+
+	for _, line := range lines {
+		assert.True(t, json.Valid([]byte(line)), line)
+	}
+
+	assert.Contains(t, rr.Body.String(), `"reason":"stream_invalid_response"`)
+	assert.Contains(t, rr.Body.String(), `{"jsonrpc":"2.0","id":"a","result":"0x1"}`)
+}
+
+func TestServeStreamCancelsRequestsOnClose(t *testing.T) {
+	received := make(chan struct{})
+	canceled := make(chan struct{})
+
+	p := newStreamTestProxy(t, StreamConfig{}, func(r *http.Request) {
+		close(received)
+		<-r.Context().Done()
+		close(canceled)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(p.ServeStream))
+	defer server.Close()
+
+	pr, pw := io.Pipe()
+
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(c, http.MethodPost, server.URL, pr)
+	require.NoError(t, err)
+
+	go func() {
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	pw.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]}` + "\n")) // nolint:errcheck
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request never reached the target")
+	}
+
+	cancel()
+	pw.Close()
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request in flight wasn't canceled")
+	}
+}
+
+func TestServeStreamClosesIdleStreams(t *testing.T) {
+	tests := []struct {
+		name   string
+		config StreamConfig
+	}{
+		{"idle timeout", StreamConfig{IdleTimeout: 100 * time.Millisecond}},
+		{"max duration", StreamConfig{IdleTimeout: time.Minute, MaxDuration: 200 * time.Millisecond}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			p := newStreamTestProxy(t, tt.config, func(r *http.Request) {})
+
+			served := make(chan struct{})
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer close(served)
+				p.ServeStream(w, r)
+			}))
+			defer server.Close()
+
+			pr, pw := io.Pipe()
+			defer pw.Close()
+
+			req, err := http.NewRequest(http.MethodPost, server.URL, pr)
+			require.NoError(t, err)
+
+			go func() {
+				resp, err := http.DefaultClient.Do(req)
+				if err == nil {
+					io.Copy(io.Discard, resp.Body) // nolint:errcheck
+					resp.Body.Close()
+				}
+			}()
+
+			// The client keeps the stream open after a first line, sending
+			// nothing else. The stream is closed by the server.
+			//
+			pw.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}` + "\n")) // nolint:errcheck
+
+			select {
+			case <-served:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the idle stream wasn't closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package proxy
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Reasons a target is tainted for. A target is excluded while any of them is
+// active, each one is set and cleared independently.
+const (
+	// TaintReasonManual is set by operators, it's never lifted
+	// automatically.
+	TaintReasonManual = "manual"
+	// TaintReasonErrorRate is set on a method class whose rolling window
+	// success rate fell under the threshold.
+	TaintReasonErrorRate = "error_rate"
+	// TaintReasonBlockLag is set on targets behind the highest block.
+	TaintReasonBlockLag = "block_lag"
+	// TaintReasonCooldown429 is set on targets rate limiting the gateway.
+	TaintReasonCooldown429 = "cooldown_429"
+	// TaintReasonBudgetExhausted is set on targets out of request budget.
+	TaintReasonBudgetExhausted = "budget_exhausted"
+	// TaintReasonMaintenance is set on targets during their maintenance
+	// windows. Untaint doesn't lift a scheduled window.
+	TaintReasonMaintenance = "maintenance"
+	// TaintReasonMisconfigured is set on targets failing permanently, e.g.
+	// answering 404 or with an untrusted certificate.
+	TaintReasonMisconfigured = "misconfigured"
+)
+
+// ErrUnknownTaintReason is returned for reasons not listed above.
+var ErrUnknownTaintReason = errors.New("unknown taint reason")
+
+func taintReasons() []string {
+	return []string{
+		TaintReasonManual,
+		TaintReasonErrorRate,
+		TaintReasonBlockLag,
+		TaintReasonCooldown429,
+		TaintReasonBudgetExhausted,
+		TaintReasonMaintenance,
+		TaintReasonMisconfigured,
+	}
+}
+
+func validateTaintReason(reason string) error {
+	for _, r := range taintReasons() {
+		if r == reason {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrUnknownTaintReason, "%q", reason)
+}
+
+// Taint is an active taint of a target.
+type Taint struct {
+	Reason string `json:"reason"`
+	// Class is the method class the taint applies to, empty when it applies
+	// to the whole target.
+	Class string `json:"class,omitempty"`
+	// Until is when the taint expires, nil when it only ends once cleared.
+	Until *time.Time `json:"until,omitempty"`
+}
+
+// Taint taints the named target for the given reason. A zero duration keeps
+// it until Untaint is called. Tainting again for the same reason replaces
+// the expiry.
+func (h *HealthCheckManager) Taint(name, reason string, duration time.Duration) error {
+	if err := validateTaintReason(reason); err != nil {
+		return err
+	}
+
+	e, err := h.entry(name)
+	if err != nil {
+		return err
+	}
+
+	var until time.Time
+	if duration > 0 {
+		until = h.clock.Now().Add(duration)
+	}
+
+	e.mu.Lock()
+	e.taints[reason] = until
+	e.mu.Unlock()
+
+	h.metricRPCProviderTaints.WithLabelValues(name, reason).Inc()
+
+	h.logger.Warn("tainting target", "nodeprovider", name, "reason", reason, "until", until)
+
+	return nil
+}
+
+// Untaint clears the given reason of the named target, the other reasons
+// stay active.
+func (h *HealthCheckManager) Untaint(name, reason string) error {
+	if err := validateTaintReason(reason); err != nil {
+		return err
+	}
+
+	e, err := h.entry(name)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	_, ok := e.taints[reason]
+	delete(e.taints, reason)
+	e.mu.Unlock()
+
+	if ok {
+		h.logger.Info("untainting target", "nodeprovider", name, "reason", reason)
+	}
+
+	return nil
+}
+
+// Taints returns the active taints of the named target, sorted by reason
+// and class.
+func (h *HealthCheckManager) Taints(name string) ([]Taint, error) {
+	e, err := h.entry(name)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h.expireTaints(name, e)
+
+	taints := []Taint{}
+
+	for reason, until := range e.taints {
+		until := until
+
+		taint := Taint{Reason: reason}
+		if !until.IsZero() {
+			taint.Until = &until
+		}
+
+		taints = append(taints, taint)
+	}
+
+	if until := h.maintenanceUntil(name, e); !until.IsZero() {
+		taints = mergeMaintenanceTaint(taints, until)
+	}
+
+	for class, state := range e.classes {
+		if until := state.taintedUntil; h.clock.Now().Before(until) {
+			taints = append(taints, Taint{Reason: TaintReasonErrorRate, Class: class, Until: &until})
+		}
+	}
+
+	sort.Slice(taints, func(i, j int) bool {
+		if taints[i].Reason != taints[j].Reason {
+			return taints[i].Reason < taints[j].Reason
+		}
+
+		return taints[i].Class < taints[j].Class
+	})
+
+	return taints, nil
+}
+
+// reportTaintMetrics sets the status of the named target for every taint
+// reason.
+func (h *HealthCheckManager) reportTaintMetrics(name string) {
+	taints, err := h.Taints(name)
+	if err != nil {
+		return
+	}
+
+	active := make(map[string]bool, len(taints))
+	for _, taint := range taints {
+		active[taint.Reason] = true
+	}
+
+	for _, reason := range taintReasons() {
+		if active[reason] {
+			h.metricRPCProviderStatus.WithLabelValues(name, reason).Set(1)
+		} else {
+			h.metricRPCProviderStatus.WithLabelValues(name, reason).Set(0)
+		}
+	}
+}
+
+// isTargetTainted reports whether any reason taints the whole named target.
+func (h *HealthCheckManager) isTargetTainted(name string) bool {
+	e, err := h.entry(name)
+	if err != nil {
+		return false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	h.expireTaints(name, e)
+
+	return len(e.taints) > 0 || !h.maintenanceUntil(name, e).IsZero()
+}
+
+// expireTaints lifts the expired taints of a target, e.mu must be held.
+func (h *HealthCheckManager) expireTaints(name string, e *healthCheckEntry) {
+	for reason, until := range e.taints {
+		if until.IsZero() || h.clock.Now().Before(until) {
+			continue
+		}
+
+		delete(e.taints, reason)
+
+		h.logger.Info("taint expired", "nodeprovider", name, "reason", reason)
+	}
+}
+
+// maintenanceUntil returns when the maintenance windows of a target active
+// now end, the zero time when none is, and logs the windows starting and
+// ending. e.mu must be held.
+func (h *HealthCheckManager) maintenanceUntil(name string, e *healthCheckEntry) time.Time {
+	var until time.Time
+
+	now := h.clock.Now()
+
+	for _, w := range e.maintenance {
+		if end := w.activeUntil(now); end.After(until) {
+			until = end
+		}
+	}
+
+	inMaintenance := !until.IsZero()
+
+	if inMaintenance && !e.inMaintenance {
+		h.metricRPCProviderTaints.WithLabelValues(name, TaintReasonMaintenance).Inc()
+		h.logger.Warn("maintenance window started", "nodeprovider", name, "until", until)
+	} else if !inMaintenance && e.inMaintenance {
+		h.logger.Info("maintenance window ended", "nodeprovider", name)
+	}
+
+	e.inMaintenance = inMaintenance
+
+	return until
+}
+
+// mergeMaintenanceTaint adds the taint of the active maintenance windows,
+// ending at until, to taints. A manual maintenance taint lasting longer is
+// kept as is.
+func mergeMaintenanceTaint(taints []Taint, until time.Time) []Taint {
+	for i, taint := range taints {
+		if taint.Reason != TaintReasonMaintenance {
+			continue
+		}
+
+		if taint.Until != nil && taint.Until.Before(until) {
+			taints[i].Until = &until
+		}
+
+		return taints
+	}
+
+	return append(taints, Taint{Reason: TaintReasonMaintenance, Until: &until})
+}
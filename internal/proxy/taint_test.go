@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthCheckManagerOverlappingTaints(t *testing.T) {
+	clock := newFakeClock()
+
+	hcm := newTestHealthCheckManager(t, "Server1")
+	hcm.clock = clock
+
+	assert.True(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	assert.NoError(t, hcm.Taint("Server1", TaintReasonManual, 0))
+	assert.NoError(t, hcm.Taint("Server1", TaintReasonCooldown429, 30*time.Second))
+
+	assert.False(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	taints, err := hcm.Taints("Server1")
+	assert.NoError(t, err)
+	assert.Len(t, taints, 2)
+	assert.Equal(t, TaintReasonCooldown429, taints[0].Reason)
+	assert.Equal(t, clock.Now().Add(30*time.Second), *taints[0].Until)
+	assert.Equal(t, TaintReasonManual, taints[1].Reason)
+	assert.Nil(t, taints[1].Until)
+
+	hcm.reportStatusMetrics()
+	assert.Equal(t, 1.0, testutil.ToFloat64(hcm.metricRPCProviderStatus.WithLabelValues("Server1", TaintReasonManual)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(hcm.metricRPCProviderStatus.WithLabelValues("Server1", TaintReasonCooldown429)))
+	assert.Equal(t, 1.0, testutil.ToFloat64(hcm.metricRPCProviderStatus.WithLabelValues("Server1", "tainted")))
+
+	// The cooldown expires, the manual taint still holds.
+	//
+	clock.Advance(31 * time.Second)
+
+	assert.False(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	taints, err = hcm.Taints("Server1")
+	assert.NoError(t, err)
+	assert.Equal(t, []Taint{{Reason: TaintReasonManual}}, taints)
+
+	hcm.reportStatusMetrics()
+	assert.Zero(t, testutil.ToFloat64(hcm.metricRPCProviderStatus.WithLabelValues("Server1", TaintReasonCooldown429)))
+
+	assert.NoError(t, hcm.Untaint("Server1", TaintReasonManual))
+
+	assert.True(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	hcm.reportStatusMetrics()
+	assert.Zero(t, testutil.ToFloat64(hcm.metricRPCProviderStatus.WithLabelValues("Server1", "tainted")))
+}
+
+func TestHealthCheckManagerErrorRateExpiryKeepsManualTaint(t *testing.T) {
+	clock := newFakeClock()
+
+	hcm := newTestHealthCheckManagerWithConfig(t, HealthCheckConfig{
+		RollingWindowSize:            2,
+		RollingWindowMinObservations: 1,
+		RollingWindowTaintThreshold:  0.5,
+		TaintDuration:                time.Minute,
+	}, "Server1")
+	hcm.clock = clock
+
+	hcm.ObserveFailure("Server1", DefaultMethodClass)
+	hcm.ObserveFailure("Server1", DefaultMethodClass)
+
+	assert.NoError(t, hcm.Taint("Server1", TaintReasonManual, 0))
+
+	taints, err := hcm.Taints("Server1")
+	assert.NoError(t, err)
+	assert.Len(t, taints, 2)
+	assert.Equal(t, TaintReasonErrorRate, taints[0].Reason)
+	assert.Equal(t, DefaultMethodClass, taints[0].Class)
+
+	clock.Advance(2 * time.Minute)
+
+	assert.False(t, hcm.IsTainted("Server1", DefaultMethodClass))
+	assert.False(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+
+	assert.NoError(t, hcm.Untaint("Server1", TaintReasonManual))
+	assert.True(t, hcm.IsAvailable("Server1", DefaultMethodClass))
+}
+
+func TestHealthCheckManagerTaintErrors(t *testing.T) {
+	hcm := newTestHealthCheckManager(t, "Server1")
+
+	assert.ErrorIs(t, hcm.Taint("Server1", "bored", 0), ErrUnknownTaintReason)
+	assert.ErrorIs(t, hcm.Untaint("Server1", "bored"), ErrUnknownTaintReason)
+	assert.ErrorIs(t, hcm.Taint("Unknown", TaintReasonManual, 0), ErrTargetNotFound)
+
+	_, err := hcm.Taints("Unknown")
+	assert.ErrorIs(t, err, ErrTargetNotFound)
+}
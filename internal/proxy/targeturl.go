@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// normalizeTargetURL validates the URL of an HTTP target and returns its
+// canonical form, so the reverse proxy, the health checks and the logs all
+// derive the same host from it: the scheme and host are lowercased, IPv6
+// literals are bracketed and trailing slashes are removed from the path.
+// Errors never include the URL, which may hold secrets.
+func normalizeTargetURL(raw string) (string, error) {
+	if raw == "" {
+		return "", errors.New("missing url")
+	}
+
+	target, err := url.Parse(raw)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return "", errors.Wrap(err, "cannot parse url")
+	}
+
+	target.Scheme = strings.ToLower(target.Scheme)
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return "", errors.New("url scheme must be http or https")
+	}
+
+	// The port of an IPv6 literal without brackets can't be told apart from
+	// the address.
+	//
+	if strings.Count(target.Host, ":") > 1 && !strings.HasPrefix(target.Host, "[") {
+		return "", errors.New("url IPv6 address must be in brackets, e.g. http://[2001:db8::1]:8545")
+	}
+
+	host := strings.ToLower(target.Hostname())
+	if host == "" {
+		return "", errors.New("url has no host")
+	}
+
+	if port := target.Port(); port != "" {
+		target.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		target.Host = "[" + host + "]"
+	} else {
+		target.Host = host
+	}
+
+	target.Path = strings.TrimRight(target.Path, "/")
+	target.RawPath = strings.TrimRight(target.RawPath, "/")
+
+	return target.String(), nil
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeTargetURL(t *testing.T) {
+	for _, tc := range []struct {
+		raw        string
+		normalized string
+		err        string
+	}{
+		{raw: "https://cloudflare-eth.com", normalized: "https://cloudflare-eth.com"},
+		{raw: "https://cloudflare-eth.com/", normalized: "https://cloudflare-eth.com"},
+		{raw: "HTTPS://Cloudflare-ETH.com//", normalized: "https://cloudflare-eth.com"},
+		{raw: "https://eth.example.com/v2/key/?a=1&b=2", normalized: "https://eth.example.com/v2/key?a=1&b=2"},
+		{raw: "http://[2001:db8::1]:8545", normalized: "http://[2001:db8::1]:8545"},
+		{raw: "http://[2001:DB8::1]/", normalized: "http://[2001:db8::1]"},
+		{raw: "http://127.0.0.1:8545/rpc/", normalized: "http://127.0.0.1:8545/rpc"},
+		{raw: "", err: "missing url"},
+		{raw: "cloudflare-eth.com", err: "url scheme must be http or https"},
+		{raw: "localhost:8545", err: "url scheme must be http or https"},
+		{raw: "ws://localhost:8546", err: "url scheme must be http or https"},
+		{raw: "https://", err: "url has no host"},
+		{raw: "http://2001:db8::1:8545", err: "url IPv6 address must be in brackets"},
+		{raw: "http://2001:db8::1", err: "url IPv6 address must be in brackets"},
+	} {
+		normalized, err := normalizeTargetURL(tc.raw)
+
+		if tc.err != "" {
+			assert.ErrorContains(t, err, tc.err, tc.raw)
+
+			continue
+		}
+
+		assert.NoError(t, err, tc.raw)
+		assert.Equal(t, tc.normalized, normalized, tc.raw)
+	}
+}
+
+func TestNormalizeTargetURLHidesTheURL(t *testing.T) {
+	_, err := normalizeTargetURL("https://eth.example.com:port/v2/secret")
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
+
+func TestNewNodeProviderRejectsInvalidURLs(t *testing.T) {
+	for _, url := range []string{"", "localhost:8545", "https://"} {
+		_, err := NewNodeProvider(NodeProviderConfig{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{URL: url},
+			},
+		})
+		assert.ErrorContains(t, err, `invalid target "Server1"`, url)
+	}
+}
+
+func TestHttpFailoverProxyIPv6Target(t *testing.T) {
+	listener, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 is not available")
+	}
+
+	fake := newFakeNode(t)
+	defer fake.Close()
+
+	var host string
+
+	node := &httptest.Server{
+		Listener: listener,
+		Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host = r.Host
+			fake.Config.Handler.ServeHTTP(w, r)
+		})},
+	}
+	node.Start()
+	defer node.Close()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	config := createConfig()
+	config.HealthChecks.Timeout = time.Second
+	config.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL + "/"},
+			},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, listener.Addr().String(), host)
+
+	healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+		URL:    node.URL,
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	require.NoError(t, err)
+
+	result, err := healthchecker.Check(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0x10), result.BlockNumber)
+	assert.NoError(t, healthchecker.Stop(context.Background()))
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"sort"
+)
+
+// byTier orders the candidates by tier, keeping the order of the load
+// balancing within a tier. The proxy attempts them in order, so requests
+// only spill into a tier once every target of the previous ones is
+// unavailable, saturated or failed. The candidates are returned as is when
+// they're already in order, e.g. when every target is in the first tier.
+func byTier(candidates []*NodeProvider) []*NodeProvider {
+	sorted := sort.SliceIsSorted(candidates, func(i, j int) bool {
+		return candidates[i].Tier() < candidates[j].Tier()
+	})
+	if sorted {
+		return candidates
+	}
+
+	// The candidates may be the targets of the proxy themselves.
+	//
+	tiered := make([]*NodeProvider, len(candidates))
+	copy(tiered, candidates)
+
+	sort.SliceStable(tiered, func(i, j int) bool {
+		return tiered[i].Tier() < tiered[j].Tier()
+	})
+
+	return tiered
+}
+
+// activeTier returns the lowest tier with a target available to any method
+// class, the one requests are served from, 0 when none is available.
+func (p *Proxy) activeTier() uint {
+	var tier uint
+
+	for _, target := range p.targets {
+		if target.Draining() || !p.hcm.IsAvailable(target.Name(), "") {
+			continue
+		}
+
+		if tier == 0 || target.Tier() < tier {
+			tier = target.Tier()
+		}
+	}
+
+	return tier
+}
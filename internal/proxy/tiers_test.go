@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestByTier(t *testing.T) {
+	targets := []*NodeProvider{
+		{Config: NodeProviderConfig{Name: "public", Tier: 3}},
+		{Config: NodeProviderConfig{Name: "paid1", Tier: 2}},
+		{Config: NodeProviderConfig{Name: "self-hosted"}},
+		{Config: NodeProviderConfig{Name: "paid2", Tier: 2}},
+	}
+
+	names := func(targets []*NodeProvider) []string {
+		names := []string{}
+		for _, target := range targets {
+			names = append(names, target.Name())
+		}
+
+		return names
+	}
+
+	assert.Equal(t, []string{"self-hosted", "paid1", "paid2", "public"}, names(byTier(targets)))
+	assert.Equal(t, []string{"public", "paid1", "self-hosted", "paid2"}, names(targets))
+
+	sorted := targets[2:3]
+	assert.Same(t, &sorted[0], &byTier(sorted)[0])
+}
+
+// newTestTieredProxy returns a proxy with a failing and a working target in
+// the first tier, and a working one in the second tier, configured first.
+// The requests served by each target are counted in calls.
+func newTestTieredProxy(t *testing.T) (*Proxy, map[string]int) {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var mu sync.Mutex
+
+	calls := map[string]int{}
+
+	newServer := func(name string, status int) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			calls[name]++
+			mu.Unlock()
+
+			w.WriteHeader(status)
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + name + `"}`)) // nolint:errcheck
+		}))
+		t.Cleanup(server.Close)
+
+		return server.URL
+	}
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name:       "Public",
+			Tier:       2,
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: newServer("Public", http.StatusOK)}},
+		},
+		{
+			Name:       "Failing",
+			Tier:       1,
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: newServer("Failing", http.StatusInternalServerError)}},
+		},
+		{
+			Name:       "Working",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: newServer("Working", http.StatusOK)}},
+		},
+	}
+
+	return newTestFailoverProxy(t, rpcGatewayConfig), calls
+}
+
+func serveTieredRequest(p *Proxy) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	rr := httptest.NewRecorder()
+
+	p.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestHttpFailoverProxyFailsOverWithinTier(t *testing.T) {
+	p, calls := newTestTieredProxy(t)
+
+	rr := serveTieredRequest(p)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Working")
+	assert.Equal(t, map[string]int{"Failing": 1, "Working": 1}, calls)
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricActiveTier))
+}
+
+func TestHttpFailoverProxySpillsIntoNextTier(t *testing.T) {
+	p, calls := newTestTieredProxy(t)
+
+	// The active tier follows the health of the targets, not the requests.
+	//
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricActiveTier))
+
+	assert.NoError(t, p.hcm.Taint("Failing", TaintReasonManual, 0))
+	assert.NoError(t, p.hcm.Taint("Working", TaintReasonManual, 0))
+	assert.Equal(t, 2.0, testutil.ToFloat64(p.metricActiveTier))
+
+	rr := serveTieredRequest(p)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Public")
+	assert.Equal(t, map[string]int{"Public": 1}, calls)
+	assert.Equal(t, 2.0, testutil.ToFloat64(p.metricActiveTier))
+
+	assert.NoError(t, p.hcm.Untaint("Working", TaintReasonManual))
+
+	rr = serveTieredRequest(p)
+
+	assert.Contains(t, rr.Body.String(), "Working")
+	assert.Equal(t, 1.0, testutil.ToFloat64(p.metricActiveTier))
+
+	for _, name := range []string{"Working", "Public"} {
+		assert.NoError(t, p.hcm.Taint(name, TaintReasonManual, 0))
+	}
+
+	assert.Equal(t, 0.0, testutil.ToFloat64(p.metricActiveTier))
+}
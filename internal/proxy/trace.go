@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DebugHeader asks for the trace of a request when set to
+	// DebugHeaderTrace.
+	DebugHeader      = "X-RPC-Gateway-Debug"
+	DebugHeaderTrace = "trace"
+
+	// DebugTokenHeader carries the token of the trace config, if any.
+	DebugTokenHeader = "X-RPC-Gateway-Debug-Token"
+
+	// TraceHeader holds the trace of a request in the header output mode.
+	TraceHeader = "X-RPC-Gateway-Trace"
+
+	// traceBodyField holds the trace of a request in the body output mode.
+	traceBodyField = "_gateway"
+)
+
+// Trace output modes.
+const (
+	TraceOutputHeader = "header"
+	TraceOutputBody   = "body"
+)
+
+// DebugTraceConfig lets clients ask for the upstream attempts made on behalf
+// of their request, to tell themselves why it was slow or failed.
+type DebugTraceConfig struct {
+	Enabled bool `yaml:"enabled"`
+
+	// Token has to be sent in the X-RPC-Gateway-Debug-Token header when
+	// set, so only trusted clients get traces.
+	Token string `yaml:"token"`
+
+	// Output is "header" to send the trace in the X-RPC-Gateway-Trace
+	// response header, or "body" to add it to the JSON-RPC response as the
+	// "_gateway" field. Defaults to "header", which keeps responses pure
+	// JSON-RPC.
+	Output string `yaml:"output"`
+}
+
+func (c DebugTraceConfig) output() string {
+	if c.Output == "" {
+		return TraceOutputHeader
+	}
+
+	return c.Output
+}
+
+func (c DebugTraceConfig) validate() error {
+	switch c.output() {
+	case TraceOutputHeader, TraceOutputBody:
+		return nil
+	default:
+		return errors.Errorf("invalid debug trace output %q", c.Output)
+	}
+}
+
+// traced reports whether the trace of r is asked for and allowed.
+func (c DebugTraceConfig) traced(r *http.Request) bool {
+	if !c.Enabled || r.Header.Get(DebugHeader) != DebugHeaderTrace {
+		return false
+	}
+
+	if c.Token == "" {
+		return true
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(DebugTokenHeader)), []byte(c.Token)) == 1
+}
+
+// AttemptTrace is a single upstream attempt of a request.
+type AttemptTrace struct {
+	Provider   string `json:"provider"`
+	DurationMs int64  `json:"durationMs"`
+	// Outcome is "success", "timeout", "transport_error", "http_<status>",
+	// or "retried_<class>" for the attempts retried on the same target.
+	Outcome string `json:"outcome"`
+}
+
+// RequestTrace is the summary of the upstream attempts of a request.
+type RequestTrace struct {
+	Attempts []AttemptTrace `json:"attempts"`
+	TotalMs  int64          `json:"totalMs"`
+}
+
+// attemptOutcome returns the outcome of an attempt served into pw.
+func (p *Proxy) attemptOutcome(pw *ReponseWriter, err error) string {
+	switch {
+	case !p.HasNodeProviderFailed(pw.statusCode):
+		return attemptSuccess
+	case err != nil:
+		return "transport_error"
+	case pw.statusCode == http.StatusGatewayTimeout:
+		return "timeout"
+	default:
+		return "http_" + strconv.Itoa(pw.statusCode)
+	}
+}
+
+// traceWriter adds the trace of the request to its response.
+type traceWriter struct {
+	http.ResponseWriter
+
+	attempts *requestAttempts
+	start    time.Time
+	output   string
+
+	// body and statusCode hold the response in the body output mode, until
+	// flush adds the trace to it.
+	body       bytes.Buffer
+	statusCode int
+}
+
+func newTraceWriter(w http.ResponseWriter, attempts *requestAttempts, output string) *traceWriter {
+	return &traceWriter{
+		ResponseWriter: w,
+		attempts:       attempts,
+		start:          time.Now(),
+		output:         output,
+		statusCode:     http.StatusOK,
+	}
+}
+
+func (t *traceWriter) trace() RequestTrace {
+	return RequestTrace{
+		Attempts: t.attempts.Trace(),
+		TotalMs:  time.Since(t.start).Milliseconds(),
+	}
+}
+
+func (t *traceWriter) WriteHeader(statusCode int) {
+	if t.output == TraceOutputBody {
+		t.statusCode = statusCode
+
+		return
+	}
+
+	if value, err := json.Marshal(t.trace()); err == nil {
+		t.Header().Set(TraceHeader, string(value))
+	}
+
+	t.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (t *traceWriter) Write(b []byte) (int, error) {
+	if t.output == TraceOutputBody {
+		return t.body.Write(b)
+	}
+
+	return t.ResponseWriter.Write(b)
+}
+
+// flush writes the response held in the body output mode, with the trace
+// added to it. Responses that aren't a JSON object, like batches, get the
+// trace header instead.
+func (t *traceWriter) flush() {
+	if t.output != TraceOutputBody {
+		return
+	}
+
+	body := t.body.Bytes()
+
+	var response map[string]json.RawMessage
+
+	trace, err := json.Marshal(t.trace())
+	if err == nil && json.Unmarshal(body, &response) == nil {
+		response[traceBodyField] = trace
+
+		if traced, err := json.Marshal(response); err == nil {
+			body = traced
+		}
+	} else if err == nil {
+		t.Header().Set(TraceHeader, string(trace))
+	}
+
+	t.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	t.ResponseWriter.WriteHeader(t.statusCode)
+	t.ResponseWriter.Write(body) // nolint:errcheck
+}
@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTraceProxy(t *testing.T, trace DebugTraceConfig) *Proxy {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failing.Close)
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	t.Cleanup(working.Close)
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Proxy.Retry = RetryConfig{MaxAttempts: 2, Backoff: time.Millisecond}
+	rpcGatewayConfig.Proxy.DebugTrace = trace
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: failing.URL,
+				},
+			},
+		},
+		{
+			Name: "Server2",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URL: working.URL,
+				},
+			},
+		},
+	}
+
+	return newTestFailoverProxy(t, rpcGatewayConfig)
+}
+
+func serveTracedRequest(p *Proxy, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func assertTraceOutcomes(t *testing.T, trace RequestTrace) {
+	t.Helper()
+
+	outcomes := []string{}
+	for _, attempt := range trace.Attempts {
+		outcomes = append(outcomes, attempt.Provider+":"+attempt.Outcome)
+	}
+
+	assert.Equal(t, []string{
+		"Server1:retried_server_error",
+		"Server1:http_503",
+		"Server2:success",
+	}, outcomes)
+}
+
+func TestHttpFailoverProxyTracesAttemptsInHeader(t *testing.T) {
+	p := newTestTraceProxy(t, DebugTraceConfig{Enabled: true})
+
+	rr := serveTracedRequest(p, map[string]string{DebugHeader: DebugHeaderTrace})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, rr.Body.String())
+
+	var trace RequestTrace
+	require.NoError(t, json.Unmarshal([]byte(rr.Header().Get(TraceHeader)), &trace))
+	assertTraceOutcomes(t, trace)
+	assert.GreaterOrEqual(t, trace.TotalMs, int64(0))
+
+	rr = serveTracedRequest(p, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(TraceHeader))
+}
+
+func TestHttpFailoverProxyTracesAttemptsInBody(t *testing.T) {
+	p := newTestTraceProxy(t, DebugTraceConfig{Enabled: true, Output: TraceOutputBody})
+
+	rr := serveTracedRequest(p, map[string]string{DebugHeader: DebugHeaderTrace})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(TraceHeader))
+
+	var response struct {
+		Result  string       `json:"result"`
+		Gateway RequestTrace `json:"_gateway"`
+	}
+
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+	assert.Equal(t, "0x1", response.Result)
+	assertTraceOutcomes(t, response.Gateway)
+}
+
+func TestHttpFailoverProxyTraceRequiresToken(t *testing.T) {
+	p := newTestTraceProxy(t, DebugTraceConfig{Enabled: true, Token: "secret"})
+
+	rr := serveTracedRequest(p, map[string]string{DebugHeader: DebugHeaderTrace})
+	assert.Empty(t, rr.Header().Get(TraceHeader))
+
+	rr = serveTracedRequest(p, map[string]string{DebugHeader: DebugHeaderTrace, DebugTokenHeader: "wrong"})
+	assert.Empty(t, rr.Header().Get(TraceHeader))
+
+	rr = serveTracedRequest(p, map[string]string{DebugHeader: DebugHeaderTrace, DebugTokenHeader: "secret"})
+	assert.NotEmpty(t, rr.Header().Get(TraceHeader))
+}
+
+func TestHttpFailoverProxyTraceDisabled(t *testing.T) {
+	p := newTestTraceProxy(t, DebugTraceConfig{})
+
+	rr := serveTracedRequest(p, map[string]string{DebugHeader: DebugHeaderTrace})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(TraceHeader))
+}
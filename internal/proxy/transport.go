@@ -0,0 +1,316 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NodeProviderDNSConfig controls how the hostname of a target is resolved.
+type NodeProviderDNSConfig struct {
+	// RefreshInterval is how often the hostname is resolved again. Idle
+	// connections are closed when the resolved addresses change, so traffic
+	// moves along with the provider's records. Zero keeps Go's default
+	// behavior.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+
+	// PreferIPv4 dials IPv4 addresses before IPv6 ones.
+	PreferIPv4 bool `yaml:"preferIPv4"`
+
+	// Server is the "host:port" of the DNS server used instead of the system
+	// resolver, e.g. for split-horizon setups.
+	Server string `yaml:"server"`
+}
+
+func (c NodeProviderDNSConfig) isZero() bool {
+	return c == NodeProviderDNSConfig{}
+}
+
+// NodeProviderTransportConfig tunes the connections to a target. Zero values
+// keep the ones of http.DefaultTransport.
+type NodeProviderTransportConfig struct {
+	MaxIdleConns        int           `yaml:"maxIdleConns"`
+	MaxIdleConnsPerHost int           `yaml:"maxIdleConnsPerHost"`
+	MaxConnsPerHost     int           `yaml:"maxConnsPerHost"`
+	IdleConnTimeout     time.Duration `yaml:"idleConnTimeout"`
+
+	// ForceHTTP2 set to false speaks HTTP/1.1 only, e.g. to providers with
+	// a broken HTTP/2 implementation. Defaults to true.
+	ForceHTTP2 *bool `yaml:"forceHTTP2"`
+
+	ExpectContinueTimeout time.Duration `yaml:"expectContinueTimeout"`
+}
+
+func (c NodeProviderTransportConfig) isZero() bool {
+	return c == NodeProviderTransportConfig{}
+}
+
+// NewHTTPTransport returns a clone of http.DefaultTransport tuned by the
+// config.
+func NewHTTPTransport(config NodeProviderTransportConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert
+
+	if config.MaxIdleConns > 0 {
+		transport.MaxIdleConns = config.MaxIdleConns
+	}
+
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+	}
+
+	if config.MaxConnsPerHost > 0 {
+		transport.MaxConnsPerHost = config.MaxConnsPerHost
+	}
+
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+
+	if config.ExpectContinueTimeout > 0 {
+		transport.ExpectContinueTimeout = config.ExpectContinueTimeout
+	}
+
+	// A non-nil empty TLSNextProto disables HTTP/2.
+	//
+	if config.ForceHTTP2 != nil && !*config.ForceHTTP2 {
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return transport
+}
+
+// contextDialer is the subset of *net.Dialer used by the dialer.
+type contextDialer interface {
+	DialContext(c context.Context, network, address string) (net.Conn, error)
+}
+
+// ipResolver is the subset of *net.Resolver used by the dialer.
+type ipResolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type resolvedHost struct {
+	addrs      []net.IPAddr
+	resolvedAt time.Time
+}
+
+// targetDialer resolves hostnames itself, so it knows when the addresses of a
+// target change.
+type targetDialer struct {
+	config   NodeProviderDNSConfig
+	resolver ipResolver
+	dialer   contextDialer
+	clock    Clock
+
+	hosts map[string]*resolvedHost
+	mu    sync.Mutex
+}
+
+// newTargetResolver returns the resolver of the configured DNS server, the
+// system one when none is.
+func newTargetResolver(config NodeProviderDNSConfig, dialer *net.Dialer) ipResolver {
+	if config.Server == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(c context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(c, network, config.Server)
+		},
+	}
+}
+
+func newTargetDialer(config NodeProviderDNSConfig, resolver ipResolver, clock Clock) *targetDialer {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	if resolver == nil {
+		resolver = newTargetResolver(config, dialer)
+	}
+
+	return &targetDialer{
+		config:   config,
+		resolver: resolver,
+		dialer:   dialer,
+		clock:    clock,
+		hosts:    map[string]*resolvedHost{},
+	}
+}
+
+// lookup returns the addresses of host, resolving it again once the refresh
+// interval elapsed. It reports whether they changed since the previous
+// resolution.
+func (d *targetDialer) lookup(c context.Context, host string) ([]net.IPAddr, bool, error) {
+	d.mu.Lock()
+	cached, ok := d.hosts[host]
+	d.mu.Unlock()
+
+	if ok && d.clock.Now().Sub(cached.resolvedAt) < d.config.RefreshInterval {
+		return cached.addrs, false, nil
+	}
+
+	addrs, err := d.resolver.LookupIPAddr(c, host)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "cannot resolve %q", host)
+	}
+
+	if d.config.PreferIPv4 {
+		addrs = preferIPv4(addrs)
+	}
+
+	d.mu.Lock()
+	d.hosts[host] = &resolvedHost{addrs: addrs, resolvedAt: d.clock.Now()}
+	d.mu.Unlock()
+
+	return addrs, ok && !sameIPAddrs(cached.addrs, addrs), nil
+}
+
+func (d *targetDialer) DialContext(c context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if net.ParseIP(host) != nil {
+		return d.dialer.DialContext(c, network, address)
+	}
+
+	addrs, _, err := d.lookup(c, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialErr error
+
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(c, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+
+		dialErr = err
+	}
+
+	if dialErr == nil {
+		dialErr = errors.Errorf("no addresses found for %q", host)
+	}
+
+	return nil, dialErr
+}
+
+// dnsRefreshingTransport closes the idle connections of a target once its
+// hostname resolves to different addresses, otherwise keep-alive connections
+// would stick to a stale address.
+type dnsRefreshingTransport struct {
+	*http.Transport
+
+	dialer *targetDialer
+}
+
+func (t *dnsRefreshingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if t.dialer.config.RefreshInterval > 0 && net.ParseIP(r.URL.Hostname()) == nil {
+		if _, changed, err := t.dialer.lookup(r.Context(), r.URL.Hostname()); err == nil && changed {
+			t.Transport.CloseIdleConnections()
+		}
+	}
+
+	return t.Transport.RoundTrip(r)
+}
+
+// newTargetTransport returns the transport used to reach a target, both by
+// the proxy and the health checks. It returns nil when the target doesn't
+// need anything beyond http.DefaultTransport.
+func newTargetTransport(config NodeProviderConfig) http.RoundTripper {
+	tuning := config.Connection.HTTP.Transport
+
+	if config.DNS.isZero() && config.WarmUp.MinIdleConnections == 0 && tuning.isZero() {
+		return nil
+	}
+
+	var (
+		transport    *http.Transport
+		roundTripper http.RoundTripper
+	)
+
+	if config.DNS.isZero() {
+		transport = NewHTTPTransport(tuning)
+		roundTripper = transport
+	} else {
+		dnsTransport := newDNSTransport(config.DNS, tuning, nil, systemClock{})
+		transport = dnsTransport.Transport
+		roundTripper = dnsTransport
+	}
+
+	// The transport would close warm connections beyond its idle limit.
+	//
+	limit := max(transport.MaxIdleConnsPerHost, http.DefaultMaxIdleConnsPerHost)
+	if n := int(config.WarmUp.MinIdleConnections); n > limit {
+		transport.MaxIdleConnsPerHost = n
+	}
+
+	return roundTripper
+}
+
+func newDNSTransport(config NodeProviderDNSConfig, tuning NodeProviderTransportConfig, resolver ipResolver,
+	clock Clock,
+) *dnsRefreshingTransport {
+	dialer := newTargetDialer(config, resolver, clock)
+
+	transport := NewHTTPTransport(tuning)
+	transport.DialContext = dialer.DialContext
+
+	return &dnsRefreshingTransport{
+		Transport: transport,
+		dialer:    dialer,
+	}
+}
+
+// preferIPv4 moves IPv4 addresses first, keeping the resolver order
+// otherwise.
+func preferIPv4(addrs []net.IPAddr) []net.IPAddr {
+	sorted := make([]net.IPAddr, 0, len(addrs))
+
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			sorted = append(sorted, addr)
+		}
+	}
+
+	for _, addr := range addrs {
+		if addr.IP.To4() == nil {
+			sorted = append(sorted, addr)
+		}
+	}
+
+	return sorted
+}
+
+// sameIPAddrs compares addresses regardless of their order, which changes
+// between resolutions with round-robin DNS.
+func sameIPAddrs(a, b []net.IPAddr) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	seen := make(map[string]struct{}, len(a))
+	for _, addr := range a {
+		seen[addr.IP.String()] = struct{}{}
+	}
+
+	for _, addr := range b {
+		if _, ok := seen[addr.IP.String()]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	mu    sync.Mutex
+	addrs map[string][]net.IPAddr
+}
+
+func (f *fakeResolver) Set(host string, ips ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+
+	f.addrs[host] = addrs
+}
+
+func (f *fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	addrs, ok := f.addrs[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addrs, nil
+}
+
+func newNamedServer(t *testing.T, address, name string) *httptest.Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", address, err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+
+	return server
+}
+
+func TestDNSTransportMovesConnectionsOnRecordChange(t *testing.T) {
+	server1 := newNamedServer(t, "127.0.0.1:0", "Server1")
+	defer server1.Close()
+
+	_, port, err := net.SplitHostPort(server1.Listener.Addr().String())
+	assert.NoError(t, err)
+
+	server2 := newNamedServer(t, net.JoinHostPort("127.0.0.2", port), "Server2")
+	defer server2.Close()
+
+	resolver := &fakeResolver{addrs: map[string][]net.IPAddr{}}
+	resolver.Set("node.test", "127.0.0.1")
+
+	clock := newFakeClock()
+	transport := newDNSTransport(NodeProviderDNSConfig{RefreshInterval: time.Minute}, NodeProviderTransportConfig{}, resolver, clock)
+	defer transport.CloseIdleConnections()
+
+	client := &http.Client{Transport: transport}
+
+	get := func() string {
+		resp, err := client.Get("http://" + net.JoinHostPort("node.test", port))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+
+		return string(body)
+	}
+
+	assert.Equal(t, "Server1", get())
+
+	// The record changes, but the keep-alive connection is reused until the
+	// refresh interval elapses.
+	//
+	resolver.Set("node.test", "127.0.0.2")
+	assert.Equal(t, "Server1", get())
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, "Server2", get())
+}
+
+func TestPreferIPv4(t *testing.T) {
+	addrs := []net.IPAddr{
+		{IP: net.ParseIP("::1")},
+		{IP: net.ParseIP("127.0.0.1")},
+		{IP: net.ParseIP("2001:db8::1")},
+		{IP: net.ParseIP("10.0.0.1")},
+	}
+
+	sorted := preferIPv4(addrs)
+
+	assert.Equal(t, []string{"127.0.0.1", "10.0.0.1", "::1", "2001:db8::1"}, []string{
+		sorted[0].IP.String(), sorted[1].IP.String(), sorted[2].IP.String(), sorted[3].IP.String(),
+	})
+}
+
+func TestNewHTTPTransport(t *testing.T) {
+	defaults := http.DefaultTransport.(*http.Transport)
+
+	transport := NewHTTPTransport(NodeProviderTransportConfig{})
+	assert.Equal(t, defaults.MaxIdleConns, transport.MaxIdleConns)
+	assert.Equal(t, defaults.MaxIdleConnsPerHost, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, defaults.MaxConnsPerHost, transport.MaxConnsPerHost)
+	assert.Equal(t, defaults.IdleConnTimeout, transport.IdleConnTimeout)
+	assert.Equal(t, defaults.ExpectContinueTimeout, transport.ExpectContinueTimeout)
+	assert.True(t, transport.ForceAttemptHTTP2)
+	assert.Nil(t, transport.TLSNextProto)
+
+	forceHTTP2 := false
+
+	transport = NewHTTPTransport(NodeProviderTransportConfig{
+		MaxIdleConns:          1000,
+		MaxIdleConnsPerHost:   500,
+		MaxConnsPerHost:       600,
+		IdleConnTimeout:       time.Minute,
+		ForceHTTP2:            &forceHTTP2,
+		ExpectContinueTimeout: 2 * time.Second,
+	})
+	assert.Equal(t, 1000, transport.MaxIdleConns)
+	assert.Equal(t, 500, transport.MaxIdleConnsPerHost)
+	assert.Equal(t, 600, transport.MaxConnsPerHost)
+	assert.Equal(t, time.Minute, transport.IdleConnTimeout)
+	assert.Equal(t, 2*time.Second, transport.ExpectContinueTimeout)
+	assert.False(t, transport.ForceAttemptHTTP2)
+	assert.NotNil(t, transport.TLSNextProto)
+}
+
+func TestTargetTransportForcesHTTP1(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+
+	defer server.Close()
+
+	tests := []struct {
+		name       string
+		forceHTTP2 bool
+		proto      string
+	}{
+		{"http2", true, "HTTP/2.0"},
+		{"http1", false, "HTTP/1.1"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			roundTripper := newTargetTransport(NodeProviderConfig{
+				Connection: NodeProviderConnectionConfig{
+					HTTP: NodeProviderConnectionHTTPConfig{
+						URL:       server.URL,
+						Transport: NodeProviderTransportConfig{ForceHTTP2: &tt.forceHTTP2},
+					},
+				},
+			})
+
+			transport := roundTripper.(*http.Transport)
+			transport.TLSClientConfig = &tls.Config{
+				RootCAs: server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs,
+			}
+
+			defer transport.CloseIdleConnections()
+
+			res, err := (&http.Client{Transport: transport}).Get(server.URL)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			defer res.Body.Close()
+
+			body, err := io.ReadAll(res.Body)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.proto, string(body))
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log/slog"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Types of the transport errors of the targets, as labeled in the request
+// errors metric and the recent errors.
+const (
+	TransportErrorCertExpired         = "tls_cert_expired"
+	TransportErrorUnknownAuthority    = "tls_unknown_authority"
+	TransportErrorHostnameMismatch    = "tls_hostname_mismatch"
+	TransportErrorCertInvalid         = "tls_cert_invalid"
+	TransportErrorTLSHandshakeTimeout = "tls_handshake_timeout"
+	TransportErrorTLS                 = "tls_error"
+	TransportErrorConnectionRefused   = "connection_refused"
+	TransportErrorDNSNotFound         = "dns_not_found"
+	TransportErrorDNS                 = "dns_error"
+	TransportErrorTimeout             = "timeout"
+	TransportErrorCanceled            = "canceled"
+	TransportErrorRedirect            = "upstream_redirect"
+	TransportErrorOther               = "transport_error"
+)
+
+// TransportError is a transport error of a target, with its type.
+type TransportError struct {
+	Type string
+	// NotAfter is when the certificate of the target expires, the zero time
+	// when it isn't known.
+	NotAfter time.Time
+
+	err error
+}
+
+func (e *TransportError) Error() string {
+	return e.Type + ": " + e.err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.err
+}
+
+// IsTLS reports whether the error comes from the TLS handshake or the
+// certificate of the target.
+func (e *TransportError) IsTLS() bool {
+	return strings.HasPrefix(e.Type, "tls_")
+}
+
+// classifyTransportError returns err with its type, nil when err isn't a
+// transport error.
+func classifyTransportError(err error) *TransportError {
+	if err == nil {
+		return nil
+	}
+
+	var classified *TransportError
+	if errors.As(err, &classified) {
+		return classified
+	}
+
+	e := &TransportError{Type: TransportErrorOther, err: err}
+
+	var (
+		invalid      x509.CertificateInvalidError
+		hostname     x509.HostnameError
+		unknown      x509.UnknownAuthorityError
+		verification *tls.CertificateVerificationError
+		record       tls.RecordHeaderError
+		alert        tls.AlertError
+		dns          *net.DNSError
+		timeout      interface{ Timeout() bool }
+	)
+
+	switch {
+	case errors.As(err, &invalid):
+		e.Type = TransportErrorCertInvalid
+		if invalid.Reason == x509.Expired {
+			e.Type = TransportErrorCertExpired
+		}
+
+		if invalid.Cert != nil {
+			e.NotAfter = invalid.Cert.NotAfter
+		}
+	case errors.As(err, &hostname):
+		e.Type = TransportErrorHostnameMismatch
+
+		if hostname.Certificate != nil {
+			e.NotAfter = hostname.Certificate.NotAfter
+		}
+	case errors.As(err, &unknown):
+		e.Type = TransportErrorUnknownAuthority
+
+		if unknown.Cert != nil {
+			e.NotAfter = unknown.Cert.NotAfter
+		}
+	case errors.As(err, &verification):
+		e.Type = TransportErrorCertInvalid
+	case errors.As(err, &record), errors.As(err, &alert):
+		e.Type = TransportErrorTLS
+	case strings.Contains(err.Error(), "TLS handshake timeout"):
+		// The transport doesn't export the type of this error.
+		//
+		e.Type = TransportErrorTLSHandshakeTimeout
+	case errors.Is(err, syscall.ECONNREFUSED):
+		e.Type = TransportErrorConnectionRefused
+	case errors.As(err, &dns) && dns.IsNotFound:
+		e.Type = TransportErrorDNSNotFound
+	case errors.As(err, &dns):
+		e.Type = TransportErrorDNS
+	case errors.Is(err, ErrUpstreamRedirect):
+		e.Type = TransportErrorRedirect
+	case errors.Is(err, context.Canceled):
+		e.Type = TransportErrorCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &timeout) && timeout.Timeout():
+		e.Type = TransportErrorTimeout
+	}
+
+	// The certificate is kept by the verification error whatever failed
+	// about it.
+	//
+	if e.NotAfter.IsZero() && errors.As(err, &verification) && len(verification.UnverifiedCertificates) > 0 {
+		e.NotAfter = verification.UnverifiedCertificates[0].NotAfter
+	}
+
+	return e
+}
+
+// isTimeout reports whether err is a timeout.
+func isTimeout(err error) bool {
+	return err != nil && classifyTransportError(err).Type == TransportErrorTimeout
+}
+
+// logTransportError logs a transport error with message. TLS errors get a
+// warning of their own, with the expiry of the certificate, as they don't go
+// away by themselves.
+func logTransportError(logger *slog.Logger, message string, e *TransportError) {
+	if !e.IsTLS() {
+		logger.Warn(message, "type", e.Type, "error", e.err)
+
+		return
+	}
+
+	args := []interface{}{"type", e.Type, "error", e.err}
+	if !e.NotAfter.IsZero() {
+		args = append(args, "notAfter", e.NotAfter)
+	}
+
+	logger.Warn("upstream TLS failure", args...)
+}
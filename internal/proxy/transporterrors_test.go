@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newExpiredTLSServer starts a server whose self-signed certificate expired
+// at notAfter, and returns it with a transport trusting the certificate.
+func newExpiredTLSServer(t *testing.T, notAfter time.Time) (*httptest.Server, http.RoundTripper) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "expired"},
+		NotBefore:             notAfter.Add(-24 * time.Hour),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}},
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return server, &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+}
+
+func TestClassifyTransportErrorExpiredCertificate(t *testing.T) {
+	notAfter := time.Now().Add(-time.Hour).Truncate(time.Second).UTC()
+	server, transport := newExpiredTLSServer(t, notAfter)
+
+	_, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.Error(t, err)
+
+	e := classifyTransportError(err)
+	assert.Equal(t, TransportErrorCertExpired, e.Type)
+	assert.True(t, e.IsTLS())
+	assert.True(t, notAfter.Equal(e.NotAfter))
+	assert.Same(t, e, classifyTransportError(errors.Wrap(e, "attempt")))
+}
+
+func TestClassifyTransportError(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	_, err := http.Get(server.URL) // nolint:noctx
+	assert.Equal(t, TransportErrorUnknownAuthority, classifyTransportError(err).Type)
+
+	// The certificate of the test server is valid for 127.0.0.1 and
+	// example.com, not localhost.
+	//
+	_, err = server.Client().Get(strings.Replace(server.URL, "127.0.0.1", "localhost", 1)) // nolint:noctx
+	assert.Equal(t, TransportErrorHostnameMismatch, classifyTransportError(err).Type)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	address := listener.Addr().String()
+	listener.Close()
+
+	_, err = http.Get("http://" + address) // nolint:noctx
+	assert.Equal(t, TransportErrorConnectionRefused, classifyTransportError(err).Type)
+
+	err = &net.DNSError{Err: "no such host", Name: "node.invalid", IsNotFound: true}
+	assert.Equal(t, TransportErrorDNSNotFound, classifyTransportError(errors.Wrap(err, "dial")).Type)
+	assert.Equal(t, TransportErrorDNS, classifyTransportError(&net.DNSError{Err: "server misbehaving"}).Type)
+
+	assert.Equal(t, TransportErrorRedirect, classifyTransportError(errors.Wrap(ErrUpstreamRedirect, "rejected")).Type)
+	assert.Equal(t, TransportErrorOther, classifyTransportError(errors.New("boom")).Type)
+	assert.Nil(t, classifyTransportError(nil))
+}
+
+func TestHttpFailoverProxyClassifiesTransportErrors(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	server, transport := newExpiredTLSServer(t, time.Now().Add(-time.Hour))
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: server.URL}},
+		},
+	}
+	config.Transports = map[string]http.RoundTripper{"Server1": transport}
+
+	p := newTestFailoverProxy(t, config)
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	rr := httptest.NewRecorder()
+
+	p.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(p.metricRequestErrors.WithLabelValues("Server1", TransportErrorCertExpired, "none", "")))
+
+	recent, err := p.RecentErrors("Server1")
+	require.NoError(t, err)
+	require.Len(t, recent, 1)
+	assert.Equal(t, TransportErrorCertExpired, recent[0].Type)
+	assert.Contains(t, recent[0].Error, "expired")
+}
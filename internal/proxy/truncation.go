@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/pkg/errors"
+)
+
+// ErrTruncatedResponse is returned for the attempts whose upstream body was
+// cut short, e.g. by a connection closed before its end.
+var ErrTruncatedResponse = errors.New("upstream response truncated")
+
+// idempotent reports whether requests can be sent again without side
+// effects, that is whether none of them falls in a write method class.
+// Bodies that aren't JSON-RPC are taken as idempotent.
+func (p *Proxy) idempotent(requests []JSONRPCRequest) bool {
+	for _, request := range requests {
+		if p.hcm.isWriteClass(p.classifier.Classify(request.Method)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// serveTruncated counts an attempt served by target whose response was cut
+// short. The client never got any byte of it, so idempotent requests are
+// rerouted like any other failure. The others may have been executed by the
+// target, so they get an error saying so instead of being sent again. It
+// reports whether a response has been written.
+func (p *Proxy) serveTruncated(
+	w http.ResponseWriter,
+	r *http.Request,
+	target *NodeProvider,
+	pw *ReponseWriter,
+	err error,
+	state *failoverState,
+) bool {
+	p.metricRequestErrors.WithLabelValues(target.Name(), "truncated_response", "none", state.client).Inc()
+
+	if p.idempotent(state.requests) {
+		return false
+	}
+
+	p.hcm.ObserveFailure(target.Name(), state.class)
+	p.observeError(target, state.requests, pw, err)
+	p.buffers.Put(pw.body)
+
+	p.writeError(w, r, middleware.GatewayError{
+		StatusCode: http.StatusBadGateway,
+		Code:       middleware.JSONRPCErrorInternal,
+		Message: "upstream response truncated, the request may or may not have been executed, " +
+			"check its outcome before sending it again",
+		Reason: "upstream_truncated_ambiguous",
+	})
+
+	return true
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTruncationTestProxy returns a proxy whose first target writes half of a
+// JSON body and closes the connection, and the second one a result, which
+// hits are counted.
+func newTruncationTestProxy(t *testing.T) (*Proxy, *atomic.Int32) {
+	t.Helper()
+
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	truncating := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "64")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"res`)) // nolint:errcheck
+		w.(http.Flusher).Flush()
+
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(truncating.Close)
+
+	var hits atomic.Int32
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	t.Cleanup(working.Close)
+
+	config := createConfig()
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: truncating.URL}},
+		},
+		{
+			Name:       "Server2",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: working.URL}},
+		},
+	}
+
+	return newTestFailoverProxy(t, config), &hits
+}
+
+func TestHttpFailoverProxyReroutesTruncatedResponses(t *testing.T) {
+	p, hits := newTruncationTestProxy(t)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, rr.Body.String())
+	assert.Equal(t, int32(1), hits.Load())
+
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(p.metricRequestErrors.WithLabelValues("Server1", "truncated_response", "none", "")))
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(p.metricRequestErrors.WithLabelValues("Server1", "rerouted", "Server2", "")))
+}
+
+func TestHttpFailoverProxyDoesNotResendTruncatedWrites(t *testing.T) {
+	p, hits := newTruncationTestProxy(t)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x00"]}`)))
+
+	assert.Equal(t, http.StatusBadGateway, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"reason":"upstream_truncated_ambiguous"`)
+	assert.Contains(t, rr.Body.String(), "may or may not have been executed")
+	assert.Zero(t, hits.Load())
+
+	assert.Equal(t, 1.0,
+		testutil.ToFloat64(p.metricRequestErrors.WithLabelValues("Server1", "truncated_response", "none", "")))
+}
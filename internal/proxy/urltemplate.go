@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// resolveSecrets reads the secrets of a target from the environment.
+func (c NodeProviderConfig) resolveSecrets() (map[string]string, error) {
+	secrets := make(map[string]string, len(c.Secrets))
+
+	for name, env := range c.Secrets {
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			return nil, errors.Errorf("secret %q: environment variable %q is not set", name, env)
+		}
+
+		secrets[name] = value
+	}
+
+	return secrets, nil
+}
+
+func executeURLTemplate(text string, secrets map[string]string) (string, error) {
+	tmpl, err := template.New("url").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot parse template")
+	}
+
+	var b strings.Builder
+
+	if err := tmpl.Execute(&b, secrets); err != nil {
+		return "", errors.Wrap(err, "cannot execute template")
+	}
+
+	return b.String(), nil
+}
+
+// resolveURL returns the URL HTTP clients use to reach the node, with the
+// secrets and the query parameters filled in. It must never be logged.
+func (c NodeProviderConfig) resolveURL() (string, error) {
+	if c.Connection.isMock() {
+		return mockURL, nil
+	}
+
+	if c.Connection.isIPC() {
+		return ipcURL, nil
+	}
+
+	config := c.Connection.HTTP
+	if config.URLTemplate == "" && len(config.QueryParams) == 0 {
+		return normalizeTargetURL(config.URL)
+	}
+
+	secrets, err := c.resolveSecrets()
+	if err != nil {
+		return "", err
+	}
+
+	raw := config.URL
+	if config.URLTemplate != "" {
+		if raw, err = executeURLTemplate(config.URLTemplate, secrets); err != nil {
+			return "", errors.Wrap(err, "invalid urlTemplate")
+		}
+	}
+
+	normalized, err := normalizeTargetURL(raw)
+	if err != nil {
+		return "", err
+	}
+
+	target, err := url.Parse(normalized)
+	if err != nil {
+		return "", errors.Wrap(err, "cannot parse url")
+	}
+
+	query := target.Query()
+
+	for name, text := range config.QueryParams {
+		value, err := executeURLTemplate(text, secrets)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid queryParams %q", name)
+		}
+
+		query.Set(name, value)
+	}
+
+	target.RawQuery = query.Encode()
+
+	return target.String(), nil
+}
+
+// secretRedactor replaces the resolved secrets of a target with their
+// placeholders, so logs show the templates rather than the resolved URLs.
+// It returns nil when the target has no secrets.
+func (c NodeProviderConfig) secretRedactor() *strings.Replacer {
+	secrets, err := c.resolveSecrets()
+	if err != nil || len(secrets) == 0 {
+		return nil
+	}
+
+	var oldnew []string
+
+	for name, value := range secrets {
+		if value == "" {
+			continue
+		}
+
+		placeholder := fmt.Sprintf("{{ .%s }}", name)
+
+		oldnew = append(oldnew, value, placeholder)
+
+		// Query parameters are logged escaped.
+		//
+		if escaped := url.QueryEscape(value); escaped != value {
+			oldnew = append(oldnew, escaped, placeholder)
+		}
+	}
+
+	if len(oldnew) == 0 {
+		return nil
+	}
+
+	return strings.NewReplacer(oldnew...)
+}
+
+// redactingHandler redacts the messages and the string and error attributes
+// of the records before handing them to the next handler.
+type redactingHandler struct {
+	next     slog.Handler
+	redactor *strings.Replacer
+}
+
+// newRedactingLogger wraps the logger, unless there is nothing to redact.
+func newRedactingLogger(logger *slog.Logger, redactor *strings.Replacer) *slog.Logger {
+	if redactor == nil {
+		return logger
+	}
+
+	return slog.New(&redactingHandler{
+		next:     logger.Handler(),
+		redactor: redactor,
+	})
+}
+
+func (h *redactingHandler) Enabled(c context.Context, level slog.Level) bool {
+	return h.next.Enabled(c, level)
+}
+
+func (h *redactingHandler) Handle(c context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, h.redactor.Replace(record.Message), record.PC)
+
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(h.redact(attr))
+
+		return true
+	})
+
+	return h.next.Handle(c, redacted)
+}
+
+func (h *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redacted = append(redacted, h.redact(attr))
+	}
+
+	return &redactingHandler{
+		next:     h.next.WithAttrs(redacted),
+		redactor: h.redactor,
+	}
+}
+
+func (h *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{
+		next:     h.next.WithGroup(name),
+		redactor: h.redactor,
+	}
+}
+
+func (h *redactingHandler) redact(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, h.redactor.Replace(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+
+		redacted := make([]any, 0, len(group))
+		for _, attr := range group {
+			redacted = append(redacted, h.redact(attr))
+		}
+
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, h.redactor.Replace(err.Error()))
+		}
+	}
+
+	return slog.Attr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNodeProviderConfigResolveURL(t *testing.T) {
+	t.Setenv("RPC_GATEWAY_TEST_API_KEY", "s3cr3t/key")
+
+	config := NodeProviderConfig{
+		Name: "Alchemy",
+		Connection: NodeProviderConnectionConfig{
+			HTTP: NodeProviderConnectionHTTPConfig{
+				URLTemplate: "https://eth-mainnet.example.com/v2/{{ .APIKey }}?chain=1",
+				QueryParams: map[string]string{
+					"key":    "{{ .APIKey }}",
+					"source": "rpc-gateway",
+				},
+			},
+		},
+		Secrets: map[string]string{
+			"APIKey": "RPC_GATEWAY_TEST_API_KEY",
+		},
+	}
+
+	resolved, err := config.resolveURL()
+	assert.NoError(t, err)
+
+	target, err := url.Parse(resolved)
+	assert.NoError(t, err)
+	assert.Equal(t, "/v2/s3cr3t/key", target.Path)
+	assert.Equal(t, url.Values{
+		"chain":  {"1"},
+		"key":    {"s3cr3t/key"},
+		"source": {"rpc-gateway"},
+	}, target.Query())
+
+	t.Run("missing environment variable", func(t *testing.T) {
+		config := config
+		config.Secrets = map[string]string{"APIKey": "RPC_GATEWAY_TEST_MISSING"}
+
+		_, err := config.resolveURL()
+		assert.ErrorContains(t, err, "RPC_GATEWAY_TEST_MISSING")
+	})
+
+	t.Run("unknown placeholder", func(t *testing.T) {
+		config := config
+		config.Secrets = nil
+
+		_, err := config.resolveURL()
+		assert.Error(t, err)
+	})
+
+	t.Run("url and urlTemplate", func(t *testing.T) {
+		config := config
+		config.Connection.HTTP.URL = "https://eth-mainnet.example.com"
+
+		_, err := NewNodeProvider(config)
+		assert.Error(t, err)
+	})
+}
+
+func TestHttpFailoverProxyResolvesURLTemplate(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	t.Setenv("RPC_GATEWAY_TEST_API_KEY", "s3cr3t")
+
+	var upstream *url.URL
+
+	fakeRPCServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstream = r.URL
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x"}`))
+	}))
+	defer fakeRPCServer.Close()
+
+	rpcGatewayConfig := createConfig()
+	rpcGatewayConfig.Targets = []NodeProviderConfig{
+		{
+			Name: "Server1",
+			Connection: NodeProviderConnectionConfig{
+				HTTP: NodeProviderConnectionHTTPConfig{
+					URLTemplate: fakeRPCServer.URL + "/v2/{{ .APIKey }}",
+					QueryParams: map[string]string{
+						"key": "{{ .APIKey }}",
+					},
+				},
+			},
+			Secrets: map[string]string{
+				"APIKey": "RPC_GATEWAY_TEST_API_KEY",
+			},
+		},
+	}
+
+	httpFailoverProxy := newTestFailoverProxy(t, rpcGatewayConfig)
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_call"}`))
+	rr := httptest.NewRecorder()
+
+	httpFailoverProxy.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "/v2/s3cr3t", upstream.Path)
+	assert.Equal(t, "s3cr3t", upstream.Query().Get("key"))
+}
+
+func TestHealthCheckManagerRedactsSecrets(t *testing.T) {
+	t.Setenv("RPC_GATEWAY_TEST_API_KEY", "s3cr3t")
+
+	// Nothing listens on the address, so the checks fail and log the URL.
+	//
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	address := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	var logs bytes.Buffer
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: []NodeProviderConfig{
+			{
+				Name: "Server1",
+				Connection: NodeProviderConnectionConfig{
+					HTTP: NodeProviderConnectionHTTPConfig{
+						URLTemplate: "http://" + address + "/v2/{{ .APIKey }}",
+					},
+				},
+				Secrets: map[string]string{
+					"APIKey": "RPC_GATEWAY_TEST_API_KEY",
+				},
+			},
+		},
+		Logger:     slog.New(slog.NewTextHandler(&logs, nil)),
+		Registerer: prometheus.NewRegistry(),
+	})
+	assert.NoError(t, err)
+
+	hc, err := hcm.GetTargetByName("Server1")
+	assert.NoError(t, err)
+
+	_, err = hc.Check(context.Background())
+	assert.Error(t, err)
+
+	assert.Contains(t, logs.String(), "/v2/{{ .APIKey }}")
+	assert.NotContains(t, logs.String(), "s3cr3t")
+
+	assert.NoError(t, hcm.Stop(context.Background()))
+}
+
+func TestRedactingHandler(t *testing.T) {
+	t.Setenv("RPC_GATEWAY_TEST_API_KEY", "s3cr3t")
+
+	var logs bytes.Buffer
+
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+
+	// Targets without secrets keep the logger as is.
+	//
+	assert.Same(t, logger, newRedactingLogger(logger, NodeProviderConfig{}.secretRedactor()))
+
+	config := NodeProviderConfig{
+		Secrets: map[string]string{
+			"APIKey": "RPC_GATEWAY_TEST_API_KEY",
+		},
+	}
+
+	newRedactingLogger(logger, config.secretRedactor()).
+		With("url", "https://example.com/s3cr3t").
+		WithGroup("request").
+		Error("cannot reach s3cr3t",
+			"error", errors.New("dial s3cr3t"),
+			slog.Group("query", slog.String("key", "s3cr3t")))
+
+	assert.NotContains(t, logs.String(), "s3cr3t")
+	assert.Contains(t, logs.String(), `"url":"https://example.com/{{ .APIKey }}"`)
+	assert.Contains(t, logs.String(), `"msg":"cannot reach {{ .APIKey }}"`)
+	assert.Contains(t, logs.String(), `"error":"dial {{ .APIKey }}"`)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-http-utils/headers"
+)
+
+const (
+	// DefaultUserAgent identifies the proxied requests when no user agent is
+	// configured.
+	DefaultUserAgent = "rpc-gateway"
+
+	// ForwardedRequestIDHeader carries the request id of the gateway to the
+	// targets, so their support can find our requests in their logs.
+	ForwardedRequestIDHeader = "X-Forwarded-Request-Id"
+)
+
+// userAgent returns the user agent sent to the target, falling back to
+// defaultUserAgent.
+func (c NodeProviderConfig) userAgent(defaultUserAgent string) string {
+	if c.UserAgent != "" {
+		return c.UserAgent
+	}
+
+	return defaultUserAgent
+}
+
+// upstreamIdentity sets the headers identifying the gateway on the requests
+// sent to a target.
+type upstreamIdentity struct {
+	userAgent           string
+	passClientUserAgent bool
+	forwardRequestID    bool
+}
+
+func newUpstreamIdentity(config ProxyConfig, target NodeProviderConfig) upstreamIdentity {
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+
+	return upstreamIdentity{
+		userAgent:           target.userAgent(userAgent),
+		passClientUserAgent: config.PassClientUserAgent,
+		forwardRequestID:    config.ForwardRequestID,
+	}
+}
+
+// director wraps the director of a reverse proxy.
+func (i upstreamIdentity) director(next func(*http.Request)) func(*http.Request) {
+	return func(r *http.Request) {
+		next(r)
+
+		if !i.passClientUserAgent || r.Header.Get(headers.UserAgent) == "" {
+			r.Header.Set(headers.UserAgent, i.userAgent)
+		}
+
+		if !i.forwardRequestID {
+			return
+		}
+
+		// The header sent by the client is replaced or dropped, only the id
+		// of the request in the gateway is forwarded. It's the X-Request-Id
+		// of the client when it sent one, middleware.RequestID adopting it.
+		//
+		if id := middleware.GetReqID(r.Context()); id != "" {
+			r.Header.Set(ForwardedRequestIDHeader, id)
+		} else {
+			r.Header.Del(ForwardedRequestIDHeader)
+		}
+	}
+}
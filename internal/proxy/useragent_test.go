@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+// headerRecorder is a fake node remembering the headers of the last request
+// of every method.
+type headerRecorder struct {
+	mu      sync.Mutex
+	headers map[string]http.Header
+}
+
+func (h *headerRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req JSONRPCRequest
+
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	h.mu.Lock()
+	h.headers[req.Method] = r.Header.Clone()
+	h.mu.Unlock()
+
+	switch req.Method {
+	case "eth_call":
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`))
+	default:
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`))
+	}
+}
+
+func (h *headerRecorder) get(method, key string) string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.headers[method].Get(key)
+}
+
+func TestHttpFailoverProxyUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		proxy           ProxyConfig
+		target          string
+		clientUserAgent string
+		requestID       string
+		userAgent       string
+		forwardedID     string
+	}{
+		{
+			name:            "default",
+			clientUserAgent: "curl/8.0",
+			userAgent:       DefaultUserAgent,
+		},
+		{
+			name:            "configured",
+			proxy:           ProxyConfig{UserAgent: "rpc-gateway/v1.2.3"},
+			clientUserAgent: "curl/8.0",
+			userAgent:       "rpc-gateway/v1.2.3",
+		},
+		{
+			name:      "target override",
+			proxy:     ProxyConfig{UserAgent: "rpc-gateway/v1.2.3"},
+			target:    "acme-gateway",
+			userAgent: "acme-gateway",
+		},
+		{
+			name:            "client user agent",
+			proxy:           ProxyConfig{UserAgent: "rpc-gateway/v1.2.3", PassClientUserAgent: true},
+			clientUserAgent: "curl/8.0",
+			userAgent:       "curl/8.0",
+		},
+		{
+			name:      "missing client user agent",
+			proxy:     ProxyConfig{UserAgent: "rpc-gateway/v1.2.3", PassClientUserAgent: true},
+			userAgent: "rpc-gateway/v1.2.3",
+		},
+		{
+			name:        "request id",
+			proxy:       ProxyConfig{ForwardRequestID: true},
+			requestID:   "host/abc-000001",
+			userAgent:   DefaultUserAgent,
+			forwardedID: "host/abc-000001",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+			recorder := &headerRecorder{headers: map[string]http.Header{}}
+
+			node := httptest.NewServer(recorder)
+			defer node.Close()
+
+			config := createConfig()
+			config.Proxy.UserAgent = tc.proxy.UserAgent
+			config.Proxy.PassClientUserAgent = tc.proxy.PassClientUserAgent
+			config.Proxy.ForwardRequestID = tc.proxy.ForwardRequestID
+			config.Targets = []NodeProviderConfig{
+				{
+					Name: "Server1",
+					Connection: NodeProviderConnectionConfig{
+						HTTP: NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+					UserAgent: tc.target,
+				},
+			}
+
+			p := newTestFailoverProxy(t, config)
+
+			req := httptest.NewRequest(http.MethodPost, "/",
+				bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+			req.Header.Set("User-Agent", tc.clientUserAgent)
+			req.Header.Set(ForwardedRequestIDHeader, "spoofed")
+
+			if tc.requestID != "" {
+				req = req.WithContext(context.WithValue(req.Context(), middleware.RequestIDKey, tc.requestID))
+			}
+
+			rec := httptest.NewRecorder()
+			p.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tc.userAgent, recorder.get("eth_chainId", "User-Agent"))
+
+			if tc.proxy.ForwardRequestID {
+				assert.Equal(t, tc.forwardedID, recorder.get("eth_chainId", ForwardedRequestIDHeader))
+			}
+		})
+	}
+}
+
+func TestHttpFailoverProxyForwardsClientRequestID(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	recorder := &headerRecorder{headers: map[string]http.Header{}}
+
+	node := httptest.NewServer(recorder)
+	defer node.Close()
+
+	config := createConfig()
+	config.Proxy.ForwardRequestID = true
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:       "Server1",
+			Connection: NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: node.URL}},
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	req := httptest.NewRequest(http.MethodPost, "/",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+	req.Header.Set(middleware.RequestIDHeader, "client-id")
+	req.Header.Set(ForwardedRequestIDHeader, "spoofed")
+
+	rec := httptest.NewRecorder()
+	middleware.RequestID(p).ServeHTTP(rec, req)
+
+	// The id of the client becomes the one of the gateway, the header it
+	// set itself is replaced.
+	//
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "client-id", recorder.get("eth_chainId", ForwardedRequestIDHeader))
+}
+
+func TestHealthcheckerUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		userAgent string
+		expected  string
+	}{
+		{name: "default", expected: userAgent},
+		{name: "configured", userAgent: "rpc-gateway/v1.2.3", expected: "rpc-gateway/v1.2.3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &headerRecorder{headers: map[string]http.Header{}}
+
+			node := httptest.NewServer(recorder)
+			defer node.Close()
+
+			healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+				URL:       node.URL,
+				UserAgent: tc.userAgent,
+				Logger:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			assert.NoError(t, err)
+
+			_, err = healthchecker.Check(context.Background())
+			assert.NoError(t, err)
+
+			// eth_blockNumber goes through the rpc client, eth_call through
+			// the plain HTTP client.
+			//
+			assert.Equal(t, tc.expected, recorder.get("eth_blockNumber", "User-Agent"))
+			assert.Equal(t, tc.expected, recorder.get("eth_call", "User-Agent"))
+
+			assert.NoError(t, healthchecker.Stop(context.Background()))
+		})
+	}
+}
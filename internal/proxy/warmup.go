@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-http-utils/headers"
+)
+
+const (
+	// DefaultWarmUpRefreshInterval is how often warm connections are
+	// refreshed when no refreshInterval is configured. It's below the 90s
+	// idle timeout of the default transport.
+	DefaultWarmUpRefreshInterval = 60 * time.Second
+
+	warmUpTimeout = 5 * time.Second
+)
+
+// NodeProviderWarmUpConfig keeps connections to a target open ahead of
+// traffic, so the first requests don't pay for DNS, TCP and TLS handshakes.
+type NodeProviderWarmUpConfig struct {
+	// MinIdleConnections is the number of keep-alive connections opened when
+	// the target becomes healthy. Zero disables warm-up.
+	MinIdleConnections uint `yaml:"minIdleConnections"`
+
+	// RefreshInterval is how often the connections are used again, so the
+	// idle timeout doesn't close them. Defaults to 60s.
+	RefreshInterval time.Duration `yaml:"refreshInterval"`
+}
+
+// connectionWarmer opens keep-alive connections to a target with lightweight
+// `eth_chainId` calls. It shares the transport of the target's reverse proxy,
+// so proxied requests reuse the connections.
+type connectionWarmer struct {
+	name     string
+	url      string
+	client   *http.Client
+	count    int
+	interval time.Duration
+
+	// wake is signaled when the target becomes healthy.
+	wake chan struct{}
+}
+
+func newConnectionWarmer(target *NodeProvider) *connectionWarmer {
+	transport := target.Proxy.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	interval := target.Config.WarmUp.RefreshInterval
+	if interval <= 0 {
+		interval = DefaultWarmUpRefreshInterval
+	}
+
+	return &connectionWarmer{
+		name:     target.Name(),
+		url:      target.url,
+		client:   &http.Client{Transport: transport},
+		count:    int(target.Config.WarmUp.MinIdleConnections),
+		interval: interval,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Wake schedules a warm-up without blocking.
+func (w *connectionWarmer) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Warm issues concurrent calls, so the transport has to open one connection
+// per call. Failures are ignored, the health checks take care of them.
+func (w *connectionWarmer) Warm(c context.Context) {
+	c, cancel := context.WithTimeout(c, warmUpTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < w.count; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			w.call(c)
+		}()
+	}
+
+	wg.Wait()
+}
+
+func (w *connectionWarmer) call(c context.Context) {
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+
+	r, err := http.NewRequestWithContext(c, http.MethodPost, w.url, body)
+	if err != nil {
+		return
+	}
+
+	r.Header.Set(headers.ContentType, "application/json")
+	r.Header.Set(headers.UserAgent, userAgent)
+
+	resp, err := w.client.Do(r)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	// The body has to be drained for the connection to be reused.
+	//
+	_, _ = io.Copy(io.Discard, resp.Body)
+}
+
+// Run warms the connections while the target is healthy, whenever it becomes
+// healthy and then on every refresh interval, until the context is canceled.
+func (w *connectionWarmer) Run(c context.Context, isHealthy func(string) bool) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	if isHealthy(w.name) {
+		w.Warm(c)
+	}
+
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+
+		if isHealthy(w.name) {
+			w.Warm(c)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// slowStartInitialRatio is the share of its configured weight a target
+	// gets right after it recovers.
+	slowStartInitialRatio = 0.1
+)
+
+type weightedTarget struct {
+	Target *NodeProvider
+
+	// CurrentWeight is the smooth weighted round robin accumulator.
+	CurrentWeight float64
+	// EffectiveWeight is the weight used for picking, it's lower than the
+	// configured weight while the target is slow starting.
+	EffectiveWeight float64
+
+	healthy     bool
+	recoveredAt time.Time
+}
+
+// WeightedRoundRobin implements the smooth weighted round robin algorithm.
+// Targets that became healthy again are slow started: their effective weight
+// ramps linearly from a fraction of the configured weight to the configured
+// weight over the slow start window.
+type WeightedRoundRobin struct {
+	targets   []*weightedTarget
+	slowStart time.Duration
+
+	mu sync.Mutex
+}
+
+func NewWeightedRoundRobin(targets []*NodeProvider, slowStart time.Duration) *WeightedRoundRobin {
+	wrr := &WeightedRoundRobin{
+		slowStart: slowStart,
+	}
+
+	for _, target := range targets {
+		wrr.targets = append(wrr.targets, &weightedTarget{
+			Target:          target,
+			EffectiveWeight: float64(target.Weight()),
+			healthy:         true,
+		})
+	}
+
+	return wrr
+}
+
+func (w *WeightedRoundRobin) effectiveWeight(t *weightedTarget, now time.Time) float64 {
+	weight := float64(t.Target.Weight())
+
+	if w.slowStart <= 0 || t.recoveredAt.IsZero() {
+		return weight
+	}
+
+	elapsed := now.Sub(t.recoveredAt)
+	if elapsed >= w.slowStart {
+		return weight
+	}
+
+	ratio := slowStartInitialRatio + (1-slowStartInitialRatio)*float64(elapsed)/float64(w.slowStart)
+
+	return weight * ratio
+}
+
+// Next picks the next target among the healthy ones. The picked target is
+// returned first, followed by the remaining targets in the configured order,
+// so the caller can fail over.
+func (w *WeightedRoundRobin) Next(isHealthy func(string) bool, now time.Time) []*NodeProvider {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var (
+		best  *weightedTarget
+		total float64
+	)
+
+	for _, t := range w.targets {
+		healthy := isHealthy(t.Target.Name())
+		if healthy && !t.healthy {
+			t.recoveredAt = now
+		}
+		t.healthy = healthy
+
+		if !healthy {
+			continue
+		}
+
+		t.EffectiveWeight = w.effectiveWeight(t, now)
+		t.CurrentWeight += t.EffectiveWeight
+		total += t.EffectiveWeight
+
+		if best == nil || t.CurrentWeight > best.CurrentWeight {
+			best = t
+		}
+	}
+
+	candidates := make([]*NodeProvider, 0, len(w.targets))
+
+	if best != nil {
+		best.CurrentWeight -= total
+		candidates = append(candidates, best.Target)
+	}
+
+	for _, t := range w.targets {
+		if t != best {
+			candidates = append(candidates, t.Target)
+		}
+	}
+
+	return candidates
+}
+
+// EffectiveWeights returns the current effective weight of every target.
+func (w *WeightedRoundRobin) EffectiveWeights() map[string]float64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	weights := make(map[string]float64, len(w.targets))
+	for _, t := range w.targets {
+		weights[t.Target.Name()] = t.EffectiveWeight
+	}
+
+	return weights
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newWeightedTestProvider(name string, weight uint) (*NodeProvider, error) {
+	return NewNodeProvider(NodeProviderConfig{
+		Name:   name,
+		Weight: weight,
+		Connection: NodeProviderConnectionConfig{
+			HTTP: NodeProviderConnectionHTTPConfig{URL: "http://localhost:8545"},
+		},
+	})
+}
+
+func TestWeightedRoundRobinShare(t *testing.T) {
+	t.Parallel()
+
+	first, err := newWeightedTestProvider("Server1", 3)
+	assert.NoError(t, err)
+
+	second, err := newWeightedTestProvider("Server2", 0)
+	assert.NoError(t, err)
+
+	wrr := NewWeightedRoundRobin([]*NodeProvider{first, second}, time.Minute)
+	healthy := func(string) bool { return true }
+
+	picks := map[string]int{}
+	for i := 0; i < 400; i++ {
+		picks[wrr.Next(healthy, time.Now())[0].Name()]++
+	}
+
+	assert.Equal(t, 300, picks["Server1"])
+	assert.Equal(t, 100, picks["Server2"])
+}
+
+func TestWeightedRoundRobinSlowStart(t *testing.T) {
+	t.Parallel()
+
+	first, err := newWeightedTestProvider("Server1", 0)
+	assert.NoError(t, err)
+
+	second, err := newWeightedTestProvider("Server2", 0)
+	assert.NoError(t, err)
+
+	clock := newFakeClock()
+	wrr := NewWeightedRoundRobin([]*NodeProvider{first, second}, time.Minute)
+
+	// Server2 goes down and comes back.
+	//
+	wrr.Next(func(name string) bool { return name != "Server2" }, clock.Now())
+
+	healthy := func(string) bool { return true }
+	share := func() float64 {
+		picks := 0
+		for i := 0; i < 1000; i++ {
+			if wrr.Next(healthy, clock.Now())[0].Name() == "Server2" {
+				picks++
+			}
+		}
+
+		return float64(picks) / 1000
+	}
+
+	atStart := share()
+	assert.InDelta(t, 0.1, wrr.EffectiveWeights()["Server2"], 0.01)
+
+	clock.Advance(30 * time.Second)
+	halfway := share()
+
+	clock.Advance(30 * time.Second)
+	afterWindow := share()
+	assert.Equal(t, float64(1), wrr.EffectiveWeights()["Server2"])
+
+	assert.Less(t, atStart, 0.15)
+	assert.Greater(t, halfway, atStart)
+	assert.Greater(t, afterWindow, halfway)
+	assert.InDelta(t, 0.5, afterWindow, 0.01)
+
+	// Failover candidates always include every target.
+	//
+	assert.Len(t, wrr.Next(healthy, clock.Now()), 2)
+}
@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+const (
+	// WriteHealthCheckModeSendRawTransaction sends an invalid transaction
+	// and expects the node to reject it with a given validation error. Any
+	// other answer, e.g. a full txpool, fails the check.
+	WriteHealthCheckModeSendRawTransaction = "sendRawTransaction"
+	// WriteHealthCheckModeTxpoolStatus checks the size of the txpool
+	// reported by txpool_status.
+	WriteHealthCheckModeTxpoolStatus = "txpoolStatus"
+
+	// DefaultWriteHealthCheckTransaction is sent when no transaction is
+	// configured. It's too short to be a valid typed transaction.
+	DefaultWriteHealthCheckTransaction = "0x00"
+)
+
+// DefaultWriteMethodClasses returns the method classes requiring targets
+// able to accept transactions when none are configured.
+func DefaultWriteMethodClasses() []string {
+	return []string{"sends"}
+}
+
+// WriteHealthCheckConfig checks whether a target accepts transactions,
+// independently of its health for reads.
+type WriteHealthCheckConfig struct {
+	// Mode is either "sendRawTransaction" or "txpoolStatus". Empty disables
+	// the check, the target is then always considered able to write.
+	Mode string `yaml:"mode"`
+
+	// Transaction is the raw transaction sent in the "sendRawTransaction"
+	// mode. Defaults to "0x00".
+	Transaction string `yaml:"transaction"`
+	// ExpectedError has to be found in the error returned for Transaction.
+	ExpectedError string `yaml:"expectedError"`
+
+	// MaxPending and MaxQueued are the largest txpool sizes of a target
+	// accepting transactions in the "txpoolStatus" mode. Zero means
+	// unlimited.
+	MaxPending uint64 `yaml:"maxPending"`
+	MaxQueued  uint64 `yaml:"maxQueued"`
+}
+
+func (c WriteHealthCheckConfig) enabled() bool {
+	return c.Mode != ""
+}
+
+func (c WriteHealthCheckConfig) validate() error {
+	switch c.Mode {
+	case "", WriteHealthCheckModeTxpoolStatus:
+		return nil
+	case WriteHealthCheckModeSendRawTransaction:
+		if c.ExpectedError == "" {
+			return errors.New("expectedError is required by the sendRawTransaction write health check")
+		}
+
+		return nil
+	default:
+		return errors.Errorf("unknown write health check mode %q", c.Mode)
+	}
+}
+
+func (c WriteHealthCheckConfig) transaction() string {
+	if c.Transaction == "" {
+		return DefaultWriteHealthCheckTransaction
+	}
+
+	return c.Transaction
+}
+
+// checkWrite tells whether the target accepts transactions.
+func (h *HealthChecker) checkWrite(c context.Context) error {
+	start := time.Now()
+
+	switch h.config.Write.Mode {
+	case WriteHealthCheckModeSendRawTransaction:
+		err := h.checkSendRawTransaction(c)
+		h.observeProbe("eth_sendRawTransaction", start, err)
+
+		return err
+	case WriteHealthCheckModeTxpoolStatus:
+		err := h.checkTxpoolStatus(c)
+		h.observeProbe("txpool_status", start, err)
+
+		return err
+	default:
+		return nil
+	}
+}
+
+func (h *HealthChecker) checkSendRawTransaction(c context.Context) error {
+	var hash string
+
+	err := h.client.CallContext(c, &hash, "eth_sendRawTransaction", h.config.Write.transaction())
+	if err == nil {
+		return errors.New("the invalid transaction was accepted")
+	}
+
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return errors.Wrap(err, "cannot send the transaction")
+	}
+
+	if !strings.Contains(rpcErr.Error(), h.config.Write.ExpectedError) {
+		return errors.Errorf("unexpected transaction error: %s", rpcErr.Error())
+	}
+
+	return nil
+}
+
+func (h *HealthChecker) checkTxpoolStatus(c context.Context) error {
+	var status struct {
+		Pending hexutil.Uint64 `json:"pending"`
+		Queued  hexutil.Uint64 `json:"queued"`
+	}
+
+	if err := h.client.CallContext(c, &status, "txpool_status"); err != nil {
+		return errors.Wrap(err, "cannot get the txpool status")
+	}
+
+	if limit := h.config.Write.MaxPending; limit > 0 && uint64(status.Pending) > limit {
+		return errors.Errorf("%d pending transactions, more than %d", status.Pending, limit)
+	}
+
+	if limit := h.config.Write.MaxQueued; limit > 0 && uint64(status.Queued) > limit {
+		return errors.Errorf("%d queued transactions, more than %d", status.Queued, limit)
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWriteTestNode is a fake node answering the health checks, whose txpool
+// can be filled. Every other call is answered with name.
+func newWriteTestNode(t *testing.T, name string, txpoolFull *atomic.Bool) *httptest.Server {
+	t.Helper()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req JSONRPCRequest
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		switch {
+		case req.Method == "eth_call":
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x3b9ac9ff"}`))
+		case req.Method == "eth_sendRawTransaction" && string(req.Params) == `["0x00"]`:
+			if txpoolFull.Load() {
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"txpool is full"}}`))
+			} else {
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"typed transaction too short"}}`))
+			}
+		case req.Method == "txpool_status":
+			if txpoolFull.Load() {
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"pending":"0x1388","queued":"0x0"}}`))
+			} else {
+				w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"pending":"0x10","queued":"0x0"}}`))
+			}
+		default:
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"` + name + `"}`))
+		}
+	}))
+	t.Cleanup(node.Close)
+
+	return node
+}
+
+func TestHealthcheckerWriteChecks(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		write WriteHealthCheckConfig
+	}{
+		{
+			name: "sendRawTransaction",
+			write: WriteHealthCheckConfig{
+				Mode:          WriteHealthCheckModeSendRawTransaction,
+				ExpectedError: "typed transaction too short",
+			},
+		},
+		{
+			name: "txpoolStatus",
+			write: WriteHealthCheckConfig{
+				Mode:       WriteHealthCheckModeTxpoolStatus,
+				MaxPending: 1000,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var txpoolFull atomic.Bool
+
+			node := newWriteTestNode(t, "node", &txpoolFull)
+
+			healthchecker, err := NewHealthChecker(HealthCheckerConfig{
+				URL:     node.URL,
+				Timeout: time.Second,
+				Write:   tc.write,
+				Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+			})
+			require.NoError(t, err)
+
+			defer healthchecker.Stop(context.Background())
+
+			healthchecker.CheckAndSetHealth(context.Background())
+			assert.True(t, healthchecker.IsHealthy())
+			assert.True(t, healthchecker.IsWriteHealthy())
+
+			txpoolFull.Store(true)
+
+			healthchecker.CheckAndSetHealth(context.Background())
+			assert.True(t, healthchecker.IsHealthy())
+			assert.False(t, healthchecker.IsWriteHealthy())
+
+			txpoolFull.Store(false)
+
+			healthchecker.CheckAndSetHealth(context.Background())
+			assert.True(t, healthchecker.IsWriteHealthy())
+		})
+	}
+}
+
+func TestHttpFailoverProxyRoutesSendsToWriteHealthyTargets(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	var primaryTxpoolFull, secondaryTxpoolFull atomic.Bool
+
+	primary := newWriteTestNode(t, "primary", &primaryTxpoolFull)
+	secondary := newWriteTestNode(t, "secondary", &secondaryTxpoolFull)
+
+	write := NodeProviderHealthCheckConfig{
+		Write: WriteHealthCheckConfig{
+			Mode:          WriteHealthCheckModeSendRawTransaction,
+			ExpectedError: "typed transaction too short",
+		},
+	}
+
+	config := createConfig()
+	config.HealthChecks.Timeout = time.Second
+	config.Targets = []NodeProviderConfig{
+		{
+			Name:        "Server1",
+			Connection:  NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: primary.URL}},
+			HealthCheck: write,
+		},
+		{
+			Name:        "Server2",
+			Connection:  NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: secondary.URL}},
+			HealthCheck: write,
+		},
+	}
+
+	p := newTestFailoverProxy(t, config)
+
+	check := func() {
+		for _, name := range []string{"Server1", "Server2"} {
+			hc, err := p.hcm.GetTargetByName(name)
+			require.NoError(t, err)
+
+			hc.CheckAndSetHealth(context.Background())
+		}
+	}
+
+	call := func(method string) string {
+		body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":["0x02"]}`)
+
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+		return rec.Body.String()
+	}
+
+	primaryTxpoolFull.Store(true)
+	check()
+
+	assert.True(t, p.hcm.IsHealthy("Server1"))
+	assert.False(t, p.hcm.IsWriteHealthy("Server1"))
+	assert.True(t, p.hcm.IsWriteHealthy("Server2"))
+
+	assert.Contains(t, call("eth_blockNumber"), `"primary"`)
+	assert.Contains(t, call("eth_sendRawTransaction"), `"secondary"`)
+
+	primaryTxpoolFull.Store(false)
+	check()
+
+	assert.Contains(t, call("eth_sendRawTransaction"), `"primary"`)
+}
+
+func TestNewHealthCheckManagerRejectsInvalidWriteChecks(t *testing.T) {
+	for _, write := range []WriteHealthCheckConfig{
+		{Mode: "mempool"},
+		{Mode: WriteHealthCheckModeSendRawTransaction},
+	} {
+		_, err := NewHealthCheckManager(HealthCheckManagerConfig{
+			Targets: []NodeProviderConfig{
+				{
+					Name:        "Server1",
+					Connection:  NodeProviderConnectionConfig{HTTP: NodeProviderConnectionHTTPConfig{URL: "http://localhost:8545"}},
+					HealthCheck: NodeProviderHealthCheckConfig{Write: write},
+				},
+			},
+			Registerer: prometheus.NewRegistry(),
+			Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+		assert.Error(t, err, write.Mode)
+	}
+}
@@ -0,0 +1,396 @@
+package rpcgateway
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+// DefaultAdminHost is the address the admin API is bound to when no host is
+// configured, so it's only reachable from the machine itself.
+const DefaultAdminHost = "127.0.0.1"
+
+type AdminConfig struct {
+	// Port serves the admin API, disabled when empty. It must not be
+	// reachable by clients.
+	Port string `yaml:"port"`
+
+	// Host is the address the admin API is bound to. Defaults to
+	// 127.0.0.1, "0.0.0.0" binds every interface.
+	Host string `yaml:"host"`
+
+	// Token is the bearer token every request of the admin API must carry,
+	// it's required when the admin API is enabled. Environment variables
+	// are expanded, e.g. "${ADMIN_TOKEN}".
+	Token string `yaml:"token"`
+
+	// Unauthenticated serves the admin API without a token, as before
+	// tokens were introduced. It's only meant for networks where nothing
+	// else reaches the port.
+	Unauthenticated bool `yaml:"unauthenticated"`
+}
+
+func (c AdminConfig) enabled() bool {
+	return c.Port != ""
+}
+
+func (c AdminConfig) host() string {
+	if c.Host == "" {
+		return DefaultAdminHost
+	}
+
+	return c.Host
+}
+
+// token returns the token with its environment variables expanded. It fails
+// when the admin API is enabled without one, unless it's unauthenticated.
+func (c AdminConfig) token() (string, error) {
+	token, err := expandEnv(c.Token)
+	if err != nil {
+		return "", errors.Wrap(err, "admin token")
+	}
+
+	if c.enabled() && token == "" && !c.Unauthenticated {
+		return "", errors.New("admin token is required when the admin port is set, unless unauthenticated is set")
+	}
+
+	return token, nil
+}
+
+// adminProvider is the status of a target.
+type adminProvider struct {
+	Name    string `json:"name"`
+	State   string `json:"state"`
+	Healthy bool   `json:"healthy"`
+	Pending int64  `json:"pending"`
+
+	// WriteHealthy tells whether the provider accepts transactions.
+	WriteHealthy bool `json:"writeHealthy"`
+
+	// BlockNumber is the last one observed by the health checks, and
+	// BlockNumberAge how long ago it was.
+	BlockNumber    uint64 `json:"blockNumber,omitempty"`
+	BlockNumberAge string `json:"blockNumberAge,omitempty"`
+
+	LastError *proxy.RecentError `json:"lastError,omitempty"`
+	Taints    []proxy.Taint      `json:"taints,omitempty"`
+}
+
+// adminFaults is the JSON form of proxy.FaultConfig.
+type adminFaults struct {
+	Latency     string  `json:"latency"`
+	FailureRate float64 `json:"failureRate"`
+	ResetRate   float64 `json:"resetRate"`
+}
+
+func newAdminServer(config AdminConfig, token string, p *proxy.Proxy, hcm *proxy.HealthCheckManager) *http.Server {
+	// A token is checked whenever one is set.
+	//
+	handler := newAdminRouter(p, hcm)
+	if token != "" || !config.Unauthenticated {
+		handler = adminAuth(token, handler)
+	}
+
+	return &http.Server{
+		Addr:              net.JoinHostPort(config.host(), config.Port),
+		Handler:           handler,
+		WriteTimeout:      time.Second * 15,
+		ReadTimeout:       time.Second * 15,
+		ReadHeaderTimeout: time.Second * 5,
+	}
+}
+
+func newAdminRouter(p *proxy.Proxy, hcm *proxy.HealthCheckManager) http.Handler {
+	r := chi.NewRouter()
+
+	r.Get("/admin/providers", listAdminProviders(p, hcm))
+
+	// Only the memory of this replica and the shared backend are flushed,
+	// every replica has to be called.
+	//
+	r.Post("/admin/cache/flush", func(w http.ResponseWriter, r *http.Request) {
+		flush, err := p.FlushCache(r.Context(), r.URL.Query().Get("method"))
+		if err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		writeAdminJSON(w, http.StatusOK, flush)
+	})
+
+	r.Route("/admin/providers/{name}", func(r chi.Router) {
+		// Drains return immediately, the state of the target tells when
+		// it's done.
+		//
+		r.Post("/drain", func(w http.ResponseWriter, r *http.Request) {
+			timeout, err := adminDuration(r, "timeout")
+			if err != nil {
+				writeAdminError(w, err)
+
+				return
+			}
+
+			if err := p.Drain(chi.URLParam(r, "name"), timeout); err != nil {
+				writeAdminError(w, err)
+
+				return
+			}
+
+			w.WriteHeader(http.StatusAccepted)
+		})
+
+		r.Get("/errors", func(w http.ResponseWriter, r *http.Request) {
+			recent, err := p.RecentErrors(chi.URLParam(r, "name"))
+			if err != nil {
+				writeAdminError(w, err)
+
+				return
+			}
+
+			writeAdminJSON(w, http.StatusOK, recent)
+		})
+
+		adminTaintRoutes(r, hcm)
+		adminFaultRoutes(r, p)
+		adminResetRoutes(r, p, hcm)
+	})
+
+	return r
+}
+
+// adminAuth rejects the requests without the bearer token. The digests are
+// compared, so the comparison takes the same time whatever the length of
+// the token sent. An empty token rejects every request.
+func adminAuth(token string, next http.Handler) http.Handler {
+	expected := sha256.Sum256([]byte(token))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get(headers.Authorization), "Bearer ")
+		actual := sha256.Sum256([]byte(given))
+
+		if token == "" || !ok || subtle.ConstantTimeCompare(expected[:], actual[:]) != 1 {
+			w.Header().Set(headers.WWWAuthenticate, "Bearer")
+			writeAdminJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// listAdminProviders lists the targets from the snapshot of the health
+// checks, like the status page, along with their state in the proxy.
+func listAdminProviders(p *proxy.Proxy, hcm *proxy.HealthCheckManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targets := map[string]*proxy.NodeProvider{}
+		for _, target := range p.Targets() {
+			targets[target.Name()] = target
+		}
+
+		providers := []adminProvider{}
+
+		for _, snapshot := range hcm.Snapshot() {
+			provider := adminProvider{
+				Name:    snapshot.Name,
+				Healthy: snapshot.Healthy,
+				Taints:  snapshot.Taints,
+
+				WriteHealthy: snapshot.WriteHealthy,
+			}
+
+			if target, ok := targets[snapshot.Name]; ok {
+				provider.State = target.State()
+				provider.Pending = target.Pending()
+			}
+
+			if snapshot.BlockNumber > 0 {
+				provider.BlockNumber = snapshot.BlockNumber
+				provider.BlockNumberAge = snapshot.BlockNumberAge.Round(time.Millisecond).String()
+			}
+
+			if recent, err := p.RecentErrors(snapshot.Name); err == nil && len(recent) > 0 {
+				provider.LastError = &recent[0]
+			}
+
+			providers = append(providers, provider)
+		}
+
+		writeAdminJSON(w, http.StatusOK, providers)
+	}
+}
+
+func adminTaintRoutes(r chi.Router, hcm *proxy.HealthCheckManager) {
+	r.Get("/taints", func(w http.ResponseWriter, r *http.Request) {
+		taints, err := hcm.Taints(chi.URLParam(r, "name"))
+		if err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		writeAdminJSON(w, http.StatusOK, taints)
+	})
+
+	// Without a duration, the taint holds until it's deleted.
+	//
+	r.Put("/taints/{reason}", func(w http.ResponseWriter, r *http.Request) {
+		duration, err := adminDuration(r, "duration")
+		if err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		if err := hcm.Taint(chi.URLParam(r, "name"), chi.URLParam(r, "reason"), duration); err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Delete("/taints/{reason}", func(w http.ResponseWriter, r *http.Request) {
+		if err := hcm.Untaint(chi.URLParam(r, "name"), chi.URLParam(r, "reason")); err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func adminFaultRoutes(r chi.Router, p *proxy.Proxy) {
+	r.Get("/faults", func(w http.ResponseWriter, r *http.Request) {
+		faults, err := p.Faults(chi.URLParam(r, "name"))
+		if err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		writeAdminJSON(w, http.StatusOK, adminFaults{
+			Latency:     faults.Latency.String(),
+			FailureRate: faults.FailureRate,
+			ResetRate:   faults.ResetRate,
+		})
+	})
+
+	r.Put("/faults", func(w http.ResponseWriter, r *http.Request) {
+		var body adminFaults
+
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeAdminError(w, errors.Wrap(err, "invalid body"))
+
+			return
+		}
+
+		faults := proxy.FaultConfig{
+			FailureRate: body.FailureRate,
+			ResetRate:   body.ResetRate,
+		}
+
+		if body.Latency != "" {
+			latency, err := time.ParseDuration(body.Latency)
+			if err != nil {
+				writeAdminError(w, errors.Wrap(err, "invalid latency"))
+
+				return
+			}
+
+			faults.Latency = latency
+		}
+
+		if err := p.SetFaults(chi.URLParam(r, "name"), faults); err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Delete("/faults", func(w http.ResponseWriter, r *http.Request) {
+		if err := p.SetFaults(chi.URLParam(r, "name"), proxy.FaultConfig{}); err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func adminResetRoutes(r chi.Router, p *proxy.Proxy, hcm *proxy.HealthCheckManager) {
+	r.Post("/reset-window", func(w http.ResponseWriter, r *http.Request) {
+		reset, err := hcm.ResetWindows(chi.URLParam(r, "name"))
+		if err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		writeAdminJSON(w, http.StatusOK, reset)
+	})
+
+	r.Post("/reset-errors", func(w http.ResponseWriter, r *http.Request) {
+		reset, err := p.ResetErrors(chi.URLParam(r, "name"))
+		if err != nil {
+			writeAdminError(w, err)
+
+			return
+		}
+
+		writeAdminJSON(w, http.StatusOK, reset)
+	})
+}
+
+// adminDuration parses the duration query parameter of the given key, zero
+// when it's missing.
+func adminDuration(r *http.Request, key string) (time.Duration, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid %s", key)
+	}
+
+	return duration, nil
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set(headers.ContentType, "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(v) // nolint:errcheck
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+
+	switch {
+	case errors.Is(err, proxy.ErrTargetNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, proxy.ErrFaultInjectionDisabled), errors.Is(err, proxy.ErrImmutableCacheDisabled):
+		status = http.StatusConflict
+	case errors.Is(err, proxy.ErrProxyClosed):
+		status = http.StatusServiceUnavailable
+	}
+
+	writeAdminJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,730 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAdminToken = "secret"
+
+// newAdminRequest returns a request to the admin API carrying the token.
+func newAdminRequest(method, path string, body io.Reader) *http.Request {
+	r := httptest.NewRequest(method, path, body)
+	r.Header.Set("Authorization", "Bearer "+testAdminToken)
+
+	return r
+}
+
+func newCountingNode(t testing.TB, calls *atomic.Int64) *httptest.Server {
+	t.Helper()
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	t.Cleanup(node.Close)
+
+	return node
+}
+
+func TestAdminTogglesFaultsMidTraffic(t *testing.T) {
+	var primaryCalls, secondaryCalls atomic.Int64
+
+	primary := newCountingNode(t, &primaryCalls)
+	secondary := newCountingNode(t, &secondaryCalls)
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+				FaultInjection: proxy.FaultInjectionConfig{
+					Enabled:     true,
+					AllowUnsafe: true,
+				},
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "primary",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: primary.URL,
+						},
+					},
+				},
+				{
+					Name: "secondary",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: secondary.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	admin := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.admin.Handler.ServeHTTP(rec, newAdminRequest(method, path, bytes.NewBufferString(body)))
+
+		return rec
+	}
+
+	var (
+		wg      sync.WaitGroup
+		stop    = make(chan struct{})
+		failed  atomic.Int64
+		traffic = func() {
+			defer wg.Done()
+
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+				rec := httptest.NewRecorder()
+
+				gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+				if rec.Code != http.StatusOK {
+					failed.Add(1)
+				}
+			}
+		}
+	)
+
+	wg.Add(1)
+
+	go traffic()
+
+	assert.Eventually(t, func() bool { return primaryCalls.Load() > 0 }, time.Second, time.Millisecond)
+
+	rec := admin(http.MethodPut, "/admin/providers/primary/faults", `{"failureRate":1}`)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = admin(http.MethodGet, "/admin/providers/primary/faults", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"latency":"0s","failureRate":1,"resetRate":0}`, rec.Body.String())
+
+	// Requests still succeed, they are rerouted to the secondary.
+	//
+	assert.Eventually(t, func() bool { return secondaryCalls.Load() > 10 }, time.Second, time.Millisecond)
+
+	served := primaryCalls.Load()
+
+	rec = admin(http.MethodDelete, "/admin/providers/primary/faults", "")
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	assert.Eventually(t, func() bool { return primaryCalls.Load() > served }, time.Second, time.Millisecond)
+
+	close(stop)
+	wg.Wait()
+
+	assert.Zero(t, failed.Load())
+}
+
+func TestAdminFaultsErrors(t *testing.T) {
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: "http://127.0.0.1:1",
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"disabled", http.MethodPut, "/admin/providers/upstream/faults", `{"failureRate":1}`, http.StatusConflict},
+		{"unknown target", http.MethodGet, "/admin/providers/unknown/faults", "", http.StatusNotFound},
+		{"invalid body", http.MethodPut, "/admin/providers/upstream/faults", `{`, http.StatusBadRequest},
+		{"invalid latency", http.MethodPut, "/admin/providers/upstream/faults", `{"latency":"soon"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			gw.admin.Handler.ServeHTTP(rec, newAdminRequest(tt.method, tt.path, bytes.NewBufferString(tt.body)))
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Contains(t, rec.Body.String(), `"error"`)
+		})
+	}
+}
+
+func TestNewRPCGatewayRefusesUnsafeFaultInjection(t *testing.T) {
+	_, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				FaultInjection: proxy.FaultInjectionConfig{Enabled: true},
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name:       "mock",
+					Connection: proxy.NodeProviderConnectionConfig{Mock: &proxy.NodeProviderConnectionMockConfig{}},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+	)
+	assert.ErrorContains(t, err, "fault injection")
+}
+
+func TestAdminDrainsProvider(t *testing.T) {
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "primary",
+					Connection: proxy.NodeProviderConnectionConfig{
+						Mock: &proxy.NodeProviderConnectionMockConfig{DefaultResult: "primary"},
+					},
+				},
+				{
+					Name: "secondary",
+					Connection: proxy.NodeProviderConnectionConfig{
+						Mock: &proxy.NodeProviderConnectionMockConfig{DefaultResult: "secondary"},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.admin.Handler.ServeHTTP(rec, newAdminRequest(method, path, nil))
+
+		return rec
+	}
+
+	rec := admin(http.MethodPost, "/admin/providers/primary/drain?timeout=1s")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+
+	assert.Eventually(t, func() bool {
+		rec := admin(http.MethodGet, "/admin/providers")
+
+		return rec.Body.String() == `[{"name":"primary","state":"drained","healthy":true,"pending":0,"writeHealthy":true},`+
+			`{"name":"secondary","state":"active","healthy":true,"pending":0,"writeHealthy":true}]`+"\n"
+	}, time.Second, time.Millisecond)
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	rec = httptest.NewRecorder()
+
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"secondary"}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPost, "/admin/providers/unknown/drain").Code)
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPost, "/admin/providers/secondary/drain?timeout=soon").Code)
+}
+
+func TestAdminListsRecentErrors(t *testing.T) {
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: "http://127.0.0.1:1",
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	rec := httptest.NewRecorder()
+
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	rec = httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, newAdminRequest(http.MethodGet, "/admin/providers/upstream/errors", nil))
+
+	var recent []proxy.RecentError
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &recent))
+	assert.Len(t, recent, 1)
+	assert.Equal(t, "eth_blockNumber", recent[0].Method)
+	assert.Equal(t, http.StatusBadGateway, recent[0].StatusCode)
+	assert.Contains(t, recent[0].Error, "connection refused")
+
+	rec = httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, newAdminRequest(http.MethodGet, "/admin/providers", nil))
+
+	assert.Contains(t, rec.Body.String(), `"lastError":{`)
+
+	rec = httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, newAdminRequest(http.MethodGet, "/admin/providers/unknown/errors", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAdminListsBlockNumbers(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval: time.Second,
+				Timeout:  time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	hc, err := gw.hcm.GetTargetByName("upstream")
+	assert.NoError(t, err)
+
+	hc.CheckAndSetHealth(context.Background())
+
+	rec := httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, newAdminRequest(http.MethodGet, "/admin/providers", nil))
+
+	var providers []struct {
+		BlockNumber    uint64 `json:"blockNumber"`
+		BlockNumberAge string `json:"blockNumberAge"`
+	}
+
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &providers))
+	assert.Len(t, providers, 1)
+	assert.Equal(t, uint64(1), providers[0].BlockNumber)
+
+	age, err := time.ParseDuration(providers[0].BlockNumberAge)
+	assert.NoError(t, err)
+	assert.Less(t, age, time.Second)
+
+	assert.NoError(t, gw.hcm.Stop(context.Background()))
+}
+
+func TestAdminTaintsProvider(t *testing.T) {
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "primary",
+					Connection: proxy.NodeProviderConnectionConfig{
+						Mock: &proxy.NodeProviderConnectionMockConfig{DefaultResult: "primary"},
+					},
+				},
+				{
+					Name: "secondary",
+					Connection: proxy.NodeProviderConnectionConfig{
+						Mock: &proxy.NodeProviderConnectionMockConfig{DefaultResult: "secondary"},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.admin.Handler.ServeHTTP(rec, newAdminRequest(method, path, nil))
+
+		return rec
+	}
+
+	call := func() string {
+		body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+		rec := httptest.NewRecorder()
+
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+		return rec.Body.String()
+	}
+
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodPut, "/admin/providers/primary/taints/manual").Code)
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodPut, "/admin/providers/primary/taints/block_lag?duration=1h").Code)
+
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"secondary"}`, call())
+
+	var taints []proxy.Taint
+
+	rec := admin(http.MethodGet, "/admin/providers/primary/taints")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &taints))
+	assert.Len(t, taints, 2)
+	assert.Equal(t, proxy.TaintReasonBlockLag, taints[0].Reason)
+	assert.NotNil(t, taints[0].Until)
+	assert.Equal(t, proxy.TaintReasonManual, taints[1].Reason)
+	assert.Nil(t, taints[1].Until)
+
+	assert.Contains(t, admin(http.MethodGet, "/admin/providers").Body.String(), `"taints":[{"reason":"block_lag"`)
+
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/admin/providers/primary/taints/manual").Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"secondary"}`, call())
+
+	assert.Equal(t, http.StatusNoContent, admin(http.MethodDelete, "/admin/providers/primary/taints/block_lag").Code)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"primary"}`, call())
+
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "/admin/providers/primary/taints/bored").Code)
+	assert.Equal(t, http.StatusBadRequest, admin(http.MethodPut, "/admin/providers/primary/taints/manual?duration=soon").Code)
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPut, "/admin/providers/unknown/taints/manual").Code)
+}
+
+func TestAdminFlushesCache(t *testing.T) {
+	var calls atomic.Int64
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"hash":"0xaa","number":"0x10"}}`))
+	}))
+	t.Cleanup(node.Close)
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+				ImmutableCache:  proxy.ImmutableCacheConfig{MaxEntries: 10},
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	call := func() {
+		body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_getBlockByHash","params":["0xaa",false]}`)
+		rec := httptest.NewRecorder()
+
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+		assert.Equal(t, http.StatusOK, rec.Code)
+	}
+
+	flush := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.admin.Handler.ServeHTTP(rec, newAdminRequest(http.MethodPost, "/admin/cache/flush"+query, nil))
+
+		return rec
+	}
+
+	call()
+	call()
+	assert.Equal(t, int64(1), calls.Load())
+
+	// Flushing another method keeps the result.
+	//
+	rec := flush("?method=eth_getTransactionReceipt")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"method":"eth_getTransactionReceipt","local":0,"remote":0}`, rec.Body.String())
+
+	call()
+	assert.Equal(t, int64(1), calls.Load())
+
+	rec = flush("?method=eth_getBlockByHash")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"method":"eth_getBlockByHash","local":1,"remote":0}`, rec.Body.String())
+
+	call()
+	call()
+	assert.Equal(t, int64(2), calls.Load())
+
+	rec = flush("")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"local":1,"remote":0}`, rec.Body.String())
+
+	call()
+	assert.Equal(t, int64(3), calls.Load())
+}
+
+func TestAdminFlushesDisabledCache(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	rec := httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, newAdminRequest(http.MethodPost, "/admin/cache/flush", nil))
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+}
+
+func TestAdminResetsWindowsAndErrors(t *testing.T) {
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Admin: AdminConfig{Token: testAdminToken},
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: "http://127.0.0.1:1",
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	admin := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		gw.admin.Handler.ServeHTTP(rec, newAdminRequest(method, path, nil))
+
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+		rec := httptest.NewRecorder()
+
+		gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	}
+
+	window, err := gw.hcm.GetRollingWindowByName("upstream")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, window.Len())
+	assert.Equal(t, 0.0, window.Avg())
+
+	rec := admin(http.MethodPost, "/admin/providers/upstream/reset-window")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"observations":2,"classes":{"reads":2}}`, rec.Body.String())
+
+	assert.Zero(t, window.Len())
+
+	classWindow, err := gw.hcm.GetClassRollingWindowByName("upstream", proxy.DefaultMethodClass)
+	assert.NoError(t, err)
+	assert.Zero(t, classWindow.Len())
+
+	rec = admin(http.MethodPost, "/admin/providers/upstream/reset-errors")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"recentErrors":2,"consecutiveFailures":2,"permanentFailures":0}`, rec.Body.String())
+
+	assert.JSONEq(t, `[]`, admin(http.MethodGet, "/admin/providers/upstream/errors").Body.String())
+
+	// The next observation starts the average over.
+	//
+	gw.hcm.ObserveSuccess("upstream", proxy.DefaultMethodClass)
+	assert.Equal(t, 1.0, window.Avg())
+
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPost, "/admin/providers/unknown/reset-window").Code)
+	assert.Equal(t, http.StatusNotFound, admin(http.MethodPost, "/admin/providers/unknown/reset-errors").Code)
+}
+
+func TestAdminRequiresToken(t *testing.T) {
+	t.Setenv("TEST_GATEWAY_ADMIN_TOKEN", testAdminToken)
+
+	node := newFakeNode(t)
+	defer node.Close()
+
+	config := RPCGatewayConfig{
+		Admin: AdminConfig{Port: "0", Token: "${TEST_GATEWAY_ADMIN_TOKEN}"},
+		Proxy: proxy.ProxyConfig{
+			UpstreamTimeout: time.Second,
+		},
+		Targets: []proxy.NodeProviderConfig{
+			{
+				Name: "upstream",
+				Connection: proxy.NodeProviderConnectionConfig{
+					HTTP: proxy.NodeProviderConnectionHTTPConfig{
+						URL: node.URL,
+					},
+				},
+			},
+		},
+	}
+
+	gw, err := NewRPCGateway(config,
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:0", gw.admin.Addr)
+
+	for _, authorization := range []string{"", "Bearer", "Bearer wrong", "Basic " + testAdminToken, testAdminToken} {
+		req := httptest.NewRequest(http.MethodPost, "/admin/cache/flush", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		rec := httptest.NewRecorder()
+		gw.admin.Handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rec.Code, authorization)
+		assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	}
+
+	rec := httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, newAdminRequest(http.MethodGet, "/admin/providers", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	config.Admin.Token = ""
+
+	_, err = NewRPCGateway(config,
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.ErrorContains(t, err, "admin token is required")
+
+	config.Admin.Token = "${TEST_GATEWAY_UNSET}"
+
+	_, err = NewRPCGateway(config,
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.ErrorContains(t, err, `environment variable "TEST_GATEWAY_UNSET" is not set`)
+
+	// The opt-out serves it without a token, as before tokens.
+	//
+	config.Admin.Token = ""
+	config.Admin.Unauthenticated = true
+
+	gw, err = NewRPCGateway(config,
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/providers", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// A token set is checked all the same.
+	//
+	config.Admin.Token = testAdminToken
+
+	gw, err = NewRPCGateway(config,
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	rec = httptest.NewRecorder()
+	gw.admin.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/providers", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
+
+func TestAdminRejectsEveryRequestWithoutToken(t *testing.T) {
+	rec := httptest.NewRecorder()
+	adminAuth("", http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer ")
+
+	rec = httptest.NewRecorder()
+	adminAuth("", http.NotFoundHandler()).ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+}
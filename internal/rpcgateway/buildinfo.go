@@ -0,0 +1,41 @@
+package rpcgateway
+
+import (
+	"net/http"
+
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
+	"github.com/go-http-utils/headers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// registerBuildInfo exports the build as a gauge always set to 1, so it can
+// be joined with the other metrics.
+func registerBuildInfo(registerer prometheus.Registerer, namespace string, build buildinfo.Info) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+
+	promauto.With(registerer).NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "rpc_gateway_build_info",
+			Help:      "The build of the gateway, always 1",
+		}, []string{
+			"version",
+			"commit",
+		}).WithLabelValues(build.Version, build.Commit).Set(1)
+}
+
+// serverHeader sets the Server header of the responses to the version of the
+// gateway.
+func serverHeader(build buildinfo.Info) func(http.Handler) http.Handler {
+	value := "rpc-gateway/" + build.Version
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set(headers.Server, value)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBuildInfoTestGateway(t *testing.T, url string, serverHeader *bool, registry *prometheus.Registry) *RPCGateway {
+	t.Helper()
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+				ServerHeader:    serverHeader,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval: time.Second,
+				Timeout:  time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: url,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(registry),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithBuildInfo(buildinfo.Info{Version: "v1.2.3", Commit: "abc123", Date: "2024-01-01"}),
+	)
+	require.NoError(t, err)
+
+	return gw
+}
+
+func TestRPCGatewayReportsBuildInfo(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	registry := prometheus.NewRegistry()
+	gw := newBuildInfoTestGateway(t, node.URL, nil, registry)
+
+	expected := `
+# HELP zeroex_rpc_gateway_build_info The build of the gateway, always 1
+# TYPE zeroex_rpc_gateway_build_info gauge
+zeroex_rpc_gateway_build_info{commit="abc123",version="v1.2.3"} 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"zeroex_rpc_gateway_build_info"))
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	rec := httptest.NewRecorder()
+
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+	assert.Equal(t, "rpc-gateway/v1.2.3", rec.Header().Get("Server"))
+}
+
+func TestRPCGatewayWithoutServerHeader(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	disabled := false
+	gw := newBuildInfoTestGateway(t, node.URL, &disabled, prometheus.NewRegistry())
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+	rec := httptest.NewRecorder()
+
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+	assert.Empty(t, rec.Header().Get("Server"))
+}
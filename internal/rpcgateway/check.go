@@ -0,0 +1,187 @@
+package rpcgateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/carlmjohnson/flowmatic"
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+// checkMetricsTimeout bounds how long Check waits for the metrics server.
+const checkMetricsTimeout = 5 * time.Second
+
+// CheckResult summarizes what Check went through, as far as it went.
+type CheckResult struct {
+	// Healthy and Unhealthy list the targets after their first health
+	// check.
+	Healthy   []string
+	Unhealthy []string
+
+	// Provider is the target that served the eth_chainId request, ChainID
+	// its result.
+	Provider string
+	ChainID  string
+
+	// MetricsAddr is the loopback address the metrics were served on.
+	MetricsAddr string
+
+	Duration time.Duration
+}
+
+func (r CheckResult) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "healthy targets: %s\n", strings.Join(r.Healthy, ", "))
+	fmt.Fprintf(&b, "unhealthy targets: %s\n", strings.Join(r.Unhealthy, ", "))
+
+	if r.ChainID != "" {
+		fmt.Fprintf(&b, "eth_chainId: %s, served by %s\n", r.ChainID, r.Provider)
+	}
+
+	if r.MetricsAddr != "" {
+		fmt.Fprintf(&b, "metrics: served on %s\n", r.MetricsAddr)
+	}
+
+	fmt.Fprintf(&b, "took %s\n", r.Duration.Round(time.Millisecond))
+
+	return b.String()
+}
+
+// forCheck returns the config of a gateway created for Check.
+func (c RPCGatewayConfig) forCheck() RPCGatewayConfig {
+	c.Metrics.Host = "127.0.0.1"
+	c.Metrics.Port = 0
+	c.Proxy.DebugTrace = proxy.DebugTraceConfig{Enabled: true}
+
+	return c
+}
+
+// Check tests the gateway end to end, before it's rolled out: the health
+// checks, the proxy and the metrics are started, and once the targets went
+// through their first health check, an eth_chainId request is sent through
+// the middlewares and the proxy, to the target the proxy picks. The proxy
+// and admin ports are never bound. The gateway has to be created
+// WithCheckMode, and is stopped when Check returns.
+func (r *RPCGateway) Check(c context.Context) (CheckResult, error) {
+	if !r.check {
+		return CheckResult{}, errors.New("rpc-gateway not created with WithCheckMode")
+	}
+
+	start := time.Now()
+
+	c, cancel := context.WithCancel(c)
+	defer cancel()
+
+	var result CheckResult
+
+	err := flowmatic.Do(
+		func() error {
+			return errors.Wrap(r.hcm.Start(c), "failed to start health check manager")
+		},
+		func() error {
+			return errors.Wrap(r.proxy.Start(c), "failed to start proxy")
+		},
+		func() error {
+			return errors.Wrap(r.metrics.Start(), "failed to start metrics server")
+		},
+		func() error {
+			defer r.metrics.Stop() // nolint:errcheck
+			defer cancel()
+
+			return r.runCheck(c, &result)
+		},
+	)
+
+	result.Duration = time.Since(start)
+
+	return result, err
+}
+
+// runCheck goes through the steps of Check, filling result along.
+func (r *RPCGateway) runCheck(c context.Context, result *CheckResult) error {
+	if err := r.hcm.AwaitFirstChecks(c); err != nil {
+		return errors.Wrap(err, "health checks failed")
+	}
+
+	for _, target := range r.config.Targets {
+		if r.hcm.IsHealthy(target.Name) {
+			result.Healthy = append(result.Healthy, target.Name)
+		} else {
+			result.Unhealthy = append(result.Unhealthy, target.Name)
+		}
+	}
+
+	if len(result.Healthy) == 0 {
+		return errors.New("no healthy target")
+	}
+
+	req, err := http.NewRequestWithContext(c, http.MethodPost, "/", strings.NewReader(chainIDRequest))
+	if err != nil {
+		return errors.Wrap(err, "cannot create eth_chainId request")
+	}
+
+	req.Header.Set(headers.ContentType, "application/json")
+	req.Header.Set(proxy.DebugHeader, proxy.DebugHeaderTrace)
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	var trace proxy.RequestTrace
+	if err := json.Unmarshal([]byte(rec.Header().Get(proxy.TraceHeader)), &trace); err == nil && len(trace.Attempts) > 0 {
+		result.Provider = trace.Attempts[len(trace.Attempts)-1].Provider
+	}
+
+	if rec.Code != http.StatusOK {
+		return errors.Errorf("eth_chainId failed, got %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+
+	chainID, err := readChainID(rec.Body)
+	if err != nil {
+		return err
+	}
+
+	result.ChainID = chainID
+
+	return r.checkMetrics(c, result)
+}
+
+// checkMetrics scrapes the metrics server.
+func (r *RPCGateway) checkMetrics(c context.Context, result *CheckResult) error {
+	c, cancel := context.WithTimeout(c, checkMetricsTimeout)
+	defer cancel()
+
+	for r.metrics.Addr() == nil {
+		select {
+		case <-c.Done():
+			return errors.Wrap(c.Err(), "metrics not served")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	result.MetricsAddr = r.metrics.Addr().String()
+
+	req, err := http.NewRequestWithContext(c, http.MethodGet, "http://"+result.MetricsAddr+"/metrics", nil)
+	if err != nil {
+		return errors.Wrap(err, "cannot create metrics request")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot scrape metrics")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("cannot scrape metrics, got %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package rpcgateway
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCheckTestGateway(t *testing.T, urls ...string) *RPCGateway {
+	t.Helper()
+
+	targets := make([]proxy.NodeProviderConfig, 0, len(urls))
+	for i, url := range urls {
+		targets = append(targets, proxy.NodeProviderConfig{
+			Name: []string{"primary", "secondary"}[i],
+			Connection: proxy.NodeProviderConnectionConfig{
+				HTTP: proxy.NodeProviderConnectionHTTPConfig{URL: url},
+			},
+		})
+	}
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval:       time.Hour,
+				Timeout:        time.Second,
+				StartupTimeout: 2 * time.Second,
+			},
+			Targets: targets,
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		WithCheckMode(),
+	)
+	require.NoError(t, err)
+
+	return gw
+}
+
+func TestCheck(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	gw := newCheckTestGateway(t, "http://127.0.0.1:1", node.URL)
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := gw.Check(c)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"secondary"}, result.Healthy)
+	assert.Equal(t, []string{"primary"}, result.Unhealthy)
+	assert.Equal(t, "secondary", result.Provider)
+	assert.Equal(t, "0x1", result.ChainID)
+	assert.True(t, strings.HasPrefix(result.MetricsAddr, "127.0.0.1:"), result.MetricsAddr)
+	assert.Contains(t, result.String(), "eth_chainId: 0x1, served by secondary")
+}
+
+func TestCheckFails(t *testing.T) {
+	// Healthy, but failing eth_chainId.
+	//
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "eth_chainId") {
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,"message":"method not found"}}`)) // nolint:errcheck
+
+			return
+		}
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	defer failing.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		err  string
+	}{
+		{"unreachable", "http://127.0.0.1:1", "no healthy target"},
+		{"chain id error", failing.URL, "eth_chainId failed: method not found"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newCheckTestGateway(t, tt.url)
+
+			c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := gw.Check(c)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestCheckNeedsCheckMode(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	gw := newBuildInfoTestGateway(t, node.URL, nil, prometheus.NewRegistry())
+
+	_, err := gw.Check(context.Background())
+	assert.ErrorContains(t, err, "WithCheckMode")
+}
@@ -1,8 +1,19 @@
 package rpcgateway
 
 import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/0xProject/rpc-gateway/internal/metrics"
 	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 type RPCGatewayConfig struct { //nolint:revive
@@ -10,4 +21,181 @@ type RPCGatewayConfig struct { //nolint:revive
 	Proxy        proxy.ProxyConfig          `yaml:"proxy"`
 	HealthChecks proxy.HealthCheckConfig    `yaml:"healthChecks"`
 	Targets      []proxy.NodeProviderConfig `yaml:"targets"`
+	Admin        AdminConfig                `yaml:"admin"`
+	Listener     ListenerConfig             `yaml:"listener"`
+
+	// TargetsDir is a directory of *.yml files of targets, appended to
+	// Targets in the order of their file names. Relative paths are relative
+	// to the configuration file, or to the working directory for remote
+	// ones. Invalid files are skipped, unless StrictTargetsDir is set.
+	TargetsDir       string `yaml:"targetsDir"`
+	StrictTargetsDir bool   `yaml:"strictTargetsDir"`
+
+	// LogLevel is "debug", "info", "warn" or "error". Defaults to "warn",
+	// or "debug" when the DEBUG environment variable is "true".
+	LogLevel string `yaml:"logLevel"`
+}
+
+// logLevel returns the level of the configured LogLevel.
+func (c RPCGatewayConfig) logLevel() (slog.Level, error) {
+	if c.LogLevel == "" {
+		if os.Getenv("DEBUG") == "true" {
+			return slog.LevelDebug, nil
+		}
+
+		return slog.LevelWarn, nil
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return level, errors.Errorf("unknown log level %q, expected debug, info, warn or error", c.LogLevel)
+	}
+
+	return level, nil
+}
+
+// ConfigOverrides replaces values of the configuration file, e.g. with
+// command line flags. Zero values keep the values of the file.
+type ConfigOverrides struct {
+	Port            string
+	MetricsPort     *uint
+	LogLevel        string
+	UpstreamTimeout time.Duration
+}
+
+// Apply returns config with the overrides applied. It fails when the result
+// is inconsistent, like the proxy and the metrics sharing a port.
+func (o ConfigOverrides) Apply(config RPCGatewayConfig) (RPCGatewayConfig, error) {
+	if o.Port != "" {
+		config.Proxy.Port = o.Port
+	}
+
+	if o.MetricsPort != nil {
+		config.Metrics.Port = *o.MetricsPort
+	}
+
+	if o.LogLevel != "" {
+		config.LogLevel = o.LogLevel
+	}
+
+	if o.UpstreamTimeout < 0 {
+		return config, errors.New("upstream timeout can't be negative")
+	}
+
+	if o.UpstreamTimeout > 0 {
+		config.Proxy.UpstreamTimeout = o.UpstreamTimeout
+	}
+
+	if _, err := config.logLevel(); err != nil {
+		return config, err
+	}
+
+	// Port 0 picks an ephemeral port, which never conflicts.
+	//
+	ports := map[string]string{}
+
+	for _, listener := range []struct{ name, port string }{
+		{"proxy", config.Proxy.Port},
+		{"metrics", strconv.FormatUint(uint64(config.Metrics.Port), 10)},
+		{"admin", config.Admin.Port},
+	} {
+		if listener.port == "" || listener.port == "0" {
+			continue
+		}
+
+		if other, ok := ports[listener.port]; ok {
+			return config, errors.Errorf("the %s and %s ports are both %s, they must differ",
+				other, listener.name, listener.port)
+		}
+
+		ports[listener.port] = listener.name
+	}
+
+	return config, nil
+}
+
+// parseConfig decodes a configuration file. JSON files, told apart by their
+// extension or their content, go through the YAML decoder as well, so both
+// formats share the same keys and parse durations like "30s" the same way.
+func parseConfig(name string, data []byte) (RPCGatewayConfig, error) {
+	var config RPCGatewayConfig
+
+	if isJSONConfig(name, data) {
+		converted, err := jsonToYAML(data)
+		if err != nil {
+			return config, errors.Wrap(err, "invalid JSON config")
+		}
+
+		data = converted
+	}
+
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+func isJSONConfig(name string, data []byte) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return true
+	case ".yml", ".yaml":
+		return false
+	}
+
+	trimmed := bytes.TrimSpace(data)
+
+	return len(trimmed) > 0 && trimmed[0] == '{' && json.Valid(trimmed)
+}
+
+// jsonToYAML re-encodes a JSON document as YAML. Numbers are kept as integers
+// whenever they are, so they can fill integer fields.
+func jsonToYAML(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(yamlCompatible(value))
+}
+
+// yamlCompatible converts the numbers decoded by encoding/json to the types
+// yaml.v2 marshals as plain numbers. Integer keys, always strings in JSON,
+// are turned into integers too, so they can fill maps keyed by integers.
+func yamlCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[interface{}]interface{}, len(v))
+		for key, value := range v {
+			if i, err := strconv.ParseInt(key, 10, 64); err == nil {
+				m[i] = yamlCompatible(value)
+			} else {
+				m[key] = yamlCompatible(value)
+			}
+		}
+
+		return m
+	case []interface{}:
+		for i, value := range v {
+			v[i] = yamlCompatible(value)
+		}
+
+		return v
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+
+		return v.String()
+	default:
+		return value
+	}
 }
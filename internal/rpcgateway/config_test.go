@@ -0,0 +1,174 @@
+package rpcgateway
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlTestConfig = `
+metrics:
+  port: 9090
+  durationBuckets: [0.1, 1, 10]
+
+proxy:
+  port: "3000"
+  upstreamTimeout: "1s"
+  requestTimeout: "3s"
+  maxRequestBodySize: 10485760
+  retry:
+    maxAttempts: 2
+    backoff: "50ms"
+  statusPolicy:
+    400: "normalize"
+  computeUnits:
+    costs:
+      eth_getLogs: 75
+    defaultCost: 1.5
+  methodClasses:
+    logs: ["eth_getLogs"]
+
+healthChecks:
+  interval: "5s"
+  timeout: "1s"
+  failureThreshold: 2
+  successThreshold: 1
+  rollingWindowMinObservations: 0.9
+
+targets:
+  - name: "Cloudflare"
+    weight: 2
+    secrets:
+      APIKey: "API_KEY"
+    connection:
+      http:
+        url: "https://cloudflare-eth.com"
+        queryParams:
+          key: "{{ .APIKey }}"
+`
+
+const jsonTestConfig = `{
+  "metrics": {"port": 9090, "durationBuckets": [0.1, 1, 10]},
+  "proxy": {
+    "port": "3000",
+    "upstreamTimeout": "1s",
+    "requestTimeout": "3s",
+    "maxRequestBodySize": 10485760,
+    "retry": {"maxAttempts": 2, "backoff": "50ms"},
+    "statusPolicy": {"400": "normalize"},
+    "computeUnits": {"costs": {"eth_getLogs": 75}, "defaultCost": 1.5},
+    "methodClasses": {"logs": ["eth_getLogs"]}
+  },
+  "healthChecks": {
+    "interval": "5s",
+    "timeout": "1s",
+    "failureThreshold": 2,
+    "successThreshold": 1,
+    "rollingWindowMinObservations": 0.9
+  },
+  "targets": [
+    {
+      "name": "Cloudflare",
+      "weight": 2,
+      "secrets": {"APIKey": "API_KEY"},
+      "connection": {
+        "http": {
+          "url": "https://cloudflare-eth.com",
+          "queryParams": {"key": "{{ .APIKey }}"}
+        }
+      }
+    }
+  ]
+}`
+
+func TestParseConfigJSONMatchesYAML(t *testing.T) {
+	fromYAML, err := parseConfig("config.yml", []byte(yamlTestConfig))
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Second, fromYAML.Proxy.UpstreamTimeout)
+	assert.Equal(t, 50*time.Millisecond, fromYAML.Proxy.Retry.Backoff)
+
+	for _, name := range []string{"config.json", "config"} {
+		fromJSON, err := parseConfig(name, []byte(jsonTestConfig))
+		require.NoError(t, err, name)
+
+		assert.Equal(t, fromYAML, fromJSON, name)
+	}
+}
+
+func TestParseConfigRejectsInvalidDurations(t *testing.T) {
+	_, err := parseConfig("config.yml", []byte(`proxy: {upstreamTimeout: "1 second"}`))
+	assert.Error(t, err)
+
+	_, err = parseConfig("config.json", []byte(`{"proxy": {"upstreamTimeout": "1 second"}}`))
+	assert.Error(t, err)
+
+	_, err = parseConfig("config.json", []byte(`{"proxy": {"upstreamTimeout": "1s"`))
+	assert.Error(t, err)
+}
+
+func TestNewRPCGatewayFromJSONConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"proxy": {"upstreamTimeout": "1 second"}}`), 0o600))
+
+	_, err := NewRPCGatewayFromConfigFile(path)
+	assert.ErrorContains(t, err, "1 second")
+}
+
+func TestConfigOverridesApply(t *testing.T) {
+	config, err := parseConfig("config.yml", []byte(yamlTestConfig))
+	require.NoError(t, err)
+
+	unchanged, err := ConfigOverrides{}.Apply(config)
+	require.NoError(t, err)
+	assert.Equal(t, config, unchanged)
+
+	metricsPort := uint(9100)
+
+	overridden, err := ConfigOverrides{
+		Port:            "4000",
+		MetricsPort:     &metricsPort,
+		LogLevel:        "debug",
+		UpstreamTimeout: 5 * time.Second,
+	}.Apply(config)
+	require.NoError(t, err)
+
+	assert.Equal(t, "4000", overridden.Proxy.Port)
+	assert.Equal(t, uint(9100), overridden.Metrics.Port)
+	assert.Equal(t, "debug", overridden.LogLevel)
+	assert.Equal(t, 5*time.Second, overridden.Proxy.UpstreamTimeout)
+	assert.Equal(t, config.Proxy.RequestTimeout, overridden.Proxy.RequestTimeout)
+
+	// Port 0 is a valid override, it picks an ephemeral port.
+	//
+	ephemeral := uint(0)
+
+	overridden, err = ConfigOverrides{MetricsPort: &ephemeral}.Apply(config)
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), overridden.Metrics.Port)
+}
+
+func TestConfigOverridesApplyRejectsConflicts(t *testing.T) {
+	config, err := parseConfig("config.yml", []byte(yamlTestConfig))
+	require.NoError(t, err)
+
+	_, err = ConfigOverrides{Port: "9090"}.Apply(config)
+	assert.ErrorContains(t, err, "the proxy and metrics ports are both 9090")
+
+	config.Admin.Port = "3000"
+
+	_, err = ConfigOverrides{}.Apply(config)
+	assert.ErrorContains(t, err, "the proxy and admin ports are both 3000")
+
+	config.Admin.Port = ""
+
+	_, err = ConfigOverrides{LogLevel: "verbose"}.Apply(config)
+	assert.ErrorContains(t, err, `unknown log level "verbose"`)
+
+	_, err = ConfigOverrides{UpstreamTimeout: -time.Second}.Apply(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,43 @@
+package rpcgateway
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// withH2C serves HTTP/2 cleartext connections on server, along the HTTP/1.1
+// ones, both with prior knowledge and upgraded from HTTP/1.1. The read and
+// write timeouts of server apply to each stream of an h2c connection, and
+// the connections are told to go away when server shuts down.
+func withH2C(server *http.Server, config proxy.ProxyConfig) error {
+	h2s := &http2.Server{IdleTimeout: server.IdleTimeout}
+
+	if err := http2.ConfigureServer(server, h2s); err != nil {
+		return errors.Wrap(err, "cannot configure http/2")
+	}
+
+	maxBodySize := config.MaxRequestBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = proxy.DefaultMaxRequestBodySize
+	}
+
+	handler := h2c.NewHandler(server.Handler, h2s)
+
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The body of a request upgrading to h2c is buffered before it's
+		// served, so it's bounded here rather than by the proxy.
+		//
+		if strings.EqualFold(r.Header.Get("Upgrade"), "h2c") {
+			r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+
+	return nil
+}
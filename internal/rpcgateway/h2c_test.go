@@ -0,0 +1,141 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+func newH2CTestGateway(t *testing.T, enableH2C bool) *httptest.Server {
+	t.Helper()
+
+	node := newFakeNode(t)
+	t.Cleanup(node.Close)
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+				EnableH2C:       enableH2C,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{URL: node.URL},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(gw)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// newH2CClient returns a client speaking HTTP/2 cleartext with prior
+// knowledge.
+func newH2CClient(t *testing.T) *http.Client {
+	t.Helper()
+
+	transport := &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(c context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+
+			return dialer.DialContext(c, network, addr)
+		},
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+
+	return &http.Client{Transport: transport}
+}
+
+func TestRPCGatewayServesH2C(t *testing.T) {
+	server := newH2CTestGateway(t, true)
+	client := newH2CClient(t)
+
+	// The requests are multiplexed on a single connection.
+	//
+	var wg sync.WaitGroup
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			resp, err := client.Post(server.URL, "application/json",
+				bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, 2, resp.ProtoMajor)
+			assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, string(body))
+		}()
+	}
+
+	wg.Wait()
+
+	// HTTP/1.1 keeps working.
+	//
+	resp, err := http.Post(server.URL, "application/json",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, 1, resp.ProtoMajor)
+
+	http.DefaultClient.CloseIdleConnections()
+}
+
+func TestRPCGatewayH2CLimitsBodiesPerStream(t *testing.T) {
+	server := newH2CTestGateway(t, true)
+	client := newH2CClient(t)
+
+	resp, err := client.Post(server.URL, "application/json",
+		bytes.NewReader(bytes.Repeat([]byte(" "), proxy.DefaultMaxRequestBodySize+1)))
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	assert.Equal(t, 2, resp.ProtoMajor)
+}
+
+func TestRPCGatewayRefusesH2CByDefault(t *testing.T) {
+	server := newH2CTestGateway(t, false)
+	client := newH2CClient(t)
+
+	_, err := client.Post(server.URL, "application/json",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,49 @@
+package rpcgateway
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/0xProject/rpc-gateway/internal/middleware"
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/pkg/errors"
+)
+
+// responseHeaders returns the middleware applying the response headers of
+// the config, with the environment variables of their values expanded. An
+// unset variable is an error rather than an empty header.
+func responseHeaders(config proxy.ProxyConfig) (func(http.Handler) http.Handler, error) {
+	set := make(map[string]string, len(config.ResponseHeaders))
+
+	for name, value := range config.ResponseHeaders {
+		expanded, err := expandEnv(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "response header %q", name)
+		}
+
+		set[name] = expanded
+	}
+
+	return middleware.ResponseHeaders(set, config.RemoveResponseHeaders), nil
+}
+
+// expandEnv expands the environment variables of value. An unset variable is
+// an error rather than an empty string.
+func expandEnv(value string) (string, error) {
+	var missing []string
+
+	expanded := os.Expand(value, func(env string) string {
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			missing = append(missing, env)
+		}
+
+		return v
+	})
+
+	if len(missing) > 0 {
+		return "", errors.Errorf("environment variable %q is not set", missing[0])
+	}
+
+	return expanded, nil
+}
@@ -0,0 +1,95 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResponseHeadersTestGateway(t *testing.T, url string) *RPCGateway {
+	t.Helper()
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+				ResponseHeaders: map[string]string{
+					"x-served-by":  "gateway-${TEST_GATEWAY_REGION}",
+					"X-Powered-By": "rpc-gateway",
+				},
+				RemoveResponseHeaders: []string{"Server", "X-Node-Version"},
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: url,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	require.NoError(t, err)
+
+	return gw
+}
+
+func TestResponseHeaders(t *testing.T) {
+	t.Setenv("TEST_GATEWAY_REGION", "eu-west-1")
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx/1.25")
+		w.Header().Set("X-Powered-By", "geth")
+		w.Header().Set("X-Node-Version", "1.13.0")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`)) // nolint:errcheck
+	}))
+	defer node.Close()
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+	}{
+		{"proxied", node.URL, http.StatusOK},
+		{"gateway error", "http://127.0.0.1:1", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newResponseHeadersTestGateway(t, tt.url)
+
+			body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`)
+			rec := httptest.NewRecorder()
+
+			gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+			assert.Equal(t, tt.status, rec.Code)
+			assert.Equal(t, "gateway-eu-west-1", rec.Result().Header.Get("X-Served-By"))
+			assert.Equal(t, []string{"rpc-gateway"}, rec.Result().Header.Values("X-Powered-By"))
+			assert.Empty(t, rec.Result().Header.Values("Server"))
+			assert.Empty(t, rec.Result().Header.Values("X-Node-Version"))
+		})
+	}
+}
+
+func TestResponseHeadersRequireTheirEnvironment(t *testing.T) {
+	_, err := responseHeaders(proxy.ProxyConfig{
+		ResponseHeaders: map[string]string{"X-Served-By": "${TEST_GATEWAY_UNSET}"},
+	})
+	assert.ErrorContains(t, err, `environment variable "TEST_GATEWAY_UNSET" is not set`)
+}
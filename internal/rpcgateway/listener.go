@@ -0,0 +1,338 @@
+package rpcgateway
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation.
+//
+//nolint:gochecknoglobals
+var listenFDsStart = 3
+
+// ListenerConfig sets how the ports of the gateway are bound, so a new
+// version can take over without refusing connections.
+//
+// The sockets passed by systemd socket activation are used instead of
+// binding the ports, in order: the proxy first, then the admin API when it's
+// enabled.
+type ListenerConfig struct {
+	// ReusePort binds the ports with SO_REUSEPORT, so the next process can
+	// listen on them while this one drains. Only supported on Linux, macOS
+	// and the BSDs.
+	ReusePort bool `yaml:"reusePort"`
+}
+
+// listen binds address, with SO_REUSEPORT when configured.
+func (c ListenerConfig) listen(address string) (net.Listener, error) {
+	var config net.ListenConfig
+
+	if c.ReusePort {
+		config.Control = func(_, _ string, conn syscall.RawConn) error {
+			var err error
+
+			if controlErr := conn.Control(func(fd uintptr) { err = setReusePort(fd) }); controlErr != nil {
+				return controlErr
+			}
+
+			return errors.Wrap(err, "cannot set SO_REUSEPORT")
+		}
+	}
+
+	return config.Listen(context.Background(), "tcp", address)
+}
+
+// pausableListener stops accepting connections once paused, but keeps the
+// socket open until it's closed, so the gateway it was handed over to gets
+// the next connections.
+type pausableListener struct {
+	net.Listener
+
+	paused    chan struct{}
+	closed    chan struct{}
+	pauseOnce sync.Once
+	closeOnce sync.Once
+}
+
+func newPausableListener(listener net.Listener) *pausableListener {
+	return &pausableListener{
+		Listener: listener,
+		paused:   make(chan struct{}),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (l *pausableListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.paused:
+		<-l.closed
+
+		return nil, net.ErrClosed
+	default:
+	}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		select {
+		case <-l.paused:
+			<-l.closed
+
+			return nil, net.ErrClosed
+		default:
+		}
+	}
+
+	return conn, err
+}
+
+// pause stops accepting connections. The pending Accept is woken up by an
+// expired deadline.
+func (l *pausableListener) pause() {
+	l.pauseOnce.Do(func() {
+		close(l.paused)
+
+		if d, ok := l.Listener.(interface{ SetDeadline(t time.Time) error }); ok {
+			d.SetDeadline(time.Now()) // nolint:errcheck
+		}
+	})
+}
+
+func (l *pausableListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+
+	return l.Listener.Close()
+}
+
+// newConns tracks the connections of a server that haven't sent a request
+// yet. http.Server.Shutdown drops them once they do, so a server whose
+// listener is paused waits for them before shutting down.
+type newConns struct {
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func (n *newConns) track(conn net.Conn, state http.ConnState) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if state != http.StateNew {
+		delete(n.conns, conn)
+
+		return
+	}
+
+	if n.conns == nil {
+		n.conns = map[net.Conn]struct{}{}
+	}
+
+	n.conns[conn] = struct{}{}
+}
+
+// await waits until every connection sent its request or went away, or
+// until c is done.
+func (n *newConns) await(c context.Context) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		n.mu.Lock()
+		pending := len(n.conns)
+		n.mu.Unlock()
+
+		if pending == 0 {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-c.Done():
+			return
+		}
+	}
+}
+
+// portBinder binds the ports of a gateway. The sockets handed over by the
+// gateway it replaces are taken over first, matched by role and address, so
+// the ports are never closed in between.
+type portBinder struct {
+	config ListenerConfig
+
+	mu        sync.Mutex
+	inherited map[string]net.Listener
+	bound     map[string]*pausableListener
+	paused    bool
+}
+
+func newPortBinder(config ListenerConfig) *portBinder {
+	return &portBinder{
+		config: config,
+		bound:  map[string]*pausableListener{},
+	}
+}
+
+// listen returns the socket of role bound to address, the handed over one
+// when there's one.
+func (b *portBinder) listen(role, address string) (net.Listener, error) {
+	b.mu.Lock()
+	listener, ok := b.inherited[role+" "+address]
+	delete(b.inherited, role+" "+address)
+	b.mu.Unlock()
+
+	if !ok {
+		var err error
+
+		if listener, err = b.config.listen(address); err != nil {
+			return nil, err
+		}
+	}
+
+	return b.track(role, address, listener), nil
+}
+
+// track records listener as the socket of role, bound to address, so it can
+// be handed over.
+func (b *portBinder) track(role, address string, listener net.Listener) net.Listener {
+	pausable := newPausableListener(listener)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bound[role+" "+address] = pausable
+
+	return pausable
+}
+
+// handover duplicates the bound sockets, for the gateway replacing this one.
+// The duplicates stay open once this gateway stops, the connections coming
+// meanwhile wait for the next one to accept them.
+func (b *portBinder) handover() (map[string]net.Listener, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	handed := make(map[string]net.Listener, len(b.bound))
+
+	for key, listener := range b.bound {
+		filer, ok := listener.Listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			closeListeners(handed)
+
+			return nil, errors.Errorf("cannot hand over %s socket", key)
+		}
+
+		file, err := filer.File()
+		if err != nil {
+			closeListeners(handed)
+
+			return nil, errors.Wrapf(err, "cannot hand over %s socket", key)
+		}
+
+		duplicate, err := net.FileListener(file)
+		file.Close()
+
+		if err != nil {
+			closeListeners(handed)
+
+			return nil, errors.Wrapf(err, "cannot hand over %s socket", key)
+		}
+
+		handed[key] = duplicate
+	}
+
+	return handed, nil
+}
+
+// pause stops accepting connections on the bound sockets, once they've been
+// handed over.
+func (b *portBinder) pause() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.paused = true
+
+	for _, listener := range b.bound {
+		listener.pause()
+	}
+}
+
+// isPaused reports whether the bound sockets were paused.
+func (b *portBinder) isPaused() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.paused
+}
+
+// inherit sets the sockets handed over by the gateway this one replaces.
+func (b *portBinder) inherit(handed map[string]net.Listener) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.inherited = handed
+}
+
+// closeInherited closes the handed over sockets that weren't taken, e.g.
+// the ports moved.
+func (b *portBinder) closeInherited() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	closeListeners(b.inherited)
+	b.inherited = nil
+}
+
+func closeListeners(listeners map[string]net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// activatedListeners returns the listeners passed by systemd socket
+// activation, none when the gateway wasn't started by it. The environment
+// variables are unset, so child processes don't take the sockets for theirs.
+func activatedListeners() ([]net.Listener, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]net.Listener, 0, count)
+
+	for fd := listenFDsStart; fd < listenFDsStart+count; fd++ {
+		// FileListener duplicates the descriptor, the original one is
+		// closed either way.
+		//
+		file := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		listener, err := net.FileListener(file)
+		file.Close()
+
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+
+			return nil, errors.Wrapf(err, "invalid socket activation file descriptor %d", fd)
+		}
+
+		listeners = append(listeners, listener)
+	}
+
+	return listeners, nil
+}
@@ -0,0 +1,192 @@
+//go:build linux
+
+package rpcgateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerConfigReusePort(t *testing.T) {
+	config := ListenerConfig{ReusePort: true}
+
+	first, err := config.listen("127.0.0.1:0")
+	require.NoError(t, err)
+
+	defer first.Close()
+
+	// The next process binds the port while the previous one still listens.
+	//
+	second, err := config.listen(first.Addr().String())
+	require.NoError(t, err)
+
+	defer second.Close()
+
+	_, err = ListenerConfig{}.listen(first.Addr().String())
+	assert.Error(t, err)
+}
+
+func TestRPCGatewayServesActivatedSocket(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	bound, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	address := bound.Addr().String()
+
+	file, err := bound.(*net.TCPListener).File()
+	require.NoError(t, err)
+
+	// The gateway owns the descriptor, like the ones systemd passes.
+	//
+	fd, err := syscall.Dup(int(file.Fd()))
+	require.NoError(t, err)
+
+	file.Close()
+	bound.Close()
+
+	start := listenFDsStart
+	listenFDsStart = fd
+
+	t.Cleanup(func() { listenFDsStart = start })
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval: 10 * time.Millisecond,
+				Timeout:  time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	require.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	select {
+	case <-gw.Ready():
+	case err := <-started:
+		t.Fatalf("gateway stopped: %v", err)
+	}
+
+	assert.Empty(t, os.Getenv("LISTEN_FDS"))
+
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	resp, err := client.Post("http://"+address+"/", "application/json",
+		bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`))
+	require.NoError(t, err)
+
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, gw.Stop(c))
+	assert.NoError(t, <-started)
+}
+
+func TestRPCGatewayClosesUnusedActivatedSockets(t *testing.T) {
+	// Two sockets are passed while the admin API is disabled, so only the
+	// first one is used. They're moved to descriptors unlikely to be taken.
+	//
+	const start = 900
+
+	addresses := make([]string, 0, 2)
+
+	for fd := start; fd < start+2; fd++ {
+		bound, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		addresses = append(addresses, bound.Addr().String())
+
+		file, err := bound.(*net.TCPListener).File()
+		require.NoError(t, err)
+
+		require.NoError(t, syscall.Dup3(int(file.Fd()), fd, 0))
+
+		file.Close()
+		bound.Close()
+	}
+
+	previous := listenFDsStart
+	listenFDsStart = start
+
+	t.Cleanup(func() { listenFDsStart = previous })
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval: 10 * time.Millisecond,
+				Timeout:  time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: "http://127.0.0.1:8545",
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	require.NoError(t, err)
+
+	listener, admin, err := gw.listen()
+	require.NoError(t, err)
+
+	defer listener.Close()
+
+	assert.Nil(t, admin)
+	assert.Equal(t, addresses[0], listener.Addr().String())
+
+	_, err = net.Dial("tcp", addresses[1])
+	assert.Error(t, err)
+}
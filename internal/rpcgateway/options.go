@@ -0,0 +1,93 @@
+package rpcgateway
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type options struct {
+	logger          *slog.Logger
+	transports      map[string]http.RoundTripper
+	registry        *prometheus.Registry
+	healthObservers []proxy.HealthObserver
+	selector        proxy.TargetSelector
+	overrides       *ConfigOverrides
+	build           *buildinfo.Info
+	check           bool
+}
+
+// Option customizes an RPCGateway beyond what the configuration file can
+// express. It's meant for programs embedding the gateway.
+type Option func(*options)
+
+// WithLogger replaces the logger used by the gateway.
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithTransport sets the HTTP transport used to reach the named target, both
+// for proxied requests and health checks.
+func WithTransport(target string, transport http.RoundTripper) Option {
+	return func(o *options) {
+		if o.transports == nil {
+			o.transports = map[string]http.RoundTripper{}
+		}
+
+		o.transports[target] = transport
+	}
+}
+
+// WithRegistry registers the gateway metrics with the given registry, which
+// is also the one served by the metrics server.
+func WithRegistry(registry *prometheus.Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithHealthListener registers a callback invoked whenever a target becomes
+// healthy or unhealthy.
+func WithHealthListener(listener func(target string, healthy bool)) Option {
+	return func(o *options) {
+		o.healthObservers = append(o.healthObservers, proxy.HealthObserverFunc(listener))
+	}
+}
+
+// WithTargetSelector replaces the configured load balancing mode.
+func WithTargetSelector(selector proxy.TargetSelector) Option {
+	return func(o *options) {
+		o.selector = selector
+	}
+}
+
+// WithConfigOverrides replaces values of the configuration, e.g. with command
+// line flags. They apply to every configuration a remote source provides too.
+func WithConfigOverrides(overrides ConfigOverrides) Option {
+	return func(o *options) {
+		o.overrides = &overrides
+	}
+}
+
+// WithBuildInfo sets the build reported by the gateway. Without it, it's
+// taken from the build info embedded by the Go toolchain.
+func WithBuildInfo(build buildinfo.Info) Option {
+	return func(o *options) {
+		o.build = &build
+	}
+}
+
+// WithCheckMode prepares the gateway for Check: the metrics are served on an
+// ephemeral loopback port, and the traces of the requests are enabled to
+// tell which target served the check. The proxy and admin ports are never
+// bound by Check.
+func WithCheckMode() Option {
+	return func(o *options) {
+		o.check = true
+	}
+}
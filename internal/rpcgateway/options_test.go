@@ -0,0 +1,89 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+type countingTransport struct {
+	calls atomic.Int64
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.calls.Add(1)
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestWithTransport(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer upstream.Close()
+
+	transport := &countingTransport{}
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: upstream.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithTransport("upstream", transport),
+	)
+	assert.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	rec := httptest.NewRecorder()
+
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, int64(1), transport.calls.Load())
+}
+
+func TestWithRegistryIsolatesMetrics(t *testing.T) {
+	config := RPCGatewayConfig{
+		Proxy: proxy.ProxyConfig{
+			UpstreamTimeout: time.Second,
+		},
+		Targets: []proxy.NodeProviderConfig{
+			{
+				Name: "upstream",
+				Connection: proxy.NodeProviderConnectionConfig{
+					HTTP: proxy.NodeProviderConnectionHTTPConfig{
+						URL: "http://127.0.0.1:1",
+					},
+				},
+			},
+		},
+	}
+
+	// Two gateways in the same process must not collide on metric
+	// registration.
+	//
+	_, err := NewRPCGateway(config, WithRegistry(prometheus.NewRegistry()))
+	assert.NoError(t, err)
+
+	_, err = NewRPCGateway(config, WithRegistry(prometheus.NewRegistry()))
+	assert.NoError(t, err)
+}
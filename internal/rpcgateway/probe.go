@@ -0,0 +1,101 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultProbeURL is the readiness endpoint probed when no URL is given,
+	// on the port of the example configuration.
+	DefaultProbeURL = "http://127.0.0.1:9090/readyz"
+
+	// maxProbeResponseSize is the largest response read by a probe.
+	maxProbeResponseSize = 64 << 10
+
+	// chainIDRequest is sent by the probes and the self-check.
+	chainIDRequest = `{"jsonrpc":"2.0","id":1,"method":"eth_chainId","params":[]}`
+)
+
+// ProbeReady reports whether the gateway at url, its /readyz endpoint, is
+// ready. It is when the endpoint answers 200, as for the probes of the
+// orchestrators, so the gateway is only ready once it accepts requests.
+func ProbeReady(c context.Context, url string) error {
+	req, err := http.NewRequestWithContext(c, http.MethodGet, url, nil)
+	if err != nil {
+		return errors.Wrap(err, "invalid probe URL")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot reach the gateway")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("gateway not ready, got %s", resp.Status)
+	}
+
+	return nil
+}
+
+// ProbeRPC sends an eth_chainId call to the proxy at url, and reports whether
+// a node answered it with a result.
+func ProbeRPC(c context.Context, url string) error {
+	body := bytes.NewBufferString(chainIDRequest)
+
+	req, err := http.NewRequestWithContext(c, http.MethodPost, url, body)
+	if err != nil {
+		return errors.Wrap(err, "invalid probe URL")
+	}
+
+	req.Header.Set(headers.ContentType, "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "cannot reach the gateway")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("eth_chainId failed, got %s", resp.Status)
+	}
+
+	_, err = readChainID(resp.Body)
+
+	return err
+}
+
+// readChainID reads the result of an eth_chainId call from body.
+func readChainID(body io.Reader) (string, error) {
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(body, maxProbeResponseSize)).Decode(&response); err != nil {
+		return "", errors.Wrap(err, "invalid eth_chainId response")
+	}
+
+	switch {
+	case response.Error != nil:
+		return "", errors.Errorf("eth_chainId failed: %s", response.Error.Message)
+	case len(response.Result) == 0 || string(response.Result) == "null":
+		return "", errors.New("eth_chainId returned no result")
+	}
+
+	var chainID string
+	if err := json.Unmarshal(response.Result, &chainID); err != nil {
+		return "", errors.Wrap(err, "invalid eth_chainId result")
+	}
+
+	return chainID, nil
+}
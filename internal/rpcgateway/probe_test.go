@@ -0,0 +1,78 @@
+package rpcgateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
+	"github.com/0xProject/rpc-gateway/internal/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeReady(t *testing.T) {
+	ready := make(chan struct{})
+
+	server := metrics.NewServer(metrics.Config{Port: 0}, nil, nil, ready, nil, buildinfo.Info{})
+
+	go server.Start() // nolint:errcheck
+
+	t.Cleanup(func() { server.Stop() }) // nolint:errcheck
+
+	require.Eventually(t, func() bool { return server.Addr() != nil }, time.Second, time.Millisecond)
+
+	url := fmt.Sprintf("http://%s/readyz", server.Addr())
+
+	c, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	assert.ErrorContains(t, ProbeReady(c, url), "503")
+
+	close(ready)
+
+	assert.NoError(t, ProbeReady(c, url))
+
+	server.Stop() // nolint:errcheck
+
+	assert.ErrorContains(t, ProbeReady(c, url), "cannot reach the gateway")
+}
+
+func TestProbeRPC(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		err    string
+	}{
+		{"healthy", http.StatusOK, `{"jsonrpc":"2.0","id":1,"result":"0x1"}`, ""},
+		{"unavailable", http.StatusServiceUnavailable, `{"jsonrpc":"2.0","id":1,"error":{"code":-32603,"message":"no node provider could serve the request"}}`, "503"},
+		{"error", http.StatusOK, `{"jsonrpc":"2.0","id":1,"error":{"code":-32000,"message":"boom"}}`, "boom"},
+		{"no result", http.StatusOK, `{"jsonrpc":"2.0","id":1,"result":null}`, "no result"},
+		{"invalid", http.StatusOK, `<html>`, "invalid eth_chainId response"},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, http.MethodPost, r.Method)
+
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body)) // nolint:errcheck
+			}))
+			defer server.Close()
+
+			err := ProbeRPC(context.Background(), server.URL)
+			if tt.err == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-http-utils/headers"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+)
+
+// DefaultRemoteConfigTimeout bounds a single fetch of a remote
+// configuration.
+const DefaultRemoteConfigTimeout = 10 * time.Second
+
+// maxRemoteConfigSize is the largest remote configuration accepted.
+const maxRemoteConfigSize = 1 << 20
+
+// IsRemoteConfig reports whether the configuration location is an HTTP(S)
+// URL rather than a file path.
+func IsRemoteConfig(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// RemoteConfigSource fetches the configuration from an HTTP(S) URL. It keeps
+// the ETag of the last configuration, so unchanged ones aren't downloaded
+// again.
+type RemoteConfigSource struct {
+	url    string
+	token  string
+	client *http.Client
+
+	etag string
+	last []byte
+}
+
+// NewRemoteConfigSource creates a source fetching the configuration at
+// rawURL. The token, when set, is sent as a bearer token. A zero timeout
+// uses DefaultRemoteConfigTimeout.
+func NewRemoteConfigSource(rawURL, token string, timeout time.Duration) (*RemoteConfigSource, error) {
+	if u, err := url.Parse(rawURL); err != nil || !IsRemoteConfig(rawURL) || u.Host == "" {
+		return nil, errors.Errorf("invalid config URL %q", rawURL)
+	}
+
+	if timeout == 0 {
+		timeout = DefaultRemoteConfigTimeout
+	}
+
+	return &RemoteConfigSource{
+		url:    rawURL,
+		token:  token,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// Fetch downloads and parses the configuration. It reports whether it
+// changed since the last successful fetch, in which case the configuration
+// returned is the new one.
+func (s *RemoteConfigSource) Fetch(c context.Context) (RPCGatewayConfig, bool, error) {
+	var config RPCGatewayConfig
+
+	req, err := http.NewRequestWithContext(c, http.MethodGet, s.url, nil)
+	if err != nil {
+		return config, false, errors.Wrap(err, "cannot create config request")
+	}
+
+	if s.token != "" {
+		req.Header.Set(headers.Authorization, "Bearer "+s.token)
+	}
+
+	if s.etag != "" {
+		req.Header.Set(headers.IfNoneMatch, s.etag)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return config, false, errors.Wrap(err, "cannot fetch config")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return config, false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return config, false, errors.Errorf("cannot fetch config: HTTP %d", resp.StatusCode)
+	}
+
+	// One more byte than accepted is read, to tell a truncated config from
+	// one of exactly the maximum size.
+	//
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxRemoteConfigSize+1))
+	if err != nil {
+		return config, false, errors.Wrap(err, "cannot read config")
+	}
+
+	if len(data) > maxRemoteConfigSize {
+		return config, false, errors.Errorf("config larger than %d bytes", maxRemoteConfigSize)
+	}
+
+	if s.last != nil && bytes.Equal(data, s.last) {
+		s.etag = resp.Header.Get(headers.ETag)
+
+		return config, false, nil
+	}
+
+	// The extension of the URL path or the content type tell JSON configs
+	// apart, the content is sniffed otherwise.
+	//
+	name := path.Base(req.URL.Path)
+	if strings.HasPrefix(resp.Header.Get(headers.ContentType), "application/json") {
+		name = "config.json"
+	}
+
+	config, err = parseConfig(name, data)
+	if err != nil {
+		return config, false, errors.Wrap(err, "invalid config")
+	}
+
+	s.etag = resp.Header.Get(headers.ETag)
+	s.last = data
+
+	return config, true, nil
+}
+
+// RunWithRemoteConfig runs a gateway configured from source until c is done.
+// Every pollInterval, when it's positive, the configuration is fetched again
+// and a changed one replaces the running gateway by a new one. The new
+// gateway takes over the sockets of the running one, which is only stopped
+// once the new one is ready, so the ports never refuse connections. Failures
+// to fetch, apply or start a configuration after the first one are logged
+// and the running gateway is kept. stopTimeout bounds how long a gateway
+// takes to stop.
+func RunWithRemoteConfig(
+	c context.Context,
+	source *RemoteConfigSource,
+	pollInterval time.Duration,
+	stopTimeout time.Duration,
+	opts ...Option,
+) error {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	logger := o.logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	config, _, err := source.Fetch(c)
+	if err != nil {
+		return err
+	}
+
+	gateway, err := newRemoteConfigGateway(config, opts)
+	if err != nil {
+		return err
+	}
+
+	var poll <-chan time.Time
+
+	if pollInterval > 0 {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		poll = ticker.C
+	}
+
+	errc := startGateway(c, gateway)
+
+	for {
+		next, err := awaitConfigChange(c, source, poll, errc, opts, logger)
+		if err != nil {
+			return err
+		}
+
+		if next == nil {
+			return stopGateway(gateway, errc, stopTimeout)
+		}
+
+		logger.Info("applying new config")
+
+		nextErrc, err := takeOver(c, gateway, next, stopTimeout)
+		if err != nil {
+			logger.Error("cannot start new config, keeping the current one", "error", err)
+
+			continue
+		}
+
+		gateway.ports.pause()
+
+		if err := stopGateway(gateway, errc, stopTimeout); err != nil {
+			return err
+		}
+
+		// The ports of the new configuration are bound, the old ones it
+		// didn't take are released.
+		//
+		next.ports.closeInherited()
+
+		gateway, errc = next, nextErrc
+	}
+}
+
+func startGateway(c context.Context, gateway *RPCGateway) chan error {
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- gateway.Start(c)
+	}()
+
+	return errc
+}
+
+// stopGateway stops gateway, and returns the error it failed with if any.
+func stopGateway(gateway *RPCGateway, errc chan error, stopTimeout time.Duration) error {
+	stopCtx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+
+	if err := gateway.Stop(stopCtx); err != nil {
+		return errors.Wrap(err, "cannot stop a service")
+	}
+
+	if err := <-errc; err != nil {
+		return errors.Wrap(err, "cannot start a service")
+	}
+
+	return nil
+}
+
+// takeOver starts next with the sockets of the running gateway, so the
+// ports keep accepting connections, and waits for it to be ready. The
+// running gateway is left alone when next fails to start.
+func takeOver(c context.Context, running, next *RPCGateway, stopTimeout time.Duration) (chan error, error) {
+	handed, err := running.ports.handover()
+	if err != nil {
+		return nil, err
+	}
+
+	next.ports.inherit(handed)
+
+	errc := startGateway(c, next)
+
+	select {
+	case <-next.Ready():
+		return errc, nil
+	case err = <-errc:
+		errc <- err
+	case <-c.Done():
+		err = c.Err()
+	}
+
+	next.ports.closeInherited()
+
+	if stopErr := stopGateway(next, errc, stopTimeout); stopErr != nil && err == nil {
+		err = stopErr
+	}
+
+	if err == nil {
+		err = errors.New("stopped before being ready")
+	}
+
+	return nil, err
+}
+
+// awaitConfigChange polls source until its configuration changes, and
+// returns a gateway built from it. It returns a nil gateway once c is done,
+// and the error of the running gateway if it fails.
+func awaitConfigChange(
+	c context.Context,
+	source *RemoteConfigSource,
+	poll <-chan time.Time,
+	errc chan error,
+	opts []Option,
+	logger *slog.Logger,
+) (*RPCGateway, error) {
+	for {
+		select {
+		case <-c.Done():
+			return nil, nil
+		case err := <-errc:
+			// The error is sent back, so the caller gets it after Stop.
+			//
+			errc <- err
+
+			if err == nil {
+				return nil, nil
+			}
+
+			return nil, errors.Wrap(err, "cannot start a service")
+		case <-poll:
+		}
+
+		config, changed, err := source.Fetch(c)
+		if err != nil {
+			logger.Error("cannot poll config, keeping the current one", "error", err)
+
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		gateway, err := newRemoteConfigGateway(config, opts)
+		if err != nil {
+			logger.Error("cannot apply new config, keeping the current one", "error", err)
+
+			continue
+		}
+
+		return gateway, nil
+	}
+}
+
+// newRemoteConfigGateway creates a gateway with its own registry, so the
+// gateways replacing each other don't register the same metrics twice.
+func newRemoteConfigGateway(config RPCGatewayConfig, opts []Option) (*RPCGateway, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	opts = append(opts[:len(opts):len(opts)], WithRegistry(registry))
+
+	return NewRPCGateway(config, opts...)
+}
@@ -0,0 +1,237 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeConfigServer serves a configuration with an ETag, and fails while
+// broken is set.
+type fakeConfigServer struct {
+	mu       sync.Mutex
+	config   string
+	version  int
+	broken   bool
+	notMods  int
+	lastAuth string
+}
+
+func (s *fakeConfigServer) set(config string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.config = config
+	s.version++
+}
+
+func (s *fakeConfigServer) setBroken(broken bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.broken = broken
+}
+
+func (s *fakeConfigServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAuth = r.Header.Get("Authorization")
+
+	if s.broken {
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	etag := strconv.Quote(strconv.Itoa(s.version))
+	if r.Header.Get("If-None-Match") == etag {
+		s.notMods++
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(s.config))
+}
+
+func newResultNode(t testing.TB, result string) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, `{"jsonrpc":"2.0","id":1,"result":"%s"}`, result)
+	}))
+}
+
+func remoteTestConfig(port, url string) string {
+	return fmt.Sprintf(`{
+  "proxy": {"port": "%s", "upstreamTimeout": "1s"},
+  "healthChecks": {"interval": "1s", "timeout": "1s", "failureThreshold": 1, "successThreshold": 1},
+  "targets": [{"name": "upstream", "connection": {"http": {"url": "%s"}}}]
+}`, port, url)
+}
+
+// awaitResult sends requests to the gateway until one is answered with
+// result.
+func awaitResult(t *testing.T, port, result string) {
+	t.Helper()
+
+	want := fmt.Sprintf(`"result":"%s"`, result)
+
+	assert.Eventually(t, func() bool {
+		resp, err := http.Post("http://localhost:"+port, "application/json",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+
+		return err == nil && bytes.Contains(body, []byte(want))
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestRunWithRemoteConfigAppliesChanges(t *testing.T) {
+	first := newResultNode(t, "0xa")
+	defer first.Close()
+
+	second := newResultNode(t, "0xb")
+	defer second.Close()
+
+	port := freePort(t)
+
+	configServer := &fakeConfigServer{}
+	configServer.set(remoteTestConfig(port, first.URL))
+
+	server := httptest.NewServer(configServer)
+	defer server.Close()
+
+	source, err := NewRemoteConfigSource(server.URL+"/config", "secret", time.Second)
+	require.NoError(t, err)
+
+	c, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+
+	go func() {
+		done <- RunWithRemoteConfig(c, source, 20*time.Millisecond, 5*time.Second,
+			WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+	}()
+
+	awaitResult(t, port, "0xa")
+
+	// Failing polls keep the running gateway.
+	//
+	configServer.setBroken(true)
+	time.Sleep(100 * time.Millisecond)
+	awaitResult(t, port, "0xa")
+	configServer.setBroken(false)
+
+	// New connections keep being accepted while the gateway is replaced.
+	//
+	var (
+		refused atomic.Int32
+		stop    = make(chan struct{})
+		polled  = make(chan struct{})
+	)
+
+	go func() {
+		defer close(polled)
+
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			resp, err := client.Post("http://localhost:"+port, "application/json",
+				bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`))
+			if err != nil {
+				refused.Add(1)
+
+				continue
+			}
+
+			resp.Body.Close()
+		}
+	}()
+
+	configServer.set(remoteTestConfig(port, second.URL))
+	awaitResult(t, port, "0xb")
+
+	time.Sleep(100 * time.Millisecond)
+	close(stop)
+	<-polled
+
+	assert.Zero(t, refused.Load())
+
+	// Unchanged configs aren't downloaded again.
+	//
+	assert.Eventually(t, func() bool {
+		configServer.mu.Lock()
+		defer configServer.mu.Unlock()
+
+		return configServer.notMods > 0 && configServer.lastAuth == "Bearer secret"
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("gateway did not stop")
+	}
+}
+
+func TestRunWithRemoteConfigRejectsInvalidConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"proxy": {"upstreamTimeout": "1 second"}}`))
+	}))
+	defer server.Close()
+
+	source, err := NewRemoteConfigSource(server.URL, "", time.Second)
+	require.NoError(t, err)
+
+	err = RunWithRemoteConfig(context.Background(), source, 0, time.Second)
+	assert.ErrorContains(t, err, "invalid config")
+}
+
+func TestRemoteConfigSourceRejectsLargeConfig(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte(" "), maxRemoteConfigSize+1))
+	}))
+	defer server.Close()
+
+	source, err := NewRemoteConfigSource(server.URL, "", time.Second)
+	require.NoError(t, err)
+
+	_, _, err = source.Fetch(context.Background())
+	assert.ErrorContains(t, err, "config larger than")
+}
+
+func TestNewRemoteConfigSourceRejectsInvalidURLs(t *testing.T) {
+	for _, url := range []string{"config.yml", "ftp://example.com/config.yml", "https://"} {
+		_, err := NewRemoteConfigSource(url, "", 0)
+		assert.Error(t, err, url)
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package rpcgateway
+
+import "github.com/pkg/errors"
+
+func setReusePort(uintptr) error {
+	return errors.New("SO_REUSEPORT isn't supported on this platform")
+}
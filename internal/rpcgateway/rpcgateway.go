@@ -4,10 +4,14 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
 	"github.com/0xProject/rpc-gateway/internal/metrics"
 	"github.com/0xProject/rpc-gateway/internal/proxy"
 	"github.com/carlmjohnson/flowmatic"
@@ -15,53 +19,278 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/httplog/v2"
 	"github.com/pkg/errors"
-	"gopkg.in/yaml.v2"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// ErrNoTargetConfigured is returned for configurations without any target,
+// inline or in the targets directory.
+var ErrNoTargetConfigured = errors.New("no target configured")
+
 type RPCGateway struct {
 	config  RPCGatewayConfig
 	proxy   *proxy.Proxy
 	hcm     *proxy.HealthCheckManager
 	server  *http.Server
+	admin   *http.Server
 	metrics *metrics.Server
+	ports   *portBinder
+	conns   *newConns
+	logger  *slog.Logger
+	build   buildinfo.Info
+
+	// ready is closed once the listeners are bound.
+	ready chan struct{}
+
+	// check is set by WithCheckMode.
+	check bool
+
+	// cancel and done are set while Start runs.
+	cancel context.CancelFunc
+	done   chan struct{}
+	mu     sync.Mutex
 }
 
 func (r *RPCGateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	r.server.Handler.ServeHTTP(w, req)
 }
 
+// Start runs the gateway until Stop is called. The context passed to Start
+// is canceled by Stop.
 func (r *RPCGateway) Start(c context.Context) error {
+	r.mu.Lock()
+	if r.done != nil {
+		r.mu.Unlock()
+
+		return errors.New("rpc-gateway already started")
+	}
+
+	c, cancel := context.WithCancel(c)
+	done := make(chan struct{})
+
+	r.cancel = cancel
+	r.done = done
+	r.mu.Unlock()
+
+	defer close(done)
+	defer cancel()
+
+	r.logger.Info("starting rpc-gateway", "version", r.build.Version, "commit", r.build.Commit, "date", r.build.Date)
+
+	// Collectors are registered by the constructors, so metrics can be
+	// scraped right away. The listeners come last, once the health checks
+	// are running.
+	//
 	return flowmatic.Do(
 		func() error {
 			return errors.Wrap(r.hcm.Start(c), "failed to start health check manager")
 		},
 		func() error {
-			return errors.Wrap(r.server.ListenAndServe(), "failed to start rpc-gateway")
+			return errors.Wrap(r.proxy.Start(c), "failed to start proxy")
 		},
 		func() error {
 			return errors.Wrap(r.metrics.Start(), "failed to start metrics server")
 		},
+		func() error {
+			return r.serve(c)
+		},
 	)
 }
 
-func (r *RPCGateway) Stop(c context.Context) error {
+// serve binds the listeners, after the first round of health checks when
+// waitForHealthyOnStart is set, and serves until Stop is called.
+func (r *RPCGateway) serve(c context.Context) error {
+	if r.config.HealthChecks.WaitForHealthyOnStart {
+		if err := r.hcm.AwaitFirstChecks(c); err != nil {
+			if c.Err() != nil {
+				return nil
+			}
+
+			r.logger.Warn("serving before the first health checks are done", "error", err)
+		}
+	}
+
+	listener, admin, err := r.listen()
+	if err != nil {
+		return err
+	}
+
+	close(r.ready)
+
 	return flowmatic.Do(
+		func() error {
+			if err := r.server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+				return errors.Wrap(err, "failed to start rpc-gateway")
+			}
+
+			return nil
+		},
+		func() error {
+			if admin == nil {
+				return nil
+			}
+
+			if err := r.admin.Serve(admin); !errors.Is(err, http.ErrServerClosed) {
+				return errors.Wrap(err, "failed to start admin server")
+			}
+
+			return nil
+		},
+	)
+}
+
+// listen returns the listeners of the proxy and, when enabled, of the admin
+// API. The sockets passed by socket activation are used when there are.
+func (r *RPCGateway) listen() (net.Listener, net.Listener, error) {
+	activated, err := activatedListeners()
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to start rpc-gateway")
+	}
+
+	// The sockets left over, e.g. one for the admin API while it's disabled,
+	// are closed rather than kept open without ever being accepted on.
+	//
+	defer func() {
+		if len(activated) > 0 {
+			r.logger.Warn("closing unused socket activation listeners", "count", len(activated))
+		}
+
+		for _, listener := range activated {
+			listener.Close()
+		}
+	}()
+
+	next := func(role, address string) (net.Listener, error) {
+		if len(activated) == 0 {
+			return r.ports.listen(role, address)
+		}
+
+		listener := activated[0]
+		activated = activated[1:]
+
+		return r.ports.track(role, address, listener), nil
+	}
+
+	listener, err := next("proxy", r.server.Addr)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to start rpc-gateway")
+	}
+
+	if !r.config.Admin.enabled() {
+		return listener, nil, nil
+	}
+
+	admin, err := next("admin", r.admin.Addr)
+	if err != nil {
+		listener.Close()
+
+		return nil, nil, errors.Wrap(err, "failed to start admin server")
+	}
+
+	return listener, admin, nil
+}
+
+// Ready is closed once the gateway accepts requests. The /readyz endpoint of
+// the metrics server follows it.
+func (r *RPCGateway) Ready() <-chan struct{} {
+	return r.ready
+}
+
+// MetricsAddr returns the address the metrics are served on, nil until the
+// metrics port is bound.
+func (r *RPCGateway) MetricsAddr() net.Addr {
+	return r.metrics.Addr()
+}
+
+// Stop stops the gateway and waits for Start to return. The context bounds
+// how long it waits.
+func (r *RPCGateway) Stop(c context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	err := flowmatic.Do(
 		func() error {
 			return errors.Wrap(r.hcm.Stop(c), "failed to stop health check manager")
 		},
 		func() error {
-			return errors.Wrap(r.server.Close(), "failed to stop rpc-gateway")
+			// The proxy is closed once no request uses it anymore.
+			//
+			err := r.shutdown(c)
+
+			if closeErr := r.proxy.Close(); closeErr != nil && err == nil {
+				err = errors.Wrap(closeErr, "failed to close proxy")
+			}
+
+			return err
 		},
 		func() error {
 			return errors.Wrap(r.metrics.Stop(), "failed to stop metrics server")
 		},
+		func() error {
+			return errors.Wrap(r.admin.Close(), "failed to stop admin server")
+		},
 	)
+	if err != nil {
+		return err
+	}
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-c.Done():
+			return errors.Wrap(c.Err(), "rpc-gateway did not stop")
+		}
+	}
+
+	return nil
+}
+
+// shutdown stops accepting requests and waits for the ones in flight, until
+// the context is done. The next process can take over the port meanwhile.
+// Once the sockets are handed over to another gateway, the connections
+// accepted last send their request before the server is shut down.
+func (r *RPCGateway) shutdown(c context.Context) error {
+	if r.ports.isPaused() {
+		r.conns.await(c)
+	}
+
+	if err := r.server.Shutdown(c); err != nil {
+		r.server.Close()
+
+		return errors.Wrap(err, "failed to stop rpc-gateway")
+	}
+
+	return nil
 }
 
-func NewRPCGateway(config RPCGatewayConfig) (*RPCGateway, error) {
-	logLevel := slog.LevelWarn
-	if os.Getenv("DEBUG") == "true" {
-		logLevel = slog.LevelDebug
+// NewRPCGateway creates an RPCGateway from the given configuration. Options
+// customize it further when it's embedded in another program.
+func NewRPCGateway(config RPCGatewayConfig, opts ...Option) (*RPCGateway, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.overrides != nil {
+		overridden, err := o.overrides.Apply(config)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid config overrides")
+		}
+
+		config = overridden
+	}
+
+	if o.check {
+		config = config.forCheck()
+	}
+
+	logLevel, err := config.logLevel()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid config")
 	}
 
 	logger := httplog.NewLogger("rpc-gateway", httplog.Options{
@@ -70,14 +299,76 @@ func NewRPCGateway(config RPCGatewayConfig) (*RPCGateway, error) {
 		LogLevel:       logLevel,
 	})
 
+	if o.logger == nil {
+		o.logger = slog.New(
+			slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+				Level: logLevel,
+			}))
+	} else {
+		logger.Logger = o.logger
+	}
+
+	if config.TargetsDir != "" {
+		targets, err := loadTargetsDir(config.TargetsDir, config.Targets, config.StrictTargetsDir, o.logger)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid config")
+		}
+
+		config.Targets = targets
+	}
+
+	if len(config.Targets) == 0 {
+		return nil, errors.Wrap(ErrNoTargetConfigured, "invalid config")
+	}
+
+	// A nil *prometheus.Registry must not end up in the interfaces below,
+	// otherwise the default registry wouldn't be used.
+	//
+	var (
+		registerer prometheus.Registerer
+		gatherer   prometheus.Gatherer
+	)
+
+	if o.registry != nil {
+		registerer = o.registry
+		gatherer = o.registry
+	}
+
+	if err := config.Metrics.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid metrics config")
+	}
+
+	adminToken, err := config.Admin.token()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid admin config")
+	}
+
+	if config.Admin.enabled() && adminToken == "" {
+		o.logger.Warn("the admin API is served without a token, anyone reaching its port can drain, taint and flush",
+			"address", net.JoinHostPort(config.Admin.host(), config.Admin.Port))
+	}
+
+	build := buildinfo.Resolve("", "", "")
+	if o.build != nil {
+		build = *o.build
+	}
+
+	registerBuildInfo(registerer, config.Metrics.Namespace(), build)
+
+	if config.Proxy.UserAgent == "" {
+		config.Proxy.UserAgent = proxy.DefaultUserAgent + "/" + build.Version
+	}
+
 	hcm, err := proxy.NewHealthCheckManager(
 		proxy.HealthCheckManagerConfig{
-			Targets: config.Targets,
-			Config:  config.HealthChecks,
-			Logger: slog.New(
-				slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
-					Level: logLevel,
-				})),
+			Targets:         config.Targets,
+			Config:          config.HealthChecks,
+			Metrics:         config.Metrics,
+			Logger:          o.logger,
+			Registerer:      registerer,
+			Transports:      o.transports,
+			HealthObservers: o.healthObservers,
+			UserAgent:       config.Proxy.UserAgent,
 		})
 	if err != nil {
 		return nil, errors.Wrap(err, "healthcheckmanager failed")
@@ -89,55 +380,113 @@ func NewRPCGateway(config RPCGatewayConfig) (*RPCGateway, error) {
 			Targets:            config.Targets,
 			HealthChecks:       config.HealthChecks,
 			HealthcheckManager: hcm,
+			Metrics:            config.Metrics,
+			Registerer:         registerer,
+			Transports:         o.transports,
+			TargetSelector:     o.selector,
+			Logger:             o.logger,
 		},
 	)
 	if err != nil {
 		return nil, errors.Wrap(err, "proxy failed")
 	}
 
+	headers, err := responseHeaders(config.Proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy config")
+	}
+
 	r := chi.NewRouter()
 	r.Use(httplog.RequestLogger(logger))
 
+	// The response headers wrap every other middleware, so they apply to
+	// the errors of the gateway as well, and after the headers of the
+	// targets and of the gateway are set.
+	//
+	r.Use(headers)
+
 	// Recoverer is a middleware that recovers from panics, logs the panic (and
 	// a backtrace), and returns a HTTP 500 (Internal Server Error) status if
 	// possible. Recoverer prints a request ID if one is provided.
 	//
 	r.Use(middleware.Recoverer)
 
+	if config.Proxy.ServerHeader == nil || *config.Proxy.ServerHeader {
+		r.Use(serverHeader(build))
+	}
+
 	r.Handle("/", proxy)
 
+	if config.Proxy.Stream.Enabled {
+		r.Post("/stream", proxy.ServeStream)
+	}
+
+	server := &http.Server{
+		Addr:              fmt.Sprintf(":%s", config.Proxy.Port),
+		Handler:           r,
+		WriteTimeout:      time.Second * 15,
+		ReadTimeout:       time.Second * 15,
+		ReadHeaderTimeout: time.Second * 5,
+	}
+
+	if config.Proxy.EnableH2C {
+		if err := withH2C(server, config.Proxy); err != nil {
+			return nil, errors.Wrap(err, "invalid proxy config")
+		}
+	}
+
+	ready := make(chan struct{})
+	ports := newPortBinder(config.Listener)
+
+	conns := &newConns{}
+	server.ConnState = conns.track
+
 	return &RPCGateway{
 		config: config,
 		proxy:  proxy,
 		hcm:    hcm,
+		admin:  newAdminServer(config.Admin, adminToken, proxy, hcm),
 		metrics: metrics.NewServer(
 			metrics.Config{
-				Port: config.Metrics.Port,
+				Port:     config.Metrics.Port,
+				Required: config.Metrics.Required,
+				Host:     config.Metrics.Host,
+				Listen: func(address string) (net.Listener, error) {
+					return ports.listen("metrics", address)
+				},
 			},
+			gatherer,
+			o.logger,
+			ready,
+			statusSource{proxy: proxy, hcm: hcm},
+			build,
 		),
-		server: &http.Server{
-			Addr:              fmt.Sprintf(":%s", config.Proxy.Port),
-			Handler:           r,
-			WriteTimeout:      time.Second * 15,
-			ReadTimeout:       time.Second * 15,
-			ReadHeaderTimeout: time.Second * 5,
-		},
+		ports:  ports,
+		conns:  conns,
+		logger: o.logger,
+		build:  build,
+		ready:  ready,
+		server: server,
+		check:  o.check,
 	}, nil
 }
 
 // NewRPCGatewayFromConfigFile creates an instance of RPCGateway from provided
-// configuration file.
-func NewRPCGatewayFromConfigFile(s string) (*RPCGateway, error) {
+// configuration file, either YAML or JSON.
+func NewRPCGatewayFromConfigFile(s string, opts ...Option) (*RPCGateway, error) {
 	data, err := os.ReadFile(s)
 	if err != nil {
 		return nil, err
 	}
 
-	var config RPCGatewayConfig
-
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	config, err := parseConfig(s, data)
+	if err != nil {
 		return nil, err
 	}
 
-	return NewRPCGateway(config)
+	if config.TargetsDir != "" && !filepath.IsAbs(config.TargetsDir) {
+		config.TargetsDir = filepath.Join(filepath.Dir(s), config.TargetsDir)
+	}
+
+	return NewRPCGateway(config, opts...)
 }
@@ -0,0 +1,566 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/metrics"
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/goleak"
+)
+
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+func TestRPCGatewayStopWaitsForStart(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval: 10 * time.Millisecond,
+				Timeout:  time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	// Let a few health checks run before stopping.
+	time.Sleep(50 * time.Millisecond)
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, gw.Stop(c))
+	assert.NoError(t, <-started)
+}
+
+func TestRPCGatewayStopClosesProxyAfterRequestsInFlight(t *testing.T) {
+	var (
+		inflight = make(chan struct{})
+		release  = make(chan struct{})
+	)
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if bytes.Contains(body, []byte("eth_getLogs")) {
+			close(inflight)
+			<-release
+		}
+
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x10"}`)) // nolint:errcheck
+	}))
+	defer node.Close()
+
+	samples := filepath.Join(t.TempDir(), "samples.jsonl")
+	port := freePort(t)
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            port,
+				UpstreamTimeout: 5 * time.Second,
+				DebugSampling: proxy.DebugSamplingConfig{
+					Rate: 1,
+					Sink: proxy.DebugSamplingSinkFile,
+					Path: samples,
+				},
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval: time.Minute,
+				Timeout:  time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	<-gw.Ready()
+
+	responses := make(chan int)
+
+	go func() {
+		resp, err := http.Post("http://127.0.0.1:"+port+"/", "application/json",
+			bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_getLogs","params":[]}`))
+		if !assert.NoError(t, err) {
+			responses <- 0
+
+			return
+		}
+
+		resp.Body.Close()
+		responses <- resp.StatusCode
+	}()
+
+	<-inflight
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stopped := make(chan error)
+
+	go func() {
+		stopped <- gw.Stop(c)
+	}()
+
+	// The request outlives the cancellation of Start, the proxy is only
+	// closed once it's done.
+	//
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	assert.Equal(t, http.StatusOK, <-responses)
+	assert.NoError(t, <-stopped)
+	assert.NoError(t, <-started)
+
+	written, err := os.ReadFile(samples)
+	assert.NoError(t, err)
+	assert.Contains(t, string(written), "eth_getLogs")
+}
+
+func TestRPCGatewayServesWithoutMetricsPort(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	occupied, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+
+	defer occupied.Close()
+
+	required := false
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Metrics: metrics.Config{
+				Port:     uint(occupied.Addr().(*net.TCPAddr).Port),
+				Required: &required,
+			},
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval: 10 * time.Millisecond,
+				Timeout:  time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	select {
+	case err := <-started:
+		t.Fatalf("gateway stopped: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	rec := httptest.NewRecorder()
+
+	gw.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", body))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, gw.MetricsAddr())
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, gw.Stop(c))
+	assert.NoError(t, <-started)
+}
+
+func TestRPCGatewayFailsWithoutRequiredMetricsPort(t *testing.T) {
+	occupied, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+
+	defer occupied.Close()
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Metrics: metrics.Config{
+				Port: uint(occupied.Addr().(*net.TCPAddr).Port),
+			},
+			Proxy: proxy.ProxyConfig{
+				Port: "0",
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name:       "mock",
+					Connection: proxy.NodeProviderConnectionConfig{Mock: &proxy.NodeProviderConnectionMockConfig{}},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, gw.Stop(c))
+	assert.ErrorContains(t, <-started, "failed to start metrics server")
+}
+
+func TestRPCGatewayMetricsOnEphemeralPort(t *testing.T) {
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port: "0",
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name:       "mock",
+					Connection: proxy.NodeProviderConnectionConfig{Mock: &proxy.NodeProviderConnectionMockConfig{}},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	assert.Eventually(t, func() bool { return gw.MetricsAddr() != nil }, time.Second, time.Millisecond)
+
+	res, err := http.Get(fmt.Sprintf("http://127.0.0.1:%d/metrics", gw.MetricsAddr().(*net.TCPAddr).Port))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	res.Body.Close()
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, gw.Stop(c))
+	assert.NoError(t, <-started)
+}
+
+func TestRPCGatewayWaitsForFirstHealthChecks(t *testing.T) {
+	release := make(chan struct{})
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer node.Close()
+	defer close(release)
+
+	port := freePort(t)
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            port,
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval:              time.Second,
+				Timeout:               5 * time.Second,
+				WaitForHealthyOnStart: true,
+				StartupTimeout:        5 * time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+
+	select {
+	case <-gw.Ready():
+		t.Fatal("gateway ready before the first health check")
+	default:
+	}
+
+	_, err = net.Dial("tcp", "127.0.0.1:"+port)
+	assert.Error(t, err)
+
+	release <- struct{}{}
+	release <- struct{}{}
+
+	select {
+	case <-gw.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("gateway not ready after the first health check")
+	}
+
+	conn, err := net.Dial("tcp", "127.0.0.1:"+port)
+	assert.NoError(t, err)
+	conn.Close()
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, gw.Stop(c))
+	assert.NoError(t, <-started)
+}
+
+func TestRPCGatewayServesAfterStartupTimeout(t *testing.T) {
+	stalled := make(chan struct{})
+
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-stalled
+	}))
+	defer node.Close()
+	defer close(stalled)
+
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port:            "0",
+				UpstreamTimeout: time.Second,
+			},
+			HealthChecks: proxy.HealthCheckConfig{
+				Interval:              time.Second,
+				Timeout:               time.Second,
+				WaitForHealthyOnStart: true,
+				StartupTimeout:        50 * time.Millisecond,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: node.URL,
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	started := make(chan error)
+
+	go func() {
+		started <- gw.Start(context.Background())
+	}()
+
+	select {
+	case <-gw.Ready():
+	case <-time.After(time.Second):
+		t.Fatal("gateway not ready after the startup timeout")
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, gw.Stop(c))
+	assert.NoError(t, <-started)
+}
+
+// freePort returns a port nothing listens on.
+func freePort(t testing.TB) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", ":0")
+	assert.NoError(t, err)
+
+	defer listener.Close()
+
+	return strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
+}
+
+// newFakeNode answers every call with the same result, which is enough for
+// both the proxied requests and the health checks.
+func newFakeNode(t testing.TB) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+}
+
+func TestRPCGatewayReturnsInvalidTargetErrors(t *testing.T) {
+	_, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port: "0",
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "Server1",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{URL: "localhost:8545"},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.ErrorContains(t, err, `invalid target "Server1"`)
+}
+
+func TestNewRPCGatewayRefusesConfigWithoutTargets(t *testing.T) {
+	_, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				Port: "0",
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.ErrorIs(t, err, ErrNoTargetConfigured)
+}
+
+func TestRPCGatewayServesStreams(t *testing.T) {
+	node := newFakeNode(t)
+	defer node.Close()
+
+	for _, enabled := range []bool{false, true} {
+		gw, err := NewRPCGateway(
+			RPCGatewayConfig{
+				Proxy: proxy.ProxyConfig{
+					Port:            "0",
+					UpstreamTimeout: time.Second,
+					Stream:          proxy.StreamConfig{Enabled: enabled},
+				},
+				Targets: []proxy.NodeProviderConfig{
+					{
+						Name: "upstream",
+						Connection: proxy.NodeProviderConnectionConfig{
+							HTTP: proxy.NodeProviderConnectionHTTPConfig{
+								URL: node.URL,
+							},
+						},
+					},
+				},
+			},
+			WithRegistry(prometheus.NewRegistry()),
+			WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		)
+		assert.NoError(t, err)
+
+		server := httptest.NewServer(gw)
+
+		resp, err := http.Post(server.URL+"/stream", proxy.StreamContentType, bytes.NewBufferString(
+			`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`+"\n"+
+				`{"jsonrpc":"2.0","id":1,"method":"eth_chainId"}`+"\n"))
+		assert.NoError(t, err)
+
+		body, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		resp.Body.Close()
+
+		if enabled {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":\"0x1\"}\n"+
+				"{\"jsonrpc\":\"2.0\",\"id\":1,\"result\":\"0x1\"}\n", string(body))
+		} else {
+			assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		}
+
+		server.Close()
+	}
+}
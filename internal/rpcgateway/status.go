@@ -0,0 +1,65 @@
+package rpcgateway
+
+import (
+	"fmt"
+
+	"github.com/0xProject/rpc-gateway/internal/metrics"
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+)
+
+// statusSource lists the targets on the status page of the metrics server.
+type statusSource struct {
+	proxy *proxy.Proxy
+	hcm   *proxy.HealthCheckManager
+}
+
+func (s statusSource) ProviderStatuses() []metrics.ProviderStatus {
+	snapshots := map[string]proxy.ProviderStatus{}
+	for _, snapshot := range s.hcm.Snapshot() {
+		snapshots[snapshot.Name] = snapshot
+	}
+
+	statuses := []metrics.ProviderStatus{}
+
+	for _, stats := range s.proxy.Stats() {
+		snapshot := snapshots[stats.Name]
+
+		status := metrics.ProviderStatus{
+			Name:         stats.Name,
+			State:        stats.State,
+			Healthy:      snapshot.Healthy,
+			WriteHealthy: snapshot.WriteHealthy,
+			BlockNumber:  snapshot.BlockNumber,
+			Lag:          snapshot.Lag,
+			SuccessRate:  snapshot.SuccessRate,
+			Observations: snapshot.Observations,
+			Score:        stats.Score,
+		}
+
+		for _, taint := range snapshot.Taints {
+			if taint.Class != "" {
+				status.Taints = append(status.Taints, taint.Reason+" ("+taint.Class+")")
+			} else {
+				status.Taints = append(status.Taints, taint.Reason)
+			}
+		}
+
+		if recent, err := s.proxy.RecentErrors(stats.Name); err == nil && len(recent) > 0 {
+			status.LastError = describeRecentError(recent[0])
+			status.LastErrorTime = recent[0].Time
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+func describeRecentError(e proxy.RecentError) string {
+	detail := e.Error
+	if detail == "" {
+		detail = e.Snippet
+	}
+
+	return fmt.Sprintf("%s HTTP %d %s", e.Method, e.StatusCode, detail)
+}
@@ -0,0 +1,53 @@
+package rpcgateway
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusSourceListsProviders(t *testing.T) {
+	gw, err := NewRPCGateway(
+		RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.NodeProviderConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.NodeProviderConnectionConfig{
+						HTTP: proxy.NodeProviderConnectionHTTPConfig{
+							URL: "http://127.0.0.1:1",
+						},
+					},
+				},
+			},
+		},
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.NoError(t, err)
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	gw.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", body))
+
+	assert.NoError(t, gw.hcm.Taint("upstream", proxy.TaintReasonManual, 0))
+
+	statuses := statusSource{proxy: gw.proxy, hcm: gw.hcm}.ProviderStatuses()
+
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "upstream", statuses[0].Name)
+	assert.Equal(t, proxy.TargetStateActive, statuses[0].State)
+	assert.Equal(t, []string{proxy.TaintReasonManual}, statuses[0].Taints)
+	assert.Equal(t, 1, statuses[0].Observations)
+	assert.Zero(t, statuses[0].SuccessRate)
+	assert.Contains(t, statuses[0].LastError, "eth_blockNumber HTTP 502")
+}
@@ -0,0 +1,117 @@
+package rpcgateway
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// loadTargetsDir returns the inline targets followed by the ones of the
+// *.yml and *.yaml files of dir, in the order of their file names. A file
+// holds either a list of targets or a single one. Files that can't be read,
+// are invalid or declare a name already taken are skipped as a whole and
+// logged, unless strict, in which case they fail the load.
+func loadTargetsDir(
+	dir string,
+	inline []proxy.NodeProviderConfig,
+	strict bool,
+	logger *slog.Logger,
+) ([]proxy.NodeProviderConfig, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read targets directory")
+	}
+
+	targets := append([]proxy.NodeProviderConfig(nil), inline...)
+
+	sources := make(map[string]string, len(inline))
+	for _, target := range inline {
+		sources[target.Name] = "the inline targets"
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !isTargetsFile(name) {
+			continue
+		}
+
+		loaded, err := loadTargetsFile(filepath.Join(dir, name), sources)
+		if err != nil {
+			if strict {
+				return nil, errors.Wrapf(err, "invalid targets file %q", name)
+			}
+
+			logger.Error("skipping invalid targets file", "file", name, "error", err)
+
+			continue
+		}
+
+		for _, target := range loaded {
+			sources[target.Name] = name
+		}
+
+		targets = append(targets, loaded...)
+	}
+
+	return targets, nil
+}
+
+func isTargetsFile(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".yml", ".yaml":
+		return true
+	default:
+		return false
+	}
+}
+
+// loadTargetsFile parses the targets of the file at path. sources maps the
+// names already taken to where they were declared.
+func loadTargetsFile(path string, sources map[string]string) ([]proxy.NodeProviderConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []proxy.NodeProviderConfig
+
+	if err := yaml.Unmarshal(data, &targets); err != nil {
+		var target proxy.NodeProviderConfig
+
+		if yaml.Unmarshal(data, &target) != nil {
+			return nil, err
+		}
+
+		targets = []proxy.NodeProviderConfig{target}
+	}
+
+	if len(targets) == 0 {
+		return nil, errors.New("no target")
+	}
+
+	names := make(map[string]bool, len(targets))
+
+	for _, target := range targets {
+		if err := target.Validate(); err != nil {
+			return nil, err
+		}
+
+		if source, ok := sources[target.Name]; ok {
+			return nil, errors.Errorf("target %q is already declared in %s", target.Name, source)
+		}
+
+		if names[target.Name] {
+			return nil, errors.Errorf("target %q is declared twice", target.Name)
+		}
+
+		names[target.Name] = true
+	}
+
+	return targets, nil
+}
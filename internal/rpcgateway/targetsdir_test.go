@@ -0,0 +1,149 @@
+package rpcgateway
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTargetsDir writes a targets directory with valid files, a broken one
+// and one redeclaring a target of an earlier file.
+func writeTargetsDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"20-infura.yml": `
+- name: "Infura"
+  connection:
+    http:
+      url: "http://127.0.0.1:8546"
+- name: "Infura2"
+  connection:
+    http:
+      url: "http://127.0.0.1:8547"
+`,
+		"10-alchemy.yaml": `
+name: "Alchemy"
+connection:
+  http:
+    url: "http://127.0.0.1:8545"
+`,
+		"15-broken.yml":    "- name: [\n",
+		"16-nameless.yml":  "- connection:\n    http:\n      url: \"http://127.0.0.1:8548\"\n",
+		"30-duplicate.yml": "- name: \"Alchemy\"\n  connection:\n    http:\n      url: \"http://127.0.0.1:8549\"\n",
+		".hidden.yml":      "- name: \"Hidden\"\n  connection:\n    http:\n      url: \"http://127.0.0.1:8550\"\n",
+		"README.md":        "not a target",
+	}
+
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+
+	return dir
+}
+
+func targetNames(targets []proxy.NodeProviderConfig) []string {
+	names := make([]string, 0, len(targets))
+	for _, target := range targets {
+		names = append(names, target.Name)
+	}
+
+	return names
+}
+
+func TestLoadTargetsDir(t *testing.T) {
+	dir := writeTargetsDir(t)
+
+	inline := []proxy.NodeProviderConfig{
+		{
+			Name:       "Inline",
+			Connection: proxy.NodeProviderConnectionConfig{HTTP: proxy.NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8544"}},
+		},
+	}
+
+	targets, err := loadTargetsDir(dir, inline, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"Inline", "Alchemy", "Infura", "Infura2"}, targetNames(targets))
+	assert.Equal(t, "http://127.0.0.1:8545", targets[1].Connection.HTTP.URL)
+}
+
+func TestLoadTargetsDirStrict(t *testing.T) {
+	dir := writeTargetsDir(t)
+
+	_, err := loadTargetsDir(dir, nil, true, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "15-broken.yml")
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "15-broken.yml")))
+	require.NoError(t, os.Remove(filepath.Join(dir, "16-nameless.yml")))
+
+	_, err = loadTargetsDir(dir, nil, true, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `target "Alchemy" is already declared in 10-alchemy.yaml`)
+}
+
+func TestLoadTargetsDirRejectsInlineDuplicates(t *testing.T) {
+	dir := writeTargetsDir(t)
+
+	inline := []proxy.NodeProviderConfig{
+		{
+			Name:       "Infura",
+			Connection: proxy.NodeProviderConnectionConfig{HTTP: proxy.NodeProviderConnectionHTTPConfig{URL: "http://127.0.0.1:8544"}},
+		},
+	}
+
+	targets, err := loadTargetsDir(dir, inline, false, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	require.NoError(t, err)
+
+	// The whole file declaring the duplicate is skipped.
+	//
+	assert.Equal(t, []string{"Infura", "Alchemy"}, targetNames(targets))
+}
+
+func TestRPCGatewayLoadsTargetsDirRelativeToConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "targets.d"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "targets.d", "node.yml"),
+		[]byte("- name: \"Node\"\n  connection:\n    http:\n      url: \"http://127.0.0.1:8545\"\n"), 0o600))
+
+	path := filepath.Join(dir, "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+proxy:
+  port: "0"
+  upstreamTimeout: "1s"
+healthChecks:
+  interval: "5s"
+  timeout: "1s"
+targetsDir: "targets.d"
+`), 0o600))
+
+	gateway, err := NewRPCGatewayFromConfigFile(path,
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	require.NoError(t, err)
+
+	require.Len(t, gateway.proxy.Targets(), 1)
+	assert.Equal(t, "Node", gateway.proxy.Targets()[0].Name())
+
+	// A missing directory fails the load, whatever the strictness.
+	//
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "targets.d")))
+
+	_, err = NewRPCGatewayFromConfigFile(path,
+		WithRegistry(prometheus.NewRegistry()),
+		WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	assert.ErrorContains(t, err, "cannot read targets directory")
+}
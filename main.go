@@ -6,29 +6,104 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
 	"github.com/0xProject/rpc-gateway/internal/rpcgateway"
 	"github.com/carlmjohnson/flowmatic"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli/v2"
 )
 
+// shutdownTimeout bounds how long the gateway waits for its components to
+// stop.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
 	c, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
 	app := &cli.App{
-		Name:  "rpc-gateway",
-		Usage: "The failover proxy for node providers.",
+		Name:    "rpc-gateway",
+		Usage:   "The failover proxy for node providers.",
+		Version: buildinfo.Resolve(version, commit, buildDate).Version,
 		Flags: []cli.Flag{
 			&cli.StringFlag{
-				Name:     "config",
-				Usage:    "The configuration file path.",
-				Required: true,
+				Name:  "config",
+				Usage: "The configuration file path, or an HTTP(S) URL to fetch it from. Required, except by the probe command.",
+			},
+			&cli.DurationFlag{
+				Name:  "config-poll-interval",
+				Usage: "How often a remote configuration is fetched again, changes are applied by restarting the gateway. 0 disables polling.",
+			},
+			&cli.DurationFlag{
+				Name:  "config-timeout",
+				Usage: "How long fetching a remote configuration may take.",
+				Value: rpcgateway.DefaultRemoteConfigTimeout,
+			},
+			&cli.StringFlag{
+				Name:    "config-token",
+				Usage:   "Bearer token sent when fetching a remote configuration.",
+				EnvVars: []string{"RPC_GATEWAY_CONFIG_TOKEN"},
+			},
+			&cli.StringFlag{
+				Name:    "port",
+				Usage:   "Overrides proxy.port of the configuration.",
+				EnvVars: []string{"RPC_GATEWAY_PORT"},
+			},
+			&cli.UintFlag{
+				Name:    "metrics-port",
+				Usage:   "Overrides metrics.port of the configuration.",
+				EnvVars: []string{"RPC_GATEWAY_METRICS_PORT"},
+			},
+			&cli.StringFlag{
+				Name:    "log-level",
+				Usage:   "Overrides logLevel of the configuration: debug, info, warn or error.",
+				EnvVars: []string{"RPC_GATEWAY_LOG_LEVEL"},
+			},
+			&cli.DurationFlag{
+				Name:    "upstream-timeout",
+				Usage:   "Overrides proxy.upstreamTimeout of the configuration.",
+				EnvVars: []string{"RPC_GATEWAY_UPSTREAM_TIMEOUT"},
+			},
+			&cli.BoolFlag{
+				Name:  "check",
+				Usage: "Starts the gateway without binding its ports, sends an eth_chainId request through it, prints a summary and exits 0 when it was served, 1 otherwise.",
 			},
 		},
+		Commands: []*cli.Command{probeCommand()},
 		Action: func(cc *cli.Context) error {
-			service, err := rpcgateway.NewRPCGatewayFromConfigFile(cc.String("config"))
+			// The flag isn't declared as required, as the probe command
+			// would need it too.
+			//
+			if !cc.IsSet("config") {
+				return errors.New(`required flag "config" not set`)
+			}
+
+			overrides := rpcgateway.WithConfigOverrides(configOverrides(cc))
+			build := rpcgateway.WithBuildInfo(buildinfo.Resolve(version, commit, buildDate))
+
+			if cc.Bool("check") {
+				return check(c, cc, overrides, build)
+			}
+
+			if rpcgateway.IsRemoteConfig(cc.String("config")) {
+				source, err := rpcgateway.NewRemoteConfigSource(
+					cc.String("config"),
+					cc.String("config-token"),
+					cc.Duration("config-timeout"),
+				)
+				if err != nil {
+					return errors.Wrap(err, "rpc-gateway failed")
+				}
+
+				return errors.Wrap(
+					rpcgateway.RunWithRemoteConfig(c, source, cc.Duration("config-poll-interval"), shutdownTimeout, overrides, build),
+					"rpc-gateway failed",
+				)
+			}
+
+			service, err := rpcgateway.NewRPCGatewayFromConfigFile(cc.String("config"), overrides, build)
 			if err != nil {
 				return errors.Wrap(err, "rpc-gateway failed")
 			}
@@ -40,7 +115,13 @@ func main() {
 				func() error {
 					<-c.Done()
 
-					return errors.Wrap(service.Stop(c), "cannot stop a service")
+					// c is already done at this point, so the shutdown gets
+					// its own deadline.
+					//
+					stopCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+					defer cancel()
+
+					return errors.Wrap(service.Stop(stopCtx), "cannot stop a service")
 				},
 			)
 		},
@@ -50,3 +131,114 @@ func main() {
 		fmt.Fprintf(os.Stderr, "error: %v", err)
 	}
 }
+
+// probeCommand checks a running gateway and exits 1 when it's unhealthy, for
+// the healthchecks of the images without curl.
+func probeCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "probe",
+		Usage: "Exits 0 when the gateway is ready, 1 otherwise.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "url",
+				Usage: "The /readyz endpoint of the gateway.",
+				Value: rpcgateway.DefaultProbeURL,
+			},
+			&cli.StringFlag{
+				Name:  "rpc",
+				Usage: "The proxy of the gateway, probed with an eth_chainId call instead of /readyz when set.",
+			},
+			&cli.DurationFlag{
+				Name:  "timeout",
+				Usage: "How long the probe may take.",
+				Value: 2 * time.Second,
+			},
+		},
+		Action: func(cc *cli.Context) error {
+			c, cancel := context.WithTimeout(cc.Context, cc.Duration("timeout"))
+			defer cancel()
+
+			probe := func() error { return rpcgateway.ProbeReady(c, cc.String("url")) }
+			if cc.IsSet("rpc") {
+				probe = func() error { return rpcgateway.ProbeRPC(c, cc.String("rpc")) }
+			}
+
+			if err := probe(); err != nil {
+				return cli.Exit("unhealthy: "+err.Error(), 1)
+			}
+
+			return nil
+		},
+	}
+}
+
+// check runs the self-check of the gateway configured by the config flag.
+func check(c context.Context, cc *cli.Context, opts ...rpcgateway.Option) error {
+	opts = append(opts, rpcgateway.WithCheckMode())
+
+	var (
+		service *rpcgateway.RPCGateway
+		err     error
+	)
+
+	if rpcgateway.IsRemoteConfig(cc.String("config")) {
+		service, err = newRemoteConfigGateway(c, cc, opts...)
+	} else {
+		service, err = rpcgateway.NewRPCGatewayFromConfigFile(cc.String("config"), opts...)
+	}
+
+	if err != nil {
+		return cli.Exit("check failed: "+err.Error(), 1)
+	}
+
+	result, err := service.Check(c)
+	fmt.Print(result)
+
+	if err != nil {
+		return cli.Exit("check failed: "+err.Error(), 1)
+	}
+
+	fmt.Println("check passed")
+
+	return nil
+}
+
+// newRemoteConfigGateway creates a gateway from the remote configuration of
+// the config flag, fetched once.
+func newRemoteConfigGateway(c context.Context, cc *cli.Context, opts ...rpcgateway.Option) (*rpcgateway.RPCGateway, error) {
+	source, err := rpcgateway.NewRemoteConfigSource(
+		cc.String("config"),
+		cc.String("config-token"),
+		cc.Duration("config-timeout"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	config, _, err := source.Fetch(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return rpcgateway.NewRPCGateway(config, opts...)
+}
+
+// configOverrides returns the configuration values set by flags or their
+// environment variables. Flags take precedence over environment variables,
+// which take precedence over the configuration file.
+func configOverrides(cc *cli.Context) rpcgateway.ConfigOverrides {
+	overrides := rpcgateway.ConfigOverrides{
+		Port:            cc.String("port"),
+		LogLevel:        cc.String("log-level"),
+		UpstreamTimeout: cc.Duration("upstream-timeout"),
+	}
+
+	// Port 0 is meaningful, so only a set flag overrides it.
+	//
+	if cc.IsSet("metrics-port") {
+		port := cc.Uint("metrics-port")
+		overrides.MetricsPort = &port
+	}
+
+	return overrides
+}
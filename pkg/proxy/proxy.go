@@ -0,0 +1,165 @@
+// Package proxy exposes the failover proxy and the health check manager to
+// programs embedding the gateway as a library. It's a thin façade over the
+// internal implementation, so both always behave the same.
+package proxy
+
+import (
+	"github.com/0xProject/rpc-gateway/internal/proxy"
+)
+
+type (
+	// Config is the input of NewProxy.
+	Config = proxy.Config
+	// ProxyConfig is the "proxy" section of the configuration file.
+	ProxyConfig = proxy.ProxyConfig //nolint:revive
+	// HealthCheckConfig is the "healthChecks" section of the configuration
+	// file.
+	HealthCheckConfig = proxy.HealthCheckConfig
+	// HealthCheckProbe is an entry of the "healthChecks.probes" section.
+	HealthCheckProbe = proxy.HealthCheckProbe
+	// CanaryConfig is the "healthChecks.canary" section.
+	CanaryConfig = proxy.CanaryConfig
+	// ErrorNormalizationConfig is the "proxy.errorNormalization" section.
+	ErrorNormalizationConfig = proxy.ErrorNormalizationConfig
+	// ErrorNormalizationRule maps a provider error to a canonical error.
+	ErrorNormalizationRule = proxy.ErrorNormalizationRule
+	// CanonicalError is the error an ErrorNormalizationRule rewrites to.
+	CanonicalError = proxy.CanonicalError
+	// SlowQueryLogConfig is the "proxy.slowQueryLog" section.
+	SlowQueryLogConfig = proxy.SlowQueryLogConfig
+	// RetryConfig is the "proxy.retry" section.
+	RetryConfig = proxy.RetryConfig
+	// FaultInjectionConfig is the "proxy.faultInjection" section.
+	FaultInjectionConfig = proxy.FaultInjectionConfig
+	// RecentErrorsConfig is the "proxy.recentErrors" section.
+	RecentErrorsConfig = proxy.RecentErrorsConfig
+	// DebugTraceConfig is the "proxy.debugTrace" section.
+	DebugTraceConfig = proxy.DebugTraceConfig
+
+	// DebugSamplingConfig is the "proxy.debugSampling" section.
+	DebugSamplingConfig = proxy.DebugSamplingConfig
+	// StatusPolicyConfig is the "proxy.statusPolicy" section.
+	StatusPolicyConfig = proxy.StatusPolicyConfig
+	// JSONRPCErrorActionsConfig is the "proxy.jsonRpcErrorActions" section.
+	JSONRPCErrorActionsConfig = proxy.JSONRPCErrorActionsConfig
+	// JSONRPCErrorAction is an entry of the "proxy.jsonRpcErrorActions"
+	// section.
+	JSONRPCErrorAction = proxy.JSONRPCErrorAction
+	// ComputeUnitsConfig is the "proxy.computeUnits" section.
+	ComputeUnitsConfig = proxy.ComputeUnitsConfig
+	// CacheControlConfig is the "proxy.cacheControl" section.
+	CacheControlConfig = proxy.CacheControlConfig
+	// StreamConfig is the "proxy.stream" section.
+	StreamConfig = proxy.StreamConfig
+	// ScoreConfig is the "proxy.score" section.
+	ScoreConfig = proxy.ScoreConfig
+	// FailoverBreakerConfig is the "proxy.failoverBreaker" section.
+	FailoverBreakerConfig = proxy.FailoverBreakerConfig
+	// PermanentFailuresConfig is the "proxy.permanentFailures" section.
+	PermanentFailuresConfig = proxy.PermanentFailuresConfig
+	// ImmutableCacheConfig is the "proxy.immutableCache" section.
+	ImmutableCacheConfig = proxy.ImmutableCacheConfig
+	// NotFoundCacheConfig is the "proxy.immutableCache.notFound" section.
+	NotFoundCacheConfig = proxy.NotFoundCacheConfig
+	// CacheBackendConfig is the "proxy.cacheBackend" section.
+	CacheBackendConfig = proxy.CacheBackendConfig
+	// RedisCacheConfig is the "proxy.cacheBackend.redis" section.
+	RedisCacheConfig = proxy.RedisCacheConfig
+	// TargetConfig is a single entry of the "targets" section of the
+	// configuration file.
+	TargetConfig = proxy.NodeProviderConfig
+	// TargetConnectionConfig is the "connection" section of a target.
+	TargetConnectionConfig = proxy.NodeProviderConnectionConfig
+	// TargetConnectionHTTPConfig is the "connection.http" section of a target.
+	TargetConnectionHTTPConfig = proxy.NodeProviderConnectionHTTPConfig
+	// TargetTransportConfig is the "connection.http.transport" section of a
+	// target.
+	TargetTransportConfig = proxy.NodeProviderTransportConfig
+	// TargetRedirectsConfig is the "connection.http.redirects" section of a
+	// target.
+	TargetRedirectsConfig = proxy.NodeProviderRedirectsConfig
+	// TargetConnectionIPCConfig is the "connection.ipc" section of a target.
+	TargetConnectionIPCConfig = proxy.NodeProviderConnectionIPCConfig
+	// TargetConnectionMockConfig is the "connection.mock" section of a target.
+	TargetConnectionMockConfig = proxy.NodeProviderConnectionMockConfig
+	// TargetDNSConfig is the "dns" section of a target.
+	TargetDNSConfig = proxy.NodeProviderDNSConfig
+	// TargetWarmUpConfig is the "warmUp" section of a target.
+	TargetWarmUpConfig = proxy.NodeProviderWarmUpConfig
+	// TargetHealthCheckConfig is the "healthCheck" section of a target.
+	TargetHealthCheckConfig = proxy.NodeProviderHealthCheckConfig
+	// TargetFaultsConfig is the "faults" section of a target.
+	TargetFaultsConfig = proxy.FaultConfig
+	// TargetMaintenanceWindowConfig is an entry of the "maintenanceWindows"
+	// section of a target.
+	TargetMaintenanceWindowConfig = proxy.MaintenanceWindowConfig
+	// HTTPHealthCheckConfig is the "healthCheck.http" section of a target.
+	HTTPHealthCheckConfig = proxy.HTTPHealthCheckConfig
+	// WriteHealthCheckConfig is the "healthCheck.write" section of a target.
+	WriteHealthCheckConfig = proxy.WriteHealthCheckConfig
+	// HealthCheckManagerConfig is the input of NewHealthCheckManager.
+	HealthCheckManagerConfig = proxy.HealthCheckManagerConfig
+
+	// Proxy is an http.Handler routing requests to the healthy targets.
+	Proxy = proxy.Proxy
+	// HealthCheckManager runs the health checks of every target.
+	HealthCheckManager = proxy.HealthCheckManager
+	// NodeProvider is a single target requests are proxied to.
+	NodeProvider = proxy.NodeProvider
+	// Provider is the transport a NodeProvider forwards requests with.
+	Provider = proxy.Provider
+	// HTTPProvider forwards requests over HTTP.
+	HTTPProvider = proxy.HTTPProvider
+	// IPCProvider forwards requests over the unix socket of a local node.
+	IPCProvider = proxy.IPCProvider
+	// MockProvider answers requests from static responses.
+	MockProvider = proxy.MockProvider
+	// RecentError is a failed attempt of a target.
+	RecentError = proxy.RecentError
+	// Taint is an active taint of a target.
+	Taint = proxy.Taint
+	// CacheFlush is what a flush of the immutable cache dropped.
+	CacheFlush = proxy.CacheFlush
+	// WindowsReset is what a reset of the rolling windows of a target
+	// dropped.
+	WindowsReset = proxy.WindowsReset
+	// ErrorsReset is what a reset of the errors of a target cleared.
+	ErrorsReset = proxy.ErrorsReset
+	// ProviderStatus is a snapshot of the health of a target.
+	ProviderStatus = proxy.ProviderStatus
+	// ProviderStats are the attempts made to a target since the start.
+	ProviderStats = proxy.ProviderStats
+	// RequestTrace is the trace of the upstream attempts of a request.
+	RequestTrace = proxy.RequestTrace
+	// AttemptTrace is a single upstream attempt of a request trace.
+	AttemptTrace = proxy.AttemptTrace
+
+	// TargetSelector decides in which order targets are attempted.
+	TargetSelector = proxy.TargetSelector
+	// HealthObserver is notified of target health transitions.
+	HealthObserver = proxy.HealthObserver
+	// HealthObserverFunc adapts a function to the HealthObserver interface.
+	HealthObserverFunc = proxy.HealthObserverFunc
+)
+
+// Reasons a target is tainted for.
+const (
+	TaintReasonManual          = proxy.TaintReasonManual
+	TaintReasonErrorRate       = proxy.TaintReasonErrorRate
+	TaintReasonBlockLag        = proxy.TaintReasonBlockLag
+	TaintReasonCooldown429     = proxy.TaintReasonCooldown429
+	TaintReasonBudgetExhausted = proxy.TaintReasonBudgetExhausted
+	TaintReasonMaintenance     = proxy.TaintReasonMaintenance
+	TaintReasonMisconfigured   = proxy.TaintReasonMisconfigured
+)
+
+// NewProxy creates a failover proxy.
+func NewProxy(config Config) (*Proxy, error) {
+	return proxy.NewProxy(config)
+}
+
+// NewHealthCheckManager creates a health check manager for the configured
+// targets.
+func NewHealthCheckManager(config HealthCheckManagerConfig) (*HealthCheckManager, error) {
+	return proxy.NewHealthCheckManager(config)
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyFacade(t *testing.T) {
+	prometheus.DefaultRegisterer = prometheus.NewRegistry()
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w,
+			http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+	defer working.Close()
+
+	targets := []TargetConfig{
+		{
+			Name: "Server1",
+			Connection: TargetConnectionConfig{
+				HTTP: TargetConnectionHTTPConfig{
+					URL: failing.URL,
+				},
+			},
+		},
+		{
+			Name: "Server2",
+			Connection: TargetConnectionConfig{
+				HTTP: TargetConnectionHTTPConfig{
+					URL: working.URL,
+				},
+			},
+		},
+	}
+
+	hcm, err := NewHealthCheckManager(HealthCheckManagerConfig{
+		Targets: targets,
+		Logger:  slog.New(slog.NewTextHandler(os.Stderr, nil)),
+	})
+	assert.NoError(t, err)
+
+	p, err := NewProxy(Config{
+		Proxy: ProxyConfig{
+			UpstreamTimeout: time.Second,
+		},
+		Targets:            targets,
+		HealthcheckManager: hcm,
+	})
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	p.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(`{}`)))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "OK", rr.Body.String())
+}
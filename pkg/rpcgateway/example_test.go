@@ -0,0 +1,54 @@
+package rpcgateway_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/pkg/proxy"
+	"github.com/0xProject/rpc-gateway/pkg/rpcgateway"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func ExampleNewRPCGateway() {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x1"}`))
+	}))
+	defer upstream.Close()
+
+	gw, err := rpcgateway.NewRPCGateway(
+		rpcgateway.RPCGatewayConfig{
+			Proxy: proxy.ProxyConfig{
+				UpstreamTimeout: time.Second,
+			},
+			Targets: []proxy.TargetConfig{
+				{
+					Name: "upstream",
+					Connection: proxy.TargetConnectionConfig{
+						HTTP: proxy.TargetConnectionHTTPConfig{
+							URL: upstream.URL,
+						},
+					},
+				},
+			},
+		},
+		rpcgateway.WithRegistry(prometheus.NewRegistry()),
+		rpcgateway.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	body := bytes.NewBufferString(`{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`)
+	req := httptest.NewRequest(http.MethodPost, "/", body)
+	rec := httptest.NewRecorder()
+
+	gw.ServeHTTP(rec, req)
+
+	fmt.Println(rec.Code, rec.Body.String())
+	// Output: 200 {"jsonrpc":"2.0","id":1,"result":"0x1"}
+}
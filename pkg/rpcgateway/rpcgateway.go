@@ -0,0 +1,129 @@
+// Package rpcgateway exposes the gateway and the options customizing it to
+// programs embedding it as a library. It's a thin façade over the internal
+// implementation, so both always behave the same. The types of the proxy
+// configuration are exposed by the proxy package next to it.
+package rpcgateway
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/0xProject/rpc-gateway/internal/buildinfo"
+	"github.com/0xProject/rpc-gateway/internal/metrics"
+	"github.com/0xProject/rpc-gateway/internal/rpcgateway"
+	"github.com/0xProject/rpc-gateway/pkg/proxy"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type (
+	// RPCGateway is the gateway, its proxy, health checks, metrics and
+	// admin servers.
+	RPCGateway = rpcgateway.RPCGateway
+	// RPCGatewayConfig is the configuration file.
+	RPCGatewayConfig = rpcgateway.RPCGatewayConfig //nolint:revive
+	// MetricsConfig is the "metrics" section.
+	MetricsConfig = metrics.Config
+	// AdminConfig is the "admin" section.
+	AdminConfig = rpcgateway.AdminConfig
+	// ListenerConfig is the "listener" section.
+	ListenerConfig = rpcgateway.ListenerConfig
+	// ConfigOverrides replaces values of the configuration, e.g. with
+	// command line flags.
+	ConfigOverrides = rpcgateway.ConfigOverrides
+	// BuildInfo is the build reported by the gateway.
+	BuildInfo = buildinfo.Info
+	// CheckResult is the outcome of RPCGateway.Check.
+	CheckResult = rpcgateway.CheckResult
+	// RemoteConfigSource fetches the configuration from a URL.
+	RemoteConfigSource = rpcgateway.RemoteConfigSource
+	// Option customizes an RPCGateway beyond what the configuration file
+	// can express.
+	Option = rpcgateway.Option
+)
+
+// NewRPCGateway creates a gateway from config.
+func NewRPCGateway(config RPCGatewayConfig, opts ...Option) (*RPCGateway, error) {
+	return rpcgateway.NewRPCGateway(config, opts...)
+}
+
+// NewRPCGatewayFromConfigFile creates a gateway from the configuration file
+// at path.
+func NewRPCGatewayFromConfigFile(path string, opts ...Option) (*RPCGateway, error) {
+	return rpcgateway.NewRPCGatewayFromConfigFile(path, opts...)
+}
+
+// NewRemoteConfigSource creates a source fetching the configuration from
+// rawURL, with token as a bearer token when it's set.
+func NewRemoteConfigSource(rawURL, token string, timeout time.Duration) (*RemoteConfigSource, error) {
+	return rpcgateway.NewRemoteConfigSource(rawURL, token, timeout)
+}
+
+// RunWithRemoteConfig runs a gateway configured from source until c is done,
+// replacing it when the configuration fetched every pollInterval changes.
+func RunWithRemoteConfig(
+	c context.Context,
+	source *RemoteConfigSource,
+	pollInterval time.Duration,
+	stopTimeout time.Duration,
+	opts ...Option,
+) error {
+	return rpcgateway.RunWithRemoteConfig(c, source, pollInterval, stopTimeout, opts...)
+}
+
+// WithLogger replaces the logger used by the gateway.
+func WithLogger(logger *slog.Logger) Option {
+	return rpcgateway.WithLogger(logger)
+}
+
+// WithTransport sets the HTTP transport used to reach the named target, both
+// for proxied requests and health checks.
+func WithTransport(target string, transport http.RoundTripper) Option {
+	return rpcgateway.WithTransport(target, transport)
+}
+
+// WithRegistry registers the gateway metrics with the given registry, which
+// is also the one served by the metrics server.
+func WithRegistry(registry *prometheus.Registry) Option {
+	return rpcgateway.WithRegistry(registry)
+}
+
+// WithHealthListener registers a callback invoked whenever a target becomes
+// healthy or unhealthy.
+func WithHealthListener(listener func(target string, healthy bool)) Option {
+	return rpcgateway.WithHealthListener(listener)
+}
+
+// WithTargetSelector replaces the configured load balancing mode.
+func WithTargetSelector(selector proxy.TargetSelector) Option {
+	return rpcgateway.WithTargetSelector(selector)
+}
+
+// WithConfigOverrides replaces values of the configuration. They apply to
+// every configuration a remote source provides too.
+func WithConfigOverrides(overrides ConfigOverrides) Option {
+	return rpcgateway.WithConfigOverrides(overrides)
+}
+
+// WithBuildInfo sets the build reported by the gateway.
+func WithBuildInfo(build BuildInfo) Option {
+	return rpcgateway.WithBuildInfo(build)
+}
+
+// WithCheckMode prepares the gateway for RPCGateway.Check.
+func WithCheckMode() Option {
+	return rpcgateway.WithCheckMode()
+}
+
+// ProbeReady reports whether the gateway at url, its /readyz endpoint, is
+// ready.
+func ProbeReady(c context.Context, url string) error {
+	return rpcgateway.ProbeReady(c, url)
+}
+
+// ProbeRPC sends an eth_chainId call to the proxy at url, and reports whether
+// a node answered it with a result.
+func ProbeRPC(c context.Context, url string) error {
+	return rpcgateway.ProbeRPC(c, url)
+}
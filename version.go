@@ -0,0 +1,12 @@
+package main
+
+// Set at build time, e.g. with
+// -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse HEAD)".
+// Empty values are taken from the build info embedded by the Go toolchain.
+//
+//nolint:gochecknoglobals
+var (
+	version   string
+	commit    string
+	buildDate string
+)